@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Analyzer plugins --------------------
+
+// Analyzers are external programs that follow the scan and report back,
+// configured under "analyzers" in config.json:
+//
+//	{"name": "backup", "run": "/usr/local/bin/backup-check --repo /mnt/b"}
+//
+// Each is started once through the shell and speaks JSON lines. disktree
+// writes an "entry" event on its stdin for every child of a directory it
+// lists, followed by a "done" event for the directory itself:
+//
+//	{"event":"entry","path":"/home/a/src","name":"src","dir":true,"size":1234,"files":10,"dirs":2}
+//	{"event":"done","path":"/home/a","dir":true,"size":5678,"files":40,"dirs":7}
+//
+// and reads replies from its stdout:
+//
+//	{"type":"hello","column":"Backup"}                 claim a table column
+//	{"type":"column","path":"/home/a/src","value":"✓"}  fill it for a path
+//	{"type":"finding","path":"/home/a/x","severity":"warning","message":"not backed up"}
+//
+// Severity is "info", "warning" or "critical". Findings are listed by f.
+// Events are queued per analyzer and dropped when a slow analyzer falls
+// behind, so an analyzer can never stall a scan.
+type analyzerConfig struct {
+	Name string `json:"name"`
+	Run  string `json:"run"`
+}
+
+// analyzerQueue is how many events wait for an analyzer before new ones
+// are dropped.
+const analyzerQueue = 8192
+
+type analyzerEvent struct {
+	Event string `json:"event"`
+	Path  string `json:"path"`
+	Name  string `json:"name,omitempty"`
+	Dir   bool   `json:"dir,omitempty"`
+	Size  int64  `json:"size"`
+	Files int64  `json:"files,omitempty"`
+	Dirs  int64  `json:"dirs,omitempty"`
+}
+
+type analyzerReply struct {
+	Type     string `json:"type"`
+	Column   string `json:"column,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Value    string `json:"value,omitempty"`
+	Severity string `json:"severity,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// finding is something an analyzer reported about a path.
+type finding struct {
+	analyzer string
+	path     string
+	severity string
+	message  string
+}
+
+func (f finding) icon() string {
+	switch f.severity {
+	case "critical":
+		return "✖"
+	case "warning":
+		return "⚠"
+	}
+	return "ℹ"
+}
+
+type analyzer struct {
+	name    string
+	column  string // claimed with hello; guarded by analyzerSet.mu
+	in      chan analyzerEvent
+	dropped atomic.Int64
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	done    chan struct{} // closed when the process has exited
+}
+
+// analyzerSet runs the configured analyzers and collects what they report.
+// Its methods are safe on a nil *analyzerSet, which has no analyzers.
+type analyzerSet struct {
+	list   []*analyzer
+	notify chan struct{} // signalled when results change
+	// sendMu keeps close from closing queues under a send
+	sendMu sync.RWMutex
+	closed bool
+
+	mu       sync.Mutex
+	columns  []string                     // in the order analyzers claimed them
+	values   map[string]map[string]string // pathKey -> column -> value
+	findings []finding
+	seen     map[finding]bool
+	errs     map[string]string // analyzer -> why it stopped
+	closing  bool
+}
+
+// startAnalyzers starts each configured analyzer. Those that can't be
+// started are reported and left out.
+func startAnalyzers(cfgs []analyzerConfig) (*analyzerSet, []string) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	s := &analyzerSet{notify: make(chan struct{}, 1), values: map[string]map[string]string{}, seen: map[finding]bool{}, errs: map[string]string{}}
+	var problems []string
+	for _, c := range cfgs {
+		if c.Name == "" || strings.TrimSpace(c.Run) == "" {
+			problems = append(problems, fmt.Sprintf("analyzer %q needs a name and run", c.Name))
+			continue
+		}
+		a, err := s.start(c)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("analyzer %s: %v", c.Name, err))
+			continue
+		}
+		s.list = append(s.list, a)
+	}
+	if len(s.list) == 0 {
+		return nil, problems
+	}
+	return s, problems
+}
+
+func (s *analyzerSet) start(c analyzerConfig) (*analyzer, error) {
+	a := &analyzer{name: c.Name, in: make(chan analyzerEvent, analyzerQueue), done: make(chan struct{})}
+	a.cmd = shellCommand(context.Background(), c.Run)
+	var err error
+	if a.stdin, err = a.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	out, err := a.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.cmd.Start(); err != nil {
+		return nil, err
+	}
+	go func() {
+		defer crashGuard()
+		enc := json.NewEncoder(a.stdin)
+		for ev := range a.in {
+			if enc.Encode(ev) != nil {
+				break // it stopped reading; the wait below reports why
+			}
+		}
+		_ = a.stdin.Close()
+		for range a.in {
+		}
+	}()
+	go func() {
+		defer crashGuard()
+		s.read(a, out)
+		err := a.cmd.Wait()
+		close(a.done)
+		s.mu.Lock()
+		if !s.closing {
+			msg := "exited"
+			if err != nil {
+				msg = err.Error()
+			}
+			s.errs[a.name] = msg
+		}
+		s.mu.Unlock()
+		s.changed()
+	}()
+	return a, nil
+}
+
+// read applies an analyzer's replies until it closes its stdout.
+func (s *analyzerSet) read(a *analyzer, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var rep analyzerReply
+		if json.Unmarshal(sc.Bytes(), &rep) != nil {
+			continue // stray output, e.g. a debug print
+		}
+		s.mu.Lock()
+		switch rep.Type {
+		case "hello":
+			if rep.Column != "" && !containsName(s.columns, rep.Column) {
+				s.columns = append(s.columns, rep.Column)
+			}
+			a.column = rep.Column
+		case "column":
+			col := s.columnOf(a, rep.Column)
+			if col != "" && rep.Path != "" {
+				k := pathKey(rep.Path)
+				if s.values[k] == nil {
+					s.values[k] = map[string]string{}
+				}
+				s.values[k][col] = sanitizeLine(rep.Value)
+			}
+		case "finding":
+			f := finding{analyzer: a.name, path: rep.Path, severity: rep.Severity, message: sanitizeLine(rep.Message)}
+			if rep.Path != "" && !s.seen[f] {
+				s.seen[f] = true
+				s.findings = append(s.findings, f)
+			}
+		}
+		s.mu.Unlock()
+		s.changed()
+	}
+}
+
+// columnOf is the column a value reply fills: the one it names, else the
+// one the analyzer claimed. Callers hold s.mu.
+func (s *analyzerSet) columnOf(a *analyzer, named string) string {
+	if named != "" && containsName(s.columns, named) {
+		return named
+	}
+	return a.column
+}
+
+func (s *analyzerSet) changed() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// send queues ev for every analyzer.
+func (s *analyzerSet) send(ev analyzerEvent) {
+	if s == nil {
+		return
+	}
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	if s.closed {
+		return
+	}
+	for _, a := range s.list {
+		select {
+		case <-a.done:
+		case a.in <- ev:
+		default:
+			a.dropped.Add(1)
+		}
+	}
+}
+
+// sendListing reports a listed directory and its sized children.
+func (s *analyzerSet) sendListing(n *Node) {
+	if s == nil {
+		return
+	}
+	for _, c := range n.Children {
+		s.send(analyzerEvent{Event: "entry", Path: c.Path, Name: c.Name, Dir: c.IsDir, Size: c.Size, Files: c.Files, Dirs: c.Dirs})
+	}
+	s.send(analyzerEvent{Event: "done", Path: n.Path, Dir: true, Size: n.Size, Files: n.Files, Dirs: n.Dirs})
+}
+
+// cols returns the table columns claimed so far.
+func (s *analyzerSet) cols() []string {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.columns...)
+}
+
+// value is what the analyzers put in column col for path.
+func (s *analyzerSet) value(path, col string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[pathKey(path)][col]
+}
+
+// report returns the findings so far and the analyzers that stopped.
+func (s *analyzerSet) report() ([]finding, map[string]string) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errs := make(map[string]string, len(s.errs))
+	for k, v := range s.errs {
+		errs[k] = v
+	}
+	return append([]finding(nil), s.findings...), errs
+}
+
+// lagging describes analyzers that fell behind and missed events.
+func (s *analyzerSet) lagging() []string {
+	if s == nil {
+		return nil
+	}
+	var out []string
+	for _, a := range s.list {
+		if n := a.dropped.Load(); n > 0 {
+			out = append(out, fmt.Sprintf("analyzer %s fell behind: %d events dropped", a.name, n))
+		}
+	}
+	return out
+}
+
+// findingsUnder counts the findings at or below dir.
+func (s *analyzerSet) findingsUnder(dir string) int {
+	fs, _ := s.report()
+	n := 0
+	for _, f := range fs {
+		if underPath(f.path, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+// close ends the analyzers' input and gives them a moment to finish.
+func (s *analyzerSet) close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.sendMu.Lock()
+	s.closed = true
+	for _, a := range s.list {
+		close(a.in)
+	}
+	s.sendMu.Unlock()
+	deadline := time.After(2 * time.Second)
+	for _, a := range s.list {
+		select {
+		case <-a.done:
+		case <-deadline:
+			_ = a.cmd.Process.Kill()
+		}
+	}
+}
+
+// analyzersMsg tells the model analyzer results changed.
+type analyzersMsg struct{}
+
+// wait returns a command that fires when results change.
+func (s *analyzerSet) wait() tea.Cmd {
+	if s == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		<-s.notify
+		// coalesce bursts of replies into one redraw
+		time.Sleep(50 * time.Millisecond)
+		return analyzersMsg{}
+	}
+}
+
+// applyAnalyzers picks up new columns and values and listens again.
+func (m *model) applyAnalyzers() tea.Cmd {
+	if cols := m.scanner.analyzers.cols(); len(cols) != len(m.pluginCols) {
+		m.pluginCols = cols
+		m.reflowColumns()
+	}
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	return m.scanner.analyzers.wait()
+}
+
+// findingsOverlay lists what the analyzers reported; Enter goes to the
+// directory holding the selected path.
+type findingsOverlay struct {
+	list   []finding
+	errs   map[string]string
+	cursor int
+}
+
+func newFindingsOverlay(m *model) *findingsOverlay {
+	fs, errs := m.scanner.analyzers.report()
+	return &findingsOverlay{list: fs, errs: errs}
+}
+
+func (o *findingsOverlay) opts() overlayOpts {
+	return overlayOpts{id: "findings", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *findingsOverlay) visibleRows(m *model) int {
+	_, h := m.screenSize()
+	return maxvalue(3, minvalue(20, h-10-len(o.errs)))
+}
+
+func (o *findingsOverlay) View(m *model) string {
+	w := m.popupWidth(96)
+	inner := maxvalue(10, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(fmt.Sprintf("Findings (%d)", len(o.list))), ""}
+	for _, name := range slices.Sorted(maps.Keys(o.errs)) {
+		lines = append(lines, truncateToWidth(fmt.Sprintf("⚠ analyzer %s stopped: %s", name, o.errs[name]), inner))
+	}
+	for _, l := range m.scanner.analyzers.lagging() {
+		lines = append(lines, truncateToWidth("⚠ "+l, inner))
+	}
+	if len(o.list) == 0 {
+		msg := "nothing reported"
+		if m.scanner.analyzers == nil {
+			msg = "no analyzers configured (see \"analyzers\" in the config)"
+		}
+		lines = append(lines, faint.Render(msg))
+	}
+	rows := o.visibleRows(m)
+	start := maxvalue(0, minvalue(o.cursor-rows/2, len(o.list)-rows))
+	for i := start; i < len(o.list) && i < start+rows; i++ {
+		f := o.list[i]
+		path := sanitizeLine(f.path)
+		if rel, err := filepath.Rel(m.rootPath, f.path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		line := truncateToWidth(fmt.Sprintf("%s %-10s %s — %s", f.icon(), truncateToWidth(f.analyzer, 10), path, f.message), inner)
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", faint.Render("↑/↓ move  Enter go to  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *findingsOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "f", "q":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(o.list)-1), o.cursor+1)
+	case "pgup":
+		o.cursor = maxvalue(0, o.cursor-o.visibleRows(m))
+	case "pgdown":
+		o.cursor = minvalue(maxvalue(0, len(o.list)-1), o.cursor+o.visibleRows(m))
+	case "enter":
+		if o.cursor >= len(o.list) {
+			return nil, false
+		}
+		if m.loading {
+			m.status = "Wait for the scan to finish before jumping to a directory"
+			return nil, true
+		}
+		return m.gotoPath(filepath.Dir(o.list[o.cursor].path)), true
+	}
+	return nil, false
+}
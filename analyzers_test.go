@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tagBig is an analyzer that claims a column and flags files named big.bin.
+const tagBig = `echo '{"type":"hello","column":"Tag"}'
+while IFS= read -r line; do
+  case "$line" in
+  *'"name":"big.bin"'*)
+    p=$(printf '%s' "$line" | sed 's/.*"path":"\([^"]*\)".*/\1/')
+    echo "{\"type\":\"column\",\"path\":\"$p\",\"value\":\"HOT\"}"
+    echo "{\"type\":\"finding\",\"path\":\"$p\",\"severity\":\"warning\",\"message\":\"large file\"}";;
+  esac
+done`
+
+func TestAnalyzerPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "tag.sh")
+	if err := os.WriteFile(script, []byte(tagBig), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, problems := startAnalyzers([]analyzerConfig{{Name: "tagger", Run: "sh " + shellQuote(script)}, {Name: "broken"}})
+	if s == nil || len(problems) != 1 {
+		t.Fatalf("want one analyzer running and the broken one reported, got %v", problems)
+	}
+	big := filepath.Join(dir, "big.bin")
+	s.sendListing(&Node{Path: dir, Size: 10, Children: []*Node{
+		{Name: "small.txt", Path: filepath.Join(dir, "small.txt"), Size: 1},
+		{Name: "big.bin", Path: big, Size: 9},
+	}})
+	deadline := time.Now().Add(5 * time.Second)
+	for s.findingsUnder(dir) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no findings from the analyzer")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.scanner.analyzers = s
+	m.width, m.height = 120, 20
+	m.current = &Node{Name: "root", Path: dir, IsDir: true, Scanned: true, Size: 10, Children: []*Node{{Name: "big.bin", Path: big, Size: 9}}}
+	m.applyAnalyzers()
+	cols := m.tbl.Columns()
+	if cols[len(cols)-1].Title != "Tag" || m.tbl.Rows()[0][len(cols)-1] != "HOT" {
+		t.Fatalf("expected the analyzer's column and value in the table")
+	}
+	if v := m.View(); !strings.Contains(v, "[1 findings: f]") {
+		t.Fatalf("expected the findings count in the header")
+	}
+	fs, errs := s.report()
+	if len(fs) != 1 || fs[0].message != "large file" || len(errs) != 0 {
+		t.Fatalf("findings = %+v, errors %v", fs, errs)
+	}
+	s.close()
+	if _, errs := s.report(); len(errs) != 0 {
+		t.Fatalf("closing should not be reported as a failure: %v", errs)
+	}
+}
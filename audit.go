@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Audit log ---------------------------
+
+// Every delete, restore and move disktree makes is appended to an audit
+// log, one JSON object per line, so whoever looks after a shared machine
+// can account for what the tool changed and who ran it. The log is only
+// ever appended to; H shows it. -audit-log picks another file or turns it
+// off.
+
+// auditEntry is one line of the audit log.
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Session string    `json:"session"` // one per run of disktree
+	User    string    `json:"user"`
+	Action  string    `json:"action"` // trash, delete, restore, rename, offload, purge
+	Path    string    `json:"path"`
+	To      string    `json:"to,omitempty"` // where a restore or rename put it; an offload's target
+	Size    int64     `json:"size,omitempty"`
+	Result  string    `json:"result"` // "ok" or the error
+}
+
+var (
+	auditMu  sync.Mutex
+	auditLog string // -audit-log: a file, "off", or "" for the default
+	// auditSession tells this run's entries from other runs' in the log
+	auditSession = fmt.Sprintf("%d-%d", os.Getpid(), time.Now().Unix())
+)
+
+// auditFile is the log written to, "" when it is off.
+func auditFile() string {
+	switch auditLog {
+	case "off":
+		return ""
+	case "":
+		return filepath.Join(dataDir(), "audit.log")
+	}
+	return auditLog
+}
+
+// auditUser is who runs disktree, as the log records it.
+func auditUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return os.Getenv("USERNAME")
+}
+
+// audit appends an entry for action on target; err is its outcome. A log
+// that can't be written doesn't stop the action, which already happened.
+func audit(action, target, to string, size int64, err error) {
+	path := auditFile()
+	if path == "" {
+		return
+	}
+	// the log outlives the working directory paths are relative to
+	target = auditPath(target)
+	if action != "offload" && to != "" { // an offload's is a target's name
+		to = auditPath(to)
+	}
+	if to == target {
+		to = "" // restored where it came from
+	}
+	e := auditEntry{Time: time.Now().UTC(), Session: auditSession, User: auditUser(), Action: action, Path: target, To: to, Size: maxInt64(size, 0), Result: "ok"}
+	if err != nil {
+		e.Result = err.Error()
+	}
+	line, jerr := json.Marshal(e)
+	if jerr != nil {
+		return
+	}
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	if os.MkdirAll(filepath.Dir(path), 0o755) != nil {
+		return
+	}
+	f, ferr := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if ferr != nil {
+		return
+	}
+	_, _ = f.Write(append(line, '\n'))
+	_ = f.Close()
+}
+
+// auditPath is p made absolute, as far as that works.
+func auditPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// readAudit reads the audit log, oldest first; a missing log is empty and
+// lines that don't parse are skipped.
+func readAudit(path string) ([]auditEntry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []auditEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e auditEntry
+		if json.Unmarshal(sc.Bytes(), &e) == nil {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// auditOverlay shows the audit log, newest first: this session's entries,
+// or every session's with a.
+type auditOverlay struct {
+	entries []auditEntry // newest first
+	all     bool
+	offset  int
+	err     error
+}
+
+// openAudit loads the log into a new viewer.
+func openAudit(all bool) *auditOverlay {
+	o := &auditOverlay{all: all}
+	o.load()
+	return o
+}
+
+func (o *auditOverlay) load() {
+	entries, err := readAudit(auditFile())
+	o.entries, o.err, o.offset = o.entries[:0], err, 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if o.all || entries[i].Session == auditSession {
+			o.entries = append(o.entries, entries[i])
+		}
+	}
+}
+
+func (o *auditOverlay) opts() overlayOpts {
+	return overlayOpts{id: "audit", z: zDialog, dim: true, focusable: true}
+}
+
+// rows is how many entries fit in the viewer.
+func (o *auditOverlay) rows(m *model) int { return maxvalue(3, m.height-12) }
+
+func (o *auditOverlay) View(m *model) string {
+	w := m.popupWidth(100)
+	inner := maxvalue(40, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	title := "Audit log — this session"
+	if o.all {
+		title = "Audit log — all sessions"
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(title), faint.Render(truncateToWidth(auditFile(), inner)), ""}
+	switch {
+	case auditFile() == "":
+		lines = append(lines, faint.Render("the audit log is off (-audit-log off)"))
+	case o.err != nil:
+		lines = append(lines, warn.Render("⚠ "+o.err.Error()))
+	case len(o.entries) == 0:
+		lines = append(lines, faint.Render("nothing deleted, restored or moved yet"))
+	}
+	o.offset = minvalue(o.offset, maxvalue(0, len(o.entries)-o.rows(m)))
+	for _, e := range o.entries[o.offset:minvalue(len(o.entries), o.offset+o.rows(m))] {
+		when := e.Time.Local().Format(time.DateTime)
+		if !o.all {
+			when = e.Time.Local().Format(time.TimeOnly)
+		}
+		line := fmt.Sprintf("%s  %-8s %9s  ", when, e.Action, humanBytes(e.Size))
+		if o.all {
+			line += fmt.Sprintf("%-10s ", truncateToWidth(e.User, 10))
+		}
+		what := e.Path
+		if e.To != "" {
+			what += " → " + e.To
+		}
+		if e.Result != "ok" {
+			what += "  ⚠ " + e.Result
+		}
+		line += truncateToWidth(what, maxvalue(1, inner-lipgloss.Width(line)))
+		if e.Result != "ok" {
+			line = warn.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if n := len(o.entries); n > o.rows(m) {
+		lines = append(lines, faint.Render(fmt.Sprintf("%d–%d of %d", o.offset+1, minvalue(n, o.offset+o.rows(m)), n)))
+	}
+	toggle := "a all sessions"
+	if o.all {
+		toggle = "a this session"
+	}
+	lines = append(lines, "", faint.Render("↑/↓ scroll  "+toggle+"  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *auditOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	last := maxvalue(0, len(o.entries)-o.rows(m))
+	switch msg.String() {
+	case "esc", "q", "H":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.offset = maxvalue(0, o.offset-1)
+	case "down", "j":
+		o.offset = minvalue(last, o.offset+1)
+	case "pgup":
+		o.offset = maxvalue(0, o.offset-o.rows(m))
+	case "pgdown", " ":
+		o.offset = minvalue(last, o.offset+o.rows(m))
+	case "a":
+		o.all = !o.all
+		o.load()
+	}
+	return nil, false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withAuditLog points the audit log at a temporary file for the test.
+func withAuditLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	old := auditLog
+	auditLog = path
+	t.Cleanup(func() { auditLog = old })
+	return path
+}
+
+func TestAuditLogsDeleteAndUndo(t *testing.T) {
+	path := withAuditLog(t)
+	h := newTUIHarness(t, 120, 30)
+	h.m.confirmSkipBelow = 50
+
+	// rows by size: alpha 5 KB, readme.md 2 KB, beta 100 B, zeta.log 10 B
+	h.keys("down", "down", "down", "d")
+	h.keys("u")
+	entries, err := readAudit(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want a trash and a restore: %+v", len(entries), entries)
+	}
+	zeta := filepath.Join(h.tmp, "zeta.log")
+	for i, want := range []string{"trash", "restore"} {
+		e := entries[i]
+		if e.Action != want || e.Path != zeta || e.Result != "ok" || e.Size != 10 {
+			t.Errorf("entry %d = %+v, want %s of %s (10 B) ok", i, e, want, zeta)
+		}
+		if e.Session != auditSession || e.User == "" || e.Time.IsZero() {
+			t.Errorf("entry %d lacks who or when: %+v", i, e)
+		}
+	}
+}
+
+func TestAuditRecordsFailuresAndIsAppendOnly(t *testing.T) {
+	path := withAuditLog(t)
+	if err := os.WriteFile(path, []byte(`{"action":"trash","path":"/earlier","result":"ok"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	audit("rename", "/a", "/b", 0, errors.New("b already exists"))
+	audit("restore", "/c", "/c", 7, nil)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "/earlier") {
+		t.Fatalf("log was not appended to:\n%s", data)
+	}
+	var e auditEntry
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Result != "b already exists" || e.To != "/b" {
+		t.Errorf("failed rename logged as %+v", e)
+	}
+	e = auditEntry{}
+	if err := json.Unmarshal([]byte(lines[2]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.To != "" {
+		t.Errorf("a restore to the original path shouldn't repeat it: %+v", e)
+	}
+
+	auditLog = "off"
+	audit("trash", "/d", "", 0, nil)
+	if after, _ := os.ReadFile(path); len(after) != len(data) {
+		t.Error("-audit-log off still wrote to the log")
+	}
+}
+
+func TestAuditOverlayShowsSessionThenAll(t *testing.T) {
+	path := withAuditLog(t)
+	line, _ := json.Marshal(auditEntry{Session: "other", User: "root", Action: "delete", Path: "/srv/old-backups", Result: "ok"})
+	if err := os.WriteFile(path, append(line, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	audit("trash", "/home/me/cache", "", 1<<20, nil)
+
+	h := newTUIHarness(t, 120, 30)
+	h.keys("H")
+	o, ok := h.m.overlays.focused().(*auditOverlay)
+	if !ok {
+		t.Fatalf("H should open the audit log, got %T", h.m.overlays.focused())
+	}
+	view := o.View(h.m)
+	if !strings.Contains(view, "/home/me/cache") || strings.Contains(view, "old-backups") {
+		t.Fatalf("the viewer should start with this session's entries only:\n%s", view)
+	}
+	h.keys("a")
+	if view = o.View(h.m); !strings.Contains(view, "old-backups") || !strings.Contains(view, "root") {
+		t.Fatalf("a should show every session, with its user:\n%s", view)
+	}
+	if len(o.entries) != 2 || o.entries[0].Path != "/home/me/cache" {
+		t.Fatalf("entries should be newest first: %+v", o.entries)
+	}
+	h.keys("esc")
+	if h.m.overlays.focused() != nil {
+		t.Fatal("esc should close the audit log")
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Backup coverage ---------------------
+
+// Formats of -backup-format.
+const (
+	backupAuto   = "auto"
+	backupBorg   = "borg"
+	backupRestic = "restic"
+)
+
+// backupRule is one include or exclude line of a backup tool's config.
+type backupRule struct {
+	include   bool
+	noRecurse bool // borg's "!": excluded without looking inside
+	match     func(p string) bool
+}
+
+// backupRules decides what a backup covers, from a borg patterns file
+// (--patterns-from: R roots, P styles, +/-/! lines, first match wins) or a
+// restic exclude file (--exclude-file: globs, ! re-includes, last match
+// wins). A pattern matching a directory matches everything inside it.
+type backupRules struct {
+	format string
+	roots  []string // empty: everything is a root
+	rules  []backupRule
+	// includes is set when some rule re-includes paths, so excluded
+	// directories must be looked into
+	includes bool
+}
+
+// loadBackupRules reads path in format; extra roots are added to the ones
+// a borg file names (restic's roots are its command-line arguments).
+func loadBackupRules(file, format string, roots []string) (*backupRules, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	switch format {
+	case "", backupAuto:
+		format = detectBackupFormat(lines)
+	case backupBorg, backupRestic:
+	default:
+		return nil, fmt.Errorf("unknown backup format %q (want auto, borg or restic)", format)
+	}
+	r := &backupRules{format: format}
+	for _, root := range roots {
+		if abs, err := filepath.Abs(expandHome(root)); err == nil {
+			r.roots = append(r.roots, abs)
+		}
+	}
+	if format == backupBorg {
+		err = r.parseBorg(lines)
+	} else {
+		err = r.parseRestic(lines)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return r, nil
+}
+
+var borgLineRE = regexp.MustCompile(`^[RrPp+\-!] `)
+
+// detectBackupFormat picks borg when lines carry its "X " prefixes.
+func detectBackupFormat(lines []string) string {
+	for _, l := range lines {
+		if borgLineRE.MatchString(strings.TrimSpace(l)) {
+			return backupBorg
+		}
+	}
+	return backupRestic
+}
+
+func (r *backupRules) parseBorg(lines []string) error {
+	style := "sh"
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if len(l) < 3 || l[1] != ' ' {
+			return fmt.Errorf("line %d: %q is not a borg pattern line", i+1, l)
+		}
+		arg := strings.TrimSpace(l[2:])
+		switch l[0] {
+		case 'R', 'r':
+			r.roots = append(r.roots, filepath.Clean(arg))
+		case 'P', 'p':
+			style = arg
+		case '+', '-', '!':
+			m, err := borgMatcher(arg, style)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+1, err)
+			}
+			r.rules = append(r.rules, backupRule{include: l[0] == '+', noRecurse: l[0] == '!', match: m})
+			r.includes = r.includes || l[0] == '+'
+		default:
+			return fmt.Errorf("line %d: unknown borg pattern type %q", i+1, l[:1])
+		}
+	}
+	return nil
+}
+
+// borgMatcher compiles a pattern of one of borg's styles (fm, sh, re, pp,
+// pf), chosen by its prefix or the current default. Paths are matched
+// without their leading slash, as borg stores them.
+func borgMatcher(pat, style string) (func(string) bool, error) {
+	if len(pat) > 3 && pat[2] == ':' {
+		style, pat = pat[:2], pat[3:]
+	}
+	if style != "re" {
+		pat = strings.Trim(pat, "/")
+	}
+	switch style {
+	case "pp":
+		return func(p string) bool { return p == pat || strings.HasPrefix(p, pat+"/") }, nil
+	case "pf":
+		return func(p string) bool { return p == pat }, nil
+	case "re":
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	case "fm", "sh":
+		re, err := regexp.Compile("^" + globRegexp(pat, style == "sh") + "(?:/.*)?$")
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown pattern style %q", style)
+}
+
+// globRegexp translates a glob to a regular expression. In shell style *
+// and ? stop at slashes and **/ spans directories; in fnmatch style *
+// matches slashes too.
+func globRegexp(pat string, shell bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(pat); i++ {
+		switch c := pat[i]; {
+		case shell && strings.HasPrefix(pat[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case shell && strings.HasPrefix(pat[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*' && shell:
+			sb.WriteString("[^/]*")
+		case c == '*':
+			sb.WriteString(".*")
+		case c == '?' && shell:
+			sb.WriteString("[^/]")
+		case c == '?':
+			sb.WriteString(".")
+		case c == '[':
+			end := strings.IndexByte(pat[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pat[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return sb.String()
+}
+
+func (r *backupRules) parseRestic(lines []string) error {
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		include := strings.HasPrefix(l, "!")
+		pat := os.ExpandEnv(strings.TrimPrefix(l, "!"))
+		if _, err := path.Match(strings.ReplaceAll(pat, "**", "*"), ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", l, err)
+		}
+		r.rules = append(r.rules, backupRule{include: include, match: resticMatcher(pat)})
+		r.includes = r.includes || include
+	}
+	return nil
+}
+
+// resticMatcher matches like restic's filter package: component by
+// component, ** for any number of them, anywhere in the path unless the
+// pattern starts with a slash.
+func resticMatcher(pat string) func(string) bool {
+	anchored := strings.HasPrefix(pat, "/")
+	pc := strings.Split(strings.Trim(pat, "/"), "/")
+	return func(p string) bool {
+		xc := strings.Split(p, "/")
+		if anchored {
+			return matchComponents(pc, xc)
+		}
+		for i := range xc {
+			if matchComponents(pc, xc[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// matchComponents reports whether pc matches xc or a leading part of it,
+// i.e. the path or one of its ancestors.
+func matchComponents(pc, xc []string) bool {
+	if len(pc) == 0 {
+		return true
+	}
+	if pc[0] == "**" {
+		for i := 0; i <= len(xc); i++ {
+			if matchComponents(pc[1:], xc[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(xc) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pc[0], xc[0])
+	return ok && matchComponents(pc[1:], xc[1:])
+}
+
+// check reports whether p itself is left out of the backup, and whether
+// what is inside it may be judged differently.
+func (r *backupRules) check(p string, isDir bool) (excluded, descend bool) {
+	if len(r.roots) > 0 {
+		in := false
+		for _, root := range r.roots {
+			if samePath(p, root) || underPath(p, root) {
+				in = true
+				break
+			}
+		}
+		if !in {
+			// the way down to a root is walked, but not backed up
+			for _, root := range r.roots {
+				if isDir && underPath(root, p) {
+					return false, true
+				}
+			}
+			return true, false
+		}
+	}
+	sp := strings.TrimPrefix(filepath.ToSlash(p), "/")
+	var decided *backupRule
+	for i := range r.rules {
+		if r.rules[i].match(sp) {
+			decided = &r.rules[i]
+			if r.format == backupBorg {
+				break // first match wins
+			}
+		}
+	}
+	if decided == nil || decided.include {
+		return false, true
+	}
+	return true, r.includes && !decided.noRecurse
+}
+
+// coverageResult is how much of a directory's contents the backup misses.
+type coverageResult struct {
+	done        bool
+	total       int64
+	unprotected map[string]int64 // by pathKey of the directory's children
+}
+
+// backupCoverage works out, in the background, how many bytes below the
+// directory being viewed the backup leaves out. Excluded directories are
+// sized with the scanner's incremental walk; everything else is listed
+// again, since exclusions may pick single files.
+type backupCoverage struct {
+	rules   *backupRules
+	s       *Scanner
+	mu      sync.Mutex
+	results map[string]*coverageResult // by pathKey
+	cancel  context.CancelFunc
+	pending string // pathKey of the directory being worked on
+	notify  chan struct{}
+}
+
+func newBackupCoverage(r *backupRules, s *Scanner) *backupCoverage {
+	return &backupCoverage{rules: r, s: s, results: map[string]*coverageResult{}, notify: make(chan struct{}, 1)}
+}
+
+// result is what is known of dir so far, or nil.
+func (b *backupCoverage) result(dir string) *coverageResult {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.results[pathKey(dir)]
+}
+
+// request starts working out dir unless it is known or under way. Only
+// the latest directory is worked on.
+func (b *backupCoverage) request(ctx context.Context, dir string) {
+	if b == nil {
+		return
+	}
+	key := pathKey(dir)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.results[key]; ok {
+		return
+	}
+	if b.cancel != nil {
+		b.cancel()
+		delete(b.results, b.pending)
+	}
+	res := &coverageResult{unprotected: map[string]int64{}}
+	b.results[key] = res
+	ctx, cancel := context.WithCancel(ctx)
+	b.cancel, b.pending = cancel, key
+	go func() {
+		defer crashGuard()
+		unprotected, total := b.measure(ctx, dir)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		res.unprotected, res.total, res.done = unprotected, total, true
+		b.cancel, b.pending = nil, ""
+		cancel()
+		select {
+		case b.notify <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// forget drops what is known of p and the directories above it, after a
+// rescan or a change made here.
+func (b *backupCoverage) forget(p string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k, res := range b.results {
+		if res.done && (samePath(k, p) || underPath(p, k)) {
+			delete(b.results, k)
+		}
+	}
+}
+
+// measure sums the unprotected bytes of each of dir's children.
+func (b *backupCoverage) measure(ctx context.Context, dir string) (map[string]int64, int64) {
+	out := map[string]int64{}
+	var total int64
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return out, 0
+	}
+	for _, e := range ents {
+		p := filepath.Join(dir, e.Name())
+		u := b.unprotected(ctx, p, e)
+		out[pathKey(p)] = u
+		total += u
+	}
+	return out, total
+}
+
+func (b *backupCoverage) unprotected(ctx context.Context, p string, e fs.DirEntry) int64 {
+	if ctx.Err() != nil || e.Type()&fs.ModeSymlink != 0 || b.s.ignored.has(p) {
+		return 0
+	}
+	excluded, descend := b.rules.check(p, e.IsDir())
+	if !e.IsDir() {
+		if !excluded {
+			return 0
+		}
+		fi, err := e.Info()
+		if err != nil || b.s.exclude.excludes(fi) {
+			return 0
+		}
+		return b.s.fileSize(p, fi)
+	}
+	if excluded && !descend {
+		sum, _ := b.s.walkSum(ctx, p, true)
+		return sum.size
+	}
+	ents, err := os.ReadDir(p)
+	if err != nil {
+		return 0
+	}
+	var n int64
+	for _, c := range ents {
+		n += b.unprotected(ctx, filepath.Join(p, c.Name()), c)
+	}
+	return n
+}
+
+// backupMsg tells the model a coverage result is ready.
+type backupMsg struct{}
+
+func (b *backupCoverage) wait() tea.Cmd {
+	if b == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		<-b.notify
+		time.Sleep(50 * time.Millisecond)
+		return backupMsg{}
+	}
+}
+
+// backupTag is the row note of a child: nothing when fully covered.
+func (m *model) backupTag(res *coverageResult, c *Node) string {
+	if res == nil || !res.done {
+		return ""
+	}
+	u := res.unprotected[pathKey(c.Path)]
+	switch {
+	case u <= 0:
+		return ""
+	case u >= c.Size:
+		return "  [not backed up]"
+	}
+	return "  [" + humanBytes(u) + " not backed up]"
+}
+
+// backupHeader totals the unprotected bytes of the current directory.
+func (m *model) backupHeader() string {
+	if m.backup == nil || m.current == nil {
+		return ""
+	}
+	res := m.backup.result(m.current.Path)
+	switch {
+	case res == nil || !res.done:
+		return "[backup: checking ...]"
+	case res.total == 0:
+		return "[backup: all covered]"
+	}
+	return "[backup: " + humanBytes(res.total) + " not backed up]"
+}
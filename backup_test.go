@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRulesBorg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("borg roots are POSIX paths")
+	}
+	dir := t.TempDir()
+	file := filepath.Join(dir, "patterns.lst")
+	content := "# borg patterns\nR /home/u\nP sh\n+ home/u/cache/keep\n- home/u/cache\n! re:\\.tmp$\n- fm:*/node_modules\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadBackupRules(file, backupAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.format != backupBorg {
+		t.Fatalf("format = %q, want borg", r.format)
+	}
+	for _, tc := range []struct {
+		path              string
+		isDir             bool
+		excluded, descend bool
+	}{
+		{"/home/u/docs/a.txt", false, false, true},
+		{"/home/u/cache", true, true, true}, // "-" keeps looking for includes
+		{"/home/u/cache/keep/x", false, false, true},
+		{"/home/u/cache/other", false, true, true},
+		{"/home/u/x.tmp", false, true, false},
+		{"/home/u/src/app/node_modules/lib", true, true, true},
+		{"/home", true, false, true}, // on the way to the root
+		{"/etc/passwd", false, true, false},
+	} {
+		ex, desc := r.check(tc.path, tc.isDir)
+		if ex != tc.excluded || desc != tc.descend {
+			t.Errorf("check(%s) = %v, %v; want %v, %v", tc.path, ex, desc, tc.excluded, tc.descend)
+		}
+	}
+}
+
+func TestBackupRulesRestic(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "excludes")
+	content := "# restic excludes\n*.iso\n/var/cache\n**/build/**/*.o\n$DT_TEST_DIR\n!important.iso\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DT_TEST_DIR", "scratch")
+	r, err := loadBackupRules(file, backupAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.format != backupRestic {
+		t.Fatalf("format = %q, want restic", r.format)
+	}
+	for path, want := range map[string]bool{
+		"/data/linux.iso":           true,
+		"/data/important.iso":       false, // last match wins
+		"/var/cache/apt/x.deb":      true,
+		"/srv/var/cache":            false, // anchored
+		"/src/build/x/y/main.o":     true,
+		"/src/build/main.c":         false,
+		"/home/u/scratch/notes.txt": true,
+		"/home/u/notes.txt":         false,
+	} {
+		if ex, _ := r.check(path, false); ex != want {
+			t.Errorf("check(%s) excluded = %v, want %v", path, ex, want)
+		}
+	}
+	if _, err := loadBackupRules(file, "tar", nil); err == nil {
+		t.Error("an unknown format should be refused")
+	}
+}
+
+func TestBackupCoverage(t *testing.T) {
+	dir := t.TempDir()
+	write := func(rel string, n int) {
+		p := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, n), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("docs/a.txt", 100)
+	write("docs/b.iso", 1000)
+	write("vm/disk.iso", 5000)
+	write("vm/disk.iso.keep", 10)
+	write("notes.txt", 7)
+	file := filepath.Join(t.TempDir(), "excludes")
+	if err := os.WriteFile(file, []byte("*.iso\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadBackupRules(file, backupRestic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBackupCoverage(r, &Scanner{threads: 2, mounts: systemMounts(), netThreads: defaultNetThreads, root: dir})
+	b.request(context.Background(), dir)
+	select {
+	case <-b.notify:
+	case <-time.After(10 * time.Second):
+		t.Fatal("coverage never finished")
+	}
+	res := b.result(dir)
+	if res == nil || !res.done {
+		t.Fatal("no result")
+	}
+	if res.total != 6000 {
+		t.Errorf("total = %d, want 6000", res.total)
+	}
+	if got := res.unprotected[pathKey(filepath.Join(dir, "docs"))]; got != 1000 {
+		t.Errorf("docs = %d, want 1000", got)
+	}
+	m := &model{backup: b}
+	vm := &Node{Name: "vm", Path: filepath.Join(dir, "vm"), Size: 5010}
+	if tag := m.backupTag(res, vm); !strings.Contains(tag, "4.9 KB not backed up") {
+		t.Errorf("vm tag = %q", tag)
+	}
+	if tag := m.backupTag(res, &Node{Name: "notes.txt", Path: filepath.Join(dir, "notes.txt"), Size: 7}); tag != "" {
+		t.Errorf("a covered file should carry no tag, got %q", tag)
+	}
+
+	b.forget(filepath.Join(dir, "vm"))
+	if b.result(dir) != nil {
+		t.Error("a change below dir should drop its result")
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Basket ------------------------------
+
+// basketItem is an entry pinned with b, with its totals when it was pinned
+// in case it has left the cache since.
+type basketItem struct {
+	path  string
+	isDir bool
+	size  int64
+	files int64
+	dirs  int64
+}
+
+// basket gathers candidates from anywhere in the tree, so entries from
+// different branches can be weighed side by side (B) before anything is
+// deleted. It lasts for the session.
+type basket struct {
+	items []basketItem
+}
+
+// index is the position of path in the basket, or -1.
+func (b *basket) index(path string) int {
+	for i, it := range b.items {
+		if samePath(it.path, path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// togglePinned pins n to the basket, or unpins it if it is there.
+func (m *model) togglePinned(n *Node) {
+	b := &m.basket
+	if i := b.index(n.Path); i >= 0 {
+		b.items = slices.Delete(b.items, i, i+1)
+		m.status = fmt.Sprintf("Unpinned %s — basket: %d", n.Name, len(b.items))
+	} else {
+		b.items = append(b.items, basketItem{path: n.Path, isDir: n.IsDir, size: n.Size, files: n.Files, dirs: n.Dirs})
+		m.status = fmt.Sprintf("Pinned %s — basket: %d, B compares them", n.Name, len(b.items))
+	}
+	m.setTableRowsFromNode(m.current)
+}
+
+// basketEntries are the pinned entries that still exist, with their latest
+// known totals, largest first.
+func (m *model) basketEntries() []basketItem {
+	var out []basketItem
+	for _, it := range m.basket.items {
+		if _, err := os.Lstat(it.path); err != nil && m.listing == nil {
+			continue // deleted or moved since
+		}
+		if v, ok := cache.Load(pathKey(it.path)); ok {
+			n := v.(*Node)
+			it.size, it.files, it.dirs = n.Size, n.Files, n.Dirs
+		} else if n := m.cachedChild(it.path); n != nil {
+			it.size, it.files, it.dirs = n.Size, n.Files, n.Dirs
+		}
+		out = append(out, it)
+	}
+	slices.SortStableFunc(out, func(a, b basketItem) int {
+		switch {
+		case a.size > b.size:
+			return -1
+		case a.size < b.size:
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+// basketTag is the header note of a non-empty basket.
+func (m *model) basketTag() string {
+	if len(m.basket.items) == 0 {
+		return ""
+	}
+	var size int64
+	for _, it := range m.basketEntries() {
+		size += max(0, it.size)
+	}
+	return fmt.Sprintf("[basket: %d, %s — B]", len(m.basket.items), humanBytes(size))
+}
+
+// basketOverlay shows the pinned entries side by side: sizes, a bar
+// relative to the largest and each one's share of the basket.
+type basketOverlay struct {
+	cursor int
+}
+
+func (o *basketOverlay) opts() overlayOpts {
+	return overlayOpts{id: "basket", z: zDialog, dim: true, focusable: true}
+}
+
+// rows is how many entries fit in the dialog.
+func (o *basketOverlay) rows(m *model) int {
+	_, h := m.screenSize()
+	return maxvalue(3, h-12)
+}
+
+func (o *basketOverlay) View(m *model) string {
+	w := m.popupWidth(90)
+	inner := maxvalue(30, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	items := m.basketEntries()
+	var total, largest int64
+	for _, it := range items {
+		total += max(0, it.size)
+		largest = max(largest, it.size)
+	}
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(fmt.Sprintf("Basket — %d pinned, %s", len(items), humanBytes(total))),
+		"",
+	}
+	if len(items) == 0 {
+		lines = append(lines, faint.Render("empty: b pins the selection from any directory"))
+	}
+	o.cursor = minvalue(o.cursor, maxvalue(0, len(items)-1))
+	rows := o.rows(m)
+	first := maxvalue(0, minvalue(o.cursor-rows/2, len(items)-rows))
+	for i := first; i < minvalue(len(items), first+rows); i++ {
+		it := items[i]
+		share := 0.0
+		if total > 0 {
+			share = float64(max(0, it.size)) / float64(total)
+		}
+		rel := 0.0
+		if largest > 0 {
+			rel = float64(max(0, it.size)) / float64(largest)
+		}
+		prefix := fmt.Sprintf("%10s  %s %5.1f%%  ", humanBytes(max(0, it.size)), bar(rel, 12), share*100)
+		path := sanitizeLine(it.path)
+		if it.isDir {
+			path += string(filepath.Separator)
+		}
+		if room := inner - lipgloss.Width(prefix); lipgloss.Width(path) > room {
+			// keep the end of long paths, that's where the name is
+			path = "…" + extractAfterPosition(path, lipgloss.Width(path)-room+1)
+		}
+		line := prefix + path
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", faint.Render("↑/↓ move  Enter go to  x unpin  d delete  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *basketOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	items := m.basketEntries()
+	var sel *basketItem
+	if o.cursor < len(items) {
+		sel = &items[o.cursor]
+	}
+	switch msg.String() {
+	case "esc", "q", "B":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(items)-1), o.cursor+1)
+	case "x", "delete":
+		if sel != nil {
+			if i := m.basket.index(sel.path); i >= 0 {
+				m.basket.items = slices.Delete(m.basket.items, i, i+1)
+			}
+			if m.current != nil {
+				m.setTableRowsFromNode(m.current)
+			}
+		}
+	case "enter":
+		if sel == nil {
+			return nil, false
+		}
+		if m.loading {
+			m.status = "Wait for the scan to finish before jumping to a directory"
+			return nil, true
+		}
+		return m.gotoPath(filepath.Dir(sel.path)), true
+	case "d":
+		if sel == nil {
+			return nil, false
+		}
+		if m.listing != nil || m.loading {
+			m.status = "Deleting from the basket needs the real files and a finished scan"
+			return nil, false
+		}
+		// the dialog opens above the basket, which shows the entry gone
+		// once it is
+		return m.promptDelete(&Node{Name: filepath.Base(sel.path), Path: sel.path, IsDir: sel.isDir, Size: sel.size, Files: sel.files, Dirs: sel.dirs}), false
+	}
+	return nil, false
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBasketPinsAndCompares(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	h.keys("b", "down", "b")
+	got := h.m.basketEntries()
+	if len(got) != 2 || !strings.HasSuffix(got[0].path, "alpha") || got[0].size != 5120 || got[1].size != 2048 {
+		t.Fatalf("basket = %+v", got)
+	}
+	if tag := h.m.basketTag(); tag != "[basket: 2, 7.0 KB — B]" {
+		t.Errorf("tag = %q", tag)
+	}
+	if !strings.Contains(h.m.tbl.Rows()[0][0], "[pinned]") {
+		t.Errorf("alpha's row should say it is pinned: %q", h.m.tbl.Rows()[0][0])
+	}
+
+	h.keys("B")
+	view := h.m.overlays.get("basket").View(h.m)
+	if !strings.Contains(view, "2 pinned, 7.0 KB") || !strings.Contains(view, "71.4%") {
+		t.Errorf("basket view:\n%s", view)
+	}
+	// x unpins the largest, under the cursor
+	h.keys("x")
+	if got := h.m.basketEntries(); len(got) != 1 || got[0].size != 2048 {
+		t.Errorf("after x: %+v", got)
+	}
+	h.keys("esc", "b")
+	if len(h.m.basket.items) != 0 {
+		t.Errorf("b on a pinned row should unpin it, basket %+v", h.m.basket.items)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Benchmarks for the scan path and table building. Compare runs with
+// benchstat before and after performance-sensitive changes:
+//
+//	go test -run '^$' -bench . -count 10 ./... > old.txt
+//	(apply change)
+//	go test -run '^$' -bench . -count 10 ./... > new.txt
+//	benchstat old.txt new.txt
+
+// benchTree describes a synthetic directory tree.
+type benchTree struct {
+	name  string
+	dirs  int // directories per level
+	depth int // levels below the root
+	files int // files per directory
+	size  int // bytes per file
+}
+
+var benchTrees = []benchTree{
+	{name: "wide", dirs: 500, depth: 1, files: 4, size: 512},
+	{name: "deep", dirs: 1, depth: 200, files: 2, size: 512},
+	{name: "many-small-files", dirs: 10, depth: 2, files: 100, size: 1},
+}
+
+var benchTreeDirs sync.Map // name -> root, built once per test binary
+
+// buildBenchTree creates t under a shared temp dir and returns its root.
+// Trees are reused across benchmarks and removed when the binary exits.
+func buildBenchTree(b *testing.B, t benchTree) string {
+	b.Helper()
+	if v, ok := benchTreeDirs.Load(t.name); ok {
+		return v.(string)
+	}
+	root, err := os.MkdirTemp("", "disktree-bench-"+t.name+"-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, t.size)
+	var fill func(dir string, level int)
+	fill = func(dir string, level int) {
+		for i := 0; i < t.files; i++ {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%03d", i)), data, 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if level == t.depth {
+			return
+		}
+		for i := 0; i < t.dirs; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("d%03d", i))
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				b.Fatal(err)
+			}
+			fill(sub, level+1)
+		}
+	}
+	fill(root, 0)
+	benchTreeDirs.Store(t.name, root)
+	return root
+}
+
+func TestMain(m *testing.M) {
+	// tests that delete aren't what the real audit log is for; audit_test
+	// points it at a file of its own
+	auditLog = "off"
+	// runExec and runTrash read auditLog back from the config, and trash,
+	// journal and audit log all live in the data dir: keep them all off the
+	// real one. The crash test's child gets a data dir from its parent.
+	data, err := os.MkdirTemp("", "disktree-data-")
+	if err != nil {
+		panic(err)
+	}
+	if os.Getenv("DISKTREE_CRASH_CHILD") == "" {
+		os.Setenv("XDG_DATA_HOME", data)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(data)
+	benchTreeDirs.Range(func(_, v any) bool {
+		_ = os.RemoveAll(v.(string))
+		return true
+	})
+	os.Exit(code)
+}
+
+func BenchmarkSumDir(b *testing.B) {
+	for _, tree := range benchTrees {
+		b.Run(tree.name, func(b *testing.B) {
+			root := buildBenchTree(b, tree)
+			s := &Scanner{threads: 16, mounts: newMountTable(nil)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if res := s.sumDir(context.Background(), root); res.err != nil {
+					b.Fatal(res.err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	for _, tree := range benchTrees {
+		b.Run(tree.name, func(b *testing.B) {
+			root := buildBenchTree(b, tree)
+			s := &Scanner{threads: 16, mounts: newMountTable(nil)}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if n, _ := s.scan(context.Background(), root, false, nil); n.Err != nil {
+					b.Fatal(n.Err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSetTableRowsFromNode(b *testing.B) {
+	const children = 100_000
+	n := &Node{Name: "big", Path: "/nonexistent/big", IsDir: true, Scanned: true}
+	for i := 0; i < children; i++ {
+		n.Children = append(n.Children, &Node{
+			Name: fmt.Sprintf("file-%06d.dat", i),
+			Path: fmt.Sprintf("/nonexistent/big/file-%06d.dat", i),
+			Size: int64(i*7919) % 1_000_000, Files: 1,
+		})
+	}
+	m := initialModel("/nonexistent/big", 1, false)
+	m.width, m.height = 160, 50
+	m.reflowColumns()
+	m.loading = false
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.setTableRowsFromNode(n)
+	}
+}
+
+// BenchmarkChildUpdates feeds a running scan's updates for a directory of
+// 20,000 children (files, then the sizes of pending subdirectories) and
+// renders after every 100, as the debounce would.
+func BenchmarkChildUpdates(b *testing.B) {
+	const children = 20_000
+	for i := 0; i < b.N; i++ {
+		m := initialModel("/nonexistent/big", 1, false)
+		m.width, m.height = 160, 50
+		m.reflowColumns()
+		m.current = &Node{Name: "big", Path: "/nonexistent/big", IsDir: true}
+		for j := 0; j < 2*children; j++ {
+			k := j % children
+			c := &Node{Name: fmt.Sprintf("d-%06d", k), Path: fmt.Sprintf("/nonexistent/big/d-%06d", k), IsDir: true, Size: -1}
+			if j >= children {
+				c.Size = int64(k*7919) % 1_000_000
+			}
+			m.placeChild(m.current, c)
+			if j%100 == 0 {
+				m.sortChildren(m.current)
+			}
+		}
+	}
+}
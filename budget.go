@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --------------------------- Scan budget -------------------------
+
+// scanBudget bounds each scan for a quick triage of a huge volume:
+// -budget 30s stops descending after thirty seconds, -budget 2M files
+// after two million files. Directories not reached by then are estimated
+// from the ones that were walked and marked with "~".
+type scanBudget struct {
+	time  time.Duration // 0 = no time limit
+	files int64         // 0 = no file limit
+	spec  string        // as given, for the header
+}
+
+// parseBudget parses "30s", "5m" or a file count such as "500000 files"
+// or "2M files" (k, M and G are powers of ten here). "" is no budget.
+func parseBudget(s string) (*scanBudget, error) {
+	t := strings.TrimSpace(s)
+	if t == "" {
+		return nil, nil
+	}
+	if n, ok := strings.CutSuffix(strings.ToLower(t), "files"); ok {
+		n = strings.TrimSpace(n)
+		mult := int64(1)
+		switch {
+		case strings.HasSuffix(n, "k"):
+			mult, n = 1e3, strings.TrimSuffix(n, "k")
+		case strings.HasSuffix(n, "m"):
+			mult, n = 1e6, strings.TrimSuffix(n, "m")
+		case strings.HasSuffix(n, "g"):
+			mult, n = 1e9, strings.TrimSuffix(n, "g")
+		}
+		v, err := strconv.ParseFloat(n, 64)
+		if err != nil || v < 1 {
+			return nil, fmt.Errorf("invalid budget %q (e.g. 30s or 2M files)", s)
+		}
+		return &scanBudget{files: int64(v * float64(mult)), spec: t}, nil
+	}
+	d, err := time.ParseDuration(t)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid budget %q (e.g. 30s or 2M files)", s)
+	}
+	return &scanBudget{time: d, spec: t}, nil
+}
+
+// budgetRun is one scan's budget, shared by the walks sizing its
+// children, with what they have walked so far.
+type budgetRun struct {
+	deadline time.Time
+	maxFiles int64
+	files    atomic.Int64
+	size     atomic.Int64
+	dirs     atomic.Int64
+}
+
+// start begins a run of b; nil without a budget.
+func (b *scanBudget) start() *budgetRun {
+	if b == nil {
+		return nil
+	}
+	r := &budgetRun{maxFiles: b.files}
+	if b.time > 0 {
+		r.deadline = time.Now().Add(b.time)
+	}
+	return r
+}
+
+// spent reports whether walks should stop descending.
+func (r *budgetRun) spent() bool {
+	if r == nil {
+		return false
+	}
+	return r.maxFiles > 0 && r.files.Load() >= r.maxFiles ||
+		!r.deadline.IsZero() && time.Now().After(r.deadline)
+}
+
+// walked counts a listed directory and the files directly in it.
+func (r *budgetRun) walked(files, size int64) {
+	if r == nil {
+		return
+	}
+	r.dirs.Add(1)
+	r.files.Add(files)
+	r.size.Add(size)
+}
+
+// estimate is what a directory that wasn't walked is taken to hold: the
+// average of the directories that were. It counts the directory alone, so
+// deep trees come out low; that is the price of the budget.
+func (r *budgetRun) estimate() (size, files int64) {
+	d := r.dirs.Load()
+	if d == 0 {
+		return 0, 0
+	}
+	return r.size.Load() / d, r.files.Load() / d
+}
+
+type budgetKey struct{}
+
+// withBudget carries a scan's budget run to the walks under ctx.
+func withBudget(ctx context.Context, r *budgetRun) context.Context {
+	if r == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, budgetKey{}, r)
+}
+
+// budgetFrom is the budget run of the scan ctx belongs to, or nil.
+func budgetFrom(ctx context.Context) *budgetRun {
+	r, _ := ctx.Value(budgetKey{}).(*budgetRun)
+	return r
+}
+
+// budgetTag is the header note when the current directory's totals are in
+// part estimates.
+func (m *model) budgetTag() string {
+	if m.scanner.budget == nil || m.current == nil || !m.current.Estimated {
+		return ""
+	}
+	return "[budget of " + m.scanner.budget.spec + " spent: ~ sizes are estimates]"
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBudget(t *testing.T) {
+	for in, want := range map[string]scanBudget{
+		"30s":          {time: 30 * time.Second},
+		"5m":           {time: 5 * time.Minute},
+		"500000 files": {files: 500000},
+		"2M files":     {files: 2000000},
+		"1.5kfiles":    {files: 1500},
+	} {
+		b, err := parseBudget(in)
+		if err != nil || b.time != want.time || b.files != want.files {
+			t.Errorf("parseBudget(%q) = %+v, %v; want %+v", in, b, err, want)
+		}
+	}
+	if b, err := parseBudget(""); b != nil || err != nil {
+		t.Errorf("no budget should be nil, got %v, %v", b, err)
+	}
+	for _, in := range []string{"soon", "-3s", "0 files", "lots files"} {
+		if _, err := parseBudget(in); err == nil {
+			t.Errorf("parseBudget(%q) should fail", in)
+		}
+	}
+}
+
+func TestBudgetEstimatesWhatIsLeft(t *testing.T) {
+	r := (&scanBudget{files: 10}).start()
+	r.walked(4, 400)
+	r.walked(2, 200)
+	if r.spent() {
+		t.Fatal("6 of 10 files should leave budget")
+	}
+	if size, files := r.estimate(); size != 300 || files != 3 {
+		t.Fatalf("estimate = %d bytes, %d files; want the per-directory average 300, 3", size, files)
+	}
+	r.walked(4, 0)
+	if !r.spent() {
+		t.Fatal("10 of 10 files should spend the budget")
+	}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "b", "f"), make([]byte, 50), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 1, mounts: newMountTable(nil), budget: &scanBudget{time: time.Nanosecond, spec: "1ns"}}
+	n, _ := s.scan(context.Background(), root, false, nil)
+	if len(n.Children) != 1 || !n.Children[0].Estimated || !n.Estimated {
+		t.Fatalf("a spent budget should estimate a: %+v", n.Children)
+	}
+	s.budget = nil
+	n, _ = s.scan(context.Background(), root, false, nil)
+	if c := n.Children[0]; c.Estimated || c.Size != 50 {
+		t.Fatalf("without a budget a is walked: %+v", c)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Size changes ------------------------
+
+// changeHighlight is how long rows that changed in a rescan stay marked.
+const changeHighlight = 4 * time.Second
+
+// changeFadeMsg clears the change markers once the highlight has expired.
+type changeFadeMsg struct{}
+
+// rememberSizes records the sizes of n's children before a rescan so the
+// result can be compared against them.
+func (m *model) rememberSizes(n *Node) {
+	m.rescanPrev = nil
+	if n == nil || !n.Scanned {
+		return
+	}
+	m.rescanPrev = make(map[string]int64, len(n.Children))
+	for _, c := range n.Children {
+		m.rescanPrev[pathKey(c.Path)] = c.Size
+	}
+}
+
+// applySizeChanges compares a finished rescan with the remembered sizes.
+// Deltas stay next to the size for the rest of the session (until the
+// directory is rescanned again); changed rows are marked only briefly.
+func (m *model) applySizeChanges(n *Node) tea.Cmd {
+	prev := m.rescanPrev
+	m.rescanPrev = nil
+	if prev == nil {
+		return nil
+	}
+	if m.sizeDeltas == nil {
+		m.sizeDeltas = map[string]int64{}
+	}
+	changed := false
+	for _, c := range n.Children {
+		key := pathKey(c.Path)
+		delete(m.sizeDeltas, key)
+		old, seen := prev[key]
+		if c.Size < 0 || (seen && (old < 0 || old == c.Size)) {
+			continue
+		}
+		m.sizeDeltas[key] = c.Size - old // old is 0 for new entries
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	m.changedUntil = time.Now().Add(changeHighlight)
+	return tea.Tick(changeHighlight, func(time.Time) tea.Msg { return changeFadeMsg{} })
+}
+
+// sizeCell renders a size with the delta from the last rescan, e.g.
+// "12.3 GB (+1.1 GB)", prefixed with ▲/▼ while the change is fresh.
+func (m *model) sizeCell(c *Node) string {
+	s := humanBytes(c.Size)
+	d, ok := m.sizeDeltas[pathKey(c.Path)]
+	if !ok {
+		return s
+	}
+	sign, mark := "+", "▲ "
+	if d < 0 {
+		sign, mark, d = "-", "▼ ", -d
+	}
+	s += " (" + sign + humanBytes(d) + ")"
+	if time.Now().Before(m.changedUntil) {
+		s = mark + s
+	}
+	return s
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// --------------------------- Chart view --------------------------
+
+// chartSlices is how many children get a slice of their own; the rest are
+// lumped together.
+const chartSlices = 8
+
+// chartPalette colors the slices in order, largest first; the last color
+// is for the remainder.
+var chartPalette = []color.RGBA{
+	{0x4e, 0x79, 0xa7, 0xff}, {0xf2, 0x8e, 0x2b, 0xff}, {0xe1, 0x57, 0x59, 0xff}, {0x76, 0xb7, 0xb2, 0xff},
+	{0x59, 0xa1, 0x4f, 0xff}, {0xed, 0xc9, 0x48, 0xff}, {0xb0, 0x7a, 0xa1, 0xff}, {0xff, 0x9d, 0xa7, 0xff},
+	{0x79, 0x70, 0x6e, 0xff},
+}
+
+// chartFills tell the slices apart where the terminal has no colors.
+const chartFills = "#%@*+=o~:"
+
+// slice is one wedge of the donut.
+type slice struct {
+	name string
+	size int64
+}
+
+// chartOverlay shows the current directory's largest children as a donut
+// with a legend, for a quick picture of where the space goes. It is drawn
+// with half blocks, or as a real picture with -graphics.
+type chartOverlay struct {
+	title  string
+	total  int64
+	slices []slice
+}
+
+func newChartOverlay(m *model) *chartOverlay {
+	o := &chartOverlay{title: m.breadcrumb()}
+	if m.current == nil {
+		return o
+	}
+	var kids []*Node
+	for _, c := range m.current.Children {
+		if c.Size > 0 {
+			kids = append(kids, c)
+		}
+	}
+	sort.SliceStable(kids, func(i, j int) bool { return kids[i].Size > kids[j].Size })
+	var rest slice
+	for i, c := range kids {
+		o.total += c.Size
+		name := sanitizeLine(c.Name)
+		if c.IsDir {
+			name += "/"
+		}
+		if i < chartSlices {
+			o.slices = append(o.slices, slice{name: name, size: c.Size})
+			continue
+		}
+		rest.size += c.Size
+		rest.name = fmt.Sprintf("%d others", i-chartSlices+1)
+	}
+	if rest.size > 0 {
+		o.slices = append(o.slices, rest)
+	}
+	return o
+}
+
+func (o *chartOverlay) opts() overlayOpts {
+	return overlayOpts{id: "chart", z: zDialog, dim: true, focusable: true}
+}
+
+// sliceAt returns the slice under the point (x, y) of a donut of radius 1
+// centered on the origin, or -1 for the hole and outside. Slices run
+// clockwise from 12 o'clock.
+func (o *chartOverlay) sliceAt(x, y float64) int {
+	d := math.Hypot(x, y)
+	if d > 1 || d < 0.55 || o.total <= 0 {
+		return -1
+	}
+	turn := math.Atan2(x, -y) / (2 * math.Pi)
+	if turn < 0 {
+		turn++
+	}
+	at := int64(turn * float64(o.total))
+	for i, s := range o.slices {
+		if at < s.size {
+			return i
+		}
+		at -= s.size
+	}
+	return len(o.slices) - 1
+}
+
+// sliceColor is the palette entry for slice i; the remainder is always
+// drawn in the last color.
+func (o *chartOverlay) sliceColor(i int) color.RGBA {
+	if i == chartSlices {
+		return chartPalette[len(chartPalette)-1]
+	}
+	return chartPalette[i%(len(chartPalette)-1)]
+}
+
+func hexColor(c color.RGBA) lipgloss.Color {
+	return lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B))
+}
+
+// donut draws the chart in w×h cells: a picture with a graphics protocol,
+// else half blocks showing two pixels per cell, else fill characters.
+func (o *chartOverlay) donut(g graphicsProtocol, w, h int) []string {
+	if g != graphicsNone {
+		img := image.NewRGBA(image.Rect(0, 0, w*cellPixelsW, h*cellPixelsH))
+		r := float64(min(img.Rect.Dx(), img.Rect.Dy())) / 2
+		for y := 0; y < img.Rect.Dy(); y++ {
+			for x := 0; x < img.Rect.Dx(); x++ {
+				if i := o.sliceAt((float64(x)+0.5-r)/r, (float64(y)+0.5-r)/r); i >= 0 {
+					img.SetRGBA(x, y, o.sliceColor(i))
+				}
+			}
+		}
+		if lines, ok := graphicsImage(g, img, w, h); ok {
+			return lines
+		}
+	}
+	// a cell is about twice as tall as wide: w columns by 2h pixel rows
+	// make a square
+	r := float64(min(w, 2*h)) / 2
+	at := func(x, y int) int { return o.sliceAt((float64(x)+0.5-r)/r, (float64(y)+0.5-r)/r) }
+	ascii := lipgloss.ColorProfile() == termenv.Ascii
+	lines := make([]string, h)
+	for cy := 0; cy < h; cy++ {
+		var sb strings.Builder
+		for x := 0; x < w; x++ {
+			top, bottom := at(x, 2*cy), at(x, 2*cy+1)
+			switch {
+			case ascii:
+				if top < 0 {
+					top = bottom
+				}
+				if top < 0 {
+					sb.WriteByte(' ')
+				} else {
+					sb.WriteByte(chartFills[min(top, len(chartFills)-1)])
+				}
+			case top >= 0:
+				st := lipgloss.NewStyle().Foreground(hexColor(o.sliceColor(top)))
+				if bottom >= 0 {
+					st = st.Background(hexColor(o.sliceColor(bottom)))
+				}
+				sb.WriteString(st.Render("▀"))
+			case bottom >= 0:
+				sb.WriteString(lipgloss.NewStyle().Foreground(hexColor(o.sliceColor(bottom))).Render("▄"))
+			default:
+				sb.WriteByte(' ')
+			}
+		}
+		lines[cy] = sb.String()
+	}
+	return lines
+}
+
+func (o *chartOverlay) View(m *model) string {
+	w := m.popupWidth(84)
+	inner := maxvalue(20, w-6)
+	_, sh := m.screenSize()
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(truncateToWidth("Composition of "+sanitizeLine(o.title), inner)), ""}
+	if o.total <= 0 {
+		lines = append(lines, faint.Render("nothing to chart here"))
+	} else {
+		// the donut is square on screen; the legend takes what is left
+		dh := maxvalue(4, minvalue(12, sh-10))
+		dw := minvalue(2*dh, maxvalue(8, inner-30))
+		dh = dw / 2
+		g := m.graphics
+		if m.overlays.focused() != overlay(o) {
+			g = graphicsNone // another dialog is drawn over the chart
+		}
+		donut := o.donut(g, dw, dh)
+
+		var legend []string
+		ascii := lipgloss.ColorProfile() == termenv.Ascii
+		room := inner - dw - 3
+		for i, s := range o.slices {
+			swatch := lipgloss.NewStyle().Foreground(hexColor(o.sliceColor(i))).Render("██")
+			if ascii {
+				swatch = strings.Repeat(string(chartFills[min(i, len(chartFills)-1)]), 2)
+			}
+			nums := fmt.Sprintf("%9s %5.1f%%", humanBytes(s.size), 100*float64(s.size)/float64(o.total))
+			name := truncateToWidth(s.name, maxvalue(1, room-lipgloss.Width(nums)-4))
+			pad := maxvalue(1, room-3-lipgloss.Width(name)-lipgloss.Width(nums))
+			legend = append(legend, swatch+" "+name+strings.Repeat(" ", pad)+nums)
+		}
+		legend = append(legend, "", faint.Render(fmt.Sprintf("total %s", humanBytes(o.total))))
+		lines = append(lines, lipgloss.JoinHorizontal(lipgloss.Top, strings.Join(donut, "\n"), "   ", strings.Join(legend, "\n")))
+	}
+	lines = append(lines, "", faint.Render("v / Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *chartOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "v", "q", "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestChartSlices(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.current = &Node{Name: "root", Path: "/r", Size: 1000}
+	for i := range 11 {
+		m.current.Children = append(m.current.Children, &Node{Name: fmt.Sprintf("f%d", i), Size: int64(100 - i)})
+	}
+	m.current.Children = append(m.current.Children, &Node{Name: "empty", Size: 0})
+
+	o := newChartOverlay(m)
+	if len(o.slices) != chartSlices+1 || o.slices[0].name != "f0" {
+		t.Fatalf("want the %d largest and a remainder, got %+v", chartSlices, o.slices)
+	}
+	if rest := o.slices[chartSlices]; rest.name != "3 others" || rest.size != 92+91+90 {
+		t.Fatalf("remainder = %+v; want 3 others of 273 bytes", rest)
+	}
+	// slices run clockwise from the top; the hole and corners are empty
+	if i := o.sliceAt(0.01, -0.9); i != 0 {
+		t.Fatalf("just right of 12 o'clock should be the largest slice, got %d", i)
+	}
+	if i := o.sliceAt(-0.01, -0.9); i != chartSlices {
+		t.Fatalf("just left of 12 o'clock should be the remainder, got %d", i)
+	}
+	if o.sliceAt(0, 0) != -1 || o.sliceAt(0.9, 0.9) != -1 {
+		t.Fatalf("the hole and the corners should be empty")
+	}
+
+	m.overlays.push(o)
+	if v := m.View(); !strings.Contains(v, "Composition of") || !strings.Contains(v, "3 others") {
+		t.Fatalf("expected the chart with its legend:\n%s", v)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io/fs"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Cloud placeholders ------------------
+
+// Files synced by OneDrive, iCloud Drive or Dropbox can be placeholders:
+// they report their full length but their data stays online until opened.
+// They are counted at that length, as everywhere else, and the part of a
+// total they make up is kept apart (Node.Cloud) so rows and the summary can
+// say how much is really on this disk, and the cleanup score goes by that.
+
+// placeholder is scanner.Placeholder; tests replace it.
+var placeholder = scanner.Placeholder
+
+// cloudPart is the part of the file fi, counted as size, that is online
+// only.
+func cloudPart(fi fs.FileInfo, size int64) int64 {
+	if placeholder(fi) {
+		return size
+	}
+	return 0
+}
+
+// localSize is what n takes on this disk, leaving out online-only files.
+func localSize(n *Node) int64 {
+	return max(0, n.Size-n.Cloud)
+}
+
+// cloudTag is the row note of an entry that is, or holds, placeholders.
+func cloudTag(n *Node) string {
+	switch {
+	case n.Cloud <= 0 || n.Size < 0:
+		return ""
+	case !n.IsDir:
+		return "  [☁ online-only]"
+	case n.Cloud >= n.Size:
+		return "  [☁ all online-only]"
+	}
+	return "  [☁ " + humanBytes(n.Cloud) + " online-only, " + humanBytes(localSize(n)) + " local]"
+}
+
+// cloudSummary is the summary line's part for the current directory's
+// placeholders.
+func cloudSummary(n *Node) string {
+	if n.Cloud <= 0 {
+		return ""
+	}
+	return humanBytes(localSize(n)) + " local · ☁ " + humanBytes(n.Cloud) + " online-only"
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+func TestPlaceholdersShowLocalSize(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "synced"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"synced/online.mov": 9000, "synced/local.txt": 1000} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	placeholder = func(fi fs.FileInfo) bool { return strings.HasPrefix(fi.Name(), "online") }
+	t.Cleanup(func() { placeholder = scanner.Placeholder })
+	s := &Scanner{threads: 1, mounts: newMountTable(nil)}
+	n, _ := s.scan(context.Background(), root, false, nil)
+	if len(n.Children) != 1 {
+		t.Fatalf("children = %+v", n.Children)
+	}
+	synced := n.Children[0]
+	if synced.Size != 10000 || synced.Cloud != 9000 || localSize(synced) != 1000 || n.Cloud != 9000 {
+		t.Fatalf("synced = %d bytes, %d online-only; root %d online-only", synced.Size, synced.Cloud, n.Cloud)
+	}
+	if tag := cloudTag(synced); !strings.Contains(tag, "online-only") || !strings.Contains(tag, "local") {
+		t.Errorf("cloudTag = %q", tag)
+	}
+	if s := cloudSummary(n); !strings.Contains(s, "local") {
+		t.Errorf("cloudSummary = %q", s)
+	}
+	trashed := &Node{Size: 10000, Cloud: 10000}
+	applyDelta(trashed, trashDelta(&TrashItem{Size: 10000, Cloud: 10000}).negate())
+	if trashed.Cloud != 0 {
+		t.Errorf("a delete should take its online-only part along, left %d", trashed.Cloud)
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- User commands -----------------------
+
+// userCommand binds a key to an external command, configured under
+// "commands" in config.json:
+//
+//	{"key": "U", "name": "usage", "run": "du -sh {}"}
+//
+// {} is replaced with the selected path and {dir} with the current
+// directory, both quoted for the shell. Output is shown in a scrollable
+// dialog; with "terminal" the command gets the terminal instead (editors,
+// pagers). "rescan" rescans the current directory once it finishes.
+type userCommand struct {
+	Key      string `json:"key"`
+	Name     string `json:"name,omitempty"`
+	Run      string `json:"run"`
+	Terminal bool   `json:"terminal,omitempty"`
+	Rescan   bool   `json:"rescan,omitempty"`
+}
+
+// commandOutputLimit bounds the output kept for the dialog.
+const commandOutputLimit = 1 << 20
+
+func (c userCommand) label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Run
+}
+
+// userCommandKeys checks the configured commands and maps them by key.
+// Commands on a key a built-in action already uses are left out and
+// reported, since the built-in would always win.
+func userCommandKeys(cmds []userCommand) (map[string]userCommand, []string) {
+	out := map[string]userCommand{}
+	var problems []string
+	for _, c := range cmds {
+		switch {
+		case c.Key == "" || strings.TrimSpace(c.Run) == "":
+			problems = append(problems, fmt.Sprintf("command %q needs a key and run", c.label()))
+		case builtinKey(c.Key):
+			problems = append(problems, fmt.Sprintf("key %s of command %q is a built-in", c.Key, c.label()))
+		default:
+			out[c.Key] = c
+		}
+	}
+	return out, problems
+}
+
+// builtinKey reports whether k is bound by the main view, as listed in the
+// help (plus the keys every terminal app reserves).
+func builtinKey(k string) bool {
+	switch k {
+	case "up", "down", "left", "right", "tab", "pgup", "pgdown", "home", "end", "j", "k", "enter", "backspace", "esc", "ctrl+c":
+		return true
+	}
+	for _, h := range helpKeys {
+		for _, b := range strings.Split(h[0], " / ") {
+			if b == k || strings.EqualFold(b, k) && len(b) > 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// expand substitutes the placeholders of c's command line.
+func (c userCommand) expand(sel, dir string) string {
+	return strings.NewReplacer("{}", shellQuote(sel), "{dir}", shellQuote(dir)).Replace(c.Run)
+}
+
+// shellQuote quotes s as one word for the shell commands run through.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return cmdQuote(s)
+	}
+	return posixQuote(s)
+}
+
+// cmdQuote quotes s as one word for cmd. cmd expands %VAR% even between
+// quotes, so % and ^ step out of them to be escaped with ^.
+func cmdQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, `""`, "%", `"^%"`, "^", `"^^"`).Replace(s) + `"`
+}
+
+// posixQuote quotes s as one word for sh, on any platform.
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellCommand runs line through the platform shell: always /bin/sh, not
+// $SHELL, since the placeholders are quoted for sh and fish or nushell
+// read those quotes differently.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", line)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", line)
+}
+
+// commandOutput collects a running command's output for the dialog.
+type commandOutput struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (o *commandOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if room := commandOutputLimit - o.buf.Len(); len(p) > room {
+		o.buf.Write(p[:max(0, room)])
+		o.truncated = true
+	} else {
+		o.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+func (o *commandOutput) lines() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := strings.TrimRight(strings.ReplaceAll(o.buf.String(), "\r\n", "\n"), "\n")
+	var out []string
+	if s != "" {
+		out = strings.Split(s, "\n")
+	}
+	if o.truncated {
+		out = append(out, "… output truncated")
+	}
+	return out
+}
+
+// commandTickMsg redraws the output dialog while its command runs.
+type commandTickMsg struct{}
+
+// commandDoneMsg reports a finished user command.
+type commandDoneMsg struct {
+	cmd userCommand
+	err error
+}
+
+func commandTick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(time.Time) tea.Msg { return commandTickMsg{} })
+}
+
+// runUserCommand starts c on the selection.
+func (m *model) runUserCommand(c userCommand) tea.Cmd {
+	sel := m.selected()
+	if sel == nil || m.current == nil {
+		m.status = "Nothing selected for " + c.label()
+		return nil
+	}
+	line := c.expand(sel.Path, m.current.Path)
+	if c.Terminal {
+		m.status = "Running " + c.label() + " ..."
+		return tea.ExecProcess(shellCommand(context.Background(), line), func(err error) tea.Msg {
+			return commandDoneMsg{cmd: c, err: err}
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &commandOverlay{cmd: c, line: line, target: filepath.Base(sel.Path), cancel: cancel, running: true}
+	x := shellCommand(ctx, line)
+	x.Stdout, x.Stderr = &o.out, &o.out
+	x.Dir = m.current.Path
+	if err := x.Start(); err != nil {
+		cancel()
+		m.status = fmt.Sprintf("⚠ %s: %v", c.label(), err)
+		return nil
+	}
+	m.overlays.push(o)
+	m.status = "Running " + c.label() + " ..."
+	done := func() tea.Msg {
+		defer crashGuard()
+		err := x.Wait()
+		if ctx.Err() != nil {
+			err = fmt.Errorf("canceled")
+		}
+		cancel()
+		return commandDoneMsg{cmd: c, err: err}
+	}
+	return tea.Batch(done, commandTick())
+}
+
+// applyCommandDone reports a finished command and rescans if it asked to.
+func (m *model) applyCommandDone(msg commandDoneMsg) tea.Cmd {
+	if o, ok := m.overlays.get("command").(*commandOverlay); ok && o.cmd.Run == msg.cmd.Run {
+		o.running, o.err = false, msg.err
+	}
+	if msg.err != nil {
+		m.status = fmt.Sprintf("⚠ %s: %v", msg.cmd.label(), msg.err)
+	} else {
+		m.status = msg.cmd.label() + " finished"
+	}
+	if !msg.cmd.Rescan || m.loading {
+		return nil
+	}
+	return func() tea.Msg { return rescanMsg{} }
+}
+
+// commandOverlay shows a user command's output as it arrives. Closing it
+// stops a command that is still running.
+type commandOverlay struct {
+	cmd      userCommand
+	line     string
+	target   string
+	out      commandOutput
+	cancel   context.CancelFunc
+	running  bool
+	err      error
+	offset   int  // first output line shown
+	scrolled bool // the user scrolled up; don't jump to new output
+}
+
+func (o *commandOverlay) opts() overlayOpts {
+	return overlayOpts{id: "command", z: zDialog, dim: true, focusable: true}
+}
+
+// rows is how many output lines fit in the dialog.
+func (o *commandOverlay) rows(m *model) int {
+	_, h := m.screenSize()
+	return maxvalue(3, h-12)
+}
+
+func (o *commandOverlay) View(m *model) string {
+	w := m.popupWidth(100)
+	inner := maxvalue(10, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	out := o.out.lines()
+	rows := o.rows(m)
+	last := maxvalue(0, len(out)-rows)
+	if !o.scrolled {
+		// stay at the end while output arrives, until the user scrolls
+		o.offset = last
+	}
+	o.offset = minvalue(o.offset, last)
+
+	var state string
+	switch {
+	case o.running:
+		state = "running ..."
+	case o.err != nil:
+		state = "⚠ " + o.err.Error()
+	default:
+		state = "finished"
+	}
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(truncateToWidth(o.cmd.label()+" — "+sanitizeLine(o.target), inner)),
+		faint.Render(truncateToWidth("$ "+sanitizeLine(o.line), inner)),
+		"",
+	}
+	for i := o.offset; i < o.offset+rows; i++ {
+		l := ""
+		if i < len(out) {
+			l = truncateToWidth(sanitizeLine(strings.ReplaceAll(out[i], "\t", "    ")), inner)
+		}
+		lines = append(lines, l)
+	}
+	pos := ""
+	if len(out) > rows {
+		pos = fmt.Sprintf("  lines %d-%d of %d", o.offset+1, minvalue(len(out), o.offset+rows), len(out))
+	}
+	lines = append(lines, "", truncateToWidth(state+pos, inner), faint.Render("↑/↓ PgUp/PgDn scroll  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *commandOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	n, rows := len(o.out.lines()), o.rows(m)
+	last := maxvalue(0, n-rows)
+	scroll := func(to int) {
+		o.offset = maxvalue(0, minvalue(last, to))
+		o.scrolled = o.offset < last
+	}
+	switch msg.String() {
+	case "esc", "q", "enter":
+		if o.running {
+			o.cancel()
+		}
+		return nil, true
+	case "ctrl+c":
+		o.cancel()
+		return m.quit(), true
+	case "up", "k":
+		scroll(o.offset - 1)
+	case "down", "j":
+		scroll(o.offset + 1)
+	case "pgup":
+		scroll(o.offset - rows)
+	case "pgdown", " ":
+		scroll(o.offset + rows)
+	case "home", "g":
+		scroll(0)
+	case "end", "G":
+		scroll(last)
+	}
+	return nil, false
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestUserCommandKeys(t *testing.T) {
+	cmds, problems := userCommandKeys([]userCommand{
+		{Key: "U", Name: "usage", Run: "du -sh {}"},
+		{Key: "d", Run: "rm -rf {}"},
+		{Key: "ctrl+r", Run: "true"},
+		{Key: "Z"},
+	})
+	if _, ok := cmds["U"]; !ok || len(cmds) != 1 {
+		t.Fatalf("only U should be bound, got %v", cmds)
+	}
+	if len(problems) != 3 {
+		t.Fatalf("want built-in keys and the empty command reported, got %q", problems)
+	}
+	// navigation keys the table uses, though the help doesn't list them
+	for _, k := range []string{"left", "right", "tab"} {
+		if !builtinKey(k) {
+			t.Errorf("%s should count as built-in", k)
+		}
+	}
+}
+
+func TestCmdQuoteEscapesExpansion(t *testing.T) {
+	for in, want := range map[string]string{
+		`C:\a b`:      `"C:\a b"`,
+		`%PATH%.txt`:  `""^%"PATH"^%".txt"`,
+		`x^y & del *`: `"x"^^"y & del *"`,
+	} {
+		if got := cmdQuote(in); got != want {
+			t.Errorf("cmdQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestRunUserCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	t.Setenv("SHELL", "/usr/bin/fish") // quoted for sh, so run by sh
+	dir := t.TempDir()
+	p := filepath.Join(dir, "it's here.txt")
+	if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.current = &Node{Name: "root", Path: dir, IsDir: true, Scanned: true, Size: 1, Children: []*Node{{Name: "it's here.txt", Path: p, Size: 1}}}
+	m.setTableRowsFromNode(m.current)
+	m.userCommands, _ = userCommandKeys([]userCommand{{Key: "U", Name: "show", Run: "ls {}; echo done"}})
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'U'}})
+	if cmd == nil {
+		t.Fatalf("U should start the command")
+	}
+	// the first command of the batch waits for the process
+	m.Update(cmd().(tea.BatchMsg)[0]())
+	o, ok := m.overlays.get("command").(*commandOverlay)
+	if !ok {
+		t.Fatalf("expected the output dialog")
+	}
+	out := strings.Join(o.out.lines(), "\n")
+	if !strings.Contains(out, p) || !strings.HasSuffix(out, "done") {
+		t.Fatalf("the quoted path should reach the command intact, got %q", out)
+	}
+	if v := m.View(); !strings.Contains(v, "finished") || m.status != "show finished" {
+		t.Fatalf("expected the command to be reported finished, status %q", m.status)
+	}
+}
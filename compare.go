@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// --------------------------- Compare -----------------------------
+
+// errCompareUsage is returned for bad arguments to `disktree compare`.
+var errCompareUsage = errors.New("usage: disktree compare [-depth n] [-format side|unified] [-all] [-min-diff size] <a> <b>")
+
+// errDifferent ends `disktree compare` with status 1 when the sides differ,
+// as diff does, so backup checks can be scripted.
+var errDifferent = errors.New("the trees differ")
+
+// compareEntry is one subpath on one side of a comparison.
+type compareEntry struct {
+	size  int64
+	isDir bool
+	err   bool // unreadable, so its size is a lower bound
+}
+
+// compareSide is a tree's entries by slash-separated path relative to its
+// root ("" is the root), down to the comparison depth.
+type compareSide map[string]compareEntry
+
+// compareRow is a subpath with its entry on each side.
+type compareRow struct {
+	rel        string
+	a, b       compareEntry
+	inA, inB   bool
+	difference int64 // b minus a
+}
+
+// changed reports whether the row differs by at least minDiff, or is on
+// one side only.
+func (r compareRow) changed(minDiff int64) bool {
+	if r.inA != r.inB {
+		return true
+	}
+	d := r.difference
+	return d != 0 && max(d, -d) >= max(minDiff, 1)
+}
+
+// runCompare implements `disktree compare`. Either side may be a directory
+// or a file list of the kind -from-file reads, e.g. taken on a backup
+// server that can't be mounted here.
+func runCompare(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	depth := flags.Int("depth", 2, "Deepest subpath level compared (1 = immediate children)")
+	format := flags.String("format", "side", "Output: side (a table of both sizes) or unified (+/-/~ lines)")
+	all := flags.Bool("all", false, "Also list subpaths whose sizes match")
+	minDiff := flags.String("min-diff", "0", "Ignore size changes smaller than this (e.g. 1M)")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 || *depth < 1 || (*format != "side" && *format != "unified") {
+		return errCompareUsage
+	}
+	threshold, err := parseSize(*minDiff)
+	if err != nil {
+		return err
+	}
+	pathA, pathB := flags.Arg(0), flags.Arg(1)
+	a, err := loadCompareSide(pathA, *depth)
+	if err != nil {
+		return err
+	}
+	b, err := loadCompareSide(pathB, *depth)
+	if err != nil {
+		return err
+	}
+	var shown []compareRow
+	differ := false
+	oneSided := map[string]bool{} // directories on one side only
+	for _, r := range compareSides(a, b) {
+		if coveredBy(r.rel, oneSided) {
+			continue // the directory's row says it all
+		}
+		if r.inA != r.inB {
+			oneSided[r.rel] = true
+		}
+		if r.changed(threshold) {
+			differ = true
+		} else if !*all {
+			continue
+		}
+		shown = append(shown, r)
+	}
+	if *format == "unified" {
+		writeUnified(w, pathA, pathB, shown, threshold)
+	} else if err := writeSideBySide(w, pathA, pathB, shown); err != nil {
+		return err
+	}
+	if differ {
+		return errDifferent
+	}
+	return nil
+}
+
+// loadCompareSide sizes the subpaths of p: a directory is walked, a
+// regular file is read as a file list.
+func loadCompareSide(p string, depth int) (compareSide, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		l, err := loadListing(p, listingAuto)
+		if err != nil {
+			return nil, err
+		}
+		return listingSide(l.node(l.root), depth), nil
+	}
+	root, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	s := &Scanner{threads: runtime.GOMAXPROCS(0) * 4, mounts: systemMounts(), netThreads: defaultNetThreads, root: root}
+	rows := make(chan exportRow, 1024)
+	go func() {
+		defer crashGuard()
+		s.walkExport(context.Background(), root, nil, rows)
+	}()
+	side := compareSide{}
+	for r := range rows {
+		if r.Depth > depth {
+			continue
+		}
+		rel := ""
+		if r.Depth > 0 {
+			rel, _ = filepath.Rel(root, r.Path)
+			rel = filepath.ToSlash(rel)
+		}
+		side[rel] = compareEntry{size: r.Size, isDir: r.IsDir, err: r.Err != nil}
+	}
+	return side, nil
+}
+
+// listingSide is the compareSide of a file list's tree below n.
+func listingSide(n *Node, depth int) compareSide {
+	side := compareSide{"": {size: n.Size, isDir: true}}
+	var walk func(n *Node, rel string, d int)
+	walk = func(n *Node, rel string, d int) {
+		for _, c := range n.Children {
+			r := c.Name
+			if rel != "" {
+				r = rel + "/" + c.Name
+			}
+			side[r] = compareEntry{size: max(0, c.Size), isDir: c.IsDir}
+			if d < depth {
+				walk(c, r, d+1)
+			}
+		}
+	}
+	walk(n, "", 1)
+	return side
+}
+
+// compareSides pairs up the subpaths of both sides in tree order: each
+// directory is followed by its contents.
+func compareSides(a, b compareSide) []compareRow {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	rows := make([]compareRow, 0, len(keys))
+	for k := range keys {
+		r := compareRow{rel: k}
+		r.a, r.inA = a[k]
+		r.b, r.inB = b[k]
+		r.difference = r.b.size - r.a.size
+		rows = append(rows, r)
+	}
+	slices.SortFunc(rows, func(x, y compareRow) int {
+		return slices.Compare(strings.Split(x.rel, "/"), strings.Split(y.rel, "/"))
+	})
+	return rows
+}
+
+// coveredBy reports whether rel lies in one of dirs.
+func coveredBy(rel string, dirs map[string]bool) bool {
+	for p := rel; strings.Contains(p, "/"); {
+		p = p[:strings.LastIndex(p, "/")]
+		if dirs[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// relLabel is how a subpath is printed: "." for the root, directories
+// with a trailing slash.
+func relLabel(r compareRow) string {
+	if r.rel == "" {
+		return "."
+	}
+	if r.a.isDir || r.b.isDir {
+		return r.rel + "/"
+	}
+	return r.rel
+}
+
+func sideSize(e compareEntry, in bool) string {
+	if !in {
+		return "—"
+	}
+	s := humanBytes(e.size)
+	if e.err {
+		s += " (errors)"
+	}
+	return s
+}
+
+func signedBytes(d int64) string {
+	switch {
+	case d > 0:
+		return "+" + humanBytes(d)
+	case d < 0:
+		return "-" + humanBytes(-d)
+	}
+	return "0 B"
+}
+
+func writeSideBySide(w io.Writer, a, b string, rows []compareRow) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PATH\tA: %s\tB: %s\tDIFF\n", a, b)
+	for _, r := range rows {
+		diff := signedBytes(r.difference)
+		switch {
+		case !r.inB:
+			diff = "only in A"
+		case !r.inA:
+			diff = "only in B"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", relLabel(r), sideSize(r.a, r.inA), sideSize(r.b, r.inB), diff)
+	}
+	if len(rows) == 0 {
+		fmt.Fprintln(tw, "(no differences)")
+	}
+	return tw.Flush()
+}
+
+// writeUnified prints the rows as diff-like lines: - only in a, + only in
+// b, ~ changed in size, and a space for matching entries with -all.
+func writeUnified(w io.Writer, a, b string, rows []compareRow, minDiff int64) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", a, b)
+	for _, r := range rows {
+		switch {
+		case !r.inB:
+			fmt.Fprintf(w, "- %s  %s\n", relLabel(r), sideSize(r.a, true))
+		case !r.inA:
+			fmt.Fprintf(w, "+ %s  %s\n", relLabel(r), sideSize(r.b, true))
+		case r.changed(minDiff):
+			fmt.Fprintf(w, "~ %s  %s → %s (%s)\n", relLabel(r), sideSize(r.a, true), sideSize(r.b, true), signedBytes(r.difference))
+		default:
+			fmt.Fprintf(w, "  %s  %s\n", relLabel(r), sideSize(r.a, true))
+		}
+	}
+}
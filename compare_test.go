@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	base := t.TempDir()
+	write := func(rel string, n int) {
+		p := filepath.Join(base, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, n), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/photos/1.jpg", 4096)
+	write("a/photos/2.jpg", 100)
+	write("a/old/deep/x", 10)
+	write("a/same.txt", 7)
+	write("b/photos/1.jpg", 4096)
+	write("b/same.txt", 7)
+	a, b := filepath.Join(base, "a"), filepath.Join(base, "b")
+
+	var out bytes.Buffer
+	err := runCompare([]string{"-format", "unified", a, b}, &out)
+	if !errors.Is(err, errDifferent) {
+		t.Fatalf("the trees differ, got %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"- old/  10 B\n", "~ photos/  4.1 KB → 4.0 KB (-100 B)\n", "- photos/2.jpg  100 B\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "old/deep") || strings.Contains(got, "same.txt") {
+		t.Errorf("contents of one-sided directories and equal entries are left out:\n%s", got)
+	}
+
+	// b as a file list taken elsewhere matches b on disk
+	list := filepath.Join(base, "b.txt")
+	lines := "4096\tf\t/srv/b/photos/1.jpg\n7\tf\t/srv/b/same.txt\n"
+	if err := os.WriteFile(list, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runCompare([]string{"-all", list, b}, &out); err != nil {
+		t.Fatalf("the list and the directory match, got %v:\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "photos/") {
+		t.Fatalf("-all lists matching entries:\n%s", out.String())
+	}
+	if err := runCompare([]string{a}, &out); !errors.Is(err, errCompareUsage) {
+		t.Fatalf("one path is a usage error, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/charmbracelet/bubbles/table"
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Compressed sizes --------------------
+
+// With -compressed, walks count each file's on-disk size after transparent
+// compression (NTFS, ZFS, btrfs, APFS) next to its length, and the table
+// gets a Disk column with the on-disk share, so savings show per entry.
+// z sorts by it.
+
+// diskSize is the on-disk size a walk counts for the file fi at path; 0
+// without -compressed.
+func (s *Scanner) diskSize(path string, fi fs.FileInfo) int64 {
+	if !s.diskSizes {
+		return 0
+	}
+	return scanner.DiskSize(path, fi)
+}
+
+// showDisk reports whether on-disk sizes are counted and shown.
+func (m *model) showDisk() bool {
+	return m.scanner != nil && m.scanner.diskSizes
+}
+
+// diskColumns is the Disk column, shown with -compressed.
+func (m *model) diskColumns() []table.Column {
+	if !m.showDisk() {
+		return nil
+	}
+	w := 16
+	if m.narrow() {
+		w = 0
+	}
+	return []table.Column{{Title: "Disk", Width: w}}
+}
+
+// diskCell is n's on-disk size and, when compression saves space, what
+// share of its length that is. Small files round up to a block and take
+// more than their length; a percentage would only be noise there.
+func diskCell(n *Node) string {
+	switch {
+	case n.Size < 0:
+		return ""
+	case n.Disk >= n.Size:
+		return humanBytes(n.Disk)
+	}
+	return fmt.Sprintf("%s %3.0f%%", humanBytes(n.Disk), 100*float64(n.Disk)/float64(n.Size))
+}
+
+// diskSummary is the summary line's part for the current directory's
+// on-disk size, with what compression saves.
+func (m *model) diskSummary(n *Node) string {
+	if !m.showDisk() || n.Size <= 0 {
+		return ""
+	}
+	s := humanBytes(n.Disk) + " on disk"
+	if saved := n.Size - n.Disk; saved > 0 {
+		s += fmt.Sprintf(" (%s saved, %.0f%%)", humanBytes(saved), 100*float64(saved)/float64(n.Size))
+	}
+	return s
+}
+
+// sortByDiskSize sorts by on-disk size, which needs -compressed.
+func (m *model) sortByDiskSize() {
+	if !m.showDisk() {
+		m.status = "On-disk sizes are not counted — start with -compressed"
+		return
+	}
+	m.setSort(sortByDisk)
+	m.status = "Sorted by size on disk (after compression)"
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompressedSizesColumnAndSort(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sparse files need fsutil on Windows")
+	}
+	h := newTUIHarness(t, 160, 24)
+	// a sparse file takes (almost) no blocks: the same as a well compressed one
+	sparse := filepath.Join(h.m.rootPath, "alpha", "sparse.img")
+	f, err := os.Create(sparse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(64 << 20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := os.WriteFile(filepath.Join(h.m.rootPath, "beta", "dense.bin"), []byte(strings.Repeat("x", 64<<10)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	base := len(h.m.tbl.Columns())
+	h.keys("z")
+	if h.m.sort == sortByDisk || !strings.Contains(h.m.status, "-compressed") {
+		t.Fatalf("z without -compressed should explain, got %q", h.m.status)
+	}
+
+	h.m.scanner.diskSizes = true
+	dirRecords = sync.Map{} // recorded without on-disk sizes
+	h.m.relayoutTable()
+	h.keys("F")
+	cols := h.m.tbl.Columns()
+	if len(cols) != base+1 || cols[base].Title != "Disk" {
+		t.Fatalf("columns = %v", cols)
+	}
+	var alpha *Node
+	for _, c := range h.m.current.Children {
+		if c.Name == "alpha" {
+			alpha = c
+		}
+	}
+	if alpha == nil || alpha.Disk <= 0 || alpha.Disk >= alpha.Size/2 {
+		t.Fatalf("alpha should take far less on disk than its length: %+v", alpha)
+	}
+	if h.m.current.Disk < alpha.Disk {
+		t.Errorf("the root's on-disk size %d should include alpha's %d", h.m.current.Disk, alpha.Disk)
+	}
+	h.keys("z")
+	if h.m.sort != sortByDisk {
+		t.Fatal("z should sort by size on disk")
+	}
+	if top := h.m.rows[0]; top.Name != "beta" {
+		t.Errorf("beta takes the most on disk; rows = %v", h.m.tbl.Rows())
+	}
+	if cell := diskCell(alpha); !strings.HasSuffix(cell, "%") {
+		t.Errorf("alpha's Disk cell should show the share, got %q", cell)
+	}
+	if !strings.Contains(h.m.summaryLine(), "on disk") {
+		t.Errorf("summary = %q", h.m.summaryLine())
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// --------------------------- Config ------------------------------
+
+// Config holds user settings read from config.json. Command-line flags take
+// precedence over values set here.
+type Config struct {
+	// ConfirmThreshold is the size at or above which deletes need a second
+	// confirmation, e.g. "1G" ("0" disables).
+	ConfirmThreshold string `json:"confirm_threshold,omitempty"`
+	// ConfirmSkipBelow is the size below which deletes need no
+	// confirmation at all, e.g. "10M" ("0", the default, always asks).
+	ConfirmSkipBelow string `json:"confirm_skip_below,omitempty"`
+	// ConfirmLarge is how deletes at or above ConfirmThreshold are
+	// confirmed: "twice" (default) or "type" (typing the name).
+	ConfirmLarge string `json:"confirm_large,omitempty"`
+	// ProtectedPaths are extra globs (in addition to the built-in system
+	// paths) that may not be deleted casually. A trailing "/**" protects
+	// everything below a directory too.
+	ProtectedPaths []string `json:"protected_paths,omitempty"`
+	// ProtectedDelete is "confirm" (type the path to override) or "refuse".
+	ProtectedDelete string `json:"protected_delete,omitempty"`
+	// TourSeen is set once the first-run introduction has been dismissed.
+	TourSeen bool `json:"tour_seen,omitempty"`
+	// TrashOnExit is what happens at quit to items trashed during the
+	// session: "ask" (default), "keep" or "empty".
+	TrashOnExit string `json:"trash_on_exit,omitempty"`
+	// TrashDedup is what happens when a path is trashed again: "off"
+	// (default), "latest" or "link".
+	TrashDedup string `json:"trash_dedup,omitempty"`
+	// TrashDir replaces the default trash directory, like -trash-dir.
+	// AuditLog is the file deletes, restores and moves are logged to, or
+	// "off", like -audit-log.
+	AuditLog string `json:"audit_log,omitempty"`
+	TrashDir string `json:"trash_dir,omitempty"`
+	// TrashMounts gives directories (usually mount points) their own
+	// trash: deletes below a key go to its value, e.g. {"/scratch":
+	// "/scratch/.disktree-trash"}.
+	TrashMounts map[string]string `json:"trash_mounts,omitempty"`
+	// Graphics is the terminal image protocol for pictures: "off"
+	// (default), "auto", "kitty" or "iterm".
+	Graphics string `json:"graphics,omitempty"`
+	// Commands bind keys to external commands run on the selection.
+	Commands []userCommand `json:"commands,omitempty"`
+	// Macros are recorded key sequences by name (Q records, @ replays).
+	Macros map[string][]string `json:"macros,omitempty"`
+	// Debounce is how long scan updates gather before the table is
+	// rebuilt, e.g. "100ms".
+	Debounce string `json:"debounce,omitempty"`
+	// Tick is the interval of row spinners while scanning, e.g. "120ms",
+	// or "auto" to stretch it while updates are frequent.
+	Tick string `json:"tick,omitempty"`
+	// FPS caps how many frames a second are drawn (default 60).
+	FPS int `json:"fps,omitempty"`
+	// MaxDepth is how many directory levels below a walked directory are
+	// entered (default 4096); deeper ones are left out with a warning.
+	MaxDepth int `json:"max_depth,omitempty"`
+	// LoadingMin is the least time the loading overlay shows, e.g.
+	// "500ms"; LoadingQuick is how fast a scan must be to skip it.
+	LoadingMin   string `json:"loading_min,omitempty"`
+	LoadingQuick string `json:"loading_quick,omitempty"`
+	// LoadingOverlay brings back the centered popup shown while scanning.
+	LoadingOverlay bool `json:"loading_overlay,omitempty"`
+	// ExcludeOlderThan and the others leave files out of scans by age
+	// ("5y", "30d") or size ("1K"), like the -exclude-* flags.
+	ExcludeOlderThan   string `json:"exclude_older_than,omitempty"`
+	ExcludeNewerThan   string `json:"exclude_newer_than,omitempty"`
+	ExcludeSmallerThan string `json:"exclude_smaller_than,omitempty"`
+	ExcludeLargerThan  string `json:"exclude_larger_than,omitempty"`
+	// Budget bounds each scan, like -budget: "30s" or "2M files".
+	Budget string `json:"budget,omitempty"`
+	// SampleAbove and SampleRate size the files of directories with more
+	// entries than SampleAbove from a SampleRate fraction of them, like
+	// -sample-above and -sample-rate.
+	SampleAbove int     `json:"sample_above,omitempty"`
+	SampleRate  float64 `json:"sample_rate,omitempty"`
+	// ScanAs sizes directories as another user, like -scan-as.
+	ScanAs string `json:"scan_as,omitempty"`
+	// OwnerColumns shows the Owner and Mode columns from the start.
+	OwnerColumns bool `json:"owner_columns,omitempty"`
+	// Xattrs adds extended attributes to file sizes, like -xattrs.
+	Xattrs bool `json:"xattrs,omitempty"`
+	// Compressed counts sizes on disk after compression, like -compressed.
+	Compressed bool `json:"compressed,omitempty"`
+	// TrustMtime reuses the totals of directories whose mtime is unchanged
+	// on rescans, like -trust-mtime.
+	TrustMtime bool `json:"trust_mtime,omitempty"`
+	// Analyzers are external programs fed the scan that report findings
+	// and fill extra columns (see analyzers.go for the protocol).
+	Analyzers []analyzerConfig `json:"analyzers,omitempty"`
+	// Offload are rsync or rclone targets O moves the selection to.
+	Offload []offloadTarget `json:"offload,omitempty"`
+	// BackupPatterns is a borg patterns file or restic exclude file whose
+	// left-out data is marked, with BackupFormat ("auto", "borg" or
+	// "restic") and the BackupRoots the backup starts from.
+	BackupPatterns string   `json:"backup_patterns,omitempty"`
+	BackupFormat   string   `json:"backup_format,omitempty"`
+	BackupRoots    []string `json:"backup_roots,omitempty"`
+}
+
+// defaultConfigPath returns the location of config.json.
+// loadConfig reads the config file at path. A missing file is not an error
+// and yields the zero Config.
+func loadConfig(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, errors.New(path + ": " + err.Error())
+	}
+	return cfg, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Confirmation policy -----------------
+
+// How a delete is confirmed depends on its size. Below -confirm-skip-below
+// it goes to the trash without a dialog (u brings it back); below
+// -confirm-threshold one Yes does; at or above it, or while the size is
+// still unknown, -confirm-large asks for a second Yes ("twice") or for the
+// name to be typed ("type"):
+//
+//	disktree -confirm-skip-below 10M -confirm-threshold 1G -confirm-large type
+
+// confirmDelete asks for n's delete as the policy says, or deletes it right
+// away.
+func (m *model) confirmDelete(n *Node) tea.Cmd {
+	o := newConfirmDelete(n, m.confirmThreshold)
+	switch {
+	case o.noRoom:
+		// the permanent delete it offers always asks twice
+	case !o.large && n.Size >= 0 && n.Size < m.confirmSkipBelow:
+		return m.deleteToTrash(n.Path)
+	case o.large && m.confirmTyped:
+		m.promptTypedDelete(n)
+		return nil
+	}
+	m.overlays.push(o)
+	return nil
+}
+
+// promptTypedDelete asks for n's name before a large delete.
+func (m *model) promptTypedDelete(n *Node) {
+	size := "size unknown (still scanning)"
+	if n.Size >= 0 {
+		size = humanBytes(n.Size)
+		if n.IsDir {
+			size += fmt.Sprintf(", %d files", n.Files)
+		}
+	}
+	validate := func(v string) error {
+		if v != n.Name {
+			return errors.New("type the name exactly to delete it")
+		}
+		return nil
+	}
+	title := fmt.Sprintf("Delete %s (%s)? Type its name to move it to the trash", n.Name, size)
+	p := newPrompt(m, "confirm-large", title, "", validate, func(m *model, v string) tea.Cmd {
+		return m.deleteToTrash(n.Path)
+	})
+	p.noHistory = true
+	m.overlays.push(p)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfirmationPolicyBySize(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	h.m.confirmSkipBelow, h.m.confirmThreshold, h.m.confirmTyped = 50, 2048, true
+	gone := func(name string) bool {
+		_, err := os.Stat(filepath.Join(h.tmp, name))
+		return os.IsNotExist(err)
+	}
+
+	// rows by size: alpha 5 KB, readme.md 2 KB, beta 100 B, zeta.log 10 B
+	h.keys("down", "down", "down", "d")
+	if !gone("zeta.log") || h.m.overlays.focused() != nil {
+		t.Fatalf("zeta.log is under the skip size and should go without a dialog (status %q)", h.m.status)
+	}
+
+	// the cursor stays on the last row, now beta
+	h.keys("d")
+	if o, ok := h.m.overlays.focused().(*confirmDeleteOverlay); !ok || o.large {
+		t.Fatalf("beta should get the plain confirmation, got %T", h.m.overlays.focused())
+	}
+	h.keys("esc")
+
+	h.keys("up", "up", "d")
+	p, ok := h.m.overlays.focused().(*promptOverlay)
+	if !ok || !strings.Contains(p.title, "Type its name") {
+		t.Fatalf("alpha is large and should ask for its name, got %T", h.m.overlays.focused())
+	}
+	h.keys("alph", "enter")
+	if gone("alpha") || p.err == "" {
+		t.Fatal("a wrong name must not delete")
+	}
+	h.keys("a", "enter")
+	if !gone("alpha") {
+		t.Fatalf("alpha not deleted after typing its name (status %q)", h.m.status)
+	}
+	if h.m.journal.next != 2 {
+		t.Fatalf("journal has %d deletes; want 2, each undoable", h.m.journal.next)
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Copy --------------------------------
+
+// copyJob is a running copy of one entry to another directory, e.g. to
+// relocate data to another volume before deleting the original. Like a deep
+// export it runs in the background with a progress dialog.
+type copyJob struct {
+	src, dst string
+	total    int64 // expected bytes, or -1 when the scan doesn't know
+	bytes    atomic.Int64
+	files    atomic.Int64
+	skipped  atomic.Int64 // devices, sockets and pipes, which aren't copied
+	current  atomic.Value // string: file being copied
+	cancel   context.CancelFunc
+	started  time.Time
+}
+
+type copyDoneMsg struct {
+	src, dst string
+	bytes    int64
+	files    int64
+	skipped  int64
+	err      error
+}
+
+type copyProgressMsg struct{}
+
+func copyProgressTick() tea.Cmd {
+	return tea.Tick(200*time.Millisecond, func(time.Time) tea.Msg { return copyProgressMsg{} })
+}
+
+// copyBufSize is the chunk size between cancellation checks.
+const copyBufSize = 1 << 20
+
+// copyTree copies src to dst, which must not exist, keeping file modes,
+// modification times and symlinks (as links, not their targets). On error or
+// cancellation the partial copy is removed.
+func copyTree(ctx context.Context, src, dst string, job *copyJob) error {
+	if _, err := os.Lstat(dst); err == nil {
+		return fmt.Errorf("%s already exists", dst)
+	}
+	buf := make([]byte, copyBufSize)
+	if err := copyEntry(ctx, src, dst, job, buf); err != nil {
+		_ = os.RemoveAll(dst)
+		return err
+	}
+	return nil
+}
+
+// copyEntry copies the entry at src, and everything below it, to dst. It
+// walks with an explicit stack rather than by recursion, so deep trees
+// don't deepen the Go stack, and like copyDir refuses directories deeper
+// than maxTreeDepth. Directories get their own mode and time back once
+// their entries are in, deepest first.
+func copyEntry(ctx context.Context, src, dst string, job *copyJob, buf []byte) error {
+	type pending struct {
+		src, dst string
+		depth    int
+	}
+	type done struct {
+		dst string
+		fi  fs.FileInfo
+	}
+	var dirs []done
+	stack := []pending{{src, dst, 0}}
+	for len(stack) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		fi, err := os.Lstat(p.src)
+		if err != nil {
+			return err
+		}
+		switch mode := fi.Mode(); {
+		case mode&fs.ModeSymlink != 0:
+			target, err := os.Readlink(p.src)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, p.dst); err != nil {
+				return err
+			}
+		case mode.IsDir():
+			if p.depth > maxTreeDepth {
+				return fmt.Errorf("%s: %w", p.src, errTooDeep)
+			}
+			// writable until the entries are in, then the original mode
+			if err := os.Mkdir(p.dst, mode.Perm()|0o700); err != nil {
+				return err
+			}
+			ents, err := os.ReadDir(p.src)
+			if err != nil {
+				return err
+			}
+			dirs = append(dirs, done{p.dst, fi})
+			for _, e := range ents {
+				stack = append(stack, pending{filepath.Join(p.src, e.Name()), filepath.Join(p.dst, e.Name()), p.depth + 1})
+			}
+		case mode.IsRegular():
+			job.current.Store(p.src)
+			if err := copyRegular(ctx, p.src, p.dst, mode.Perm(), job, buf); err != nil {
+				return err
+			}
+			job.files.Add(1)
+			if err := os.Chtimes(p.dst, fi.ModTime(), fi.ModTime()); err != nil {
+				return err
+			}
+		default:
+			job.skipped.Add(1)
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].dst, dirs[i].fi.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(dirs[i].dst, dirs[i].fi.ModTime(), dirs[i].fi.ModTime()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyRegular(ctx context.Context, src, dst string, perm fs.FileMode, job *copyJob, buf []byte) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			_ = df.Close()
+			return err
+		}
+		n, rerr := sf.Read(buf)
+		if n > 0 {
+			if _, err := df.Write(buf[:n]); err != nil {
+				_ = df.Close()
+				return err
+			}
+			job.bytes.Add(int64(n))
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			_ = df.Close()
+			return rerr
+		}
+	}
+	return df.Close()
+}
+
+// promptCopy asks where to copy the selection. The prompt starts at the
+// last destination, so a batch of moves to one volume needs no retyping.
+func (m *model) promptCopy() {
+	sel := m.selected()
+	if sel == nil {
+		return
+	}
+	if m.copyJob != nil {
+		m.overlays.push(copyProgressOverlay{})
+		return
+	}
+	initial := filepath.Dir(sel.Path)
+	if h := m.promptHistory["copy"]; len(h) > 0 {
+		initial = h[len(h)-1]
+	}
+	validate := func(v string) error {
+		if err := validateDirPath(v); err != nil {
+			return err
+		}
+		dir := expandHome(v)
+		if samePath(dir, sel.Path) || underPath(dir, sel.Path) {
+			return errors.New("can't copy a directory into itself")
+		}
+		if _, err := os.Lstat(filepath.Join(dir, sel.Name)); err == nil {
+			return fmt.Errorf("%s already exists there", sel.Name)
+		}
+		return nil
+	}
+	m.overlays.push(newPrompt(m, "copy", "Copy "+sel.Name+" into directory", initial, validate, func(m *model, v string) tea.Cmd {
+		return m.startCopy(sel, expandHome(v))
+	}))
+}
+
+// startCopy copies n into dir in the background and shows its progress.
+func (m *model) startCopy(n *Node, dir string) tea.Cmd {
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	job := &copyJob{src: n.Path, dst: filepath.Join(dir, filepath.Base(n.Path)), total: -1, cancel: cancel, started: time.Now()}
+	if n.Size > 0 && !m.scanner.allocated {
+		job.total = n.Size
+	}
+	job.current.Store(n.Path)
+	m.copyJob = job
+	m.overlays.push(copyProgressOverlay{})
+	run := func() tea.Msg {
+		err := copyTree(ctx, job.src, job.dst, job)
+		return copyDoneMsg{src: job.src, dst: job.dst, bytes: job.bytes.Load(), files: job.files.Load(), skipped: job.skipped.Load(), err: err}
+	}
+	return tea.Batch(run, copyProgressTick())
+}
+
+// finishCopy reports the copy. A copy into a scanned directory makes its
+// sizes stale, so they are forgotten, and the current view is rescanned
+// when the copy landed in it.
+func (m *model) finishCopy(msg copyDoneMsg) tea.Cmd {
+	m.copyJob = nil
+	m.overlays.remove("copy-progress")
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		m.status = "Copy canceled; the partial copy was removed"
+		return nil
+	case msg.err != nil:
+		m.status = "⚠ copy failed: " + msg.err.Error()
+		return nil
+	}
+	m.journal.record(&journalOp{Kind: opCopy, From: msg.src, To: msg.dst})
+	m.status = fmt.Sprintf("Copied %s (%s, %d files) to %s — d moves the original to the trash, u takes the copy back", filepath.Base(msg.src), humanBytes(msg.bytes), msg.files, msg.dst)
+	if msg.skipped > 0 {
+		m.status += fmt.Sprintf(" (%d special files skipped)", msg.skipped)
+	}
+	dir := filepath.Dir(msg.dst)
+	invalidateSums(msg.dst)
+	cache.Delete(pathKey(dir))
+	if !m.loading && m.current != nil && samePath(m.current.Path, dir) {
+		return m.rescanCurrent(false)
+	}
+	return nil
+}
+
+// progress is the progress line of a running copy.
+func (j *copyJob) progress() string {
+	done := j.bytes.Load()
+	if j.total <= 0 {
+		return fmt.Sprintf("%s, %d files", humanBytes(done), j.files.Load())
+	}
+	p := min(float64(done)/float64(j.total), 1)
+	return fmt.Sprintf("%s of %s (%.0f%%), %d files", humanBytes(done), humanBytes(j.total), 100*p, j.files.Load())
+}
+
+// copyProgressOverlay shows a running copy. Esc cancels it; Enter hides the
+// dialog and leaves progress in the status line.
+type copyProgressOverlay struct{}
+
+func (copyProgressOverlay) opts() overlayOpts {
+	return overlayOpts{id: "copy-progress", z: zDialog, focusable: true}
+}
+
+func (copyProgressOverlay) View(m *model) string {
+	w := m.popupWidth(60)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Copying ...")}
+	if job := m.copyJob; job != nil {
+		cur, _ := job.current.Load().(string)
+		lines = append(lines,
+			"",
+			truncateToWidth(job.src+" → "+job.dst, maxvalue(10, w-6)),
+			m.spin.View()+" "+job.progress(),
+		)
+		if job.total > 0 {
+			lines = append(lines, bar(float64(job.bytes.Load())/float64(job.total), maxvalue(10, w-6)))
+		}
+		lines = append(lines,
+			truncateToWidth(strings.TrimPrefix(cur, job.src), maxvalue(10, w-6)),
+			fmt.Sprintf("elapsed %s", time.Since(job.started).Round(time.Second)),
+		)
+	}
+	lines = append(lines, "", lipgloss.NewStyle().Faint(true).Render("Esc cancel  Enter run in background"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (copyProgressOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc":
+		if m.copyJob != nil {
+			m.copyJob.cancel()
+			m.status = "Canceling copy ..."
+		}
+		return nil, true
+	case "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
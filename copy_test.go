@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCopyTree(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "photos")
+	if err := os.MkdirAll(filepath.Join(src, "2024"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(src, "2024", "a.jpg")
+	if err := os.WriteFile(file, []byte("jpeg data"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, old, old); err != nil {
+		t.Fatal(err)
+	}
+	links := runtime.GOOS != "windows"
+	if links {
+		if err := os.Symlink("2024/a.jpg", filepath.Join(src, "latest")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(t.TempDir(), "photos")
+	job := &copyJob{total: -1}
+	if err := copyTree(context.Background(), src, dst, job); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filepath.Join(dst, "2024", "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.ModTime().Equal(old) || (runtime.GOOS != "windows" && fi.Mode().Perm() != 0o640) {
+		t.Fatalf("mode or mtime lost: %v %v", fi.Mode(), fi.ModTime())
+	}
+	if job.bytes.Load() != 9 || job.files.Load() != 1 {
+		t.Fatalf("counted %d bytes, %d files", job.bytes.Load(), job.files.Load())
+	}
+	if links {
+		if target, err := os.Readlink(filepath.Join(dst, "latest")); err != nil || target != "2024/a.jpg" {
+			t.Fatalf("symlink not kept: %q, %v", target, err)
+		}
+	}
+	if err := copyTree(context.Background(), src, dst, job); err == nil {
+		t.Fatal("copying over an existing entry should fail")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	again := filepath.Join(t.TempDir(), "photos")
+	if err := copyTree(ctx, src, again, &copyJob{}); err == nil {
+		t.Fatal("a canceled copy should fail")
+	}
+	if _, err := os.Lstat(again); !os.IsNotExist(err) {
+		t.Fatal("a canceled copy should leave nothing behind")
+	}
+}
+
+// TestCopyDirRoundTrip copies a tree out and back the way the trash
+// fallback and its restore do, and expects it unchanged.
+func TestCopyDirRoundTrip(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "proj")
+	if err := os.MkdirAll(filepath.Join(src, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(src, "bin", "run.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Date(2019, 5, 6, 7, 8, 9, 0, time.UTC)
+	for _, p := range []string{script, filepath.Join(src, "bin")} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	posix := runtime.GOOS != "windows"
+	if posix {
+		if err := os.Chmod(script, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("bin/run.sh", filepath.Join(src, "run")); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink("missing", filepath.Join(src, "dangling")); err != nil {
+			t.Fatal(err)
+		}
+		if os.Geteuid() == 0 {
+			if err := os.Lchown(script, 1234, 5678); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// read-only directories are copied too, and stay read-only
+		if err := os.Chmod(filepath.Join(src, "bin"), 0o555); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = os.Chmod(filepath.Join(src, "bin"), 0o755) })
+	}
+
+	out := filepath.Join(t.TempDir(), "proj")
+	back := filepath.Join(t.TempDir(), "proj")
+	if err := copyDir(src, out); err != nil {
+		t.Fatal(err)
+	}
+	if posix {
+		t.Cleanup(func() { _ = os.Chmod(filepath.Join(out, "bin"), 0o755) })
+	}
+	if err := copyDir(out, back); err != nil {
+		t.Fatal(err)
+	}
+	if posix {
+		t.Cleanup(func() { _ = os.Chmod(filepath.Join(back, "bin"), 0o755) })
+	}
+
+	for _, p := range []string{"bin", filepath.Join("bin", "run.sh")} {
+		want, err := os.Lstat(filepath.Join(src, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.Lstat(filepath.Join(back, p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.ModTime().Equal(old) || (posix && got.Mode() != want.Mode()) {
+			t.Errorf("%s: got %v %v, want %v %v", p, got.Mode(), got.ModTime(), want.Mode(), old)
+		}
+		if posix && os.Geteuid() == 0 {
+			gu, gg, _ := fileOwner(got)
+			wu, wg, _ := fileOwner(want)
+			if gu != wu || gg != wg {
+				t.Errorf("%s: owner %d:%d, want %d:%d", p, gu, gg, wu, wg)
+			}
+		}
+	}
+	if posix {
+		for link, target := range map[string]string{"run": "bin/run.sh", "dangling": "missing"} {
+			if got, err := os.Readlink(filepath.Join(back, link)); err != nil || got != target {
+				t.Errorf("%s: got link %q, %v; want %q", link, got, err, target)
+			}
+		}
+	}
+}
+
+func TestCopyPrompt(t *testing.T) {
+	root := t.TempDir()
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "big.iso"), []byte("iso"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(root, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m.current = &Node{Path: root, IsDir: true, Children: []*Node{{Name: "big.iso", Path: filepath.Join(root, "big.iso"), Size: 3, Files: 1}}}
+	m.setTableRowsFromNode(m.current)
+
+	m.promptCopy()
+	p, ok := m.overlays.focused().(*promptOverlay)
+	if !ok {
+		t.Fatal("C should open the destination prompt")
+	}
+	p.input.SetValue(root)
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if !strings.Contains(p.err, "already exists") {
+		t.Fatalf("copying onto itself should be refused, got %q", p.err)
+	}
+	p.input.SetValue(dest)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.copyJob == nil || !m.overlays.has("copy-progress") {
+		t.Fatal("the copy should run with a progress dialog")
+	}
+	var done copyDoneMsg
+	for _, msg := range cmd().(tea.BatchMsg) {
+		if d, ok := msg().(copyDoneMsg); ok {
+			done = d
+			break
+		}
+	}
+	m.Update(done)
+	if m.copyJob != nil || !strings.Contains(m.status, "Copied big.iso") {
+		t.Fatalf("unexpected status %q", m.status)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "big.iso")); err != nil || string(b) != "iso" {
+		t.Fatalf("copy missing: %q, %v", b, err)
+	}
+
+	// u takes the copy back into the trash, ctrl+r brings it back
+	m.undo()
+	if _, err := os.Lstat(filepath.Join(dest, "big.iso")); !os.IsNotExist(err) || !strings.HasPrefix(m.status, "Undid copy of big.iso") {
+		t.Fatalf("undo should trash the copy: %v, status %q", err, m.status)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "big.iso")); err != nil {
+		t.Fatalf("undoing a copy must leave the source alone: %v", err)
+	}
+	m.redo()
+	if b, err := os.ReadFile(filepath.Join(dest, "big.iso")); err != nil || string(b) != "iso" {
+		t.Fatalf("redo should bring the copy back: %q, %v (status %q)", b, err, m.status)
+	}
+}
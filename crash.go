@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/term"
+)
+
+// --------------------------- Crash recovery ----------------------
+
+// maxRecentMsgs bounds the message log included in crash reports.
+const maxRecentMsgs = 50
+
+// recentMsgs is a ring of the last messages delivered to Update.
+var recentMsgs struct {
+	mu   sync.Mutex
+	buf  [maxRecentMsgs]string
+	next int
+	n    int
+}
+
+func recordMsg(msg tea.Msg) {
+	s := fmt.Sprintf("%s %T %v", time.Now().Format("15:04:05.000"), msg, msg)
+	if len(s) > 160 {
+		s = s[:160] + "…"
+	}
+	s = strings.ToValidUTF8(strings.ReplaceAll(s, "\n", `\n`), "?")
+	recentMsgs.mu.Lock()
+	recentMsgs.buf[recentMsgs.next] = s
+	recentMsgs.next = (recentMsgs.next + 1) % maxRecentMsgs
+	recentMsgs.n = minvalue(recentMsgs.n+1, maxRecentMsgs)
+	recentMsgs.mu.Unlock()
+}
+
+// recentMsgLog returns the logged messages, oldest first.
+func recentMsgLog() []string {
+	recentMsgs.mu.Lock()
+	defer recentMsgs.mu.Unlock()
+	out := make([]string, 0, recentMsgs.n)
+	start := (recentMsgs.next - recentMsgs.n + maxRecentMsgs) % maxRecentMsgs
+	for i := 0; i < recentMsgs.n; i++ {
+		out = append(out, recentMsgs.buf[(start+i)%maxRecentMsgs])
+	}
+	return out
+}
+
+// writeCrashReport saves the panic, its stack and the recent message log
+// under dir/crashes and returns the file path.
+func writeCrashReport(dir string, r any, stack []byte, msgs []string) (string, error) {
+	crashDir := filepath.Join(dir, "crashes")
+	if err := os.MkdirAll(crashDir, 0o700); err != nil {
+		return "", err
+	}
+	p := filepath.Join(crashDir, fmt.Sprintf("crash-%s.txt", timestamp()))
+	var b strings.Builder
+	fmt.Fprintf(&b, "disktree crash report\n\ntime:    %s\nruntime: %s %s/%s\nargs:    %q\n\npanic: %v\n\n%s\n",
+		time.Now().Format(time.RFC3339), runtime.Version(), runtime.GOOS, runtime.GOARCH, os.Args, r, stack)
+	fmt.Fprintf(&b, "\nlast %d messages (oldest first):\n", len(msgs))
+	for _, m := range msgs {
+		b.WriteString("  " + m + "\n")
+	}
+	if err := os.WriteFile(p, []byte(b.String()), 0o600); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// crashHandler restores the terminal and writes a crash report when any
+// guarded goroutine panics. It is installed by main only; without it
+// crashGuard re-panics so tests fail normally.
+type crashHandler struct {
+	once     sync.Once
+	ttyState *term.State
+	out      io.Writer
+}
+
+var activeCrashHandler *crashHandler
+
+// installCrashHandler remembers the terminal state so it can be restored
+// after a panic, even one raised outside the Bubble Tea loop.
+func installCrashHandler() {
+	h := &crashHandler{out: os.Stderr}
+	if term.IsTerminal(os.Stdin.Fd()) {
+		h.ttyState, _ = term.GetState(os.Stdin.Fd())
+	}
+	activeCrashHandler = h
+}
+
+// crashGuard is deferred at the top of goroutines we start, around commands
+// and around the program itself.
+func crashGuard() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	h := activeCrashHandler
+	if h == nil {
+		panic(r)
+	}
+	h.crash(r, debug.Stack())
+}
+
+func (h *crashHandler) crash(r any, stack []byte) {
+	h.once.Do(func() {
+		// leave the alternate screen, show the cursor, disable mouse reporting
+		_, _ = io.WriteString(os.Stdout, "\x1b[?1000l\x1b[?1006l\x1b[?1049l\x1b[?25h\r\n")
+		if h.ttyState != nil {
+			_ = term.Restore(os.Stdin.Fd(), h.ttyState)
+		}
+		fmt.Fprintf(h.out, "disktree crashed: %v\n", r)
+		if p, err := writeCrashReport(dataDir(), r, stack, recentMsgLog()); err == nil {
+			fmt.Fprintf(h.out, "A crash report was saved to %s\n", p)
+		} else {
+			fmt.Fprintf(h.out, "Could not save a crash report (%v):\n\n%s\n", err, stack)
+		}
+		os.Exit(2)
+	})
+	select {} // another goroutine is already reporting and exiting
+}
+
+// guardedModel logs every message for crash reports and runs the model's
+// commands under crashGuard. Update and View run on the program goroutine,
+// which main guards.
+type guardedModel struct{ *model }
+
+func (g guardedModel) Init() tea.Cmd {
+	return guardCmd(g.model.Init())
+}
+
+func (g guardedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	recordMsg(msg)
+	_, cmd := g.model.Update(msg)
+	return g, guardCmd(cmd)
+}
+
+// guardCmd wraps cmd, and the commands of any batch it returns, in crashGuard.
+func guardCmd(cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		defer crashGuard()
+		msg := cmd()
+		if batch, ok := msg.(tea.BatchMsg); ok {
+			for i, c := range batch {
+				batch[i] = guardCmd(c)
+			}
+		}
+		return msg
+	}
+}
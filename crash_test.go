@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestRecentMsgLogKeepsNewest(t *testing.T) {
+	for i := 0; i < maxRecentMsgs+5; i++ {
+		recordMsg(fmt.Sprintf("msg-%d", i))
+	}
+	log := recentMsgLog()
+	if len(log) != maxRecentMsgs {
+		t.Fatalf("expected %d messages, got %d", maxRecentMsgs, len(log))
+	}
+	if !strings.HasSuffix(log[0], "msg-5") || !strings.HasSuffix(log[len(log)-1], fmt.Sprintf("msg-%d", maxRecentMsgs+4)) {
+		t.Fatalf("unexpected order: first %q last %q", log[0], log[len(log)-1])
+	}
+}
+
+func TestWriteCrashReport(t *testing.T) {
+	dir := t.TempDir()
+	p, err := writeCrashReport(dir, "boom", []byte("goroutine 1 [running]:"), []string{"12:00:00.000 tea.KeyMsg d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(p) != filepath.Join(dir, "crashes") {
+		t.Fatalf("report written to %s", p)
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"panic: boom", "goroutine 1 [running]:", "tea.KeyMsg d"} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("report lacks %q:\n%s", want, b)
+		}
+	}
+}
+
+func TestGuardCmdWrapsBatches(t *testing.T) {
+	inner := func() tea.Msg { return "inner" }
+	msg := guardCmd(tea.Batch(inner, inner))()
+	batch, ok := msg.(tea.BatchMsg)
+	if !ok || len(batch) != 2 {
+		t.Fatalf("expected a batch of 2, got %#v", msg)
+	}
+	if got := batch[0](); got != "inner" {
+		t.Fatalf("wrapped command returned %v", got)
+	}
+	if guardCmd(nil) != nil {
+		t.Fatal("guardCmd(nil) should stay nil")
+	}
+}
+
+// TestCrashInGoroutineWritesReport panics in a guarded goroutine of a child
+// process and checks that it exits with a report instead of a raw panic.
+func TestCrashInGoroutineWritesReport(t *testing.T) {
+	if os.Getenv("DISKTREE_CRASH_CHILD") == "1" {
+		installCrashHandler()
+		recordMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("d")})
+		done := make(chan struct{})
+		go func() {
+			defer crashGuard()
+			panic("boom from a scan worker")
+		}()
+		<-done
+		return
+	}
+	data := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashInGoroutineWritesReport$")
+	cmd.Env = append(os.Environ(), "DISKTREE_CRASH_CHILD=1", "XDG_DATA_HOME="+data)
+	out, err := cmd.CombinedOutput()
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2, got %v\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "A crash report was saved to") {
+		t.Fatalf("missing report location in output:\n%s", out)
+	}
+	reports, _ := filepath.Glob(filepath.Join(data, "disktree", "crashes", "crash-*.txt"))
+	if len(reports) != 1 {
+		t.Fatalf("expected one crash report, found %v", reports)
+	}
+	b, _ := os.ReadFile(reports[0])
+	if !strings.Contains(string(b), "boom from a scan worker") || !strings.Contains(string(b), "tea.KeyMsg") {
+		t.Fatalf("unexpected report:\n%s", b)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Debug view --------------------------
+
+// poolStats counts what the walkers of a Scanner are doing, for the D debug
+// view. All methods are safe on a nil *poolStats, which records nothing.
+type poolStats struct {
+	busy    atomic.Int64 // walkers holding a worker slot
+	queued  atomic.Int64 // walkers waiting for a slot
+	listed  atomic.Int64 // directories listed since start
+	reading sync.Map     // path -> time.Time the listing started
+}
+
+// acquire takes a slot of sem, counting the wait as queued. It returns
+// false if ctx ends first.
+func (p *poolStats) acquire(ctx context.Context, sem chan struct{}) bool {
+	if p != nil {
+		p.queued.Add(1)
+		defer p.queued.Add(-1)
+	}
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return false
+	}
+	if p != nil {
+		p.busy.Add(1)
+	}
+	return true
+}
+
+// release gives back a slot taken with acquire.
+func (p *poolStats) release(sem chan struct{}) {
+	<-sem
+	if p != nil {
+		p.busy.Add(-1)
+	}
+}
+
+// read marks dir as being listed until the returned func is called.
+func (p *poolStats) read(dir string) func() {
+	if p == nil {
+		return func() {}
+	}
+	p.reading.Store(dir, time.Now())
+	return func() {
+		p.reading.Delete(dir)
+		p.listed.Add(1)
+	}
+}
+
+// inFlight is a listing that has not returned yet.
+type inFlight struct {
+	path string
+	age  time.Duration
+}
+
+// inFlight returns the listings in progress, longest running first.
+func (p *poolStats) inFlight() []inFlight {
+	var out []inFlight
+	now := time.Now()
+	p.reading.Range(func(k, v any) bool {
+		out = append(out, inFlight{path: k.(string), age: now.Sub(v.(time.Time))})
+		return true
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].age > out[j].age })
+	return out
+}
+
+// debugOverlay shows live worker pool use while a scan or export runs:
+// busy and queued walkers, listing rate, how the in-flight listings spread
+// over the current directory's children, and the slowest of them.
+type debugOverlay struct {
+	// rate sampling; the view is redrawn on every frame
+	at     time.Time
+	listed int64
+	rate   float64
+}
+
+func (o *debugOverlay) opts() overlayOpts {
+	return overlayOpts{id: "debug", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *debugOverlay) View(m *model) string {
+	p := m.scanner.pool
+	w := m.popupWidth(76)
+	inner := maxvalue(20, w-6)
+	if now, n := time.Now(), p.listed.Load(); o.at.IsZero() {
+		o.at, o.listed = now, n
+	} else if d := now.Sub(o.at); d >= time.Second {
+		o.rate = float64(n-o.listed) / d.Seconds()
+		o.at, o.listed = now, n
+	}
+	state := "idle"
+	switch {
+	case m.scanner.gate.paused():
+		state = "paused"
+	case m.loading && m.exportJob != nil:
+		state = "scanning and exporting"
+	case m.loading:
+		state = "scanning"
+	case m.exportJob != nil:
+		state = "exporting"
+	}
+	busy, threads := p.busy.Load(), int64(maxvalue(1, m.scanner.threads))
+	keyStyle := lipgloss.NewStyle().Bold(true).Width(13)
+	faint := lipgloss.NewStyle().Faint(true)
+	rows := [][2]string{
+		{"State", state},
+		{"Workers", fmt.Sprintf("%s %d/%d busy", usageBar(busy, threads, 20), busy, threads)},
+		{"Queued", fmt.Sprintf("%d directories waiting for a worker", p.queued.Load())},
+		{"Rate", fmt.Sprintf("%.0f dirs/s, %d listed", o.rate, p.listed.Load())},
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Scan debug"), ""}
+	for _, r := range rows {
+		lines = append(lines, keyStyle.Render(r[0])+r[1])
+	}
+
+	flights := p.inFlight()
+	if len(flights) > 0 && m.current != nil {
+		// which of the current directory's children the workers are in
+		per := map[string]int64{}
+		var names []string
+		for _, f := range flights {
+			rel, err := filepath.Rel(m.current.Path, f.path)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				rel = "(elsewhere)"
+			} else {
+				rel = strings.SplitN(rel, string(filepath.Separator), 2)[0]
+			}
+			if per[rel] == 0 {
+				names = append(names, rel)
+			}
+			per[rel]++
+		}
+		sort.SliceStable(names, func(i, j int) bool { return per[names[i]] > per[names[j]] })
+		lines = append(lines, "", faint.Render("Listings per directory"))
+		for _, n := range names[:minvalue(6, len(names))] {
+			lines = append(lines, fmt.Sprintf("%s %2d  %s", usageBar(per[n], threads, 12), per[n], truncateToWidth(n, inner-17)))
+		}
+		lines = append(lines, "", faint.Render("Slowest listings in flight"))
+		for _, f := range flights[:minvalue(6, len(flights))] {
+			d := fmt.Sprintf("%6s  ", f.age.Round(100*time.Millisecond))
+			lines = append(lines, d+truncateToWidth(f.path, inner-len(d)))
+		}
+	}
+	lines = append(lines, "", faint.Render("P pause/resume  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *debugOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "D", "q", "enter":
+		return nil, true
+	case "P":
+		m.togglePause()
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
+
+// usageBar draws n of total as a bar of width cells.
+func usageBar(n, total int64, width int) string {
+	filled := int(float64(width) * float64(min(n, total)) / float64(max(1, total)))
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugViewShowsPoolUse(t *testing.T) {
+	dir := t.TempDir()
+	m := initialModel(dir, 2, false)
+	t.Cleanup(m.cancel)
+	m.loading = true
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true}
+	p := m.scanner.pool
+
+	sem := make(chan struct{}, 1)
+	if !p.acquire(context.Background(), sem) {
+		t.Fatal("acquire should succeed with a free slot")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.acquire(ctx, sem) {
+		t.Fatal("acquire on a full pool should give up when canceled")
+	}
+	stuck := filepath.Join(dir, "slow", "deep")
+	done := p.read(stuck)
+
+	o := &debugOverlay{}
+	m.overlays.push(o)
+	v := o.View(m)
+	for _, want := range []string{"scanning", "1/2 busy", "0 directories waiting", "slow", stuck} {
+		if !strings.Contains(v, want) {
+			t.Fatalf("debug view lacks %q:\n%s", want, v)
+		}
+	}
+
+	done()
+	p.release(sem)
+	if p.busy.Load() != 0 || p.listed.Load() != 1 || len(p.inFlight()) != 0 {
+		t.Fatalf("counters after release: busy=%d listed=%d in flight=%d", p.busy.Load(), p.listed.Load(), len(p.inFlight()))
+	}
+}
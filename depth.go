@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Depth guard -------------------------
+
+// maxTreeDepth is how many directory levels below a walked directory are
+// entered (-max-depth). Deeper directories — a pathological tree, or a
+// recursive bind mount that never ends — are left out of totals and
+// exports with a warning, and refused by copies, rather than followed
+// until memory runs out.
+var maxTreeDepth = scanner.DefaultMaxDepth
+
+// errTooDeep marks directories beyond maxTreeDepth.
+var errTooDeep = errors.New("deeper than the -max-depth limit")
+
+// setMaxDepth applies -max-depth (or max_depth from the config).
+func setMaxDepth(n int) error {
+	if n < 1 {
+		return fmt.Errorf("-max-depth must be at least 1, got %d", n)
+	}
+	maxTreeDepth = n
+	return nil
+}
+
+// truncatedNote is the warning shown for a node whose totals leave out
+// directories beyond the limit.
+func truncatedNote() string {
+	return fmt.Sprintf("truncated below %d levels", maxTreeDepth)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// deepTree makes root/d1/d2/.../dN, each level holding a 10 byte file.
+func deepTree(t *testing.T, levels int) string {
+	t.Helper()
+	root := t.TempDir()
+	p := root
+	for i := 1; i <= levels; i++ {
+		p = filepath.Join(p, "d")
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(p, "f"), make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDepthGuard(t *testing.T) {
+	root := deepTree(t, 6)
+	prev := maxTreeDepth
+	t.Cleanup(func() { maxTreeDepth = prev })
+	if err := setMaxDepth(0); err == nil {
+		t.Error("a zero limit should be refused")
+	}
+	if err := setMaxDepth(3); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scanner{threads: 2}
+	res, _ := s.walkSum(context.Background(), root, false)
+	if res.size != 30 || !res.truncated {
+		t.Errorf("walkSum = %+v; want the first three levels and truncated", res)
+	}
+
+	rows := make(chan exportRow, 64)
+	go s.walkExport(context.Background(), root, nil, rows)
+	var tooDeep int
+	for r := range rows {
+		if errors.Is(r.Err, errTooDeep) {
+			tooDeep++
+		}
+	}
+	if tooDeep != 1 {
+		t.Errorf("export flagged %d directories as too deep, want 1", tooDeep)
+	}
+
+	if err := copyDir(root, filepath.Join(t.TempDir(), "copy")); !errors.Is(err, errTooDeep) {
+		t.Errorf("copyDir of a too deep tree: %v", err)
+	}
+	if err := copyDir(filepath.Join(root, "d", "d", "d"), filepath.Join(t.TempDir(), "copy")); err != nil {
+		t.Errorf("copyDir within the limit: %v", err)
+	}
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(context.Background(), root, dst, &copyJob{}); !errors.Is(err, errTooDeep) {
+		t.Errorf("copyTree of a too deep tree: %v", err)
+	}
+	if _, err := os.Lstat(dst); !os.IsNotExist(err) {
+		t.Error("copyTree should remove what it copied of a too deep tree")
+	}
+	job := &copyJob{}
+	if err := copyTree(context.Background(), filepath.Join(root, "d", "d", "d"), dst, job); err != nil || job.files.Load() != 4 {
+		t.Errorf("copyTree within the limit: %v, %d files", err, job.files.Load())
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+import (
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+)
+
+// deviceID returns an identifier for the filesystem holding path. Without
+// device numbers the volume name (e.g. "C:") is the best approximation.
+func deviceID(path string) (uint64, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(strings.ToUpper(filepath.VolumeName(abs))))
+	return h.Sum64(), nil
+}
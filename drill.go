@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Auto-drill --------------------------
+
+// autoDrillShare is the share of its parent a child directory must hold
+// for auto-drill to enter it.
+const autoDrillShare = 0.5
+
+// autoDrillTarget is the directory auto-drill enters from n: its largest
+// child, when that holds more than half of n. nil means n is the hotspot —
+// its usage is spread out or sits in its own files.
+func autoDrillTarget(n *Node) *Node {
+	if n == nil || n.Size <= 0 {
+		return nil
+	}
+	var largest *Node
+	for _, c := range n.Children {
+		if largest == nil || c.Size > largest.Size {
+			largest = c
+		}
+	}
+	if largest == nil || !largest.IsDir || largest.NoAccess || largest.Err != nil {
+		return nil
+	}
+	if float64(largest.Size) <= autoDrillShare*float64(n.Size) {
+		return nil
+	}
+	return largest
+}
+
+// autoDrill enters the largest child of the current directory, and is
+// called again as each level's scan completes until no child holds more
+// than half, leaving the way there in the breadcrumbs (Backspace walks
+// back up).
+func (m *model) autoDrill() tea.Cmd {
+	if !m.autoDrilling {
+		m.autoDrilling = true
+		m.autoDrillFrom = len(m.breadcrumbs)
+	}
+	next := autoDrillTarget(m.current)
+	if next == nil {
+		m.autoDrilling = false
+		if m.current == nil {
+			return nil
+		}
+		levels := len(m.breadcrumbs) - m.autoDrillFrom
+		m.status = fmt.Sprintf("Auto-drill: %s — %s, no child above half", m.current.Path, humanBytes(max(0, m.current.Size)))
+		switch {
+		case levels == 1:
+			m.status += " (1 level down)"
+		case levels > 1:
+			m.status += fmt.Sprintf(" (%d levels down)", levels)
+		}
+		return nil
+	}
+	return m.enterDir(next.Path)
+}
+
+// stopAutoDrill ends an auto-drill where it is; the running level's scan
+// still completes.
+func (m *model) stopAutoDrill() {
+	if !m.autoDrilling {
+		return
+	}
+	m.autoDrilling = false
+	m.status = "Auto-drill stopped at " + m.breadcrumbs[len(m.breadcrumbs)-1]
+}
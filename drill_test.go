@@ -0,0 +1,44 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAutoDrillTarget(t *testing.T) {
+	big := &Node{Name: "big", IsDir: true, Size: 60}
+	n := &Node{Size: 100, Children: []*Node{big, {Name: "small", IsDir: true, Size: 30}, {Name: "f", Size: 10}}}
+	if got := autoDrillTarget(n); got != big {
+		t.Errorf("target = %v, want big", got)
+	}
+	big.Size = 50
+	if got := autoDrillTarget(n); got != nil {
+		t.Errorf("exactly half should stop, got %v", got.Name)
+	}
+	file := &Node{Name: "disk.img", Size: 90}
+	if got := autoDrillTarget(&Node{Size: 100, Children: []*Node{file}}); got != nil {
+		t.Errorf("a file can't be entered, got %v", got.Name)
+	}
+	if got := autoDrillTarget(&Node{Size: 100, Children: []*Node{{Name: "x", IsDir: true, Size: 90, NoAccess: true}}}); got != nil {
+		t.Errorf("an unreadable directory can't be entered, got %v", got.Name)
+	}
+}
+
+func TestAutoDrillStopsAtHotspot(t *testing.T) {
+	h := newTUIHarness(t, 100, 24)
+	h.keys("a")
+	for i := 0; i < 5 && h.m.autoDrilling; i++ {
+		h.settle()
+	}
+	if h.m.autoDrilling {
+		t.Fatal("auto-drill never stopped")
+	}
+	// alpha holds most of the tree, but its own big.bin dominates it
+	if cur := h.m.breadcrumbs[len(h.m.breadcrumbs)-1]; filepath.Base(cur) != "alpha" || len(h.m.breadcrumbs) != 2 {
+		t.Fatalf("breadcrumbs = %v, want the root then alpha", h.m.breadcrumbs)
+	}
+	if !strings.Contains(h.m.status, "Auto-drill") || !strings.Contains(h.m.status, "1 level down") {
+		t.Errorf("status = %q", h.m.status)
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Elevated rescan ---------------------
+
+// sumReport is what the privileged helper (disktree -sum-json <path>) prints.
+type sumReport struct {
+	Size      int64  `json:"size"`
+	Files     int64  `json:"files"`
+	Dirs      int64  `json:"dirs"`
+	Exclusive int64  `json:"exclusive"`
+	Disk      int64  `json:"disk,omitempty"`
+	Cloud     int64  `json:"cloud,omitempty"`
+	Margin    int64  `json:"margin,omitempty"` // of a sampled size
+	Err       string `json:"err,omitempty"`
+}
+
+// runSumHelper is the body of the privileged helper: it sums one subtree and
+// writes the totals as JSON.
+func runSumHelper(w io.Writer, path string, s *Scanner) error {
+	return json.NewEncoder(w).Encode(sumReportOf(s.sumDir(context.Background(), path)))
+}
+
+type elevatedDoneMsg struct {
+	path string
+	rep  sumReport
+	err  error
+}
+
+// elevatorCommand returns the command used to gain privileges: pkexec when a
+// graphical session can show its agent, sudo otherwise.
+func elevatorCommand() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", errors.New("elevated rescan is not supported on Windows")
+	}
+	if os.Geteuid() == 0 {
+		return "", errors.New("already running as root")
+	}
+	if os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != "" {
+		if p, err := exec.LookPath("pkexec"); err == nil {
+			return p, nil
+		}
+	}
+	if p, err := exec.LookPath("sudo"); err == nil {
+		return p, nil
+	}
+	return "", errors.New("neither sudo nor pkexec found")
+}
+
+// elevatedTarget returns the node an elevated rescan should target: the
+// selected row if it failed, else the current directory if it failed.
+func (m *model) elevatedTarget() *Node {
+	if sel := m.selected(); sel != nil && sel.Err != nil {
+		return sel
+	}
+	if m.current != nil && m.current.Err != nil {
+		return m.current
+	}
+	return nil
+}
+
+// rescanElevated re-runs the size calculation for an unreadable subtree via
+// a privileged copy of this binary. The TUI is suspended while the password
+// prompt is shown.
+func (m *model) rescanElevated() tea.Cmd {
+	n := m.elevatedTarget()
+	if n == nil {
+		m.status = "Nothing to rescan: selection has no permission errors"
+		return nil
+	}
+	if uacAvailable() {
+		return m.rescanUAC([]string{n.Path})
+	}
+	elev, err := elevatorCommand()
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	args := []string{self, "-sum-json", n.Path, "-threads", fmt.Sprint(m.threads)}
+	if m.followSymlinks {
+		args = append(args, "-follow-symlinks", "-symlink-policy", m.scanner.linkPolicy.String(), "-root", m.rootPath)
+	}
+	if m.scanner.excludeHidden {
+		args = append(args, "-exclude-hidden")
+	}
+	if m.scanner.oneFileSystem {
+		args = append(args, "-one-file-system")
+	}
+	if m.scanner.allocated {
+		args = append(args, "-allocated")
+	}
+	args = append(args, fmt.Sprintf("-xattrs=%t", m.scanner.xattrs))
+	args = append(args, fmt.Sprintf("-compressed=%t", m.scanner.diskSizes))
+	args = append(args, m.scanner.sampling.args()...)
+	args = append(args, m.scanner.exclude.args()...)
+	var out bytes.Buffer
+	c := exec.Command(elev, args...)
+	c.Stdout = &out
+	path := n.Path
+	m.status = fmt.Sprintf("Rescanning %s with elevated privileges ...", path)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			return elevatedDoneMsg{path: path, err: err}
+		}
+		var rep sumReport
+		if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+			return elevatedDoneMsg{path: path, err: fmt.Errorf("helper output: %w", err)}
+		}
+		return elevatedDoneMsg{path: path, rep: rep}
+	})
+}
+
+// applyElevated merges the helper's totals into the tree and fixes up every
+// cached ancestor.
+func (m *model) applyElevated(msg elevatedDoneMsg) {
+	if msg.err != nil {
+		m.status = "⚠ elevated rescan failed: " + msg.err.Error()
+		return
+	}
+	newErr := m.mergeSum(msg.path, msg.rep)
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	m.status = fmt.Sprintf("%s — %s (%d files, %d dirs) [elevated]", msg.path, humanBytes(msg.rep.Size), msg.rep.Files, msg.rep.Dirs)
+	if newErr != nil {
+		m.status += " ⚠ " + newErr.Error()
+	}
+}
+
+// mergeSum puts fresh totals for path into the tree, wherever the entry is
+// loaded, and fixes up every cached ancestor. It returns the error left in
+// the report.
+func (m *model) mergeSum(path string, rep sumReport) error {
+	var newErr error
+	if rep.Err != "" {
+		newErr = errors.New(rep.Err)
+	}
+	parent := filepath.Dir(path)
+	invalidateSums(path)
+	updated := false
+	m.eachCopy(parent, func(pn *Node) {
+		for _, c := range pn.Children {
+			if samePath(c.Path, path) {
+				c.Size, c.Files, c.Dirs, c.Exclusive, c.Err = rep.Size, rep.Files, rep.Dirs, rep.Exclusive, newErr
+				c.Disk, c.Cloud, c.Margin = rep.Disk, rep.Cloud, rep.Margin
+				c.NoAccess = false
+				updated = true
+			}
+		}
+	})
+	if updated {
+		// recompute the parent from its children and push the change upwards
+		if pn := m.cachedOrCurrent(parent); pn != nil {
+			before := nodeDelta{size: pn.Size, files: pn.Files, dirs: pn.Dirs}
+			m.eachCopy(parent, sumChildren)
+			propagateDelta(parent, nodeDelta{size: pn.Size - before.size, files: pn.Files - before.files, dirs: pn.Dirs - before.dirs})
+		}
+	} else if m.current != nil && samePath(m.current.Path, path) {
+		// the current directory itself was unreadable; show its totals
+		before := nodeDelta{size: m.current.Size, files: m.current.Files, dirs: m.current.Dirs}
+		m.current.Size, m.current.Files, m.current.Dirs, m.current.Err = rep.Size, rep.Files, rep.Dirs, newErr
+		propagateDelta(path, nodeDelta{size: m.current.Size - before.size, files: m.current.Files - before.files, dirs: m.current.Dirs - before.dirs})
+	}
+	return newErr
+}
+
+// --------------------------- Elevated delete ---------------------
+
+// trashReport is what the privileged delete helper (disktree -trash-json
+// <path> -trash-into <dir>) prints.
+type trashReport struct {
+	Item *TrashItem `json:"item,omitempty"`
+	Err  string     `json:"err,omitempty"`
+}
+
+// runTrashHelper is the body of the privileged delete helper: it moves
+// path into the trash directory dir, which is the user's and not root's
+// (sudo resets HOME), and writes the item as JSON.
+func runTrashHelper(w io.Writer, path, dir string) error {
+	var r trashReport
+	ti, err := moveToTrashIn(dir, path)
+	if err != nil {
+		r.Err = err.Error()
+	} else {
+		r.Item = ti
+		// the metadata goes to the owner of the trash, like the rest of
+		// it; the item keeps its owner, so a restore puts it back as it
+		// was and a root-only file doesn't become the user's to read
+		if uid, gid, ok := dirOwner(dir); ok {
+			_ = os.Lchown(ti.TrashPath+trashMetaSuffix, uid, gid)
+		}
+	}
+	return json.NewEncoder(w).Encode(r)
+}
+
+// dirOwner is the owner of dir, where files have owner ids.
+func dirOwner(dir string) (uid, gid int, ok bool) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return 0, 0, false
+	}
+	return fileOwner(fi)
+}
+
+type elevatedTrashMsg struct {
+	path string
+	item *TrashItem
+	err  error
+}
+
+// deleteElevated moves path to the trash via a privileged copy of this
+// binary, after a delete was refused for lack of permission.
+func (m *model) deleteElevated(path string) tea.Cmd {
+	elev, err := elevatorCommand()
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	var out bytes.Buffer
+	c := exec.Command(elev, self, "-trash-json", path, "-trash-into", trashDirFor(path))
+	c.Stdout = &out
+	m.status = fmt.Sprintf("Deleting %s with elevated privileges ...", path)
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		if err != nil {
+			return elevatedTrashMsg{path: path, err: err}
+		}
+		var rep trashReport
+		if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+			return elevatedTrashMsg{path: path, err: fmt.Errorf("helper output: %w", err)}
+		}
+		if rep.Err != "" || rep.Item == nil {
+			return elevatedTrashMsg{path: path, err: errors.New(rep.Err)}
+		}
+		return elevatedTrashMsg{path: path, item: rep.Item}
+	})
+}
+
+// applyElevatedTrash updates the tree for an elevated delete, as for any
+// other. The item keeps its owner in the trash, so moving it out again or
+// removing it takes root too: it is neither journaled for u nor offered
+// to the quit-time empty, and the status line says where it went.
+func (m *model) applyElevatedTrash(msg elevatedTrashMsg) tea.Cmd {
+	if msg.err != nil {
+		audit("trash", msg.path, "", 0, msg.err)
+		m.status = "⚠ elevated delete failed: " + msg.err.Error()
+		return nil
+	}
+	cmd := m.trashed(msg.path, msg.item)
+	m.sessionTrash = slices.DeleteFunc(m.sessionTrash, func(ti *TrashItem) bool { return ti == msg.item })
+	m.status += fmt.Sprintf(" [elevated: u can't undo it; restoring it from %s needs root too]", msg.item.TrashPath)
+	return cmd
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Batch scripts -----------------------
+
+// `disktree exec housekeeping.dts` runs housekeeping without the TUI, one
+// command per line:
+//
+//	# weekly cleanup of the CI cache
+//	scan /srv/ci/cache
+//	filter older-than 90d
+//	export /var/reports/ci-cache.csv
+//	trash **/*.tar.gz max 20G
+//
+//	scan <dir>                    the directory the commands below work on; prints its totals
+//	filter <test> <value>         keep only files older-than, newer-than, larger-than or
+//	                              smaller-than value for the commands below; filter off clears
+//	export <file> [format]        deep export of the scanned directory, as -export
+//	trash <glob> [max <size>]     move the matching entries to the trash, oldest first,
+//	                              stopping before the one that would pass max
+//
+// Globs are matched against paths relative to the scanned directory with
+// / as separator; * stays within a name, ** spans directories, and a glob
+// without a slash matches names at any depth. While a filter is set, only
+// files are trashed: a whole directory would take files it leaves out.
+//
+// The script is checked before anything runs and stops at the first
+// failing command. Deletes have the TUI's rails: protected paths are
+// refused, everything goes to the trash (disktree trash restore brings it
+// back), and each delete is journaled so the next disktree session can undo
+// it with u. -dry-run prints what would be trashed instead.
+
+// errExecUsage is returned for bad arguments to `disktree exec`.
+var errExecUsage = errors.New("usage: disktree exec [-dry-run] <script.dts>")
+
+// scriptStep is one command of a script.
+type scriptStep struct {
+	line int
+	cmd  string
+	args []string
+	// parsed arguments
+	glob *regexp.Regexp
+	max  int64
+}
+
+// scriptFilters maps the tests of filter to the exclusion predicate that
+// keeps what they select (older-than 1y leaves out files newer than 1y).
+var scriptFilters = map[string]int{"newer-than": 0, "older-than": 1, "larger-than": 2, "smaller-than": 3}
+
+// scriptFields splits a line at spaces; double quotes keep a path with
+// spaces together.
+func scriptFields(line string) ([]string, error) {
+	var out []string
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimSpace(line) {
+		if line[0] != '"' {
+			end := strings.IndexAny(line, " \t")
+			if end < 0 {
+				end = len(line)
+			}
+			out = append(out, line[:end])
+			line = line[end:]
+			continue
+		}
+		q, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return nil, errors.New("unterminated quote")
+		}
+		s, _ := strconv.Unquote(q)
+		out = append(out, s)
+		line = line[len(q):]
+	}
+	return out, nil
+}
+
+// parseScript reads a script and checks every command.
+func parseScript(r io.Reader) ([]scriptStep, error) {
+	var steps []scriptStep
+	sc := bufio.NewScanner(r)
+	scanned := false
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f, err := scriptFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		st := scriptStep{line: n, cmd: f[0], args: f[1:]}
+		bad := func(format string, a ...any) ([]scriptStep, error) {
+			return nil, fmt.Errorf("line %d: %s: %s", n, st.cmd, fmt.Sprintf(format, a...))
+		}
+		switch st.cmd {
+		case "scan":
+			if len(st.args) != 1 {
+				return bad("needs a directory")
+			}
+			scanned = true
+		case "filter":
+			switch {
+			case len(st.args) == 1 && st.args[0] == "off":
+			case len(st.args) != 2:
+				return bad("needs a test and a value, e.g. filter older-than 1y")
+			default:
+				i, ok := scriptFilters[st.args[0]]
+				if !ok {
+					return bad("unknown test %q (older-than, newer-than, larger-than, smaller-than)", st.args[0])
+				}
+				var vals [4]string
+				vals[i] = st.args[1]
+				if _, err := newFilePredicates(vals); err != nil {
+					return bad("%v", err)
+				}
+			}
+		case "export":
+			if len(st.args) < 1 || len(st.args) > 2 {
+				return bad("needs a file and optionally a format")
+			}
+			if _, err := exporterFor(st.args[0], strings.Join(st.args[1:], "")); err != nil {
+				return bad("%v", err)
+			}
+		case "trash":
+			switch {
+			case len(st.args) == 3 && st.args[1] == "max":
+				if st.max, err = parseSize(st.args[2]); err != nil || st.max <= 0 {
+					return bad("invalid max %q", st.args[2])
+				}
+			case len(st.args) != 1:
+				return bad("needs a glob and optionally max <size>")
+			}
+			pat := strings.Trim(filepath.ToSlash(st.args[0]), "/")
+			if pat == "" || pat == "**" {
+				return bad("%q would trash everything", st.args[0])
+			}
+			if !strings.Contains(pat, "/") {
+				pat = "**/" + pat
+			}
+			if st.glob, err = regexp.Compile("^" + globRegexp(pat, true) + "$"); err != nil {
+				return bad("%v", err)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown command %q (scan, filter, export, trash)", n, st.cmd)
+		}
+		if st.cmd != "scan" && st.cmd != "filter" && !scanned {
+			return bad("comes before any scan")
+		}
+		steps = append(steps, st)
+	}
+	return steps, sc.Err()
+}
+
+// scriptRun is the state a script builds up as it runs.
+type scriptRun struct {
+	w       io.Writer
+	s       *Scanner
+	dryRun  bool
+	root    string
+	filters [4]string // indexed like predicateFlags
+	protect protectedRules
+	journal *opJournal
+}
+
+// runExec implements `disktree exec`.
+func runExec(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	dryRun := flags.Bool("dry-run", false, "Print what would be trashed without trashing it")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		return errExecUsage
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	steps, err := parseScript(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %w", flags.Arg(0), err)
+	}
+	cfg, _ := loadConfig(defaultConfigPath())
+	_ = configureTrash(cfg.TrashDir, cfg.TrashMounts)
+	auditLog = cfg.AuditLog
+	r := &scriptRun{
+		w:       w,
+		s:       &Scanner{threads: runtime.GOMAXPROCS(0) * 4, mounts: systemMounts(), netThreads: defaultNetThreads},
+		dryRun:  *dryRun,
+		protect: newProtectedRules(cfg.ProtectedPaths, true),
+		// left open on purpose: the next session takes the deletes over,
+		// as it does a crashed session's, so u can undo them
+		journal: &opJournal{path: filepath.Join(journalDir(), strconv.Itoa(os.Getpid())+".json")},
+	}
+	return r.run(context.Background(), steps)
+}
+
+// run executes steps, stopping at the first error.
+func (r *scriptRun) run(ctx context.Context, steps []scriptStep) error {
+	for _, st := range steps {
+		var err error
+		switch st.cmd {
+		case "scan":
+			err = r.scan(ctx, st.args[0])
+		case "filter":
+			err = r.filter(st.args)
+		case "export":
+			o := exportOptions{Format: strings.Join(st.args[1:], "")}
+			err = r.s.runHeadlessExport(r.root, st.args[0], o, nil, r.w)
+		case "trash":
+			err = r.trash(ctx, st)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %s: %w", st.line, st.cmd, err)
+		}
+	}
+	return nil
+}
+
+func (r *scriptRun) scan(ctx context.Context, dir string) error {
+	abs, err := filepath.Abs(expandHome(dir))
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(abs); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", abs)
+	}
+	r.root, r.s.root = abs, abs
+	res := r.s.sumDir(ctx, abs)
+	fmt.Fprintf(r.w, "%s: %s in %d files, %d dirs%s\n", abs, humanBytes(res.size), res.files, res.dirs, r.filterNote())
+	if res.err != nil {
+		fmt.Fprintf(r.w, "  ⚠ %v\n", res.err)
+	}
+	return nil
+}
+
+func (r *scriptRun) filter(args []string) error {
+	if args[0] == "off" {
+		r.filters = [4]string{}
+	} else {
+		r.filters[scriptFilters[args[0]]] = args[1]
+	}
+	p, err := newFilePredicates(r.filters)
+	if err != nil {
+		return err
+	}
+	r.s.exclude = p
+	return nil
+}
+
+// filterNote names the files a filter leaves out, for scan's totals.
+func (r *scriptRun) filterNote() string {
+	if r.s.exclude == nil {
+		return ""
+	}
+	return " (excluding files " + r.s.exclude.describe() + ")"
+}
+
+// scriptMatch is an entry a trash command matched.
+type scriptMatch struct {
+	path    string
+	isDir   bool
+	modTime time.Time
+	size    int64
+	files   int64
+	dirs    int64
+}
+
+// trash moves what st.glob matches below the root to the trash.
+func (r *scriptRun) trash(ctx context.Context, st scriptStep) error {
+	matches, err := r.matches(ctx, st.glob)
+	if err != nil {
+		return err
+	}
+	verb := "trashed"
+	if r.dryRun {
+		verb = "would trash"
+	}
+	var total int64
+	count, refused := 0, 0
+	for _, mt := range matches {
+		if rule, ok := r.protect.match(mt.path); ok {
+			fmt.Fprintf(r.w, "  refused %s: protected by %s\n", mt.path, rule)
+			refused++
+			continue
+		}
+		if st.max > 0 && total+mt.size > st.max {
+			fmt.Fprintf(r.w, "  stopped at %s (%s): it would pass max %s\n", mt.path, humanBytes(mt.size), humanBytes(st.max))
+			break
+		}
+		// what the TUI sends elsewhere fails the step, dry runs included
+		if st, ok := detectStore(mt.path); ok {
+			return fmt.Errorf("%s is in the %s, which disktree doesn't delete from: %s", mt.path, st.name, st.note)
+		}
+		if locked := lockingFlags(mt.path); len(locked) > 0 {
+			return fmt.Errorf("%s has the %s flag and can't be moved; clear it with chflags no%s first", mt.path, strings.Join(locked, ", "), locked[0])
+		}
+		if !r.dryRun {
+			ti, err := moveToTrash(mt.path)
+			audit("trash", mt.path, "", mt.size, err)
+			if err != nil {
+				return err
+			}
+			ti.Size, ti.Files, ti.Dirs = mt.size, mt.files, mt.dirs
+			_ = writeTrashMeta(ti.TrashPath, *ti)
+			r.journal.record(&journalOp{Kind: opTrash, Trash: ti})
+		}
+		fmt.Fprintf(r.w, "  %s %s (%s)\n", verb, mt.path, humanBytes(mt.size))
+		total += mt.size
+		count++
+	}
+	fmt.Fprintf(r.w, "%s %d of %d matches of %s, %s", verb, count, len(matches), st.args[0], humanBytes(total))
+	if refused > 0 {
+		fmt.Fprintf(r.w, "; %d protected", refused)
+	}
+	fmt.Fprintln(r.w)
+	return nil
+}
+
+// matches walks the root for entries glob matches, oldest first. A
+// matching directory is taken whole and not descended, unless a filter is
+// set.
+func (r *scriptRun) matches(ctx context.Context, glob *regexp.Regexp) ([]scriptMatch, error) {
+	var out []scriptMatch
+	err := filepath.WalkDir(r.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == r.root {
+				return err
+			}
+			return nil // unreadable parts are left alone
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		rel, _ := filepath.Rel(r.root, p)
+		if rel == "." || scanner.Special(d.Type()) != scanner.NotSpecial || !glob.MatchString(filepath.ToSlash(rel)) {
+			return nil
+		}
+		if d.IsDir() && r.s.exclude != nil {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		mt := scriptMatch{path: p, isDir: d.IsDir(), modTime: fi.ModTime(), size: fi.Size()}
+		if d.IsDir() {
+			res := r.s.sumDir(ctx, p)
+			mt.size, mt.files, mt.dirs = res.size, res.files, res.dirs
+			out = append(out, mt)
+			return filepath.SkipDir
+		}
+		if r.s.exclude.excludes(fi) {
+			return nil
+		}
+		mt.files = 1
+		out = append(out, mt)
+		return nil
+	})
+	slices.SortStableFunc(out, func(a, b scriptMatch) int { return a.modTime.Compare(b.modTime) })
+	return out, err
+}
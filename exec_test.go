@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScriptErrors(t *testing.T) {
+	for script, want := range map[string]string{
+		"trash *.log":                      "line 1: trash: comes before any scan",
+		"scan /x\nfrobnicate":              `line 2: unknown command "frobnicate"`,
+		"scan /x\nfilter older-than soon":  "line 2: filter:",
+		"scan /x\nfilter bigger 1G":        `unknown test "bigger"`,
+		"scan /x\ntrash ** max 1G":         "would trash everything",
+		"scan /x\ntrash *.log max lots":    `invalid max "lots"`,
+		`scan "/x`:                         "line 1: unterminated quote",
+		"scan /x\nexport out.csv nonsense": "unknown export format",
+	} {
+		_, err := parseScript(strings.NewReader(script))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseScript(%q) = %v; want %q", script, err, want)
+		}
+	}
+	steps, err := parseScript(strings.NewReader("# comment\n\nscan \"/my dir\"\nfilter older-than 1y\ntrash build/*.o max 1G\n"))
+	if err != nil || len(steps) != 3 || steps[0].args[0] != "/my dir" || steps[2].max != 1<<30 {
+		t.Fatalf("steps = %+v, %v", steps, err)
+	}
+	if !steps[2].glob.MatchString("build/a.o") || steps[2].glob.MatchString("src/build/a.o") {
+		t.Error("a glob with a slash should match from the scanned directory")
+	}
+}
+
+func TestExecTrashesOldMatches(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	trashRoutes, trashDirOverride = nil, ""
+	root := t.TempDir()
+	old := time.Now().Add(-400 * 24 * time.Hour)
+	files := map[string]int{"a/old1.log": 100, "a/b/old2.log": 200, "a/new.log": 50, "keep.txt": 10, "c/old3.log": 300}
+	for name, size := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(name, "old") {
+			// the longer name makes old2.log the newest of the old files
+			at := old.Add(time.Duration(len(name)) * time.Hour)
+			if err := os.Chtimes(p, at, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	report := filepath.Join(t.TempDir(), "report.csv")
+	script := filepath.Join(t.TempDir(), "clean.dts")
+	body := "scan " + strconv.Quote(root) + "\nfilter older-than 1y\nexport " + strconv.Quote(report) + "\ntrash *.log max 450\n"
+	if err := os.WriteFile(script, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runExec([]string{"-dry-run", script}, &out); err != nil {
+		t.Fatalf("dry run: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "would trash 2 of 3 matches") {
+		t.Errorf("dry run output:\n%s", out.String())
+	}
+	for name := range files {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Fatalf("dry run removed %s", name)
+		}
+	}
+
+	out.Reset()
+	if err := runExec([]string{script}, &out); err != nil {
+		t.Fatalf("exec: %v\n%s", err, out.String())
+	}
+	for name, gone := range map[string]bool{"c/old3.log": true, "a/old1.log": true, "a/b/old2.log": false, "a/new.log": false, "keep.txt": false} {
+		if _, err := os.Stat(filepath.Join(root, name)); (err != nil) != gone {
+			t.Errorf("%s: gone = %v; want %v\n%s", name, err != nil, gone, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "stopped at "+filepath.Join(root, "a/b/old2.log")) {
+		t.Errorf("the cap should stop before old2.log:\n%s", out.String())
+	}
+	if b, err := os.ReadFile(report); err != nil || !strings.Contains(string(b), "old2.log") || strings.Contains(string(b), "new.log") {
+		t.Errorf("report should list only the old files: %v\n%s", err, b)
+	}
+
+	// the deletes are in the trash and journaled for the next session
+	items, err := readAllTrash()
+	if err != nil || len(items) != 2 {
+		t.Fatalf("trash = %d items, %v", len(items), err)
+	}
+	ents, _ := os.ReadDir(journalDir())
+	if len(ents) != 1 {
+		t.Fatalf("journal files = %d; want 1", len(ents))
+	}
+	b, _ := os.ReadFile(filepath.Join(journalDir(), ents[0].Name()))
+	var jf journalFile
+	if err := json.Unmarshal(b, &jf); err != nil || jf.Next != 2 {
+		t.Fatalf("journal = %s, %v", b, err)
+	}
+}
+
+func TestExecTrashFailsInsideSystemStores(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the flatpak store is only detected on Linux")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	trashRoutes, trashDirOverride = nil, ""
+	root := filepath.Join(home, ".local", "share", "flatpak")
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "repo.log"), make([]byte, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(t.TempDir(), "clean.dts")
+	if err := os.WriteFile(script, []byte("scan "+strconv.Quote(root)+"\ntrash *.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := runExec([]string{"-dry-run", script}, &out); err == nil || !strings.Contains(err.Error(), "flatpak") {
+		t.Fatalf("a trash step inside a system store should fail, got %v\n%s", err, out.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "repo.log")); err != nil {
+		t.Fatal("the store's file should be left alone")
+	}
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Deep export -------------------------
+
+// exportRow is one line of a deep export.
+type exportRow struct {
+	Name  string
+	Path  string
+	Depth int // 1 = immediate child of the export root
+	IsDir bool
+	Size  int64
+	Files int64
+	Dirs  int64
+	Share float64 // percent of the parent directory's size
+	Err   error
+}
+
+// exportDir tracks a directory whose row can only be written once every
+// subdirectory below it has been summed.
+type exportDir struct {
+	parent   *exportDir
+	row      exportRow
+	mu       sync.Mutex
+	pending  int         // own listing + unfinished subdirectories
+	children []exportRow // immediate children, held until shares are known
+}
+
+// exportJob is a running deep export. Rows are produced by a background
+// walker and written by a single buffered writer, so the TUI stays responsive.
+type exportJob struct {
+	path    string
+	rows    atomic.Int64
+	current atomic.Value // string: directory most recently listed
+	cancel  context.CancelFunc
+	started time.Time
+	onDir   func(exportRow) // called as each directory's subtree completes
+}
+
+// walkExport walks root with the scanner's per-mount worker limits and sends
+// a row for every entry below it. Directory rows are emitted once their
+// subtree is complete; a directory's children are emitted together so their
+// share of the parent can be filled in. The last row is root itself at depth
+// 0. out is closed when the walk ends.
+func (s *Scanner) walkExport(ctx context.Context, root string, job *exportJob, out chan<- exportRow) {
+	var wg sync.WaitGroup
+	var semMu sync.Mutex
+	sems := map[string]chan struct{}{}
+	semFor := func(mi mountInfo) chan struct{} {
+		semMu.Lock()
+		defer semMu.Unlock()
+		sem, ok := sems[mi.Point]
+		if !ok {
+			sem = make(chan struct{}, s.limitFor(mi))
+			sems[mi.Point] = sem
+		}
+		return sem
+	}
+	opts := s.options()
+	var guard scanner.LinkGuard
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		guard.Enter("", real) // the export root counts as entered
+	}
+	limit := opts.DepthLimit()
+	run := traceRunFrom(ctx)
+	emit := func(r exportRow) bool {
+		select {
+		case out <- r:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	// finish completes d and, in a loop rather than by recursion so deep
+	// trees don't deepen the stack, every parent it was the last one of
+	finish := func(d *exportDir) {
+		for d != nil {
+			d.mu.Lock()
+			d.pending--
+			done := d.pending == 0
+			d.mu.Unlock()
+			if !done {
+				return
+			}
+			for _, c := range d.children {
+				if d.row.Size > 0 {
+					c.Share = float64(c.Size) / float64(d.row.Size) * 100
+				}
+				if !emit(c) {
+					return
+				}
+			}
+			d.children = nil
+			if job != nil && job.onDir != nil {
+				job.onDir(d.row)
+			}
+			p := d.parent
+			if p == nil {
+				emit(d.row) // the export root itself, at depth 0
+				return
+			}
+			t0 := run.now()
+			p.mu.Lock()
+			p.row.Size += d.row.Size
+			p.row.Files += d.row.Files
+			p.row.Dirs += d.row.Dirs + 1
+			p.children = append(p.children, d.row)
+			p.mu.Unlock()
+			run.add(phaseAggregate, t0)
+			d = p
+		}
+	}
+
+	var walk func(d *exportDir, mi mountInfo)
+	walk = func(d *exportDir, mi mountInfo) {
+		defer finish(d)
+		if d.row.Depth > limit {
+			d.mu.Lock()
+			d.row.Err = errTooDeep
+			d.mu.Unlock()
+			return
+		}
+		if !s.gate.wait(ctx) {
+			return
+		}
+		if job != nil {
+			job.current.Store(d.row.Path)
+		}
+		t0 := run.now()
+		ents, err := s.readDir(d.row.Path, mi)
+		run.add(phaseReaddir, t0)
+		if errors.Is(err, fs.ErrNotExist) {
+			return // removed since its parent was listed
+		}
+		if err != nil {
+			d.mu.Lock()
+			d.row.Err = err
+			d.mu.Unlock()
+			return
+		}
+		for _, e := range ents {
+			if e.Type()&fs.ModeSymlink != 0 && !s.followSymlinks {
+				continue
+			}
+			if s.excludeHidden && scanner.IsHidden(e) {
+				continue
+			}
+			childPath := filepath.Join(d.row.Path, e.Name())
+			if s.ignored.has(childPath) {
+				continue
+			}
+			isDir, info, kind := e.IsDir(), e.Info, scanner.Special(e.Type())
+			if e.Type()&fs.ModeSymlink != 0 {
+				if target, fi, follow := opts.ResolveLink(childPath); follow {
+					if fi.IsDir() && !guard.Enter(childPath, target) {
+						continue // already walked, or a cycle
+					}
+					isDir, info, kind = fi.IsDir(), func() (fs.FileInfo, error) { return fi, nil }, scanner.Special(fi.Mode())
+				}
+			}
+			if kind != scanner.NotSpecial {
+				continue // FIFOs, sockets and devices have no size to export
+			}
+			if isDir {
+				sub := &exportDir{parent: d, pending: 1, row: exportRow{Name: e.Name(), Path: childPath, Depth: d.row.Depth + 1, IsDir: true}}
+				d.mu.Lock()
+				d.pending++
+				d.mu.Unlock()
+				if s.excludesMount(childPath) {
+					finish(sub)
+					continue
+				}
+				cmi := s.mounts.lookup(childPath)
+				wg.Add(1)
+				go func() {
+					defer crashGuard()
+					defer wg.Done()
+					sem := semFor(cmi)
+					if !s.pool.acquire(ctx, sem) {
+						finish(sub)
+						return
+					}
+					defer s.pool.release(sem)
+					walk(sub, cmi)
+				}()
+				continue
+			}
+			r := exportRow{Name: e.Name(), Path: childPath, Depth: d.row.Depth + 1, Files: 1}
+			t0 := run.now()
+			fi, err := info()
+			run.add(phaseStat, t0)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // removed since the listing
+			}
+			if err == nil && s.exclude.excludes(fi) {
+				continue
+			}
+			if err == nil {
+				r.Size = s.fileSize(childPath, fi)
+			} else {
+				r.Err = err
+			}
+			d.mu.Lock()
+			d.row.Size += r.Size
+			d.row.Files++
+			d.children = append(d.children, r)
+			d.mu.Unlock()
+		}
+	}
+
+	top := &exportDir{pending: 1, row: exportRow{Name: filepath.Base(root), Path: root, IsDir: true}}
+	walk(top, s.mounts.lookup(root))
+	wg.Wait()
+	close(out)
+}
+
+// exportOptions narrow down which rows a deep export writes. Filtered rows
+// still count towards their parents' totals.
+type exportOptions struct {
+	Format        string // exporter name; empty picks one from the file extension
+	MaxDepth      int    // deepest level written, 1 = immediate children; 0 = unlimited
+	MinSize       int64  // skip entries smaller than this
+	DirsOnly      bool
+	Match         *regexp.Regexp // keep only entries whose full path matches; nil keeps all
+	IncludeErrors bool           // keep unreadable entries and add an Error column
+	Meta          *exportMeta    // preamble describing the scan; nil writes none
+	Appending     bool           // adding a snapshot to a time-series file; no header
+}
+
+func (o exportOptions) keep(r exportRow) bool {
+	switch {
+	case o.MaxDepth > 0 && r.Depth > o.MaxDepth:
+		return false
+	case r.Size < o.MinSize:
+		return false
+	case o.DirsOnly && !r.IsDir:
+		return false
+	case o.Match != nil && !o.Match.MatchString(r.Path):
+		return false
+	case r.Err != nil && !o.IncludeErrors:
+		return false
+	}
+	return true
+}
+
+// String summarizes the active filters for status lines, e.g. "depth ≤ 2, ≥ 1.0 MiB".
+func (o exportOptions) String() string {
+	var parts []string
+	if o.MaxDepth > 0 {
+		parts = append(parts, fmt.Sprintf("depth ≤ %d", o.MaxDepth))
+	}
+	if o.MinSize > 0 {
+		parts = append(parts, "≥ "+humanBytes(o.MinSize))
+	}
+	if o.DirsOnly {
+		parts = append(parts, "dirs only")
+	}
+	if o.Match != nil {
+		parts = append(parts, "path ~ /"+o.Match.String()+"/")
+	}
+	if o.IncludeErrors {
+		parts = append(parts, "with errors")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// filterRows forwards the rows o keeps, counting them on job. The depth-0
+// root row is forwarded only when keepRoot is set.
+func filterRows(in <-chan exportRow, o exportOptions, keepRoot bool, job *exportJob) <-chan exportRow {
+	out := make(chan exportRow, cap(in))
+	go func() {
+		defer crashGuard()
+		defer close(out)
+		for r := range in {
+			if r.Err != nil && o.Meta != nil {
+				o.Meta.errors.Add(1)
+			}
+			if r.Depth == 0 {
+				if keepRoot {
+					out <- r
+				}
+				continue
+			}
+			if !o.keep(r) {
+				continue
+			}
+			out <- r
+			if job != nil {
+				job.rows.Add(1)
+			}
+		}
+	}()
+	return out
+}
+
+// runDeepExport walks root and writes every entry below it to path, in the
+// format chosen by o.Format or the file extension. Formats that can stream
+// rows are written while the walk runs; the others get the finished tree.
+func (s *Scanner) runDeepExport(ctx context.Context, root, path string, o exportOptions, job *exportJob) (err error) {
+	ex, err := exporterFor(path, o.Format)
+	if err != nil {
+		return err
+	}
+	ctx, run := s.trace.begin(ctx, "export", root)
+	defer func() { run.end(err) }()
+	if o.Meta == nil {
+		o.Meta = s.exportMeta(root, o.String())
+	}
+	f, appending, undo, err := createExport(path, ex)
+	if err != nil {
+		return err
+	}
+	o.Appending = appending
+	raw := make(chan exportRow, 1024)
+	go func() {
+		defer crashGuard()
+		s.walkExport(ctx, root, job, raw)
+	}()
+	bw := bufio.NewWriterSize(f, 64<<10)
+	t0 := run.now()
+	var werr error
+	if sx, ok := ex.(seriesExporter); ok {
+		werr = sx.WriteRows(bw, filterRows(raw, o, true, job), o)
+	} else if rx, ok := ex.(rowExporter); ok {
+		werr = rx.WriteRows(bw, filterRows(raw, o, false, job), o)
+	} else {
+		werr = ex.Write(bw, rowsToTree(filterRows(raw, o, true, job)), o)
+	}
+	if werr == nil {
+		werr = bw.Flush()
+	}
+	cerr := f.Close()
+	run.add(phaseExport, t0)
+	if ctx.Err() != nil {
+		undo()
+		return ctx.Err()
+	}
+	if werr != nil {
+		return werr
+	}
+	return cerr
+}
+
+type deepExportDoneMsg struct {
+	path string
+	rows int64
+	err  error
+}
+
+type exportProgressMsg struct{}
+
+func exportProgressTick() tea.Cmd {
+	return tea.Tick(200*time.Millisecond, func(time.Time) tea.Msg { return exportProgressMsg{} })
+}
+
+// runHeadlessExport writes a deep export of root without starting the TUI.
+// With a webhook, directory summaries are streamed to it as the walk goes.
+func (s *Scanner) runHeadlessExport(root, path string, o exportOptions, hook *webhook, w io.Writer) error {
+	job := &exportJob{path: path, started: time.Now()}
+	if hook != nil {
+		hook.start(root)
+		job.onDir = hook.dir
+	}
+	err := s.runDeepExport(context.Background(), root, path, o, job)
+	if hook != nil {
+		_, _ = fmt.Fprintln(w, hook.finish(job.rows.Load(), err))
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "Exported %d rows to %s in %s\n", job.rows.Load(), path, time.Since(job.started).Round(time.Millisecond))
+	return nil
+}
+
+// startDeepExport exports the whole subtree of the current directory to path
+// in the background and shows a progress dialog.
+func (m *model) startDeepExport(path string, o exportOptions) tea.Cmd {
+	return m.startExport(m.breadcrumbs[len(m.breadcrumbs)-1], path, o)
+}
+
+// startExport exports the subtree of root to path in the background.
+func (m *model) startExport(root, path string, o exportOptions) tea.Cmd {
+	if m.exportJob != nil {
+		m.overlays.push(exportProgressOverlay{})
+		return nil
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	job := &exportJob{path: path, cancel: cancel, started: time.Now()}
+	job.current.Store(root)
+	m.exportJob = job
+	m.overlays.push(exportProgressOverlay{})
+	run := func() tea.Msg {
+		err := m.scanner.runDeepExport(ctx, root, job.path, o, job)
+		return deepExportDoneMsg{path: job.path, rows: job.rows.Load(), err: err}
+	}
+	return tea.Batch(run, exportProgressTick())
+}
+
+func (m *model) finishDeepExport(msg deepExportDoneMsg) tea.Cmd {
+	m.exportJob = nil
+	m.overlays.remove("export-progress")
+	if !m.loading {
+		m.scanner.gate.unpause()
+	}
+	switch {
+	case msg.err == context.Canceled:
+		m.status = "Export canceled"
+	case msg.err != nil:
+		m.status = "⚠ export failed: " + msg.err.Error()
+	default:
+		m.status = fmt.Sprintf("Exported %d rows to %s", msg.rows, msg.path)
+		return m.showExportToast(msg.path, fmt.Sprintf("%d rows", msg.rows))
+	}
+	return nil
+}
+
+// exportProgressOverlay shows a running deep export. Esc cancels it; Enter
+// hides the dialog and leaves progress in the status line.
+type exportProgressOverlay struct{}
+
+func (exportProgressOverlay) opts() overlayOpts {
+	return overlayOpts{id: "export-progress", z: zDialog, focusable: true}
+}
+
+func (exportProgressOverlay) View(m *model) string {
+	w := m.popupWidth(60)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Exporting ...")}
+	if job := m.exportJob; job != nil {
+		cur, _ := job.current.Load().(string)
+		lines = append(lines,
+			"",
+			fmt.Sprintf("%s %d rows → %s", m.busyIndicator(), job.rows.Load(), job.path),
+			truncateToWidth(cur, maxvalue(10, w-6)),
+			fmt.Sprintf("elapsed %s", time.Since(job.started).Round(time.Second)),
+		)
+	}
+	lines = append(lines, "", lipgloss.NewStyle().Faint(true).Render("Esc cancel  P pause  Enter run in background"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (exportProgressOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "P":
+		m.togglePause()
+	case "esc":
+		if m.exportJob != nil {
+			m.exportJob.cancel()
+			m.status = "Canceling export ..."
+		}
+		return nil, true
+	case "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
+
+// exportDialog collects the deep export file name and filters before the
+// export starts. Tab/↑/↓ move between fields, Space toggles checkboxes and
+// cycles the format, which follows the file extension.
+type exportDialog struct {
+	inputs  [4]textinput.Model // file, max depth, min size, path match
+	filters exportOptions
+	focus   int // 0-3 inputs, 4 dirs-only, 5 include-errors, 6 format
+	err     string
+}
+
+const exportDialogFields = 7
+
+func newExportDialog(m *model) *exportDialog {
+	d := &exportDialog{filters: m.exportOpts}
+	depth, minSize, match := "", "", ""
+	if d.filters.MaxDepth > 0 {
+		depth = strconv.Itoa(d.filters.MaxDepth)
+	}
+	if d.filters.MinSize > 0 {
+		minSize = humanBytes(d.filters.MinSize)
+	}
+	if d.filters.Match != nil {
+		match = d.filters.Match.String()
+	}
+	for i, v := range []string{fmt.Sprintf("du-deep-%s.csv", timestamp()), depth, minSize, match} {
+		ti := textinput.New()
+		ti.Prompt = ""
+		ti.SetValue(v)
+		ti.CursorEnd()
+		ti.Cursor.SetMode(cursor.CursorStatic)
+		ti.Width = m.popupWidth(60) - 24
+		d.inputs[i] = ti
+	}
+	d.inputs[1].Placeholder = "unlimited"
+	d.inputs[2].Placeholder = "0"
+	d.inputs[3].Placeholder = "any (regex, e.g. cache|tmp|log)"
+	d.inputs[0].Focus()
+	return d
+}
+
+func (d *exportDialog) opts() overlayOpts {
+	return overlayOpts{id: "export-dialog", z: zDialog, dim: true, focusable: true}
+}
+
+func (d *exportDialog) View(m *model) string {
+	label := func(i int, s string) string {
+		st := lipgloss.NewStyle().Width(16)
+		if i == d.focus {
+			st = st.Bold(true).Foreground(lipgloss.Color("2"))
+		}
+		return st.Render(s)
+	}
+	check := func(on bool) string {
+		if on {
+			return "[x]"
+		}
+		return "[ ]"
+	}
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render("Deep export of " + m.breadcrumbs[len(m.breadcrumbs)-1]),
+		"",
+		label(0, "File") + d.inputs[0].View(),
+		label(1, "Max depth") + d.inputs[1].View(),
+		label(2, "Min size") + d.inputs[2].View(),
+		label(3, "Path match") + d.inputs[3].View(),
+		label(4, "Dirs only") + check(d.filters.DirsOnly),
+		label(5, "Include errors") + check(d.filters.IncludeErrors),
+		label(6, "Format") + d.format().Name(),
+	}
+	if d.err != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("⚠ "+d.err))
+	}
+	lines = append(lines, "", lipgloss.NewStyle().Faint(true).Render("Enter export  Tab next  Space toggle/cycle  Esc cancel"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(m.popupWidth(60)).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+// format is the exporter matching the file name as typed.
+func (d *exportDialog) format() Exporter {
+	ex, _ := exporterFor(d.inputs[0].Value(), "")
+	return ex
+}
+
+// cycleFormat switches the file name to the next registered format.
+func (d *exportDialog) cycleFormat() {
+	cur := d.format()
+	name := d.inputs[0].Value()
+	if strings.HasSuffix(strings.ToLower(name), cur.Extension()) {
+		name = name[:len(name)-len(cur.Extension())]
+	}
+	next := exporters[0]
+	for i, e := range exporters {
+		if e.Name() == cur.Name() {
+			next = exporters[(i+1)%len(exporters)]
+		}
+	}
+	d.inputs[0].SetValue(name + next.Extension())
+	d.inputs[0].CursorEnd()
+}
+
+func (d *exportDialog) setFocus(i int) {
+	d.focus = (i + exportDialogFields) % exportDialogFields
+	for j := range d.inputs {
+		if j == d.focus {
+			d.inputs[j].Focus()
+		} else {
+			d.inputs[j].Blur()
+		}
+	}
+}
+
+// parse validates the dialog fields and returns the file name and options.
+func (d *exportDialog) parse() (string, exportOptions, error) {
+	o := d.filters
+	path := strings.TrimSpace(d.inputs[0].Value())
+	if err := validateExportPath(path); err != nil {
+		return "", o, err
+	}
+	o.MaxDepth = 0
+	if v := strings.TrimSpace(d.inputs[1].Value()); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return "", o, fmt.Errorf("max depth must be a non-negative number")
+		}
+		o.MaxDepth = n
+	}
+	o.MinSize = 0
+	if v := strings.TrimSpace(d.inputs[2].Value()); v != "" {
+		n, err := parseSize(v)
+		if err != nil {
+			return "", o, err
+		}
+		o.MinSize = n
+	}
+	o.Match = nil
+	if v := strings.TrimSpace(d.inputs[3].Value()); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return "", o, fmt.Errorf("path match: %w", err)
+		}
+		o.Match = re
+	}
+	return expandHome(path), o, nil
+}
+
+func (d *exportDialog) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "tab", "down":
+		d.setFocus(d.focus + 1)
+		return nil, false
+	case "shift+tab", "up":
+		d.setFocus(d.focus - 1)
+		return nil, false
+	case "enter":
+		path, o, err := d.parse()
+		if err != nil {
+			d.err = err.Error()
+			return nil, false
+		}
+		m.exportOpts = o
+		return m.startDeepExport(path, o), true
+	case " ":
+		switch d.focus {
+		case 4:
+			d.filters.DirsOnly = !d.filters.DirsOnly
+			return nil, false
+		case 5:
+			d.filters.IncludeErrors = !d.filters.IncludeErrors
+			return nil, false
+		case 6:
+			d.cycleFormat()
+			return nil, false
+		}
+	}
+	if d.focus >= len(d.inputs) {
+		return nil, false
+	}
+	d.err = ""
+	var cmd tea.Cmd
+	d.inputs[d.focus], cmd = d.inputs[d.focus].Update(msg)
+	return cmd, false
+}
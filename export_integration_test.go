@@ -5,6 +5,9 @@ import (
 	"encoding/csv"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +31,9 @@ func TestExportCSVIntegration(t *testing.T) {
 	n := m.scanner.scanDir(context.Background(), tmp)
 	m.current = n
 
-	// run export command and get the message
+	// run export command and get the message; it writes to the working
+	// directory
+	t.Chdir(t.TempDir())
 	msg := m.exportCSV()()
 	exMsg, ok := msg.(exportDoneMsg)
 	if !ok {
@@ -46,6 +51,7 @@ func TestExportCSVIntegration(t *testing.T) {
 		_ = f.Close()
 	}(f)
 	r := csv.NewReader(f)
+	r.Comment = '#' // metadata preamble
 	rec, err := r.Read()
 	if err != nil {
 		t.Fatal(err)
@@ -54,3 +60,135 @@ func TestExportCSVIntegration(t *testing.T) {
 		t.Fatalf("unexpected csv header: %v", rec)
 	}
 }
+
+func TestDeepExportStreamsWholeSubtree(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a/f1": 10, "a/b/f2": 30, "c": 60} {
+		if err := os.WriteFile(filepath.Join(tmp, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "deep.csv")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	job := &exportJob{path: out}
+	if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{}, job); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	recs, err := readExportCSV(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := job.rows.Load(); got != 5 || len(recs) != 6 {
+		t.Fatalf("expected 5 rows, job counted %d, file has %d records", got, len(recs)-1)
+	}
+	pos := map[string]int{}
+	byName := map[string][]string{}
+	for i, r := range recs[1:] {
+		pos[r[0]] = i
+		byName[r[0]] = r
+	}
+	// directories follow their contents
+	if pos["b"] < pos["f2"] || pos["a"] < pos["b"] || pos["a"] < pos["f1"] {
+		t.Fatalf("directory rows written before their contents: %v", pos)
+	}
+	if a := byName["a"]; a[2] != "40" || a[4] != "2" || a[5] != "1" || a[6] != "40.0" {
+		t.Fatalf("unexpected row for a: %v", a)
+	}
+	if f1 := byName["f1"]; f1[6] != "25.0" {
+		t.Fatalf("expected f1 to be 25%% of a, got %v", f1)
+	}
+}
+
+// readExportCSV reads an export's records, skipping the "#" metadata lines.
+func readExportCSV(f *os.File) ([][]string, error) {
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	return r.ReadAll()
+}
+
+func TestDeepExportCancelRemovesPartialFile(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "f"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "deep.csv")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s := &Scanner{threads: 1, mounts: newMountTable(nil)}
+	if err := s.runDeepExport(ctx, tmp, out, exportOptions{}, nil); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Fatalf("expected partial export to be removed, stat err = %v", err)
+	}
+}
+
+func TestDeepExportFilters(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a/f1": 10, "a/b/f2": 30, "c": 60, "d": 1} {
+		if err := os.WriteFile(filepath.Join(tmp, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(o exportOptions) [][]string {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), "deep.csv")
+		s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+		if err := s.runDeepExport(context.Background(), tmp, out, o, nil); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		recs, err := readExportCSV(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recs
+	}
+
+	recs := read(exportOptions{MaxDepth: 1, MinSize: 2})
+	if len(recs) != 3 || recs[1][0] == "d" || recs[2][0] == "d" {
+		t.Fatalf("expected a and c only, got %v", recs)
+	}
+	if a := recs[0]; len(a) != len(exportHeader) {
+		t.Fatalf("unexpected header %v", a)
+	}
+
+	recs = read(exportOptions{DirsOnly: true, IncludeErrors: true})
+	if len(recs) != 3 || recs[0][len(recs[0])-1] != "Error" {
+		t.Fatalf("expected header with Error column and rows for a, b: %v", recs)
+	}
+	// filtered rows still count towards their parents
+	for _, r := range recs[1:] {
+		if r[0] == "a" && r[2] != "40" {
+			t.Fatalf("expected a to total 40 bytes, got %v", r)
+		}
+	}
+
+	// the pattern is matched against the full path, so a directory's name
+	// keeps everything below it
+	recs = read(exportOptions{Match: regexp.MustCompile(`[/\\]b([/\\]|$)|[/\\]c$`)})
+	var names []string
+	for _, r := range recs[1:] {
+		names = append(names, r[0])
+	}
+	slices.Sort(names)
+	if strings.Join(names, ",") != "b,c,f2" {
+		t.Fatalf("path match kept %v; want b, c and f2", names)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// --------------------------- Export toast ------------------------
+
+// toastTimeout is how long the export toast stays up without a key press.
+const toastTimeout = 10 * time.Second
+
+// exportToast confirms a finished export in the bottom-right corner and
+// offers to open the file, reveal it in the file manager or copy its path.
+// Any other key dismisses it and is handled as usual.
+type exportToast struct {
+	path string // absolute
+	what string // e.g. "current view", "1234 rows"
+	seq  int    // matches the toastExpiredMsg that closes it
+	note string // outcome of the last action
+}
+
+// toastExpiredMsg closes the toast with the same seq if it is still up.
+type toastExpiredMsg struct{ seq int }
+
+// showExportToast pushes the toast for path and schedules its timeout.
+func (m *model) showExportToast(path, what string) tea.Cmd {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	m.toastSeq++
+	seq := m.toastSeq
+	m.overlays.push(&exportToast{path: path, what: what, seq: seq})
+	return tea.Tick(toastTimeout, func(time.Time) tea.Msg { return toastExpiredMsg{seq: seq} })
+}
+
+func (o *exportToast) opts() overlayOpts {
+	return overlayOpts{id: "export-toast", z: zDialog, focusable: true, corner: true}
+}
+
+func (o *exportToast) View(m *model) string {
+	w := m.popupWidth(56)
+	inner := maxvalue(10, w-4)
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render("✓ Exported " + o.what),
+		truncateToWidth(o.path, inner),
+	}
+	if o.note != "" {
+		lines = append(lines, truncateToWidth(o.note, inner))
+	}
+	lines = append(lines, faint.Render("o open  r reveal  c copy path  Esc dismiss"))
+	style := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Width(w).Background(lipgloss.Color("0"))
+	return style.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (o *exportToast) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	var err error
+	switch msg.String() {
+	case "o":
+		if err = openPath(o.path); err == nil {
+			o.note = "Opened with the default application"
+		}
+	case "r":
+		if err = revealPath(o.path); err == nil {
+			o.note = "Shown in the file manager"
+		}
+	case "c":
+		if err = copyToClipboard(o.path); err == nil {
+			o.note = "Path copied to the clipboard"
+		}
+	case "esc":
+		return nil, true
+	default:
+		// not ours: close and let the main view handle the key
+		return func() tea.Msg { return msg }, true
+	}
+	if err != nil {
+		o.note = "⚠ " + err.Error()
+	}
+	return nil, false
+}
+
+// openPath opens p with the desktop's default application.
+func openPath(p string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return startDetached("open", p)
+	case "windows":
+		return startDetached("rundll32", "url.dll,FileProtocolHandler", p)
+	}
+	if ok, err := wslExplorer(p, false); ok {
+		return err
+	}
+	return startDetached("xdg-open", p)
+}
+
+// revealPath shows p selected in the file manager where the platform can,
+// and opens its directory otherwise.
+func revealPath(p string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return startDetached("open", "-R", p)
+	case "windows":
+		return startDetached("explorer", "/select,"+p)
+	}
+	if ok, err := wslExplorer(p, true); ok {
+		return err
+	}
+	// the freedesktop file manager interface selects the file; not every
+	// desktop has it
+	if err := startDetached("dbus-send", "--session", "--print-reply", "--dest=org.freedesktop.FileManager1",
+		"/org/freedesktop/FileManager1", "org.freedesktop.FileManager1.ShowItems",
+		"array:string:file://"+filepath.ToSlash(p), "string:"); err == nil {
+		return nil
+	}
+	return startDetached("xdg-open", filepath.Dir(p))
+}
+
+// startDetached starts a helper program without tying it to the terminal:
+// its output is discarded so it can't draw over the TUI.
+func startDetached(name string, args ...string) error {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return fmt.Errorf("%s not found", name)
+	}
+	c := exec.Command(path, args...)
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go func() { _ = c.Wait() }()
+	return nil
+}
+
+// copyToClipboard puts s on the system clipboard, or asks the terminal to
+// (OSC 52) when no clipboard tool is available, e.g. over SSH.
+func copyToClipboard(s string) error {
+	if err := clipboard.WriteAll(s); err == nil {
+		return nil
+	}
+	if os.Getenv("TERM") == "dumb" {
+		return fmt.Errorf("no clipboard available")
+	}
+	termenv.NewOutput(os.Stdout).Copy(s)
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestExportToast(t *testing.T) {
+	dir := t.TempDir()
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.width, m.height = 100, 30
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Scanned: true}
+
+	m.Update(exportDoneMsg{err: errors.New("disk full")})
+	if m.overlays.has("export-toast") || !strings.Contains(m.status, "disk full") {
+		t.Fatalf("a failed export should only report, status %q", m.status)
+	}
+
+	out := filepath.Join(dir, "du.csv")
+	_, expire := m.Update(exportDoneMsg{path: out})
+	o, ok := m.overlays.focused().(*exportToast)
+	if !ok || expire == nil {
+		t.Fatalf("a finished export should show the toast and schedule its timeout")
+	}
+	lines := strings.Split(m.View(), "\n")
+	bottom := strings.Join(lines[len(lines)-8:], "\n")
+	if !strings.Contains(bottom, "✓ Exported the current view") || !strings.Contains(bottom, "o open  r reveal  c copy path") {
+		t.Fatalf("the toast should sit at the bottom of the screen:\n%s", m.View())
+	}
+
+	// a second export replaces the toast; the first one's timeout must not close it
+	m.Update(exportDoneMsg{path: out})
+	m.Update(toastExpiredMsg{seq: o.seq})
+	if !m.overlays.has("export-toast") {
+		t.Fatalf("a stale timeout closed the newer toast")
+	}
+	m.Update(toastExpiredMsg{seq: m.toastSeq})
+	if m.overlays.has("export-toast") {
+		t.Fatalf("the toast should close when its timeout fires")
+	}
+
+	m.Update(deepExportDoneMsg{path: out, rows: 42})
+	if o, ok := m.overlays.focused().(*exportToast); !ok || o.what != "42 rows" {
+		t.Fatalf("a finished deep export should show the toast too")
+	}
+	s := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'s'}}
+	_, cmd := m.Update(s)
+	if m.overlays.has("export-toast") || cmd == nil {
+		t.Fatalf("another key should dismiss the toast")
+	}
+	if got, ok := cmd().(tea.KeyMsg); !ok || got.String() != "s" {
+		t.Fatalf("the key should be handed on to the main view, got %#v", got)
+	}
+}
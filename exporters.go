@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --------------------------- Exporters ---------------------------
+
+// Exporter writes a scanned tree in one file format. root is the exported
+// directory; its descendants are written, not root itself. Formats register
+// themselves in init so the TUI and the headless flags pick them up by name
+// or file extension.
+type Exporter interface {
+	Name() string
+	Extension() string // including the dot, e.g. ".csv"
+	Write(w io.Writer, root *Node, o exportOptions) error
+}
+
+// rowExporter is implemented by flat formats that can be written while a
+// deep export is still walking, without holding the tree in memory.
+type rowExporter interface {
+	Exporter
+	WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error
+}
+
+var exporters []Exporter
+
+func registerExporter(e Exporter) {
+	exporters = append(exporters, e)
+}
+
+func init() {
+	registerExporter(csvExporter{})
+	registerExporter(jsonExporter{})
+	registerExporter(ncduExporter{})
+	registerExporter(markdownExporter{})
+	registerExporter(htmlExporter{})
+	registerExporter(tsCSVExporter{})
+	registerExporter(influxExporter{})
+	registerExporter(sessionExporter{})
+}
+
+// exporterNames lists registered formats for flag help and errors.
+func exporterNames() string {
+	names := make([]string, len(exporters))
+	for i, e := range exporters {
+		names[i] = e.Name()
+	}
+	return strings.Join(names, ", ")
+}
+
+// exporterFor returns the exporter called name, or when name is empty the one
+// whose extension matches path (longest match wins, so ".ncdu.json" beats
+// ".json"). Unknown extensions fall back to CSV.
+func exporterFor(path, name string) (Exporter, error) {
+	if name != "" {
+		for _, e := range exporters {
+			if strings.EqualFold(e.Name(), name) {
+				return e, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown export format %q (available: %s)", name, exporterNames())
+	}
+	var best Exporter
+	lower := strings.ToLower(filepath.Base(path))
+	for _, e := range exporters {
+		if strings.HasSuffix(lower, e.Extension()) && (best == nil || len(e.Extension()) > len(best.Extension())) {
+			best = e
+		}
+	}
+	if best == nil {
+		return csvExporter{}, nil
+	}
+	return best, nil
+}
+
+// walkRows sends root's descendants as rows in the order a deep export
+// produces them: a directory's row follows its contents.
+func walkRows(root *Node, fn func(exportRow) error) error {
+	var walk func(n *Node, depth int) error
+	walk = func(n *Node, depth int) error {
+		for _, c := range n.Children {
+			if err := walk(c, depth+1); err != nil {
+				return err
+			}
+		}
+		for _, c := range n.Children {
+			r := exportRow{Name: c.Name, Path: c.Path, Depth: depth, IsDir: c.IsDir, Size: c.Size, Files: c.Files, Dirs: c.Dirs, Share: shareOf(c, n), Err: c.Err}
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(root, 1)
+}
+
+// writeNodeRows adapts a rowExporter to a tree.
+func writeNodeRows(rx rowExporter, w io.Writer, root *Node, o exportOptions) error {
+	rows := make(chan exportRow)
+	done := make(chan error, 1)
+	go func() { done <- rx.WriteRows(w, rows, o) }()
+	_ = walkRows(root, func(r exportRow) error {
+		rows <- r
+		return nil
+	})
+	close(rows)
+	return <-done
+}
+
+// shareOf is c's size as a percentage of its parent.
+func shareOf(c, parent *Node) float64 {
+	if parent.Size <= 0 {
+		return 0
+	}
+	return float64(c.Size) / float64(parent.Size) * 100
+}
+
+// rowsToTree assembles deep export rows into a tree. Rows arrive children
+// first, so each directory row adopts the rows collected for its path; the
+// depth-0 row becomes the root.
+func rowsToTree(rows <-chan exportRow) *Node {
+	pending := map[string][]*Node{}
+	var root *Node
+	for r := range rows {
+		n := &Node{Name: r.Name, Path: r.Path, IsDir: r.IsDir, Size: r.Size, Files: r.Files, Dirs: r.Dirs, Err: r.Err, Scanned: true}
+		if r.IsDir {
+			n.Children = pending[r.Path]
+			delete(pending, r.Path)
+		}
+		if r.Depth == 0 {
+			root = n
+			continue
+		}
+		parent := filepath.Dir(r.Path)
+		pending[parent] = append(pending[parent], n)
+	}
+	if root == nil {
+		root = &Node{}
+	}
+	return root
+}
+
+// exportMeta is the preamble that makes an export self-describing: what was
+// scanned, when, where and how. Formats that stream rows only know the error
+// total once the walk is done and write it after the rows.
+type exportMeta struct {
+	Root    string
+	Time    time.Time
+	Host    string
+	Version string
+	Options string // scan settings and export filters
+	errors  atomic.Int64
+}
+
+// exportMeta describes an export of root made with this scanner's settings
+// plus the export-specific filters.
+func (s *Scanner) exportMeta(root, filters string) *exportMeta {
+	host, _ := os.Hostname()
+	opts := []string{fmt.Sprintf("threads=%d", s.threads)}
+	if s.followSymlinks {
+		opts = append(opts, "follow-symlinks", "symlinks="+s.linkPolicy.String())
+	}
+	if s.excludeHidden {
+		opts = append(opts, "exclude-hidden")
+	}
+	if s.oneFileSystem {
+		opts = append(opts, "one-file-system")
+	}
+	if filters != "" {
+		opts = append(opts, filters)
+	}
+	return &exportMeta{Root: root, Time: time.Now(), Host: host, Version: version, Options: strings.Join(opts, ", ")}
+}
+
+// Errors is the number of unreadable entries met so far.
+func (m *exportMeta) Errors() int64 { return m.errors.Load() }
+
+// fields lists the preamble in display order, without the error total.
+func (m *exportMeta) fields() [][2]string {
+	return [][2]string{
+		{"root", m.Root},
+		{"generated", m.Time.Format(time.RFC3339)},
+		{"host", m.Host},
+		{"version", "disktree " + m.Version},
+		{"options", m.Options},
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// ---- CSV ----
+
+// exportHeader is shared by the current-view and deep CSV exports.
+var exportHeader = []string{"Name", "Path", "SizeBytes", "SizeHuman", "Files", "Dirs", "ParentShare%"}
+
+type csvExporter struct{}
+
+func (csvExporter) Name() string      { return "csv" }
+func (csvExporter) Extension() string { return ".csv" }
+
+func (e csvExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	return writeNodeRows(e, w, root, o)
+}
+
+// CSV has no comment syntax; the preamble uses "# key: value" lines, which
+// most readers can skip (e.g. pandas' comment="#").
+func (csvExporter) WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error {
+	if o.Meta != nil {
+		oneLine := strings.NewReplacer("\n", " ", "\r", " ")
+		for _, f := range o.Meta.fields() {
+			if _, err := fmt.Fprintf(w, "# %s: %s\n", f[0], oneLine.Replace(f[1])); err != nil {
+				return err
+			}
+		}
+	}
+	cw := csv.NewWriter(w)
+	header := exportHeader
+	if o.IncludeErrors {
+		header = append(append([]string{}, exportHeader...), "Error")
+	}
+	werr := cw.Write(header)
+	for r := range rows {
+		if werr != nil {
+			continue // keep draining so the walker can finish
+		}
+		rec := []string{
+			r.Name,
+			r.Path,
+			fmt.Sprintf("%d", r.Size),
+			humanBytes(r.Size),
+			fmt.Sprintf("%d", r.Files),
+			fmt.Sprintf("%d", r.Dirs),
+			fmt.Sprintf("%.1f", r.Share),
+		}
+		if o.IncludeErrors {
+			rec = append(rec, errString(r.Err))
+		}
+		werr = cw.Write(rec)
+	}
+	cw.Flush()
+	if werr != nil {
+		return werr
+	}
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if o.Meta != nil {
+		_, werr = fmt.Fprintf(w, "# errors: %d\n", o.Meta.Errors())
+	}
+	return werr
+}
+
+// ---- JSON ----
+
+type jsonExporter struct{}
+
+func (jsonExporter) Name() string      { return "json" }
+func (jsonExporter) Extension() string { return ".json" }
+
+type jsonNode struct {
+	Meta     *jsonMeta   `json:"meta,omitempty"` // root only
+	Name     string      `json:"name"`
+	Path     string      `json:"path"`
+	IsDir    bool        `json:"is_dir,omitempty"`
+	Size     int64       `json:"size"`
+	Files    int64       `json:"files"`
+	Dirs     int64       `json:"dirs"`
+	Error    string      `json:"error,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+type jsonMeta struct {
+	Root      string `json:"root"`
+	Generated string `json:"generated"`
+	Host      string `json:"host"`
+	Version   string `json:"version"`
+	Options   string `json:"options"`
+	Errors    int64  `json:"errors"`
+}
+
+func (m *exportMeta) json() *jsonMeta {
+	return &jsonMeta{Root: m.Root, Generated: m.Time.Format(time.RFC3339), Host: m.Host, Version: m.Version, Options: m.Options, Errors: m.Errors()}
+}
+
+func (jsonExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	var conv func(n *Node) *jsonNode
+	conv = func(n *Node) *jsonNode {
+		j := &jsonNode{Name: n.Name, Path: n.Path, IsDir: n.IsDir, Size: n.Size, Files: n.Files, Dirs: n.Dirs}
+		if o.IncludeErrors {
+			j.Error = errString(n.Err)
+		}
+		for _, c := range n.Children {
+			j.Children = append(j.Children, conv(c))
+		}
+		return j
+	}
+	top := conv(root)
+	if o.Meta != nil {
+		top.Meta = o.Meta.json()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(top)
+}
+
+// ---- ncdu ----
+
+// ncduExporter writes the ncdu JSON dump format (version 1.2), readable with
+// `ncdu -f file`.
+type ncduExporter struct{}
+
+func (ncduExporter) Name() string      { return "ncdu" }
+func (ncduExporter) Extension() string { return ".ncdu.json" }
+
+func (ncduExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	info := map[string]any{"progname": "disktree", "progver": version, "timestamp": time.Now().Unix()}
+	if o.Meta != nil {
+		// ncdu ignores unknown metadata keys
+		info["timestamp"] = o.Meta.Time.Unix()
+		info["disktree"] = o.Meta.json()
+	}
+	meta, _ := json.Marshal(info)
+	if _, err := fmt.Fprintf(w, "[1,2,%s,\n", meta); err != nil {
+		return err
+	}
+	var write func(n *Node, name string) error
+	write = func(n *Node, name string) error {
+		info := map[string]any{"name": name}
+		if n.Err != nil {
+			info["read_error"] = true
+		}
+		if !n.IsDir && n != root {
+			info["asize"] = n.Size
+			info["dsize"] = n.Size
+			b, _ := json.Marshal(info)
+			_, err := w.Write(b)
+			return err
+		}
+		b, _ := json.Marshal(info)
+		if _, err := fmt.Fprintf(w, "[%s", b); err != nil {
+			return err
+		}
+		for _, c := range n.Children {
+			if _, err := io.WriteString(w, ",\n"); err != nil {
+				return err
+			}
+			if err := write(c, c.Name); err != nil {
+				return err
+			}
+		}
+		_, err := io.WriteString(w, "]")
+		return err
+	}
+	if err := write(root, root.Path); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "]\n")
+	return err
+}
+
+// ---- Markdown ----
+
+type markdownExporter struct{}
+
+func (markdownExporter) Name() string      { return "markdown" }
+func (markdownExporter) Extension() string { return ".md" }
+
+func (e markdownExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	return writeNodeRows(e, w, root, o)
+}
+
+func (markdownExporter) WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error {
+	cell := strings.NewReplacer("|", `\|`, "\n", " ")
+	if o.Meta != nil {
+		var b strings.Builder
+		b.WriteString("# disktree export\n\n")
+		for _, f := range o.Meta.fields() {
+			fmt.Fprintf(&b, "- **%s:** %s\n", f[0], cell.Replace(f[1]))
+		}
+		if _, err := io.WriteString(w, b.String()+"\n"); err != nil {
+			return err
+		}
+	}
+	head := "| Name | Path | Size | Files | Dirs | Share |\n|---|---|---:|---:|---:|---:|\n"
+	if o.IncludeErrors {
+		head = "| Name | Path | Size | Files | Dirs | Share | Error |\n|---|---|---:|---:|---:|---:|---|\n"
+	}
+	_, werr := io.WriteString(w, head)
+	for r := range rows {
+		if werr != nil {
+			continue
+		}
+		line := fmt.Sprintf("| %s | %s | %s | %d | %d | %.1f%% |", cell.Replace(r.Name), cell.Replace(r.Path), humanBytes(r.Size), r.Files, r.Dirs, r.Share)
+		if o.IncludeErrors {
+			line += " " + cell.Replace(errString(r.Err)) + " |"
+		}
+		_, werr = io.WriteString(w, line+"\n")
+	}
+	if werr == nil && o.Meta != nil {
+		_, werr = fmt.Fprintf(w, "\n- **errors:** %d\n", o.Meta.Errors())
+	}
+	return werr
+}
+
+// ---- HTML ----
+
+type htmlExporter struct{}
+
+func (htmlExporter) Name() string      { return "html" }
+func (htmlExporter) Extension() string { return ".html" }
+
+func (e htmlExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	return writeNodeRows(e, w, root, o)
+}
+
+func (htmlExporter) WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error {
+	cols := []string{"Name", "Path", "Size", "Files", "Dirs", "Share"}
+	if o.IncludeErrors {
+		cols = append(cols, "Error")
+	}
+	var pre strings.Builder
+	if o.Meta != nil {
+		pre.WriteString("<dl>\n")
+		for _, f := range o.Meta.fields() {
+			fmt.Fprintf(&pre, "<dt>%s</dt><dd>%s</dd>\n", f[0], html.EscapeString(f[1]))
+		}
+		pre.WriteString("</dl>\n")
+	}
+	_, werr := fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>disktree export</title>\n"+
+		"<style>body{font-family:sans-serif}td.n{text-align:right}</style></head><body>\n%s<table>\n<tr><th>%s</th></tr>\n",
+		pre.String(), strings.Join(cols, "</th><th>"))
+	for r := range rows {
+		if werr != nil {
+			continue
+		}
+		cells := []string{
+			"<td>" + html.EscapeString(r.Name) + "</td>",
+			"<td>" + html.EscapeString(r.Path) + "</td>",
+			`<td class="n" data-bytes="` + fmt.Sprint(r.Size) + `">` + humanBytes(r.Size) + "</td>",
+			fmt.Sprintf(`<td class="n">%d</td>`, r.Files),
+			fmt.Sprintf(`<td class="n">%d</td>`, r.Dirs),
+			fmt.Sprintf(`<td class="n">%.1f%%</td>`, r.Share),
+		}
+		if o.IncludeErrors {
+			cells = append(cells, "<td>"+html.EscapeString(errString(r.Err))+"</td>")
+		}
+		_, werr = io.WriteString(w, "<tr>"+strings.Join(cells, "")+"</tr>\n")
+	}
+	if werr != nil {
+		return werr
+	}
+	end := "</table>\n"
+	if o.Meta != nil {
+		end += fmt.Sprintf("<p>errors: %d</p>\n", o.Meta.Errors())
+	}
+	_, err := io.WriteString(w, end+"</body></html>\n")
+	return err
+}
+
+// ---- Time series ----
+
+// seriesExporter is implemented by time-series formats. Each export adds a
+// snapshot to the file instead of replacing it, so a file written from cron
+// collects a series; every row carries the snapshot's time, and the export
+// root itself is written too (at depth 0), as it is usually the one a
+// dashboard plots.
+type seriesExporter interface {
+	rowExporter
+	series()
+}
+
+// createExport opens path for writing ex: truncated, or for a time-series
+// format appended to. appending reports whether the file already had data,
+// and undo puts the file back as it was, for a canceled export.
+func createExport(path string, ex Exporter) (f *os.File, appending bool, undo func(), err error) {
+	if _, ok := ex.(seriesExporter); !ok {
+		f, err = os.Create(path)
+		return f, false, func() { _ = os.Remove(path) }, err
+	}
+	f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, false, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, false, nil, err
+	}
+	size := fi.Size()
+	undo = func() {
+		if size == 0 {
+			_ = os.Remove(path)
+		} else {
+			_ = os.Truncate(path, size)
+		}
+	}
+	return f, size > 0, undo, nil
+}
+
+// writeSeriesRows adapts a seriesExporter to a tree, root row included.
+func writeSeriesRows(sx seriesExporter, w io.Writer, root *Node, o exportOptions) error {
+	rows := make(chan exportRow)
+	done := make(chan error, 1)
+	go func() { done <- sx.WriteRows(w, rows, o) }()
+	_ = walkRows(root, func(r exportRow) error {
+		rows <- r
+		return nil
+	})
+	rows <- exportRow{Name: root.Name, Path: root.Path, IsDir: true, Size: root.Size, Files: root.Files, Dirs: root.Dirs, Err: root.Err}
+	close(rows)
+	return <-done
+}
+
+// snapshot is what identifies a time-series snapshot: when, where and of
+// what. Exports without a preamble fall back to now and this host.
+func (o exportOptions) snapshot() (t time.Time, host, root string) {
+	if o.Meta != nil {
+		return o.Meta.Time, o.Meta.Host, o.Meta.Root
+	}
+	host, _ = os.Hostname()
+	return time.Now(), host, ""
+}
+
+// tsCSVExporter writes CSV with the snapshot time, host and root on every
+// row, for tools that ingest CSV into a time-series database. The header is
+// written only when the file is new.
+type tsCSVExporter struct{}
+
+func (tsCSVExporter) Name() string      { return "csv-ts" }
+func (tsCSVExporter) Extension() string { return ".ts.csv" }
+func (tsCSVExporter) series()           {}
+
+func (e tsCSVExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	return writeSeriesRows(e, w, root, o)
+}
+
+func (tsCSVExporter) WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error {
+	at, host, root := o.snapshot()
+	stamp := at.UTC().Format(time.RFC3339)
+	cw := csv.NewWriter(w)
+	var werr error
+	if !o.Appending {
+		header := []string{"Time", "Host", "Root", "Path", "Depth", "IsDir", "SizeBytes", "Files", "Dirs", "ParentShare%"}
+		if o.IncludeErrors {
+			header = append(header, "Error")
+		}
+		werr = cw.Write(header)
+	}
+	for r := range rows {
+		if werr != nil {
+			continue // keep draining so the walker can finish
+		}
+		rec := []string{
+			stamp, host, root, r.Path,
+			fmt.Sprint(r.Depth),
+			fmt.Sprint(r.IsDir),
+			fmt.Sprint(r.Size),
+			fmt.Sprint(r.Files),
+			fmt.Sprint(r.Dirs),
+			fmt.Sprintf("%.1f", r.Share),
+		}
+		if o.IncludeErrors {
+			rec = append(rec, errString(r.Err))
+		}
+		werr = cw.Write(rec)
+	}
+	cw.Flush()
+	if werr != nil {
+		return werr
+	}
+	return cw.Error()
+}
+
+// influxExporter writes InfluxDB line protocol, one point per entry in the
+// measurement "disktree", tagged with host, root, path and kind, stamped
+// with the snapshot time in nanoseconds. Every path is a series of its own,
+// so large trees are best exported with -export-depth or -export-dirs-only.
+type influxExporter struct{}
+
+func (influxExporter) Name() string      { return "influx" }
+func (influxExporter) Extension() string { return ".lp" }
+func (influxExporter) series()           {}
+
+func (e influxExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	return writeSeriesRows(e, w, root, o)
+}
+
+// Tag keys and values escape commas, equals signs and spaces; string field
+// values escape quotes and backslashes. Line breaks can't be escaped at all.
+var (
+	influxTag   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", " ", "\r", " ")
+	influxField = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", " ", "\r", " ")
+)
+
+func (influxExporter) WriteRows(w io.Writer, rows <-chan exportRow, o exportOptions) error {
+	at, host, root := o.snapshot()
+	var common strings.Builder
+	common.WriteString("disktree")
+	if host != "" {
+		common.WriteString(",host=" + influxTag.Replace(host))
+	}
+	if root != "" {
+		common.WriteString(",root=" + influxTag.Replace(root))
+	}
+	var werr error
+	for r := range rows {
+		if werr != nil {
+			continue
+		}
+		kind := "file"
+		if r.IsDir {
+			kind = "dir"
+		}
+		var b strings.Builder
+		b.WriteString(common.String())
+		if r.Path != "" {
+			b.WriteString(",path=" + influxTag.Replace(r.Path))
+		}
+		fmt.Fprintf(&b, ",kind=%s size=%di,files=%di,dirs=%di,depth=%di", kind, r.Size, r.Files, r.Dirs, r.Depth)
+		if r.Depth > 0 {
+			fmt.Fprintf(&b, ",share=%.1f", r.Share)
+		}
+		if o.IncludeErrors && r.Err != nil {
+			b.WriteString(`,error="` + influxField.Replace(r.Err.Error()) + `"`)
+		}
+		fmt.Fprintf(&b, " %d\n", at.UnixNano())
+		_, werr = io.WriteString(w, b.String())
+	}
+	return werr
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExporterFor(t *testing.T) {
+	cases := map[string]string{
+		"out.csv":        "csv",
+		"OUT.JSON":       "json",
+		"dump.ncdu.json": "ncdu",
+		"report.md":      "markdown",
+		"report.html":    "html",
+		"disk.ts.csv":    "csv-ts",
+		"disk.lp":        "influx",
+		"noext":          "csv",
+	}
+	for path, want := range cases {
+		ex, err := exporterFor(path, "")
+		if err != nil || ex.Name() != want {
+			t.Errorf("exporterFor(%q) = %v, %v; want %s", path, ex, err, want)
+		}
+	}
+	if ex, err := exporterFor("out.csv", "html"); err != nil || ex.Name() != "html" {
+		t.Errorf("explicit format should win over the extension, got %v, %v", ex, err)
+	}
+	if _, err := exporterFor("out.csv", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func deepExportTree(t *testing.T) string {
+	t.Helper()
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"a/f1": 10, "a/b/f2": 30, "c|d": 60} {
+		if err := os.WriteFile(filepath.Join(tmp, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp
+}
+
+func TestDeepExportJSONTree(t *testing.T) {
+	tmp := deepExportTree(t)
+	out := filepath.Join(t.TempDir(), "tree.json")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root jsonNode
+	if err := json.Unmarshal(b, &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Path != tmp || root.Size != 100 || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	for _, c := range root.Children {
+		if c.Name == "a" && (!c.IsDir || c.Size != 40 || len(c.Children) != 2) {
+			t.Fatalf("unexpected node for a: %+v", c)
+		}
+	}
+}
+
+func TestDeepExportNcduIsValidJSON(t *testing.T) {
+	tmp := deepExportTree(t)
+	out := filepath.Join(t.TempDir(), "dump.ncdu.json")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dump []any
+	if err := json.Unmarshal(b, &dump); err != nil {
+		t.Fatalf("invalid ncdu dump: %v\n%s", err, b)
+	}
+	if len(dump) != 4 || dump[0] != float64(1) {
+		t.Fatalf("unexpected ncdu header: %v", dump[:3])
+	}
+	top, ok := dump[3].([]any)
+	if !ok || len(top) != 3 || top[0].(map[string]any)["name"] != tmp {
+		t.Fatalf("unexpected ncdu root: %v", dump[3])
+	}
+}
+
+func TestMarkdownExportEscapesCells(t *testing.T) {
+	tmp := deepExportTree(t)
+	out := filepath.Join(t.TempDir(), "report.md")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{MaxDepth: 1}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, l := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(l, "|") {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected header, separator and 2 rows, got:\n%s", b)
+	}
+	if !strings.Contains(string(b), `c\|d`) {
+		t.Fatalf("expected | in names to be escaped:\n%s", b)
+	}
+}
+
+func TestExportDialogCyclesFormatExtension(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	d := newExportDialog(m)
+	d.inputs[0].SetValue("out.csv")
+	d.cycleFormat()
+	if got := d.inputs[0].Value(); got != "out.json" {
+		t.Fatalf("expected out.json, got %s", got)
+	}
+	d.cycleFormat()
+	if got := d.inputs[0].Value(); got != "out.ncdu.json" || d.format().Name() != "ncdu" {
+		t.Fatalf("expected out.ncdu.json, got %s", got)
+	}
+}
+
+func TestExportsCarryMetadata(t *testing.T) {
+	tmp := deepExportTree(t)
+	s := &Scanner{threads: 2, mounts: newMountTable(nil), excludeHidden: true}
+	export := func(name string) string {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), name)
+		if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{DirsOnly: true}, nil); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	csvOut := export("out.csv")
+	for _, want := range []string{"# root: " + tmp + "\n", "# version: disktree " + version + "\n", "# options: threads=2, exclude-hidden, dirs only\n"} {
+		if !strings.HasPrefix(csvOut, "# ") || !strings.Contains(csvOut, want) {
+			t.Fatalf("csv preamble lacks %q:\n%s", want, csvOut)
+		}
+	}
+	if !strings.HasSuffix(csvOut, "# errors: 0\n") {
+		t.Fatalf("csv should end with the error total:\n%s", csvOut)
+	}
+
+	var root jsonNode
+	if err := json.Unmarshal([]byte(export("out.json")), &root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Meta == nil || root.Meta.Root != tmp || root.Meta.Generated == "" || root.Meta.Options == "" {
+		t.Fatalf("json export lacks metadata: %+v", root.Meta)
+	}
+	for _, name := range []string{"out.md", "out.html", "out.ncdu.json"} {
+		if out := export(name); !strings.Contains(out, tmp) || !strings.Contains(out, "threads=2") {
+			t.Fatalf("%s export lacks metadata:\n%s", name, out)
+		}
+	}
+}
+
+func TestInfluxExportAppendsSnapshots(t *testing.T) {
+	tmp := deepExportTree(t)
+	if err := os.WriteFile(filepath.Join(tmp, "a b,c"), make([]byte, 5), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "disk.lp")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	for range 2 {
+		if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{MaxDepth: 1}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	// a, c|d, "a b,c" and the root, twice
+	if len(lines) != 8 {
+		t.Fatalf("expected two snapshots of 4 points:\n%s", b)
+	}
+	if !strings.Contains(string(b), `path=`+tmp+`/a\ b\,c,kind=file size=5i`) {
+		t.Fatalf("tag values should be escaped:\n%s", b)
+	}
+	root := lines[3]
+	if !strings.Contains(root, "path="+tmp+",kind=dir size=105i,files=4i,dirs=2i,depth=0i ") || strings.Contains(root, "share=") {
+		t.Fatalf("expected the root point last in the snapshot, got %s", root)
+	}
+	stamp := root[strings.LastIndex(root, " ")+1:]
+	if !strings.HasSuffix(lines[0], " "+stamp) || strings.HasSuffix(lines[4], " "+stamp) {
+		t.Fatalf("each snapshot should share one timestamp:\n%s", b)
+	}
+}
+
+func TestTimestampedCSVWritesHeaderOnce(t *testing.T) {
+	tmp := deepExportTree(t)
+	out := filepath.Join(t.TempDir(), "disk.ts.csv")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	for range 2 {
+		if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{DirsOnly: true}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	recs, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header, then a, a/b and the root per snapshot
+	if len(recs) != 7 || recs[0][0] != "Time" || recs[1][0] == "Time" {
+		t.Fatalf("unexpected rows: %v", recs)
+	}
+	if last := recs[6]; last[2] != tmp || last[3] != tmp || last[4] != "0" || last[6] != "100" {
+		t.Fatalf("expected the root row last, got %v", last)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// --------------------------- Incremental rescans -----------------
+
+// dirRecord remembers what a directory looked like when it was last listed:
+// its mtime, a fingerprint of its entries, the totals of the files directly
+// inside it and the names of its subdirectories and of the followed
+// symlinks to directories.
+type dirRecord struct {
+	mtime   time.Time
+	fp      uint64
+	own     dirSum
+	subdirs []string
+	links   []string
+}
+
+// Records of every directory walked so far, keyed by path. Incremental
+// rescans use them to skip listing directories whose mtime is unchanged
+// (with -trust-mtime) and to tell which re-listed ones changed.
+var dirRecords sync.Map // map[string]*dirRecord
+
+// walkStats counts the directories visited by a walk and how many of them
+// had to be listed again.
+type walkStats struct {
+	dirs     int64 // directories visited
+	rewalked int64 // directories listed and stat'ed again
+	changed  int64 // re-listed directories whose fingerprint differed
+}
+
+func (w *walkStats) add(o walkStats) {
+	w.dirs += o.dirs
+	w.rewalked += o.rewalked
+	w.changed += o.changed
+}
+
+// percent returns the share of directories that were re-listed.
+func (w walkStats) percent() float64 {
+	if w.dirs == 0 {
+		return 0
+	}
+	return float64(w.rewalked) / float64(w.dirs) * 100
+}
+
+// fingerprint hashes the names, types, sizes and mtimes of a directory's
+// entries, so a re-listed directory can tell whether anything actually
+// changed (an mtime bump alone doesn't count).
+type fingerprint struct {
+	h   hash.Hash64
+	buf [8]byte
+}
+
+func newFingerprint() *fingerprint {
+	return &fingerprint{h: fnv.New64a()}
+}
+
+func (f *fingerprint) add(e fs.DirEntry, fi fs.FileInfo) {
+	_, _ = f.h.Write([]byte(e.Name()))
+	_, _ = f.h.Write([]byte{0, byte(e.Type() >> 24)})
+	if fi == nil {
+		return
+	}
+	binary.LittleEndian.PutUint64(f.buf[:], uint64(fi.Size()))
+	_, _ = f.h.Write(f.buf[:])
+	binary.LittleEndian.PutUint64(f.buf[:], uint64(fi.ModTime().UnixNano()))
+	_, _ = f.h.Write(f.buf[:])
+}
+
+func (f *fingerprint) sum() uint64 { return f.h.Sum64() }
+
+// sumDirCached returns the subtree totals for path using an incremental walk
+// that, with -trust-mtime, only re-lists directories whose mtime changed
+// since the last walk.
+func (s *Scanner) sumDirCached(ctx context.Context, path string) (dirSum, walkStats) {
+	return s.walkSum(ctx, path, true)
+}
+
+// forgetSums drops directory records and leaderboard entries for p and
+// everything below it, so the next scan walks the full tree.
+func forgetSums(p string) {
+	leaders.forget(p)
+	dirRecords.Range(func(k, _ any) bool {
+		if underPath(k.(string), p) {
+			dirRecords.Delete(k)
+		}
+		return true
+	})
+}
+
+// invalidateSums drops records affected by a change disktree itself made at
+// p: p's own subtree and its parent, whose listing changed.
+func invalidateSums(p string) {
+	forgetSums(p)
+	dirRecords.Delete(pathKey(filepath.Dir(p)))
+	attached.forget(p)
+}
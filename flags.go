@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// --------------------------- File flags --------------------------
+
+// bsdFlags are the chflags(1) file flags of the BSDs and macOS, by the name
+// chflags and ls -lo use. goos limits a flag to the systems that define
+// that bit; "" means all of them.
+var bsdFlags = []struct {
+	bit  uint32
+	name string
+	goos string
+}{
+	{0x00000001, "nodump", ""},
+	{0x00000002, "uchg", ""},
+	{0x00000004, "uappnd", ""},
+	{0x00000008, "opaque", ""},
+	{0x00000010, "uunlnk", "freebsd dragonfly"},
+	{0x00000020, "compressed", "darwin"},
+	{0x00008000, "hidden", "freebsd darwin"},
+	{0x00010000, "arch", ""},
+	{0x00020000, "schg", ""},
+	{0x00040000, "sappnd", ""},
+	{0x00080000, "restricted", "darwin"},
+	{0x00100000, "sunlnk", "freebsd dragonfly darwin"},
+}
+
+// lockFlags make renaming and unlinking a file fail, for root too while
+// the system flags are in force.
+var lockFlags = []string{"uchg", "uappnd", "uunlnk", "schg", "sappnd", "sunlnk", "restricted"}
+
+// decodeFlags names the flags set in bits on goos.
+func decodeFlags(bits uint32, goos string) []string {
+	var out []string
+	for _, f := range bsdFlags {
+		if bits&f.bit != 0 && (f.goos == "" || slices.Contains(strings.Fields(f.goos), goos)) {
+			out = append(out, f.name)
+		}
+	}
+	return out
+}
+
+// fileFlags returns the names of the flags set on fi; none where the
+// platform has no file flags.
+func fileFlags(fi fs.FileInfo) []string {
+	bits, ok := rawFlags(fi)
+	if !ok {
+		return nil
+	}
+	return decodeFlags(bits, runtime.GOOS)
+}
+
+// lockingFlags returns the flags on path that keep it from being moved to
+// the trash, e.g. "uchg" after chflags uchg.
+func lockingFlags(path string) []string {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, f := range fileFlags(fi) {
+		if slices.Contains(lockFlags, f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
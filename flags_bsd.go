@@ -0,0 +1,17 @@
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// rawFlags returns st_flags.
+func rawFlags(fi fs.FileInfo) (uint32, bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint32(st.Flags), true
+}
@@ -0,0 +1,8 @@
+//go:build !(darwin || freebsd || openbsd || netbsd || dragonfly)
+
+package main
+
+import "io/fs"
+
+// Only the BSDs and macOS have chflags(1) file flags.
+func rawFlags(fs.FileInfo) (uint32, bool) { return 0, false }
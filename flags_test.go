@@ -0,0 +1,20 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDecodeFlags(t *testing.T) {
+	// chflags nodump,uchg,hidden,sunlnk
+	bits := uint32(0x1 | 0x2 | 0x8000 | 0x100000)
+	for goos, want := range map[string][]string{
+		"freebsd": {"nodump", "uchg", "hidden", "sunlnk"},
+		"darwin":  {"nodump", "uchg", "hidden", "sunlnk"},
+		"openbsd": {"nodump", "uchg"},
+	} {
+		if got := decodeFlags(bits, goos); !slices.Equal(got, want) {
+			t.Errorf("%s: got %v, want %v", goos, got, want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+)
+
+// --------------------------- Freed space -------------------------
+
+// freedSpace counts the space a cleanup has freed this session: everything
+// deleted (trashed items still count, since emptying the trash is what
+// finally gives it back) and everything offloaded. Undoing a delete takes
+// it off again.
+type freedSpace struct {
+	total   int64
+	inTrash int64 // part of total that is still in the trash
+}
+
+// trashed counts a delete of this session.
+func (f *freedSpace) trashed(ti *TrashItem) {
+	size := trashedSize(ti)
+	f.total += size
+	f.inTrash += size
+}
+
+// restoredFreed takes back an undone delete. Items trashed by an earlier
+// session were never counted.
+func (m *model) restoredFreed(ti *TrashItem, size int64) {
+	if !slices.Contains(m.sessionTrash, ti) {
+		return
+	}
+	m.freed.total = max(0, m.freed.total-size)
+	m.freed.inTrash = max(0, m.freed.inTrash-size)
+}
+
+// offloaded counts data moved to archival storage.
+func (f *freedSpace) offloaded(size int64) {
+	f.total += max(0, size)
+}
+
+// removed counts a permanent delete.
+func (f *freedSpace) removed(size int64) {
+	f.total += max(0, size)
+}
+
+// summary is the footer's note, or "" before anything was freed.
+func (f *freedSpace) summary() string {
+	if f.total <= 0 {
+		return ""
+	}
+	s := "freed this session: " + humanBytes(f.total)
+	if f.inTrash > 0 {
+		s += " (" + humanBytes(f.inTrash) + " in trash)"
+	}
+	return s
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestFreedThisSession(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cache = sync.Map{}
+	dir := t.TempDir()
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 2048), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 160, Height: 30})
+	m.loading = false
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Scanned: true, Children: []*Node{
+		{Name: "a.bin", Path: filepath.Join(dir, "a.bin"), Size: 2048, Files: 1},
+		{Name: "b.bin", Path: filepath.Join(dir, "b.bin"), Size: 2048, Files: 1},
+	}}
+	sumChildren(m.current)
+	m.journal = &opJournal{path: filepath.Join(journalDir(), "test.json")}
+	if strings.Contains(m.View(), "freed") {
+		t.Fatal("nothing freed yet")
+	}
+
+	m.deleteToTrash(filepath.Join(dir, "a.bin"))
+	m.deleteToTrash(filepath.Join(dir, "b.bin"))
+	if !strings.Contains(m.View(), "freed this session: 4.0 KB (4.0 KB in trash)") {
+		t.Fatalf("footer should count both deletes:\n%s", m.View())
+	}
+	m.undo()
+	m.freed.offloaded(1024)
+	if got := m.freed.summary(); got != "freed this session: 3.0 KB (2.0 KB in trash)" {
+		t.Fatalf("after undo and offload: %q", got)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package main
+
+// freeSpace is not implemented on this platform; callers treat the free
+// space as unknown.
+func freeSpace(string) (int64, error) { return 0, errNoDeviceInfo }
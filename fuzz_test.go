@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/x/ansi"
+)
+
+// Seeds cover the inputs that broke overlays before: styled rows, wide
+// runes (CJK, emoji), combining marks, box drawing and invalid UTF-8.
+var fuzzSeeds = []string{
+	"",
+	"plain ascii text",
+	"\x1b[1mbold\x1b[0m and \x1b[38;5;240mgrey\x1b[0m",
+	"\x1b[48;5;57m 📁 alpha   5.0 KB \x1b[0m",
+	"日本語のファイル名.txt",
+	"élève",
+	"👩‍👩‍👧 family",
+	"╔══════╗\n║ box  ║\n╚══════╝",
+	"tab\tseparated\r\n",
+	"\xff\xfe broken \xc3",
+	"\x1b[38;2;255;0;0mtrue\x1b]8;;http://x\x07link\x1b]8;;\x07",
+}
+
+func FuzzTruncateToWidth(f *testing.F) {
+	for i, s := range fuzzSeeds {
+		f.Add(s, i*3)
+	}
+	f.Fuzz(func(t *testing.T, s string, w int) {
+		// both helpers work on single lines
+		s = strings.ReplaceAll(s, "\n", " ")
+		w = w % 200
+		out := truncateToWidth(s, w)
+		if !utf8.ValidString(out) {
+			t.Fatalf("invalid UTF-8: %q", out)
+		}
+		if got := ansi.StringWidth(out); got > max(w, 0) {
+			t.Fatalf("width %d exceeds %d: %q", got, w, out)
+		}
+		if after := extractAfterPosition(s, w); !utf8.ValidString(after) {
+			t.Fatalf("extractAfterPosition: invalid UTF-8: %q", after)
+		}
+	})
+}
+
+func FuzzRenderOverlay(f *testing.F) {
+	for i, s := range fuzzSeeds {
+		f.Add(s, fuzzSeeds[(i+3)%len(fuzzSeeds)], 40+i, 10+i)
+	}
+	f.Add(strings.Repeat("x", 300), "popup", 1, 1)
+	f.Fuzz(func(t *testing.T, base, popup string, width, height int) {
+		// keep sizes within what a terminal can report
+		width = 1 + abs(width)%240
+		height = 1 + abs(height)%80
+		out := renderOverlay(base, popup, width, height)
+		if !utf8.ValidString(out) {
+			t.Fatalf("invalid UTF-8 in output")
+		}
+		lines := strings.Split(out, "\n")
+		if len(lines) != height {
+			t.Fatalf("got %d lines, want %d", len(lines), height)
+		}
+		for i, l := range lines {
+			if got := ansi.StringWidth(l); got != width {
+				t.Fatalf("line %d is %d cells wide, want %d: %q", i, got, width, l)
+			}
+		}
+	})
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
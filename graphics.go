@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+	"sync"
+)
+
+// --------------------------- Terminal graphics -------------------
+
+// graphicsProtocol is how raster images are sent to the terminal. Pictures
+// drawn with it replace half-block renderings where the terminal can show
+// real pixels.
+type graphicsProtocol int
+
+const (
+	graphicsNone  graphicsProtocol = iota // block characters only
+	graphicsKitty                         // kitty graphics protocol (kitty, Ghostty, WezTerm)
+	graphicsITerm                         // iTerm2 inline images (iTerm2, WezTerm)
+)
+
+// graphicsImageID is the kitty image id disktree draws with; there is only
+// ever one picture on screen, so each draw replaces the last.
+const graphicsImageID = 0x4454
+
+// cellPixelsW×cellPixelsH is the assumed size of a terminal cell in pixels, used to size
+// images; the terminal scales them to the cells given anyway.
+const cellPixelsW, cellPixelsH = 8, 16
+
+// parseGraphics maps the -graphics flag to a protocol: "off", "auto"
+// (detected from the environment), "kitty" or "iterm".
+func parseGraphics(s string, getenv func(string) string) (graphicsProtocol, error) {
+	switch strings.ToLower(s) {
+	case "", "off":
+		return graphicsNone, nil
+	case "auto":
+		return detectGraphics(getenv), nil
+	case "kitty":
+		return graphicsKitty, nil
+	case "iterm", "iterm2":
+		return graphicsITerm, nil
+	}
+	return graphicsNone, fmt.Errorf("unknown graphics mode %q (want off, auto, kitty or iterm)", s)
+}
+
+// detectGraphics guesses the terminal's image support from the variables
+// terminals set. tmux and screen don't pass the protocols through by
+// default, so nothing is detected inside them.
+func detectGraphics(getenv func(string) string) graphicsProtocol {
+	if getenv("TMUX") != "" || strings.HasPrefix(getenv("TERM"), "screen") {
+		return graphicsNone
+	}
+	switch {
+	case getenv("KITTY_WINDOW_ID") != "", getenv("TERM") == "xterm-kitty", getenv("TERM") == "xterm-ghostty":
+		return graphicsKitty
+	case getenv("TERM_PROGRAM") == "WezTerm":
+		return graphicsKitty
+	case getenv("TERM_PROGRAM") == "iTerm.app", getenv("LC_TERMINAL") == "iTerm2":
+		return graphicsITerm
+	}
+	return graphicsNone
+}
+
+func (g graphicsProtocol) String() string {
+	switch g {
+	case graphicsKitty:
+		return "kitty"
+	case graphicsITerm:
+		return "iterm"
+	}
+	return "off"
+}
+
+// graphicsImage renders img as w×h cells of the terminal's image protocol.
+// Each line is blank cells followed by a sequence that steps back over them
+// and draws, between a cursor save and restore so the renderer's idea of
+// the cursor stays right. Drawing after the blanks matters for iTerm2,
+// whose pictures live in the cells and would be erased by text written
+// over them: every row carries its own strip of the picture, so a row the
+// renderer rewrites is drawn again. kitty pictures float above the cells
+// and are placed once, from the first row. It returns false for
+// graphicsNone or when the image can't be encoded.
+func graphicsImage(g graphicsProtocol, img image.Image, w, h int) ([]string, bool) {
+	if g == graphicsNone || w <= 0 || h <= 0 {
+		return nil, false
+	}
+	// fit the image into the cells, keeping its aspect ratio
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return nil, false
+	}
+	scale := min(float64(w*cellPixelsW)/float64(b.Dx()), float64(h*cellPixelsH)/float64(b.Dy()))
+	pw, ph := max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale))
+	cols := min(w, (pw+cellPixelsW-1)/cellPixelsW)
+	rows := min(h, (ph+cellPixelsH-1)/cellPixelsH)
+	scaled := scaleImage(img, cols*cellPixelsW, rows*cellPixelsH)
+
+	blank := strings.Repeat(" ", cols)
+	back := fmt.Sprintf("\x1b[%dD", cols)
+	lines := make([]string, rows)
+	for i := range lines {
+		lines[i] = blank
+	}
+	if g == graphicsKitty {
+		data, ok := encodePNG(scaled)
+		if !ok {
+			return nil, false
+		}
+		pic := "\x1b7" + back + kittyDelete() + kittyPlace(data, cols, rows) + "\x1b8"
+		rememberPicture(pic)
+		lines[0] = blank + pic
+		return lines, true
+	}
+	for i := range lines {
+		strip := scaled.SubImage(image.Rect(0, i*cellPixelsH, cols*cellPixelsW, (i+1)*cellPixelsH))
+		data, ok := encodePNG(strip)
+		if !ok {
+			return nil, false
+		}
+		pic := "\x1b7" + back + fmt.Sprintf(
+			"\x1b]1337;File=inline=1;width=%d;height=1;preserveAspectRatio=0;doNotMoveCursor=1:%s\a", cols, data) + "\x1b8"
+		rememberPicture(pic)
+		lines[i] = blank + pic
+	}
+	return lines, true
+}
+
+// encodePNG returns img as base64 PNG data.
+func encodePNG(img image.Image) (string, bool) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), true
+}
+
+// kittyPlace transmits a PNG and places it at the cursor over cols×rows
+// cells, below the text (z<0) and without moving the cursor (C=1). Data is
+// sent in the 4096-byte chunks the protocol requires.
+func kittyPlace(data string, cols, rows int) string {
+	var sb strings.Builder
+	first := true
+	for len(data) > 0 {
+		n := min(4096, len(data))
+		chunk := data[:n]
+		data = data[n:]
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&sb, "\x1b_Gf=100,a=T,i=%d,c=%d,r=%d,C=1,z=-1,q=2,m=%d;%s\x1b\\", graphicsImageID, cols, rows, more, chunk)
+			first = false
+		} else {
+			fmt.Fprintf(&sb, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	return sb.String()
+}
+
+// kittyDelete removes the picture drawn last, and frees its data.
+func kittyDelete() string {
+	return fmt.Sprintf("\x1b_Ga=d,d=I,i=%d,q=2\x1b\\", graphicsImageID)
+}
+
+// scaleImage resizes img to w×h with nearest-neighbour sampling, which is
+// all a preview needs.
+func scaleImage(img image.Image, w, h int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		sy := b.Min.Y + y*b.Dy()/h
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, sy))
+		}
+	}
+	return out
+}
+
+// graphicsFrame finishes a frame for the terminal's image protocol. kitty
+// pictures stay on screen until deleted, so once a frame no longer draws
+// one (the pane closed, the selection moved, a dialog opened over it) the
+// old one is removed. iTerm2 pictures live in the cells and are simply
+// overwritten.
+func (m *model) graphicsFrame(frame string) string {
+	drawn := strings.Contains(frame, "\x1b_Gf=")
+	if m.graphics == graphicsKitty && m.graphicsShown && !drawn {
+		frame = kittyDelete() + frame
+	}
+	m.graphicsShown = drawn
+	return frame
+}
+
+// pictures remembers the pictures graphicsImage drew lately. Only these
+// survive when a dialog is composed: anything else in it, e.g. a file or
+// attribute name, can't bring escape sequences to the terminal.
+var pictures struct {
+	sync.Mutex
+	drawn map[string]bool
+	order []string
+}
+
+// maxPictures bounds pictures; a frame draws a handful at most.
+const maxPictures = 64
+
+// rememberPicture records seq as drawn by graphicsImage.
+func rememberPicture(seq string) {
+	pictures.Lock()
+	defer pictures.Unlock()
+	if pictures.drawn == nil {
+		pictures.drawn = map[string]bool{}
+	}
+	if pictures.drawn[seq] {
+		return
+	}
+	if len(pictures.order) == maxPictures {
+		delete(pictures.drawn, pictures.order[0])
+		pictures.order = pictures.order[1:]
+	}
+	pictures.drawn[seq] = true
+	pictures.order = append(pictures.order, seq)
+}
+
+// pictureAt returns the length of the picture graphicsImage drew that s
+// starts with (the cursor save, step back, image data and restore), or 0.
+func pictureAt(s string) int {
+	if !strings.HasPrefix(s, "\x1b7") {
+		return 0
+	}
+	end := strings.Index(s, "\x1b8")
+	if end < 0 {
+		return 0
+	}
+	pictures.Lock()
+	defer pictures.Unlock()
+	if pictures.drawn[s[:end+2]] {
+		return end + 2
+	}
+	return 0
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+func TestDetectGraphics(t *testing.T) {
+	for _, tc := range []struct {
+		env  map[string]string
+		want graphicsProtocol
+	}{
+		{map[string]string{"TERM": "xterm-kitty"}, graphicsKitty},
+		{map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, graphicsKitty},
+		{map[string]string{"TERM_PROGRAM": "iTerm.app"}, graphicsITerm},
+		{map[string]string{"LC_TERMINAL": "iTerm2"}, graphicsITerm},
+		{map[string]string{"TERM": "xterm-kitty", "TMUX": "/tmp/tmux-0/default"}, graphicsNone},
+		{map[string]string{"TERM": "xterm-256color"}, graphicsNone},
+	} {
+		getenv := func(k string) string { return tc.env[k] }
+		if got := detectGraphics(getenv); got != tc.want {
+			t.Errorf("detectGraphics(%v) = %v; want %v", tc.env, got, tc.want)
+		}
+		if got, _ := parseGraphics("off", getenv); got != graphicsNone {
+			t.Errorf("-graphics off should never draw pictures, got %v", got)
+		}
+	}
+	if _, err := parseGraphics("sixel", os.Getenv); err == nil {
+		t.Errorf("unknown modes should be rejected")
+	}
+}
+
+func TestKittyPreviewPicture(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "pic.png")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// large enough to need several 4096-byte chunks
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rnd.IntN(256))
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.graphics = graphicsKitty
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 30})
+	m.current = &Node{Name: "root", Path: dir, Scanned: true, Size: 1, Children: []*Node{
+		{Name: "pic.png", Path: p, Size: 1},
+	}}
+	m.setTableRowsFromNode(m.current)
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+
+	v := m.View()
+	start := strings.Index(v, "\x1b_Gf=100,a=T")
+	if start < 0 {
+		t.Fatalf("expected a kitty picture in the preview pane")
+	}
+	if strings.Contains(v, "▀") {
+		t.Fatalf("the picture should replace the half-block thumbnail")
+	}
+	// every chunk must arrive whole; the last one ends the transfer
+	seq := v[start:]
+	seq = seq[:strings.Index(seq, "\x1b8")]
+	if n := strings.Count(seq, "\x1b_G"); n < 2 || n != strings.Count(seq, "\x1b\\") || !strings.Contains(seq, "m=0;") {
+		t.Fatalf("picture sent in broken chunks: %d starts", n)
+	}
+
+	// closing the pane must remove the picture from the screen
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	if v := m.View(); !strings.HasPrefix(v, kittyDelete()) {
+		t.Fatalf("expected the old picture to be deleted")
+	}
+	if v := m.View(); strings.Contains(v, "\x1b_G") {
+		t.Fatalf("the delete should be sent once")
+	}
+}
+
+func TestITermPictureRows(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 80, 64))
+	lines, ok := graphicsImage(graphicsITerm, img, 10, 4)
+	if !ok || len(lines) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(lines))
+	}
+	for i, l := range lines {
+		// each row redraws its own strip after the blanks under it
+		if !strings.HasPrefix(l, strings.Repeat(" ", 10)+"\x1b7\x1b[10D\x1b]1337;File=") || !strings.HasSuffix(l, "\a\x1b8") {
+			t.Fatalf("row %d is not a self-contained strip: %.40q", i, l)
+		}
+		if w := ansi.StringWidth(l); w != 10 {
+			t.Fatalf("row %d is %d cells wide; want 10", i, w)
+		}
+	}
+}
+
+func TestDialogsKeepOnlyDrawnPictures(t *testing.T) {
+	lines, ok := graphicsImage(graphicsITerm, image.NewRGBA(image.Rect(0, 0, 16, 16)), 2, 1)
+	if !ok {
+		t.Fatal("no picture")
+	}
+	forged := "\x1b7\x1b[2D\x1b]1337;File=inline=1:AAAA\a\x1b8"
+	out := renderOverlay("", lines[0]+"\n"+"evil"+forged+"\x1b]0;title\a", 40, 5)
+	if !strings.Contains(out, lines[0][2:]) {
+		t.Error("the drawn picture should be kept")
+	}
+	if strings.Contains(out, "AAAA\a") || strings.Contains(out, "\x1b]0;") {
+		t.Errorf("escape sequences from the text went through: %q", out)
+	}
+}
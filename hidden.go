@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --------------------------- Hidden entries ----------------------
+
+// isHidden reports whether a table entry counts as hidden: a dotfile or
+// dot-directory, or an entry the scanner found carrying the platform hidden
+// flag (Windows attribute, chflags on macOS and FreeBSD). Hidden entries are part of the
+// totals unless -exclude-hidden is set; the `.` key only controls whether
+// they are listed.
+func isHidden(n *Node) bool {
+	return n.Hidden || strings.HasPrefix(n.Name, ".") && n.Name != "." && n.Name != ".."
+}
+
+// hiddenSummary describes the entries left out of the table, e.g.
+// "12 hidden entries, 3.4 GB".
+func hiddenSummary(count int, size int64) string {
+	noun := "entries"
+	if count == 1 {
+		noun = "entry"
+	}
+	return fmt.Sprintf("%d hidden %s, %s", count, noun, humanBytes(size))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestHiddenToggleKeepsTotals(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	m.loading = false
+	m.current = &Node{Name: "root", Path: "/r", Scanned: true, Size: 400, Children: []*Node{
+		{Name: "visible", Path: "/r/visible", Size: 100},
+		{Name: ".cache", Path: "/r/.cache", Size: 200},
+		{Name: ".env", Path: "/r/.env", Size: 100},
+	}}
+	m.setTableRowsFromNode(m.current)
+	if len(m.rows) != 3 {
+		t.Fatalf("expected all 3 rows shown by default, got %d", len(m.rows))
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'.'}})
+	if len(m.rows) != 1 || m.rows[0].Name != "visible" {
+		t.Fatalf("expected only the visible entry, got %d rows", len(m.rows))
+	}
+	if m.hiddenCount != 2 || m.hiddenSize != 300 {
+		t.Fatalf("hidden = %d entries, %d bytes; want 2, 300", m.hiddenCount, m.hiddenSize)
+	}
+	// percentages stay relative to everything in the directory
+	if got := m.tbl.Rows()[0][5]; strings.TrimSpace(got) != "25.0%" {
+		t.Fatalf("share of visible entry = %q; want 25.0%%", got)
+	}
+	if !strings.Contains(m.View(), "[2 hidden entries, 300 B]") {
+		t.Fatalf("expected hidden indicator in the header")
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'.'}})
+	if len(m.rows) != 3 {
+		t.Fatalf("expected hidden entries back, got %d rows", len(m.rows))
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// --------------------------- Ignore ------------------------------
+
+// ignoreSet holds the entries left out of this session's totals with I,
+// e.g. a Photos directory known to be huge, so the rest of the tree can
+// be looked at. Scans skip them until ctrl+u brings them back.
+type ignoreSet struct {
+	mu    sync.Mutex
+	nodes []*Node // in the order they were ignored
+	keys  map[string]bool
+	n     atomic.Int32 // len(nodes), read by walkers without the lock
+}
+
+// has reports whether p is ignored. It is called for every entry walked,
+// so an empty set costs one atomic load.
+func (s *ignoreSet) has(p string) bool {
+	if s == nil || s.n.Load() == 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keys[pathKey(p)]
+}
+
+// skipFunc is has as a scanner.Options.Skip hook.
+func (s *ignoreSet) skipFunc() func(string) bool {
+	if s == nil {
+		return nil
+	}
+	return s.has
+}
+
+func (s *ignoreSet) add(n *Node) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keys == nil {
+		s.keys = map[string]bool{}
+	}
+	s.nodes = append(s.nodes, n)
+	s.keys[pathKey(n.Path)] = true
+	s.n.Store(int32(len(s.nodes)))
+}
+
+// drain empties the set and returns what it held, latest first.
+func (s *ignoreSet) drain() []*Node {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nodes := s.nodes
+	s.nodes, s.keys = nil, nil
+	s.n.Store(0)
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+// total is how many entries are ignored and how much they hold.
+func (s *ignoreSet) total() (count int, size int64) {
+	if s == nil {
+		return 0, 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, n := range s.nodes {
+		size += maxInt64(n.Size, 0)
+	}
+	return len(s.nodes), size
+}
+
+// nodeDeltaOf is what n contributes to the directories above its parent.
+func nodeDeltaOf(n *Node) nodeDelta {
+	return trashDelta(&TrashItem{IsDir: n.IsDir, Size: maxInt64(n.Size, 0), Files: n.Files, Dirs: n.Dirs, Disk: n.Disk, Cloud: n.Cloud})
+}
+
+// ignoreSelected takes the selection out of the tree and of every cached
+// total above it, as a delete would, without touching the files.
+func (m *model) ignoreSelected() {
+	n := m.selected()
+	if n == nil {
+		return
+	}
+	if n.Size < 0 {
+		m.status = "⚠ " + n.Name + " isn't sized yet; ignore it once it is"
+		return
+	}
+	parent := filepath.Dir(n.Path)
+	m.scanner.ignored.add(n)
+	invalidateSums(n.Path)
+	m.removeChild(parent, n.Path)
+	propagateDelta(parent, nodeDeltaOf(n).negate())
+	m.setTableRowsFromNode(m.current)
+	m.status = fmt.Sprintf("Ignoring %s (%s) for this session — ctrl+u brings it back", n.Name, humanBytes(n.Size))
+}
+
+// unignoreAll puts every ignored entry back, latest first, so one ignored
+// inside another lands in its restored parent.
+func (m *model) unignoreAll() {
+	nodes := m.scanner.ignored.drain()
+	if len(nodes) == 0 {
+		m.status = "Nothing is ignored"
+		return
+	}
+	var size int64
+	for _, n := range nodes {
+		parent := filepath.Dir(n.Path)
+		invalidateSums(n.Path)
+		m.addChild(parent, n)
+		propagateDelta(parent, nodeDeltaOf(n))
+		size += maxInt64(n.Size, 0)
+	}
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	m.status = fmt.Sprintf("Brought back %d ignored (%s)", len(nodes), humanBytes(size))
+}
+
+// ignoreTag is the header note while entries are ignored.
+func (m *model) ignoreTag() string {
+	count, size := m.scanner.ignored.total()
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf("[ignoring %d, %s]", count, humanBytes(size))
+}
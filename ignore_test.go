@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnoreAndBringBack(t *testing.T) {
+	h := newTUIHarness(t, 120, 24)
+	total := h.m.current.Size
+	sel := h.m.selected()
+	if sel == nil || sel.Name != "alpha" {
+		t.Fatalf("selection = %v, want alpha first", sel)
+	}
+	h.keys("I")
+	if h.m.current.Size != total-5120 || !strings.Contains(h.m.ignoreTag(), "ignoring 1, 5.0 KB") {
+		t.Fatalf("size = %d (was %d), tag %q", h.m.current.Size, total, h.m.ignoreTag())
+	}
+	// a rescan leaves it out too
+	h.keys("r")
+	h.settle()
+	for _, c := range h.m.current.Children {
+		if c.Name == "alpha" {
+			t.Fatal("alpha came back with a rescan")
+		}
+	}
+	if h.m.current.Size != total-5120 {
+		t.Errorf("size after rescan = %d, want %d", h.m.current.Size, total-5120)
+	}
+	h.keys("ctrl+u")
+	if h.m.current.Size != total || h.m.ignoreTag() != "" {
+		t.Errorf("size = %d, want %d back; tag %q", h.m.current.Size, total, h.m.ignoreTag())
+	}
+	if sel := h.m.selected(); sel == nil || sel.Name != "alpha" {
+		t.Errorf("alpha should be back on top, got %v", sel)
+	}
+}
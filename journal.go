@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Operation journal -------------------
+
+// opKind names a destructive operation that can be undone and redone. A
+// move is a copy and a delete, undone one step at a time. Offloads leave
+// the machine and aren't journaled; nothing compresses files in place.
+type opKind string
+
+const (
+	opTrash  opKind = "trash"  // moved to the trash; undo restores it
+	opRename opKind = "rename" // renamed in place; undo renames it back
+	opCopy   opKind = "copy"   // copied with C; undo moves the copy to the trash
+)
+
+// journalOp is one entry of the journal.
+type journalOp struct {
+	Kind opKind    `json:"kind"`
+	At   time.Time `json:"at"`
+	// Trash is the trashed item for opTrash, and the trashed copy of an
+	// undone opCopy
+	Trash *TrashItem `json:"trash,omitempty"`
+	// From and To are the old and new paths for opRename, the source and
+	// the copy for opCopy
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// describe is a short label for status messages, e.g. "delete of notes.txt".
+func (op *journalOp) describe() string {
+	switch op.Kind {
+	case opTrash:
+		return "delete of " + filepath.Base(op.Trash.OrigPath)
+	case opRename:
+		return fmt.Sprintf("rename of %s to %s", filepath.Base(op.From), filepath.Base(op.To))
+	case opCopy:
+		return fmt.Sprintf("copy of %s to %s", filepath.Base(op.From), filepath.Dir(op.To))
+	}
+	return string(op.Kind)
+}
+
+// stale reports whether op can't be undone (or redone) any more because
+// what it would move back is gone, e.g. an item already restored with
+// `disktree trash restore` or renamed again outside disktree.
+func (op *journalOp) stale(undo bool) bool {
+	var p string
+	switch {
+	case op.Kind == opTrash && undo:
+		p = op.Trash.TrashPath
+	case op.Kind == opTrash:
+		p = op.Trash.OrigPath
+	case op.Kind == opRename && undo:
+		p = op.To
+	case op.Kind == opRename:
+		p = op.From
+	case op.Kind == opCopy && undo:
+		p = op.To
+	case op.Kind == opCopy:
+		if op.Trash == nil {
+			return true
+		}
+		p = op.Trash.TrashPath
+	default:
+		return false
+	}
+	_, err := os.Lstat(p)
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+// opJournal is the session's undo/redo history. ops[:next] are done and can
+// be undone, newest last; ops[next:] were undone and can be redone until a
+// new operation is recorded. It is saved to path after every change so the
+// history survives a crash; a clean exit removes the file.
+type opJournal struct {
+	ops  []*journalOp
+	next int
+	path string // "" keeps the journal in memory only
+}
+
+// journalFile is the on-disk form of a session's journal.
+type journalFile struct {
+	PID  int          `json:"pid"`
+	Next int          `json:"next"`
+	Ops  []*journalOp `json:"ops"`
+}
+
+// openJournal starts this session's journal in dir, taking over the done
+// operations of sessions that ended without closing theirs (crashes). It
+// returns how many operations were recovered.
+func openJournal(dir string) (*opJournal, int) {
+	j := &opJournal{path: filepath.Join(dir, strconv.Itoa(os.Getpid())+".json")}
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return j, 0
+	}
+	var stale []string
+	for _, e := range ents {
+		pid, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(e.Name(), ".json") || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		p := filepath.Join(dir, e.Name())
+		b, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var f journalFile
+		if json.Unmarshal(b, &f) == nil && f.Next <= len(f.Ops) {
+			j.ops = append(j.ops, f.Ops[:f.Next]...)
+		}
+		stale = append(stale, p)
+	}
+	sort.SliceStable(j.ops, func(a, b int) bool { return j.ops[a].At.Before(j.ops[b].At) })
+	j.next = len(j.ops)
+	if j.next > 0 && j.save() != nil {
+		// keep the old files rather than lose the history
+		return j, j.next
+	}
+	for _, p := range stale {
+		_ = os.Remove(p)
+	}
+	return j, j.next
+}
+
+// record appends op after the done operations, dropping the redo tail.
+func (j *opJournal) record(op *journalOp) {
+	if op.At.IsZero() {
+		op.At = time.Now()
+	}
+	j.ops = append(j.ops[:j.next], op)
+	j.next = len(j.ops)
+	_ = j.save()
+}
+
+// forget drops the trash operations of the item at trashPath, which is
+// gone from the trash for good, so undo doesn't stop at it.
+func (j *opJournal) forget(trashPath string) {
+	var ops []*journalOp
+	next := j.next
+	for i, op := range j.ops {
+		if op.Kind == opTrash && op.Trash != nil && op.Trash.TrashPath == trashPath {
+			if i < j.next {
+				next--
+			}
+			continue
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == len(j.ops) {
+		return
+	}
+	j.ops, j.next = ops, next
+	_ = j.save()
+}
+
+// dropStale removes the stale operations undo (or redo) would reach first,
+// so it goes on with the next one instead of failing on them for good, and
+// describes them.
+func (j *opJournal) dropStale(undo bool) []string {
+	var dropped []string
+	for {
+		i := j.next
+		if undo {
+			i--
+		}
+		if i < 0 || i >= len(j.ops) || !j.ops[i].stale(undo) {
+			break
+		}
+		dropped = append(dropped, j.ops[i].describe())
+		j.ops = slices.Delete(j.ops, i, i+1)
+		if undo {
+			j.next--
+		}
+	}
+	if len(dropped) > 0 {
+		_ = j.save()
+	}
+	return dropped
+}
+
+// droppedNote tells the status line which stale operations were dropped.
+func droppedNote(dropped []string) string {
+	if len(dropped) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (dropped %s: already reverted elsewhere)", strings.Join(dropped, ", "))
+}
+
+// save writes the journal atomically; it is a no-op for in-memory journals.
+func (j *opJournal) save() error {
+	if j.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(journalFile{PID: os.Getpid(), Next: j.next, Ops: j.ops})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o755); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// close removes the journal file after a clean exit. Trashed items stay
+// recoverable with `disktree trash restore`.
+func (j *opJournal) close() {
+	if j.path != "" {
+		_ = os.Remove(j.path)
+	}
+}
+
+// undo reverts the most recent done operation.
+func (m *model) undo() tea.Cmd {
+	j := m.journal
+	dropped := j.dropStale(true)
+	if j.next == 0 {
+		m.status = "Nothing to undo" + droppedNote(dropped)
+		return nil
+	}
+	op := j.ops[j.next-1]
+	var cmd tea.Cmd
+	var err error
+	switch op.Kind {
+	case opTrash:
+		err = m.restoreTrashed(op.Trash)
+	case opRename:
+		err = m.renamePath(op.To, op.From)
+	case opCopy:
+		var ti *TrashItem
+		if ti, cmd, err = m.trashPath(op.To); err == nil {
+			op.Trash = ti
+		}
+	default:
+		err = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	if err != nil {
+		m.status = fmt.Sprintf("⚠ could not undo %s: %v", op.describe(), err) + droppedNote(dropped)
+		return nil
+	}
+	j.next--
+	_ = j.save()
+	m.status = "Undid " + op.describe() + droppedNote(dropped)
+	return cmd
+}
+
+// redo repeats the most recently undone operation.
+func (m *model) redo() tea.Cmd {
+	j := m.journal
+	dropped := j.dropStale(false)
+	if j.next == len(j.ops) {
+		m.status = "Nothing to redo" + droppedNote(dropped)
+		return nil
+	}
+	op := j.ops[j.next]
+	var cmd tea.Cmd
+	var err error
+	switch op.Kind {
+	case opTrash:
+		var ti *TrashItem
+		if ti, cmd, err = m.trashPath(op.Trash.OrigPath); err == nil {
+			op.Trash = ti
+		}
+	case opRename:
+		err = m.renamePath(op.From, op.To)
+	case opCopy:
+		if err = m.restoreTrashed(op.Trash); err == nil {
+			op.To, op.Trash = op.Trash.OrigPath, nil
+		}
+	default:
+		err = fmt.Errorf("unknown operation %q", op.Kind)
+	}
+	if err != nil {
+		m.status = fmt.Sprintf("⚠ could not redo %s: %v", op.describe(), err) + droppedNote(dropped)
+		return nil
+	}
+	j.next++
+	_ = j.save()
+	m.status = "Redid " + op.describe() + droppedNote(dropped)
+	return cmd
+}
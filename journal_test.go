@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUndoRedoDeletesAndRenames(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cache = sync.Map{}
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Scanned: true, Children: []*Node{
+		{Name: "a.txt", Path: filepath.Join(dir, "a.txt"), Size: 100, Files: 1},
+		{Name: "b.txt", Path: filepath.Join(dir, "b.txt"), Size: 100, Files: 1},
+	}}
+	sumChildren(m.current)
+	m.journal = &opJournal{path: filepath.Join(journalDir(), "test.json")}
+	exists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	m.deleteToTrash(filepath.Join(dir, "a.txt"))
+	m.renameNode(m.current.Children[0], "c.txt")
+	if exists("a.txt") || exists("b.txt") || !exists("c.txt") {
+		t.Fatalf("expected a.txt trashed and b.txt renamed to c.txt")
+	}
+
+	m.undo()
+	m.undo()
+	if !exists("a.txt") || !exists("b.txt") || exists("c.txt") {
+		t.Fatalf("two undos should restore a.txt and the name b.txt")
+	}
+	if m.current.Size != 200 || len(m.current.Children) != 2 {
+		t.Fatalf("view after undo: size=%d children=%d", m.current.Size, len(m.current.Children))
+	}
+	if m.undo(); m.status != "Nothing to undo" {
+		t.Fatalf("status = %q; want Nothing to undo", m.status)
+	}
+
+	m.redo()
+	if exists("a.txt") || m.current.Size != 100 {
+		t.Fatalf("redo should trash a.txt again")
+	}
+	var f journalFile
+	if b, err := os.ReadFile(m.journal.path); err != nil || json.Unmarshal(b, &f) != nil || f.Next != 1 || len(f.Ops) != 2 {
+		t.Fatalf("journal file should hold 2 ops with 1 done, got %+v (%v)", f, err)
+	}
+
+	// a new operation drops what could still be redone
+	m.renameNode(m.current.Children[0], "d.txt")
+	if m.redo(); m.status != "Nothing to redo" || !exists("d.txt") {
+		t.Fatalf("the rename of b.txt to c.txt should no longer be redoable, status %q", m.status)
+	}
+	m.journal.close()
+	if _, err := os.Stat(m.journal.path); !os.IsNotExist(err) {
+		t.Fatalf("a clean exit should remove the journal file")
+	}
+}
+
+func TestJournalRecoversCrashedSession(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses PID 1 as a process that is always running")
+	}
+	dir := t.TempDir()
+	old := journalFile{PID: 1 << 30, Next: 1, Ops: []*journalOp{
+		{Kind: opRename, At: time.Now().Add(-time.Minute), From: "/x/a", To: "/x/b"},
+		{Kind: opRename, At: time.Now(), From: "/x/b", To: "/x/c"}, // undone before the crash
+	}}
+	b, _ := json.Marshal(old)
+	stale := filepath.Join(dir, "1073741824.json")
+	if err := os.WriteFile(stale, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	live := filepath.Join(dir, "1.json") // init never goes away
+	if err := os.WriteFile(live, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, n := openJournal(dir)
+	if n != 1 || j.next != 1 || j.ops[0].To != "/x/b" {
+		t.Fatalf("expected the one done op of the dead session, got %d: %+v", n, j.ops)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("the dead session's journal should be taken over")
+	}
+	if _, err := os.Stat(live); err != nil {
+		t.Fatalf("a running session's journal must be left alone: %v", err)
+	}
+	if _, err := os.Stat(j.path); err != nil {
+		t.Fatalf("recovered ops should be saved under this session: %v", err)
+	}
+}
+
+func TestUndoDropsOpsRevertedElsewhere(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cache = sync.Map{}
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), make([]byte, 100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.journal = &opJournal{path: filepath.Join(journalDir(), "test.json")}
+
+	m.deleteToTrash(filepath.Join(dir, "a.txt"))
+	m.deleteToTrash(filepath.Join(dir, "b.txt"))
+	// b.txt comes back with `disktree trash restore`, behind the journal's back
+	if _, err := restoreFromTrashTo(m.journal.ops[1].Trash); err != nil {
+		t.Fatal(err)
+	}
+
+	m.undo()
+	if _, err := os.Lstat(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatalf("undo should go on to the delete of a.txt: %v (status %q)", err, m.status)
+	}
+	if !strings.Contains(m.status, "Undid delete of a.txt") || !strings.Contains(m.status, "dropped delete of b.txt") {
+		t.Fatalf("status = %q; want the undo and the dropped op", m.status)
+	}
+	if len(m.journal.ops) != 1 || m.journal.next != 0 {
+		t.Fatalf("journal holds %d ops, %d done; want only a.txt's, undone", len(m.journal.ops), m.journal.next)
+	}
+
+	// and redo skips what can't be deleted again
+	if err := os.Remove(filepath.Join(dir, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if m.redo(); !strings.HasPrefix(m.status, "Nothing to redo (dropped delete of a.txt") {
+		t.Fatalf("status = %q; want the stale redo dropped", m.status)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Narrow layout -----------------------
+
+// narrowWidth is the terminal width below which the compact layout is used:
+// tmux splits and phone SSH clients, where the full column set and the
+// one-line footer no longer fit.
+const narrowWidth = 60
+
+// statusLines is how many lines the status wraps to in the compact layout.
+const statusLines = 2
+
+// narrow reports whether the compact layout is in use.
+func (m *model) narrow() bool {
+	return m.width > 0 && m.width < narrowWidth
+}
+
+// footHints are the key hints of the footer, most useful first. The compact
+// layout stacks them on as many lines as they need.
+var footHints = []string{
+	"↑/↓ move", "Enter open", "Backspace up", "s=size", "n=name", "r=rescan",
+	"e=export CSV", "d=delete", "u=undo", "?=help", "q=quit",
+}
+
+// footLines returns the footer, one line wide or wrapped to the width. Once
+// space was freed, the tally leads it.
+func (m *model) footLines() []string {
+	hints := footHints
+	if s := m.freed.summary(); s != "" {
+		hints = append([]string{s}, footHints...)
+	}
+	if !m.narrow() {
+		return []string{strings.Join(hints, "  ")}
+	}
+	var lines []string
+	line := ""
+	for _, h := range hints {
+		switch {
+		case line == "":
+			line = h
+		case lipgloss.Width(line)+2+lipgloss.Width(h) <= m.width:
+			line += "  " + h
+		default:
+			lines = append(lines, line)
+			line = h
+		}
+	}
+	return append(lines, line)
+}
+
+// statusView returns the status line, wrapped to statusLines lines in the
+// compact layout so long messages aren't cut off at the edge.
+func (m *model) statusView(status string) string {
+	if !m.narrow() {
+		return status
+	}
+	wrapped := strings.Split(lipgloss.NewStyle().Width(m.width).Render(status), "\n")
+	if len(wrapped) > statusLines {
+		wrapped = wrapped[:statusLines]
+	}
+	for i := range wrapped {
+		wrapped[i] = strings.TrimRight(wrapped[i], " ")
+	}
+	return strings.Join(wrapped, "\n")
+}
+
+// chromeLines is how many lines the title, summary, table border, status
+// and footer take around the table rows.
+func (m *model) chromeLines() int {
+	if !m.narrow() {
+		return 7
+	}
+	return 6 + statusLines - 1 + len(m.footLines()) - 1
+}
+
+// summaryLine pins the totals of the current directory under the title,
+// kept up to date while its children stream in.
+func (m *model) summaryLine() string {
+	n := m.current
+	if n == nil || (len(n.Children) == 0 && !n.Scanned) {
+		return ""
+	}
+	var unreadable, sizing int
+	for _, c := range n.Children {
+		switch {
+		case c.Err != nil || c.NoAccess:
+			unreadable++
+		case c.Size < 0:
+			sizing++
+		}
+	}
+	parts := []string{"Σ " + humanBytes(max(0, n.Size)), fmt.Sprintf("%d files", n.Files), fmt.Sprintf("%d dirs", n.Dirs)}
+	if d := m.diskSummary(n); d != "" {
+		parts = append(parts, d)
+	}
+	if c := cloudSummary(n); c != "" {
+		parts = append(parts, c)
+	}
+	if unreadable > 0 {
+		parts = append(parts, fmt.Sprintf("%d unreadable", unreadable))
+	}
+	if sizing > 0 {
+		parts = append(parts, fmt.Sprintf("%d still sizing", sizing))
+	}
+	line := strings.Join(parts, " · ")
+	if m.narrow() {
+		line = truncateToWidth(line, m.width)
+	}
+	return line
+}
+
+// relayoutTable applies a change of the column set. Rows must never be
+// longer than the columns, so they are dropped while the columns change
+// and rebuilt after.
+func (m *model) relayoutTable() {
+	cursor := m.tbl.Cursor()
+	m.tbl.SetRows(nil)
+	m.reflowColumns()
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+		m.tbl.SetCursor(cursor)
+	}
+}
+
+// compactColumns is the column set of the compact layout: Dirs and Graph
+// are hidden (zero width) and headers shortened, so Name keeps most of the
+// room. Rows still carry all seven cells.
+func (m *model) compactColumns(avail int) []table.Column {
+	sizeW := 8
+	if m.wideSize {
+		sizeW = 14
+	}
+	fixed := sizeW + 8 + 6 + 6
+	return []table.Column{
+		{Title: "Name", Width: maxvalue(10, avail-fixed)},
+		{Title: "Size", Width: sizeW},
+		{Title: "Own", Width: 8},
+		{Title: "#", Width: 6},
+		{Title: "Dirs", Width: 0},
+		{Title: "%", Width: 6},
+		{Title: "Graph", Width: 0},
+	}
+}
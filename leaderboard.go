@@ -0,0 +1,289 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Leaderboard -------------------------
+
+// leaderboardSize is how many directories each ranking keeps.
+const leaderboardSize = 50
+
+// rankedDir is one directory on the leaderboard.
+type rankedDir struct {
+	path string
+	size int64
+	idx  int // position in the heap
+}
+
+// topK is a min-heap of the k largest directories seen, keyed by pathKey so
+// a rescan updates an entry in place instead of adding a duplicate.
+type topK struct {
+	k      int
+	items  []*rankedDir
+	byPath map[string]*rankedDir
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, byPath: map[string]*rankedDir{}}
+}
+
+func (t *topK) Len() int           { return len(t.items) }
+func (t *topK) Less(i, j int) bool { return t.items[i].size < t.items[j].size }
+func (t *topK) Swap(i, j int) {
+	t.items[i], t.items[j] = t.items[j], t.items[i]
+	t.items[i].idx, t.items[j].idx = i, j
+}
+
+func (t *topK) Push(x any) {
+	d := x.(*rankedDir)
+	d.idx = len(t.items)
+	t.items = append(t.items, d)
+	t.byPath[pathKey(d.path)] = d
+}
+
+func (t *topK) Pop() any {
+	d := t.items[len(t.items)-1]
+	t.items = t.items[:len(t.items)-1]
+	delete(t.byPath, pathKey(d.path))
+	return d
+}
+
+// offer records size for path, evicting the smallest entry when full.
+func (t *topK) offer(path string, size int64) {
+	if d, ok := t.byPath[pathKey(path)]; ok {
+		d.size = size
+		heap.Fix(t, d.idx)
+		return
+	}
+	if len(t.items) < t.k {
+		heap.Push(t, &rankedDir{path: path, size: size})
+		return
+	}
+	if size <= t.items[0].size {
+		return
+	}
+	delete(t.byPath, pathKey(t.items[0].path))
+	t.items[0] = &rankedDir{path: path, size: size}
+	t.byPath[pathKey(path)] = t.items[0]
+	heap.Fix(t, 0)
+}
+
+// removeWhere drops every entry whose path matches drop.
+func (t *topK) removeWhere(drop func(string) bool) {
+	for i := len(t.items) - 1; i >= 0; i-- {
+		if i < len(t.items) && drop(t.items[i].path) {
+			heap.Remove(t, i)
+		}
+	}
+}
+
+// sorted returns the entries largest first.
+func (t *topK) sorted() []rankedDir {
+	out := make([]rankedDir, len(t.items))
+	for i, d := range t.items {
+		out[i] = *d
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].size != out[j].size {
+			return out[i].size > out[j].size
+		}
+		return out[i].path < out[j].path
+	})
+	return out
+}
+
+// leaderboard ranks every directory walked anywhere during the session by
+// exclusive size (files directly inside it) and by cumulative size (its
+// whole subtree).
+type leaderboard struct {
+	mu         sync.Mutex
+	exclusive  *topK
+	cumulative *topK
+}
+
+func newLeaderboard(k int) *leaderboard {
+	return &leaderboard{exclusive: newTopK(k), cumulative: newTopK(k)}
+}
+
+// leaders is fed by walkSum and Scanner.scan, like dirRecords.
+var leaders = newLeaderboard(leaderboardSize)
+
+func (l *leaderboard) offerExclusive(path string, size int64) {
+	l.mu.Lock()
+	l.exclusive.offer(path, size)
+	l.mu.Unlock()
+}
+
+func (l *leaderboard) offerCumulative(path string, size int64) {
+	l.mu.Lock()
+	l.cumulative.offer(path, size)
+	l.mu.Unlock()
+}
+
+// forget drops p and everything below it from both rankings.
+func (l *leaderboard) forget(p string) {
+	drop := func(k string) bool { return underPath(k, p) }
+	l.mu.Lock()
+	l.exclusive.removeWhere(drop)
+	l.cumulative.removeWhere(drop)
+	l.mu.Unlock()
+}
+
+// rankings returns both rankings, largest first.
+func (l *leaderboard) rankings() (cumulative, exclusive []rankedDir) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cumulative.sorted(), l.exclusive.sorted()
+}
+
+// subtreeAcc adds up a directory's cumulative size during walkSum. Each
+// directory holds one pending count for its own listing plus one per
+// subdirectory; when the last one finishes, its total is final, goes on the
+// leaderboard and is added to the parent.
+type subtreeAcc struct {
+	parent  *subtreeAcc
+	path    string
+	size    atomic.Int64
+	pending atomic.Int64
+}
+
+func newSubtreeAcc(parent *subtreeAcc, path string) *subtreeAcc {
+	a := &subtreeAcc{parent: parent, path: path}
+	a.pending.Store(1)
+	return a
+}
+
+func (a *subtreeAcc) done() {
+	for a != nil && a.pending.Add(-1) == 0 {
+		size := a.size.Load()
+		leaders.offerCumulative(a.path, size)
+		if a.parent != nil {
+			a.parent.size.Add(size)
+		}
+		a = a.parent
+	}
+}
+
+// leaderboardOverlay lists the largest directories found so far; Tab
+// switches between cumulative and exclusive sizes, Enter jumps to one.
+type leaderboardOverlay struct {
+	tabs     [2][]rankedDir // cumulative, exclusive
+	tab      int
+	cursor   int
+	scanning bool
+}
+
+func newLeaderboardOverlay(m *model) *leaderboardOverlay {
+	o := &leaderboardOverlay{scanning: m.loading}
+	cum, excl := leaders.rankings()
+	// entries deleted outside a rescan may linger; don't offer to jump there
+	for i, list := range [][]rankedDir{cum, excl} {
+		for _, d := range list {
+			if _, err := os.Lstat(d.path); err == nil {
+				o.tabs[i] = append(o.tabs[i], d)
+			}
+		}
+	}
+	return o
+}
+
+func (o *leaderboardOverlay) opts() overlayOpts {
+	return overlayOpts{id: "leaderboard", z: zDialog, dim: true, focusable: true}
+}
+
+// visibleRows is how many entries fit in the dialog.
+func (o *leaderboardOverlay) visibleRows(m *model) int {
+	_, h := m.screenSize()
+	return maxvalue(3, minvalue(20, h-10))
+}
+
+func (o *leaderboardOverlay) View(m *model) string {
+	w := m.popupWidth(80)
+	inner := maxvalue(10, w-6)
+	active := lipgloss.NewStyle().Bold(true).Underline(true)
+	faint := lipgloss.NewStyle().Faint(true)
+	names := []string{"Cumulative", "Exclusive"}
+	for i := range names {
+		if i == o.tab {
+			names[i] = active.Render(names[i])
+		} else {
+			names[i] = faint.Render(names[i])
+		}
+	}
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Largest directories") + "   " + names[0] + "  " + names[1], ""}
+
+	list := o.tabs[o.tab]
+	if len(list) == 0 {
+		lines = append(lines, faint.Render("nothing scanned yet"))
+	}
+	rows := o.visibleRows(m)
+	start := maxvalue(0, minvalue(o.cursor-rows/2, len(list)-rows))
+	for i := start; i < len(list) && i < start+rows; i++ {
+		d := list[i]
+		prefix := fmt.Sprintf("%3d. %10s  ", i+1, humanBytes(d.size))
+		path := sanitizeLine(d.path)
+		if rel, err := filepath.Rel(m.rootPath, d.path); err == nil && !strings.HasPrefix(rel, "..") {
+			path = sanitizeLine(filepath.Join(filepath.Base(m.rootPath), rel))
+		}
+		// keep the end of long paths, that's where the directory name is
+		if room := inner - lipgloss.Width(prefix); lipgloss.Width(path) > room {
+			path = "…" + extractAfterPosition(path, lipgloss.Width(path)-room+1)
+		}
+		line := prefix + path
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+
+	lines = append(lines, "")
+	hint := "Tab switch  ↑/↓ move  Enter go to  Esc close"
+	if o.scanning {
+		hint = "scan still running — " + hint
+	}
+	lines = append(lines, faint.Render(hint))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *leaderboardOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	list := o.tabs[o.tab]
+	switch msg.String() {
+	case "esc", "L", "q":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "tab", "shift+tab", "left", "right":
+		o.tab = 1 - o.tab
+		o.cursor = 0
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(list)-1), o.cursor+1)
+	case "pgup":
+		o.cursor = maxvalue(0, o.cursor-o.visibleRows(m))
+	case "pgdown":
+		o.cursor = minvalue(maxvalue(0, len(list)-1), o.cursor+o.visibleRows(m))
+	case "enter":
+		if o.cursor >= len(list) {
+			return nil, false
+		}
+		if m.loading {
+			m.status = "Wait for the scan to finish before jumping to a directory"
+			return nil, true
+		}
+		return m.gotoPath(list[o.cursor].path), true
+	}
+	return nil, false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTopKKeepsLargestAndUpdatesInPlace(t *testing.T) {
+	k := newTopK(3)
+	for i, p := range []string{"a", "b", "c", "d", "e"} {
+		k.offer(p, int64(i+1)*10)
+	}
+	k.offer("c", 100) // rescan grew c
+	k.offer("a", 5)   // too small to enter
+	k.removeWhere(func(p string) bool { return p == "d" })
+
+	got := k.sorted()
+	if len(got) != 2 || got[0].path != "c" || got[0].size != 100 || got[1].path != "e" {
+		t.Fatalf("unexpected ranking: %+v", got)
+	}
+	if len(k.byPath) != len(k.items) {
+		t.Fatalf("index out of sync: %d paths, %d items", len(k.byPath), len(k.items))
+	}
+}
+
+func TestLeaderboardRanksDeepDirectories(t *testing.T) {
+	leaders = newLeaderboard(leaderboardSize)
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	root := t.TempDir()
+	write := func(rel string, size int) {
+		p := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/b/c/huge.bin", 50_000)
+	write("a/b/small.txt", 100)
+	write("a/b/c/d/tiny.txt", 10)
+	write("top.txt", 1_000)
+
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	s.scan(context.Background(), root, false, nil)
+
+	cum, excl := leaders.rankings()
+	find := func(list []rankedDir, rel string) int64 {
+		for _, d := range list {
+			if d.path == filepath.Join(root, rel) {
+				return d.size
+			}
+		}
+		t.Fatalf("%s missing from %+v", rel, list)
+		return 0
+	}
+	if got := find(cum, "a/b/c"); got != 50_010 {
+		t.Fatalf("cumulative a/b/c = %d; want 50010", got)
+	}
+	if got := find(cum, "a"); got != 50_110 {
+		t.Fatalf("cumulative a = %d; want 50110", got)
+	}
+	if got := find(cum, "."); got != 51_110 {
+		t.Fatalf("cumulative root = %d; want 51110", got)
+	}
+	if got := find(excl, "a/b/c"); got != 50_000 {
+		t.Fatalf("exclusive a/b/c = %d; want 50000", got)
+	}
+	if excl[0].path != filepath.Join(root, "a/b/c") {
+		t.Fatalf("largest exclusive should be a/b/c, got %s", excl[0].path)
+	}
+
+	// deleting a directory takes it and its subtree off the board
+	invalidateSums(filepath.Join(root, "a", "b"))
+	cum, _ = leaders.rankings()
+	for _, d := range cum {
+		if strings.HasPrefix(d.path, filepath.Join(root, "a", "b")) {
+			t.Fatalf("%s should have been forgotten", d.path)
+		}
+	}
+}
+
+func TestLeaderboardOverlayJumpsToDirectory(t *testing.T) {
+	leaders = newLeaderboard(leaderboardSize)
+	root := t.TempDir()
+	deep := filepath.Join(root, "x", "y")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	leaders.offerCumulative(deep, 1<<20)
+	leaders.offerCumulative(filepath.Join(root, "gone"), 1<<30) // deleted since
+
+	m := initialModel(root, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'L'}})
+	o, ok := m.overlays.focused().(*leaderboardOverlay)
+	if !ok {
+		t.Fatalf("expected the leaderboard overlay")
+	}
+	if len(o.tabs[0]) != 1 {
+		t.Fatalf("missing paths should be skipped, got %+v", o.tabs[0])
+	}
+	if !strings.Contains(o.View(m), filepath.Join("x", "y")) {
+		t.Fatalf("expected x/y on the leaderboard")
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlays.has("leaderboard") {
+		t.Fatalf("enter should close the leaderboard")
+	}
+	if got := m.breadcrumbs[len(m.breadcrumbs)-1]; got != deep {
+		t.Fatalf("expected to navigate to %s, got %s", deep, got)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- File lists --------------------------
+
+// fileListing is a tree built from a list of paths and sizes instead of a
+// walk, for browsing machines that can only hand out a listing:
+//
+//	find /srv -printf '%s\t%y\t%p\n' > srv.txt   # on the server
+//	disktree -from-file srv.txt                   # anywhere else
+//
+// Lines are "size<TAB>path", or "size<TAB>type<TAB>path" with find's %y
+// type letter, which is what tells empty directories from files. Without
+// it, an entry becomes a directory once something is listed below it, and
+// a path ending in a separator is a directory too. Directories' own sizes
+// are ignored, as in a scan; blank lines and lines starting with # are
+// skipped.
+//
+// The output of du -ab (or -ah) has the same shape, but lists directories
+// after their contents with cumulative sizes. It is recognised by its last
+// line being the root, and directories then keep the sizes du gave them.
+type fileListing struct {
+	root    string
+	dirs    map[string]*Node // by cleaned path
+	skipped int              // malformed lines left out
+	meta    *jsonMeta        // preamble of an opened session (session.go)
+}
+
+// listingProblemLimit caps how many bad lines are quoted in the error.
+const listingProblemLimit = 3
+
+// Listing formats for -from-format.
+const (
+	listingAuto = "auto" // du when the root comes last, else a file list
+	listingList = "list" // size<TAB>[type<TAB>]path, directory sizes ignored
+	listingDu   = "du"   // du -ab output, directory sizes taken as given
+)
+
+// readListing builds the tree of the entries in r, read as format. Its root
+// is the deepest directory containing every entry. Malformed lines are
+// skipped and reported; a listing with no usable line is an error.
+func readListing(r io.Reader, format string) (*fileListing, []string, error) {
+	switch format {
+	case "", listingAuto, listingList, listingDu:
+	default:
+		return nil, nil, fmt.Errorf("unknown list format %q (want auto, list or du)", format)
+	}
+	l := &fileListing{dirs: map[string]*Node{}}
+	files := map[string]*Node{}
+	reported := map[string]int64{} // sizes as listed, for du's directories
+	var first, last string
+	typed := false
+	var paths []string
+	var problems []string
+	bad := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for lineNo := 1; sc.Scan(); lineNo++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		size, kind, p, err := parseListingLine(line)
+		if err != nil {
+			if bad++; bad <= listingProblemLimit {
+				problems = append(problems, fmt.Sprintf("line %d: %v", lineNo, err))
+			}
+			continue
+		}
+		isDir := kind == 'd' || strings.HasSuffix(p, "/") || strings.HasSuffix(p, string(filepath.Separator))
+		p = filepath.Clean(p)
+		typed = typed || kind != 0
+		reported[p] = size
+		if first == "" {
+			first = p
+		}
+		last = p
+		if isDir {
+			paths = append(paths, p)
+			l.dir(p, files)
+			continue
+		}
+		if _, ok := l.dirs[p]; ok {
+			paths = append(paths, p)
+			continue // a directory listed as a plain entry
+		}
+		paths = append(paths, filepath.Dir(p))
+		parent := l.dir(filepath.Dir(p), files)
+		if old, ok := files[p]; ok {
+			old.Size = size // listed twice: the last line wins
+			continue
+		}
+		f := &Node{Name: filepath.Base(p), Path: p, Size: size, Files: 1, Exclusive: size, Scanned: true}
+		files[p] = f
+		parent.Children = append(parent.Children, f)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	l.skipped = bad
+	if bad > listingProblemLimit {
+		problems = append(problems, fmt.Sprintf("... %d more bad lines", bad-listingProblemLimit))
+	}
+	if len(paths) == 0 {
+		return nil, problems, fmt.Errorf("the list has no entries (want size<TAB>path lines)")
+	}
+	l.root = commonDir(paths)
+	du := format == listingDu
+	if format == "" || format == listingAuto {
+		// find lists a directory before its contents, du after them
+		du = !typed && samePath(last, l.root) && !samePath(first, l.root)
+	}
+	if !du {
+		reported = nil
+	}
+	l.sum(l.dirs[l.root], reported)
+	return l, problems, nil
+}
+
+// loadListing reads the list at path, or stdin for "-". Lines that could
+// not be read are reported on stderr, where they are seen after quitting.
+func loadListing(path, format string) (*fileListing, error) {
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer func(f *os.File) {
+			_ = f.Close()
+		}(f)
+		in = f
+	}
+	l, problems, err := readListing(in, format)
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, "from-file:", p)
+	}
+	return l, err
+}
+
+// parseListingLine splits a listing line into size, find %y type (0 when
+// absent) and path.
+func parseListingLine(line string) (int64, byte, string, error) {
+	sz, rest, ok := strings.Cut(line, "\t")
+	if !ok {
+		return 0, 0, "", fmt.Errorf("no tab between size and path")
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(sz), 10, 64)
+	if err != nil {
+		if size, err = parseSize(strings.TrimSpace(sz)); err != nil {
+			return 0, 0, "", fmt.Errorf("bad size %q", sz)
+		}
+	}
+	if size < 0 {
+		return 0, 0, "", fmt.Errorf("negative size")
+	}
+	var kind byte
+	if len(rest) > 2 && rest[1] == '\t' && strings.IndexByte("fdlbcpsD", rest[0]) >= 0 {
+		kind, rest = rest[0], rest[2:]
+	}
+	if rest == "" {
+		return 0, 0, "", fmt.Errorf("empty path")
+	}
+	return size, kind, rest, nil
+}
+
+// dir returns the directory node for p, creating it and its ancestors as
+// needed. A file already listed at p becomes a directory: the listing
+// named something below it.
+func (l *fileListing) dir(p string, files map[string]*Node) *Node {
+	if d, ok := l.dirs[p]; ok {
+		return d
+	}
+	d := &Node{Name: nodeName(p), Path: p, IsDir: true, Scanned: true}
+	f, wasFile := files[p]
+	if wasFile {
+		delete(files, p)
+		*f = *d // keeps its place among the parent's children
+		d = f
+	}
+	l.dirs[p] = d
+	if parent := filepath.Dir(p); parent != p && !wasFile {
+		pd := l.dir(parent, files)
+		pd.Children = append(pd.Children, d)
+	}
+	return d
+}
+
+// sum fills in the totals of d's subtree, and offers its directories to the
+// largest-directories view like a scan would. Directories found in
+// reported (du's) keep that size; their own size is what their
+// subdirectories don't account for, which includes files du didn't list.
+func (l *fileListing) sum(d *Node, reported map[string]int64) {
+	d.Size, d.Files, d.Dirs, d.Exclusive = 0, 0, 0, 0
+	var sub int64
+	for _, c := range d.Children {
+		if c.IsDir {
+			l.sum(c, reported)
+			d.Dirs += c.Dirs + 1
+			sub += c.Size
+		} else {
+			d.Exclusive += c.Size
+		}
+		d.Size += c.Size
+		d.Files += c.Files
+	}
+	if size, ok := reported[d.Path]; ok {
+		d.Size, d.Exclusive = size, max(0, size-sub)
+	}
+	leaders.offerExclusive(d.Path, d.Exclusive)
+	leaders.offerCumulative(d.Path, d.Size)
+}
+
+// node returns the directory at p, or nil when the listing has none at or
+// below its root.
+func (l *fileListing) node(p string) *Node {
+	p = filepath.Clean(p)
+	if !samePath(p, l.root) && !underPath(p, l.root) {
+		return nil
+	}
+	return l.dirs[p]
+}
+
+// commonDir is the deepest directory containing every one of dirs.
+func commonDir(dirs []string) string {
+	common := dirs[0]
+	for _, p := range dirs[1:] {
+		for !underPath(p, common) && !samePath(p, common) {
+			up := filepath.Dir(common)
+			if up == common {
+				return common
+			}
+			common = up
+		}
+	}
+	return common
+}
+
+// tag is the header note of a file list.
+func (l *fileListing) tag() string {
+	if l.meta != nil {
+		return sessionTag(l.meta)
+	}
+	if l.skipped > 0 {
+		return fmt.Sprintf("[file list, %d bad lines skipped]", l.skipped)
+	}
+	return "[file list]"
+}
+
+// listingScan answers a scan request from the listing, in the same way a
+// finished scan would.
+func (m *model) listingScan(path, token string) tea.Cmd {
+	ch := make(chan tea.Msg, 1)
+	m.scanCh = ch
+	if n := m.listing.node(path); n != nil {
+		ch <- scanDoneMsg{node: n, token: token}
+	} else {
+		ch <- errMsg{err: fmt.Errorf("%s is not in the file list", path)}
+	}
+	close(ch)
+	return scanReaderCmd(ch)
+}
+
+// listingBlocks reports whether key k needs the real files, which a file
+// list doesn't have: deleting, renaming, previews, elevated rescans, deep
+// exports and user commands.
+func (m *model) listingBlocks(k string) bool {
+	if k == "d" && m.planMode {
+		return false // planning only records paths
+	}
+	switch k {
+	case "d", "R", "u", "ctrl+r", "!", "p", "X", "C", "O":
+		return true
+	}
+	_, ok := m.userCommands[k]
+	return ok
+}
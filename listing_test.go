@@ -0,0 +1,130 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestReadListing(t *testing.T) {
+	in := strings.Join([]string{
+		"# find /srv -printf '%s\\t%y\\t%p\\n'",
+		"4096\td\t/srv",
+		"4096\td\t/srv/www",
+		"100\tf\t/srv/www/index.html",
+		"4096\td\t/srv/empty",
+		"50\t/srv/logs/a.log", // two columns; logs is implied
+		"4096\t/srv/old",      // looks like a file ...
+		"7\t/srv/old/x",       // ... until something is listed below it
+		"oops\t/srv/bad",
+		"no tab here",
+		"",
+	}, "\n")
+	l, problems, err := readListing(strings.NewReader(in), listingAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.root != "/srv" || l.skipped != 2 || len(problems) != 2 || !strings.HasPrefix(problems[0], "line 9:") {
+		t.Fatalf("unexpected root %q, problems %v", l.root, problems)
+	}
+	root := l.node("/srv")
+	if root.Size != 157 || root.Files != 3 || root.Dirs != 4 || len(root.Children) != 4 {
+		t.Fatalf("unexpected root totals: %+v", root)
+	}
+	if d := l.node("/srv/empty"); d == nil || !d.IsDir || d.Size != 0 {
+		t.Fatalf("expected an empty directory, got %+v", d)
+	}
+	if d := l.node("/srv/old"); d == nil || !d.IsDir || d.Size != 7 || d.Files != 1 {
+		t.Fatalf("expected old to turn into a directory, got %+v", d)
+	}
+	if l.node("/") != nil || l.node("/srv/www/index.html") != nil {
+		t.Fatalf("only directories at or below the root are browsable")
+	}
+
+	if _, _, err := readListing(strings.NewReader("# nothing\n"), listingAuto); err == nil {
+		t.Fatalf("an empty list should be an error")
+	}
+}
+
+func TestBrowseListing(t *testing.T) {
+	l, _, err := readListing(strings.NewReader("10\ta/b/f1\n20\ta/c/f2\n"), listingAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.root != "a" {
+		t.Fatalf("expected the common directory a, got %q", l.root)
+	}
+	m := initialModel(l.root, 1, false)
+	t.Cleanup(m.cancel)
+	m.listing = l
+	m.loadingMinDuration = 0
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	drain := func(cmd tea.Cmd) {
+		m.Update(cmd())
+	}
+	m.setLoading(true)
+	drain(m.startIncrementalScan(l.root))
+	if m.loading || m.current == nil || m.current.Size != 30 || len(m.current.Children) != 2 {
+		t.Fatalf("expected the listing's root to be shown, got %+v", m.current)
+	}
+	if v := m.View(); !strings.Contains(v, "[file list]") {
+		t.Fatalf("the header should say this is a file list")
+	}
+
+	// entering a directory is answered from the list as well
+	m.tbl.SetCursor(0)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	for _, c := range cmd().(tea.BatchMsg) {
+		if msg, ok := c().(scanDoneMsg); ok {
+			m.Update(msg)
+		}
+	}
+	if m.current.Path != filepath.Join("a", "c") || m.current.Size != 20 {
+		t.Fatalf("expected a/c, got %+v", m.current)
+	}
+
+	// nothing that touches the real files
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	if m.overlays.has("confirm-delete") || !strings.Contains(m.status, "file list") {
+		t.Fatalf("delete should be refused, status %q", m.status)
+	}
+}
+
+func TestReadDuOutput(t *testing.T) {
+	// du -ab /tmp/dut
+	dump := "4096\t/tmp/dut/e\n5\t/tmp/dut/a/b/f\n4101\t/tmp/dut/a/b\n3\t/tmp/dut/a/g\n8200\t/tmp/dut/a\n16392\t/tmp/dut\n"
+	l, _, err := readListing(strings.NewReader(dump), listingAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := l.node("/tmp/dut")
+	if root.Size != 16392 || root.Files != 3 || root.Dirs != 2 {
+		t.Fatalf("expected du's totals for the root, got %+v", root)
+	}
+	if a := l.node("/tmp/dut/a"); a.Size != 8200 || a.Exclusive != 4099 || a.Files != 2 {
+		t.Fatalf("unexpected a: %+v", a)
+	}
+
+	// read as a plain list, directory lines don't count
+	l, _, err = readListing(strings.NewReader(dump), listingList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := l.node("/tmp/dut"); root.Size != 4096+5+3 {
+		t.Fatalf("expected file sizes only, got %+v", root)
+	}
+
+	// du without -a lists directories only; their sizes still add up
+	l, _, err = readListing(strings.NewReader("4096\t/d/e\n4101\t/d/a/b\n8200\t/d/a\n16392\t/d\n"), listingAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := l.node("/d/a"); a.Size != 8200 || l.node("/d").Size != 16392 {
+		t.Fatalf("unexpected totals without -a: %+v", a)
+	}
+	if _, _, err := readListing(strings.NewReader(dump), "ncdu"); err == nil {
+		t.Fatalf("unknown formats should be rejected")
+	}
+}
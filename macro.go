@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Macros ------------------------------
+
+// Q starts recording keys, in the main view and in dialogs alike, and Q
+// again stops and asks for a name. @ lists the saved macros and replays
+// one in the current directory, so the cleanup done in one project folder
+// (filter, plan, delete) is a keystroke in the next. Macros are kept under
+// "macros" in config.json as lists of key names:
+//
+//	"macros": {"clean builds": ["/", "t", "a", "r", "g", "e", "t", "enter", "d", "enter"]}
+//
+// Replay feeds the keys through Update one at a time and waits while a scan
+// or retry runs, as a user would; any key pressed meanwhile stops it.
+
+// macroDelay spaces replayed keys so the commands of one key get their
+// messages in before the next key.
+const macroDelay = 15 * time.Millisecond
+
+// macroRun is a replay in progress.
+type macroRun struct {
+	name string
+	keys []string
+	pos  int
+}
+
+type macroStepMsg struct {
+	run *macroRun
+}
+
+// keyTypes maps key names back to their types for replay.
+var keyTypes = func() map[string]tea.KeyType {
+	out := map[string]tea.KeyType{}
+	for t := tea.KeyType(-256); t <= tea.KeyDelete; t++ {
+		if s := t.String(); s != "" && t != tea.KeyRunes {
+			out[s] = t
+		}
+	}
+	return out
+}()
+
+// keyMsg turns a recorded key name back into the key.
+func keyMsg(s string) tea.KeyMsg {
+	alt := false
+	if rest, ok := strings.CutPrefix(s, "alt+"); ok && rest != "" {
+		alt, s = true, rest
+	}
+	if t, ok := keyTypes[s]; ok {
+		return tea.KeyMsg{Type: t, Alt: alt}
+	}
+	if len(s) > 2 && strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s[1 : len(s)-1]), Alt: alt, Paste: true}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s), Alt: alt}
+}
+
+// macroKey handles a key before anything else sees it: a key pressed
+// during a replay stops it (and is swallowed, bar ctrl+c), and while
+// recording every key is kept except the ones that drive the recorder.
+func (m *model) macroKey(msg tea.KeyMsg) bool {
+	if m.macroFeeding {
+		return false
+	}
+	k := msg.String()
+	if m.macroRun != nil {
+		m.macroRun = nil
+		m.status = "Macro stopped"
+		return k != "ctrl+c"
+	}
+	if m.recording && k != "ctrl+c" && (m.overlays.focused() != nil || k != "Q" && k != "@") {
+		m.recorded = append(m.recorded, k)
+	}
+	return false
+}
+
+// toggleRecording starts recording, or stops it and asks for a name.
+func (m *model) toggleRecording() {
+	if !m.recording {
+		m.recording, m.recorded = true, nil
+		m.status = "Recording a macro: Q stops"
+		return
+	}
+	keys := m.recorded
+	m.recording, m.recorded = false, nil
+	if len(keys) == 0 {
+		m.status = "Macro not saved: no keys were recorded"
+		return
+	}
+	m.overlays.push(newPrompt(m, "macro", fmt.Sprintf("Name this macro (%d keys)", len(keys)), "",
+		func(v string) error {
+			if v == "" {
+				return errors.New("the macro needs a name")
+			}
+			return nil
+		},
+		func(m *model, name string) tea.Cmd {
+			m.saveMacro(name, keys)
+			return nil
+		}))
+}
+
+// saveMacro keeps keys as name for the session and in the config file.
+func (m *model) saveMacro(name string, keys []string) {
+	if m.macros == nil {
+		m.macros = map[string][]string{}
+	}
+	m.macros[name] = keys
+	m.status = fmt.Sprintf("Saved macro %q (%d keys): @ replays it", name, len(keys))
+	if err := m.persistMacros(); err != nil {
+		m.status = fmt.Sprintf("Macro %q kept for this session; ⚠ could not save config: %v", name, err)
+	}
+}
+
+// persistMacros writes the macros to the config file, keeping the other
+// settings.
+func (m *model) persistMacros() error {
+	if m.configPath == "" {
+		return nil
+	}
+	cfg, err := loadConfig(m.configPath)
+	if err != nil {
+		return err
+	}
+	cfg.Macros = m.macros
+	return saveConfig(m.configPath, cfg)
+}
+
+// playMacro starts replaying the macro name.
+func (m *model) playMacro(name string) tea.Cmd {
+	keys := m.macros[name]
+	if len(keys) == 0 {
+		return nil
+	}
+	m.macroRun = &macroRun{name: name, keys: keys}
+	m.status = fmt.Sprintf("Replaying macro %q ...", name)
+	return macroTick(m.macroRun)
+}
+
+func macroTick(run *macroRun) tea.Cmd {
+	return tea.Tick(macroDelay, func(time.Time) tea.Msg { return macroStepMsg{run: run} })
+}
+
+// stepMacro feeds the next key of run, or waits for the scan it started.
+func (m *model) stepMacro(run *macroRun) tea.Cmd {
+	if run != m.macroRun {
+		return nil // stopped
+	}
+	if m.loading || m.retrying {
+		return macroTick(run)
+	}
+	if run.pos == len(run.keys) {
+		m.macroRun = nil
+		m.status = strings.TrimSpace(m.status + fmt.Sprintf("  [macro %q done]", run.name))
+		return nil
+	}
+	k := keyMsg(run.keys[run.pos])
+	run.pos++
+	m.macroFeeding = true
+	_, cmd := m.Update(k)
+	m.macroFeeding = false
+	return tea.Batch(cmd, macroTick(run))
+}
+
+// macroTag is the header note while recording or replaying.
+func (m *model) macroTag() string {
+	switch {
+	case m.recording:
+		return fmt.Sprintf("[● recording macro: %d keys — Q stops]", len(m.recorded))
+	case m.macroRun != nil:
+		return fmt.Sprintf("[macro %s %d/%d — any key stops]", m.macroRun.name, m.macroRun.pos, len(m.macroRun.keys))
+	}
+	return ""
+}
+
+// macroOverlay lists the saved macros to replay or forget one.
+type macroOverlay struct {
+	cursor int
+}
+
+func (o *macroOverlay) opts() overlayOpts {
+	return overlayOpts{id: "macros", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *macroOverlay) View(m *model) string {
+	w := m.popupWidth(70)
+	inner := maxvalue(30, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	names := slices.Sorted(maps.Keys(m.macros))
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Macros"), ""}
+	if len(names) == 0 {
+		lines = append(lines, faint.Render("none yet: Q starts recording, Q again stops"))
+	}
+	o.cursor = minvalue(o.cursor, maxvalue(0, len(names)-1))
+	for i, name := range names {
+		keys := m.macros[name]
+		line := fmt.Sprintf("%-20s %3d keys  ", truncateToWidth(name, 20), len(keys))
+		line += faint.Render(truncateToWidth(strings.Join(keys, " "), maxvalue(1, inner-lipgloss.Width(line))))
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", faint.Render("↑/↓ move  Enter replay here  x forget  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *macroOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	names := slices.Sorted(maps.Keys(m.macros))
+	switch msg.String() {
+	case "esc", "q", "@":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(names)-1), o.cursor+1)
+	case "x", "delete":
+		if o.cursor < len(names) {
+			delete(m.macros, names[o.cursor])
+			if err := m.persistMacros(); err != nil {
+				m.status = "⚠ could not save config: " + err.Error()
+			}
+		}
+	case "enter":
+		if o.cursor >= len(names) {
+			return nil, true
+		}
+		return m.playMacro(names[o.cursor]), true
+	}
+	return nil, false
+}
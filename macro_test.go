@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestKeyMsgRoundTrip(t *testing.T) {
+	for _, k := range []string{"enter", "esc", "ctrl+u", " ", "down", "alt+x", "x", "@", "Q", "[pasted]"} {
+		if got := keyMsg(k).String(); got != k {
+			t.Errorf("keyMsg(%q).String() = %q", k, got)
+		}
+	}
+}
+
+func TestMacroRecordAndReplay(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	h.keys("Q", "down", "b", "Q")
+	if h.m.recording {
+		t.Fatal("still recording after the second Q")
+	}
+	h.keys("pin second", "enter")
+	if got := h.m.macros["pin second"]; !slices.Equal(got, []string{"down", "b"}) {
+		t.Fatalf("recorded %v; want [down b]", got)
+	}
+
+	// replay it in alpha, which pins alpha's second entry
+	h.keys("up", "enter")
+	h.keys("@", "enter")
+	if h.m.macroRun == nil {
+		t.Fatalf("replay did not start: %q", h.m.status)
+	}
+	for h.m.macroRun != nil {
+		h.m.stepMacro(h.m.macroRun)
+		h.settle()
+	}
+	var pinned []string
+	for _, it := range h.m.basketEntries() {
+		pinned = append(pinned, filepath.Base(it.path))
+	}
+	slices.Sort(pinned)
+	if !slices.Equal(pinned, []string{"nested", "readme.md"}) {
+		t.Fatalf("pinned %v; want nested and readme.md", pinned)
+	}
+
+	// a key pressed during a replay stops it and does nothing else
+	h.m.playMacro("pin second")
+	h.keys("b")
+	if h.m.macroRun != nil || h.m.status != "Macro stopped" || len(h.m.basket.items) != 2 {
+		t.Fatalf("replay not stopped: run %v, status %q, basket %d", h.m.macroRun, h.m.status, len(h.m.basket.items))
+	}
+}
@@ -5,7 +5,6 @@ package main
 import (
 	"context"
 	"crypto/rand"
-	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -15,6 +14,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -26,8 +26,17 @@ import (
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+
+	"jvanrhyn.dev/disktree/scanner"
 )
 
+// defaultNetThreads is the per-mount worker cap for network/FUSE filesystems.
+const defaultNetThreads = 4
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
 var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
 
 // --------------------------- Data model ---------------------------
@@ -38,9 +47,47 @@ type Node struct {
 	Size     int64
 	Files    int64
 	Dirs     int64
+	IsDir    bool
 	Children []*Node // only immediate children of this node
 	Err      error
 	Scanned  bool
+	Hidden   bool // dotfile or platform hidden flag, see scanner.IsHidden
+	// Pruned cached nodes keep their totals but dropped Children to save
+	// memory; they are rescanned when visited (from dirRecords with
+	// -trust-mtime, else by listing the subtree again).
+	Pruned bool
+	// NoAccess directories could not be listed; their size is unknown (-1)
+	NoAccess bool
+	// Exclusive is the size of the files directly inside a directory,
+	// without its subdirectories; for files it equals Size
+	Exclusive int64
+	// LinkTarget is set on symlinks (listed with -follow-symlinks)
+	LinkTarget string
+	// Changed is set when entries vanished while the directory was being
+	// scanned; its totals leave them out
+	Changed bool
+	// Truncated is set when directories deeper than -max-depth were left
+	// out of its totals
+	Truncated bool
+	// Estimated is set when its totals are in part extrapolated because
+	// the scan budget ran out (-budget)
+	Estimated bool
+	// Margin is the half-width of the 95% confidence interval around Size
+	// when huge directories below were sampled (-sample-above)
+	Margin int64
+	// Kind is set on FIFOs, sockets and device files, which have no size;
+	// Special counts those skipped in a directory's subtree
+	Kind    scanner.SpecialKind
+	Special scanner.SpecialCounts
+	// Disk is the space taken on disk after transparent compression,
+	// counted with -compressed (compressed.go)
+	Disk int64
+	// Cloud is the part of Size in cloud-sync placeholders, which take
+	// (almost) nothing locally (cloud.go)
+	Cloud int64
+	// ListedFiles and ListedDirs count the entries directly inside a
+	// directory that is still being sized (Size -1)
+	ListedFiles, ListedDirs int64
 }
 
 // TrashItem describes a trashed file's metadata stored next to the trashed item.
@@ -50,6 +97,15 @@ type TrashItem struct {
 	OrigPath  string    `json:"orig_path"`
 	DeletedAt time.Time `json:"deleted_at"`
 	IsDir     bool      `json:"is_dir"`
+	// subtree totals at delete time, used to update cached ancestors
+	Size  int64 `json:"size,omitempty"`
+	Files int64 `json:"files,omitempty"`
+	Dirs  int64 `json:"dirs,omitempty"`
+	Disk  int64 `json:"disk,omitempty"`
+	Cloud int64 `json:"cloud,omitempty"`
+	// Linked are the files (relative to TrashPath) -trash-dedup link
+	// shares with another copy; a restore copies them apart first
+	Linked []string `json:"linked,omitempty"`
 }
 
 // Cache scanned directories to avoid recomputing when navigating back
@@ -60,164 +116,534 @@ var cache sync.Map // map[string]*Node
 type Scanner struct {
 	threads        int
 	followSymlinks bool
+	// mounts classifies paths by filesystem; nil treats everything as local
+	mounts *mountTable
+	// netThreads caps concurrency per network/FUSE mount (0 = threads)
+	netThreads int
+	// excludeHidden leaves hidden entries out of scans and totals entirely
+	excludeHidden bool
+	// tryUnreadable walks directories that can't be listed instead of
+	// reporting them as "no access"
+	tryUnreadable bool
+	// linkPolicy says where followed symlinks are counted, relative to the
+	// scan root (see symlinks.go)
+	linkPolicy linkPolicy
+	root       string
+	// oneFileSystem leaves filesystems mounted below a directory out of
+	// its totals, like du -x
+	oneFileSystem bool
+	// allocated counts the disk space files take instead of their length
+	allocated bool
+	// trustMtime lets incremental walks reuse the totals of directories
+	// whose mtime is unchanged (-trust-mtime). A file that grows or
+	// shrinks in place doesn't touch its directory's mtime, so this is
+	// opt-in.
+	trustMtime bool
+	// xattrs adds extended attributes and resource forks to file sizes
+	// (-xattrs, xattr.go)
+	xattrs bool
+	// diskSizes also counts compressed on-disk sizes (-compressed,
+	// compressed.go)
+	diskSizes bool
+	// exclude leaves files out by age or size (predicates.go)
+	exclude *filePredicates
+	// ignored are the entries left out of this session with I (ignore.go)
+	ignored *ignoreSet
+	// gate holds walkers between directories while paused (pause.go)
+	gate *pauseGate
+	// pool counts busy and queued walkers for the debug view (debug.go)
+	pool *poolStats
+	// analyzers receive every listing (analyzers.go)
+	analyzers *analyzerSet
+	// trace records scans and exports as OpenTelemetry spans (tracing.go)
+	trace *tracer
+	// wsl sizes Windows drives natively when running in WSL (wsl.go)
+	wsl *wslBridge
+	// scanAs sizes directories as another user (-scan-as, runas.go)
+	scanAs *scanAsBridge
+	// server lists directories instead of walking them (-attach, server.go)
+	server *serverClient
+	// budget bounds each scan (-budget, budget.go)
+	budget *scanBudget
+	// sampling sizes the files of huge directories from a sample
+	// (-sample-above, sampling.go)
+	sampling *sampling
 }
 
-type dirSum struct {
-	size  int64
-	files int64
-	dirs  int64
-	err   error
-}
+// statBatch is how many entries are listed (and stat'ed) per ReadDir call on
+// network filesystems, so huge directories don't flood the server.
+const statBatch = 256
 
-func (s *Scanner) scanDir(ctx context.Context, path string) *Node {
-	if v, ok := cache.Load(path); ok {
-		return v.(*Node)
+// limitFor returns the worker limit for directories on mount mi.
+func (s *Scanner) limitFor(mi mountInfo) int {
+	if mi.network() && s.netThreads > 0 {
+		return maxvalue(1, minvalue(s.threads, s.netThreads))
 	}
+	return maxvalue(1, s.threads)
+}
 
-	name := filepath.Base(path)
-	if name == "/" || name == "." || name == "" {
-		name = path
+// excludesMount reports whether p is a mount point whose contents are left
+// out of its parent's totals by -one-file-system.
+func (s *Scanner) excludesMount(p string) bool {
+	if !s.oneFileSystem {
+		return false
 	}
+	_, ok := s.mounts.isMountPoint(p)
+	return ok
+}
 
-	n := &Node{Name: name, Path: path}
+// readDir lists p, trying once more if p is missing: a directory that is
+// being replaced (renamed over) can vanish briefly. A remaining
+// fs.ErrNotExist means p was removed during the scan.
+func (s *Scanner) readDir(p string, mi mountInfo) ([]fs.DirEntry, error) {
+	defer s.pool.read(p)()
+	ents, err := s.listDir(p, mi)
+	if errors.Is(err, fs.ErrNotExist) {
+		ents, err = s.listDir(p, mi)
+	}
+	return ents, err
+}
 
-	// list immediate children
-	entries, err := os.ReadDir(path)
+// listDir lists p, reading network directories in bounded batches.
+func (s *Scanner) listDir(p string, mi mountInfo) ([]fs.DirEntry, error) {
+	if !mi.network() {
+		return os.ReadDir(p)
+	}
+	f, err := os.Open(p)
 	if err != nil {
-		n.Err = err
-		cache.Store(path, n)
-		return n
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	var out []fs.DirEntry
+	for {
+		batch, err := f.ReadDir(statBatch)
+		out = append(out, batch...)
+		if err == io.EOF || (err == nil && len(batch) == 0) {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
 	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name() < out[j].Name() })
+	return out, nil
+}
 
-	// worker semaphore
-	sem := make(chan struct{}, maxvalue(1, s.threads))
-	var wg sync.WaitGroup
-	children := make([]*Node, 0, len(entries))
-	mu := sync.Mutex{}
+type dirSum struct {
+	size  int64
+	files int64
+	dirs  int64
+	// exclusive is the size of the files directly inside the walked root
+	exclusive int64
+	err       error
+	// changed is set when entries vanished during the walk
+	changed bool
+	// truncated is set when directories below -max-depth were skipped
+	truncated bool
+	// estimated is set when directories past the scan budget were
+	// estimated instead of walked
+	estimated bool
+	// margin is the 95% confidence half-width of size when files of huge
+	// directories were sampled (sampling.go)
+	margin int64
+	// special counts the FIFOs, sockets and device files skipped
+	special scanner.SpecialCounts
+	// disk is the on-disk size of the files, with -compressed
+	disk int64
+	// cloud is the part of size in cloud-sync placeholders (cloud.go)
+	cloud int64
+}
 
-	for _, e := range entries {
-		// skip symlinks unless asked
-		if e.Type()&fs.ModeSymlink != 0 && !s.followSymlinks {
-			continue
-		}
+// addFile counts the file fi at path.
+func (d *dirSum) addFile(s *Scanner, path string, fi fs.FileInfo) {
+	size := s.fileSize(path, fi)
+	d.size += size
+	d.disk += s.diskSize(path, fi)
+	d.cloud += cloudPart(fi, size)
+	d.files++
+}
 
-		childPath := filepath.Join(path, e.Name())
-		child := &Node{Name: e.Name(), Path: childPath}
-		children = append(children, child)
+func (d dirSum) totals() scanner.Totals {
+	return scanner.Totals{Size: d.size, Files: d.files, Dirs: d.dirs, Exclusive: d.exclusive, Err: d.err, Changed: d.changed, Truncated: d.truncated, Estimated: d.estimated, Margin: d.margin, Special: d.special, Disk: d.disk, Cloud: d.cloud}
+}
 
-		if e.IsDir() {
-			wg.Add(1)
-			go func(nd *Node) {
-				defer wg.Done()
-				select {
-				case sem <- struct{}{}:
-					// proceed
-				case <-ctx.Done():
-					return
-				}
-				defer func() { <-sem }()
-				res := s.sumDir(ctx, nd.Path)
-				mu.Lock()
-				nd.Size, nd.Files, nd.Dirs, nd.Err = res.size, res.files, res.dirs, res.err
-				mu.Unlock()
-			}(child)
-		} else {
-			fi, err := e.Info()
-			if err == nil {
-				child.Size = fi.Size()
-				child.Files = 1
-			}
-		}
+// nodeFromEntry converts a scanner entry into a leaf Node.
+func nodeFromEntry(e scanner.Entry) *Node {
+	return &Node{Name: e.Name, Path: e.Path, IsDir: e.IsDir, Size: e.Size, Files: e.Files, Dirs: e.Dirs, Exclusive: e.Exclusive, Err: e.Err, Hidden: e.Hidden, NoAccess: e.NoAccess, LinkTarget: e.LinkTarget, Changed: e.Changed, Truncated: e.Truncated, Estimated: e.Estimated, Margin: e.Margin, Kind: e.Kind, Special: e.Special, Disk: e.Disk, Cloud: e.Cloud, ListedFiles: e.ListedFiles, ListedDirs: e.ListedDirs}
+}
+
+// scanDir returns the cached node for path, scanning it if needed.
+func (s *Scanner) scanDir(ctx context.Context, path string) *Node {
+	if v, ok := cache.Load(pathKey(path)); ok && !v.(*Node).Pruned {
+		return v.(*Node)
 	}
+	n, _ := s.scan(ctx, path, false, nil)
+	return n
+}
 
-	wg.Wait()
+// scan lists path with the scanner engine and sizes its children with
+// walkSum (incrementally when asked). Both the TUI and scanDir go through
+// here so symlink and cache handling cannot drift apart. onChild, if set,
+// receives each child as it is listed and again once sized. Completed scans
+// are cached; a root that cannot be listed is returned with Err set and is
+// not cached, so the next visit retries it.
+func (s *Scanner) scan(ctx context.Context, path string, incremental bool, onChild func(*Node)) (*Node, walkStats) {
+	if s.server != nil {
+		n := s.server.scan(ctx, path, onChild)
+		if n.Err == nil || len(n.Children) > 0 {
+			cache.Store(pathKey(path), n)
+			s.analyzers.sendListing(n)
+			leaders.offerExclusive(path, n.Exclusive)
+			leaders.offerCumulative(path, n.Size)
+		}
+		return n, walkStats{}
+	}
+	var mu sync.Mutex
+	var walk walkStats
+	ctx, run := s.trace.begin(ctx, "scan", path)
+	ctx = withBudget(ctx, s.budget.start())
+	opts := s.options()
+	opts.SizeDir = func(ctx context.Context, p string) scanner.Totals {
+		if s.excludesMount(p) {
+			return scanner.Totals{}
+		}
+		if res, ok := s.scanAs.sum(ctx, p); ok {
+			return res.totals()
+		}
+		if res, ok := s.wsl.sum(ctx, p, s); ok {
+			return res.totals()
+		}
+		res, ws := s.walkSum(ctx, p, incremental)
+		mu.Lock()
+		walk.add(ws)
+		mu.Unlock()
+		return res.totals()
+	}
+	t0 := run.now()
+	events, err := scanner.Scan(ctx, path, opts) // lists path before returning
+	run.add(phaseReaddir, t0)
+	if err != nil {
+		run.end(err)
+		return &Node{Name: nodeName(path), Path: path, IsDir: true, Err: err, Scanned: true}, walk
+	}
+	n := &Node{Name: nodeName(path), Path: path, IsDir: true}
+	for ev := range events {
+		switch ev := ev.(type) {
+		case scanner.ChildEvent:
+			if onChild != nil {
+				onChild(nodeFromEntry(ev.Entry))
+			}
+		case scanner.DoneEvent:
+			t0 := run.now()
+			n.Size, n.Files, n.Dirs, n.Exclusive, n.Err = ev.Root.Size, ev.Root.Files, ev.Root.Dirs, ev.Root.Exclusive, ev.Root.Err
+			n.Changed, n.Truncated, n.Estimated, n.Margin = ev.Root.Changed, ev.Root.Truncated, ev.Root.Estimated, ev.Root.Margin
+			n.Special, n.Disk, n.Cloud = ev.Root.Special, ev.Root.Disk, ev.Root.Cloud
+			n.Children = make([]*Node, len(ev.Children))
+			for i, c := range ev.Children {
+				n.Children[i] = nodeFromEntry(c)
+			}
+			n.Scanned = true
+			cache.Store(pathKey(path), n)
+			s.analyzers.sendListing(n)
+			leaders.offerExclusive(path, n.Exclusive)
+			leaders.offerCumulative(path, n.Size)
+			run.add(phaseAggregate, t0)
+		}
+	}
+	run.end(ctx.Err())
+	mu.Lock()
+	defer mu.Unlock()
+	return n, walk
+}
 
-	// aggregate
-	var total int64
-	for _, c := range children {
-		total += c.Size
-		if c.Dirs > 0 || c.Files > 0 {
-			// counts already include nested totals for dirs
-			n.Dirs += c.Dirs
-			n.Files += c.Files
-		}
-		if c.Err != nil {
-			n.Err = c.Err // keep last error; informational only
-		}
+// nodeName is the display name for a scanned directory; roots like "/" keep
+// their full path.
+func nodeName(path string) string {
+	name := filepath.Base(path)
+	if name == "/" || name == "." || name == "" || name == string(filepath.Separator) {
+		return path
 	}
-	n.Size = total
-	n.Children = children
-	n.Scanned = true
-	cache.Store(path, n)
-	return n
+	return name
 }
 
-// sumDir computes totals for an entire subtree without building its full tree
+// sumDir computes totals for an entire subtree without building its full tree.
+// Concurrency is bounded per mount so network filesystems get fewer workers.
 func (s *Scanner) sumDir(ctx context.Context, path string) (res dirSum) {
+	res, _ = s.walkSum(ctx, path, false)
+	return res
+}
+
+// walkSum walks the subtree at path, recording each directory's own totals
+// in dirRecords. When incremental is set and the scanner trusts mtimes,
+// directories whose mtime matches their record are not listed again: their
+// recorded totals and subdirectories are reused and only the
+// subdirectories are visited.
+func (s *Scanner) walkSum(ctx context.Context, path string, incremental bool) (dirSum, walkStats) {
 	// BFS/DFS with semaphore-limited goroutines for subdirectories
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, maxvalue(1, s.threads))
 	errs := make(chan error, 1)
 
 	var mu sync.Mutex
-	var files, dirs, size int64
+	var files, dirs, size, exclusive int64
+	var changed, truncated, estimated bool
+	var margin int64
+	var special scanner.SpecialCounts
+	var disk, cloud int64
+	var stats walkStats
+
+	var semMu sync.Mutex
+	sems := map[string]chan struct{}{}
+	semFor := func(mi mountInfo) chan struct{} {
+		semMu.Lock()
+		defer semMu.Unlock()
+		sem, ok := sems[mi.Point]
+		if !ok {
+			sem = make(chan struct{}, s.limitFor(mi))
+			sems[mi.Point] = sem
+		}
+		return sem
+	}
 
-	var walk func(string)
-	walk = func(p string) {
-		select {
-		case <-ctx.Done():
+	// followed symlinks to directories are walked once, and never when
+	// they loop back to an ancestor
+	opts := s.options()
+	var guard scanner.LinkGuard
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		guard.Enter("", real) // the walk root counts as entered
+	}
+	run := traceRunFrom(ctx)
+	budget := budgetFrom(ctx)
+
+	limit := opts.DepthLimit()
+
+	var walk func(string, mountInfo, *subtreeAcc, int)
+	descend := func(child string, parent *subtreeAcc, depth int) {
+		if s.excludesMount(child) {
+			return
+		}
+		cmi := s.mounts.lookup(child)
+		acc := newSubtreeAcc(parent, child)
+		parent.pending.Add(1)
+		wg.Add(1)
+		go func(cp string, cmi mountInfo) {
+			defer crashGuard()
+			defer wg.Done()
+			sem := semFor(cmi)
+			if !s.pool.acquire(ctx, sem) {
+				return
+			}
+			defer s.pool.release(sem)
+			walk(cp, cmi, acc, depth)
+		}(child, cmi)
+	}
+	walk = func(p string, mi mountInfo, acc *subtreeAcc, depth int) {
+		if depth > limit {
+			// a recursive bind mount or a pathological tree
+			mu.Lock()
+			truncated = true
+			mu.Unlock()
+			acc.done()
+			return
+		}
+		if !s.gate.wait(ctx) {
+			return
+		}
+		// stat before listing so a change made during the listing shows up
+		// as a newer mtime next time
+		var mtime time.Time
+		if fi, err := os.Stat(p); err == nil {
+			mtime = fi.ModTime()
+		}
+		var prev *dirRecord
+		if v, ok := dirRecords.Load(pathKey(p)); ok {
+			prev = v.(*dirRecord)
+		}
+		if incremental && s.trustMtime && prev != nil && !mtime.IsZero() && prev.mtime.Equal(mtime) {
+			leaders.offerExclusive(p, prev.own.size)
+			acc.size.Add(prev.own.size)
+			mu.Lock()
+			if p == path {
+				exclusive = prev.own.size
+			}
+			size += prev.own.size
+			files += prev.own.files
+			margin = combineMargins(margin, prev.own.margin)
+			special.Merge(prev.own.special)
+			disk += prev.own.disk
+			cloud += prev.own.cloud
+			dirs += int64(len(prev.subdirs))
+			stats.dirs++
+			mu.Unlock()
+			for _, name := range prev.subdirs {
+				descend(filepath.Join(p, name), acc, depth+1)
+			}
+			for _, name := range prev.links {
+				child := filepath.Join(p, name)
+				if target, fi, follow := opts.ResolveLink(child); follow && fi.IsDir() && guard.Enter(child, target) {
+					mu.Lock()
+					dirs++
+					mu.Unlock()
+					descend(child, acc, depth+1)
+				}
+			}
+			acc.done()
+			return
+		}
+		if budget.spent() {
+			// past the budget: guess rather than list
+			es, ef := budget.estimate()
+			mu.Lock()
+			size += es
+			files += ef
+			estimated = true
+			mu.Unlock()
+			acc.done()
+			return
+		}
+		t0 := run.now()
+		ents, err := s.readDir(p, mi)
+		run.add(phaseReaddir, t0)
+		if errors.Is(err, fs.ErrNotExist) {
+			// removed since its parent was listed
+			mu.Lock()
+			changed = true
+			mu.Unlock()
+			acc.done()
 			return
-		default:
 		}
-		ents, err := os.ReadDir(p)
 		if err != nil {
 			select {
 			case errs <- err:
 			default:
 			}
+			acc.done()
 			return
 		}
+		rec := &dirRecord{mtime: mtime}
+		fp := newFingerprint()
+		var linkDirs int64
+		// in huge directories only every stride-th file is stat'ed
+		stride := s.sampling.stride(len(ents))
+		var sample fileSample
+		var sampled int64 // files seen while sampling
 		for _, e := range ents {
-			if e.Type()&fs.ModeSymlink != 0 && !s.followSymlinks {
+			isLink := e.Type()&fs.ModeSymlink != 0
+			if isLink && !s.followSymlinks {
+				continue
+			}
+			if s.excludeHidden && scanner.IsHidden(e) {
 				continue
 			}
 			child := filepath.Join(p, e.Name())
-			if e.IsDir() {
-				mu.Lock()
-				dirs++
-				mu.Unlock()
-				wg.Add(1)
-				go func(cp string) {
-					defer wg.Done()
-					select {
-					case sem <- struct{}{}:
-						// ok
-					case <-ctx.Done():
-						return
+			if s.ignored.has(child) {
+				continue
+			}
+			if k := scanner.Special(e.Type()); k != scanner.NotSpecial {
+				// no stat: some hang, and their sizes mean nothing
+				fp.add(e, nil)
+				rec.own.special.Add(k)
+				continue
+			}
+			if isLink {
+				if target, fi, follow := opts.ResolveLink(child); follow {
+					fp.add(e, fi)
+					if k := scanner.Special(fi.Mode()); k != scanner.NotSpecial {
+						rec.own.special.Add(k)
+						continue
 					}
-					defer func() { <-sem }()
-					walk(cp)
-				}(child)
-			} else {
+					if !fi.IsDir() {
+						if s.exclude.excludes(fi) {
+							continue
+						}
+						rec.own.addFile(s, child, fi)
+						continue
+					}
+					rec.links = append(rec.links, e.Name())
+					if guard.Enter(child, target) {
+						linkDirs++
+						descend(child, acc, depth+1)
+					}
+					continue
+				}
+				// otherwise the link counts as itself, like a file
+			}
+			if e.IsDir() {
+				rec.subdirs = append(rec.subdirs, e.Name())
+				fp.add(e, nil)
+				descend(child, acc, depth+1)
+			} else if stride > 1 {
+				sampled++
+				if sampled%int64(stride) != 1 {
+					fp.add(e, nil)
+					continue
+				}
 				fi, err := e.Info()
+				fp.add(e, fi)
 				if err == nil {
+					size := s.fileSize(child, fi)
+					sample.add(size, s.diskSize(child, fi), cloudPart(fi, size), !s.exclude.excludes(fi))
+				}
+			} else {
+				t0 := run.now()
+				fi, err := e.Info()
+				run.add(phaseStat, t0)
+				if errors.Is(err, fs.ErrNotExist) {
 					mu.Lock()
-					size += fi.Size()
-					files++
+					changed = true
 					mu.Unlock()
+					continue
+				}
+				fp.add(e, fi)
+				if err == nil && !s.exclude.excludes(fi) {
+					rec.own.addFile(s, child, fi)
 				}
 			}
 		}
-	}
-
-	walk(path)
+		if stride > 1 {
+			sz, fl, mg := sample.estimate(sampled)
+			rec.own.size += sz
+			rec.own.disk += sample.scaled(sample.disk, sz)
+			rec.own.cloud += sample.scaled(sample.cloud, sz)
+			rec.own.files += fl
+			rec.own.margin = mg
+		}
+		t0 = run.now()
+		rec.fp = fp.sum()
+		dirRecords.Store(pathKey(p), rec)
+		leaders.offerExclusive(p, rec.own.size)
+		acc.size.Add(rec.own.size)
+		acc.done()
+		mu.Lock()
+		if p == path {
+			exclusive = rec.own.size
+		}
+		size += rec.own.size
+		files += rec.own.files
+		margin = combineMargins(margin, rec.own.margin)
+		special.Merge(rec.own.special)
+		disk += rec.own.disk
+		cloud += rec.own.cloud
+		dirs += int64(len(rec.subdirs)) + linkDirs
+		budget.walked(rec.own.files, rec.own.size)
+		stats.dirs++
+		stats.rewalked++
+		if prev != nil && prev.fp != rec.fp {
+			stats.changed++
+		}
+		mu.Unlock()
+		run.add(phaseAggregate, t0)
+	}
+
+	walk(path, s.mounts.lookup(path), newSubtreeAcc(nil, path), 0)
 	wg.Wait()
 	var err error
 	select {
 	case err = <-errs:
 	default:
 	}
-	return dirSum{size: size, files: files, dirs: dirs, err: err}
+	return dirSum{size: size, files: files, dirs: dirs, exclusive: exclusive, err: err, changed: changed, truncated: truncated, estimated: estimated, margin: margin, special: special, disk: disk, cloud: cloud}, stats
 }
 
 // --------------------------- TUI ------------------------------
@@ -227,6 +653,9 @@ type sortMode int
 const (
 	sortBySize sortMode = iota
 	sortByName
+	sortByExclusive
+	sortByScore // cleanup score (score.go)
+	sortByDisk  // on-disk size (compressed.go)
 )
 
 type model struct {
@@ -244,6 +673,11 @@ type model struct {
 	loading     bool
 	status      string
 
+	// autoDrilling is set while a (auto-drill) keeps entering the largest
+	// child; autoDrillFrom is the breadcrumb depth it started at
+	autoDrilling  bool
+	autoDrillFrom int
+
 	tbl     table.Model
 	spin    spinner.Model
 	sort    sortMode
@@ -251,23 +685,124 @@ type model struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
-	// delete confirmation
-	confirmDelete bool
-	deletePath    string
-	confirmFocus  int // 0 = yes, 1 = no
-	loadingFrame  int
+	// dialogs layered over the main view (confirm delete, loading, help)
+	overlays     overlayStack
+	loadingFrame int
+	// submitted prompt values per prompt kind, oldest first
+	promptHistory map[string][]string
+	// case-insensitive name filter applied to the table
+	filter string
+	// nodes backing the table rows, in display order
+	rows []*Node
+	// child sizes before the running rescan, and the differences it found
+	rescanPrev   map[string]int64
+	sizeDeltas   map[string]int64
+	changedUntil time.Time
+	// the Size column is widened while a row shows a delta
+	wideSize bool
+	// soft memory cap (-mem-limit); nearing it turns on compact mode
+	memLimit int64
+	compact  bool
+	// leave hidden entries out of the table (they still count in totals)
+	hideHidden bool
+	// side pane previewing the selected entry (`p`), and its last render
+	showPreview bool
+	preview     *previewCache
+	// terminal image protocol for pictures (-graphics), and whether the
+	// last frame drew one
+	graphics      graphicsProtocol
+	graphicsShown bool
+	// external commands bound to keys in the config
+	userCommands map[string]userCommand
+	// table columns claimed by analyzers, after the built-in ones
+	pluginCols []string
+	// showPerms adds the Owner and Mode columns (o); perms caches them for
+	// the entries of permsDir (perms.go)
+	showPerms bool
+	perms     map[string]permInfo
+	permsDir  string
+	// scores caches what cleanup scores need for scoresDir's entries
+	scores    map[string]scoreInfo
+	scoresDir string
+	// tree read from -from-file; scans are answered from it (listing.go)
+	listing *fileListing
+	// storage profile from -profile, nil for none (termux.go)
+	profile *storageProfile
+	// which node's children are in table order (sorting.go)
+	order childOrder
+	// links in the current table counted both here and at their target
+	doubleCounted int
+	// hidden entries left out of the current table and their total size
+	hiddenCount int
+	hiddenSize  int64
+	// running deep export, if any
+	exportJob *exportJob
+	// running copy, if any (copy.go)
+	copyJob *copyJob
+	// archival targets for O and the running offload, if any (offload.go)
+	offload    []offloadTarget
+	offloadJob *offloadJob
+	// what the backup leaves out, from -backup-patterns (backup.go)
+	backup *backupCoverage
+	// toastSeq numbers export toasts so a stale timeout can't close a newer one
+	toastSeq int
+	// filters last used for deep exports
+	exportOpts exportOptions
 	// incremental scan channel (delivers childUpdateMsg and final scanDoneMsg)
 	scanCh chan tea.Msg
 	// debounce control for frequent updates
 	pendingUpdates bool
 	debounceActive bool
-	debounceDur    time.Duration
+	// debounce and loading tick intervals (pacing.go)
+	pacer pacer
+	// when ctrl+z stopped the program, for the status at resume (suspend.go)
+	suspendedAt time.Time
 	// behavior options
 	autoRescanAfterDelete bool
-	// undo history (most recent appended at end)
-	trashHistory []*TrashItem
-	// time window during which undo is allowed
-	undoWindow time.Duration
+	// deletes at or above this size need a second confirmation (0 disables)
+	confirmThreshold int64
+	// confirmSkipBelow and confirmTyped are the rest of the confirmation
+	// policy (-confirm-skip-below, -confirm-large type; confirm.go)
+	confirmSkipBelow int64
+	confirmTyped     bool
+	// paths that need a typed override (or are refused) before deleting
+	protect protectedRules
+	// undo/redo history of deletes, renames and copies
+	journal *opJournal
+	// everything trashed this session, offered for emptying at quit
+	sessionTrash []*TrashItem
+	// space deleted and offloaded this session, for the footer (freed.go)
+	freed freedSpace
+	// cleanup plan, and whether d adds to it instead of deleting (plan.go)
+	plan     cleanupPlan
+	planMode bool
+	// entries pinned with b to compare them side by side (basket.go)
+	basket basket
+	// trashOnExit is "ask", "keep" or "empty" (-trash-on-exit)
+	trashOnExit string
+	// trashDedup is "off", "latest" or "link" (-trash-dedup)
+	trashDedup string
+	// uacOffered is set once unreadable folders were offered for a UAC
+	// rescan, so the offer doesn't come back on every scan (uac.go)
+	uacOffered bool
+	// retrying is set while T sizes errored folders again (retry.go)
+	retrying bool
+	// claim is this instance's registered scan of the root, otherScans the
+	// claims of other instances on overlapping roots found at start, and
+	// publishing is set while the records of the finished scan are being
+	// written for them (scanlock.go)
+	claim      *scanClaim
+	otherScans []*scanClaim
+	publishing bool
+	// macros are the saved key macros by name; recording and recorded are
+	// the one being recorded, macroRun the one being replayed (macro.go)
+	macros       map[string][]string
+	recording    bool
+	recorded     []string
+	macroRun     *macroRun
+	macroFeeding bool
+	// configPath is where settings chosen in the UI are saved
+	configPath string
 	// active scan token to match messages to the currently-viewed scan
 	scanToken string
 	// minimum overlay display time to prevent flicker
@@ -278,6 +813,10 @@ type model struct {
 	ongoingScansMu sync.Mutex
 	// ensure loading state is visible for at least this duration
 	loadingMinDuration time.Duration
+	// scans finishing sooner than this skip loadingMinDuration (pacing.go)
+	loadingQuick time.Duration
+	// show the centered loading popup instead of the header badge
+	loadingOverlay bool
 	// flag to ensure loading state persists during scans
 	scanInProgress bool
 }
@@ -285,6 +824,10 @@ type model struct {
 type scanDoneMsg struct {
 	node  *Node
 	token string
+	// directories visited / re-listed by an incremental rescan
+	walk walkStats
+	// served from the cache without listing anything
+	cached bool
 }
 
 type errMsg struct{ err error }
@@ -314,6 +857,7 @@ func initialModel(root string, threads int, follow bool) *model {
 	cols := []table.Column{
 		{Title: "Name", Width: 40},
 		{Title: "Size", Width: 12},
+		{Title: "Own", Width: 10},
 		{Title: "Files", Width: 8},
 		{Title: "Dirs", Width: 6},
 		{Title: "% of Parent", Width: 12},
@@ -324,6 +868,7 @@ func initialModel(root string, threads int, follow bool) *model {
 	t.SetStyles(tableStyles())
 
 	m := model{
+		protect:        newProtectedRules(nil, false),
 		rootPath:       root,
 		threads:        threads,
 		followSymlinks: follow,
@@ -331,26 +876,40 @@ func initialModel(root string, threads int, follow bool) *model {
 		spin:           sp,
 		tbl:            t,
 		sort:           sortBySize,
-		scanner:        &Scanner{threads: threads, followSymlinks: follow},
+		pacer:          newPacer(),
+		scanner:        &Scanner{threads: threads, followSymlinks: follow, mounts: systemMounts(), netThreads: defaultNetThreads, root: root, gate: &pauseGate{}, pool: &poolStats{}, ignored: &ignoreSet{}},
 		ctx:            ctx,
 		cancel:         cancel,
-		// default undo window 30s
-		undoWindow: 30 * time.Second,
+		journal:        &opJournal{},
 		// minimum loading display time to prevent flicker
 		minLoadingTime: 200 * time.Millisecond,
 		// ensure the loading state is visible for at least this duration
-		loadingMinDuration: 500 * time.Millisecond,
+		loadingMinDuration: defaultLoadingMin,
+		loadingQuick:       defaultLoadingQuick,
 	}
 
 	return &m
 }
 
 func (m *model) Init() tea.Cmd {
-	cache.Delete(m.rootPath)
-	m.loading = true
-	m.loadingStartTime = time.Now()
-	m.status = fmt.Sprintf("Scanning %s ...", m.rootPath)
-	return tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(m.rootPath))
+	var cmds []tea.Cmd
+	if c := coveringClaim(m.rootPath, m.scanner.recordsKey(), m.otherScans); c != nil {
+		// another instance is walking this tree: ask before a second walk
+		m.overlays.push(&scanLockOverlay{claim: c})
+		m.status = fmt.Sprintf("%s is scanning %s", c.who(), c.Root)
+	} else {
+		m.status = fmt.Sprintf("Scanning %s ...", m.rootPath)
+		if len(m.otherScans) > 0 {
+			m.status += fmt.Sprintf(" (%s is also scanning %s below it)", m.otherScans[0].who(), m.otherScans[0].Root)
+		}
+		cmds = append(cmds, m.startRootScan())
+	}
+	cmds = append(cmds, m.claimBeatTick())
+	if m.memLimit > 0 {
+		cmds = append(cmds, memCheckTick())
+	}
+	cmds = append(cmds, m.scanner.analyzers.wait(), m.backup.wait())
+	return tea.Batch(cmds...)
 }
 
 // scanCmd is retained for reference but unused after incremental scanning refactor.
@@ -362,10 +921,22 @@ func (m *model) Init() tea.Cmd {
 //     }
 // }
 
-func loadingTicker() tea.Cmd {
-	return tea.Tick(time.Millisecond*120, func(t time.Time) tea.Msg {
-		return loadingTickMsg(t)
-	})
+// setLoading toggles the loading state. Rows stream in while it is on, with
+// a badge in the header; the centered overlay is opt-in (-loading-overlay).
+func (m *model) setLoading(on bool) {
+	m.loading = on
+	if on {
+		m.loadingStartTime = time.Now()
+		m.perms, m.scores = nil, nil // looked up again
+		if m.loadingOverlay {
+			m.overlays.push(loadingOverlay{})
+		}
+		return
+	}
+	m.overlays.remove("loading")
+	if m.exportJob == nil {
+		m.scanner.gate.unpause() // nothing left to hold
+	}
 }
 
 func scanReaderCmd(ch chan tea.Msg) tea.Cmd {
@@ -383,12 +954,25 @@ func scanReaderCmd(ch chan tea.Msg) tea.Cmd {
 // and returns a command that will deliver the first message. Subsequent
 // messages are delivered by reusing scanReaderCmd repeatedly from Update.
 func (m *model) startIncrementalScan(path string) tea.Cmd {
-	useFastCache := !m.loading // capture at call time to avoid race conditions
+	return m.startScan(path, false)
+}
+
+// startCachedScan is startIncrementalScan for navigation: a directory whose
+// listing is in the cache is shown from it at once, as it was when last
+// seen (r rescans it).
+func (m *model) startCachedScan(path string) tea.Cmd {
+	return m.startScan(path, true)
+}
+
+func (m *model) startScan(path string, useFastCache bool) tea.Cmd {
 	ch := make(chan tea.Msg, 64)
 	m.scanCh = ch
 	// generate scan token and store it on the model so updates can match
 	token := uniqueSuffix()
 	m.scanToken = token
+	if m.listing != nil {
+		return m.listingScan(path, token)
+	}
 	// increment ongoing scans counter
 	m.ongoingScansMu.Lock()
 	m.ongoingScans++
@@ -396,95 +980,38 @@ func (m *model) startIncrementalScan(path string) tea.Cmd {
 	m.scanInProgress = true
 
 	go func(useFastCache bool) {
+		defer crashGuard()
+		var done tea.Msg
 		defer func() {
-			close(ch)
-			// decrement ongoing scans counter when scan completes
+			// decrement ongoing scans counter when scan completes, before
+			// the result is sent so applying it sees no scan running
 			m.ongoingScansMu.Lock()
 			m.ongoingScans--
 			if m.ongoingScans <= 0 {
 				m.scanInProgress = false
 			}
 			m.ongoingScansMu.Unlock()
+			if done != nil {
+				ch <- done
+			}
+			close(ch)
 		}()
 		// Use cache if available, fully scanned, and fast cache is enabled
 		if useFastCache {
-			if v, ok := cache.Load(path); ok {
-				if n, ok2 := v.(*Node); ok2 && n.Scanned {
-					ch <- scanDoneMsg{node: n, token: token}
+			if v, ok := cache.Load(pathKey(path)); ok {
+				if n, ok2 := v.(*Node); ok2 && n.Scanned && !n.Pruned {
+					done = scanDoneMsg{node: n, token: token, cached: true}
 					return
 				}
 			}
 		}
 
-		// list immediate children
-		ents, err := os.ReadDir(path)
-		if err != nil {
-			n := &Node{Name: filepath.Base(path), Path: path, Err: err, Scanned: true}
-			ch <- scanDoneMsg{node: n, token: token}
-			return
-		}
-
-		// prepare children slice while launching size workers for directories
-		var wg sync.WaitGroup
-		var mu sync.Mutex
-		childs := make([]*Node, 0, len(ents))
-
-		for _, e := range ents {
-			// skip symlinks unless configured
-			if e.Type()&fs.ModeSymlink != 0 && !m.followSymlinks {
-				continue
-			}
-			childPath := filepath.Join(path, e.Name())
-			child := &Node{Name: e.Name(), Path: childPath}
-
-			if e.IsDir() {
-				// append placeholder and compute size asynchronously
-				mu.Lock()
-				childs = append(childs, child)
-				mu.Unlock()
-
-				// send an immediate placeholder update so the UI shows the directory
-				child.Size = -1 // sentinel for "scanning"
-				ch <- childUpdateMsg{parent: path, child: child, token: token}
-
-				wg.Add(1)
-				go func(nd *Node) {
-					defer wg.Done()
-					res := m.scanner.sumDir(m.ctx, nd.Path)
-					nd.Size, nd.Files, nd.Dirs, nd.Err = res.size, res.files, res.dirs, res.err
-					// send update for this child with computed totals
-					ch <- childUpdateMsg{parent: path, child: nd, token: token}
-				}(child)
-			} else {
-				fi, err := e.Info()
-				if err == nil {
-					child.Size = fi.Size()
-					child.Files = 1
-				}
-				mu.Lock()
-				childs = append(childs, child)
-				mu.Unlock()
-				// immediate update for files
-				ch <- childUpdateMsg{parent: path, child: child, token: token}
-			}
-		}
-
-		wg.Wait()
-
-		// aggregate totals
-		var total, files, dirs int64
-		var lastErr error
-		for _, c := range childs {
-			total += c.Size
-			files += c.Files
-			dirs += c.Dirs
-			if c.Err != nil {
-				lastErr = c.Err
-			}
+		n, walk := m.scanner.scan(m.ctx, path, true, func(c *Node) {
+			ch <- childUpdateMsg{parent: path, child: c, token: token}
+		})
+		if n.Scanned {
+			done = scanDoneMsg{node: n, token: token, walk: walk}
 		}
-		n := &Node{Name: filepath.Base(path), Path: path, Children: childs, Size: total, Files: files, Dirs: dirs, Err: lastErr, Scanned: true}
-		cache.Store(path, n)
-		ch <- scanDoneMsg{node: n, token: token}
 	}(useFastCache)
 
 	return scanReaderCmd(ch)
@@ -500,42 +1027,52 @@ func (m *model) setTableRowsFromNode(n *Node) {
 	// show a subtle placeholder row so the user sees the state.
 	if len(n.Children) == 0 && (!n.Scanned || m.loading) {
 		ph := lipgloss.NewStyle().Faint(true).Render(".. scanning ..")
-		rows = append(rows, table.Row{ph, "", "", "", "", ""})
+		rows = append(rows, table.Row{ph, "", "", "", "", "", ""})
 		m.tbl.SetRows(rows)
+		m.rows = nil
 		if len(rows) > 0 {
 			m.tbl.SetCursor(0)
 		}
 		return
 	}
-	// sort
-	switch m.sort {
-	case sortByName:
-		sort.Slice(n.Children, func(i, j int) bool { return strings.ToLower(n.Children[i].Name) < strings.ToLower(n.Children[j].Name) })
-	default: // size desc
-		sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Size > n.Children[j].Size })
+	if !m.loading && n.Scanned {
+		m.backup.request(m.ctx, n.Path)
 	}
+	coverage := m.backup.result(n.Path)
+	// normally a no-op: scan updates are placed in order (sorting.go)
+	m.sortChildren(n)
 	var total int64
-	// sort directories with unknown size (Size<0) to the bottom
-	sort.SliceStable(n.Children, func(i, j int) bool {
-		ai, aj := n.Children[i], n.Children[j]
-		// unknown sizes go last
-		if ai.Size < 0 && aj.Size >= 0 {
-			return false
-		}
-		if aj.Size < 0 && ai.Size >= 0 {
-			return true
-		}
-		// otherwise apply configured sort
-		if m.sort == sortByName {
-			return strings.ToLower(ai.Name) < strings.ToLower(aj.Name)
-		}
-		return ai.Size > aj.Size
-	})
-
 	for _, c := range n.Children {
 		total += c.Size
 	}
+	visible := make([]*Node, 0, len(n.Children))
+	filter := strings.ToLower(m.filter)
+	m.hiddenCount, m.hiddenSize = 0, 0
+	m.doubleCounted = 0
+	// inside a store every row would carry its tag; the header shows it once
+	_, inStore := detectStore(n.Path)
 	for _, c := range n.Children {
+		if m.hideHidden && isHidden(c) {
+			m.hiddenCount++
+			m.hiddenSize += maxInt64(c.Size, 0)
+			continue
+		}
+		if filter != "" && !strings.Contains(strings.ToLower(c.Name), filter) {
+			continue
+		}
+		visible = append(visible, c)
+	}
+	wide := false
+	for _, c := range visible {
+		if _, ok := m.sizeDeltas[pathKey(c.Path)]; ok {
+			wide = true
+		}
+	}
+	if wide != m.wideSize {
+		m.wideSize = wide
+		m.reflowColumns()
+	}
+	for _, c := range visible {
 		pct := 0.0
 		// Treat unknown sizes as zero for percent calculations
 		sz := c.Size
@@ -552,8 +1089,50 @@ func (m *model) setTableRowsFromNode(n *Node) {
 		}
 
 		displayName := fmt.Sprintf("%s %s", iconFor(c.Name, isDir), c.Name)
+		mountExcluded := false
+		if isDir {
+			if mi, ok := m.scanner.mounts.isMountPoint(c.Path); ok {
+				mountExcluded = m.scanner.excludesMount(c.Path)
+				displayName = fmt.Sprintf("%s %s  [%s]", fileIcons["mount"], c.Name, mountNote(mi, mountExcluded))
+			}
+		}
+		if st, ok := detectStore(c.Path); ok && !inStore {
+			displayName += "  [" + st.name + "]"
+		}
+		if c.Changed {
+			displayName += "  [changed during scan]"
+		}
+		if c.Truncated {
+			displayName += "  [⚠ " + truncatedNote() + "]"
+		}
+		if c.Kind != scanner.NotSpecial {
+			displayName += "  [" + c.Kind.String() + ", not counted]"
+		}
+		displayName += sampledTag(c)
+		displayName += cloudTag(c)
+		if note := m.profile.restrictedNote(c.Path); note != "" {
+			displayName += "  [" + note + "]"
+		}
+		if m.plan.index(c.Path) >= 0 {
+			displayName += "  [planned]"
+		}
+		if m.basket.index(c.Path) >= 0 {
+			displayName += "  [pinned]"
+		}
+		displayName += m.backupTag(coverage, c)
+		if c.LinkTarget != "" {
+			displayName += " → " + c.LinkTarget
+			if m.scanner.doubleCounted(c) {
+				displayName = "⚠ " + displayName
+				m.doubleCounted++
+			}
+		}
 		sizeStr := ""
-		if c.Size < 0 {
+		if c.NoAccess {
+			sizeStr = "no access"
+		} else if mountExcluded {
+			sizeStr = "excluded"
+		} else if c.Size < 0 {
 			// per-row spinner frame while scanning
 			if len(spinnerFrames) > 0 {
 				sizeStr = spinnerFrames[m.loadingFrame%len(spinnerFrames)]
@@ -561,21 +1140,50 @@ func (m *model) setTableRowsFromNode(n *Node) {
 				sizeStr = "scanning"
 			}
 		} else {
-			sizeStr = humanBytes(c.Size)
+			sizeStr = m.sizeCell(c)
+			if c.Estimated || c.Margin > 0 {
+				sizeStr = "~" + sizeStr
+			}
+		}
+		ownStr := ""
+		if !c.NoAccess && !mountExcluded && c.Size >= 0 {
+			ownStr = humanBytes(c.Exclusive)
+		}
+		filesStr, dirsStr := fmt.Sprintf("%d", c.Files), fmt.Sprintf("%d", c.Dirs)
+		if c.Size < 0 && !c.NoAccess && c.ListedFiles+c.ListedDirs > 0 {
+			// still being summed: what it holds directly, more may be below
+			filesStr, dirsStr = fmt.Sprintf("%d+", c.ListedFiles), fmt.Sprintf("%d+", c.ListedDirs)
 		}
 
-		rows = append(rows, table.Row{
+		row := table.Row{
 			displayName,
 			sizeStr,
-			fmt.Sprintf("%d", c.Files),
-			fmt.Sprintf("%d", c.Dirs),
+			ownStr,
+			filesStr,
+			dirsStr,
 			fmt.Sprintf("%5.1f%%", pct*100),
 			bar(pct, 18),
-		})
+		}
+		if m.showDisk() && len(m.tbl.Columns()) > len(row) {
+			row = append(row, diskCell(c))
+		}
+		if m.showPerms && len(m.tbl.Columns()) >= len(row)+2 {
+			row = append(row, m.permCells(c)...)
+		}
+		if m.sort == sortByScore && len(m.tbl.Columns()) > len(row) {
+			row = append(row, m.scoreCell(c))
+		}
+		// only as many analyzer cells as there are columns for; a row
+		// longer than the column set would not render
+		for _, col := range m.pluginCols[:minvalue(len(m.pluginCols), len(m.tbl.Columns())-len(row))] {
+			row = append(row, m.scanner.analyzers.value(c.Path, col))
+		}
+		rows = append(rows, row)
 	}
 	// preserve cursor position across updates to avoid jumping to top
 	prev := m.tbl.Cursor()
 	m.tbl.SetRows(rows)
+	m.rows = visible
 	if len(rows) > 0 {
 		if prev < 0 {
 			prev = 0
@@ -587,6 +1195,26 @@ func (m *model) setTableRowsFromNode(n *Node) {
 	}
 }
 
+// selected returns the node under the table cursor, or nil.
+func (m *model) selected() *Node {
+	idx := m.tbl.Cursor()
+	if idx < 0 || idx >= len(m.rows) {
+		return nil
+	}
+	return m.rows[idx]
+}
+
+// enterDir navigates into the child directory p at once, showing a
+// placeholder until its scan (or cached listing) arrives.
+func (m *model) enterDir(p string) tea.Cmd {
+	m.breadcrumbs = append(m.breadcrumbs, p)
+	m.current = &Node{Name: filepath.Base(p), Path: p, IsDir: true, Children: []*Node{}, Scanned: false}
+	m.setTableRowsFromNode(m.current)
+	m.status = fmt.Sprintf("Scanning %s ...", p)
+	m.setLoading(true)
+	return tea.Batch(m.spin.Tick, m.loadingTick(), m.startCachedScan(p))
+}
+
 func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case childUpdateMsg:
@@ -596,53 +1224,37 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		// If current is nil or different path, ensure we have a node placeholder
 		curPath := m.breadcrumbs[len(m.breadcrumbs)-1]
-		if m.current == nil || m.current.Path != curPath {
-			m.current = &Node{Name: filepath.Base(curPath), Path: curPath, Children: []*Node{}, Scanned: false}
+		if m.current == nil || !samePath(m.current.Path, curPath) {
+			m.current = &Node{Name: filepath.Base(curPath), Path: curPath, IsDir: true, Children: []*Node{}, Scanned: false}
 		}
 
-		// merge or append child
-		merged := false
-		for i, c := range m.current.Children {
-			if c.Path == msg.child.Path {
-				m.current.Children[i] = msg.child
-				merged = true
-				break
-			}
-		}
-		if !merged {
-			m.current.Children = append(m.current.Children, msg.child)
-		}
+		// merge or insert child in table order
+		m.placeChild(m.current, msg.child)
 
 		// recompute totals treating unknown sizes as zero
-		var total, files, dirs int64
-		for _, c := range m.current.Children {
-			sz := c.Size
-			if sz > 0 {
-				total += sz
-			}
-			files += c.Files
-			dirs += c.Dirs
-		}
-		m.current.Size = total
-		m.current.Files = files
-		m.current.Dirs = dirs
+		sumChildren(m.current)
 
 		// update cache partially (store current snapshot)
-		cache.Store(curPath, m.current)
+		cache.Store(pathKey(curPath), m.current)
 
 		// mark pending updates and start debounce timer if not active
 		m.pendingUpdates = true
+		m.pacer.updates++
 		if !m.debounceActive {
 			m.debounceActive = true
-			// start debounce timer (use model duration if set, else 100ms)
-			d := m.debounceDur
-			if d == 0 {
-				d = 100 * time.Millisecond
-			}
-			return m, tea.Batch(scanReaderCmd(m.scanCh), debounceCmd(d))
+			return m, tea.Batch(scanReaderCmd(m.scanCh), debounceCmd(m.pacer.debounceFor()))
 		}
 		return m, scanReaderCmd(m.scanCh)
 
+	case memCheckMsg:
+		return m, m.checkMemory()
+
+	case changeFadeMsg:
+		if m.current != nil {
+			m.setTableRowsFromNode(m.current)
+		}
+		return m, nil
+
 	case flushUpdatesMsg:
 		if m.pendingUpdates {
 			m.setTableRowsFromNode(m.current)
@@ -652,102 +1264,48 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, scanReaderCmd(m.scanCh)
 
 	case loadingTickMsg:
-		// advance per-row spinner frame
-		if len(spinnerFrames) > 0 {
+		m.pacer.running = false
+		m.pacer.ticked()
+		if !m.loading {
+			return m, nil // nothing is scanning; the next scan restarts the tick
+		}
+		// advance per-row spinner frame; frozen while paused
+		if len(spinnerFrames) > 0 && !m.scanner.gate.paused() {
 			m.loadingFrame = (m.loadingFrame + 1) % len(spinnerFrames)
 		}
 		// if no pending updates, refresh rows so spinner frames update in the table
 		if !m.pendingUpdates && m.current != nil {
 			m.setTableRowsFromNode(m.current)
 		}
-		return m, loadingTicker()
+		return m, m.loadingTick()
 	case tea.WindowSizeMsg:
 		m.width, m.height = msg.Width, msg.Height
 		m.reflowColumns()
 		// adjust table height to fill remaining space (reserve lines for header/status/footer)
-		// header ~1, status ~1, footer ~1, plus some padding
-		tableHeight := maxvalue(3, m.height-6)
+		// header ~1, status ~1, footer ~1, plus some padding; more when they wrap
+		tableHeight := maxvalue(3, m.height-m.chromeLines())
 		m.tbl.SetHeight(tableHeight)
 		return m, nil
 
+	case tea.ResumeMsg:
+		m.resumed()
+		return m, nil
+
 	case tea.KeyMsg:
-		// If a confirmation modal is open, handle modal keys first
-		if m.confirmDelete {
-			switch msg.String() {
-			case "left", "h":
-				m.confirmFocus = 0
-				return m, nil
-			case "right", "l":
-				m.confirmFocus = 1
-				return m, nil
-			case "tab":
-				m.confirmFocus = (m.confirmFocus + 1) % 2
-				return m, nil
-			case "enter":
-				if m.confirmFocus == 0 {
-					// yes: delete
-					if m.deletePath != "" {
-						ti, err := moveToTrash(m.deletePath)
-						m.confirmDelete = false
-						if err != nil {
-							m.deletePath = ""
-							m.status = "⚠ " + err.Error()
-							return m, nil
-						}
-						// append to trash history for undo/restore
-						m.trashHistory = append(m.trashHistory, ti)
-						basename := filepath.Base(m.deletePath)
-						// Remove the deleted child from the current view without doing a full rescan.
-						parent := m.breadcrumbs[len(m.breadcrumbs)-1]
-						if m.current != nil && m.current.Path == parent {
-							newChildren := make([]*Node, 0, len(m.current.Children))
-							for _, c := range m.current.Children {
-								if c.Path == m.deletePath {
-									continue
-								}
-								newChildren = append(newChildren, c)
-							}
-							m.current.Children = newChildren
-							// recompute totals
-							var total, files, dirs int64
-							for _, c := range m.current.Children {
-								if c.Size > 0 {
-									total += c.Size
-								}
-								files += c.Files
-								dirs += c.Dirs
-							}
-							m.current.Size = total
-							m.current.Files = files
-							m.current.Dirs = dirs
-							// update cache and refresh table
-							cache.Store(parent, m.current)
-							m.setTableRowsFromNode(m.current)
-							m.deletePath = ""
-							m.status = fmt.Sprintf("Deleted %s", basename)
-							return m, nil
-						}
-						// fallback: if current isn't the parent, just clear deletePath and note status
-						m.deletePath = ""
-						m.status = fmt.Sprintf("Deleted (refresh available for %s)", parent)
-						return m, nil
-					}
-				} else {
-					// no: cancel
-					m.confirmDelete = false
-					m.deletePath = ""
-					m.status = "Canceled"
-				}
-				return m, nil
-			case "esc":
-				m.confirmDelete = false
-				m.deletePath = ""
-				m.status = ""
-				return m, nil
-			default:
-				// swallow all other keys while modal is open (modal behavior)
-				return m, nil
+		// back to the shell from anywhere, dialogs and running scans included
+		if msg.String() == "ctrl+z" {
+			return m, m.suspend()
+		}
+		if m.macroKey(msg) {
+			return m, nil
+		}
+		// If a dialog has focus, route keys to it first
+		if o := m.overlays.focused(); o != nil {
+			cmd, closed := o.Update(m, msg)
+			if closed {
+				m.overlays.remove(o.opts().id)
 			}
+			return m, cmd
 		}
 
 		// While loading, allow lightweight read-only navigation (arrow keys etc.)
@@ -755,8 +1313,31 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.loading {
 			switch msg.String() {
 			case "ctrl+c", "q":
-				m.cancel()
-				return m, tea.Quit
+				return m, m.quit()
+			case "?":
+				m.overlays.push(helpOverlay{})
+				return m, nil
+			case "L":
+				m.overlays.push(newLeaderboardOverlay(m))
+				return m, nil
+			case "v":
+				m.overlays.push(newChartOverlay(m))
+				return m, nil
+			case "f":
+				m.overlays.push(newFindingsOverlay(m))
+				return m, nil
+			case "P":
+				m.togglePause()
+				return m, m.spin.Tick
+			case "a", "esc":
+				m.stopAutoDrill()
+				return m, m.spin.Tick
+			case "D":
+				m.overlays.push(&debugOverlay{})
+				return m, nil
+			case "Q":
+				m.toggleRecording()
+				return m, m.spin.Tick
 			case "up", "down", "left", "right", "pgup", "pgdown", "home", "end", "tab":
 				// forward navigation keys to the table
 				var cmd tea.Cmd
@@ -768,19 +1349,15 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+		if m.listing != nil && m.listingBlocks(msg.String()) {
+			m.status = "Not available while browsing a file list"
+			return m, nil
+		}
 		switch msg.String() {
 		case "ctrl+c", "q":
-			m.cancel()
-			return m, tea.Quit
+			return m, m.quit()
 		case "enter":
-			if m.current == nil || len(m.current.Children) == 0 {
-				return m, nil
-			}
-			idx := m.tbl.Cursor()
-			if idx < 0 || idx >= len(m.current.Children) {
-				return m, nil
-			}
-			child := m.current.Children[idx]
+			child := m.selected()
 			if child == nil {
 				return m, nil
 			}
@@ -789,106 +1366,176 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if child.Files == 1 && child.Dirs == 0 && len(child.Children) == 0 {
 				return m, nil
 			}
-			// navigate into folder immediately (show placeholder) then start scan
-			m.breadcrumbs = append(m.breadcrumbs, child.Path)
-			m.current = &Node{Name: filepath.Base(child.Path), Path: child.Path, Children: []*Node{}, Scanned: false}
-			m.setTableRowsFromNode(m.current)
-			m.status = fmt.Sprintf("Scanning %s ...", child.Path)
-			m.loading = true
-			m.loadingStartTime = time.Now()
-			return m, tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(child.Path))
+			return m, m.enterDir(child.Path)
+		case "a":
+			return m, m.autoDrill()
 		case "backspace":
 			if len(m.breadcrumbs) > 1 {
 				m.breadcrumbs = m.breadcrumbs[:len(m.breadcrumbs)-1]
 				up := m.breadcrumbs[len(m.breadcrumbs)-1]
-				m.current = &Node{Name: filepath.Base(up), Path: up, Children: []*Node{}, Scanned: false}
+				m.current = &Node{Name: filepath.Base(up), Path: up, IsDir: true, Children: []*Node{}, Scanned: false}
 				m.setTableRowsFromNode(m.current)
 				m.status = fmt.Sprintf("Scanning %s ...", up)
-				m.loading = true
-				m.loadingStartTime = time.Now()
-				return m, tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(up))
+				m.setLoading(true)
+				return m, tea.Batch(m.spin.Tick, m.loadingTick(), m.startCachedScan(up))
 			}
-		case "r":
-			// rescan current
-			cur := m.breadcrumbs[len(m.breadcrumbs)-1]
-			// drop from cache so we actually rescan
-			cache.Delete(cur)
-			m.current = &Node{Name: filepath.Base(cur), Path: cur, Children: []*Node{}, Scanned: false}
-			m.setTableRowsFromNode(m.current)
-			m.status = fmt.Sprintf("Rescanning %s ...", cur)
-			m.loading = true
-			m.loadingStartTime = time.Now()
-			return m, tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(cur))
+		case "r", "F":
+			return m, m.rescanCurrent(msg.String() == "F")
+		case "W":
+			return m, m.toggleWSLNative()
 		case "s":
-			m.sort = sortBySize
-			if m.current != nil {
-				m.setTableRowsFromNode(m.current)
-			}
+			m.setSort(sortBySize)
 			return m, nil
 		case "n":
-			m.sort = sortByName
-			if m.current != nil {
-				m.setTableRowsFromNode(m.current)
-			}
+			m.setSort(sortByName)
+			return m, nil
+		case "x":
+			m.setSort(sortByExclusive)
+			return m, nil
+		case "z":
+			m.sortByDiskSize()
+			return m, nil
+		case "c":
+			m.setSort(sortByScore)
+			m.status = "Sorted by cleanup score: size, age and kind (caches, build output, copies, temp files)"
 			return m, nil
 		case "e":
 			return m, m.exportCSV()
+		case "E":
+			m.promptExportAs()
+			return m, nil
+		case "P":
+			m.togglePause()
+			return m, nil
+		case "D":
+			m.overlays.push(&debugOverlay{})
+			return m, nil
+		case "ctrl+s":
+			return m, m.saveSession()
+		case "X":
+			if m.exportJob != nil {
+				m.overlays.push(exportProgressOverlay{})
+			} else {
+				m.overlays.push(newExportDialog(m))
+			}
+			return m, nil
+		case "g":
+			m.promptGoto()
+			return m, nil
+		case "/":
+			m.promptFilter()
+			return m, nil
+		case "R":
+			m.promptRename()
+			return m, nil
+		case "C":
+			m.promptCopy()
+			return m, nil
+		case "O":
+			m.promptOffload()
+			return m, nil
+		case "M":
+			m.togglePlanMode()
+			return m, nil
+		case "m":
+			m.overlays.push(&planOverlay{})
+			return m, nil
 		case "d":
 			// prompt delete for current selection
-			if m.current == nil || len(m.current.Children) == 0 {
+			sel := m.selected()
+			if sel == nil {
 				return m, nil
 			}
-			idx := m.tbl.Cursor()
-			if idx < 0 || idx >= len(m.current.Children) {
+			if m.planMode {
+				m.togglePlanned(sel)
 				return m, nil
 			}
-			sel := m.current.Children[idx]
-			m.confirmDelete = true
-			m.deletePath = sel.Path
-			m.status = fmt.Sprintf("Delete %s?", sel.Name)
-			return m, nil
+			return m, m.promptDelete(sel)
 		case "u":
-			// undo last delete / restore using trashHistory (LIFO)
-			if len(m.trashHistory) == 0 {
-				m.status = "Nothing to restore"
+			return m, m.undo()
+		case "ctrl+r":
+			return m, m.redo()
+		case "!":
+			return m, m.rescanElevated()
+		case "T":
+			return m, m.retryErrored()
+		case "H":
+			m.overlays.push(openAudit(false))
+			return m, nil
+		case "Q":
+			m.toggleRecording()
+			return m, nil
+		case "@":
+			if m.recording {
+				m.status = "Stop recording with Q before replaying a macro"
 				return m, nil
 			}
-			// peek last
-			ti := m.trashHistory[len(m.trashHistory)-1]
-			// check undo window
-			if m.undoWindow > 0 && time.Since(ti.DeletedAt) > m.undoWindow {
-				m.status = "Undo window expired"
-				// drop expired item from history
-				m.trashHistory = m.trashHistory[:len(m.trashHistory)-1]
-				return m, nil
+			m.overlays.push(&macroOverlay{})
+			return m, nil
+		case "A":
+			m.autoRescanAfterDelete = !m.autoRescanAfterDelete
+			if m.autoRescanAfterDelete {
+				m.status = "Rescan after delete: on"
+			} else {
+				m.status = "Rescan after delete: off"
 			}
-			if err := restoreFromTrash(ti); err != nil {
-				m.status = fmt.Sprintf("Restore failed: %v", err)
-				return m, nil
+			return m, nil
+		case "S":
+			m.overlays.push(statsOverlay{})
+			return m, nil
+		case "L":
+			m.overlays.push(newLeaderboardOverlay(m))
+			return m, nil
+		case "v":
+			m.overlays.push(newChartOverlay(m))
+			return m, nil
+		case "f":
+			m.overlays.push(newFindingsOverlay(m))
+			return m, nil
+		case "o":
+			m.toggleOwnerColumns()
+			return m, nil
+		case "b":
+			if sel := m.selected(); sel != nil {
+				m.togglePinned(sel)
 			}
-			restored := ti.OrigPath
-			// pop
-			m.trashHistory = m.trashHistory[:len(m.trashHistory)-1]
-			m.status = fmt.Sprintf("Restored %s", filepath.Base(restored))
-			// if current view is the parent of restored item, rescan it to show restored entry
+			return m, nil
+		case "B":
+			m.overlays.push(&basketOverlay{})
+			return m, nil
+		case "I":
+			m.ignoreSelected()
+			return m, nil
+		case "ctrl+u":
+			m.unignoreAll()
+			return m, nil
+		case ".":
+			m.hideHidden = !m.hideHidden
 			if m.current != nil {
-				parent := m.current.Path
-				if filepath.Dir(restored) == parent {
-					cache.Delete(parent)
-					m.status += " — refreshing view"
-					m.loading = true
-					return m, tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(parent))
-				}
+				m.setTableRowsFromNode(m.current)
+			}
+			if m.hideHidden {
+				m.status = "Hidden entries: hidden (" + hiddenSummary(m.hiddenCount, m.hiddenSize) + ")"
+			} else {
+				m.status = "Hidden entries: shown"
 			}
 			return m, nil
-		case "c", "esc":
-			// cancel delete
-			if m.confirmDelete {
-				m.confirmDelete = false
-				m.deletePath = ""
-				m.status = "Canceled"
+		case "p":
+			m.showPreview = !m.showPreview
+			m.preview = nil
+			m.reflowColumns()
+			return m, nil
+		case "i":
+			if sel := m.selected(); sel != nil {
+				m.overlays.push(newDetailsOverlay(m, sel))
 			}
 			return m, nil
+		case "?":
+			m.overlays.push(helpOverlay{})
+			return m, nil
+		}
+		if c, ok := m.userCommands[msg.String()]; ok {
+			return m, m.runUserCommand(c)
 		}
 		// forward other key messages (arrow keys, page up/down) to the table for navigation
 		var cmd tea.Cmd
@@ -898,26 +1545,30 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case scanDoneMsg:
 		// Ignore completion from stale scans; keep loading state
 		if msg.token != m.scanToken {
-			cache.Store(msg.node.Path, msg.node)
+			cache.Store(pathKey(msg.node.Path), msg.node)
 			return m, nil
 		}
 		// Only apply the completed scan to the UI if it matches the current breadcrumb path.
 		cur := m.breadcrumbs[len(m.breadcrumbs)-1]
-		if msg.node.Path == cur {
+		if samePath(msg.node.Path, cur) {
 			m.current = msg.node
+			m.backup.forget(msg.node.Path)
+			fade := m.applySizeChanges(msg.node)
 
-			// Always enforce minimum display time to prevent flicker
+			// Enforce a minimum display time to prevent flicker, unless
+			// the result came from the cache or so quickly that the
+			// overlay never got to show
 			elapsed := time.Since(m.loadingStartTime)
-			if elapsed < m.loadingMinDuration {
+			if !msg.cached && elapsed >= m.loadingQuick && elapsed < m.loadingMinDuration {
 				// Delay clearing the loading state - store the completed scan but keep loading
 				remaining := m.loadingMinDuration - elapsed
-				return m, tea.Tick(remaining, func(t time.Time) tea.Msg {
+				return m, tea.Batch(fade, tea.Tick(remaining, func(t time.Time) tea.Msg {
 					// Create a special completion message that bypasses the minimum time check
 					return struct {
 						scanDoneMsg
 						forceComplete bool
-					}{scanDoneMsg: scanDoneMsg{node: msg.node, token: msg.token}, forceComplete: true}
-				})
+					}{scanDoneMsg: msg, forceComplete: true}
+				}))
 			}
 
 			// Only clear loading state if no other scans are ongoing
@@ -927,21 +1578,28 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.ongoingScansMu.Unlock()
 
 			if ongoing <= 1 && !scanInProgress {
-				m.loading = false
+				m.setLoading(false)
 				if msg.node.Err != nil {
 					m.status = "⚠ " + msg.node.Err.Error()
 				} else {
-					m.status = fmt.Sprintf("%s — %s (%d files, %d dirs)", msg.node.Path, humanBytes(msg.node.Size), msg.node.Files, msg.node.Dirs)
+					m.status = scanSummary(msg)
 				}
 			} else {
 				// Keep loading state and show debug info
 				m.status = fmt.Sprintf("Scanning... (ongoing: %d, inProgress: %v)", ongoing, scanInProgress)
 			}
 			m.setTableRowsFromNode(msg.node)
-			return m, nil
+			if m.autoDrilling && !m.loading {
+				return m, tea.Batch(fade, m.publishScan(msg.node), m.autoDrill())
+			}
+			if !m.loading {
+				m.offerUAC(msg.node)
+				return m, tea.Batch(fade, m.publishScan(msg.node))
+			}
+			return m, fade
 		}
 		// otherwise cache the result for later; don't clear loading (it may be for another view)
-		cache.Store(msg.node.Path, msg.node)
+		cache.Store(pathKey(msg.node.Path), msg.node)
 		return m, nil
 
 	case struct {
@@ -951,7 +1609,7 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Handle forced completion after minimum display time
 		if msg.forceComplete && msg.token == m.scanToken {
 			cur := m.breadcrumbs[len(m.breadcrumbs)-1]
-			if msg.node.Path == cur && m.current != nil {
+			if samePath(msg.node.Path, cur) && m.current != nil {
 				// Only clear loading state if no other scans are ongoing
 				m.ongoingScansMu.Lock()
 				ongoing := m.ongoingScans
@@ -959,32 +1617,141 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.ongoingScansMu.Unlock()
 
 				if ongoing <= 1 && !scanInProgress {
-					m.loading = false
+					m.setLoading(false)
 					if msg.node.Err != nil {
 						m.status = "⚠ " + msg.node.Err.Error()
 					} else {
-						m.status = fmt.Sprintf("%s — %s (%d files, %d dirs)", msg.node.Path, humanBytes(msg.node.Size), msg.node.Files, msg.node.Dirs)
+						m.status = scanSummary(msg.scanDoneMsg)
 					}
 				} else {
 					// Keep loading state and show debug info
 					m.status = fmt.Sprintf("Scanning... (ongoing: %d, inProgress: %v)", ongoing, scanInProgress)
 				}
 				m.setTableRowsFromNode(msg.node)
+				if m.autoDrilling && !m.loading {
+					return m, tea.Batch(m.publishScan(msg.node), m.autoDrill())
+				}
+				if !m.loading {
+					m.offerUAC(msg.node)
+					return m, m.publishScan(msg.node)
+				}
 				return m, nil
 			}
 		}
 		return m, nil
 
+	case exportProgressMsg:
+		if job := m.exportJob; job != nil {
+			if !m.overlays.has("export-progress") {
+				m.status = fmt.Sprintf("Exporting %s ... %d rows (X to show)", job.path, job.rows.Load())
+			}
+			return m, exportProgressTick()
+		}
+		return m, nil
+
+	case deepExportDoneMsg:
+		return m, m.finishDeepExport(msg)
+
+	case copyProgressMsg:
+		if job := m.copyJob; job != nil {
+			if !m.overlays.has("copy-progress") {
+				m.status = "Copying " + job.src + " ... " + job.progress() + " (C to show)"
+			}
+			return m, copyProgressTick()
+		}
+		return m, nil
+
+	case copyDoneMsg:
+		return m, m.finishCopy(msg)
+
+	case offloadProgressMsg:
+		if job := m.offloadJob; job != nil {
+			if !m.overlays.has("offload-progress") {
+				m.status = fmt.Sprintf("Offloading %s to %s ... %s (O to show)", job.node.Name, job.target.Name, job.out.last())
+			}
+			return m, offloadProgressTick()
+		}
+		return m, nil
+
+	case offloadDoneMsg:
+		return m, m.finishOffload(msg)
+
+	case exportDoneMsg:
+		if msg.err != nil {
+			m.status = "⚠ export failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.status = "Exported the current view to " + msg.path
+		return m, m.showExportToast(msg.path, "the current view")
+
+	case toastExpiredMsg:
+		if o, ok := m.overlays.get("export-toast").(*exportToast); ok && o.seq == msg.seq {
+			m.overlays.remove("export-toast")
+		}
+		return m, nil
+
+	case elevatedDoneMsg:
+		m.applyElevated(msg)
+		return m, nil
+
+	case uacDoneMsg:
+		m.applyUAC(msg)
+		return m, nil
+
+	case attachPollMsg:
+		return m, m.pollAttach()
+
+	case recordsPublishedMsg:
+		m.applyPublished(msg)
+		return m, nil
+
+	case claimBeatMsg:
+		return m, m.beatClaim()
+
+	case retryDoneMsg:
+		return m, m.applyRetry(msg)
+
+	case macroStepMsg:
+		return m, m.stepMacro(msg.run)
+
+	case elevatedTrashMsg:
+		return m, m.applyElevatedTrash(msg)
+
+	case analyzersMsg:
+		return m, m.applyAnalyzers()
+	case backupMsg:
+		if m.current != nil {
+			m.setTableRowsFromNode(m.current)
+		}
+		return m, m.backup.wait()
+	case commandDoneMsg:
+		return m, m.applyCommandDone(msg)
+	case commandTickMsg:
+		if o, ok := m.overlays.get("command").(*commandOverlay); ok && o.running {
+			return m, commandTick()
+		}
+		return m, nil
+	case storeDoneMsg:
+		return m, m.applyStoreDone(msg)
+
+	case trashEmptiedMsg:
+		if msg.err != nil {
+			m.status = "⚠ could not empty the trash: " + msg.err.Error() + " — press q again to quit"
+			m.trashOnExit = "keep"
+			return m, nil
+		}
+		return m, tea.Quit
+
 	case errMsg:
-		m.loading = false
+		m.setLoading(false)
 		m.status = "⚠ " + msg.err.Error()
 		return m, nil
 
 	case rescanMsg:
 		cur := m.breadcrumbs[len(m.breadcrumbs)-1]
 		m.status = fmt.Sprintf("Rescanning %s ...", cur)
-		m.loading = true
-		return m, tea.Batch(m.spin.Tick, loadingTicker(), m.startIncrementalScan(cur))
+		m.setLoading(true)
+		return m, tea.Batch(m.spin.Tick, m.loadingTick(), m.startIncrementalScan(cur))
 
 	default:
 		// spinner & table updates
@@ -994,6 +1761,334 @@ func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// promptDelete opens the dialog that deletes n: the store's own tooling,
+// the protection prompt or the confirmation the policy asks for (confirm.go),
+// which may be none.
+func (m *model) promptDelete(n *Node) tea.Cmd {
+	if st, ok := detectStore(n.Path); ok {
+		// offer the store's own tooling before raw deletion
+		m.overlays.push(newStoreOverlay(st, n))
+		return nil
+	}
+	if rule, ok := m.protect.match(n.Path); ok {
+		m.promptProtectedDelete(n, rule)
+		return nil
+	}
+	if locked := lockingFlags(n.Path); len(locked) > 0 {
+		m.status = fmt.Sprintf("⚠ %s has the %s flag and can't be moved; clear it with chflags no%s first", n.Name, strings.Join(locked, ", "), locked[0])
+		return nil
+	}
+	return m.confirmDelete(n)
+}
+
+// deleteToTrash moves path to the trash and records it in the journal so
+// it can be undone.
+func (m *model) deleteToTrash(path string) tea.Cmd {
+	ti, cmd, err := m.trashPath(path)
+	if err != nil {
+		audit("trash", path, "", 0, err)
+	}
+	var full *trashFullError
+	if errors.As(err, &full) {
+		// found out only now, for an item whose size wasn't known yet
+		m.status = "⚠ " + err.Error()
+		m.overlays.push(newConfirmPermanent(path, full.free, full.need))
+		return nil
+	}
+	if hint := permissionHint(path, err); hint != "" {
+		m.status = "⚠ permission denied: " + hint
+		if _, elevErr := elevatorCommand(); elevErr == nil {
+			m.overlays.push(newElevatedDelete(path, hint))
+		}
+		return nil
+	}
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	m.journal.record(&journalOp{Kind: opTrash, Trash: ti})
+	return cmd
+}
+
+// trashPath moves path to the trash and removes it from the cached tree
+// (current view and every cached ancestor) without doing a full rescan.
+func (m *model) trashPath(path string) (*TrashItem, tea.Cmd, error) {
+	ti, err := moveToTrash(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ti, m.trashed(path, ti), nil
+}
+
+// trashed takes path, now in the trash as ti, out of the cached tree and
+// counts it for the session.
+func (m *model) trashed(path string, ti *TrashItem) tea.Cmd {
+	parent := filepath.Dir(path)
+	if node := m.cachedChild(path); node != nil {
+		ti.Size, ti.Files, ti.Dirs, ti.Disk, ti.Cloud = maxInt64(node.Size, 0), node.Files, node.Dirs, node.Disk, node.Cloud
+		_ = writeTrashMeta(ti.TrashPath, *ti)
+	}
+	m.sessionTrash = append(m.sessionTrash, ti)
+	m.freed.trashed(ti)
+	audit("trash", path, "", trashedSize(ti), nil)
+
+	invalidateSums(path)
+	m.removeChild(parent, path)
+	propagateDelta(parent, trashDelta(ti).negate())
+	m.status = fmt.Sprintf("Deleted %s", filepath.Base(path)) + m.dedupTrashed(ti)
+	if m.autoRescanAfterDelete {
+		// the parent is rescanned from disk, so drop the patched-up copy
+		cache.Delete(pathKey(parent))
+		if m.current != nil && samePath(m.current.Path, parent) {
+			m.status += " — rescanning"
+			m.setLoading(true)
+			return tea.Batch(m.spin.Tick, m.loadingTick(), m.startIncrementalScan(parent))
+		}
+		return nil
+	}
+	if m.current != nil && samePath(m.current.Path, parent) {
+		m.setTableRowsFromNode(m.current)
+	}
+	return nil
+}
+
+// cachedChild is path's entry in the cached listing of its parent, if any.
+func (m *model) cachedChild(path string) *Node {
+	if pn := m.cachedOrCurrent(filepath.Dir(path)); pn != nil {
+		for _, c := range pn.Children {
+			if samePath(c.Path, path) {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// deletePermanently removes path outright, for a delete the trash has no
+// room for. Nothing can bring it back, so it isn't journaled.
+func (m *model) deletePermanently(path string) tea.Cmd {
+	parent := filepath.Dir(path)
+	node := m.cachedChild(path)
+	err := os.RemoveAll(path)
+	invalidateSums(path)
+	var size int64
+	if node != nil {
+		size = node.Size
+	}
+	audit("delete", path, "", size, err)
+	if err != nil {
+		// some of it may be gone; the parent's listing is stale either way
+		m.status = "⚠ " + err.Error()
+		cache.Delete(pathKey(parent))
+		forgetCachedSubtree(path)
+		if !m.loading && m.current != nil && samePath(m.current.Path, parent) {
+			status := m.status
+			cmd := m.rescanCurrent(false)
+			m.status = status
+			return cmd
+		}
+		return nil
+	}
+	m.removeChild(parent, path)
+	if node != nil {
+		propagateDelta(parent, trashDelta(&TrashItem{IsDir: node.IsDir, Size: maxInt64(node.Size, 0), Files: node.Files, Dirs: node.Dirs, Disk: node.Disk, Cloud: node.Cloud}).negate())
+		m.freed.removed(node.Size)
+	}
+	if m.current != nil && samePath(m.current.Path, parent) {
+		m.setTableRowsFromNode(m.current)
+	}
+	m.status = fmt.Sprintf("Deleted %s permanently", filepath.Base(path))
+	return nil
+}
+
+// restoreTrashed moves ti back out of the trash and adds it back to the
+// cached tree. If its original path is taken, it is restored next to it
+// and ti.OrigPath is updated to where it went.
+func (m *model) restoreTrashed(ti *TrashItem) error {
+	size := trashedSize(ti)
+	restored, err := restoreFromTrashTo(ti)
+	audit("restore", ti.OrigPath, restored, size, err)
+	if err != nil {
+		return err
+	}
+	m.restoredFreed(ti, size)
+	ti.OrigPath = restored
+
+	parent := filepath.Dir(restored)
+	invalidateSums(restored)
+	m.addChild(parent, &Node{Name: filepath.Base(restored), Path: restored, IsDir: ti.IsDir, Size: ti.Size, Files: ti.Files, Dirs: ti.Dirs, Disk: ti.Disk, Cloud: ti.Cloud})
+	propagateDelta(parent, trashDelta(ti))
+	if m.current != nil && samePath(m.current.Path, parent) {
+		m.setTableRowsFromNode(m.current)
+	}
+	return nil
+}
+
+// cachedOrCurrent returns the node for dir, preferring the current view.
+func (m *model) cachedOrCurrent(dir string) *Node {
+	if m.current != nil && samePath(m.current.Path, dir) {
+		return m.current
+	}
+	if v, ok := cache.Load(pathKey(dir)); ok {
+		return v.(*Node)
+	}
+	return nil
+}
+
+// removeChild drops path from the children of dir (current view and cache)
+// and recomputes dir's totals.
+func (m *model) removeChild(dir, path string) {
+	m.backup.forget(dir)
+	m.eachCopy(dir, func(n *Node) {
+		kept := make([]*Node, 0, len(n.Children))
+		for _, c := range n.Children {
+			if !samePath(c.Path, path) {
+				kept = append(kept, c)
+			}
+		}
+		n.Children = kept
+		sumChildren(n)
+	})
+}
+
+// addChild inserts child into dir (current view and cache), replacing an
+// entry with the same path, and recomputes dir's totals.
+func (m *model) addChild(dir string, child *Node) {
+	m.backup.forget(dir)
+	m.eachCopy(dir, func(n *Node) {
+		for i, c := range n.Children {
+			if samePath(c.Path, child.Path) {
+				n.Children[i] = child
+				sumChildren(n)
+				return
+			}
+		}
+		n.Children = append(n.Children, child)
+		sumChildren(n)
+	})
+}
+
+// eachCopy calls fn for the current view and the cached node of dir,
+// visiting a shared node only once.
+func (m *model) eachCopy(dir string, fn func(*Node)) {
+	var seen *Node
+	if m.current != nil && samePath(m.current.Path, dir) {
+		fn(m.current)
+		seen = m.current
+	}
+	if v, ok := cache.Load(pathKey(dir)); ok {
+		if n := v.(*Node); n.Pruned {
+			// totals can't be recomputed without children; rescan on visit
+			cache.Delete(pathKey(dir))
+		} else if n != seen {
+			fn(n)
+		}
+	}
+}
+
+// sumChildren recomputes n's totals from its immediate children, treating
+// unknown sizes as zero.
+func sumChildren(n *Node) {
+	var total, files, dirs, exclusive, disk, cloud int64
+	for _, c := range n.Children {
+		disk += c.Disk
+		cloud += c.Cloud
+		if c.Size > 0 {
+			total += c.Size
+			if !c.IsDir {
+				exclusive += c.Size
+			}
+		}
+		files += c.Files
+		dirs += c.Dirs
+	}
+	n.Size, n.Files, n.Dirs, n.Exclusive, n.Disk, n.Cloud = total, files, dirs, exclusive, disk, cloud
+}
+
+// nodeDelta is the change in subtree totals caused by adding or removing an entry.
+type nodeDelta struct {
+	size, files, dirs, disk, cloud int64
+	// exclusive changes only the directory that directly holds the entry
+	exclusive int64
+}
+
+func (d nodeDelta) negate() nodeDelta {
+	return nodeDelta{size: -d.size, files: -d.files, dirs: -d.dirs, disk: -d.disk, cloud: -d.cloud, exclusive: -d.exclusive}
+}
+
+// trashDelta is what a trashed item contributes to the totals of the
+// directories above its parent. The item itself counts as a directory there.
+func trashDelta(ti *TrashItem) nodeDelta {
+	d := nodeDelta{size: ti.Size, files: ti.Files, dirs: ti.Dirs, disk: ti.Disk, cloud: ti.Cloud}
+	if ti.IsDir {
+		d.dirs++
+	} else {
+		d.exclusive = ti.Size
+	}
+	return d
+}
+
+// propagateDelta applies d to every cached ancestor above dir, including the
+// entry that represents the chain in each ancestor's children. dir itself is
+// excluded because callers recompute it from its children.
+func propagateDelta(dir string, d nodeDelta) {
+	child := dir
+	for {
+		parent := filepath.Dir(child)
+		if parent == child {
+			return
+		}
+		if v, ok := cache.Load(pathKey(parent)); ok {
+			pn := v.(*Node)
+			applyDelta(pn, nodeDelta{size: d.size, files: d.files, dirs: d.dirs, disk: d.disk, cloud: d.cloud})
+			for _, c := range pn.Children {
+				if samePath(c.Path, child) {
+					applyDelta(c, d)
+				}
+			}
+		}
+		// only dir's own entry holds the item directly
+		d.exclusive = 0
+		child = parent
+	}
+}
+
+func applyDelta(n *Node, d nodeDelta) {
+	if n.Size >= 0 {
+		n.Size = maxInt64(0, n.Size+d.size)
+	}
+	n.Exclusive = maxInt64(0, n.Exclusive+d.exclusive)
+	n.Files = maxInt64(0, n.Files+d.files)
+	n.Dirs = maxInt64(0, n.Dirs+d.dirs)
+	n.Disk = maxInt64(0, n.Disk+d.disk)
+	n.Cloud = maxInt64(0, n.Cloud+d.cloud)
+}
+
+// exclusiveBefore orders by exclusive size, then cumulative size, descending.
+func exclusiveBefore(a, b *Node) bool {
+	if a.Exclusive != b.Exclusive {
+		return a.Exclusive > b.Exclusive
+	}
+	return a.Size > b.Size
+}
+
+// scanSummary is the status line shown when a scan completes. Incremental
+// rescans also report how much of the tree had to be walked again.
+func scanSummary(msg scanDoneMsg) string {
+	n := msg.node
+	st := fmt.Sprintf("%s — %s (%d files, %d dirs)", n.Path, humanBytes(n.Size), n.Files, n.Dirs)
+	if msg.cached {
+		return st + " — as last scanned, r rescans"
+	}
+	if w := msg.walk; w.dirs > 0 && w.rewalked < w.dirs {
+		st += fmt.Sprintf(" — re-scanned %.0f%% of tree", w.percent())
+		if w.changed > 0 {
+			st += fmt.Sprintf(", %d dirs changed", w.changed)
+		}
+	}
+	return st
+}
+
 func (m *model) reflowColumns() {
 	if m.width <= 0 {
 		return
@@ -1001,182 +2096,237 @@ func (m *model) reflowColumns() {
 	// Dedicate space: keep numeric columns readable, expand Name & Graph
 	// Increase Dirs minInts width so larger directory counts aren't truncated,
 	// and slightly reduce the Name minimum to make room on narrower terminals.
-	minInts := []int{8, 10, 6, 8, 12, 10} // Name unused index 0, Size=10, Files=6, Dirs=8, %parent=12, Graph=10
+	minInts := []int{8, 10, 10, 6, 8, 12, 10} // Name unused index 0, Size=10, Own=10, Files=6, Dirs=8, %parent=12, Graph=10
+	if m.wideSize {
+		minInts[1] = 22 // room for "▲ 12.3 GB (+1.1 GB)"
+	}
 	// Reserve more space for table formatting (borders, separators, padding)
 	// Bubble Tea table adds separators between columns and may have borders
-	avail := m.width - 10  // more conservative padding for table formatting
+	avail := m.width - m.previewWidth() - 10  // more conservative padding for table formatting
+	// disk, owner and mode, score, then analyzer columns go last; the compact
+	// layout has no room for them
+	plugin := append(append(m.diskColumns(), m.permColumns()...), m.scoreColumns()...)
+	for _, c := range plugin {
+		avail -= c.Width + 2
+	}
+	for _, c := range m.pluginCols {
+		w := 12
+		if m.narrow() {
+			w = 0
+		}
+		plugin = append(plugin, table.Column{Title: c, Width: w})
+		avail -= w + 2
+	}
+	if m.narrow() {
+		m.tbl.SetColumns(append(m.compactColumns(avail), plugin...))
+		return
+	}
 
 	// Base widths
-	nameW := maxvalue(20, avail-(minInts[1]+minInts[2]+minInts[3]+minInts[4]+minInts[5]))
-	graphW := maxvalue(12, minInts[5]+(avail-(nameW+minInts[1]+minInts[2]+minInts[3]+minInts[4]+minInts[5])))
+	fixed := minInts[1] + minInts[2] + minInts[3] + minInts[4] + minInts[5] + minInts[6]
+	nameW := maxvalue(20, avail-fixed)
+	graphW := maxvalue(12, minInts[6]+(avail-(nameW+fixed)))
 
 	cols := []table.Column{
 		{Title: "Name", Width: nameW},
 		{Title: "Size", Width: minInts[1]},
-		{Title: "Files", Width: minInts[2]},
-		{Title: "Dirs", Width: minInts[3]},
-		{Title: "% of Parent", Width: minInts[4]},
+		{Title: "Own", Width: minInts[2]},
+		{Title: "Files", Width: minInts[3]},
+		{Title: "Dirs", Width: minInts[4]},
+		{Title: "% of Parent", Width: minInts[5]},
 		{Title: "Graph", Width: graphW},
 	}
-	m.tbl.SetColumns(cols)
+	m.tbl.SetColumns(append(cols, plugin...))
+}
+
+// rescanCurrent rescans the current directory; full also discards
+// fingerprinted subtree sums.
+func (m *model) rescanCurrent(full bool) tea.Cmd {
+	cur := m.breadcrumbs[len(m.breadcrumbs)-1]
+	// drop from cache so we actually rescan
+	cache.Delete(pathKey(cur))
+	if full {
+		forgetSums(cur)
+	}
+	if m.current != nil && samePath(m.current.Path, cur) {
+		m.rememberSizes(m.current)
+	}
+	m.current = &Node{Name: filepath.Base(cur), Path: cur, IsDir: true, Children: []*Node{}, Scanned: false}
+	m.setTableRowsFromNode(m.current)
+	m.status = fmt.Sprintf("Rescanning %s ...", cur)
+	m.setLoading(true)
+	return tea.Batch(m.spin.Tick, m.loadingTick(), m.startIncrementalScan(cur))
 }
 
 func (m *model) View() string {
-	head := lipgloss.NewStyle().Bold(true).Render("DiskTree TUI — " + m.breadcrumb())
-	status := m.status
-	if m.loading {
-		status = m.spin.View() + " " + status
-	}
-	foot := lipgloss.NewStyle().Faint(true).Render("↑/↓ move  Enter open  Backspace up  s=size  n=name  r=rescan  e=export CSV  d=delete  u=undo  q=quit")
-	
-	// Helper function to build body content
-	buildBody := func(useNoSelectionTable bool) string {
-		var tableView string
-		if useNoSelectionTable {
-			// Temporarily disable selection highlighting for background rendering
-			m.tbl.SetStyles(tableStylesNoSelection())
-			tableView = m.tbl.View()
-			m.tbl.SetStyles(tableStyles()) // Restore original styles
-		} else {
-			tableView = m.tbl.View()
-		}
-		
-		return lipgloss.JoinVertical(lipgloss.Left,
-			head,
-			tableView,
-			status,
-			foot,
-		)
-	}
-
-	if m.confirmDelete {
-		// Build the modal popup — width clamped to terminal to avoid wrap/clipping
-		popupW := 60
-		if m.width > 0 {
-			popupW = minvalue(popupW, maxvalue(10, m.width-4))
-		}
-		modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(popupW).Align(lipgloss.Center).Background(lipgloss.Color("0"))
-		// buttons
-		btnYes := lipgloss.NewStyle().Padding(0, 2)
-		btnNo := lipgloss.NewStyle().Padding(0, 2)
-		if m.confirmFocus == 0 {
-			btnYes = btnYes.Background(lipgloss.Color("2")).Foreground(lipgloss.Color("0"))
-		} else {
-			btnNo = btnNo.Background(lipgloss.Color("2")).Foreground(lipgloss.Color("0"))
-		}
-		yes := btnYes.Render(" Yes ")
-		no := btnNo.Render(" No ")
-		content := lipgloss.JoinHorizontal(lipgloss.Center, m.status)
-		footer := lipgloss.JoinHorizontal(lipgloss.Center, yes, " ", no)
-		popup := modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, content, "", footer))
-
-		// Use body without selection highlighting for background
-		body := buildBody(true)
-
-		// If we don't yet know terminal size, fall back to simple body+popup
-		if m.width == 0 || m.height == 0 {
-			// Use conservative defaults to render a true overlay even before WindowSize
-			ow, oh := m.width, m.height
-			if ow <= 0 {
-				if c := os.Getenv("COLUMNS"); c != "" {
-					if v, err := strconv.Atoi(c); err == nil {
-						ow = v
-					}
-				}
-				if ow <= 0 {
-					ow = 80
-				}
-			}
-			if oh <= 0 {
-				if l := os.Getenv("LINES"); l != "" {
-					if v, err := strconv.Atoi(l); err == nil {
-						oh = v
-					}
-				}
-				if oh <= 0 {
-					oh = 24
-				}
-			}
-			return renderOverlay(body, popup, ow, oh)
-		}
-		return renderOverlay(body, popup, m.width, m.height)
-	}
-
-	// show a centered loading overlay while scanning
-	if m.loading {
-		popupW := 50
-		if m.width > 0 {
-			popupW = minvalue(popupW, maxvalue(10, m.width-4))
-		}
-		modalStyle := lipgloss.NewStyle().Border(lipgloss.NormalBorder()).Padding(1, 2).Width(popupW).Align(lipgloss.Center).Background(lipgloss.Color("0"))
-		content := lipgloss.JoinHorizontal(lipgloss.Center, m.spin.View(), " ", m.status)
-		popup := modalStyle.Render(content)
-		
-		// Use body without selection highlighting for background
-		body := buildBody(true)
-		
-		if m.width == 0 || m.height == 0 {
-			// Use conservative defaults to render a true overlay even before WindowSize
-			ow, oh := m.width, m.height
-			if ow <= 0 {
-				if c := os.Getenv("COLUMNS"); c != "" {
-					if v, err := strconv.Atoi(c); err == nil {
-						ow = v
-					}
-				}
-				if ow <= 0 {
-					ow = 80
-				}
-			}
-			if oh <= 0 {
-				if l := os.Getenv("LINES"); l != "" {
-					if v, err := strconv.Atoi(l); err == nil {
-						oh = v
-					}
-				}
-				if oh <= 0 {
-					oh = 24
-				}
-			}
-			return renderOverlay(body, popup, ow, oh)
+	title := "DiskTree TUI — " + m.breadcrumb()
+	if m.narrow() {
+		title = m.breadcrumb()
+	}
+	if m.filter != "" {
+		title += fmt.Sprintf("  [filter: %s]", m.filter)
+	}
+	if m.listing != nil {
+		title += "  " + m.listing.tag()
+	}
+	if m.loading && !m.loadingOverlay {
+		title += "  " + m.loadingBadge()
+	}
+	if m.scanner.allocated {
+		title += "  [allocated size]"
+	}
+	if m.scanner.xattrs {
+		title += "  [+xattrs]"
+	}
+	if m.scanner.exclude != nil {
+		title += "  [excluding files " + m.scanner.exclude.describe() + "]"
+	}
+	if tag := m.ignoreTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.wslTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.scanAsTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.serverTag(); tag != "" {
+		title += "  " + tag
+	}
+	if m.autoRescanAfterDelete {
+		title += "  [rescan after delete]"
+	}
+	if tag := m.basketTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.planTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.backupHeader(); tag != "" {
+		title += "  " + tag
+	}
+	if m.hideHidden && m.hiddenCount > 0 {
+		title += "  [" + hiddenSummary(m.hiddenCount, m.hiddenSize) + "]"
+	}
+	if m.doubleCounted > 0 {
+		title += fmt.Sprintf("  [⚠ %d double-counted links]", m.doubleCounted)
+	}
+	if m.current != nil && m.current.Changed {
+		title += "  [changed during scan: r to rescan]"
+	}
+	if m.current != nil && m.current.Truncated {
+		title += "  [⚠ " + truncatedNote() + ": see -max-depth]"
+	}
+	if tag := m.budgetTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.samplingTag(); tag != "" {
+		title += "  " + tag
+	}
+	if tag := m.macroTag(); tag != "" {
+		title += "  " + tag
+	}
+	if m.current != nil {
+		if n := m.scanner.analyzers.findingsUnder(m.current.Path); n > 0 {
+			title += fmt.Sprintf("  [%d findings: f]", n)
+		}
+	}
+	if m.current != nil {
+		if st, ok := detectStore(m.current.Path); ok {
+			title += "  [" + st.name + ": d for reclaim options]"
 		}
-		return renderOverlay(body, popup, m.width, m.height)
 	}
+	if m.narrow() {
+		title = truncateToWidth(title, m.width)
+	}
+	head := lipgloss.NewStyle().Bold(true).Render(title)
+	status := m.status
+	if m.loading || m.scanner.gate.paused() {
+		status = m.busyIndicator() + " " + status
+	}
+	status = m.statusView(status)
+	foot := lipgloss.NewStyle().Faint(true).Render(strings.Join(m.footLines(), "\n"))
+
+	// Disable selection highlighting while the table is the background of a dialog
+	var tableView string
+	if !m.overlays.empty() {
+		m.tbl.SetStyles(tableStylesNoSelection())
+		tableView = m.tbl.View()
+		m.tbl.SetStyles(tableStyles()) // Restore original styles
+	} else {
+		tableView = m.tbl.View()
+	}
+	// the table has a minimum width; the pane takes what is left of its share
+	if pw := minvalue(m.previewWidth(), m.width-lipgloss.Width(tableView)); pw >= minPreviewWidth {
+		tableView = lipgloss.JoinHorizontal(lipgloss.Top, tableView, m.previewPane(pw, lipgloss.Height(tableView)))
+	}
+	summary := lipgloss.NewStyle().Faint(true).Render(m.summaryLine())
+	body := lipgloss.JoinVertical(lipgloss.Left,
+		head,
+		summary,
+		tableView,
+		status,
+		foot,
+	)
+
 	// Always return a fixed-size base screen to prevent layout shifts
-	{
-		ow, oh := m.width, m.height
-		if ow <= 0 {
-			if c := os.Getenv("COLUMNS"); c != "" {
-				if v, err := strconv.Atoi(c); err == nil {
-					ow = v
-				}
+	ow, oh := m.screenSize()
+	base := lipgloss.Place(maxvalue(1, ow), maxvalue(1, oh), lipgloss.Left, lipgloss.Top, body, lipgloss.WithWhitespaceChars(" "), lipgloss.WithWhitespaceForeground(lipgloss.Color("0")))
+	if m.overlays.empty() {
+		return m.graphicsFrame(base)
+	}
+	return m.graphicsFrame(m.overlays.compose(m, base, ow, oh))
+}
+
+// screenSize returns the terminal size, using conservative defaults (or
+// COLUMNS/LINES) before the first WindowSizeMsg arrives.
+func (m *model) screenSize() (int, int) {
+	ow, oh := m.width, m.height
+	if ow <= 0 {
+		if c := os.Getenv("COLUMNS"); c != "" {
+			if v, err := strconv.Atoi(c); err == nil {
+				ow = v
 			}
-			if ow <= 0 {
-				ow = 80
+		}
+		if ow <= 0 {
+			ow = 80
+		}
+	}
+	if oh <= 0 {
+		if l := os.Getenv("LINES"); l != "" {
+			if v, err := strconv.Atoi(l); err == nil {
+				oh = v
 			}
 		}
 		if oh <= 0 {
-			if l := os.Getenv("LINES"); l != "" {
-				if v, err := strconv.Atoi(l); err == nil {
-					oh = v
-				}
-			}
-			if oh <= 0 {
-				oh = 24
-			}
+			oh = 24
 		}
-		
-		// Use normal table with selection highlighting for regular view
-		body := buildBody(false)
-		base := lipgloss.Place(maxvalue(1, ow), maxvalue(1, oh), lipgloss.Left, lipgloss.Top, body, lipgloss.WithWhitespaceChars(" "), lipgloss.WithWhitespaceForeground(lipgloss.Color("0")))
-		return base
 	}
+	return ow, oh
 }
 
 // renderOverlay composes an overlay popup centered over a full-screen renderings
 // of base content, without shifting the layout. It returns a string with exactly
 // height lines and width columns (padded as needed).
 func renderOverlay(base, popup string, width, height int) string {
+	return renderOverlayAt(base, popup, width, height, centered)
+}
+
+// placement returns the 0-based top-left cell of a popW×popH popup on a
+// width×height screen.
+type placement func(width, height, popW, popH int) (row, col int)
+
+func centered(width, height, popW, popH int) (int, int) {
+	return maxvalue(0, (height-popH)/2), maxvalue(0, (width-popW)/2)
+}
+
+// bottomRight keeps clear of the status and footer lines.
+func bottomRight(width, height, popW, popH int) (int, int) {
+	return maxvalue(0, height-popH-2), maxvalue(0, width-popW-1)
+}
+
+// renderOverlayAt is renderOverlay with the popup where place puts it.
+func renderOverlayAt(base, popup string, width, height int, place placement) string {
 	// Create a fixed-size background surface
 	screen := lipgloss.Place(
 		maxvalue(1, width), maxvalue(1, height),
@@ -1186,8 +2336,8 @@ func renderOverlay(base, popup string, width, height int) string {
 		lipgloss.WithWhitespaceForeground(lipgloss.Color("0")),
 	)
 
-	bgLines := strings.Split(screen, "\n")
-	popLines := strings.Split(popup, "\n")
+	bgLines := strings.Split(sanitizeCells(screen), "\n")
+	popLines := strings.Split(sanitizeCellsKeeping(popup, pictureAt), "\n")
 
 	// Determine popup dimensions
 	popW := 0
@@ -1198,14 +2348,9 @@ func renderOverlay(base, popup string, width, height int) string {
 	}
 	popH := len(popLines)
 
-	// Centered 0-based placement
-	startRow := 0
-	startCol := 0
-	if height > 0 {
-		startRow = maxvalue(0, (height-popH)/2)
-	}
-	if width > 0 {
-		startCol = maxvalue(0, (width-popW)/2)
+	startRow, startCol := 0, 0
+	if height > 0 && width > 0 {
+		startRow, startCol = place(width, height, popW, popH)
 	}
 
 	// Compose output lines
@@ -1315,8 +2460,39 @@ func humanBytes(b int64) string {
 	return fmt.Sprintf("%.1f %s", d/unit, "EB")
 }
 
+// parseSize parses human-friendly sizes such as "512", "10K", "1.5GB" or
+// "2 GiB". Units are powers of 1024 to match humanBytes.
+func parseSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "IB"), "B")
+	mult := int64(1)
+	if t != "" {
+		switch t[len(t)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		case 'P':
+			mult = 1 << 50
+		}
+		if mult > 1 {
+			t = t[:len(t)-1]
+		}
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
 var fileIcons = map[string]string{
 	"folder":  "📁",
+	"mount":   "💽",
 	".pdf":    "📄",
 	".xls":    "📊",
 	".xlsx":   "📊",
@@ -1377,69 +2553,137 @@ func maxInt64(a, b int64) int64 {
 // truncateToWidth truncates a string to fit within the specified visual width,
 // respecting Unicode character boundaries
 func truncateToWidth(s string, maxWidth int) string {
-	if lipgloss.Width(s) <= maxWidth {
-		return s
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if maxWidth <= 0 {
+		return ""
 	}
-	
-	runes := []rune(s)
-	var result strings.Builder
-	
-	for _, r := range runes {
-		// Check the visual width this rune would add
-		testString := result.String() + string(r)
-		testWidth := lipgloss.Width(testString)
-		
-		if testWidth > maxWidth {
-			break
-		}
-		
-		result.WriteRune(r)
+	if ansi.StringWidth(s) <= maxWidth {
+		return s
 	}
-	
-	return result.String()
+	// ansi.Truncate keeps escape sequences and grapheme clusters intact
+	return ansi.Truncate(s, maxWidth, "")
 }
 
-// runeWidth returns the visual width of a single rune
-func runeWidth(r rune) int {
-	return lipgloss.Width(string(r))
+// sanitizeCells keeps printable text, newlines and SGR styling and drops
+// every other control character or escape sequence (tabs become a space),
+// so the width ansi measures is the width a terminal draws.
+func sanitizeCells(s string) string {
+	return sanitizeCellsKeeping(s, nil)
 }
 
-// extractAfterPosition extracts the part of string that starts at the given visual position
-func extractAfterPosition(s string, startPos int) string {
-	if startPos <= 0 {
+// sanitizeCellsKeeping is sanitizeCells that also keeps what keep accepts
+// where it starts (its length, or 0), e.g. the pictures a dialog drew.
+func sanitizeCellsKeeping(s string, keep func(s string) int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	var b strings.Builder
+	b.Grow(len(s))
+	var state byte
+	for len(s) > 0 {
+		if keep != nil {
+			if n := keep(s); n > 0 {
+				b.WriteString(s[:n])
+				s, state = s[n:], 0
+				continue
+			}
+		}
+		seq, width, n, newState := ansi.DecodeSequence(s, state, nil)
+		state = newState
+		switch {
+		case width > 0, seq == "\n", isSGR(seq):
+			b.WriteString(seq)
+		case seq == "\t":
+			b.WriteByte(' ')
+		}
+		s = s[n:]
+	}
+	return b.String()
+}
+
+// isSGR reports whether seq is a complete Select Graphic Rendition sequence.
+func isSGR(seq string) bool {
+	if len(seq) < 3 || !strings.HasPrefix(seq, "\x1b[") || seq[len(seq)-1] != 'm' {
+		return false
+	}
+	return strings.Trim(seq[2:len(seq)-1], "0123456789;:") == ""
+}
+
+// runeWidth returns the visual width of a single rune
+func runeWidth(r rune) int {
+	return lipgloss.Width(string(r))
+}
+
+// extractAfterPosition extracts the part of string that starts at the given visual position
+func extractAfterPosition(s string, startPos int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if startPos <= 0 {
 		return s
 	}
-	
-	totalWidth := lipgloss.Width(s)
-	if startPos >= totalWidth {
+	if startPos >= ansi.StringWidth(s) {
 		return ""
 	}
-	
-	runes := []rune(s)
-	currentWidth := 0
-	
-	for i, r := range runes {
-		if currentWidth >= startPos {
-			return string(runes[i:])
-		}
-		currentWidth += runeWidth(r)
-	}
-	
-	return ""
+	return ansi.TruncateLeft(s, startPos, "")
 }
 
 // --------------------------- Trash helpers -----------------------
 
-func getTrashDir() string {
-	// Prefer XDG location on Unix-like systems, fallback to home
-	if td := os.Getenv("XDG_DATA_HOME"); td != "" {
-		return filepath.Join(td, "disktree", "trash")
+var errNoDeviceInfo = errors.New("filesystem device information unavailable")
+
+// existingAncestor returns p or its closest ancestor that exists.
+func existingAncestor(p string) string {
+	for {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return p
+		}
+		p = parent
 	}
-	if h, err := os.UserHomeDir(); err == nil {
-		return filepath.Join(h, ".local", "share", "disktree", "trash")
+}
+
+// crossesFilesystem reports whether moving src into the trash would cross a
+// filesystem boundary, in which case the move degrades to a slow copy.
+func crossesFilesystem(src string) bool {
+	a, err := deviceID(src)
+	if err != nil {
+		return false
 	}
-	// fallback to current dir ./trash
-	return "./.disktree_trash"
+	b, err := deviceID(existingAncestor(trashDirFor(src)))
+	if err != nil {
+		return false
+	}
+	return a != b
+}
+
+// trashSpaceMargin is kept free on the trash volume by a copy into it, so
+// a delete doesn't fill the disk it lands on.
+const trashSpaceMargin = 64 << 20
+
+// trashFullError refuses a copy into a trash volume without room for it.
+type trashFullError struct {
+	trash      string
+	free, need int64
+}
+
+func (e *trashFullError) Error() string {
+	return fmt.Sprintf("the trash (%s) has %s free, not enough for %s — delete permanently instead", e.trash, humanBytes(e.free), humanBytes(e.need))
+}
+
+// trashRoom checks whether need bytes from src fit into its trash with the
+// margin to spare, and returns its free space. Unknown free space passes:
+// the copy then fails as it would have.
+func trashRoom(src string, need int64) (free int64, ok bool) {
+	return roomIn(trashDirFor(src), need)
+}
+
+// roomIn is trashRoom for the trash directory td.
+func roomIn(td string, need int64) (free int64, ok bool) {
+	free, err := freeSpace(existingAncestor(td))
+	if err != nil {
+		return -1, true
+	}
+	return free, need+trashSpaceMargin <= free
 }
 
 func uniqueSuffix() string {
@@ -1450,10 +2694,15 @@ func uniqueSuffix() string {
 	return "-" + hex.EncodeToString(b)
 }
 
-// moveToTrash moves the provided path into the trash directory, preserving the basename
+// moveToTrash moves the provided path into its trash directory, preserving the basename
 // and adding a short unique suffix if necessary.
 func moveToTrash(src string) (*TrashItem, error) {
-	td := getTrashDir()
+	return moveToTrashIn(trashDirFor(src), src)
+}
+
+// moveToTrashIn is moveToTrash into the trash directory td; the elevated
+// delete helper is given the user's.
+func moveToTrashIn(td, src string) (*TrashItem, error) {
 	if err := os.MkdirAll(td, 0755); err != nil {
 		return nil, err
 	}
@@ -1470,36 +2719,35 @@ func moveToTrash(src string) (*TrashItem, error) {
 		_ = writeTrashMeta(dst, ti)
 		return &ti, nil
 	}
-	// fallback: copy recursively (for directories) then remove
-	fi, err := os.Stat(src)
+	// fallback: copy, then remove. The copy is staged and its metadata
+	// written before the source is touched, so however it is interrupted
+	// the trash holds the whole item or nothing and the original stays
+	// complete until it does. A symlink is moved as the link itself.
+	fi, err := os.Lstat(src)
 	if err != nil {
 		return nil, err
 	}
+	need := fi.Size()
 	if fi.IsDir() {
-		// simple directory copy
-		if err := copyDir(src, dst); err != nil {
-			return nil, err
-		}
-		if err := os.RemoveAll(src); err != nil {
-			return nil, err
-		}
-		ti := TrashItem{Name: base, TrashPath: dst, OrigPath: src, DeletedAt: time.Now(), IsDir: true}
-		if err := writeTrashMeta(dst, ti); err != nil {
-			return &ti, err
-		}
-		return &ti, nil
+		need = scanner.Walk(context.Background(), src, scanner.Options{}).Size
 	}
-	// file copy
-	if err := copyFile(src, dst); err != nil {
-		return nil, err
+	if free, ok := roomIn(td, need); !ok {
+		return nil, &trashFullError{trash: td, free: free, need: need}
 	}
-	if err := os.Remove(src); err != nil {
+	if err := stageCopy(src, dst, fi.IsDir()); err != nil {
 		return nil, err
 	}
-	// write metadata
 	ti := TrashItem{Name: base, TrashPath: dst, OrigPath: src, DeletedAt: time.Now(), IsDir: fi.IsDir()}
 	if err := writeTrashMeta(dst, ti); err != nil {
-		return &ti, err
+		_ = os.RemoveAll(dst)
+		return nil, err
+	}
+	remove := os.Remove
+	if fi.IsDir() {
+		remove = os.RemoveAll
+	}
+	if err := remove(src); err != nil {
+		return nil, fmt.Errorf("copied to the trash, but removing the original failed (the copy stays in the trash): %w", err)
 	}
 	return &ti, nil
 }
@@ -1512,153 +2760,330 @@ func fiIsDir(path string) bool {
 	return fi.IsDir()
 }
 
+// writeTrashMeta writes ti next to the trashed item. It goes to a
+// temporary file first, so a crash never leaves half a record behind.
 func writeTrashMeta(trashPath string, ti TrashItem) error {
-	metaPath := trashPath + ".meta.json"
+	metaPath := trashPath + trashMetaSuffix
 	b, err := json.Marshal(ti)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(metaPath, b, 0644)
+	tmp := metaPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, metaPath)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(metaPath))
+	return nil
 }
 
 // restoreFromTrash moves a trashed item back to its original path. If a file exists at the
 // destination, it will add a unique suffix to avoid overwriting.
 func restoreFromTrash(ti *TrashItem) error {
+	_, err := restoreFromTrashTo(ti)
+	return err
+}
+
+// restoreFromTrashTo is restoreFromTrash but also returns the path the item
+// was restored to.
+func restoreFromTrashTo(ti *TrashItem) (string, error) {
 	if ti == nil {
-		return errors.New("no item to restore")
+		return "", errors.New("no item to restore")
 	}
 	dst := ti.OrigPath
 	// if dst exists, add suffix
 	if _, err := os.Stat(dst); err == nil {
 		dst = dst + uniqueSuffix()
 	}
+	if err := unshareLinked(ti.TrashPath); err != nil {
+		return "", err
+	}
+	// the original parent may have been deleted since
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
 	// attempt rename back
 	if err := os.Rename(ti.TrashPath, dst); err == nil {
 		// remove meta file
-		_ = os.Remove(ti.TrashPath + ".meta.json")
-		return nil
+		_ = os.Remove(ti.TrashPath + trashMetaSuffix)
+		return dst, nil
 	}
-	// fallback: copy then remove
-	fi, err := os.Stat(ti.TrashPath)
+	// fallback: copy then remove, staged like the copy into the trash so
+	// the item is never half restored
+	fi, err := os.Lstat(ti.TrashPath)
 	if err != nil {
-		return err
-	}
-	if fi.IsDir() {
-		if err := copyDir(ti.TrashPath, dst); err != nil {
-			return err
-		}
-		if err := os.RemoveAll(ti.TrashPath); err != nil {
-			return err
-		}
-		_ = os.Remove(ti.TrashPath + ".meta.json")
-		return nil
+		return "", err
 	}
-	if err := copyFile(ti.TrashPath, dst); err != nil {
-		return err
+	if err := stageCopy(ti.TrashPath, dst, fi.IsDir()); err != nil {
+		return "", err
 	}
-	if err := os.Remove(ti.TrashPath); err != nil {
-		return err
+	if err := os.RemoveAll(ti.TrashPath); err != nil {
+		return "", err
 	}
-	_ = os.Remove(ti.TrashPath + ".meta.json")
-	return nil
+	_ = os.Remove(ti.TrashPath + trashMetaSuffix)
+	return dst, nil
 }
 
+// copyFile copies the file or symlink at src to dst for the trash and
+// restore fallbacks, keeping what a restore must bring back: the mode
+// (setuid, setgid and sticky bits too), the modification time and, when
+// permitted, the owner. A symlink is copied as a link, not its target.
 func copyFile(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode()&fs.ModeSymlink != 0:
+		return copySymlink(src, dst, fi)
+	case !fi.Mode().IsRegular():
+		return fmt.Errorf("%s: %w", src, errSpecialFile)
+	}
 	sf, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer func(sf *os.File) {
-		err := sf.Close()
-		if err != nil {
-
-		}
+		_ = sf.Close()
 	}(sf)
-	df, err := os.Create(dst)
+	df, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
 	if err != nil {
 		return err
 	}
-	defer func(df *os.File) {
-		err := df.Close()
-		if err != nil {
-
-		}
-	}(df)
-	_, err = io.Copy(df, sf)
-	return err
+	if _, err := io.Copy(df, sf); err != nil {
+		_ = df.Close()
+		return err
+	}
+	if err := df.Sync(); err != nil {
+		_ = df.Close()
+		return err
+	}
+	if err := df.Close(); err != nil {
+		return err
+	}
+	return copyMeta(dst, fi)
 }
 
-func copyDir(src, dst string) error {
-	entries, err := os.ReadDir(src)
+// errSpecialFile refuses devices, pipes and sockets: a fallback copy that
+// left them out would lose them once the original is removed.
+var errSpecialFile = errors.New("special files (devices, pipes, sockets) can't be copied")
+
+// copySymlink recreates the link at src as dst, pointing at the same
+// (possibly relative or dangling) target.
+func copySymlink(src, dst string, fi fs.FileInfo) error {
+	target, err := os.Readlink(src)
 	if err != nil {
 		return err
 	}
-	if err := os.MkdirAll(dst, 0755); err != nil {
+	if err := os.Symlink(target, dst); err != nil {
 		return err
 	}
-	for _, e := range entries {
-		s := filepath.Join(src, e.Name())
-		d := filepath.Join(dst, e.Name())
-		if e.IsDir() {
-			if err := copyDir(s, d); err != nil {
-				return err
+	copyOwner(dst, fi)
+	return nil
+}
+
+// copyOwner gives dst the owner and group of fi. Only root may give files
+// away, so for anyone else a failure is expected and ignored: the copy is
+// theirs, as with cp -p.
+func copyOwner(dst string, fi fs.FileInfo) {
+	if uid, gid, ok := fileOwner(fi); ok {
+		_ = os.Lchown(dst, uid, gid)
+	}
+}
+
+// copyMeta sets the owner, mode and modification time of fi on dst. The
+// owner goes first, since chown clears setuid and setgid bits.
+func copyMeta(dst string, fi fs.FileInfo) error {
+	copyOwner(dst, fi)
+	mode := fi.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(dst, mode); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
+
+// copyDir copies the tree at src to dst like copyFile does its entries.
+// Directories are taken from an explicit stack rather than by recursion,
+// and a tree deeper than -max-depth is refused instead of copied in part.
+// Their modes and times are set once everything inside is written, deepest
+// first, so neither a read-only directory nor the writes undo them.
+func copyDir(src, dst string) error {
+	type pending struct {
+		src, dst string
+		depth    int
+	}
+	type done struct {
+		dst string
+		fi  fs.FileInfo
+	}
+	var dirs []done
+	stack := []pending{{src, dst, 0}}
+	for len(stack) > 0 {
+		d := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if d.depth > maxTreeDepth {
+			return fmt.Errorf("%s: %w", d.src, errTooDeep)
+		}
+		fi, err := os.Lstat(d.src)
+		if err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(d.src)
+		if err != nil {
+			return err
+		}
+		// writable until the entries are in
+		if err := os.MkdirAll(d.dst, fi.Mode().Perm()|0o700); err != nil {
+			return err
+		}
+		dirs = append(dirs, done{d.dst, fi})
+		for _, e := range entries {
+			s := filepath.Join(d.src, e.Name())
+			t := filepath.Join(d.dst, e.Name())
+			if e.IsDir() {
+				stack = append(stack, pending{s, t, d.depth + 1})
+				continue
 			}
-		} else {
-			if err := copyFile(s, d); err != nil {
+			if err := copyFile(s, t); err != nil {
 				return err
 			}
 		}
 	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := copyMeta(dirs[i].dst, dirs[i].fi); err != nil {
+			return err
+		}
+		syncDir(dirs[i].dst)
+	}
+	return nil
+}
+
+// stagingPrefix starts the hidden names copies are staged under, followed
+// by the pid of the disktree writing them (see sweepStaging).
+const stagingPrefix = ".disktree-staging-"
+
+// stageCopy copies src (a directory when isDir) under a staging name next
+// to dst, with its data flushed to disk, and only then renames it to dst:
+// dst appears complete or not at all. A failed copy leaves nothing behind.
+func stageCopy(src, dst string, isDir bool) error {
+	stage := filepath.Join(filepath.Dir(dst), stagingPrefix+strconv.Itoa(os.Getpid())+"-"+filepath.Base(dst))
+	cp := copyFile
+	if isDir {
+		cp = copyDir
+	}
+	if err := cp(src, stage); err != nil {
+		_ = os.RemoveAll(stage)
+		return err
+	}
+	if err := os.Rename(stage, dst); err != nil {
+		_ = os.RemoveAll(stage)
+		return err
+	}
+	syncDir(filepath.Dir(dst))
 	return nil
 }
 
+// sweepStaging removes staged copies in dir left by disktree processes
+// that are gone: a copy into the trash cut short by a crash or power loss.
+// Their sources were never removed.
+func sweepStaging(dir string) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range ents {
+		rest, ok := strings.CutPrefix(e.Name(), stagingPrefix)
+		if !ok {
+			continue
+		}
+		pidStr, _, _ := strings.Cut(rest, "-")
+		pid, err := strconv.Atoi(pidStr)
+		if err != nil || pid == os.Getpid() || processAlive(pid) {
+			continue
+		}
+		_ = os.RemoveAll(filepath.Join(dir, e.Name()))
+	}
+}
+
+// syncDir flushes dir's entries to disk, so a rename into it survives a
+// crash. Some platforms can't sync directories; that is not an error.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		_ = f.Sync()
+		_ = f.Close()
+	}
+}
+
 // --------------------------- Export ------------------------------
 
 func (m *model) exportCSV() tea.Cmd {
 	if m.current == nil {
 		return func() tea.Msg { return exportDoneMsg{err: errors.New("nothing to export")} }
 	}
-	path := fmt.Sprintf("du-%s.csv", time.Now().Format("20060102-150405"))
+	return m.exportTo(fmt.Sprintf("du-%s.csv", timestamp()))
+}
+
+// exportTo writes the current view to path in the format matching its
+// extension (CSV when none matches).
+func (m *model) exportTo(path string) tea.Cmd {
+	if m.current == nil {
+		return func() tea.Msg { return exportDoneMsg{err: errors.New("nothing to export")} }
+	}
+	ex, err := exporterFor(path, "")
+	if err != nil {
+		return func() tea.Msg { return exportDoneMsg{err: err} }
+	}
+	// shares are relative to the listed children, as in the table
+	root := &Node{Name: m.current.Name, Path: m.current.Path, IsDir: true, Children: m.current.Children}
+	meta := m.scanner.exportMeta(root.Path, "current view")
+	for _, c := range root.Children {
+		root.Size += c.Size
+		if c.Err != nil {
+			meta.errors.Add(1)
+		}
+	}
 	return func() tea.Msg {
-		f, err := os.Create(path)
+		f, appending, _, err := createExport(path, ex)
 		if err != nil {
 			return exportDoneMsg{err: err}
 		}
-		defer func(f *os.File) {
-			err := f.Close()
-			if err != nil {
-
-			}
-		}(f)
-		w := csv.NewWriter(f)
-		defer w.Flush()
-		err = w.Write([]string{"Name", "Path", "SizeBytes", "SizeHuman", "Files", "Dirs", "ParentShare%"})
-		if err != nil {
-			return nil
-		}
-		var total int64
-		for _, c := range m.current.Children {
-			total += c.Size
-		}
-		for _, c := range m.current.Children {
-			pct := 0.0
-			if total > 0 {
-				pct = float64(c.Size) / float64(total) * 100
-			}
-			_ = w.Write([]string{
-				c.Name,
-				c.Path,
-				fmt.Sprintf("%d", c.Size),
-				humanBytes(c.Size),
-				fmt.Sprintf("%d", c.Files),
-				fmt.Sprintf("%d", c.Dirs),
-				fmt.Sprintf("%.1f", pct),
-			})
+		err = ex.Write(f, root, exportOptions{Meta: meta, Appending: appending})
+		if cerr := f.Close(); err == nil {
+			err = cerr
 		}
-		return exportDoneMsg{path: path}
+		return exportDoneMsg{path: path, err: err}
 	}
 }
 
+// stringList is a flag.Value collecting repeated string flags.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// timestamp formats the current time for use in generated file names.
+func timestamp() string {
+	return time.Now().Format("20060102-150405")
+}
+
 // --------------------------- Styles ------------------------------
 
 func tableStyles() table.Styles {
@@ -1692,27 +3117,697 @@ func tableStylesNoSelection() table.Styles {
 // --------------------------- main ------------------------------
 
 func main() {
+	var sessionPath string
+	// subcommands come before any flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "version":
+			runVersion(os.Stdout)
+			return
+		case "paths":
+			configureTrashFrom(defaultConfigPath())
+			runPaths(os.Stdout)
+			return
+		case "trash":
+			configureTrashFrom(defaultConfigPath())
+			if err := runTrash(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				if errors.Is(err, errTrashUsage) {
+					os.Exit(2)
+				}
+				os.Exit(1)
+			}
+			return
+		case "exec":
+			if err := runExec(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				if errors.Is(err, errExecUsage) {
+					os.Exit(2)
+				}
+				os.Exit(1)
+			}
+			return
+		case "open":
+			// the rest of main runs as usual, browsing the session
+			if len(os.Args) < 3 || strings.HasPrefix(os.Args[2], "-") {
+				fmt.Fprintln(os.Stderr, "usage: disktree open <session.dtree> [flags]")
+				os.Exit(2)
+			}
+			sessionPath = os.Args[2]
+			os.Args = append(os.Args[:1], os.Args[3:]...)
+		case "compare":
+			if err := runCompare(os.Args[2:], os.Stdout); err != nil {
+				if errors.Is(err, errDifferent) {
+					os.Exit(1)
+				}
+				// like diff: 1 for differences, 2 for trouble
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(2)
+			}
+			return
+		case "self-update":
+			if err := runSelfUpdate(os.Stdout); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	var root string
 	var threads int
 	var follow bool
 	flag.StringVar(&root, "root", ".", "Root path to scan")
 	flag.IntVar(&threads, "threads", runtime.GOMAXPROCS(0)*4, "Worker concurrency for size calculation")
 	flag.BoolVar(&follow, "follow-symlinks", false, "Follow symbolic links (may cause cycles)")
+	var oneFileSystem bool
+	flag.BoolVar(&oneFileSystem, "one-file-system", false, "Leave filesystems mounted below a directory out of its totals (like du -x)")
+	var allocated bool
+	flag.BoolVar(&allocated, "allocated", false, "Count the disk space files take (st_blocks) instead of their length, like du without --apparent-size")
+	var xattrs bool
+	flag.BoolVar(&xattrs, "xattrs", false, "Add extended attributes and resource forks to file sizes (macOS and Linux)")
+	var compressed bool
+	flag.BoolVar(&compressed, "compressed", false, "Also count sizes on disk after transparent compression (NTFS, ZFS, btrfs, APFS) and show them in a Disk column")
+	var symlinkPolicy string
+	flag.StringVar(&symlinkPolicy, "symlink-policy", "link", "Where followed links are counted: link (unless the target is inside -root), target, or both")
 	var rescanAfterDelete bool
 	flag.BoolVar(&rescanAfterDelete, "rescan-after-delete", false, "Automatically rescan parent after deleting an item")
+	var confirmThreshold string
+	flag.StringVar(&confirmThreshold, "confirm-threshold", "1G", "Require a second confirmation when deleting items at least this large (0 disables)")
+	var confirmSkipBelow, confirmLarge string
+	flag.StringVar(&confirmSkipBelow, "confirm-skip-below", "0", "Delete items smaller than this to the trash without asking (0 always asks)")
+	flag.StringVar(&confirmLarge, "confirm-large", "twice", "How deletes at or above -confirm-threshold are confirmed: twice (a second Yes) or type (typing the name)")
+	var configPath string
+	flag.StringVar(&configPath, "config", defaultConfigPath(), "Path to the config file")
+	var protect stringList
+	flag.Var(&protect, "protect", "Glob of paths that need a typed override to delete (repeatable)")
+	var protectedDelete string
+	flag.StringVar(&protectedDelete, "protected-delete", "confirm", "How to handle deleting protected paths: confirm (type the path) or refuse")
+	var netThreads int
+	flag.IntVar(&netThreads, "network-threads", defaultNetThreads, "Worker concurrency per network/FUSE mount (NFS, SMB, sshfs, ...)")
+	var excludeHidden bool
+	flag.BoolVar(&excludeHidden, "exclude-hidden", false, "Leave hidden entries (dotfiles, Windows/macOS hidden flag) out of scans and totals")
+	var memLimit string
+	flag.StringVar(&memLimit, "mem-limit", "", "Soft memory cap (e.g. 2G); sets GOMEMLIMIT and drops cached listings when nearing it")
+	var tryUnreadable bool
+	flag.BoolVar(&tryUnreadable, "try-unreadable", false, "Walk directories that can't be listed (e.g. other users' homes) instead of showing them as \"no access\"")
+	var trashOnExit string
+	flag.StringVar(&trashOnExit, "trash-on-exit", "ask", "What to do at quit with items trashed this session: ask, keep or empty")
+	var trashDir string
+	flag.StringVar(&trashDir, "trash-dir", "", "Trash directory to delete into instead of the default (config trash_mounts can give volumes their own)")
+	flag.StringVar(&auditLog, "audit-log", "", "File to append every delete, restore and move to (default audit.log in the data directory), or off")
+	var trashDedup string
+	flag.StringVar(&trashDedup, "trash-dedup", "off", "When a path is trashed again: off keeps every copy, latest only the newest, link hard-links identical files to the previous copy")
+	var graphics string
+	flag.StringVar(&graphics, "graphics", "off", "Draw pictures with the terminal's image protocol: off, auto, kitty or iterm")
+	var tour bool
+	flag.BoolVar(&tour, "tour", false, "Show the first-run introduction again")
+	var trustMtime bool
+	flag.BoolVar(&trustMtime, "trust-mtime", false, "Rescan only directories whose mtime changed, reusing the others' totals (faster, but misses files that grow or shrink in place)")
+	var scanLock bool
+	flag.BoolVar(&scanLock, "scan-lock", true, "Register scans in the data directory and offer to attach to another instance's scan of the same root (-scan-lock=false scans regardless)")
+	var sumJSON string
+	flag.StringVar(&sumJSON, "sum-json", "", "Print subtree totals for a path as JSON and exit (used for elevated rescans)")
+	var sumBatch, sumOut string
+	flag.StringVar(&sumBatch, "sum-batch", "", "Size each path listed in this file and write the totals to -sum-out (used for UAC rescans on Windows)")
+	flag.StringVar(&sumOut, "sum-out", "", "File -sum-batch writes its totals to")
+	var serveSums bool
+	flag.BoolVar(&serveSums, "serve-sums", false, "Answer subtree totals over a local socket until stdin closes (the -scan-as helper)")
+	var serveSock, attachSock string
+	flag.StringVar(&serveSock, "serve", "", "Scan -root without the TUI and keep the results in memory for -attach viewers on this unix socket, until Ctrl+C")
+	flag.StringVar(&attachSock, "attach", "", "Browse the scan of a disktree -serve process through its unix socket instead of scanning")
+	var sampleAbove int
+	var sampleRate float64
+	flag.IntVar(&sampleAbove, "sample-above", 0, "Size the files of directories with more entries than this from a sample, with a confidence interval (0 = never)")
+	flag.Float64Var(&sampleRate, "sample-rate", 0.01, "Fraction of files stat'ed in a sampled directory")
+	var budget string
+	flag.StringVar(&budget, "budget", "", "Stop descending once a scan has spent this (e.g. 30s, or 2M files) and estimate the rest")
+	var scanAs string
+	flag.StringVar(&scanAs, "scan-as", "", "Size directories as this user through a sudo/pkexec helper while the TUI stays unprivileged")
+	var trashJSON, trashInto string
+	flag.StringVar(&trashJSON, "trash-json", "", "Move a path to the -trash-into directory, print the item as JSON and exit (used for elevated deletes)")
+	flag.StringVar(&trashInto, "trash-into", "", "Trash directory for -trash-json")
+	var exportPath, exportMinSize string
+	var exportOpts exportOptions
+	flag.StringVar(&exportPath, "export", "", "Write a deep CSV export of -root to this file and exit without starting the TUI")
+	flag.IntVar(&exportOpts.MaxDepth, "export-depth", 0, "Deepest level to export, 1 = immediate children (0 = unlimited)")
+	flag.StringVar(&exportMinSize, "export-min-size", "0", "Skip exported entries smaller than this (e.g. 10M)")
+	flag.BoolVar(&exportOpts.DirsOnly, "export-dirs-only", false, "Export directories only")
+	var exportMatch string
+	flag.StringVar(&exportMatch, "export-match", "", "Export only entries whose full path matches this regular expression (e.g. 'cache|tmp|log')")
+	flag.BoolVar(&exportOpts.IncludeErrors, "export-errors", false, "Export unreadable entries with an Error column")
+	flag.StringVar(&exportOpts.Format, "export-format", "", "Export format: "+exporterNames()+" (default: from the file extension, else csv)")
+	var report bool
+	var reportDepth int
+	flag.BoolVar(&report, "report", false, "Print a du-style summary of -root (size and path per directory) and exit without starting the TUI")
+	flag.IntVar(&reportDepth, "depth", 1, "Directory levels below -root listed by -report (0 = the root's total only)")
+	var webhookURL string
+	var webhookHeaders stringList
+	var webhookInterval time.Duration
+	var webhookBatchSize int
+	flag.StringVar(&webhookURL, "webhook", "", "With -export, POST directory summaries as JSON batches to this URL while the walk runs")
+	flag.Var(&webhookHeaders, "webhook-header", "Extra \"Name: value\" header for -webhook requests (repeatable)")
+	flag.DurationVar(&webhookInterval, "webhook-interval", 2*time.Second, "How often -webhook sends the events gathered")
+	flag.IntVar(&webhookBatchSize, "webhook-batch", 500, "Most events in one -webhook request; a full batch is sent right away")
+	var fromFile string
+	flag.StringVar(&fromFile, "from-file", "", "Browse a list of size<TAB>path lines (e.g. from find -printf or du -ab) instead of scanning; - reads stdin")
+	var fromFormat string
+	flag.StringVar(&fromFormat, "from-format", listingAuto, "How -from-file is read: auto, list (file sizes) or du (du -ab output)")
+	var backupPatterns, backupFormat string
+	var backupRoots stringList
+	flag.StringVar(&backupPatterns, "backup-patterns", "", "Mark what a backup leaves out, from a borg patterns file or a restic exclude file")
+	flag.StringVar(&backupFormat, "backup-format", backupAuto, "How -backup-patterns is read: auto, borg or restic")
+	flag.Var(&backupRoots, "backup-root", "Directory the backup starts from, as given to restic or borg create (repeatable; default: everything)")
+	var planFile string
+	flag.StringVar(&planFile, "plan", "", "Load a cleanup plan saved from the m dialog, to review and run it")
+	var debounce, tick string
+	var fps int
+	flag.StringVar(&debounce, "debounce", defaultDebounce.String(), "How long scan updates gather before the table is rebuilt")
+	flag.StringVar(&tick, "tick", defaultTick.String(), "Interval of row spinners while scanning; auto (or auto:<min>) stretches it while updates are frequent")
+	flag.IntVar(&fps, "fps", defaultFPS, "Most frames drawn per second (lower it for slow terminals or SSH)")
+	var loadingMin, loadingQuick string
+	var legacyLoading bool
+	flag.BoolVar(&legacyLoading, "loading-overlay", false, "Cover the table with a centered popup while scanning, instead of a header badge")
+	flag.StringVar(&loadingMin, "loading-min", defaultLoadingMin.String(), "Least time the loading overlay shows, so it doesn't flicker (0 disables)")
+	flag.StringVar(&loadingQuick, "loading-quick", defaultLoadingQuick.String(), "Scans finishing within this are shown at once, without -loading-min; cached directories always are")
+	var profile string
+	flag.StringVar(&profile, "profile", profileAuto, "Storage profile: auto, termux (Android storage quirks and a start screen of its storage roots) or none")
+	var wslHelper string
+	flag.StringVar(&wslHelper, "wsl-helper", "auto", "Under WSL, Windows build of disktree that sizes Windows drives instead of walking them over 9p (auto finds disktree.exe; off disables)")
+	var maxDepth int
+	flag.IntVar(&maxDepth, "max-depth", scanner.DefaultMaxDepth, "Deepest directory level walked below a sized directory; deeper trees (e.g. recursive bind mounts) are left out with a warning")
+	var predicates [4]string
+	for i, f := range predicateFlags {
+		flag.StringVar(&predicates[i], f.name, "", f.usage)
+	}
+	var ownerColumns bool
+	flag.BoolVar(&ownerColumns, "owner-columns", false, "Show the Owner and Mode columns (o toggles them)")
+	var otelEndpoint string
+	flag.StringVar(&otelEndpoint, "otel", "", "Send OpenTelemetry spans of scans and exports to this OTLP/HTTP collector (e.g. http://localhost:4318)")
 	flag.Parse()
 
+	links, err := parseLinkPolicy(symlinkPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
 	// Normalize root
 	abs, err := filepath.Abs(root)
 	if err == nil {
 		root = abs
 	}
 
+	if err := setMaxDepth(maxDepth); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	// configureScanner gives s the scanning options of the flags, and of
+	// the config once it has been applied below. The TUI, -serve, -report,
+	// -export and the helpers all set up their scanner with it, so they
+	// count alike.
+	configureScanner := func(s *Scanner, preds *filePredicates) error {
+		s.threads, s.followSymlinks, s.root = threads, follow, root
+		s.netThreads = netThreads
+		s.excludeHidden = excludeHidden
+		s.tryUnreadable = tryUnreadable
+		s.linkPolicy = links
+		s.oneFileSystem = oneFileSystem
+		s.allocated = allocated
+		s.xattrs = xattrs
+		s.diskSizes = compressed
+		s.trustMtime = trustMtime
+		s.exclude = preds
+		var err error
+		if s.budget, err = parseBudget(budget); err != nil {
+			return fmt.Errorf("-budget: %w", err)
+		}
+		s.sampling, err = newSampling(sampleAbove, sampleRate)
+		return err
+	}
+
+	if sumJSON != "" || serveSums || sumBatch != "" {
+		preds, err := newFilePredicates(predicates)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		// the TUI passes the options it resolved; the config only fills in
+		// for a helper started by hand, and must not stop one that isn't
+		if hcfg, err := loadConfig(configPath); err == nil {
+			xattrs = xattrs || (!set["xattrs"] && hcfg.Xattrs)
+			compressed = compressed || (!set["compressed"] && hcfg.Compressed)
+		}
+		s := &Scanner{mounts: systemMounts()}
+		if err := configureScanner(s, preds); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		switch {
+		case serveSums:
+			err = runSumServer(os.Stdin, os.Stdout, s)
+		case sumBatch != "":
+			if sumOut == "" {
+				sumOut = sumBatch + ".out"
+			}
+			err = runSumBatch(sumBatch, sumOut, s)
+		default:
+			err = runSumHelper(os.Stdout, sumJSON, s)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if trashJSON != "" {
+		if trashInto == "" {
+			trashInto = trashDirFor(trashJSON)
+		}
+		if err := runTrashHelper(os.Stdout, trashJSON, trashInto); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if !set["confirm-threshold"] && cfg.ConfirmThreshold != "" {
+		confirmThreshold = cfg.ConfirmThreshold
+	}
+	if !set["confirm-skip-below"] && cfg.ConfirmSkipBelow != "" {
+		confirmSkipBelow = cfg.ConfirmSkipBelow
+	}
+	if !set["confirm-large"] && cfg.ConfirmLarge != "" {
+		confirmLarge = cfg.ConfirmLarge
+	}
+	if confirmLarge != "twice" && confirmLarge != "type" {
+		fmt.Println("Error: -confirm-large must be twice or type")
+		os.Exit(2)
+	}
+	if !set["protected-delete"] && cfg.ProtectedDelete != "" {
+		protectedDelete = cfg.ProtectedDelete
+	}
+	if protectedDelete != "confirm" && protectedDelete != "refuse" {
+		fmt.Println("Error: -protected-delete must be confirm or refuse")
+		os.Exit(2)
+	}
+	if !set["trash-on-exit"] && cfg.TrashOnExit != "" {
+		trashOnExit = cfg.TrashOnExit
+	}
+	if trashOnExit != "ask" && trashOnExit != "keep" && trashOnExit != "empty" {
+		fmt.Println("Error: -trash-on-exit must be ask, keep or empty")
+		os.Exit(2)
+	}
+	if !set["trash-dir"] && cfg.TrashDir != "" {
+		trashDir = cfg.TrashDir
+	}
+	if !set["audit-log"] && cfg.AuditLog != "" {
+		auditLog = cfg.AuditLog
+	}
+	if err := configureTrash(trashDir, cfg.TrashMounts); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if !set["trash-dedup"] && cfg.TrashDedup != "" {
+		trashDedup = cfg.TrashDedup
+	}
+	if trashDedup != "off" && trashDedup != "latest" && trashDedup != "link" {
+		fmt.Println("Error: -trash-dedup must be off, latest or link")
+		os.Exit(2)
+	}
+
+	if !set["backup-patterns"] && cfg.BackupPatterns != "" {
+		backupPatterns = expandHome(cfg.BackupPatterns)
+	}
+	if !set["backup-format"] && cfg.BackupFormat != "" {
+		backupFormat = cfg.BackupFormat
+	}
+	if !set["backup-root"] {
+		backupRoots = append(backupRoots, cfg.BackupRoots...)
+	}
+
+	// every scanner counts extended attributes and on-disk sizes the same
+	// way, headless ones too
+	if !set["xattrs"] && cfg.Xattrs {
+		xattrs = true
+	}
+	if !set["compressed"] && cfg.Compressed {
+		compressed = true
+	}
+	if !set["trust-mtime"] && cfg.TrustMtime {
+		trustMtime = true
+	}
+	if !set["budget"] && cfg.Budget != "" {
+		budget = cfg.Budget
+	}
+	if !set["sample-above"] && cfg.SampleAbove > 0 {
+		sampleAbove = cfg.SampleAbove
+	}
+	if !set["sample-rate"] && cfg.SampleRate > 0 {
+		sampleRate = cfg.SampleRate
+	}
+
+	for i, v := range []string{cfg.ExcludeOlderThan, cfg.ExcludeNewerThan, cfg.ExcludeSmallerThan, cfg.ExcludeLargerThan} {
+		if !set[predicateFlags[i].name] && v != "" {
+			predicates[i] = v
+		}
+	}
+	preds, err := newFilePredicates(predicates)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	if !set["max-depth"] && cfg.MaxDepth != 0 {
+		if err := setMaxDepth(cfg.MaxDepth); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(2)
+		}
+	}
+
+	if !set["graphics"] && cfg.Graphics != "" {
+		graphics = cfg.Graphics
+	}
+	gfx, err := parseGraphics(graphics, os.Getenv)
+	if err != nil {
+		fmt.Println("Error: -graphics:", err)
+		os.Exit(2)
+	}
+
+	if !set["debounce"] && cfg.Debounce != "" {
+		debounce = cfg.Debounce
+	}
+	if !set["tick"] && cfg.Tick != "" {
+		tick = cfg.Tick
+	}
+	if !set["fps"] && cfg.FPS != 0 {
+		fps = cfg.FPS
+	}
+	pace, err := parsePacing(debounce, tick)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if !set["loading-min"] && cfg.LoadingMin != "" {
+		loadingMin = cfg.LoadingMin
+	}
+	if !set["loading-quick"] && cfg.LoadingQuick != "" {
+		loadingQuick = cfg.LoadingQuick
+	}
+	lmin, lquick, err := parseLoadingTimes(loadingMin, loadingQuick)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	if fps < 1 || fps > 120 {
+		fmt.Println("Error: -fps must be between 1 and 120")
+		os.Exit(2)
+	}
+
+	threshold, err := parseSize(confirmThreshold)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+	skipBelow, err := parseSize(confirmSkipBelow)
+	if err != nil {
+		fmt.Println("Error: -confirm-skip-below:", err)
+		os.Exit(2)
+	}
+
+	var trace *tracer
+	if otelEndpoint != "" {
+		if trace, err = newTracer(otelEndpoint, os.Getenv); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+	}
+	prof, err := parseProfile(profile, os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error: -profile:", err)
+		os.Exit(2)
+	}
+	if prof != nil {
+		markAndroidStorage(systemMounts())
+	}
+	var plan cleanupPlan
+	if planFile != "" {
+		if plan, err = loadPlan(planFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -plan:", err)
+			os.Exit(2)
+		}
+	}
+	var backup *backupRules
+	if backupPatterns != "" {
+		if fromFile != "" || sessionPath != "" {
+			fmt.Fprintln(os.Stderr, "Error: -backup-patterns needs the files themselves, not a file list or session")
+			os.Exit(2)
+		}
+		if backup, err = loadBackupRules(backupPatterns, backupFormat, backupRoots); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -backup-patterns:", err)
+			os.Exit(2)
+		}
+	}
+	var listing *fileListing
+	if fromFile != "" || sessionPath != "" {
+		switch {
+		case exportPath != "":
+			fmt.Fprintln(os.Stderr, "Error: -from-file and open can't be combined with -export")
+			os.Exit(2)
+		case report:
+			fmt.Fprintln(os.Stderr, "Error: -from-file and open can't be combined with -report")
+			os.Exit(2)
+		case fromFile != "" && sessionPath != "":
+			fmt.Fprintln(os.Stderr, "Error: -from-file can't be combined with open")
+			os.Exit(2)
+		}
+		if sessionPath != "" {
+			listing, err = loadSession(sessionPath)
+		} else {
+			listing, err = loadListing(fromFile, fromFormat)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		switch {
+		case !set["root"]:
+			root = listing.root
+		case listing.node(root) == nil:
+			fmt.Fprintf(os.Stderr, "Error: -root %s is not a directory in the list (its root is %s)\n", root, listing.root)
+			os.Exit(2)
+		}
+	}
+	if serveSock != "" || attachSock != "" {
+		switch {
+		case serveSock != "" && attachSock != "":
+			fmt.Fprintln(os.Stderr, "Error: -serve and -attach can't be combined")
+			os.Exit(2)
+		case listing != nil:
+			fmt.Fprintln(os.Stderr, "Error: -from-file and open can't be combined with -serve or -attach")
+			os.Exit(2)
+		case exportPath != "" || report:
+			fmt.Fprintln(os.Stderr, "Error: -export and -report scan by themselves; they can't be combined with -serve or -attach")
+			os.Exit(2)
+		}
+	}
+	var server *serverClient
+	if attachSock != "" {
+		if server, err = attachServer(attachSock); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if !set["root"] {
+			root = server.root
+		}
+	}
+	if webhookURL != "" && exportPath == "" {
+		fmt.Fprintln(os.Stderr, "Error: -webhook needs -export (it streams headless scans)")
+		os.Exit(2)
+	}
+	headlessScanner := func() *Scanner {
+		s := &Scanner{mounts: systemMounts(), trace: trace}
+		if err := configureScanner(s, preds); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		return s
+	}
+	if report {
+		switch {
+		case exportPath != "":
+			fmt.Fprintln(os.Stderr, "Error: -report can't be combined with -export")
+			os.Exit(2)
+		case reportDepth < 0:
+			fmt.Fprintln(os.Stderr, "Error: -depth must be 0 or more")
+			os.Exit(2)
+		}
+		err := headlessScanner().runReport(context.Background(), root, reportDepth, os.Stdout, os.Stderr)
+		if msg := trace.close(5 * time.Second); msg != "" {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if exportPath != "" {
+		// an export lists every file: there is nothing to estimate
+		if set["budget"] || set["sample-above"] {
+			fmt.Fprintln(os.Stderr, "Error: -export lists every file; it can't be combined with -budget or -sample-above")
+			os.Exit(2)
+		}
+		budget, sampleAbove = "", 0
+		if exportOpts.MinSize, err = parseSize(exportMinSize); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(2)
+		}
+		if exportMatch != "" {
+			if exportOpts.Match, err = regexp.Compile(exportMatch); err != nil {
+				fmt.Fprintln(os.Stderr, "Error: -export-match:", err)
+				os.Exit(2)
+			}
+		}
+		var hook *webhook
+		if webhookURL != "" {
+			if hook, err = newWebhook(webhookURL, webhookHeaders, webhookInterval, webhookBatchSize); err != nil {
+				fmt.Fprintln(os.Stderr, "Error:", err)
+				os.Exit(2)
+			}
+		}
+		err := headlessScanner().runHeadlessExport(root, exportPath, exportOpts, hook, os.Stderr)
+		if msg := trace.close(5 * time.Second); msg != "" {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	m := initialModel(root, threads, follow)
+	m.scanner.trace = trace
+	m.scanner.wsl = newWSLBridge(wslHelper)
+	m.listing = listing
+	m.profile = prof
+	if memLimit != "" {
+		if m.memLimit, err = parseSize(memLimit); err != nil {
+			fmt.Fprintln(os.Stderr, "Error: -mem-limit:", err)
+			os.Exit(2)
+		}
+		setMemLimit(m.memLimit)
+	}
 	m.autoRescanAfterDelete = rescanAfterDelete
-	p := tea.NewProgram(m, tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
+	m.pacer = pace
+	m.loadingMinDuration, m.loadingQuick = lmin, lquick
+	m.loadingOverlay = legacyLoading || (!set["loading-overlay"] && cfg.LoadingOverlay)
+	m.showPerms = ownerColumns || (!set["owner-columns"] && cfg.OwnerColumns)
+	if err := configureScanner(m.scanner, preds); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(2)
+	}
+	if !set["scan-as"] && cfg.ScanAs != "" {
+		scanAs = cfg.ScanAs
+	}
+	if scanAs != "" && m.listing == nil {
+		fmt.Fprintf(os.Stderr, "Starting the scanner as %s ...\n", scanAs)
+		if m.scanner.scanAs, err = startScanAs(scanAs, m.scanner); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
+	if serveSock != "" {
+		// the scanner is set up as the TUI's would be; the server runs it
+		err := serveOnSignals(serveSock, root, m.scanner, os.Stderr)
+		m.scanner.scanAs.close()
+		if msg := trace.close(5 * time.Second); msg != "" {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	m.scanner.server, attached = server, server
+	m.confirmThreshold = threshold
+	m.confirmSkipBelow = skipBelow
+	m.confirmTyped = confirmLarge == "type"
+	m.protect = newProtectedRules(append(cfg.ProtectedPaths, protect...), protectedDelete == "refuse")
+	m.trashOnExit = trashOnExit
+	m.trashDedup = trashDedup
+	m.graphics = gfx
+	m.configPath = configPath
+	var problems, more []string
+	m.userCommands, problems = userCommandKeys(cfg.Commands)
+	m.macros = cfg.Macros
+	m.scanner.analyzers, more = startAnalyzers(cfg.Analyzers)
+	problems = append(problems, more...)
+	m.offload, more = offloadTargets(cfg.Offload)
+	problems = append(problems, more...)
+	m.plan = plan
+	if backup != nil {
+		m.backup = newBackupCoverage(backup, m.scanner)
+	}
+	if len(problems) > 0 {
+		m.status = "⚠ config: " + strings.Join(problems, "; ")
+	}
+	// a crashed session's deletes, renames and copies stay undoable
+	j, recovered := openJournal(journalDir())
+	m.journal = j
+	if recovered > 0 {
+		m.status = fmt.Sprintf("Recovered %d undoable operations from an earlier session — u to undo", recovered)
+	}
+	// and a copy into the trash it was making is dropped; its source is intact
+	for _, d := range trashDirs() {
+		sweepStaging(d)
+	}
+	if scanLock && listing == nil && server == nil {
+		m.claim = claimScan(m.rootPath, m.scanner.recordsKey())
+		if m.scanner.trustMtime {
+			// attaching only saves a walk when records can be reused
+			m.otherScans = otherClaims(m.rootPath)
+		}
+	}
+	if prof != nil && !set["root"] && listing == nil {
+		m.overlays.push(newStartOverlay(prof))
+	}
+	if tour || !cfg.TourSeen {
+		m.overlays.push(tourOverlay{configPath: configPath})
+	}
+	// panics are handled by crashGuard so the terminal is restored and a
+	// report is written, including panics in our own goroutines
+	installCrashHandler()
+	popts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithoutCatchPanics(), tea.WithFPS(fps)}
+	if fromFile == "-" {
+		popts = append(popts, tea.WithInputTTY()) // stdin was the list
+	}
+	p := tea.NewProgram(guardedModel{m}, popts...)
+	if err := runProgram(p); err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
+	m.journal.close()
+	m.claim.remove()
+	m.scanner.analyzers.close()
+	m.scanner.scanAs.close()
+	m.scanner.server.close()
+	if msg := trace.close(2 * time.Second); msg != "" {
+		fmt.Fprintln(os.Stderr, msg)
+	}
+}
+
+func runProgram(p *tea.Program) error {
+	defer crashGuard()
+	_, err := p.Run()
+	return err
 }
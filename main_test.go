@@ -58,3 +58,42 @@ func TestMax(t *testing.T) {
 		t.Fatalf("max(5,-1) = %d; want 5", got)
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"10K", 10 << 10},
+		{"1.5GB", 3 << 29},
+		{"2 GiB", 2 << 30},
+		{"1t", 1 << 40},
+	}
+	for _, c := range cases {
+		got, err := parseSize(c.in)
+		if err != nil || got != c.want {
+			t.Fatalf("parseSize(%q) = %d, %v; want %d", c.in, got, err, c.want)
+		}
+	}
+	if _, err := parseSize("lots"); err == nil {
+		t.Fatalf("parseSize(\"lots\") should fail")
+	}
+}
+
+func TestSummaryLine(t *testing.T) {
+	m := &model{width: 120}
+	if got := m.summaryLine(); got != "" {
+		t.Errorf("no directory should show no summary, got %q", got)
+	}
+	m.current = &Node{Path: "/d", IsDir: true, Size: 3 << 20, Files: 12, Dirs: 3, Children: []*Node{
+		{Name: "a", IsDir: true, Size: 3 << 20},
+		{Name: "b", IsDir: true, Size: -1},
+		{Name: "c", IsDir: true, NoAccess: true},
+	}}
+	want := "Σ 3.0 MB · 12 files · 3 dirs · 1 unreadable · 1 still sizing"
+	if got := m.summaryLine(); got != want {
+		t.Errorf("summaryLine() = %q, want %q", got, want)
+	}
+}
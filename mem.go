@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Memory ------------------------------
+
+// compactAt is the share of -mem-limit at which disktree switches to compact
+// mode and starts dropping cached listings.
+const compactAt = 0.8
+
+// memCheckInterval is how often the heap is compared against -mem-limit.
+const memCheckInterval = 2 * time.Second
+
+type memCheckMsg struct{}
+
+func memCheckTick() tea.Cmd {
+	return tea.Tick(memCheckInterval, func(time.Time) tea.Msg { return memCheckMsg{} })
+}
+
+// setMemLimit applies -mem-limit as the Go runtime's soft memory limit
+// (GOMEMLIMIT), so the GC works harder before the cap is reached.
+func setMemLimit(limit int64) {
+	if limit > 0 {
+		debug.SetMemoryLimit(limit)
+	}
+}
+
+// heapInUse is the live heap, including memory not yet returned to the OS.
+func heapInUse() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapInuse
+}
+
+// checkMemory switches to compact mode once the heap nears memLimit. Cached
+// directories off the current path are pruned first: they keep their totals
+// and lose their children, which a visit rescans: from dirRecords with
+// -trust-mtime, by listing the subtree again without.
+// If that does not bring the heap back under the threshold, their listings
+// and subtree records are dropped as well.
+func (m *model) checkMemory() tea.Cmd {
+	if m.memLimit <= 0 {
+		return nil
+	}
+	threshold := uint64(compactAt * float64(m.memLimit))
+	if heapInUse() < threshold {
+		return memCheckTick()
+	}
+	pruned := pruneCache(m.breadcrumbs)
+	debug.FreeOSMemory()
+	dropped := 0
+	if heapInUse() >= threshold {
+		dropped = compactCaches(m.breadcrumbs)
+		debug.FreeOSMemory()
+	}
+	if !m.compact || dropped > 0 {
+		m.status = fmt.Sprintf("Memory near the %s limit: compact mode on, pruned %d and dropped %d cached directories", humanBytes(m.memLimit), pruned, dropped)
+	}
+	m.compact = true
+	return memCheckTick()
+}
+
+// pruneCache replaces cached directories outside keep with copies that keep
+// their totals but no children, returning how many were pruned.
+func pruneCache(keep []string) int {
+	keepSet := make(map[string]bool, len(keep))
+	for _, p := range keep {
+		keepSet[pathKey(p)] = true
+	}
+	pruned := 0
+	cache.Range(func(k, v any) bool {
+		n := v.(*Node)
+		if keepSet[k.(string)] || n.Pruned || len(n.Children) == 0 {
+			return true
+		}
+		p := *n
+		p.Children, p.Pruned = nil, true
+		cache.Store(k, &p)
+		pruned++
+		return true
+	})
+	return pruned
+}
+
+// compactCaches drops cached listings and subtree records for every
+// directory that is not in keep, returning how many listings were dropped.
+func compactCaches(keep []string) int {
+	keepSet := make(map[string]bool, len(keep))
+	for _, p := range keep {
+		keepSet[pathKey(p)] = true
+	}
+	dropped := 0
+	cache.Range(func(k, _ any) bool {
+		if !keepSet[k.(string)] {
+			cache.Delete(k)
+			dropped++
+		}
+		return true
+	})
+	dirRecords.Range(func(k, _ any) bool {
+		if !keepSet[k.(string)] {
+			dirRecords.Delete(k)
+		}
+		return true
+	})
+	return dropped
+}
+
+// statsOverlay shows memory use and cache sizes, refreshed on every frame.
+type statsOverlay struct{}
+
+func (statsOverlay) opts() overlayOpts {
+	return overlayOpts{id: "stats", z: zDialog, dim: true, focusable: true}
+}
+
+func (statsOverlay) View(m *model) string {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	count := func(sm interface{ Range(func(k, v any) bool) }) int {
+		n := 0
+		sm.Range(func(_, _ any) bool { n++; return true })
+		return n
+	}
+	pruned := 0
+	cache.Range(func(_, v any) bool {
+		if v.(*Node).Pruned {
+			pruned++
+		}
+		return true
+	})
+	rss := "n/a"
+	if v, ok := residentBytes(); ok {
+		rss = humanBytes(int64(v))
+	}
+	limit := "none (set with -mem-limit)"
+	if m.memLimit > 0 {
+		limit = humanBytes(m.memLimit)
+		if m.compact {
+			limit += " — compact mode"
+		}
+	}
+	rows := [][2]string{
+		{"RSS", rss},
+		{"Heap", fmt.Sprintf("%s in use, %s from OS", humanBytes(int64(ms.HeapInuse)), humanBytes(int64(ms.Sys)))},
+		{"GC", fmt.Sprintf("%d cycles", ms.NumGC)},
+		{"Limit", limit},
+		{"Cached dirs", fmt.Sprintf("%d listings (%d pruned), %d subtree records", count(&cache), pruned, count(&dirRecords))},
+		{"Goroutines", fmt.Sprintf("%d", runtime.NumGoroutine())},
+		{"Special files", specialNote(m.current)},
+	}
+	keyStyle := lipgloss.NewStyle().Bold(true).Width(13)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Stats"), ""}
+	for _, r := range rows {
+		lines = append(lines, keyStyle.Render(r[0])+r[1])
+	}
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(m.popupWidth(60)).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+// specialNote describes the special files skipped below n.
+func specialNote(n *Node) string {
+	if n == nil || n.Special.Total() == 0 {
+		return "none skipped"
+	}
+	return fmt.Sprintf("%d skipped here and below (%s)", n.Special.Total(), n.Special)
+}
+
+func (statsOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "S", "q", "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "runtime"
+
+// residentBytes approximates RSS with the memory the Go runtime obtained
+// from the OS; exact figures need platform APIs not wired up here.
+func residentBytes() (uint64, bool) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys, true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompactModeKeepsCurrentPath(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	t.Cleanup(func() {
+		cache = sync.Map{}
+		dirRecords = sync.Map{}
+	})
+	for _, p := range []string{"/r", "/r/a", "/r/b", "/r/b/c"} {
+		cache.Store(p, &Node{Path: p})
+		dirRecords.Store(p, &dirRecord{})
+	}
+
+	m := initialModel("/r", 1, false)
+	m.breadcrumbs = []string{"/r", "/r/a"}
+	m.memLimit = 1 // any heap is over the cap
+	if cmd := m.checkMemory(); cmd == nil {
+		t.Fatal("expected the memory check to keep ticking")
+	}
+	if !m.compact || !strings.Contains(m.status, "compact mode on, pruned 0 and dropped 2") {
+		t.Fatalf("expected compact mode, status %q", m.status)
+	}
+	for p, want := range map[string]bool{"/r": true, "/r/a": true, "/r/b": false, "/r/b/c": false} {
+		if _, ok := cache.Load(p); ok != want {
+			t.Errorf("cache has %s = %v; want %v", p, ok, want)
+		}
+		if _, ok := dirRecords.Load(p); ok != want {
+			t.Errorf("dirRecords has %s = %v; want %v", p, ok, want)
+		}
+	}
+	if !strings.Contains(statsOverlay{}.View(m), "compact mode") {
+		t.Fatal("stats overlay should report compact mode")
+	}
+}
+
+func TestPrunedNodesKeepTotalsAndReexpand(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	t.Cleanup(func() {
+		cache = sync.Map{}
+		dirRecords = sync.Map{}
+	})
+	tmp := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	full := s.scanDir(context.Background(), tmp)
+	cache.Store("/kept", &Node{Path: "/kept", Children: []*Node{{Name: "x"}}})
+
+	if n := pruneCache([]string{"/kept"}); n != 1 {
+		t.Fatalf("pruned %d nodes; want 1", n)
+	}
+	v, _ := cache.Load(tmp)
+	p := v.(*Node)
+	if !p.Pruned || p.Children != nil || p.Size != 20 || p.Files != 2 {
+		t.Fatalf("pruned node should keep totals only: %+v", p)
+	}
+	if len(full.Children) != 2 {
+		t.Fatal("pruning must not modify nodes already handed out")
+	}
+	if again := s.scanDir(context.Background(), tmp); again.Pruned || len(again.Children) != 2 {
+		t.Fatalf("revisiting a pruned directory should rescan it: %+v", again)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// --------------------------- Mounts ------------------------------
+
+// mountInfo describes the filesystem a path lives on.
+type mountInfo struct {
+	Point  string // mount point, e.g. "/home"
+	FSType string // e.g. "ext4", "nfs4", "fuse.sshfs"
+	Source string // device or remote, e.g. "server:/export"
+	Remote bool   // known to be remote regardless of FSType (Windows network drives)
+	// Emulated is Android's shared storage: local flash behind FUSE or
+	// sdcardfs, which ignores case and has no stable inode numbers
+	Emulated bool
+}
+
+// networkFSTypes are filesystems where every stat is a round trip.
+var networkFSTypes = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb": true, "smbfs": true, "smb2": true, "smb3": true,
+	"afpfs": true, "webdav": true, "davfs": true, "9p": true, "ncpfs": true, "glusterfs": true,
+	"ceph": true, "lustre": true, "gpfs": true, "afs": true, "remote": true,
+}
+
+// network reports whether the mount is a network or FUSE filesystem.
+func (mi mountInfo) network() bool {
+	if mi.Emulated {
+		return false
+	}
+	t := strings.ToLower(mi.FSType)
+	return mi.Remote || networkFSTypes[t] || t == "fuse" || strings.HasPrefix(t, "fuse.") || strings.HasPrefix(t, "fuseblk")
+}
+
+// mountTable maps paths to the mount holding them.
+type mountTable struct {
+	mounts []mountInfo // longest mount point first
+}
+
+var (
+	mountsOnce sync.Once
+	mounts     *mountTable
+)
+
+// systemMounts returns the mount table, read once per process.
+func systemMounts() *mountTable {
+	mountsOnce.Do(func() {
+		mounts = newMountTable(readMounts())
+	})
+	return mounts
+}
+
+func newMountTable(ms []mountInfo) *mountTable {
+	sort.SliceStable(ms, func(i, j int) bool { return len(ms[i].Point) > len(ms[j].Point) })
+	return &mountTable{mounts: ms}
+}
+
+// lookup returns the mount holding path. Unknown paths yield an empty
+// mountInfo, which is treated as a local filesystem.
+func (t *mountTable) lookup(path string) mountInfo {
+	if t == nil {
+		return mountInfo{}
+	}
+	p := filepath.Clean(path)
+	for _, mi := range t.mounts {
+		if mountContains(mi.Point, p) {
+			return mi
+		}
+	}
+	return fallbackMount(p)
+}
+
+// isMountPoint reports whether path is itself a mount point.
+func (t *mountTable) isMountPoint(path string) (mountInfo, bool) {
+	mi := t.lookup(path)
+	return mi, mi.Point != "" && samePoint(mi.Point, filepath.Clean(path))
+}
+
+// mountNote annotates a mount point row, e.g. "ext4 /dev/sdb1, excluded".
+func mountNote(mi mountInfo, excluded bool) string {
+	parts := []string{}
+	for _, s := range []string{mi.FSType, mi.Source} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if excluded {
+		parts = append(parts, "excluded")
+	} else {
+		parts = append(parts, "included")
+	}
+	return strings.Join(parts, " ")
+}
+
+func mountContains(point, p string) bool {
+	if samePoint(point, p) {
+		return true
+	}
+	prefix := point
+	if !strings.HasSuffix(prefix, string(os.PathSeparator)) {
+		prefix += string(os.PathSeparator)
+	}
+	return hasPathPrefix(p, prefix)
+}
+
+// samePoint compares cleaned paths, ignoring case on Windows. Mount lookups
+// use it rather than samePath, which needs the mount table itself.
+func samePoint(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// hasPathPrefix is strings.HasPrefix, ignoring case on Windows.
+func hasPathPrefix(p, prefix string) bool {
+	if runtime.GOOS == "windows" {
+		return len(p) >= len(prefix) && strings.EqualFold(p[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(p, prefix)
+}
@@ -0,0 +1,37 @@
+//go:build darwin || freebsd || openbsd
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// readMounts lists mounted filesystems with getfsstat(2).
+func readMounts() []mountInfo {
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil || n == 0 {
+		return nil
+	}
+	buf := make([]unix.Statfs_t, n)
+	n, err = unix.Getfsstat(buf, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil
+	}
+	out := make([]mountInfo, 0, n)
+	for i := range buf[:n] {
+		out = append(out, fsstatMount(&buf[i]))
+	}
+	return out
+}
+
+// cString converts a NUL-terminated C char array to a string.
+func cString[T int8 | byte](b []T) string {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		out = append(out, byte(c))
+	}
+	return string(out)
+}
+
+func fallbackMount(string) mountInfo { return mountInfo{} }
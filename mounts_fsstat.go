@@ -0,0 +1,13 @@
+//go:build darwin || freebsd
+
+package main
+
+import "golang.org/x/sys/unix"
+
+func fsstatMount(st *unix.Statfs_t) mountInfo {
+	return mountInfo{
+		Point:  cString(st.Mntonname[:]),
+		FSType: cString(st.Fstypename[:]),
+		Source: cString(st.Mntfromname[:]),
+	}
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// readMounts parses /proc/self/mountinfo.
+func readMounts() []mountInfo {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	var out []mountInfo
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		if mi, ok := parseMountInfoLine(sc.Text()); ok {
+			out = append(out, mi)
+		}
+	}
+	return out
+}
+
+// parseMountInfoLine parses one line of /proc/self/mountinfo:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+func parseMountInfoLine(line string) (mountInfo, bool) {
+	pre, post, ok := strings.Cut(line, " - ")
+	if !ok {
+		return mountInfo{}, false
+	}
+	f := strings.Fields(pre)
+	g := strings.Fields(post)
+	if len(f) < 5 || len(g) < 2 {
+		return mountInfo{}, false
+	}
+	return mountInfo{Point: unescapeMount(f[4]), FSType: g[0], Source: unescapeMount(g[1])}, true
+}
+
+// unescapeMount decodes the octal escapes (\040 for space etc.) used in mountinfo.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			v := 0
+			okOct := true
+			for _, c := range s[i+1 : i+4] {
+				if c < '0' || c > '7' {
+					okOct = false
+					break
+				}
+				v = v*8 + int(c-'0')
+			}
+			if okOct {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func fallbackMount(string) mountInfo { return mountInfo{} }
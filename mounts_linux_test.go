@@ -0,0 +1,22 @@
+//go:build linux
+
+package main
+
+import "testing"
+
+func TestParseMountInfoLine(t *testing.T) {
+	line := `36 35 98:0 / /mnt/my\040share rw,noatime master:1 - nfs4 server:/export rw,vers=4.2`
+	mi, ok := parseMountInfoLine(line)
+	if !ok {
+		t.Fatalf("failed to parse %q", line)
+	}
+	if mi.Point != "/mnt/my share" || mi.FSType != "nfs4" || mi.Source != "server:/export" {
+		t.Fatalf("parsed %+v", mi)
+	}
+	if !mi.network() {
+		t.Fatalf("nfs4 should be a network filesystem")
+	}
+	if _, ok := parseMountInfoLine("garbage"); ok {
+		t.Fatalf("garbage line should not parse")
+	}
+}
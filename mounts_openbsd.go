@@ -0,0 +1,12 @@
+package main
+
+import "golang.org/x/sys/unix"
+
+// OpenBSD's struct statfs prefixes its fields with f_.
+func fsstatMount(st *unix.Statfs_t) mountInfo {
+	return mountInfo{
+		Point:  cString(st.F_mntonname[:]),
+		FSType: cString(st.F_fstypename[:]),
+		Source: cString(st.F_mntfromname[:]),
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !windows
+
+package main
+
+// readMounts is not implemented on this platform; every path is treated as
+// being on a local filesystem.
+func readMounts() []mountInfo { return nil }
+
+func fallbackMount(string) mountInfo { return mountInfo{} }
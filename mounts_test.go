@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMountTableLookup(t *testing.T) {
+	mt := newMountTable([]mountInfo{
+		{Point: "/", FSType: "ext4"},
+		{Point: "/mnt/nas", FSType: "nfs4", Source: "nas:/export"},
+		{Point: "/mnt/nas2", FSType: "fuse.sshfs"},
+	})
+	cases := []struct {
+		path    string
+		point   string
+		network bool
+	}{
+		{"/home/user", "/", false},
+		{"/mnt/nas", "/mnt/nas", true},
+		{"/mnt/nas/photos/2020", "/mnt/nas", true},
+		{"/mnt/nas2/x", "/mnt/nas2", true}, // not swallowed by the /mnt/nas prefix
+		{"/mnt/nasty", "/", false},
+	}
+	for _, c := range cases {
+		mi := mt.lookup(c.path)
+		if mi.Point != c.point || mi.network() != c.network {
+			t.Errorf("lookup(%q) = %+v (network=%v); want point %q network=%v", c.path, mi, mi.network(), c.point, c.network)
+		}
+	}
+	if _, ok := mt.isMountPoint("/mnt/nas"); !ok {
+		t.Errorf("/mnt/nas should be a mount point")
+	}
+	if _, ok := mt.isMountPoint("/mnt/nas/photos"); ok {
+		t.Errorf("/mnt/nas/photos should not be a mount point")
+	}
+}
+
+func TestScannerLimitsNetworkConcurrency(t *testing.T) {
+	s := &Scanner{threads: 32, netThreads: 4}
+	if got := s.limitFor(mountInfo{FSType: "cifs"}); got != 4 {
+		t.Fatalf("limitFor(cifs) = %d; want 4", got)
+	}
+	if got := s.limitFor(mountInfo{FSType: "ext4"}); got != 32 {
+		t.Fatalf("limitFor(ext4) = %d; want 32", got)
+	}
+}
+
+func TestOneFileSystemExcludesMountPoints(t *testing.T) {
+	root := t.TempDir()
+	for name, size := range map[string]int{"f": 1, "vol/big": 1000, "a/g": 10, "a/vol2/h": 100} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mt := newMountTable([]mountInfo{
+		{Point: filepath.Join(root, "vol"), FSType: "xfs", Source: "/dev/sdb1"},
+		{Point: filepath.Join(root, "a", "vol2"), FSType: "tmpfs"},
+	})
+
+	for _, tc := range []struct {
+		one  bool
+		want int64
+		note string
+	}{
+		{false, 1111, "[xfs /dev/sdb1 included]"},
+		{true, 11, "[xfs /dev/sdb1 excluded]"},
+	} {
+		cache = sync.Map{}
+		dirRecords = sync.Map{}
+		m := initialModel(root, 2, false)
+		t.Cleanup(m.cancel)
+		m.loading = false
+		m.scanner.mounts = mt
+		m.scanner.oneFileSystem = tc.one
+		m.current, _ = m.scanner.scan(context.Background(), root, false, nil)
+		if m.current.Size != tc.want {
+			t.Fatalf("one-file-system=%v: total %d; want %d", tc.one, m.current.Size, tc.want)
+		}
+		m.setTableRowsFromNode(m.current)
+		found := false
+		for i, r := range m.tbl.Rows() {
+			if m.rows[i].Name != "vol" {
+				continue
+			}
+			found = true
+			if !strings.Contains(r[0], "💽") || !strings.Contains(r[0], tc.note) {
+				t.Fatalf("one-file-system=%v: mount row %q should carry %s", tc.one, r[0], tc.note)
+			}
+			if tc.one != (r[1] == "excluded") {
+				t.Fatalf("one-file-system=%v: size cell %q", tc.one, r[1])
+			}
+		}
+		if !found {
+			t.Fatalf("missing the vol row")
+		}
+	}
+}
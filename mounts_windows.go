@@ -0,0 +1,55 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// readMounts lists drive letters with their filesystem type. Network drives
+// report "remote" when the share doesn't expose a filesystem name.
+func readMounts() []mountInfo {
+	var out []mountInfo
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil
+	}
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		root := string(rune('A'+i)) + `:\`
+		out = append(out, volumeMount(root))
+	}
+	return out
+}
+
+func volumeMount(root string) mountInfo {
+	p, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return mountInfo{Point: root}
+	}
+	mi := mountInfo{Point: root, Source: root}
+	fsName := make([]uint16, windows.MAX_PATH+1)
+	if windows.GetVolumeInformation(p, nil, 0, nil, nil, nil, &fsName[0], uint32(len(fsName))) == nil {
+		mi.FSType = windows.UTF16ToString(fsName)
+	}
+	if windows.GetDriveType(p) == windows.DRIVE_REMOTE {
+		mi.Remote = true
+		if mi.FSType == "" {
+			mi.FSType = "remote"
+		}
+	}
+	return mi
+}
+
+// fallbackMount handles UNC paths (\\server\share\...), which are always remote.
+func fallbackMount(p string) mountInfo {
+	if vol := filepath.VolumeName(p); strings.HasPrefix(vol, `\\`) {
+		return mountInfo{Point: vol + `\`, FSType: "smb", Source: vol, Remote: true}
+	}
+	return mountInfo{}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// --------------------------- Name normalization ------------------
+
+// normalizeNames is set where the filesystem treats a name's NFC and NFD
+// forms as the same file. macOS (APFS, HFS+) does, and hands back names in
+// whichever form they were created with, so "é" typed in Terminal and "é"
+// written by a Finder copy can both name one entry. Elsewhere the two forms
+// are different files and must stay apart.
+var normalizeNames = runtime.GOOS == "darwin"
+
+// pathKey is p in the form used to compare paths and key caches: NFC where
+// normalizeNames is set, and lower case below the mount point when that
+// volume ignores case. Node.Path and everything handed to the OS keep the
+// on-disk form.
+func pathKey(p string) string {
+	if normalizeNames && !isASCII(p) {
+		p = norm.NFC.String(p)
+	}
+	mi := systemMounts().lookup(p)
+	if !volumeFoldsCase(mi) {
+		return p
+	}
+	if runtime.GOOS == "windows" {
+		return strings.ToLower(p) // drive letters and UNC hosts ignore case too
+	}
+	// the part up to the mount point lives on the parent volume; it was
+	// matched against mi.Point, so its spelling is already canonical
+	n := min(len(mi.Point), len(p))
+	return p[:n] + strings.ToLower(p[n:])
+}
+
+// samePath reports whether a and b name the same entry.
+func samePath(a, b string) bool {
+	return a == b || pathKey(a) == pathKey(b)
+}
+
+// underPath reports whether p is dir or below it.
+func underPath(p, dir string) bool {
+	p, dir = pathKey(p), pathKey(dir)
+	sep := string(os.PathSeparator)
+	if strings.HasSuffix(dir, sep) { // a root such as / or C:\
+		return strings.HasPrefix(p, dir)
+	}
+	return p == dir || strings.HasPrefix(p, dir+sep)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// caseFolding caches volumeFoldsCase per mount point.
+var caseFolding sync.Map // map[string]bool
+
+// volumeFoldsCase reports whether the volume mi treats names differing only
+// in case as the same file. It is probed once per mount point.
+func volumeFoldsCase(mi mountInfo) bool {
+	if v, ok := caseFolding.Load(mi.Point); ok {
+		return v.(bool)
+	}
+	if mi.Emulated {
+		return true // the probe compares inode numbers, which it lacks
+	}
+	point := mi.Point
+	if point == "" {
+		point = string(os.PathSeparator)
+		if runtime.GOOS == "windows" {
+			point = `C:\`
+		}
+	}
+	folds, ok := probeCaseFolding(point)
+	if !ok {
+		folds = defaultFoldsCase(mi)
+	}
+	caseFolding.Store(mi.Point, folds)
+	return folds
+}
+
+// probeCaseFolding looks up an entry of dir under its name with the case
+// swapped. ok is false when dir has no entry with letters to try.
+func probeCaseFolding(dir string) (folds, ok bool) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return false, false
+	}
+	names, _ := f.Readdirnames(64)
+	_ = f.Close()
+	for _, name := range names {
+		swapped := swapCase(name)
+		if swapped == name {
+			continue
+		}
+		if containsName(names, swapped) {
+			return false, true // both spellings are separate entries
+		}
+		fi, err := os.Lstat(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		other, err := os.Lstat(filepath.Join(dir, swapped))
+		return err == nil && os.SameFile(fi, other), true
+	}
+	return false, false
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// caseInsensitiveFSTypes ignore case whatever the OS.
+var caseInsensitiveFSTypes = map[string]bool{
+	"vfat": true, "msdos": true, "msdosfs": true, "exfat": true, "ntfs": true, "ntfs3": true, "fuseblk": true,
+	"cifs": true, "smb": true, "smbfs": true, "smb2": true, "smb3": true,
+}
+
+// defaultFoldsCase guesses for volumes that can't be probed: by filesystem
+// type, else by platform default (APFS and NTFS ignore case as set up by
+// default; Linux and BSD filesystems don't).
+func defaultFoldsCase(mi mountInfo) bool {
+	if caseInsensitiveFSTypes[strings.ToLower(mi.FSType)] {
+		return true
+	}
+	return runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+}
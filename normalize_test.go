@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNFCAndNFDNamesMatchWhereTheFilesystemSaysSo(t *testing.T) {
+	nfc, nfd := "caf\u00e9", "cafe\u0301"
+	t.Cleanup(func(old bool) func() { return func() { normalizeNames = old } }(normalizeNames))
+
+	normalizeNames = false
+	if samePath("/x/"+nfc, "/x/"+nfd) {
+		t.Fatalf("without normalization the two forms are different files")
+	}
+
+	normalizeNames = true
+	cache = sync.Map{}
+	if !samePath("/x/"+nfc, "/x/"+nfd) || !underPath("/x/"+nfd+"/a", "/x/"+nfc) {
+		t.Fatalf("NFC and NFD forms should compare equal")
+	}
+
+	dir := t.TempDir()
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Children: []*Node{
+		{Name: nfc, Path: filepath.Join(dir, nfc), IsDir: true, Size: -1},
+	}}
+	m.Update(childUpdateMsg{parent: dir, child: &Node{Name: nfd, Path: filepath.Join(dir, nfd), IsDir: true, Size: 10}, token: m.scanToken})
+	if n := len(m.current.Children); n != 1 || m.current.Children[0].Size != 10 {
+		t.Fatalf("the update should replace the listed child, got %d children", n)
+	}
+	if m.current.Children[0].Path != filepath.Join(dir, nfd) {
+		t.Fatalf("the on-disk form of the name should be kept")
+	}
+
+	cache.Store(pathKey(filepath.Join(dir, nfc)), &Node{Path: filepath.Join(dir, nfc)})
+	if _, ok := cache.Load(pathKey(filepath.Join(dir, nfd))); !ok {
+		t.Fatalf("cache lookups should not depend on the form")
+	}
+	forgetCachedSubtree(filepath.Join(dir, nfd))
+	if _, ok := cache.Load(pathKey(filepath.Join(dir, nfc))); ok {
+		t.Fatalf("forgetting the subtree should find the other form")
+	}
+}
+
+func TestCaseInsensitiveVolumesShareKeys(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Probe.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if folds, ok := probeCaseFolding(dir); !ok {
+		t.Fatalf("a directory with letters in its names should be probed")
+	} else if _, err := os.Stat(filepath.Join(dir, "probe.TXT")); folds != (err == nil) {
+		t.Fatalf("probe says folds=%v, but stat of the other spelling gave %v", folds, err)
+	}
+	if _, ok := probeCaseFolding(t.TempDir()); ok {
+		t.Fatalf("an empty directory can't tell")
+	}
+
+	mi := systemMounts().lookup(dir)
+	old, had := caseFolding.Load(mi.Point)
+	t.Cleanup(func() {
+		if had {
+			caseFolding.Store(mi.Point, old)
+		} else {
+			caseFolding.Delete(mi.Point)
+		}
+	})
+	caseFolding.Store(mi.Point, false)
+	if samePath(filepath.Join(dir, "Foo"), filepath.Join(dir, "foo")) {
+		t.Fatalf("a case-sensitive volume keeps Foo and foo apart")
+	}
+	caseFolding.Store(mi.Point, true)
+	if !samePath(filepath.Join(dir, "Foo"), filepath.Join(dir, "foo")) || !underPath(filepath.Join(dir, "FOO", "x"), filepath.Join(dir, "foo")) {
+		t.Fatalf("a case-insensitive volume should treat Foo and foo as one path")
+	}
+	if k := pathKey(filepath.Join(dir, "Foo")); !strings.HasPrefix(k, mi.Point) {
+		t.Fatalf("the mount point's own spelling should be kept, got %q", k)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Offload -----------------------------
+
+// offloadTarget is archival storage the selection can be moved to with
+// rsync or rclone, configured under "offload" in config.json:
+//
+//	{"name": "nas", "tool": "rsync", "dest": "nas:/archive"}
+//	{"name": "b2", "tool": "rclone", "dest": "b2:bucket/archive", "args": ["--transfers", "8"]}
+//
+// The selection lands in dest under its own name. args are added to the
+// tool's own flags.
+type offloadTarget struct {
+	Name string   `json:"name"`
+	Tool string   `json:"tool"`
+	Dest string   `json:"dest"`
+	Args []string `json:"args,omitempty"`
+}
+
+// Tools for offload targets.
+const (
+	toolRsync  = "rsync"
+	toolRclone = "rclone"
+)
+
+// offloadTargets checks the configured targets, leaving out and reporting
+// the ones that can't work.
+func offloadTargets(ts []offloadTarget) ([]offloadTarget, []string) {
+	var out []offloadTarget
+	var problems []string
+	for _, t := range ts {
+		switch {
+		case t.Name == "" || t.Dest == "":
+			problems = append(problems, fmt.Sprintf("offload target %q needs a name and dest", t.Name))
+		case t.Tool != toolRsync && t.Tool != toolRclone:
+			problems = append(problems, fmt.Sprintf("offload target %q: tool %q is not rsync or rclone", t.Name, t.Tool))
+		default:
+			out = append(out, t)
+		}
+	}
+	return out, problems
+}
+
+// command is the tool's command line moving src to the target. rsync
+// removes the files it sent (finishOffload prunes the directories left
+// behind); rclone's move does both.
+func (t offloadTarget) command(src string, isDir bool) []string {
+	dest := strings.TrimRight(t.Dest, "/")
+	if t.Tool == toolRsync {
+		args := []string{toolRsync, "-a", "--remove-source-files", "--info=progress2"}
+		return append(append(args, t.Args...), src, dest+"/")
+	}
+	verb := "moveto"
+	if isDir {
+		verb = "move"
+	}
+	args := []string{toolRclone, verb, src, dest + "/" + filepath.Base(src),
+		"--stats", "1s", "--stats-one-line", "--stats-log-level", "NOTICE"}
+	if isDir {
+		args = append(args, "--delete-empty-src-dirs")
+	}
+	return append(args, t.Args...)
+}
+
+// offloadJob is a running offload. The tool's output is kept for the
+// dialog, and its progress is read from the percentages it prints.
+type offloadJob struct {
+	target  offloadTarget
+	node    *Node
+	line    []string
+	out     offloadOutput
+	cancel  context.CancelFunc
+	started time.Time
+}
+
+type offloadDoneMsg struct {
+	job *offloadJob
+	err error
+}
+
+type offloadProgressMsg struct{}
+
+func offloadProgressTick() tea.Cmd {
+	return tea.Tick(200*time.Millisecond, func(time.Time) tea.Msg { return offloadProgressMsg{} })
+}
+
+// offloadTail is how many output lines are kept, for the error shown when
+// the tool fails.
+const offloadTail = 50
+
+var percentRE = regexp.MustCompile(`(\d{1,3})%`)
+
+// offloadOutput keeps the last lines of the tool's output and the last
+// percentage in it. Both tools redraw their progress line with \r.
+type offloadOutput struct {
+	mu      sync.Mutex
+	partial string
+	lines   []string
+	percent atomic.Int64 // -1 until the tool reports one
+}
+
+func (o *offloadOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.partial + string(p)
+	parts := strings.FieldsFunc(s, func(r rune) bool { return r == '\r' || r == '\n' })
+	o.partial = ""
+	if n := len(s); n > 0 && s[n-1] != '\r' && s[n-1] != '\n' && len(parts) > 0 {
+		o.partial, parts = parts[len(parts)-1], parts[:len(parts)-1]
+	}
+	for _, l := range parts {
+		if m := percentRE.FindAllStringSubmatch(l, -1); m != nil {
+			if v, err := strconv.Atoi(m[len(m)-1][1]); err == nil && v <= 100 {
+				o.percent.Store(int64(v))
+			}
+		}
+		if strings.TrimSpace(l) != "" {
+			o.lines = append(o.lines, l)
+		}
+	}
+	if len(o.lines) > offloadTail {
+		o.lines = o.lines[len(o.lines)-offloadTail:]
+	}
+	return len(p), nil
+}
+
+// last is the most recent output line.
+func (o *offloadOutput) last() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.lines) == 0 {
+		return ""
+	}
+	return o.lines[len(o.lines)-1]
+}
+
+// promptOffload offers the configured targets for the selection.
+func (m *model) promptOffload() {
+	if m.offloadJob != nil {
+		m.overlays.push(offloadProgressOverlay{})
+		return
+	}
+	sel := m.selected()
+	if sel == nil {
+		return
+	}
+	if len(m.offload) == 0 {
+		m.status = "No offload targets; add them under \"offload\" in " + m.configPath
+		return
+	}
+	if rule, ok := m.protect.match(sel.Path); ok {
+		m.status = fmt.Sprintf("⚠ %s is protected (%s) and can't be offloaded", sel.Name, rule)
+		return
+	}
+	m.overlays.push(&offloadOverlay{node: sel})
+}
+
+// startOffload runs t's tool on n in the background.
+func (m *model) startOffload(t offloadTarget, n *Node) tea.Cmd {
+	line := t.command(n.Path, n.IsDir)
+	if _, err := exec.LookPath(line[0]); err != nil {
+		m.status = fmt.Sprintf("⚠ offload to %s: %v", t.Name, err)
+		return nil
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	job := &offloadJob{target: t, node: n, line: line, cancel: cancel, started: time.Now()}
+	job.out.percent.Store(-1)
+	x := exec.CommandContext(ctx, line[0], line[1:]...)
+	x.Stdout, x.Stderr = &job.out, &job.out
+	if err := x.Start(); err != nil {
+		cancel()
+		m.status = fmt.Sprintf("⚠ offload to %s: %v", t.Name, err)
+		return nil
+	}
+	m.offloadJob = job
+	m.overlays.push(offloadProgressOverlay{})
+	done := func() tea.Msg {
+		defer crashGuard()
+		err := x.Wait()
+		if ctx.Err() != nil {
+			err = context.Canceled
+		} else if err != nil {
+			if l := job.out.last(); l != "" {
+				err = fmt.Errorf("%w: %s", err, l)
+			}
+		}
+		cancel()
+		return offloadDoneMsg{job: job, err: err}
+	}
+	return tea.Batch(done, offloadProgressTick())
+}
+
+// finishOffload reports the offload. When the selection is gone its size
+// comes off the totals as a delete's would; otherwise what is left of it
+// is rescanned, since the tool may have moved part of it.
+func (m *model) finishOffload(msg offloadDoneMsg) tea.Cmd {
+	job := msg.job
+	m.offloadJob = nil
+	m.overlays.remove("offload-progress")
+	n, path := job.node, job.node.Path
+	if msg.err == nil && n.IsDir {
+		pruneEmptyDirs(path)
+	}
+	parent := filepath.Dir(path)
+	invalidateSums(path)
+	audit("offload", path, job.target.Name, n.Size, msg.err)
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		m.removeChild(parent, path)
+		propagateDelta(parent, trashDelta(&TrashItem{IsDir: n.IsDir, Size: maxInt64(n.Size, 0), Files: n.Files, Dirs: n.Dirs, Disk: n.Disk, Cloud: n.Cloud}).negate())
+		if m.current != nil && samePath(m.current.Path, parent) {
+			m.setTableRowsFromNode(m.current)
+		}
+		m.freed.offloaded(n.Size)
+		m.status = fmt.Sprintf("Offloaded %s (%s) to %s in %s", n.Name, humanBytes(maxInt64(n.Size, 0)), job.target.Name, time.Since(job.started).Round(time.Second))
+		return nil
+	}
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		m.status = fmt.Sprintf("Offload to %s canceled; files already sent are gone from %s", job.target.Name, n.Name)
+	case msg.err != nil:
+		m.status = fmt.Sprintf("⚠ offload to %s failed: %v", job.target.Name, msg.err)
+	default:
+		m.status = fmt.Sprintf("Offloaded %s to %s; some entries were left behind", n.Name, job.target.Name)
+	}
+	cache.Delete(pathKey(parent))
+	forgetCachedSubtree(path)
+	if !m.loading && m.current != nil && samePath(m.current.Path, parent) {
+		status := m.status
+		cmd := m.rescanCurrent(false)
+		m.status = status
+		return cmd
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes the directories rsync leaves behind after moving
+// their files, deepest first. Directories still holding anything stay.
+func pruneEmptyDirs(root string) {
+	var dirs []string
+	_ = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() {
+			dirs = append(dirs, p)
+		}
+		return nil
+	})
+	for i := len(dirs) - 1; i >= 0; i-- {
+		_ = os.Remove(dirs[i]) // fails unless empty
+	}
+}
+
+// offloadOverlay picks the target for an offload. It shows the command
+// that will run, and Enter starts it.
+type offloadOverlay struct {
+	node   *Node
+	cursor int
+}
+
+func (o *offloadOverlay) opts() overlayOpts {
+	return overlayOpts{id: "offload", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *offloadOverlay) View(m *model) string {
+	w := m.popupWidth(80)
+	inner := maxvalue(10, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(truncateToWidth("Offload "+sanitizeLine(o.node.Name)+" ("+humanBytes(maxInt64(o.node.Size, 0))+")", inner)),
+		"",
+	}
+	for i, t := range m.offload {
+		line := truncateToWidth(fmt.Sprintf("%-12s %-7s %s", t.Name, t.Tool, sanitizeLine(t.Dest)), inner)
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if o.cursor < len(m.offload) {
+		t := m.offload[o.cursor]
+		lines = append(lines, "", faint.Render(truncateToWidth("$ "+sanitizeLine(strings.Join(t.command(o.node.Path, o.node.IsDir), " ")), inner)))
+	}
+	lines = append(lines, "", faint.Render("The selection is moved: it is removed here once sent, and u can't undo it"),
+		faint.Render("↑/↓ target  Enter move  Esc cancel"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *offloadOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "q":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(m.offload)-1), o.cursor+1)
+	case "enter":
+		if o.cursor >= len(m.offload) {
+			return nil, true
+		}
+		m.overlays.remove("offload")
+		return m.startOffload(m.offload[o.cursor], o.node), true
+	}
+	return nil, false
+}
+
+// offloadProgressOverlay shows a running offload. Esc stops the tool;
+// Enter hides the dialog and leaves progress in the status line.
+type offloadProgressOverlay struct{}
+
+func (offloadProgressOverlay) opts() overlayOpts {
+	return overlayOpts{id: "offload-progress", z: zDialog, focusable: true}
+}
+
+func (offloadProgressOverlay) View(m *model) string {
+	w := m.popupWidth(70)
+	inner := maxvalue(10, w-6)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render("Offloading ...")}
+	if job := m.offloadJob; job != nil {
+		lines = append(lines, "",
+			truncateToWidth(sanitizeLine(job.node.Path)+" → "+job.target.Name, inner),
+			truncateToWidth(sanitizeLine(job.out.last()), inner))
+		if p := job.out.percent.Load(); p >= 0 {
+			lines = append(lines, bar(float64(p)/100, inner))
+		}
+		lines = append(lines, fmt.Sprintf("elapsed %s", time.Since(job.started).Round(time.Second)))
+	}
+	lines = append(lines, "", lipgloss.NewStyle().Faint(true).Render("Esc stop  Enter run in background"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+func (offloadProgressOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc":
+		if m.offloadJob != nil {
+			m.offloadJob.cancel()
+			m.status = "Stopping offload ..."
+		}
+		return nil, true
+	case "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
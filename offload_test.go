@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestOffloadTargets(t *testing.T) {
+	ts, problems := offloadTargets([]offloadTarget{
+		{Name: "nas", Tool: "rsync", Dest: "nas:/archive/"},
+		{Name: "b2", Tool: "rclone", Dest: "b2:bucket", Args: []string{"--transfers", "8"}},
+		{Name: "tape", Tool: "tar", Dest: "/dev/st0"},
+		{Tool: "rsync"},
+	})
+	if len(ts) != 2 || len(problems) != 2 {
+		t.Fatalf("got %v, problems %v", ts, problems)
+	}
+	if got := strings.Join(ts[0].command("/data/old", true), " "); got != "rsync -a --remove-source-files --info=progress2 /data/old nas:/archive/" {
+		t.Errorf("rsync line %q", got)
+	}
+	if got := strings.Join(ts[1].command("/data/old", true), " "); !strings.HasPrefix(got, "rclone move /data/old b2:bucket/old ") || !strings.HasSuffix(got, "--delete-empty-src-dirs --transfers 8") {
+		t.Errorf("rclone line %q", got)
+	}
+	if got := ts[1].command("/data/a.iso", false); got[1] != "moveto" {
+		t.Errorf("files are moved with moveto, got %v", got)
+	}
+}
+
+func TestOffloadOutputProgress(t *testing.T) {
+	var o offloadOutput
+	o.percent.Store(-1)
+	_, _ = o.Write([]byte("sending incremental file list\n     1,024   3%  1.00MB/s"))
+	if o.percent.Load() != -1 {
+		t.Fatal("an unfinished line should wait for its end")
+	}
+	_, _ = o.Write([]byte("\r    32,768  45%  2.00MB/s\r"))
+	if o.percent.Load() != 45 || !strings.Contains(o.last(), "45%") {
+		t.Fatalf("percent %d, last %q", o.percent.Load(), o.last())
+	}
+}
+
+func TestOffloadRemovesSelection(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake rsync is a shell script")
+	}
+	bin := t.TempDir()
+	// moves the files like --remove-source-files, leaving the directories
+	script := "#!/bin/sh\nfor a; do src=$dst; dst=$a; done\necho '  9  100%  1.00kB/s'\nfind \"$src\" -type f -exec rm {} +\n"
+	if err := os.WriteFile(filepath.Join(bin, "rsync"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	root := t.TempDir()
+	old := filepath.Join(root, "old")
+	if err := os.MkdirAll(filepath.Join(old, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(old, "sub", "f"), []byte("123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(root, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m.offload = []offloadTarget{{Name: "nas", Tool: "rsync", Dest: "nas:/archive"}}
+	keep := &Node{Name: "keep", Path: filepath.Join(root, "keep"), Size: 5, Files: 1}
+	m.current = &Node{Path: root, IsDir: true, Size: 14, Files: 2, Dirs: 2, Children: []*Node{
+		{Name: "old", Path: old, IsDir: true, Size: 9, Files: 1, Dirs: 1}, keep,
+	}}
+	m.setTableRowsFromNode(m.current)
+
+	m.promptOffload()
+	if !m.overlays.has("offload") {
+		t.Fatal("O should open the target picker")
+	}
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.offloadJob == nil {
+		t.Fatalf("the offload should be running: %s", m.status)
+	}
+	for _, c := range cmd().(tea.BatchMsg) {
+		if d, ok := c().(offloadDoneMsg); ok {
+			m.Update(d)
+			break
+		}
+	}
+	if _, err := os.Lstat(old); !os.IsNotExist(err) {
+		t.Fatal("the directories left by rsync should be pruned")
+	}
+	if len(m.current.Children) != 1 || m.current.Size != 5 || !strings.Contains(m.status, "Offloaded old") {
+		t.Fatalf("totals not updated: %d children, size %d, status %q", len(m.current.Children), m.current.Size, m.status)
+	}
+}
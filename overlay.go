@@ -0,0 +1,550 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// --------------------------- Overlays ----------------------------
+
+// overlay is a dialog drawn on top of the main view. All dialogs share the
+// model's overlay stack, which takes care of z-ordering, background dimming
+// and routing key input to the focused dialog.
+type overlay interface {
+	// opts describes how the stack should treat the overlay.
+	opts() overlayOpts
+	// View renders the popup content; the stack centers it on screen.
+	View(m *model) string
+	// Update handles a key while the overlay has focus. Returning true closes it.
+	Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool)
+}
+
+type overlayOpts struct {
+	id        string // unique per dialog kind; pushing the same id replaces it
+	z         int    // higher values are drawn above lower ones
+	dim       bool   // fade everything below this overlay
+	focusable bool   // receives key input while on the stack
+	// corner anchors the overlay at the bottom right instead of the
+	// center, for toasts
+	corner bool
+}
+
+// Well-known z levels so unrelated dialogs stack predictably.
+const (
+	zStatus = 0  // passive indicators such as the loading popup
+	zDialog = 10 // interactive dialogs
+	zAlert  = 20 // dialogs that must sit above everything else
+)
+
+type overlayStack struct {
+	items []overlay
+}
+
+// push adds o to the stack, replacing an existing overlay with the same id.
+func (s *overlayStack) push(o overlay) {
+	s.remove(o.opts().id)
+	s.items = append(s.items, o)
+}
+
+func (s *overlayStack) remove(id string) {
+	out := s.items[:0]
+	for _, o := range s.items {
+		if o.opts().id != id {
+			out = append(out, o)
+		}
+	}
+	s.items = out
+}
+
+func (s *overlayStack) has(id string) bool {
+	return s.get(id) != nil
+}
+
+func (s *overlayStack) get(id string) overlay {
+	for _, o := range s.items {
+		if o.opts().id == id {
+			return o
+		}
+	}
+	return nil
+}
+
+func (s *overlayStack) empty() bool { return len(s.items) == 0 }
+
+// ordered returns overlays bottom to top: by z, then by push order.
+func (s *overlayStack) ordered() []overlay {
+	out := append([]overlay(nil), s.items...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].opts().z < out[j].opts().z })
+	return out
+}
+
+// focused returns the topmost focusable overlay, or nil if keys should go to
+// the main view.
+func (s *overlayStack) focused() overlay {
+	ord := s.ordered()
+	for i := len(ord) - 1; i >= 0; i-- {
+		if ord[i].opts().focusable {
+			return ord[i]
+		}
+	}
+	return nil
+}
+
+// compose draws every overlay over base, which must already be a full
+// width×height screen.
+func (s *overlayStack) compose(m *model, base string, width, height int) string {
+	screen := base
+	for _, o := range s.ordered() {
+		if o.opts().dim {
+			screen = dimBackground(screen)
+		}
+		place := centered
+		if o.opts().corner {
+			place = bottomRight
+		}
+		screen = renderOverlayAt(screen, o.View(m), width, height, place)
+	}
+	return screen
+}
+
+// dimBackground renders s faint, dropping any existing styling so that
+// highlighted rows don't punch through the dimmed layer.
+func dimBackground(s string) string {
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = faint.Render(ansi.Strip(l))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// popupWidth clamps a preferred popup width to the terminal to avoid wrap/clipping.
+func (m *model) popupWidth(pref int) int {
+	if m.width > 0 {
+		return minvalue(pref, maxvalue(10, m.width-4))
+	}
+	return pref
+}
+
+// --------------------------- Dialogs -----------------------------
+
+// loadingOverlay is the passive popup shown while a scan is running.
+type loadingOverlay struct{}
+
+func (loadingOverlay) opts() overlayOpts {
+	return overlayOpts{id: "loading", z: zStatus}
+}
+
+func (loadingOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.NormalBorder()).Padding(1, 2).Width(m.popupWidth(50)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	content := lipgloss.JoinHorizontal(lipgloss.Center, m.busyIndicator(), " ", m.status)
+	return modalStyle.Render(content)
+}
+
+func (loadingOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) { return nil, false }
+
+// confirmDeleteOverlay asks before moving path to the trash. Items at or
+// above the size threshold (or of unknown size) need a second confirmation.
+type confirmDeleteOverlay struct {
+	path    string
+	name    string
+	size    int64 // -1 while still being scanned
+	files   int64
+	dirs    int64
+	crossFS bool // trash is on another filesystem, so the move is a copy
+	// trash is where the item will go, shown when -trash-dir or
+	// trash_mounts moved it from the default
+	trash string
+	// noRoom is set when that filesystem has too little free space (free)
+	// for the copy; the dialog then offers a permanent delete instead
+	noRoom bool
+	free   int64
+	large  bool
+	stage  int // 0 = first prompt, 1 = extra confirmation for large items
+	focus  int // 0 = yes, 1 = no
+}
+
+func newConfirmDelete(n *Node, threshold int64) *confirmDeleteOverlay {
+	o := &confirmDeleteOverlay{
+		path:    n.Path,
+		name:    n.Name,
+		size:    n.Size,
+		files:   n.Files,
+		dirs:    n.Dirs,
+		crossFS: crossesFilesystem(n.Path),
+	}
+	if trashDirOverride != "" || len(trashRoutes) > 0 {
+		o.trash = trashDirFor(n.Path)
+	}
+	o.large = threshold > 0 && (n.Size < 0 || n.Size >= threshold)
+	if o.crossFS && n.Size >= 0 {
+		if free, ok := trashRoom(n.Path, n.Size); !ok {
+			o.noRoom, o.free, o.focus = true, free, 1
+		}
+	}
+	return o
+}
+
+// newConfirmPermanent offers to delete path permanently after the trash
+// turned out to lack room for it.
+func newConfirmPermanent(path string, free, need int64) *confirmDeleteOverlay {
+	return &confirmDeleteOverlay{path: path, name: filepath.Base(path), size: need, files: -1, crossFS: true, noRoom: true, free: free, focus: 1}
+}
+
+func (o *confirmDeleteOverlay) opts() overlayOpts {
+	return overlayOpts{id: "confirm-delete", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *confirmDeleteOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(m.popupWidth(60)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	size := "size unknown (still scanning)"
+	if o.size >= 0 {
+		size = humanBytes(o.size)
+	}
+	lines := []string{"Delete " + o.name + "?"}
+	if o.files >= 0 {
+		lines = append(lines, fmt.Sprintf("%s — %d files, %d dirs", size, o.files, o.dirs))
+	} else {
+		lines = append(lines, size)
+	}
+	if o.trash != "" && !o.noRoom {
+		lines = append(lines, lipgloss.NewStyle().Faint(true).Render("→ trash: "+sanitizeLine(o.trash)))
+	}
+	switch {
+	case o.noRoom:
+		lines = append(lines,
+			warn.Render(fmt.Sprintf("The trash is on another filesystem with only %s free: it doesn't fit", humanBytes(max(0, o.free)))),
+			warn.Render("Delete it permanently instead? This can't be undone"))
+	case o.crossFS:
+		lines = append(lines, warn.Render("Trash is on another filesystem: this is a slow copy"))
+	}
+	if o.stage == 1 {
+		sure := "This is a large delete. Are you really sure?"
+		if o.noRoom {
+			sure = "Permanently delete " + o.name + "? There is no undo."
+		}
+		lines = append(lines, "", warn.Bold(true).Render(sure))
+	}
+	footer := buttonRow(o.focus, "Yes", "No")
+	if o.noRoom {
+		footer = buttonRow(o.focus, "Delete permanently", "Cancel")
+	}
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", footer))
+}
+
+func (o *confirmDeleteOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "left", "h":
+		o.focus = 0
+	case "right", "l":
+		o.focus = 1
+	case "tab":
+		o.focus = (o.focus + 1) % 2
+	case "enter":
+		if o.focus != 0 {
+			m.status = "Canceled"
+			return nil, true
+		}
+		if (o.large || o.noRoom) && o.stage == 0 {
+			// ask again, defaulting to No so a double Enter doesn't delete
+			o.stage = 1
+			o.focus = 1
+			return nil, false
+		}
+		if o.noRoom {
+			return m.deletePermanently(o.path), true
+		}
+		return m.deleteToTrash(o.path), true
+	case "esc":
+		m.status = ""
+		return nil, true
+	}
+	// swallow all other keys while the dialog is open (modal behavior)
+	return nil, false
+}
+
+// elevatedDeleteOverlay explains a delete refused for lack of permission
+// and offers to retry it through sudo or pkexec.
+type elevatedDeleteOverlay struct {
+	path  string
+	hint  string
+	focus int // 0 = retry, 1 = cancel
+}
+
+func newElevatedDelete(path, hint string) *elevatedDeleteOverlay {
+	return &elevatedDeleteOverlay{path: path, hint: hint, focus: 1}
+}
+
+func (o *elevatedDeleteOverlay) opts() overlayOpts {
+	return overlayOpts{id: "elevated-delete", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *elevatedDeleteOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(m.popupWidth(60)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	elev := "sudo"
+	if p, err := elevatorCommand(); err == nil {
+		elev = filepath.Base(p)
+	}
+	lines := []string{
+		"Permission denied deleting " + filepath.Base(o.path),
+		warn.Render(o.hint),
+		"Retry with " + elev + "? It still goes to your trash",
+	}
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", buttonRow(o.focus, "Delete with "+elev, "Cancel")))
+}
+
+func (o *elevatedDeleteOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "left", "h":
+		o.focus = 0
+	case "right", "l":
+		o.focus = 1
+	case "tab":
+		o.focus = (o.focus + 1) % 2
+	case "enter":
+		if o.focus != 0 {
+			m.status = "Canceled"
+			return nil, true
+		}
+		return m.deleteElevated(o.path), true
+	case "esc":
+		m.status = ""
+		return nil, true
+	}
+	return nil, false
+}
+
+// buttonRow renders a horizontal row of buttons with the focused one highlighted.
+func buttonRow(focus int, labels ...string) string {
+	parts := make([]string, 0, len(labels)*2)
+	for i, l := range labels {
+		st := lipgloss.NewStyle().Padding(0, 2)
+		if i == focus {
+			st = st.Background(lipgloss.Color("2")).Foreground(lipgloss.Color("0"))
+		}
+		if i > 0 {
+			parts = append(parts, " ")
+		}
+		parts = append(parts, st.Render(" "+l+" "))
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Center, parts...)
+}
+
+// detailsOverlay shows everything known about a single entry.
+type detailsOverlay struct {
+	title string
+	rows  [][2]string
+}
+
+func newDetailsOverlay(m *model, n *Node) *detailsOverlay {
+	o := &detailsOverlay{title: n.Name}
+	add := func(k, v string) { o.rows = append(o.rows, [2]string{k, v}) }
+	add("Path", n.Path)
+	if fi, err := os.Lstat(n.Path); err == nil {
+		kind := "file"
+		if fi.IsDir() {
+			kind = "directory"
+		} else if fi.Mode()&os.ModeSymlink != 0 {
+			kind = "symlink"
+		}
+		add("Type", kind)
+		add("Mode", fi.Mode().String())
+		if flags := fileFlags(fi); len(flags) > 0 {
+			add("Flags", strings.Join(flags, ", "))
+		}
+		add("Modified", fi.ModTime().Format("2006-01-02 15:04:05"))
+		if !fi.IsDir() {
+			if x := xattrDetail(n.Path, m.scanner.xattrs); x != "" {
+				add("Xattrs", x)
+			}
+		}
+	}
+	if n.NoAccess {
+		add("Size", "unknown — no access (press ! to rescan as administrator)")
+	} else if n.Size >= 0 {
+		add("Size", fmt.Sprintf("%s (%d bytes)", humanBytes(n.Size), n.Size))
+	} else {
+		add("Size", "scanning ...")
+	}
+	if n.Cloud > 0 {
+		add("Local", fmt.Sprintf("%s — %s is in cloud-sync placeholders, online only; deleting them frees no space here", humanBytes(localSize(n)), humanBytes(n.Cloud)))
+	}
+	add("Files", fmt.Sprintf("%d", n.Files))
+	add("Dirs", fmt.Sprintf("%d", n.Dirs))
+	if st, ok := detectStore(n.Path); ok {
+		add("Store", st.name+" — press d for its reclaim commands")
+	}
+	if m.profile.restrictedNote(n.Path) != "" {
+		add("Android", "apps may not list this directory; sizes are what Termux can see")
+	}
+	if n.LinkTarget != "" {
+		add("Link target", n.LinkTarget)
+		add("Counted", m.scanner.linkAttribution(n))
+	}
+	mi := m.scanner.mounts.lookup(n.Path)
+	if mi.FSType != "" {
+		fsDesc := fmt.Sprintf("%s on %s", mi.FSType, mi.Point)
+		if mi.Source != "" {
+			fsDesc += " (" + mi.Source + ")"
+		}
+		if volumeFoldsCase(mi) {
+			fsDesc += ", case-insensitive"
+		}
+		if mi.Emulated {
+			fsDesc += ", Android shared storage (no inode info)"
+		}
+		add("Filesystem", fsDesc)
+		if _, ok := m.scanner.mounts.isMountPoint(n.Path); ok {
+			if m.scanner.excludesMount(n.Path) {
+				add("Mount point", "yes — not counted in the parent's total (-one-file-system)")
+			} else {
+				add("Mount point", "yes — counted in the parent's total")
+			}
+		}
+		if mi.network() {
+			add("Network", fmt.Sprintf("yes — %d workers, batched listing", m.scanner.limitFor(mi)))
+		}
+	}
+	if n.Changed {
+		add("Changed", "entries vanished while it was scanned and are not counted — press r to rescan")
+	}
+	if n.Truncated {
+		add("Truncated", fmt.Sprintf("directories more than %d levels down are not counted (a loop or recursive bind mount?) — see -max-depth", maxTreeDepth))
+	}
+	if n.Err != nil {
+		add("Error", n.Err.Error())
+	}
+	return o
+}
+
+func (o *detailsOverlay) opts() overlayOpts {
+	return overlayOpts{id: "details", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *detailsOverlay) View(m *model) string {
+	w := m.popupWidth(70)
+	keyStyle := lipgloss.NewStyle().Bold(true).Width(12)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(o.title), ""}
+	for _, r := range o.rows {
+		lines = append(lines, keyStyle.Render(r[0])+truncateToWidth(r[1], maxvalue(10, w-18)))
+	}
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *detailsOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "i", "q", "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
+
+// helpOverlay lists the key bindings.
+type helpOverlay struct{}
+
+var helpKeys = [][2]string{
+	{"↑/↓", "move"},
+	{"Enter", "open directory"},
+	{"Backspace", "go up"},
+	{"a", "auto-drill into the largest child until none holds half"},
+	{"s / n / x", "sort by size / name / own size"},
+	{"c", "sort by cleanup score (adds a Score column)"},
+	{"z", "sort by size on disk (with -compressed)"},
+	{"r", "rescan (reuses unchanged subtrees)"},
+	{"F", "full rescan (ignores cached sums)"},
+	{"P", "pause / resume scan or export"},
+	{"e", "export CSV"},
+	{"E", "export CSV to a chosen file"},
+	{"X", "deep export of the whole subtree (with filters)"},
+	{"ctrl+s", "save the session as a .dtree file (disktree open)"},
+	{"g", "go to path"},
+	{"/", "filter by name"},
+	{".", "hide / show hidden entries"},
+	{"R", "rename selection"},
+	{"C", "copy selection to another directory"},
+	{"O", "offload selection to archival storage (rsync/rclone; u can't undo it)"},
+	{"M", "plan mode: d adds to a cleanup plan instead of deleting"},
+	{"m", "review, save or run the cleanup plan"},
+	{"i", "details of selection"},
+	{"o", "toggle owner and mode columns"},
+	{"b / B", "pin selection to the basket / compare the basket"},
+	{"I / ctrl+u", "ignore selection for this session / bring all back"},
+	{"p", "toggle preview of selection"},
+	{"L", "largest directories anywhere"},
+	{"v", "chart of the current directory"},
+	{"f", "analyzer findings"},
+	{"S", "memory and cache stats"},
+	{"D", "scan debug view (workers, queue)"},
+	{"d", "delete (move to trash)"},
+	{"u / ctrl+r", "undo / redo delete, rename, copy"},
+	{"H", "audit log of deletes, restores and moves"},
+	{"A", "toggle rescan after delete"},
+	{"Q / @", "record a key macro / replay one here"},
+	{"T", "retry every folder that failed, e.g. after fixing permissions"},
+	{"!", "rescan unreadable selection with sudo/pkexec (UAC on Windows)"},
+	{"W", "WSL: size Windows drives with disktree.exe"},
+	{"ctrl+z", "suspend to the shell (fg resumes)"},
+	{"?", "toggle this help"},
+	{"q", "quit"},
+}
+
+func (helpOverlay) opts() overlayOpts {
+	return overlayOpts{id: "help", z: zDialog, dim: true, focusable: true}
+}
+
+func (helpOverlay) View(m *model) string {
+	keyStyle := lipgloss.NewStyle().Bold(true).Width(12)
+	// border, padding and the title take 6 rows; split the keys into two
+	// columns when they don't fit underneath
+	_, h := m.screenSize()
+	keys := helpKeys
+	for _, k := range slices.Sorted(maps.Keys(m.userCommands)) {
+		keys = append(keys[:len(keys):len(keys)], [2]string{k, m.userCommands[k].label()})
+	}
+	cols, width := 1, 50
+	if len(keys) > h-6 && m.popupWidth(96) == 96 {
+		cols, width = 2, 96
+	}
+	perCol := (len(keys) + cols - 1) / cols
+	colStyle := lipgloss.NewStyle().Width((width - 6) / cols)
+	var columns []string
+	for c := 0; c < cols; c++ {
+		var lines []string
+		for _, k := range keys[c*perCol : minvalue(len(keys), (c+1)*perCol)] {
+			line := keyStyle.Render(k[0]) + k[1]
+			if cols > 1 {
+				// wrapped entries would put the columns out of step
+				line = ansi.Truncate(line, colStyle.GetWidth()-1, "…")
+			}
+			lines = append(lines, line)
+		}
+		columns = append(columns, colStyle.Render(strings.Join(lines, "\n")))
+	}
+	body := lipgloss.NewStyle().Bold(true).Render("Keys") + "\n\n" + lipgloss.JoinHorizontal(lipgloss.Top, columns...)
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(m.popupWidth(width)).Background(lipgloss.Color("0"))
+	return modalStyle.Render(body)
+}
+
+func (helpOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "?", "q", "enter":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
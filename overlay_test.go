@@ -1,8 +1,12 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
@@ -229,4 +233,138 @@ func TestOverlayPreservesContentAfterPopup(t *testing.T) {
 			t.Errorf("Overlay line missing content after popup. Line: %q", overlayLine)
 		}
 	}
-}
\ No newline at end of file
+}
+
+type stubOverlay struct {
+	id        string
+	z         int
+	focusable bool
+}
+
+func (s stubOverlay) opts() overlayOpts {
+	return overlayOpts{id: s.id, z: s.z, focusable: s.focusable}
+}
+func (s stubOverlay) View(m *model) string { return s.id }
+func (s stubOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	return nil, false
+}
+
+func TestOverlayStackOrderingAndFocus(t *testing.T) {
+	var s overlayStack
+	s.push(stubOverlay{id: "loading", z: zStatus})
+	s.push(stubOverlay{id: "alert", z: zAlert, focusable: true})
+	s.push(stubOverlay{id: "dialog", z: zDialog, focusable: true})
+
+	var ids []string
+	for _, o := range s.ordered() {
+		ids = append(ids, o.opts().id)
+	}
+	if got := strings.Join(ids, ","); got != "loading,dialog,alert" {
+		t.Fatalf("ordered() = %s; want loading,dialog,alert", got)
+	}
+	if f := s.focused(); f == nil || f.opts().id != "alert" {
+		t.Fatalf("focused() = %v; want alert", f)
+	}
+
+	// pushing the same id replaces instead of duplicating
+	s.push(stubOverlay{id: "dialog", z: zDialog, focusable: true})
+	if len(s.items) != 3 {
+		t.Fatalf("expected 3 overlays after re-push, got %d", len(s.items))
+	}
+
+	s.remove("alert")
+	if f := s.focused(); f == nil || f.opts().id != "dialog" {
+		t.Fatalf("focused() after remove = %v; want dialog", f)
+	}
+	s.remove("dialog")
+	if f := s.focused(); f != nil {
+		t.Fatalf("non-focusable overlay should not take focus, got %v", f.opts().id)
+	}
+}
+
+func TestConfirmDeleteLargeNeedsSecondConfirmation(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	n := &Node{Name: "big", Path: "/nonexistent/big", Size: 2 << 30}
+	o := newConfirmDelete(n, 1<<30)
+	if !o.large {
+		t.Fatalf("expected item above threshold to be large")
+	}
+	// first Yes escalates instead of deleting
+	if _, closed := o.Update(m, tea.KeyMsg{Type: tea.KeyEnter}); closed {
+		t.Fatalf("large delete closed after first confirmation")
+	}
+	if o.stage != 1 || o.focus != 1 {
+		t.Fatalf("expected second stage focused on No, got stage=%d focus=%d", o.stage, o.focus)
+	}
+	// Enter on the default (No) cancels
+	if _, closed := o.Update(m, tea.KeyMsg{Type: tea.KeyEnter}); !closed || m.status != "Canceled" {
+		t.Fatalf("expected cancel, closed=%v status=%q", closed, m.status)
+	}
+
+	small := newConfirmDelete(&Node{Name: "s", Path: "/nonexistent/s", Size: 10}, 1<<30)
+	if small.large {
+		t.Fatalf("small item should not need extra confirmation")
+	}
+}
+
+func TestConfirmPermanentWhenTrashIsFull(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	if _, err := freeSpace(t.TempDir()); err == nil {
+		if _, ok := trashRoom(t.TempDir(), 1<<62); ok {
+			t.Fatal("an exabyte should not fit in the trash")
+		}
+	}
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "dump")
+	if err := os.MkdirAll(filepath.Join(victim, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(dir, 1, false)
+	m.current = &Node{Name: "dir", Path: dir, IsDir: true, Scanned: true, Size: 5 << 30,
+		Children: []*Node{{Name: "dump", Path: victim, IsDir: true, Size: 5 << 30, Dirs: 1}}}
+	cache.Store(pathKey(dir), m.current)
+	t.Cleanup(func() { cache.Delete(pathKey(dir)) })
+
+	o := newConfirmPermanent(victim, 1<<30, 5<<30)
+	if !strings.Contains(o.View(m), "Delete permanently") || o.focus != 1 {
+		t.Fatalf("the dialog should offer a permanent delete, focused on Cancel:\n%s", o.View(m))
+	}
+	left := tea.KeyMsg{Type: tea.KeyLeft}
+	enter := tea.KeyMsg{Type: tea.KeyEnter}
+	o.Update(m, left)
+	if _, closed := o.Update(m, enter); closed || o.stage != 1 {
+		t.Fatal("a permanent delete needs a second confirmation")
+	}
+	o.Update(m, left)
+	if _, closed := o.Update(m, enter); !closed {
+		t.Fatal("expected the dialog to close")
+	}
+	if _, err := os.Lstat(victim); !os.IsNotExist(err) {
+		t.Fatalf("%s should be gone: %v", victim, err)
+	}
+	if len(m.current.Children) != 0 || m.freed.total != 5<<30 || !strings.Contains(m.status, "permanently") {
+		t.Fatalf("view not updated: %d children, freed %d, status %q", len(m.current.Children), m.freed.total, m.status)
+	}
+}
+
+func TestTourDismissalIsRemembered(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	path := filepath.Join(t.TempDir(), "conf", "config.json")
+	if err := saveConfig(path, Config{ConfirmThreshold: "5G"}); err != nil {
+		t.Fatal(err)
+	}
+	o := tourOverlay{configPath: path}
+	if _, closed := o.Update(m, tea.KeyMsg{Type: tea.KeyDown}); closed {
+		t.Fatalf("tour closed on an unrelated key")
+	}
+	if _, closed := o.Update(m, tea.KeyMsg{Type: tea.KeyEnter}); !closed {
+		t.Fatalf("expected Enter to dismiss the tour")
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TourSeen || cfg.ConfirmThreshold != "5G" {
+		t.Fatalf("expected tour_seen recorded and other settings kept, got %+v", cfg)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Pacing ------------------------------
+
+// Defaults of -debounce, -tick and -fps.
+const (
+	defaultDebounce = 100 * time.Millisecond
+	defaultTick     = 120 * time.Millisecond
+	defaultFPS      = 60
+)
+
+// Defaults of -loading-min and -loading-quick: the loading overlay stays
+// up for at least defaultLoadingMin so it doesn't flicker, except after a
+// scan finishing within defaultLoadingQuick, whose result is shown at once.
+const (
+	defaultLoadingMin   = 500 * time.Millisecond
+	defaultLoadingQuick = 100 * time.Millisecond
+)
+
+// Limits of the automatic tick: it doubles while a tick sees more than
+// busyUpdates scan updates, up to maxAutoTick, and halves back towards the
+// configured tick once they drop below calmUpdates.
+const (
+	busyUpdates = 200
+	calmUpdates = 20
+	maxAutoTick = time.Second
+)
+
+// pacer decides how often a running scan redraws the table. Scan updates
+// gather for debounce before the table is rebuilt, and the loading tick
+// (row spinners, rows of pending directories) fires every tick. In auto
+// mode the tick stretches while updates pour in, so a slow terminal over
+// SSH isn't flooded with redraws, and the debounce stretches with it.
+type pacer struct {
+	debounce time.Duration
+	tick     time.Duration
+	auto     bool
+	cur      time.Duration // the tick in use; tick unless auto stretched it
+	updates  int           // scan updates since the last tick
+	running  bool          // a loading tick is scheduled
+}
+
+func newPacer() pacer {
+	return pacer{debounce: defaultDebounce, tick: defaultTick, cur: defaultTick}
+}
+
+// parsePacing reads -debounce and -tick. tick is a duration, or "auto" or
+// "auto:<duration>" for the automatic mode starting from that interval.
+func parsePacing(debounce, tick string) (pacer, error) {
+	p := newPacer()
+	if debounce != "" {
+		d, err := time.ParseDuration(debounce)
+		if err != nil || d <= 0 {
+			return p, fmt.Errorf("debounce %q is not a positive duration", debounce)
+		}
+		p.debounce = d
+	}
+	if rest, ok := strings.CutPrefix(tick, "auto"); ok {
+		p.auto = true
+		tick = strings.TrimPrefix(rest, ":")
+	}
+	if tick != "" {
+		d, err := time.ParseDuration(tick)
+		if err != nil || d < 10*time.Millisecond {
+			return p, fmt.Errorf("tick %q is not a duration of at least 10ms (or auto)", tick)
+		}
+		p.tick = d
+	}
+	p.cur = p.tick
+	return p, nil
+}
+
+// parseLoadingTimes reads -loading-min and -loading-quick; either may be 0.
+func parseLoadingTimes(minimum, quick string) (time.Duration, time.Duration, error) {
+	lmin, err := time.ParseDuration(minimum)
+	if err != nil || lmin < 0 {
+		return 0, 0, fmt.Errorf("loading-min %q is not a duration", minimum)
+	}
+	lquick, err := time.ParseDuration(quick)
+	if err != nil || lquick < 0 {
+		return 0, 0, fmt.Errorf("loading-quick %q is not a duration", quick)
+	}
+	return lmin, lquick, nil
+}
+
+// debounceFor is how long updates gather before the next table rebuild.
+func (p *pacer) debounceFor() time.Duration {
+	if p.auto {
+		return max(p.debounce, p.cur)
+	}
+	return p.debounce
+}
+
+// ticked adapts the automatic tick to the updates seen since the last one.
+func (p *pacer) ticked() {
+	if p.auto {
+		switch {
+		case p.updates > busyUpdates:
+			p.cur = min(2*p.cur, max(maxAutoTick, p.tick))
+		case p.updates < calmUpdates:
+			p.cur = max(p.cur/2, p.tick)
+		}
+	}
+	p.updates = 0
+}
+
+// loadingTick schedules the next loading tick, unless one is pending: every
+// scan start asks for one, and the ticks must not pile up.
+func (m *model) loadingTick() tea.Cmd {
+	if m.pacer.running {
+		return nil
+	}
+	m.pacer.running = true
+	return tea.Tick(m.pacer.cur, func(t time.Time) tea.Msg {
+		return loadingTickMsg(t)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParsePacing(t *testing.T) {
+	p, err := parsePacing("250ms", "auto:50ms")
+	if err != nil || p.debounce != 250*time.Millisecond || !p.auto || p.tick != 50*time.Millisecond || p.cur != p.tick {
+		t.Fatalf("unexpected %+v, %v", p, err)
+	}
+	if p, err := parsePacing("", "auto"); err != nil || !p.auto || p.tick != defaultTick || p.debounce != defaultDebounce {
+		t.Fatalf("auto alone keeps the default interval, got %+v, %v", p, err)
+	}
+	for _, tc := range [][2]string{{"0s", "120ms"}, {"soon", "120ms"}, {"100ms", "1ms"}, {"100ms", "autox"}} {
+		if _, err := parsePacing(tc[0], tc[1]); err == nil {
+			t.Errorf("parsePacing(%q, %q) should fail", tc[0], tc[1])
+		}
+	}
+}
+
+func TestAutoTickFollowsUpdateVolume(t *testing.T) {
+	p, _ := parsePacing("100ms", "auto:100ms")
+	for i := 0; i < 10; i++ {
+		p.updates = busyUpdates + 1
+		p.ticked()
+	}
+	if p.cur != maxAutoTick || p.debounceFor() != maxAutoTick {
+		t.Fatalf("a flood of updates should stretch the tick to %v, got %v", maxAutoTick, p.cur)
+	}
+	p.updates = (busyUpdates + calmUpdates) / 2
+	p.ticked()
+	if p.cur != maxAutoTick {
+		t.Fatalf("moderate volume keeps the interval, got %v", p.cur)
+	}
+	for i := 0; i < 10; i++ {
+		p.ticked()
+	}
+	if p.cur != 100*time.Millisecond || p.debounceFor() != 100*time.Millisecond {
+		t.Fatalf("a quiet scan returns to the configured tick, got %v", p.cur)
+	}
+
+	fixed := newPacer()
+	fixed.updates = 10 * busyUpdates
+	fixed.ticked()
+	if fixed.cur != defaultTick {
+		t.Fatalf("a fixed tick never changes, got %v", fixed.cur)
+	}
+}
+
+func TestLoadingTicksDontPileUp(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	t.Cleanup(m.cancel)
+	m.setLoading(true)
+	if m.loadingTick() == nil || m.loadingTick() != nil {
+		t.Fatalf("a second scan start must not add another tick")
+	}
+	m.Update(loadingTickMsg(time.Now()))
+	if !m.pacer.running {
+		t.Fatalf("the tick continues while loading")
+	}
+	m.setLoading(false)
+	m.Update(loadingTickMsg(time.Now()))
+	if m.pacer.running {
+		t.Fatalf("the tick stops once nothing is loading")
+	}
+}
+
+func TestParseLoadingTimes(t *testing.T) {
+	lmin, quick, err := parseLoadingTimes("300ms", "0")
+	if err != nil || lmin != 300*time.Millisecond || quick != 0 {
+		t.Fatalf("unexpected %v, %v, %v", lmin, quick, err)
+	}
+	for _, tc := range [][2]string{{"-1s", "100ms"}, {"500ms", "later"}} {
+		if _, _, err := parseLoadingTimes(tc[0], tc[1]); err == nil {
+			t.Errorf("parseLoadingTimes(%q, %q) should fail", tc[0], tc[1])
+		}
+	}
+}
+
+func TestCachedNavigationSkipsLoadingMinimum(t *testing.T) {
+	cache = sync.Map{}
+	root := t.TempDir()
+	sub := filepath.Join(root, "sub")
+	m := initialModel(root, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	cached := &Node{Name: filepath.Base(root), Path: root, IsDir: true, Scanned: true, Size: 10, Children: []*Node{
+		{Name: "sub", Path: sub, IsDir: true, Size: 10, Files: 1, Scanned: true},
+	}}
+	sumChildren(cached)
+	cache.Store(pathKey(root), cached)
+	m.breadcrumbs = []string{root, sub}
+	m.current = &Node{Name: "sub", Path: sub, IsDir: true, Scanned: true}
+
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	if !m.loading {
+		t.Fatal("going up starts loading")
+	}
+	for _, c := range cmd().(tea.BatchMsg) {
+		if msg, ok := c().(scanDoneMsg); ok {
+			if !msg.cached {
+				t.Fatal("the parent should come from the cache")
+			}
+			m.Update(msg)
+		}
+	}
+	if m.loading || m.current != cached {
+		t.Fatalf("a cached directory should show at once, loading=%v", m.loading)
+	}
+	if !strings.Contains(m.status, "r rescans") {
+		t.Errorf("status should say the listing is cached: %q", m.status)
+	}
+}
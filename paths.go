@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+)
+
+// --------------------------- Paths -------------------------------
+
+// Where disktree keeps its files. Each location follows the platform
+// convention, so package-manager installs (Homebrew, Scoop) never write next
+// to the binary:
+//
+//	           Linux/BSD                  macOS                                  Windows
+//	config     $XDG_CONFIG_HOME/disktree  ~/Library/Application Support/disktree %APPDATA%\disktree
+//	data       $XDG_DATA_HOME/disktree    ~/Library/Application Support/disktree %LOCALAPPDATA%\disktree
+//	cache      $XDG_CACHE_HOME/disktree   ~/Library/Caches/disktree              %LOCALAPPDATA%\disktree\cache
+//
+// XDG_DATA_HOME, when set, wins on every platform.
+
+// configDir holds config.json.
+func configDir() string {
+	if d, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(d, "disktree")
+	}
+	return filepath.Join(os.TempDir(), "disktree")
+}
+
+// dataDir is where disktree keeps its trash, crash reports and snapshots.
+func dataDir() string {
+	if td := os.Getenv("XDG_DATA_HOME"); td != "" {
+		return filepath.Join(td, "disktree")
+	}
+	switch runtime.GOOS {
+	case "windows":
+		if d := os.Getenv("LOCALAPPDATA"); d != "" {
+			return filepath.Join(d, "disktree")
+		}
+	case "darwin":
+		if h, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(h, "Library", "Application Support", "disktree")
+		}
+	default:
+		if h, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(h, ".local", "share", "disktree")
+		}
+	}
+	return filepath.Join(os.TempDir(), "disktree")
+}
+
+// cacheDir holds data that can be rebuilt at any time.
+func cacheDir() string {
+	if d, err := os.UserCacheDir(); err == nil {
+		if runtime.GOOS == "windows" {
+			// UserCacheDir is %LOCALAPPDATA% itself, shared with dataDir
+			return filepath.Join(d, "disktree", "cache")
+		}
+		return filepath.Join(d, "disktree")
+	}
+	return filepath.Join(os.TempDir(), "disktree", "cache")
+}
+
+// getTrashDir is the default trash: -trash-dir (trash_dir) if set, else
+// the data directory's. trash_mounts may send deletes elsewhere, see
+// trashDirFor.
+func getTrashDir() string {
+	if trashDirOverride != "" {
+		return trashDirOverride
+	}
+	return filepath.Join(dataDir(), "trash")
+}
+
+func crashDir() string          { return filepath.Join(dataDir(), "crashes") }
+func snapshotsDir() string      { return filepath.Join(dataDir(), "snapshots") }
+func journalDir() string        { return filepath.Join(dataDir(), "journal") }
+func scansDir() string          { return filepath.Join(dataDir(), "scans") }
+func defaultConfigPath() string { return filepath.Join(configDir(), "config.json") }
+
+// legacyDataDir is where versions before platform paths kept their data on
+// every OS, "" unless it still exists. Its trash is read with the others
+// (trashDirs) and `disktree paths` reports it.
+func legacyDataDir() string {
+	h, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	d := filepath.Join(h, ".local", "share", "disktree")
+	if d == dataDir() {
+		return ""
+	}
+	if _, err := os.Stat(d); err != nil {
+		return ""
+	}
+	return d
+}
+
+// runPaths prints where everything lives (`disktree paths`).
+func runPaths(w io.Writer) {
+	rows := [][2]string{
+		{"config", defaultConfigPath()},
+		{"data", dataDir()},
+		{"trash", getTrashDir()},
+		{"crashes", crashDir()},
+		{"snapshots", snapshotsDir()},
+		{"journal", journalDir()},
+		{"scans", scansDir()},
+		{"cache", cacheDir()},
+	}
+	for i, r := range trashRoutes {
+		rows = slices.Insert(rows, 3+i, [2]string{"trash", r.dir + " (for " + r.mount + ")"})
+	}
+	for _, r := range rows {
+		fmt.Fprintf(w, "%-10s %s\n", r[0], r[1])
+	}
+	if d := legacyDataDir(); d != "" {
+		fmt.Fprintf(w, "\nOlder data (trash, crash reports) was found in %s;\nits trash is still listed and restored, move the rest to %s.\n", d, dataDir())
+	}
+}
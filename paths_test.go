@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathsFollowXDGDataHome(t *testing.T) {
+	data := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", data)
+	if got, want := getTrashDir(), filepath.Join(data, "disktree", "trash"); got != want {
+		t.Fatalf("getTrashDir() = %q; want %q", got, want)
+	}
+	if got, want := crashDir(), filepath.Join(data, "disktree", "crashes"); got != want {
+		t.Fatalf("crashDir() = %q; want %q", got, want)
+	}
+	var b strings.Builder
+	runPaths(&b)
+	for _, want := range []string{"config", defaultConfigPath(), "trash", getTrashDir(), "cache", cacheDir()} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("paths output lacks %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestTrashDirAndMounts(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Cleanup(func() { _ = configureTrash("", nil) })
+	work := t.TempDir()
+	scratch := filepath.Join(work, "scratch")
+	own := filepath.Join(work, "own-trash")
+	scratchTrash := filepath.Join(scratch, ".trash")
+	if err := configureTrash(own, map[string]string{scratch: scratchTrash}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getTrashDir(); got != own {
+		t.Fatalf("getTrashDir() = %q; want the -trash-dir %q", got, own)
+	}
+	for p, want := range map[string]string{
+		filepath.Join(scratch, "out", "big.bin"): scratchTrash,
+		filepath.Join(work, "scratchy", "f"):     own,
+		filepath.Join(work, "notes.txt"):         own,
+	} {
+		if got := trashDirFor(p); got != want {
+			t.Errorf("trashDirFor(%q) = %q; want %q", p, got, want)
+		}
+	}
+
+	for _, p := range []string{filepath.Join(scratch, "big.bin"), filepath.Join(work, "notes.txt")} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ti, err := moveToTrash(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := filepath.Dir(ti.TrashPath), trashDirFor(p); got != want {
+			t.Fatalf("%s went to %q; want %q", p, got, want)
+		}
+	}
+	items, err := readAllTrash()
+	if err != nil || len(items) != 2 {
+		t.Fatalf("readAllTrash() = %d items, %v; want both trashes read", len(items), err)
+	}
+	var b strings.Builder
+	runPaths(&b)
+	if !strings.Contains(b.String(), scratchTrash+" (for "+scratch+")") {
+		t.Fatalf("paths output lacks the scratch trash:\n%s", b.String())
+	}
+	if o := newConfirmDelete(&Node{Name: "big.bin", Path: filepath.Join(scratch, "x"), Size: 1}, 0); o.trash != scratchTrash {
+		t.Fatalf("confirm dialog names trash %q; want %q", o.trash, scratchTrash)
+	}
+}
+
+func TestLegacyTrashIsStillRead(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	// deleted by a version that kept its data in ~/.local/share everywhere
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, ".local", "share"))
+	p := filepath.Join(t.TempDir(), "old.txt")
+	if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := moveToTrash(p); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	items, err := readAllTrash()
+	if err != nil || len(items) != 1 || items[0].OrigPath != p {
+		t.Fatalf("readAllTrash() = %v, %v; want the legacy item", items, err)
+	}
+	var out strings.Builder
+	if err := runTrash([]string{"restore", p}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Fatalf("not restored from the legacy trash: %v", err)
+	}
+	var b strings.Builder
+	runPaths(&b)
+	if !strings.Contains(b.String(), filepath.Join(home, ".local", "share", "disktree")) {
+		t.Fatalf("paths output doesn't mention the legacy data:\n%s", b.String())
+	}
+}
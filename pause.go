@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// --------------------------- Pausing -----------------------------
+
+// pauseGate holds scan and export workers between directories while the
+// user has paused them, e.g. to free disk bandwidth for something else.
+// Workers finish the listing they are in and wait before the next one, so
+// resuming carries on where the walk stopped. The zero value is running.
+type pauseGate struct {
+	mu     sync.Mutex
+	resume chan struct{} // non-nil while paused; closed on resume
+	since  time.Time
+}
+
+// pause stops workers at their next directory.
+func (g *pauseGate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil {
+		g.resume = make(chan struct{})
+		g.since = time.Now()
+	}
+}
+
+// unpause releases waiting workers and returns how long they were held.
+func (g *pauseGate) unpause() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.resume == nil {
+		return 0
+	}
+	close(g.resume)
+	g.resume = nil
+	return time.Since(g.since)
+}
+
+// paused reports whether workers are being held.
+func (g *pauseGate) paused() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.resume != nil
+}
+
+// wait blocks while paused. It returns false if ctx ends first.
+func (g *pauseGate) wait(ctx context.Context) bool {
+	if g == nil {
+		return ctx.Err() == nil
+	}
+	g.mu.Lock()
+	ch := g.resume
+	g.mu.Unlock()
+	if ch == nil {
+		return ctx.Err() == nil
+	}
+	select {
+	case <-ch:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// togglePause pauses or resumes the running scan or export.
+func (m *model) togglePause() {
+	g := m.scanner.gate
+	if g.paused() {
+		d := g.unpause()
+		m.status = "Resumed after " + d.Round(time.Second).String()
+		return
+	}
+	if !m.loading && m.exportJob == nil {
+		m.status = "Nothing to pause"
+		return
+	}
+	g.pause()
+}
+
+// loadingBadge is the header note of a running scan.
+func (m *model) loadingBadge() string {
+	if m.scanner.gate.paused() {
+		return "[" + m.busyIndicator() + "]"
+	}
+	return "[" + m.busyIndicator() + " scanning]"
+}
+
+// busyIndicator is the spinner, or a pause sign while workers are held.
+func (m *model) busyIndicator() string {
+	if m.scanner.gate.paused() {
+		return "⏸ paused — P to resume"
+	}
+	return m.spin.View()
+}
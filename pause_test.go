@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPausedWalkResumes(t *testing.T) {
+	dirRecords = sync.Map{}
+	root := t.TempDir()
+	for _, d := range []string{"a", "a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, d, "f"), make([]byte, 10), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Scanner{threads: 2, gate: &pauseGate{}}
+	s.gate.pause()
+	done := make(chan dirSum, 1)
+	go func() { done <- s.sumDir(context.Background(), root) }()
+	select {
+	case <-done:
+		t.Fatalf("the walk should wait while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.gate.unpause()
+	select {
+	case res := <-done:
+		if res.size != 30 || res.files != 3 {
+			t.Fatalf("resumed walk = %d bytes, %d files; want 30, 3", res.size, res.files)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the walk should finish after resuming")
+	}
+
+	// canceling a paused walk must not leave it hanging
+	s.gate.pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- s.sumDir(ctx, root) }()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("a paused walk should end when canceled")
+	}
+}
+
+func TestPauseKey(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	t.Cleanup(m.cancel)
+	P := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'P'}}
+
+	m.loading = false
+	m.Update(P)
+	if m.scanner.gate.paused() || m.status != "Nothing to pause" {
+		t.Fatalf("P without a scan should do nothing, status %q", m.status)
+	}
+
+	m.loading = true
+	m.Update(P)
+	if !m.scanner.gate.paused() || !strings.Contains(m.View(), "⏸ paused") {
+		t.Fatalf("P during a scan should pause it and say so")
+	}
+	m.Update(P)
+	if m.scanner.gate.paused() || !strings.HasPrefix(m.status, "Resumed") {
+		t.Fatalf("a second P should resume, status %q", m.status)
+	}
+
+	m.Update(P)
+	m.setLoading(false)
+	if m.scanner.gate.paused() {
+		t.Fatalf("a finished scan should not leave the next one paused")
+	}
+}
+
+func TestLoadingShowsBadgeNotOverlay(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	m.setLoading(true)
+	if m.overlays.has("loading") {
+		t.Fatal("the loading popup is opt-in")
+	}
+	if v := m.View(); !strings.Contains(v, "scanning]") {
+		t.Fatalf("the header should carry the scanning badge:\n%s", v)
+	}
+	m.scanner.gate.pause()
+	if v := m.View(); !strings.Contains(v, "[⏸ paused — P to resume]") {
+		t.Fatalf("a paused scan should say so in the badge:\n%s", v)
+	}
+	m.scanner.gate.unpause()
+	m.setLoading(false)
+
+	m.loadingOverlay = true
+	m.setLoading(true)
+	if !m.overlays.has("loading") || strings.Contains(m.View(), "scanning]") {
+		t.Fatal("-loading-overlay should bring back the popup instead of the badge")
+	}
+}
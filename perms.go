@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// --------------------------- Owner and mode ----------------------
+
+// permInfo is the owner and mode of an entry, for the Owner and Mode
+// columns.
+type permInfo struct {
+	owner string
+	mode  fs.FileMode
+	err   error
+}
+
+// permColumns are the optional columns toggled with o, drawn after the
+// built-in seven and before analyzer columns.
+func (m *model) permColumns() []table.Column {
+	if !m.showPerms {
+		return nil
+	}
+	ow, mw := 16, 11
+	if m.narrow() {
+		ow, mw = 0, 0
+	}
+	return []table.Column{{Title: "Owner", Width: ow}, {Title: "Mode", Width: mw}}
+}
+
+// permCells are the Owner and Mode cells of n. Entries are looked up once
+// per directory visit; leaving it (or a rescan) forgets them.
+func (m *model) permCells(n *Node) []string {
+	if dir := filepath.Dir(n.Path); m.perms == nil || m.permsDir != dir {
+		m.perms, m.permsDir = map[string]permInfo{}, dir
+	}
+	p, ok := m.perms[n.Path]
+	if !ok {
+		p = lookupPerm(n.Path)
+		m.perms[n.Path] = p
+	}
+	if p.err != nil {
+		return []string{"?", "?"}
+	}
+	return []string{p.owner, p.mode.String()}
+}
+
+func lookupPerm(path string) permInfo {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return permInfo{err: err}
+	}
+	return permInfo{owner: ownerName(fi), mode: fi.Mode()}
+}
+
+// toggleOwnerColumns shows or hides the Owner and Mode columns.
+func (m *model) toggleOwnerColumns() {
+	m.showPerms = !m.showPerms
+	m.perms = nil
+	m.relayoutTable()
+	if m.showPerms {
+		m.status = "Showing owner and mode columns (o hides them)"
+	} else {
+		m.status = "Owner and mode columns hidden"
+	}
+}
+
+var (
+	userNames  sync.Map // uid → name
+	groupNames sync.Map // gid → name
+)
+
+// ownerName is "user:group" for fi, with numeric ids where the names are
+// unknown, or "" where files have no owner ids (Windows).
+func ownerName(fi fs.FileInfo) string {
+	uid, gid, ok := fileOwner(fi)
+	if !ok {
+		return ""
+	}
+	return lookupName(&userNames, uid, func(id string) (string, error) {
+		u, err := user.LookupId(id)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	}) + ":" + lookupName(&groupNames, gid, func(id string) (string, error) {
+		g, err := user.LookupGroupId(id)
+		if err != nil {
+			return "", err
+		}
+		return g.Name, nil
+	})
+}
+
+func lookupName(cache *sync.Map, id int, lookup func(string) (string, error)) string {
+	if v, ok := cache.Load(id); ok {
+		return v.(string)
+	}
+	name, err := lookup(strconv.Itoa(id))
+	if err != nil || name == "" {
+		name = strconv.Itoa(id)
+	}
+	cache.Store(id, name)
+	return name
+}
+
+// permissionHint explains a delete refused for lack of permission: moving
+// an entry needs write access to the directory holding it, so both owners
+// are named, e.g. "owned by root:root (-rw-r--r--) in /srv, owned by
+// root:root (drwxr-xr-x)". It is "" for other errors.
+func permissionHint(path string, err error) string {
+	if !errors.Is(err, fs.ErrPermission) {
+		return ""
+	}
+	describe := func(p string) string {
+		fi, err := os.Lstat(p)
+		if err != nil {
+			return "of unknown owner"
+		}
+		owner := ownerName(fi)
+		if owner == "" {
+			return fmt.Sprintf("(%s)", fi.Mode())
+		}
+		return fmt.Sprintf("owned by %s (%s)", owner, fi.Mode())
+	}
+	parent := filepath.Dir(path)
+	return fmt.Sprintf("%s is %s in %s, %s", filepath.Base(path), describe(path), parent, describe(parent))
+}
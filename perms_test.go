@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestOwnerName(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("files have no owner ids")
+	}
+	fi, err := os.Stat(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := user.Current()
+	if err != nil {
+		t.Skip(err)
+	}
+	if got := ownerName(fi); !strings.HasPrefix(got, u.Username+":") {
+		t.Errorf("owner = %q, want %s:<group>", got, u.Username)
+	}
+}
+
+func TestPermissionHint(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "locked.txt")
+	if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if hint := permissionHint(p, errors.New("disk on fire")); hint != "" {
+		t.Errorf("other errors get no hint, got %q", hint)
+	}
+	hint := permissionHint(p, &fs.PathError{Op: "rename", Path: p, Err: fs.ErrPermission})
+	if !strings.HasPrefix(hint, "locked.txt is ") || !strings.Contains(hint, "-rw-r--r--") || !strings.Contains(hint, " in "+dir+", ") {
+		t.Errorf("hint = %q", hint)
+	}
+}
+
+func TestOwnerColumnsToggle(t *testing.T) {
+	h := newTUIHarness(t, 140, 24)
+	base := len(h.m.tbl.Columns())
+	h.keys("o")
+	cols := h.m.tbl.Columns()
+	if len(cols) != base+2 || cols[base].Title != "Owner" || cols[base+1].Title != "Mode" {
+		t.Fatalf("columns = %v", cols)
+	}
+	for _, r := range h.m.tbl.Rows() {
+		if len(r) != len(cols) {
+			t.Fatalf("row %v doesn't fill the columns", r)
+		}
+		if strings.HasPrefix(r[0], "alpha") && !strings.HasPrefix(r[base+1], "d") {
+			t.Errorf("alpha mode = %q", r[base+1])
+		}
+	}
+	h.keys("o")
+	if len(h.m.tbl.Columns()) != base {
+		t.Error("o should hide the columns again")
+	}
+}
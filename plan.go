@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Cleanup plan ------------------------
+
+// planItem is one entry of a cleanup plan, with its size when it was
+// planned.
+type planItem struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"is_dir,omitempty"`
+	Size  int64  `json:"size"`
+	Files int64  `json:"files,omitempty"`
+	Dirs  int64  `json:"dirs,omitempty"`
+}
+
+// cleanupPlan is what plan mode collects instead of deleting: reviewed with
+// m, saved as JSON (and a shell script) and run later in one confirmed
+// batch, this session or another one started with -plan.
+type cleanupPlan struct {
+	Created time.Time  `json:"created"`
+	Items   []planItem `json:"items"`
+}
+
+// index is the position of path in the plan, or -1.
+func (p *cleanupPlan) index(path string) int {
+	for i, it := range p.Items {
+		if samePath(it.Path, path) {
+			return i
+		}
+	}
+	return -1
+}
+
+// covering is the planned directory path lies in, if any.
+func (p *cleanupPlan) covering(path string) (planItem, bool) {
+	for _, it := range p.Items {
+		if it.IsDir && underPath(path, it.Path) {
+			return it, true
+		}
+	}
+	return planItem{}, false
+}
+
+// total is the planned size. Items never overlap, so nothing counts twice.
+func (p *cleanupPlan) total() int64 {
+	var size int64
+	for _, it := range p.Items {
+		size += max(0, it.Size)
+	}
+	return size
+}
+
+// togglePlanned adds n to the plan, or takes it out if it is planned
+// already. A directory replaces the planned entries inside it.
+func (m *model) togglePlanned(n *Node) {
+	p := &m.plan
+	if i := p.index(n.Path); i >= 0 {
+		p.Items = append(p.Items[:i], p.Items[i+1:]...)
+		m.status = fmt.Sprintf("Unplanned %s — plan: %d items, %s", n.Name, len(p.Items), humanBytes(p.total()))
+		m.setTableRowsFromNode(m.current)
+		return
+	}
+	if it, ok := p.covering(n.Path); ok {
+		m.status = fmt.Sprintf("%s is inside %s, which is planned already", n.Name, filepath.Base(it.Path))
+		return
+	}
+	kept := p.Items[:0]
+	for _, it := range p.Items {
+		if !underPath(it.Path, n.Path) {
+			kept = append(kept, it)
+		}
+	}
+	p.Items = append(kept, planItem{Path: n.Path, IsDir: n.IsDir || n.Dirs > 0, Size: max(0, n.Size), Files: n.Files, Dirs: n.Dirs})
+	if p.Created.IsZero() {
+		p.Created = time.Now()
+	}
+	m.status = fmt.Sprintf("Planned %s (%s) — plan: %d items, %s; m to review", n.Name, humanBytes(max(0, n.Size)), len(p.Items), humanBytes(p.total()))
+	m.setTableRowsFromNode(m.current)
+}
+
+// togglePlanMode switches d between deleting and planning.
+func (m *model) togglePlanMode() {
+	m.planMode = !m.planMode
+	if m.planMode {
+		m.status = "Plan mode: d adds to the cleanup plan and deletes nothing; m reviews it"
+	} else {
+		m.status = fmt.Sprintf("Plan mode off — the plan keeps %d items (m to review)", len(m.plan.Items))
+	}
+}
+
+// planTag is the header note of plan mode and a non-empty plan.
+func (m *model) planTag() string {
+	switch {
+	case m.planMode:
+		return fmt.Sprintf("[plan mode: %d items, %s — d plans, m reviews]", len(m.plan.Items), humanBytes(m.plan.total()))
+	case len(m.plan.Items) > 0:
+		return fmt.Sprintf("[plan: %d items, %s — m]", len(m.plan.Items), humanBytes(m.plan.total()))
+	}
+	return ""
+}
+
+// loadPlan reads a plan saved from the review dialog, for -plan.
+func loadPlan(path string) (cleanupPlan, error) {
+	var p cleanupPlan
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		return p, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, it := range p.Items {
+		if !filepath.IsAbs(it.Path) {
+			return p, fmt.Errorf("%s: %q is not an absolute path", path, it.Path)
+		}
+	}
+	return p, nil
+}
+
+// savePlan writes the plan as base.json, to load with -plan, and base.sh,
+// a script deleting the same paths for machines without disktree (such as
+// the server a -from-file listing came from).
+func savePlan(p cleanupPlan, base string) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".json", append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#!/bin/sh\n# disktree cleanup plan of %s: %d items, %s\n", p.Created.Format("2006-01-02 15:04"), len(p.Items), humanBytes(p.total()))
+	sb.WriteString("# Deletes permanently. Review before running.\nset -e\n")
+	for _, it := range p.Items {
+		fmt.Fprintf(&sb, "rm -rf -- %s # %s\n", posixQuote(it.Path), humanBytes(it.Size))
+	}
+	return os.WriteFile(base+".sh", []byte(sb.String()), 0o755)
+}
+
+// runPlan moves every planned item to the trash, each recorded in the
+// journal like a delete with d. Protected, locked and vanished items are
+// skipped and stay in the plan.
+func (m *model) runPlan() tea.Cmd {
+	if m.listing != nil {
+		m.status = "A plan made from a file list can't run here; save it (s) and run its script where the files are"
+		return nil
+	}
+	var cmds []tea.Cmd
+	var done int
+	var freed int64
+	var skipped []string
+	var left []planItem
+	for _, it := range m.plan.Items {
+		name := filepath.Base(it.Path)
+		reason := ""
+		if _, err := os.Lstat(it.Path); errors.Is(err, fs.ErrNotExist) {
+			reason = "gone"
+		} else if rule, ok := m.protect.match(it.Path); ok {
+			reason = "protected by " + rule
+		} else if locked := lockingFlags(it.Path); len(locked) > 0 {
+			reason = strings.Join(locked, ", ")
+		}
+		if reason == "" {
+			ti, cmd, err := m.trashPath(it.Path)
+			if err == nil {
+				m.journal.record(&journalOp{Kind: opTrash, Trash: ti})
+				cmds = append(cmds, cmd)
+				done++
+				freed += trashedSize(ti)
+				continue
+			}
+			reason = err.Error()
+		}
+		if reason != "gone" {
+			left = append(left, it)
+		}
+		skipped = append(skipped, name+": "+reason)
+	}
+	m.plan.Items = left
+	m.status = fmt.Sprintf("Plan done: %d items (%s) moved to the trash — u undoes them one by one", done, humanBytes(freed))
+	if len(skipped) > 0 {
+		m.status += "; skipped " + strings.Join(skipped, "; ")
+	}
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	return tea.Batch(cmds...)
+}
+
+// planOverlay reviews the plan: x drops the selected item, s saves the plan,
+// Enter asks to run it.
+type planOverlay struct {
+	cursor  int
+	confirm bool
+	err     string
+}
+
+func (o *planOverlay) opts() overlayOpts {
+	return overlayOpts{id: "plan", z: zDialog, dim: true, focusable: true}
+}
+
+// rows is how many plan items fit in the dialog.
+func (o *planOverlay) rows(m *model) int {
+	_, h := m.screenSize()
+	return maxvalue(3, h-14)
+}
+
+func (o *planOverlay) View(m *model) string {
+	w := m.popupWidth(90)
+	inner := maxvalue(20, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	items := m.plan.Items
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(fmt.Sprintf("Cleanup plan — %d items, %s", len(items), humanBytes(m.plan.total()))),
+		"",
+	}
+	if len(items) == 0 {
+		lines = append(lines, faint.Render("empty: M turns on plan mode, then d plans the selection"))
+	}
+	rows := o.rows(m)
+	first := maxvalue(0, minvalue(o.cursor-rows/2, len(items)-rows))
+	for i := first; i < minvalue(len(items), first+rows); i++ {
+		it := items[i]
+		size := fmt.Sprintf("%10s  ", humanBytes(it.Size))
+		line := size + truncateToWidth(sanitizeLine(it.Path), inner-len(size))
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "")
+	switch {
+	case o.err != "":
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("⚠ "+o.err))
+	case o.confirm:
+		lines = append(lines, lipgloss.NewStyle().Foreground(lipgloss.Color("11")).Render(
+			fmt.Sprintf("Move %d items (%s) to the trash? y to run, any other key cancels", len(items), humanBytes(m.plan.total()))))
+	}
+	lines = append(lines, faint.Render("↑/↓ move  x unplan  s save JSON+script  Enter run  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *planOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	items := m.plan.Items
+	if o.confirm {
+		o.confirm = false
+		if msg.String() == "y" {
+			return m.runPlan(), true
+		}
+		return nil, false
+	}
+	o.err = ""
+	switch msg.String() {
+	case "esc", "q", "m":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(items)-1), o.cursor+1)
+	case "x", "delete":
+		if o.cursor < len(items) {
+			m.plan.Items = append(items[:o.cursor], items[o.cursor+1:]...)
+			o.cursor = minvalue(o.cursor, maxvalue(0, len(m.plan.Items)-1))
+			if m.current != nil {
+				m.setTableRowsFromNode(m.current)
+			}
+		}
+	case "s":
+		if len(items) == 0 {
+			return nil, false
+		}
+		base := "disktree-plan-" + timestamp()
+		if err := savePlan(m.plan, base); err != nil {
+			o.err = err.Error()
+			return nil, false
+		}
+		m.status = fmt.Sprintf("Saved the plan to %s.json (disktree -plan) and %s.sh", base, base)
+		return m.showExportToast(base+".json", fmt.Sprintf("plan of %d items", len(items))), false
+	case "enter":
+		if len(items) > 0 {
+			o.confirm = true
+		}
+	}
+	return nil, false
+}
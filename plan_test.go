@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCleanupPlan(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cache = sync.Map{}
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "cache", "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"a.iso", filepath.Join("cache", "x", "blob")} {
+		if err := os.WriteFile(filepath.Join(dir, f), make([]byte, 1024), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 160, Height: 30})
+	m.loading = false
+	cacheDir := &Node{Name: "cache", Path: filepath.Join(dir, "cache"), IsDir: true, Size: 1024, Files: 1, Dirs: 1}
+	iso := &Node{Name: "a.iso", Path: filepath.Join(dir, "a.iso"), Size: 1024, Files: 1}
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Scanned: true, Children: []*Node{cacheDir, iso}}
+	sumChildren(m.current)
+	m.journal = &opJournal{path: filepath.Join(journalDir(), "test.json")}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("M")})
+	m.togglePlanned(&Node{Name: "x", Path: filepath.Join(dir, "cache", "x"), IsDir: true, Size: 1024})
+	m.togglePlanned(cacheDir)
+	m.togglePlanned(iso)
+	if len(m.plan.Items) != 2 || m.plan.total() != 2048 {
+		t.Fatalf("cache should replace cache/x: %+v", m.plan.Items)
+	}
+	m.togglePlanned(&Node{Name: "blob", Path: filepath.Join(dir, "cache", "x", "blob")})
+	if len(m.plan.Items) != 2 || !strings.Contains(m.status, "planned already") {
+		t.Fatalf("entries inside a planned directory are refused: %q", m.status)
+	}
+	if _, err := os.Lstat(iso.Path); err != nil || !strings.Contains(m.View(), "[planned]") {
+		t.Fatal("planning must not delete, and planned rows are tagged")
+	}
+
+	base := filepath.Join(t.TempDir(), "plan")
+	if err := savePlan(m.plan, base); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadPlan(base + ".json")
+	if err != nil || len(loaded.Items) != 2 || loaded.Items[1].Path != iso.Path {
+		t.Fatalf("round trip: %+v, %v", loaded, err)
+	}
+	if b, _ := os.ReadFile(base + ".sh"); !strings.Contains(string(b), "rm -rf -- "+posixQuote(iso.Path)) {
+		t.Fatalf("script:\n%s", b)
+	}
+
+	m.protect = newProtectedRules([]string{cacheDir.Path}, false)
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m")})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	if _, err := os.Lstat(iso.Path); err == nil {
+		t.Fatal("running the plan should trash a.iso")
+	}
+	if len(m.plan.Items) != 1 || !strings.Contains(m.status, "skipped cache: protected") {
+		t.Fatalf("the protected item stays planned: %+v, %q", m.plan.Items, m.status)
+	}
+	if m.journal.next != 1 {
+		t.Fatal("plan deletes should be undoable")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --------------------------- Exclusion predicates ----------------
+
+// filePredicates leave files out of scans and totals by age or size
+// (-exclude-older-than 5y, -exclude-smaller-than 1K, ...), so both the
+// numbers and the table show only the data worth looking at. Directories
+// are always walked; only the files in them are tested.
+type filePredicates struct {
+	olderThan, newerThan    time.Duration // by modification time; 0 = off
+	smallerThan, largerThan int64         // by length; 0 = off
+	// now is when the process started: ages are measured from it, so a
+	// long scan treats every file alike
+	now time.Time
+	// specs are the limits as given, for the header and the helpers
+	specs [][2]string // flag name, value
+}
+
+// predicateFlags are the flags that set filePredicates, in display order.
+var predicateFlags = []struct{ name, label, usage string }{
+	{"exclude-older-than", "older than", "Leave files last modified longer ago than this out of scans and totals (e.g. 5y, 6mo, 30d)"},
+	{"exclude-newer-than", "newer than", "Leave files modified within this out of scans and totals (e.g. 2w, 12h)"},
+	{"exclude-smaller-than", "smaller than", "Leave files smaller than this out of scans and totals (e.g. 1K)"},
+	{"exclude-larger-than", "larger than", "Leave files larger than this out of scans and totals (e.g. 10G)"},
+}
+
+// newFilePredicates parses the limits, indexed like predicateFlags; empty
+// ones are off. It returns nil when all are.
+func newFilePredicates(values [4]string) (*filePredicates, error) {
+	p := &filePredicates{now: time.Now()}
+	for i, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		name := predicateFlags[i].name
+		var err error
+		switch i {
+		case 0:
+			p.olderThan, err = parseAge(v)
+		case 1:
+			p.newerThan, err = parseAge(v)
+		case 2:
+			p.smallerThan, err = parseSize(v)
+		case 3:
+			p.largerThan, err = parseSize(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("-%s: %w", name, err)
+		}
+		p.specs = append(p.specs, [2]string{name, v})
+	}
+	if len(p.specs) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// excludes reports whether the file fi is left out.
+func (p *filePredicates) excludes(fi fs.FileInfo) bool {
+	if p == nil {
+		return false
+	}
+	age := p.now.Sub(fi.ModTime())
+	switch {
+	case p.olderThan > 0 && age > p.olderThan,
+		p.newerThan > 0 && age < p.newerThan,
+		p.smallerThan > 0 && fi.Size() < p.smallerThan,
+		p.largerThan > 0 && fi.Size() > p.largerThan:
+		return true
+	}
+	return false
+}
+
+// fileFilter is excludes as a scanner.Options.ExcludeFile hook, nil when
+// nothing is excluded.
+func (p *filePredicates) fileFilter() func(fs.FileInfo) bool {
+	if p == nil {
+		return nil
+	}
+	return p.excludes
+}
+
+// describe is e.g. "older than 5y, smaller than 1K".
+func (p *filePredicates) describe() string {
+	var parts []string
+	for _, s := range p.specs {
+		for _, f := range predicateFlags {
+			if f.name == s[0] {
+				parts = append(parts, f.label+" "+s[1])
+			}
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// args are the flags that give a helper process the same limits.
+func (p *filePredicates) args() []string {
+	if p == nil {
+		return nil
+	}
+	var a []string
+	for _, s := range p.specs {
+		a = append(a, "-"+s[0], s[1])
+	}
+	return a
+}
+
+// ageUnits are the suffixes parseAge knows beyond those of
+// time.ParseDuration; a year is 365 days and a month 30.
+var ageUnits = []struct {
+	suffix string
+	unit   time.Duration
+}{
+	{"mo", 30 * 24 * time.Hour},
+	{"y", 365 * 24 * time.Hour},
+	{"w", 7 * 24 * time.Hour},
+	{"d", 24 * time.Hour},
+}
+
+// parseAge parses ages such as "5y", "6mo", "2w", "30d" or "12h".
+func parseAge(s string) (time.Duration, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	for _, u := range ageUnits {
+		if n, ok := strings.CutSuffix(t, u.suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil || v <= 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(v * float64(u.unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(t)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. 5y, 6mo, 2w, 30d, 12h)", s)
+	}
+	return d, nil
+}
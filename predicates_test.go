@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"5y":   5 * 365 * 24 * time.Hour,
+		"6mo":  180 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"30d":  30 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"12h":  12 * time.Hour,
+	} {
+		if got, err := parseAge(in); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "y", "-3d", "soon"} {
+		if _, err := parseAge(in); err == nil {
+			t.Errorf("parseAge(%q) should fail", in)
+		}
+	}
+}
+
+func TestFilePredicates(t *testing.T) {
+	if p, err := newFilePredicates([4]string{}); p != nil || err != nil {
+		t.Fatalf("no limits should mean no predicates, got %v, %v", p, err)
+	}
+	if _, err := newFilePredicates([4]string{"", "", "lots"}); err == nil {
+		t.Error("a bad size should be refused")
+	}
+	p, err := newFilePredicates([4]string{"1y", "", "1K", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.describe(); got != "older than 1y, smaller than 1K" {
+		t.Errorf("describe = %q", got)
+	}
+	if got := p.args(); !slices.Equal(got, []string{"-exclude-older-than", "1y", "-exclude-smaller-than", "1K"}) {
+		t.Errorf("args = %v", got)
+	}
+
+	dir := t.TempDir()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		when := time.Now().Add(-age)
+		if err := os.Chtimes(path, when, when); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("keep.bin", 4096, time.Hour)
+	write("sub/old.bin", 4096, 2*365*24*time.Hour)
+	write("sub/small.txt", 10, time.Hour)
+	write("sub/keep.bin", 2048, time.Hour)
+
+	s := &Scanner{threads: 2, mounts: newMountTable(nil), exclude: p}
+	res, _ := s.walkSum(context.Background(), dir, false)
+	if res.size != 6144 || res.files != 2 {
+		t.Errorf("walkSum = %d bytes in %d files, want 6144 in 2", res.size, res.files)
+	}
+}
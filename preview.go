@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image.Decode
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// --------------------------- Preview pane ------------------------
+
+const (
+	// previewHeadBytes is how much of a file is read to sniff and show it.
+	previewHeadBytes = 16 << 10
+	// previewMaxImage bounds the files and pixel counts decoded for thumbnails.
+	previewMaxImage     = 32 << 20
+	previewMaxImagePels = 40_000_000
+	// minPreviewWidth is the narrowest pane worth drawing.
+	minPreviewWidth = 16
+)
+
+// previewCache holds the last rendered pane so View doesn't touch the disk
+// on every frame; it is rebuilt when the selection, pane size or file's
+// modification time changes.
+type previewCache struct {
+	path    string
+	w, h    int
+	modTime int64
+	size    int64
+	g       graphicsProtocol
+	out     string
+}
+
+// previewWidth is the width of the side pane, or 0 when it is hidden.
+func (m *model) previewWidth() int {
+	if !m.showPreview || m.width <= 0 {
+		return 0
+	}
+	return minvalue(60, maxvalue(24, m.width/3))
+}
+
+// previewPane renders the pane for the selected entry at w×h cells.
+func (m *model) previewPane(w, h int) string {
+	style := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	innerW := maxvalue(1, w-style.GetHorizontalFrameSize())
+	innerH := maxvalue(1, h-style.GetVerticalFrameSize())
+
+	n := m.selected()
+	var content string
+	if n == nil {
+		content = lipgloss.NewStyle().Faint(true).Render("nothing selected")
+	} else {
+		var mod int64
+		fi, err := os.Lstat(n.Path)
+		if err == nil {
+			mod = fi.ModTime().UnixNano()
+		}
+		// pictures can't be layered under a dialog; draw blocks meanwhile
+		g := m.graphics
+		if !m.overlays.empty() {
+			g = graphicsNone
+		}
+		c := m.preview
+		if c == nil || c.path != n.Path || c.w != innerW || c.h != innerH || c.modTime != mod || c.size != n.Size || c.g != g {
+			c = &previewCache{path: n.Path, w: innerW, h: innerH, modTime: mod, size: n.Size, g: g}
+			c.out = buildPreview(n, fi, err, innerW, innerH, g)
+			m.preview = c
+		}
+		content = c.out
+	}
+	return style.Width(w - style.GetHorizontalBorderSize()).Height(h - style.GetVerticalBorderSize()).
+		MaxHeight(h).Render(content)
+}
+
+// buildPreview describes n in a w×h box: directory totals, the head of a
+// text file, a thumbnail of an image, or the metadata of anything else.
+// Thumbnails are real pictures when g is a terminal graphics protocol.
+func buildPreview(n *Node, fi os.FileInfo, statErr error, w, h int, g graphicsProtocol) string {
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(truncateToWidth(sanitizeLine(n.Name), w))}
+	add := func(s string) { lines = append(lines, truncateToWidth(s, w)) }
+	done := func() string {
+		if len(lines) > h {
+			lines = lines[:h]
+		}
+		return strings.Join(lines, "\n")
+	}
+	if statErr != nil {
+		add("cannot stat: " + sanitizeLine(statErr.Error()))
+		return done()
+	}
+	add(fmt.Sprintf("%s  %s  %s", fi.Mode().String(), humanBytes(fi.Size()), fi.ModTime().Format("2006-01-02 15:04")))
+
+	switch {
+	case n.IsDir:
+		switch {
+		case n.NoAccess:
+			add("directory — no access")
+		case n.Size >= 0:
+			add(fmt.Sprintf("directory — %s, %d files, %d dirs", humanBytes(n.Size), n.Files, n.Dirs))
+		default:
+			add("directory — scanning ...")
+		}
+		add("")
+		for _, c := range n.Children {
+			if len(lines) >= h {
+				break
+			}
+			name := sanitizeLine(c.Name)
+			if c.IsDir {
+				name += "/"
+			}
+			add(name)
+		}
+		return done()
+	case !fi.Mode().IsRegular():
+		add("not a regular file")
+		return done()
+	}
+
+	f, err := os.Open(n.Path)
+	if err != nil {
+		add("cannot read: " + sanitizeLine(err.Error()))
+		return done()
+	}
+	defer f.Close()
+	head := make([]byte, previewHeadBytes)
+	k, err := io.ReadFull(f, head)
+	head = head[:k]
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		add("cannot read: " + sanitizeLine(err.Error()))
+		return done()
+	}
+	kind := http.DetectContentType(head)
+	add("type: " + kind)
+	add("")
+
+	if strings.HasPrefix(kind, "image/") && fi.Size() <= previewMaxImage {
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			if thumb, ok := imageThumbnail(f, w, h-len(lines), g); ok {
+				lines = append(lines, thumb...)
+				return done()
+			}
+		}
+	}
+	if looksLikeText(head) {
+		text := string(head)
+		if k == previewHeadBytes {
+			// don't show a multi-byte character cut in half at the end
+			for len(text) > 0 && !utf8.ValidString(text[len(text)-min(len(text), utf8.UTFMax):]) {
+				text = text[:len(text)-1]
+			}
+		}
+		for l := range strings.SplitSeq(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+			if len(lines) >= h {
+				break
+			}
+			add(sanitizeLine(strings.ReplaceAll(l, "\t", "    ")))
+		}
+		return done()
+	}
+	// binary: show the magic bytes so formats without a MIME type are recognisable
+	dump := hex.Dump(head[:min(len(head), 64)])
+	for l := range strings.SplitSeq(strings.TrimRight(dump, "\n"), "\n") {
+		// hex.Dump lines are "offset  hex  |ascii|"; keep the hex part
+		if i := strings.Index(l, "|"); i > 0 {
+			l = strings.TrimRight(l[:i], " ")
+		}
+		add(l[min(len(l), 10):])
+	}
+	return done()
+}
+
+// sanitizeLine strips styling and control characters from file names and
+// contents so the pane never emits escape sequences it didn't create.
+func sanitizeLine(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// looksLikeText reports whether head is plausibly text: valid UTF-8 (apart
+// from a character cut off at the end) with no NUL bytes and few controls.
+func looksLikeText(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	trimmed := head
+	if len(trimmed) > utf8.UTFMax {
+		trimmed = trimmed[:len(trimmed)-utf8.UTFMax]
+	}
+	if !utf8.Valid(trimmed) {
+		return false
+	}
+	ctrl := 0
+	for _, b := range head {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			ctrl++
+		}
+	}
+	return ctrl*10 <= len(head)
+}
+
+// asciiRamp maps luminance to characters when the terminal has no colors.
+const asciiRamp = " .:-=+*#%@"
+
+// imageThumbnail decodes r and scales it to fit w×h cells. With color each
+// cell is an upper half block showing two pixels (foreground on top,
+// background below); without color it falls back to an ASCII ramp. With a
+// graphics protocol the image is sent as a picture instead.
+func imageThumbnail(r io.ReadSeeker, w, h int, g graphicsProtocol) ([]string, bool) {
+	if w <= 0 || h <= 0 {
+		return nil, false
+	}
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > previewMaxImagePels {
+		return nil, false
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, false
+	}
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, false
+	}
+	if lines, ok := graphicsImage(g, img, w, h); ok {
+		return lines, true
+	}
+	ascii := lipgloss.ColorProfile() == termenv.Ascii
+
+	// a cell is about twice as tall as it is wide, so each cell covers one
+	// pixel column and two pixel rows (ASCII samples only the upper one)
+	rowsPerCell := 2
+	pw, ph := w, h*rowsPerCell
+	scale := min(float64(pw)/float64(cfg.Width), float64(ph)/float64(cfg.Height))
+	tw := max(1, int(float64(cfg.Width)*scale))
+	th := max(1, int(float64(cfg.Height)*scale))
+	b := img.Bounds()
+	at := func(x, y int) (r, g, bl uint32) {
+		sx := b.Min.X + x*b.Dx()/tw
+		sy := b.Min.Y + y*b.Dy()/th
+		r, g, bl, _ = img.At(sx, sy).RGBA()
+		return r >> 8, g >> 8, bl >> 8
+	}
+
+	var out []string
+	for y := 0; y < th; y += rowsPerCell {
+		var sb strings.Builder
+		for x := 0; x < tw; x++ {
+			r1, g1, b1 := at(x, y)
+			if ascii {
+				lum := (299*r1 + 587*g1 + 114*b1) / 1000
+				sb.WriteByte(asciiRamp[int(lum)*(len(asciiRamp)-1)/255])
+				continue
+			}
+			st := lipgloss.NewStyle().Foreground(lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", r1, g1, b1)))
+			if y+1 < th {
+				r2, g2, b2 := at(x, y+1)
+				st = st.Background(lipgloss.Color(fmt.Sprintf("#%02x%02x%02x", r2, g2, b2)))
+			}
+			sb.WriteString(st.Render("▀"))
+		}
+		out = append(out, sb.String())
+	}
+	return out, true
+}
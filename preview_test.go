@@ -0,0 +1,107 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+func previewOf(t *testing.T, path string, w, h int) string {
+	t.Helper()
+	fi, err := os.Lstat(path)
+	return buildPreview(&Node{Name: filepath.Base(path), Path: path, Size: 1}, fi, err, w, h, graphicsNone)
+}
+
+func TestPreviewKinds(t *testing.T) {
+	dir := t.TempDir()
+	text := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(text, []byte("first line\n\x1b[31msecond\tline\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "blob.bin")
+	if err := os.WriteFile(bin, []byte{0x7f, 'E', 'L', 'F', 0, 1, 2, 3}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	pic := filepath.Join(dir, "pic.png")
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(0, 0, color.RGBA{A: 0xff})
+	f, err := os.Create(pic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	got := previewOf(t, text, 30, 10)
+	if !strings.Contains(got, "first line") || !strings.Contains(got, "[31msecond    line") {
+		t.Fatalf("text head missing or escape kept:\n%s", got)
+	}
+	if strings.Contains(got, "\x1b[31m") {
+		t.Fatalf("file contents must not inject escape sequences:\n%q", got)
+	}
+
+	got = previewOf(t, bin, 40, 10)
+	if !strings.Contains(got, "type: application/octet-stream") || !strings.Contains(got, "7f 45 4c 46") {
+		t.Fatalf("expected binary metadata and magic bytes:\n%s", got)
+	}
+
+	prev := lipgloss.ColorProfile()
+	t.Cleanup(func() { lipgloss.SetColorProfile(prev) })
+	lipgloss.SetColorProfile(termenv.Ascii)
+	got = previewOf(t, pic, 20, 10)
+	if !strings.Contains(got, "type: image/png") || !strings.Contains(got, "  @@@@") {
+		t.Fatalf("expected an ASCII thumbnail:\n%s", got)
+	}
+	lipgloss.SetColorProfile(termenv.TrueColor)
+	got = previewOf(t, pic, 20, 10)
+	if !strings.Contains(got, "▀") {
+		t.Fatalf("expected a half-block thumbnail:\n%s", got)
+	}
+	for _, l := range strings.Split(got, "\n") {
+		if w := ansi.StringWidth(l); w > 20 {
+			t.Fatalf("line %q is %d cells wide; want <= 20", l, w)
+		}
+	}
+}
+
+func TestPreviewPaneToggle(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "readme.md")
+	if err := os.WriteFile(p, []byte("# hello preview\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := initialModel(dir, 1, false)
+	m.loading = false
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 20})
+	m.current = &Node{Name: "root", Path: dir, Scanned: true, Size: 16, Children: []*Node{
+		{Name: "readme.md", Path: p, Size: 16},
+	}}
+	m.setTableRowsFromNode(m.current)
+
+	nameW := m.tbl.Columns()[0].Width
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	if !strings.Contains(m.View(), "# hello preview") {
+		t.Fatalf("expected the file head in the preview pane")
+	}
+	if got := m.tbl.Columns()[0].Width; got >= nameW {
+		t.Fatalf("table should narrow for the pane: Name width %d, was %d", got, nameW)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'p'}})
+	if strings.Contains(m.View(), "# hello preview") {
+		t.Fatalf("expected the pane to close")
+	}
+}
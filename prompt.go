@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Prompts -----------------------------
+
+// promptOverlay is a single-line text input dialog shared by every feature
+// that needs to ask for a value (goto path, export filename, filter, rename).
+// Submitted values are remembered per kind and can be recalled with ↑/↓.
+type promptOverlay struct {
+	kind     string // history bucket and overlay id suffix
+	title    string
+	input    textinput.Model
+	validate func(string) error
+	submit   func(m *model, value string) tea.Cmd
+	err      string
+	histIdx  int    // index into history while browsing; len(history) = draft
+	draft    string // what the user typed before browsing history
+	// noHistory disables recall, e.g. for typed safety overrides
+	noHistory bool
+}
+
+func newPrompt(m *model, kind, title, initial string, validate func(string) error, submit func(*model, string) tea.Cmd) *promptOverlay {
+	ti := textinput.New()
+	ti.Prompt = "> "
+	ti.SetValue(initial)
+	ti.CursorEnd()
+	ti.Cursor.SetMode(cursor.CursorStatic)
+	ti.Width = m.popupWidth(60) - 8
+	ti.Focus()
+	return &promptOverlay{
+		kind:     kind,
+		title:    title,
+		input:    ti,
+		validate: validate,
+		submit:   submit,
+		histIdx:  len(m.promptHistory[kind]),
+	}
+}
+
+func (p *promptOverlay) opts() overlayOpts {
+	return overlayOpts{id: "prompt-" + p.kind, z: zDialog, dim: true, focusable: true}
+}
+
+func (p *promptOverlay) View(m *model) string {
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(p.title), "", p.input.View()}
+	if p.err != "" {
+		lines = append(lines, "", lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Render("⚠ "+p.err))
+	}
+	lines = append(lines, "", lipgloss.NewStyle().Faint(true).Render("Enter confirm  Esc cancel  ↑/↓ history"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(m.popupWidth(60)).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (p *promptOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	hist := m.promptHistory[p.kind]
+	switch msg.String() {
+	case "esc":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "enter":
+		v := strings.TrimSpace(p.input.Value())
+		if p.validate != nil {
+			if err := p.validate(v); err != nil {
+				p.err = err.Error()
+				return nil, false
+			}
+		}
+		if !p.noHistory {
+			m.rememberPrompt(p.kind, v)
+		}
+		return p.submit(m, v), true
+	case "up":
+		if p.histIdx > 0 && !p.noHistory {
+			if p.histIdx == len(hist) {
+				p.draft = p.input.Value()
+			}
+			p.histIdx--
+			p.input.SetValue(hist[p.histIdx])
+			p.input.CursorEnd()
+		}
+		return nil, false
+	case "down":
+		if p.histIdx < len(hist) {
+			p.histIdx++
+			if p.histIdx == len(hist) {
+				p.input.SetValue(p.draft)
+			} else {
+				p.input.SetValue(hist[p.histIdx])
+			}
+			p.input.CursorEnd()
+		}
+		return nil, false
+	}
+	p.err = ""
+	var cmd tea.Cmd
+	p.input, cmd = p.input.Update(msg)
+	return cmd, false
+}
+
+// maxPromptHistory bounds the remembered values per prompt kind.
+const maxPromptHistory = 50
+
+func (m *model) rememberPrompt(kind, v string) {
+	if v == "" {
+		return
+	}
+	if m.promptHistory == nil {
+		m.promptHistory = map[string][]string{}
+	}
+	h := m.promptHistory[kind]
+	// move repeated values to the end instead of duplicating them
+	for i, e := range h {
+		if e == v {
+			h = append(h[:i], h[i+1:]...)
+			break
+		}
+	}
+	h = append(h, v)
+	if len(h) > maxPromptHistory {
+		h = h[len(h)-maxPromptHistory:]
+	}
+	m.promptHistory[kind] = h
+}
+
+// --------------------------- Prompt users ------------------------
+
+func (m *model) promptGoto() {
+	cur := m.breadcrumbs[len(m.breadcrumbs)-1]
+	m.overlays.push(newPrompt(m, "goto", "Go to path", cur, validateDirPath, func(m *model, v string) tea.Cmd {
+		return m.gotoPath(v)
+	}))
+}
+
+func validateDirPath(v string) error {
+	if v == "" {
+		return errors.New("path is required")
+	}
+	fi, err := os.Stat(expandHome(v))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.New("not a directory")
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~"+string(os.PathSeparator)) {
+		if h, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(h, p[1:])
+		}
+	}
+	return p
+}
+
+// gotoPath navigates to p. Paths below the scan root keep the breadcrumb
+// trail from the root; anything else becomes a new root.
+func (m *model) gotoPath(p string) tea.Cmd {
+	p = expandHome(p)
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	crumbs := []string{p}
+	if rel, err := filepath.Rel(m.rootPath, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		crumbs = []string{m.rootPath}
+		if rel != "." {
+			acc := m.rootPath
+			for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+				acc = filepath.Join(acc, part)
+				crumbs = append(crumbs, acc)
+			}
+		}
+	} else {
+		m.rootPath = p
+		m.scanner.root = p
+	}
+	m.breadcrumbs = crumbs
+	m.current = &Node{Name: filepath.Base(p), Path: p, Children: []*Node{}, Scanned: false}
+	m.setTableRowsFromNode(m.current)
+	m.status = fmt.Sprintf("Scanning %s ...", p)
+	m.setLoading(true)
+	return tea.Batch(m.spin.Tick, m.loadingTick(), m.startCachedScan(p))
+}
+
+func (m *model) promptExportAs() {
+	def := fmt.Sprintf("du-%s.csv", timestamp())
+	m.overlays.push(newPrompt(m, "export", "Export current view to (.csv .json .ncdu.json .md .html)", def, validateExportPath, func(m *model, v string) tea.Cmd {
+		return m.exportTo(expandHome(v))
+	}))
+}
+
+func validateExportPath(v string) error {
+	if v == "" {
+		return errors.New("file name is required")
+	}
+	dir := filepath.Dir(expandHome(v))
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+	return nil
+}
+
+func (m *model) promptFilter() {
+	m.overlays.push(newPrompt(m, "filter", "Filter by name (empty clears)", m.filter, nil, func(m *model, v string) tea.Cmd {
+		m.filter = v
+		if m.current != nil {
+			m.setTableRowsFromNode(m.current)
+		}
+		return nil
+	}))
+}
+
+func (m *model) promptRename() {
+	sel := m.selected()
+	if sel == nil {
+		return
+	}
+	dir := filepath.Dir(sel.Path)
+	validate := func(v string) error {
+		if v == "" {
+			return errors.New("name is required")
+		}
+		if strings.ContainsRune(v, os.PathSeparator) || strings.ContainsRune(v, '/') {
+			return errors.New("name must not contain path separators")
+		}
+		if v == sel.Name {
+			return errors.New("name is unchanged")
+		}
+		if _, err := os.Lstat(filepath.Join(dir, v)); err == nil {
+			return fmt.Errorf("%s already exists", v)
+		}
+		return nil
+	}
+	m.overlays.push(newPrompt(m, "rename", "Rename "+sel.Name, sel.Name, validate, func(m *model, v string) tea.Cmd {
+		m.renameNode(sel, v)
+		return nil
+	}))
+}
+
+// renameNode renames n on disk and records it in the journal.
+func (m *model) renameNode(n *Node, name string) {
+	oldPath := n.Path
+	newPath := filepath.Join(filepath.Dir(oldPath), name)
+	if err := m.renamePath(oldPath, newPath); err != nil {
+		m.status = "⚠ " + err.Error()
+		return
+	}
+	if n.Path == oldPath {
+		// not a child of a loaded directory, e.g. a search result
+		movePaths(n, newPath)
+		m.setTableRowsFromNode(m.current)
+	}
+	m.journal.record(&journalOp{Kind: opRename, From: oldPath, To: newPath})
+	m.status = fmt.Sprintf("Renamed %s to %s", filepath.Base(oldPath), name)
+}
+
+// renamePath renames from to to within the same directory, refusing to
+// replace an existing entry, and updates the node for it in place.
+func (m *model) renamePath(from, to string) error {
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s already exists", filepath.Base(to))
+	}
+	err := os.Rename(from, to)
+	audit("rename", from, to, 0, err)
+	if err != nil {
+		return err
+	}
+	forgetCachedSubtree(from)
+	invalidateSums(from)
+	m.eachCopy(filepath.Dir(from), func(p *Node) {
+		for _, c := range p.Children {
+			if samePath(c.Path, from) {
+				movePaths(c, to)
+			}
+		}
+	})
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	return nil
+}
+
+// movePaths points n and its loaded descendants at n's new path p.
+func movePaths(n *Node, p string) {
+	n.Name, n.Path = filepath.Base(p), p
+	for _, c := range n.Children {
+		movePaths(c, filepath.Join(p, c.Name))
+	}
+}
+
+// forgetCachedSubtree drops cached scans for p and everything below it.
+func forgetCachedSubtree(p string) {
+	cache.Range(func(k, _ any) bool {
+		if underPath(k.(string), p) {
+			cache.Delete(k)
+		}
+		return true
+	})
+}
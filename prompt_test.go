@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestPromptHistoryAndValidation(t *testing.T) {
+	tmp := t.TempDir()
+	m := initialModel(tmp, 1, false)
+
+	var got string
+	submit := func(m *model, v string) tea.Cmd { got = v; return nil }
+	p := newPrompt(m, "goto", "Go to", "", validateDirPath, submit)
+	m.overlays.push(p)
+
+	// invalid input keeps the prompt open and shows the error
+	p.input.SetValue(filepath.Join(tmp, "missing"))
+	if _, closed := p.Update(m, tea.KeyMsg{Type: tea.KeyEnter}); closed {
+		t.Fatalf("prompt closed on invalid input")
+	}
+	if p.err == "" {
+		t.Fatalf("expected validation error to be shown")
+	}
+
+	if err := os.Mkdir(filepath.Join(tmp, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p.input.SetValue(filepath.Join(tmp, "sub"))
+	if _, closed := p.Update(m, tea.KeyMsg{Type: tea.KeyEnter}); !closed {
+		t.Fatalf("prompt should close on valid input")
+	}
+	if got != filepath.Join(tmp, "sub") {
+		t.Fatalf("submit got %q", got)
+	}
+
+	// a new prompt recalls the submitted value with ↑
+	p2 := newPrompt(m, "goto", "Go to", "draft", validateDirPath, submit)
+	p2.Update(m, tea.KeyMsg{Type: tea.KeyUp})
+	if v := p2.input.Value(); v != filepath.Join(tmp, "sub") {
+		t.Fatalf("history up = %q", v)
+	}
+	p2.Update(m, tea.KeyMsg{Type: tea.KeyDown})
+	if v := p2.input.Value(); v != "draft" {
+		t.Fatalf("history down should restore draft, got %q", v)
+	}
+}
+
+func TestRememberPromptDeduplicates(t *testing.T) {
+	m := &model{}
+	m.rememberPrompt("filter", "a")
+	m.rememberPrompt("filter", "b")
+	m.rememberPrompt("filter", "a")
+	h := m.promptHistory["filter"]
+	if len(h) != 2 || h[0] != "b" || h[1] != "a" {
+		t.Fatalf("history = %v; want [b a]", h)
+	}
+}
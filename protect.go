@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Delete protection -------------------
+
+// defaultProtectedPaths are system locations that are never deleted without
+// a typed override. They protect the directory itself, not its contents.
+var defaultProtectedPaths = []string{
+	"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib32", "/lib64",
+	"/opt", "/proc", "/root", "/sbin", "/srv", "/sys", "/usr", "/usr/*", "/var",
+	"/Applications", "/Library", "/System", "/System/**", "/Users", "/Volumes",
+	`C:\`, `C:\Windows`, `C:\Windows\**`, `C:\Program Files`, `C:\Program Files (x86)`,
+	`C:\ProgramData`, `C:\Users`,
+}
+
+// protectedRules decides which paths need a typed override to delete.
+type protectedRules struct {
+	globs  []string
+	refuse bool // refuse outright instead of asking for the typed path
+}
+
+func newProtectedRules(extra []string, refuse bool) protectedRules {
+	globs := append([]string(nil), defaultProtectedPaths...)
+	if h, err := os.UserHomeDir(); err == nil {
+		globs = append(globs, h)
+	}
+	for _, g := range extra {
+		globs = append(globs, expandHome(g))
+	}
+	return protectedRules{globs: globs, refuse: refuse}
+}
+
+// match returns the rule protecting path, if any.
+func (r protectedRules) match(path string) (string, bool) {
+	p := normalizeProtectPath(path)
+	for _, g := range r.globs {
+		ng := normalizeProtectPath(g)
+		if sub, ok := strings.CutSuffix(ng, "/**"); ok {
+			if p == sub || strings.HasPrefix(p, strings.TrimSuffix(sub, "/")+"/") {
+				return g, true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(ng, p); ok {
+			return g, true
+		}
+	}
+	return "", false
+}
+
+// normalizeProtectPath cleans p and uses forward slashes so one set of rules
+// works on every platform. Windows paths compare case-insensitively.
+func normalizeProtectPath(p string) string {
+	if strings.HasSuffix(p, "/**") || strings.HasSuffix(p, `\**`) {
+		return normalizeProtectPath(p[:len(p)-3]) + "/**"
+	}
+	p = filepath.ToSlash(filepath.Clean(filepath.FromSlash(p)))
+	if runtime.GOOS == "windows" || strings.Contains(p, `\`) || (len(p) >= 2 && p[1] == ':') {
+		p = strings.ToLower(strings.ReplaceAll(p, `\`, "/"))
+	}
+	return p
+}
+
+// promptProtectedDelete handles a delete request for a protected path: it is
+// either refused or requires typing the full path as an override.
+func (m *model) promptProtectedDelete(n *Node, rule string) {
+	if m.protect.refuse {
+		m.status = fmt.Sprintf("⚠ %s is protected (%s); delete refused", n.Path, rule)
+		return
+	}
+	validate := func(v string) error {
+		if v != n.Path {
+			return errors.New("type the full path exactly to delete it")
+		}
+		return nil
+	}
+	title := fmt.Sprintf("%s is protected (%s). Type its full path to move it to the trash", n.Name, rule)
+	p := newPrompt(m, "protected", title, "", validate, func(m *model, v string) tea.Cmd {
+		return m.deleteToTrash(n.Path)
+	})
+	p.noHistory = true
+	m.overlays.push(p)
+}
@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestProtectedRulesMatch(t *testing.T) {
+	r := newProtectedRules([]string{"/data/prod/**", "/srv/*.db"}, false)
+	cases := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/usr", true},
+		{"/usr/local", true},      // /usr/*
+		{"/usr/local/foo", false}, // contents of /usr/local are fair game
+		{"/etc/", true},           // cleaned before matching
+		{"/data/prod", true},      // the ** root itself
+		{"/data/prod/a/b", true},  // and everything below it
+		{"/data/production", false},
+		{"/srv/app.db", true},
+		{"/tmp/scratch", false},
+		{`C:\Windows`, true},
+		{`c:\windows\system32`, true},
+		{`C:\Temp`, false},
+	}
+	for _, c := range cases {
+		if _, got := r.match(c.path); got != c.want {
+			t.Errorf("match(%q) = %v; want %v", c.path, got, c.want)
+		}
+	}
+}
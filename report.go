@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// --------------------------- Report ------------------------------
+
+// -report prints a du-style summary of -root and exits without starting
+// the TUI, for scripts and cron jobs: a line per directory down to -depth
+// levels below the root, size and path separated by a tab. As with du,
+// each directory comes after the ones inside it (largest first here) and
+// the root comes last, with the total. Directories that couldn't be read
+// in full are named on stderr and the exit status is 1.
+
+// runReport writes the report of root to w and the read errors to errw.
+// It scans with a copy of s that trusts mtimes: every record the levels
+// reuse was written by this run moments ago.
+func (s *Scanner) runReport(ctx context.Context, root string, depth int, w, errw io.Writer) error {
+	rs := *s
+	rs.trustMtime = true
+	bw := bufio.NewWriter(w)
+	failed := rs.reportDir(ctx, bw, errw, root, depth)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d %s could not be read in full; their sizes are too low", failed, folders(failed))
+	}
+	return nil
+}
+
+// reportDir reports path and, depth levels deep, the directories below it.
+// It returns how many directories it reported errors for. The walks are
+// incremental, so a level below reuses what sizing this one recorded.
+func (s *Scanner) reportDir(ctx context.Context, w, errw io.Writer, path string, depth int) int {
+	n, _ := s.scan(ctx, path, true, nil)
+	failed := 0
+	if depth > 0 {
+		var dirs []*Node
+		for _, c := range n.Children {
+			if c.IsDir && !s.excludesMount(c.Path) {
+				dirs = append(dirs, c)
+			}
+		}
+		sort.SliceStable(dirs, func(i, j int) bool { return dirs[i].Size > dirs[j].Size })
+		for _, c := range dirs {
+			if ctx.Err() != nil {
+				break
+			}
+			failed += s.reportDir(ctx, w, errw, c.Path, depth-1)
+		}
+	}
+	// above the last level an error below is reported where it happened
+	if n.Err != nil && (depth == 0 || len(n.Children) == 0) {
+		fmt.Fprintf(errw, "disktree: %s: %v\n", path, n.Err)
+		failed++
+	}
+	fmt.Fprintf(w, "%s\t%s\n", humanBytes(maxInt64(n.Size, 0)), path)
+	return failed
+}
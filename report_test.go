@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReportListsDirectoriesDuStyle(t *testing.T) {
+	root := t.TempDir()
+	for p, size := range map[string]int{"big/deep/f": 5000, "small/g": 300, "top.txt": 3} {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &Scanner{threads: 4, mounts: newMountTable(nil)}
+	line := func(size int64, rel string) string {
+		return humanBytes(size) + "\t" + filepath.Join(root, rel)
+	}
+
+	for _, tc := range []struct {
+		depth int
+		want  []string
+	}{
+		{0, []string{line(5303, "")}},
+		{1, []string{line(5000, "big"), line(300, "small"), line(5303, "")}},
+		{2, []string{line(5000, "big/deep"), line(5000, "big"), line(300, "small"), line(5303, "")}},
+	} {
+		var out, errs bytes.Buffer
+		if err := s.runReport(context.Background(), root, tc.depth, &out, &errs); err != nil {
+			t.Fatalf("depth %d: %v (%s)", tc.depth, err, errs.String())
+		}
+		if s.trustMtime {
+			t.Fatal("runReport should leave the caller's scanner as it was")
+		}
+		got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("depth %d:\n%s\nwant:\n%s", tc.depth, strings.Join(got, "\n"), strings.Join(tc.want, "\n"))
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -61,3 +64,55 @@ func TestMoveAndRestoreFile(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteAndRestorePropagateToCachedAncestors(t *testing.T) {
+	cache = sync.Map{}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	tmp := t.TempDir()
+	sub := filepath.Join(tmp, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "big"), bytes.Repeat([]byte{'x'}, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "other"), bytes.Repeat([]byte{'y'}, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// populate the cache for every level of the breadcrumb chain
+	s := &Scanner{threads: 2}
+	root := s.scanDir(context.Background(), tmp)
+	aNode := s.scanDir(context.Background(), filepath.Join(tmp, "a"))
+	m := initialModel(tmp, 2, false)
+	m.breadcrumbs = []string{tmp, filepath.Join(tmp, "a"), sub}
+	m.current = s.scanDir(context.Background(), sub)
+
+	m.deleteToTrash(filepath.Join(sub, "big"))
+	if root.Size != 10 {
+		t.Fatalf("root size after delete = %d; want 10", root.Size)
+	}
+	for _, c := range root.Children {
+		if c.Name == "a" && (c.Size != 0 || c.Files != 0) {
+			t.Fatalf("root entry for a not updated: size=%d files=%d", c.Size, c.Files)
+		}
+	}
+	if m.current.Size != 0 || len(m.current.Children) != 0 {
+		t.Fatalf("current view not updated: size=%d children=%d", m.current.Size, len(m.current.Children))
+	}
+	// only b held the file directly; the directories above keep their own size
+	if b := aNode.Children[0]; b.Exclusive != 0 || aNode.Exclusive != 0 || root.Exclusive != 10 {
+		t.Fatalf("exclusive sizes after delete: b=%d a=%d root=%d; want 0, 0, 10", b.Exclusive, aNode.Exclusive, root.Exclusive)
+	}
+
+	m.undo()
+	if root.Size != 1010 || root.Files != 2 {
+		t.Fatalf("root after restore = %d bytes, %d files; want 1010, 2", root.Size, root.Files)
+	}
+	if m.current.Size != 1000 || len(m.current.Children) != 1 {
+		t.Fatalf("current view after restore: size=%d children=%d", m.current.Size, len(m.current.Children))
+	}
+	if b := aNode.Children[0]; b.Exclusive != 1000 || m.current.Exclusive != 1000 {
+		t.Fatalf("exclusive size of b after restore = %d / %d; want 1000", b.Exclusive, m.current.Exclusive)
+	}
+}
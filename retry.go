@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Retry errored -----------------------
+
+// After a chmod, a chown or joining a group, T sizes again only the
+// directories that failed — every entry of the loaded tree whose totals
+// carry an error — and merges the fresh totals like an elevated rescan,
+// instead of walking the whole volume again.
+
+type retryDoneMsg struct {
+	reports []batchReport
+}
+
+// retryTargets are the directories of the loaded tree (the current view
+// and every cached listing) with an error or no access, deepest first so
+// an enclosing folder's fresh sum is merged after the ones inside it.
+func (m *model) retryTargets() []string {
+	seen := map[string]bool{}
+	var paths []string
+	collect := func(n *Node) {
+		if n.Err != nil && len(n.Children) == 0 && !seen[pathKey(n.Path)] {
+			// the listing itself failed
+			seen[pathKey(n.Path)] = true
+			paths = append(paths, n.Path)
+		}
+		for _, c := range n.Children {
+			if c.IsDir && (c.Err != nil || c.NoAccess) && !seen[pathKey(c.Path)] {
+				seen[pathKey(c.Path)] = true
+				paths = append(paths, c.Path)
+			}
+		}
+	}
+	if m.current != nil {
+		collect(m.current)
+	}
+	cache.Range(func(_, v any) bool {
+		collect(v.(*Node))
+		return true
+	})
+	sep := string(filepath.Separator)
+	slices.SortFunc(paths, func(a, b string) int {
+		if d := strings.Count(b, sep) - strings.Count(a, sep); d != 0 {
+			return d
+		}
+		return strings.Compare(a, b)
+	})
+	return paths
+}
+
+// retryErrored sizes the retry targets in the background.
+func (m *model) retryErrored() tea.Cmd {
+	if m.loading || m.retrying {
+		m.status = "Wait for the scan to finish before retrying errors"
+		return nil
+	}
+	paths := m.retryTargets()
+	if len(paths) == 0 {
+		m.status = "Nothing to retry: no errors in the loaded tree"
+		return nil
+	}
+	m.retrying = true
+	m.status = fmt.Sprintf("Retrying %d errored %s ...", len(paths), folders(len(paths)))
+	ctx, s := m.ctx, m.scanner
+	return func() tea.Msg {
+		reps := make([]batchReport, 0, len(paths))
+		for _, p := range paths {
+			if ctx.Err() != nil {
+				break
+			}
+			reps = append(reps, batchReport{Path: p, sumReport: sumReportOf(s.sumDir(ctx, p))})
+		}
+		return retryDoneMsg{reports: reps}
+	}
+}
+
+func folders(n int) string {
+	if n == 1 {
+		return "folder"
+	}
+	return "folders"
+}
+
+// applyRetry merges the fresh totals. A current directory that couldn't
+// be listed is listed again.
+func (m *model) applyRetry(msg retryDoneMsg) tea.Cmd {
+	m.retrying = false
+	var before int64
+	if root := m.cachedOrCurrent(m.rootPath); root != nil {
+		before = root.Size
+	}
+	relist := false
+	fixed := 0
+	for _, r := range msg.reports {
+		if r.Err == "" {
+			fixed++
+			if v, ok := cache.Load(pathKey(r.Path)); ok && v.(*Node).Err != nil && len(v.(*Node).Children) == 0 {
+				cache.Delete(pathKey(r.Path))
+			}
+			if m.current != nil && samePath(m.current.Path, r.Path) && m.current.Err != nil && len(m.current.Children) == 0 {
+				relist = true
+			}
+		}
+		m.mergeSum(r.Path, r.sumReport)
+	}
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+	m.status = fmt.Sprintf("Retried %d %s: %d readable now", len(msg.reports), folders(len(msg.reports)), fixed)
+	if root := m.cachedOrCurrent(m.rootPath); root != nil && root.Size > before {
+		m.status += " (+" + humanBytes(root.Size-before) + ")"
+	}
+	if failed := len(msg.reports) - fixed; failed > 0 {
+		m.status += fmt.Sprintf(", %d still failing", failed)
+	}
+	if relist {
+		return m.rescanCurrent(false)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRetryErroredMergesFixedFolders(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	tmp := t.TempDir()
+	locked := filepath.Join(tmp, "locked")
+	inner := filepath.Join(locked, "inner")
+	if err := os.MkdirAll(inner, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for p, size := range map[string]int{filepath.Join(locked, "a"): 30, filepath.Join(inner, "b"): 70} {
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the scan found locked unreadable; its permissions have been fixed since
+	m := initialModel(tmp, 2, false)
+	child := &Node{Name: "locked", Path: locked, IsDir: true, Size: -1, Err: os.ErrPermission, NoAccess: true}
+	m.current = &Node{Name: filepath.Base(tmp), Path: tmp, IsDir: true, Children: []*Node{child}, Scanned: true}
+	cache.Store(pathKey(tmp), m.current)
+	// and a listing further down that failed on its own
+	cache.Store(pathKey(inner), &Node{Name: "inner", Path: inner, IsDir: true, Err: os.ErrPermission, Scanned: true})
+
+	if got := m.retryTargets(); len(got) != 2 || got[0] != inner || got[1] != locked {
+		t.Fatalf("retryTargets = %v; want inner before locked", got)
+	}
+	cmd := m.retryErrored()
+	if cmd == nil || !m.retrying {
+		t.Fatalf("no retry started: %q", m.status)
+	}
+	if m.retryErrored() != nil {
+		t.Fatal("a second retry started while one was running")
+	}
+	m.applyRetry(cmd().(retryDoneMsg))
+	if child.Err != nil || child.NoAccess || child.Size != 100 || child.Files != 2 {
+		t.Fatalf("locked not merged: %+v", child)
+	}
+	if m.current.Size != 100 {
+		t.Fatalf("parent size = %d; want 100", m.current.Size)
+	}
+	if _, ok := cache.Load(pathKey(inner)); ok {
+		t.Fatal("the failed listing of inner is still cached")
+	}
+	if !strings.Contains(m.status, "2 readable now") {
+		t.Fatalf("status = %q", m.status)
+	}
+	if len(m.retryTargets()) != 0 {
+		t.Fatalf("still errored after the retry: %v", m.retryTargets())
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --------------------------- Scan as another user ----------------
+
+// With -scan-as, directories are sized by a helper running under another
+// account (a NAS admin's view of shares only a service account can read)
+// while the TUI stays unprivileged. The helper is this binary started
+// through sudo -u (or pkexec --user) with -serve-sums: it listens on a
+// local socket in a directory of its own and answers one sum request per
+// line, like -sum-json does for a single elevated rescan. Connecting takes
+// a token the TUI hands it over stdin, since the socket has to be
+// reachable from the TUI's account; closing stdin ends it.
+
+// sumRequest asks the helper for the totals of a directory.
+type sumRequest struct {
+	Path string `json:"path"`
+}
+
+// sumReportOf is the helper's answer for res.
+func sumReportOf(res dirSum) sumReport {
+	r := sumReport{Size: res.size, Files: res.files, Dirs: res.dirs, Exclusive: res.exclusive, Disk: res.disk, Cloud: res.cloud, Margin: res.margin}
+	if res.err != nil {
+		r.Err = res.err.Error()
+	}
+	return r
+}
+
+// runSumServer is the body of the -serve-sums helper. It reads the token
+// from in, prints the socket's path to out and serves until in is closed.
+func runSumServer(in io.Reader, out io.Writer, s *Scanner) error {
+	r := bufio.NewReader(in)
+	token, err := r.ReadString('\n')
+	token = strings.TrimSpace(token)
+	if err != nil || token == "" {
+		return errors.New("-serve-sums: no token on stdin")
+	}
+	dir, err := os.MkdirTemp("", "disktree-scan-as-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "sums.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	// the TUI runs as someone else: it must get through the directory and
+	// write to the socket; the token keeps everyone else out
+	if err := os.Chmod(dir, 0o711); err != nil {
+		return err
+	}
+	if err := os.Chmod(sock, 0o666); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(out, sock); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSums(conn, token, s)
+		}
+	}()
+	_, _ = io.Copy(io.Discard, r) // until the TUI exits
+	return nil
+}
+
+// serveSums answers the requests on one connection once it has shown the
+// token.
+func serveSums(conn net.Conn, token string, s *Scanner) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	got, err := r.ReadString('\n')
+	if err != nil || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(token)) != 1 {
+		return
+	}
+	dec, enc := json.NewDecoder(r), json.NewEncoder(conn)
+	for {
+		var req sumRequest
+		if dec.Decode(&req) != nil {
+			return
+		}
+		if enc.Encode(sumReportOf(s.sumDir(context.Background(), req.Path))) != nil {
+			return
+		}
+	}
+}
+
+// scanAsBridge is the TUI's side of the helper: a pool of authenticated
+// connections, one per walker that is waiting on a sum.
+type scanAsBridge struct {
+	user   string
+	sock   string
+	token  string
+	stdin  io.Closer    // closing it ends the helper
+	cmd    *exec.Cmd    // nil when the helper wasn't started by us (tests)
+	failed atomic.Int64 // sums that fell back to walking as ourselves
+	mu     sync.Mutex
+	idle   []*sumConn
+}
+
+type sumConn struct {
+	c   net.Conn
+	dec *json.Decoder
+	enc *json.Encoder
+}
+
+// helperArgs are the flags that make the helper's scanner count like s.
+func (s *Scanner) helperArgs() []string {
+	args := []string{"-threads", fmt.Sprint(s.threads), "-root", s.root}
+	if s.followSymlinks {
+		args = append(args, "-follow-symlinks", "-symlink-policy", s.linkPolicy.String())
+	}
+	if s.excludeHidden {
+		args = append(args, "-exclude-hidden")
+	}
+	if s.oneFileSystem {
+		args = append(args, "-one-file-system")
+	}
+	if s.allocated {
+		args = append(args, "-allocated")
+	}
+	// explicit either way, so the helper's config can't turn them on
+	args = append(args, fmt.Sprintf("-xattrs=%t", s.xattrs), fmt.Sprintf("-compressed=%t", s.diskSizes))
+	args = append(args, s.sampling.args()...)
+	return append(args, s.exclude.args()...)
+}
+
+// startScanAs starts the helper as user, through sudo or pkexec, before
+// the TUI takes over the terminal so a password can be asked for.
+func startScanAs(user string, s *Scanner) (*scanAsBridge, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("-scan-as is not supported on Windows")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	helper := append([]string{self, "-serve-sums"}, s.helperArgs()...)
+	var c *exec.Cmd
+	if p, err := exec.LookPath("sudo"); err == nil {
+		c = exec.Command(p, append([]string{"-u", user, "--"}, helper...)...)
+	} else if p, err := exec.LookPath("pkexec"); err == nil {
+		c = exec.Command(p, append([]string{"--user", user}, helper...)...)
+	} else {
+		return nil, errors.New("-scan-as needs sudo or pkexec")
+	}
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	b := &scanAsBridge{user: user, token: newToken(), stdin: stdin, cmd: c}
+	fail := func(err error) (*scanAsBridge, error) {
+		b.close()
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("-scan-as %s: %w", user, err)
+	}
+	if _, err := fmt.Fprintln(stdin, b.token); err != nil {
+		return fail(err)
+	}
+	sock, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		return fail(errors.New("the helper did not start"))
+	}
+	b.sock = strings.TrimSpace(sock)
+	sc, err := b.get()
+	if err != nil {
+		return fail(err)
+	}
+	b.put(sc)
+	return b, nil
+}
+
+// newToken is a random secret for the helper's socket.
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// get takes an idle connection or opens a new one.
+func (b *scanAsBridge) get() (*sumConn, error) {
+	b.mu.Lock()
+	if n := len(b.idle); n > 0 {
+		sc := b.idle[n-1]
+		b.idle = b.idle[:n-1]
+		b.mu.Unlock()
+		return sc, nil
+	}
+	b.mu.Unlock()
+	c, err := net.Dial("unix", b.sock)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprintln(c, b.token); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &sumConn{c: c, dec: json.NewDecoder(c), enc: json.NewEncoder(c)}, nil
+}
+
+func (b *scanAsBridge) put(sc *sumConn) {
+	b.mu.Lock()
+	b.idle = append(b.idle, sc)
+	b.mu.Unlock()
+}
+
+// sum has the helper size p. It reports false when p should be walked as
+// ourselves after all: the helper failed or the scan was cancelled.
+func (b *scanAsBridge) sum(ctx context.Context, p string) (dirSum, bool) {
+	if b == nil {
+		return dirSum{}, false
+	}
+	sc, err := b.get()
+	if err != nil {
+		b.failed.Add(1)
+		return dirSum{}, false
+	}
+	stop := context.AfterFunc(ctx, func() { _ = sc.c.SetDeadline(time.Now()) })
+	var rep sumReport
+	err = sc.enc.Encode(sumRequest{Path: p})
+	if err == nil {
+		err = sc.dec.Decode(&rep)
+	}
+	if !stop() || err != nil {
+		sc.c.Close()
+		if ctx.Err() == nil {
+			b.failed.Add(1)
+		}
+		return dirSum{}, false
+	}
+	b.put(sc)
+	res := dirSum{size: rep.Size, files: rep.Files, dirs: rep.Dirs, exclusive: rep.Exclusive, disk: rep.Disk, cloud: rep.Cloud, margin: rep.Margin}
+	if rep.Err != "" {
+		res.err = errors.New(rep.Err)
+	}
+	return res, true
+}
+
+// close ends the helper and drops the connections.
+func (b *scanAsBridge) close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	for _, sc := range b.idle {
+		sc.c.Close()
+	}
+	b.idle = nil
+	b.mu.Unlock()
+	_ = b.stdin.Close()
+	if b.cmd == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = b.cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		_ = b.cmd.Process.Kill() // sudo passes the signal on
+	}
+}
+
+// scanAsTag is the header note while sizes come from the helper.
+func (m *model) scanAsTag() string {
+	b := m.scanner.scanAs
+	if b == nil {
+		return ""
+	}
+	if n := b.failed.Load(); n > 0 {
+		return fmt.Sprintf("[sizing as %s: helper failed %d times, sized as you]", b.user, n)
+	}
+	return "[sizing as " + b.user + "]"
+}
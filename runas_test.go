@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanAsHelperServesSums(t *testing.T) {
+	dir := t.TempDir()
+	for i, size := range []int{100, 23} {
+		p := filepath.Join(dir, "sub", fmt.Sprint(i))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- runSumServer(inR, outW, &Scanner{threads: 2}) }()
+	b := &scanAsBridge{user: "svc", token: "secret", stdin: inW}
+	fmt.Fprintln(inW, b.token)
+	sock, err := bufio.NewReader(outR).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.sock = strings.TrimSpace(sock)
+
+	res, ok := b.sum(context.Background(), filepath.Join(dir, "sub"))
+	if !ok || res.size != 123 || res.files != 2 {
+		t.Fatalf("sum = %+v, %v; want 123 bytes in 2 files", res, ok)
+	}
+	// the connection goes back to the pool and serves the next request
+	if res, ok = b.sum(context.Background(), dir); !ok || res.size != 123 || len(b.idle) != 1 {
+		t.Fatalf("second sum = %+v, %v with %d idle connections", res, ok, len(b.idle))
+	}
+
+	// without the token the helper hangs up
+	c, err := net.Dial("unix", b.sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(c, "guess")
+	_ = json.NewEncoder(c).Encode(sumRequest{Path: dir})
+	var rep sumReport
+	if err := json.NewDecoder(c).Decode(&rep); err == nil {
+		t.Fatalf("helper answered a wrong token: %+v", rep)
+	}
+	c.Close()
+
+	b.close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(b.sock)); !os.IsNotExist(err) {
+		t.Fatalf("socket directory left behind: %v", err)
+	}
+	m := initialModel(dir, 1, false)
+	m.scanner.scanAs = b
+	if tag := m.scanAsTag(); tag != "[sizing as svc]" {
+		t.Fatalf("tag = %q", tag)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// --------------------------- Sampling ----------------------------
+
+// sampling sizes the files of huge directories from a sample instead of
+// stat'ing every one (-sample-above 1000000 -sample-rate 0.01): listing a
+// directory with millions of entries is quick, the stat per file is what
+// takes minutes on a network share. Subdirectories are still all walked.
+type sampling struct {
+	above int     // directories with more entries than this are sampled
+	rate  float64 // fraction of their files that is stat'ed
+}
+
+// newSampling returns nil when sampling is off (above is 0).
+func newSampling(above int, rate float64) (*sampling, error) {
+	if above <= 0 {
+		return nil, nil
+	}
+	if rate <= 0 || rate >= 1 {
+		return nil, fmt.Errorf("-sample-rate must be between 0 and 1, got %g", rate)
+	}
+	return &sampling{above: above, rate: rate}, nil
+}
+
+// args are the flags that sample like s in a helper; none when off.
+func (s *sampling) args() []string {
+	if s == nil {
+		return nil
+	}
+	return []string{"-sample-above", fmt.Sprint(s.above), "-sample-rate", fmt.Sprint(s.rate)}
+}
+
+// stride is how many files of a directory with entries entries are skipped
+// per one stat'ed: 1 stats them all.
+func (s *sampling) stride(entries int) int {
+	if s == nil || entries <= s.above {
+		return 1
+	}
+	return max(1, int(math.Round(1/s.rate)))
+}
+
+// fileSample collects the files stat'ed in a sampled directory. Files the
+// exclusion predicates leave out count as size 0, so the estimate covers
+// only what a full walk would have counted.
+type fileSample struct {
+	n, kept    int64
+	sum, sumSq float64
+	disk       float64 // on-disk sizes, with -compressed
+	cloud      float64 // sizes of cloud-sync placeholders
+}
+
+func (f *fileSample) add(size, disk, cloud int64, kept bool) {
+	f.n++
+	if !kept {
+		return
+	}
+	f.kept++
+	f.sum += float64(size)
+	f.sumSq += float64(size) * float64(size)
+	f.disk += float64(disk)
+	f.cloud += float64(cloud)
+}
+
+// scaled is the share of an estimated size that part (disk or cloud) is
+// of the sample's sizes.
+func (f *fileSample) scaled(part float64, size int64) int64 {
+	if f.sum <= 0 {
+		return 0
+	}
+	return int64(math.Round(float64(size) * part / f.sum))
+}
+
+// estimate extrapolates the sample to the directory's total files: its
+// size and file count, and the half-width of a 95% confidence interval
+// around the size (with the finite population correction).
+func (f *fileSample) estimate(total int64) (size, files, margin int64) {
+	if f.n == 0 || total <= 0 {
+		return 0, 0, 0
+	}
+	n, N := float64(f.n), float64(total)
+	mean := f.sum / n
+	size = int64(math.Round(N * mean))
+	files = int64(math.Round(float64(f.kept) * N / n))
+	if f.n < 2 {
+		return size, files, size // one file says nothing about the spread
+	}
+	variance := max(0, (f.sumSq-n*mean*mean)/(n-1))
+	se := N * math.Sqrt(variance/n*max(0, 1-n/N))
+	return size, files, int64(math.Round(1.96 * se))
+}
+
+// combineMargins adds up independent margins: their squares add.
+func combineMargins(a, b int64) int64 {
+	if a == 0 || b == 0 {
+		return a + b
+	}
+	return int64(math.Round(math.Hypot(float64(a), float64(b))))
+}
+
+// sampledTag is the row note of an entry whose size is in part sampled.
+func sampledTag(n *Node) string {
+	if n.Margin <= 0 || n.Size <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("  [sampled ±%.1f%%]", 100*float64(n.Margin)/float64(n.Size))
+}
+
+// samplingTag is the header note for a directory with sampled totals.
+func (m *model) samplingTag() string {
+	if m.current == nil || m.current.Margin <= 0 {
+		return ""
+	}
+	return "[sampled: ±" + humanBytes(m.current.Margin) + " at 95%]"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSampleEstimate(t *testing.T) {
+	var f fileSample
+	for _, size := range []int64{100, 100, 100, 100} {
+		f.add(size, 0, 0, true)
+	}
+	if size, files, margin := f.estimate(40); size != 4000 || files != 40 || margin != 0 {
+		t.Fatalf("equal sizes: estimate = %d, %d, ±%d; want 4000, 40, ±0", size, files, margin)
+	}
+	f = fileSample{}
+	for i := range 40 {
+		f.add(int64(i%2*200), 0, 0, true)
+	}
+	size, _, margin := f.estimate(400)
+	if size != 40000 || margin <= 0 || margin >= size {
+		t.Fatalf("spread sizes: estimate = %d ±%d; want 40000 with a margin", size, margin)
+	}
+	if _, _, all := f.estimate(40); all != 0 {
+		t.Fatalf("a sample of every file should have no margin, got ±%d", all)
+	}
+	if s, err := newSampling(0, 0.01); s != nil || err != nil {
+		t.Fatalf("sampling off should be nil, got %v, %v", s, err)
+	}
+	if _, err := newSampling(10, 1.5); err == nil {
+		t.Fatal("a rate above 1 should fail")
+	}
+}
+
+func TestSamplingScan(t *testing.T) {
+	root := t.TempDir()
+	big := filepath.Join(root, "big")
+	if err := os.Mkdir(big, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 40 {
+		if err := os.WriteFile(filepath.Join(big, fmt.Sprint("f", i)), make([]byte, 100+i%2*100), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "small"), make([]byte, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 1, mounts: newMountTable(nil), sampling: &sampling{above: 10, rate: 0.5}}
+	n, _ := s.scan(context.Background(), root, false, nil)
+	var b *Node
+	for _, c := range n.Children {
+		if c.Name == "big" {
+			b = c
+		}
+	}
+	if b == nil {
+		t.Fatalf("big missing: %+v", n.Children)
+	}
+	if b.Margin <= 0 || b.Size < 4000 || b.Size > 8000 || b.Files != 40 {
+		t.Fatalf("big = %d ±%d in %d files; want about 6000 with a margin, 40 files", b.Size, b.Margin, b.Files)
+	}
+	if n.Margin != b.Margin || sampledTag(b) == "" {
+		t.Fatalf("the root should carry big's margin: %d vs %d", n.Margin, b.Margin)
+	}
+}
+
+func TestHelpersSampleLikeTheTUI(t *testing.T) {
+	s := &Scanner{threads: 1, mounts: newMountTable(nil), sampling: &sampling{above: 10, rate: 0.5}}
+	args := strings.Join(s.helperArgs(), " ")
+	if !strings.Contains(args, "-sample-above 10 -sample-rate 0.5") {
+		t.Fatalf("helper args %q should carry the sampling", args)
+	}
+	if rep := sumReportOf(dirSum{size: 6000, margin: 400}); rep.Margin != 400 {
+		t.Fatalf("the helper's report should carry the margin, got %+v", rep)
+	}
+}
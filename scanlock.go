@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Scan coordination -------------------
+
+// Two instances walking the same huge NFS root double the load on the
+// server. So each TUI scan registers a claim in the data directory, and an
+// instance starting on a root another one is already scanning (or one
+// below it) offers to attach instead: it waits for that scan to finish,
+// takes over its directory records and rescans incrementally, which stats
+// each directory instead of listing and stat'ing every file again. The
+// claims are advisory; "Scan anyway" ignores them. Only instances whose
+// options give the same totals (recordsKey) attach to each other.
+
+// scanClaim is a running instance's claim on a root, one file per process
+// in scansDir().
+type scanClaim struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	User    string    `json:"user"`
+	Root    string    `json:"root"`
+	Started time.Time `json:"started"`
+	// Options is the recordsKey of the scanner, which the records'
+	// totals depend on
+	Options string `json:"options"`
+	// Records is the snapshot of the scan's directory records, set once
+	// the scan of Root has finished
+	Records string `json:"records,omitempty"`
+
+	file string // the claim's own path
+}
+
+// claimStale is how old a claim from another host may get before it is
+// taken for a crashed instance; running instances touch theirs every
+// claimBeat. Processes on this host are simply probed.
+const (
+	claimBeat  = time.Minute
+	claimStale = 3 * claimBeat
+)
+
+// claimScan registers this process's scan of root with the scanner options
+// opts (recordsKey). Coordination is a courtesy, so a claim that can't be
+// written is nil and nothing else.
+func claimScan(root, opts string) *scanClaim {
+	host, _ := os.Hostname()
+	c := &scanClaim{PID: os.Getpid(), Host: host, User: auditUser(), Root: root, Started: time.Now(), Options: opts,
+		file: filepath.Join(scansDir(), fmt.Sprintf("%s-%d.json", host, os.Getpid()))}
+	if err := os.MkdirAll(scansDir(), 0o755); err != nil {
+		return nil
+	}
+	if c.save() != nil {
+		return nil
+	}
+	return c
+}
+
+func (c *scanClaim) save() error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.file)
+}
+
+// readClaim reads the claim at path.
+func readClaim(path string) (*scanClaim, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c scanClaim
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	c.file = path
+	return &c, nil
+}
+
+// alive reports whether the claim's process still runs. Stale claims are
+// left for release or another instance to clean up.
+func (c *scanClaim) alive() bool {
+	if host, _ := os.Hostname(); c.Host == host {
+		return processAlive(c.PID)
+	}
+	fi, err := os.Stat(c.file)
+	return err == nil && time.Since(fi.ModTime()) < claimStale
+}
+
+// remove deletes the claim and its records.
+func (c *scanClaim) remove() {
+	if c == nil {
+		return
+	}
+	_ = os.Remove(c.file)
+	if c.Records != "" {
+		_ = os.Remove(c.Records)
+	}
+}
+
+// otherClaims are the live claims of other processes on roots that
+// overlap root: the same, an ancestor or a directory below it. Claims of
+// processes that are gone are removed on the way.
+func otherClaims(root string) []*scanClaim {
+	ents, err := os.ReadDir(scansDir())
+	if err != nil {
+		return nil
+	}
+	host, _ := os.Hostname()
+	var out []*scanClaim
+	for _, e := range ents {
+		if !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		c, err := readClaim(filepath.Join(scansDir(), e.Name()))
+		if err != nil || c.Host == host && c.PID == os.Getpid() {
+			continue
+		}
+		if !c.alive() {
+			c.remove()
+			continue
+		}
+		if underPath(root, c.Root) || underPath(c.Root, root) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// coveringClaim is the first of claims whose root contains root and whose
+// options are opts, whose results can stand in for a scan of root.
+func coveringClaim(root, opts string, claims []*scanClaim) *scanClaim {
+	for _, c := range claims {
+		if underPath(root, c.Root) && c.Options == opts {
+			return c
+		}
+	}
+	return nil
+}
+
+// who names the claim's instance for the dialog and status line.
+func (c *scanClaim) who() string {
+	w := "disktree " + strconv.Itoa(c.PID)
+	if host, _ := os.Hostname(); c.Host != host {
+		w += " on " + c.Host
+	}
+	if c.User != "" {
+		w += " (" + c.User + ")"
+	}
+	return w
+}
+
+// recordsKey describes the options the totals in the directory records
+// depend on. An instance started with other flags would compute other
+// sizes, so it can't use these records.
+func (s *Scanner) recordsKey() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "hidden=%t unreadable=%t xdev=%t allocated=%t xattrs=%t disk=%t depth=%d", s.excludeHidden, s.tryUnreadable, s.oneFileSystem, s.allocated, s.xattrs, s.diskSizes, maxTreeDepth)
+	if s.followSymlinks {
+		fmt.Fprintf(&b, " follow=%s", s.linkPolicy)
+		if s.linkPolicy == linkAtLink {
+			fmt.Fprintf(&b, " root=%s", s.root) // links into the root count there
+		}
+	}
+	if s.exclude != nil {
+		for _, sp := range s.exclude.specs {
+			fmt.Fprintf(&b, " %s=%s", sp[0], sp[1])
+		}
+	}
+	if s.sampling != nil {
+		fmt.Fprintf(&b, " sample=%d/%g", s.sampling.above, s.sampling.rate)
+	}
+	if s.budget != nil {
+		// a spent budget leaves estimates in the records
+		fmt.Fprintf(&b, " budget=%s/%d", s.budget.time, s.budget.files)
+	}
+	return b.String()
+}
+
+// recordLine is one directory record in a snapshot.
+type recordLine struct {
+	Path    string                `json:"p"`
+	MTime   time.Time             `json:"t"`
+	FP      uint64                `json:"fp"`
+	Size    int64                 `json:"s,omitempty"`
+	Files   int64                 `json:"f,omitempty"`
+	Disk    int64                 `json:"dk,omitempty"`
+	Cloud   int64                 `json:"c,omitempty"`
+	Margin  int64                 `json:"m,omitempty"`
+	Special scanner.SpecialCounts `json:"x"`
+	Subdirs []string              `json:"d,omitempty"`
+	Links   []string              `json:"l,omitempty"`
+}
+
+// writeRecords saves the directory records to path, gzipped JSON lines,
+// and returns how many it wrote. They are all from walks below the root;
+// whoever loads them checks each directory's mtime before trusting it.
+func writeRecords(path string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriterSize(zw, 64<<10)
+	enc := json.NewEncoder(bw)
+	n := 0
+	dirRecords.Range(func(k, v any) bool {
+		r := v.(*dirRecord)
+		err = enc.Encode(recordLine{Path: k.(string), MTime: r.mtime, FP: r.fp, Size: r.own.size, Files: r.own.files, Disk: r.own.disk, Cloud: r.own.cloud, Margin: r.own.margin, Special: r.own.special, Subdirs: r.subdirs, Links: r.links})
+		n++
+		return err == nil
+	})
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return n, err
+}
+
+// loadRecords takes over the records in a snapshot; records of this
+// process's own walks are kept.
+func loadRecords(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+	dec := json.NewDecoder(bufio.NewReaderSize(zr, 64<<10))
+	n := 0
+	for dec.More() {
+		var l recordLine
+		if err := dec.Decode(&l); err != nil {
+			return n, err
+		}
+		own := dirSum{size: l.Size, files: l.Files, disk: l.Disk, cloud: l.Cloud, margin: l.Margin, special: l.Special}
+		if _, had := dirRecords.LoadOrStore(l.Path, &dirRecord{mtime: l.MTime, fp: l.FP, own: own, subdirs: l.Subdirs, links: l.Links}); !had {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type claimBeatMsg struct{}
+
+// claimBeatTick keeps the claim fresh for instances on other hosts.
+func (m *model) claimBeatTick() tea.Cmd {
+	if m.claim == nil {
+		return nil
+	}
+	return tea.Tick(claimBeat, func(time.Time) tea.Msg { return claimBeatMsg{} })
+}
+
+func (m *model) beatClaim() tea.Cmd {
+	now := time.Now()
+	_ = os.Chtimes(m.claim.file, now, now)
+	return m.claimBeatTick()
+}
+
+type recordsPublishedMsg struct {
+	path string
+	err  error
+}
+
+// publishScan snapshots the records of a finished scan of the root for
+// instances that attach to it. Once per session: later rescans of the
+// root only update them in memory.
+func (m *model) publishScan(n *Node) tea.Cmd {
+	c := m.claim
+	if c == nil || c.Records != "" || m.publishing || n == nil || n.Err != nil || !samePath(n.Path, c.Root) {
+		return nil
+	}
+	m.publishing = true
+	path := strings.TrimSuffix(c.file, ".json") + ".records.gz"
+	return func() tea.Msg {
+		_, err := writeRecords(path)
+		return recordsPublishedMsg{path: path, err: err}
+	}
+}
+
+func (m *model) applyPublished(msg recordsPublishedMsg) {
+	m.publishing = false
+	if msg.err != nil || m.claim == nil {
+		return // others scan for themselves
+	}
+	m.claim.Records = msg.path
+	if m.claim.save() != nil {
+		_ = os.Remove(msg.path)
+		m.claim.Records = ""
+	}
+}
+
+// startRootScan starts the first scan of the root, as Init does when no
+// other instance is scanning it.
+func (m *model) startRootScan() tea.Cmd {
+	cache.Delete(pathKey(m.rootPath))
+	m.setLoading(true)
+	if m.status == "" {
+		m.status = fmt.Sprintf("Scanning %s ...", m.rootPath)
+	}
+	return tea.Batch(m.spin.Tick, m.loadingTick(), m.startIncrementalScan(m.rootPath))
+}
+
+type attachPollMsg struct{}
+
+func attachPoll() tea.Cmd {
+	return tea.Tick(time.Second, func(time.Time) tea.Msg { return attachPollMsg{} })
+}
+
+// attachScan takes over the records of the other instance's scan and
+// scans from them, or waits for that scan to finish.
+func (m *model) attachScan(o *scanLockOverlay) tea.Cmd {
+	c, err := readClaim(o.claim.file)
+	switch {
+	case err != nil || !c.alive():
+		m.overlays.remove("scan-lock")
+		m.status = fmt.Sprintf("%s stopped before its scan finished; scanning %s ...", o.claim.who(), m.rootPath)
+		return m.startRootScan()
+	case c.Options != m.scanner.recordsKey():
+		m.overlays.remove("scan-lock")
+		m.status = fmt.Sprintf("%s scans with other options; scanning %s ...", c.who(), m.rootPath)
+		return m.startRootScan()
+	case c.Records == "":
+		o.claim, o.waiting = c, true
+		return attachPoll()
+	}
+	m.overlays.remove("scan-lock")
+	n, err := loadRecords(c.Records)
+	if err != nil && n == 0 {
+		m.status = fmt.Sprintf("⚠ could not read the results of %s (%v); scanning %s ...", c.who(), err, m.rootPath)
+		return m.startRootScan()
+	}
+	m.status = fmt.Sprintf("Attached to the scan of %s by %s: checking %d directories for changes ...", c.Root, c.who(), n)
+	return m.startRootScan()
+}
+
+// scanLockOverlay offers to attach to another instance's scan of the root
+// instead of walking it a second time, and waits for that scan.
+type scanLockOverlay struct {
+	claim   *scanClaim
+	focus   int // 0 = attach, 1 = scan anyway
+	waiting bool
+}
+
+func (o *scanLockOverlay) opts() overlayOpts {
+	return overlayOpts{id: "scan-lock", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *scanLockOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(m.popupWidth(70)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	c := o.claim
+	lines := []string{
+		fmt.Sprintf("%s is already scanning", c.who()),
+		warn.Render(c.Root),
+		fmt.Sprintf("since %s", c.Started.Local().Format(time.TimeOnly)),
+		"",
+	}
+	if o.waiting {
+		lines = append(lines, "Waiting for it to finish, then only changed directories are listed again ...")
+		return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", buttonRow(0, "Scan now instead")))
+	}
+	if c.Records != "" {
+		lines[0] = fmt.Sprintf("%s has scanned", c.who())
+		lines = append(lines, "Use its results? Only directories changed since are listed again")
+	} else {
+		lines = append(lines, "Wait for its results instead of walking the same tree twice?")
+	}
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", buttonRow(o.focus, "Attach", "Scan anyway")))
+}
+
+func (o *scanLockOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	if o.waiting {
+		switch msg.String() {
+		case "enter", "esc":
+			m.status = ""
+			return m.startRootScan(), true
+		case "ctrl+c", "q":
+			return m.quit(), true
+		}
+		return nil, false
+	}
+	switch msg.String() {
+	case "left", "h":
+		o.focus = 0
+	case "right", "l":
+		o.focus = 1
+	case "tab":
+		o.focus = (o.focus + 1) % 2
+	case "enter":
+		if o.focus == 0 {
+			return m.attachScan(o), false
+		}
+		m.status = ""
+		return m.startRootScan(), true
+	case "esc":
+		m.status = ""
+		return m.startRootScan(), true
+	case "ctrl+c", "q":
+		return m.quit(), true
+	}
+	return nil, false
+}
+
+// pollAttach checks on the scan being waited for.
+func (m *model) pollAttach() tea.Cmd {
+	o, ok := m.overlays.get("scan-lock").(*scanLockOverlay)
+	if !ok || !o.waiting {
+		return nil // scanning by ourselves after all
+	}
+	return m.attachScan(o)
+}
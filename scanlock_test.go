@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// fakeClaim registers a claim on root for another process scanning with
+// options opts.
+func fakeClaim(t *testing.T, pid int, root, opts string) *scanClaim {
+	t.Helper()
+	host, _ := os.Hostname()
+	c := &scanClaim{PID: pid, Host: host, User: "someone", Root: root, Started: time.Now(), Options: opts,
+		file: filepath.Join(scansDir(), fmt.Sprintf("%s-%d.json", host, pid))}
+	if err := os.MkdirAll(scansDir(), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.save(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestOtherClaimsFindsOverlappingLiveScans(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the claims use Unix paths")
+	}
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	own := claimScan("/srv/data", "")
+	if own == nil {
+		t.Fatal("no claim written")
+	}
+	parent := fakeClaim(t, os.Getppid(), "/srv/data", "")
+	gone := fakeClaim(t, 99999999, "/srv", "")
+	fakeClaim(t, 1, "/home", "") // alive, but elsewhere
+
+	claims := otherClaims("/srv/data/projects")
+	if len(claims) != 1 || claims[0].PID != parent.PID {
+		t.Fatalf("got %+v, want only the live claim on /srv/data", claims)
+	}
+	if c := coveringClaim("/srv/data/projects", "", claims); c == nil || c.PID != parent.PID {
+		t.Fatalf("the claim on /srv/data covers a scan below it, got %+v", c)
+	}
+	if c := coveringClaim("/srv/data/projects", "hidden=true", claims); c != nil {
+		t.Fatalf("a scan with other options can't stand in, got %+v", c)
+	}
+	if _, err := os.Stat(gone.file); !os.IsNotExist(err) {
+		t.Error("the claim of a process that is gone should be removed")
+	}
+	// a root above the running scan overlaps it but can't be served by it
+	if claims := otherClaims("/srv"); len(claims) != 1 || coveringClaim("/srv", "", claims) != nil {
+		t.Fatalf("/srv: got %+v, want the claim on /srv/data and nothing covering", claims)
+	}
+	own.remove()
+	if _, err := os.Stat(own.file); !os.IsNotExist(err) {
+		t.Error("remove left the claim behind")
+	}
+}
+
+func TestAttachWaitsForOtherScanThenReusesItsRecords(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	h.m.scanner.trustMtime = true
+	root := h.m.rootPath
+
+	// the finished scan is published for others to attach to
+	h.m.claim = claimScan(root, h.m.scanner.recordsKey())
+	cmd := h.m.publishScan(h.m.current)
+	if cmd == nil {
+		t.Fatal("a finished scan of the root should be published")
+	}
+	h.send(cmd())
+	published, err := readClaim(h.m.claim.file)
+	if err != nil || published.Records == "" {
+		t.Fatalf("claim not updated with its records: %+v, %v", published, err)
+	}
+
+	// a second instance starts on the same root while the first still runs
+	dirRecords = sync.Map{}
+	other := fakeClaim(t, os.Getppid(), root, h.m.scanner.recordsKey())
+	h.m.claim, h.m.otherScans = nil, otherClaims(root)
+	scanCh := h.m.scanCh
+	h.m.Init()
+	o, ok := h.m.overlays.focused().(*scanLockOverlay)
+	if !ok || h.m.scanCh != scanCh {
+		t.Fatalf("expected the attach dialog and no scan, got %T", h.m.overlays.focused())
+	}
+	h.keys("enter")
+	if !o.waiting {
+		t.Fatal("attaching to an unfinished scan should wait for it")
+	}
+	h.send(attachPollMsg{})
+	if !o.waiting || h.m.scanCh != scanCh {
+		t.Fatal("nothing published yet: it should keep waiting")
+	}
+
+	other.Records = published.Records
+	if err := other.save(); err != nil {
+		t.Fatal(err)
+	}
+	h.send(attachPollMsg{})
+	if h.m.overlays.get("scan-lock") != nil {
+		t.Fatal("the dialog should close once the results are in")
+	}
+	if !strings.Contains(h.m.status, "Attached") {
+		t.Fatalf("status %q", h.m.status)
+	}
+	rec, ok := dirRecords.Load(pathKey(filepath.Join(root, "alpha")))
+	if !ok {
+		t.Fatal("records not taken over")
+	}
+	h.settle()
+	if after, _ := dirRecords.Load(pathKey(filepath.Join(root, "alpha"))); after != rec {
+		t.Error("alpha was listed again although it hadn't changed")
+	}
+	if h.m.current == nil || h.m.current.Size != 4096+1024+100+2048+10 {
+		t.Fatalf("wrong totals after attaching: %+v", h.m.current)
+	}
+}
+
+func TestScanAnywayIgnoresTheClaim(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	fakeClaim(t, os.Getppid(), h.m.rootPath, h.m.scanner.recordsKey())
+	h.m.otherScans = otherClaims(h.m.rootPath)
+	scanCh := h.m.scanCh
+	h.m.Init()
+	h.keys("tab", "enter")
+	if h.m.overlays.get("scan-lock") != nil || h.m.scanCh == scanCh {
+		t.Fatal("Scan anyway should close the dialog and scan")
+	}
+}
+
+func TestRecordsKeyCoversDepthAndBudget(t *testing.T) {
+	t.Cleanup(func() { maxTreeDepth = scanner.DefaultMaxDepth })
+	s := &Scanner{}
+	base := s.recordsKey()
+	if err := setMaxDepth(8); err != nil {
+		t.Fatal(err)
+	}
+	shallow := s.recordsKey()
+	if shallow == base {
+		t.Fatalf("-max-depth 8 truncates other directories, but the key stays %q", base)
+	}
+	b, err := parseBudget("2M files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.budget = b
+	if s.recordsKey() == shallow {
+		t.Fatalf("a budget leaves estimates, but the key stays %q", shallow)
+	}
+}
@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// wideTree builds dirs subdirectories of files files each.
+func wideTree(b *testing.B, dirs, files int) string {
+	b.Helper()
+	root := b.TempDir()
+	for d := 0; d < dirs; d++ {
+		sub := filepath.Join(root, fmt.Sprintf("d%03d", d))
+		if err := os.Mkdir(sub, 0o755); err != nil {
+			b.Fatal(err)
+		}
+		for f := 0; f < files; f++ {
+			if err := os.WriteFile(filepath.Join(sub, fmt.Sprintf("f%03d", f)), []byte("x"), 0o644); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func BenchmarkWalk(b *testing.B) {
+	root := wideTree(b, 100, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if t := Walk(context.Background(), root, Options{Threads: 16}); t.Files != 5000 {
+			b.Fatalf("walked %d files", t.Files)
+		}
+	}
+}
+
+func BenchmarkScanEvents(b *testing.B) {
+	root := wideTree(b, 100, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		events, err := Scan(context.Background(), root, Options{Threads: 16})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for range events {
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package scanner
+
+import "io/fs"
+
+// DiskSize is the space the file fi at path takes on disk once the
+// filesystem has compressed it: st_blocks on Unix, which ZFS, btrfs and
+// APFS count after compression; the length where there are no block
+// counts.
+func DiskSize(path string, fi fs.FileInfo) int64 {
+	return allocatedSize(fi)
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package scanner
+
+import (
+	"io/fs"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procGetCompressedFileSize = windows.NewLazySystemDLL("kernel32.dll").NewProc("GetCompressedFileSizeW")
+
+// invalidFileSize is the low word GetCompressedFileSize fails with.
+const invalidFileSize = 0xFFFFFFFF
+
+// DiskSize is the space the file fi at path takes on disk once NTFS has
+// compressed it (GetCompressedFileSize, which also accounts for sparse
+// files); its length when that can't be asked.
+func DiskSize(path string, fi fs.FileInfo) int64 {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil || procGetCompressedFileSize.Find() != nil {
+		return fi.Size()
+	}
+	var high uint32
+	low, _, err := procGetCompressedFileSize.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&high)))
+	if uint32(low) == invalidFileSize && err != windows.ERROR_SUCCESS {
+		return fi.Size()
+	}
+	return int64(high)<<32 | int64(uint32(low))
+}
@@ -0,0 +1,20 @@
+package scanner
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// IsHidden reports whether a directory entry is hidden: a dotfile on every
+// platform, or an entry carrying the platform's hidden flag
+// (FILE_ATTRIBUTE_HIDDEN on Windows, chflags hidden on macOS and FreeBSD).
+func IsHidden(e fs.DirEntry) bool {
+	if strings.HasPrefix(e.Name(), ".") {
+		return true
+	}
+	if !hasHiddenAttr {
+		return false
+	}
+	fi, err := e.Info()
+	return err == nil && hiddenAttr(fi)
+}
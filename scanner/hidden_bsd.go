@@ -0,0 +1,19 @@
+//go:build darwin || freebsd
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+const hasHiddenAttr = true
+
+// ufHidden is UF_HIDDEN from <sys/stat.h>, set by `chflags hidden` (macOS,
+// FreeBSD).
+const ufHidden = 0x8000
+
+func hiddenAttr(fi fs.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && st.Flags&ufHidden != 0
+}
@@ -0,0 +1,10 @@
+//go:build !windows && !darwin && !freebsd
+
+package scanner
+
+import "io/fs"
+
+// Elsewhere only the dotfile convention applies.
+const hasHiddenAttr = false
+
+func hiddenAttr(fs.FileInfo) bool { return false }
@@ -0,0 +1,15 @@
+//go:build windows
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+const hasHiddenAttr = true
+
+func hiddenAttr(fi fs.FileInfo) bool {
+	d, ok := fi.Sys().(*syscall.Win32FileAttributeData)
+	return ok && d.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
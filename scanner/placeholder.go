@@ -0,0 +1,5 @@
+package scanner
+
+// isPlaceholder is Placeholder, replaced by tests on systems without
+// placeholders.
+var isPlaceholder = Placeholder
@@ -0,0 +1,20 @@
+//go:build darwin
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Placeholder reports whether fi is a cloud-sync placeholder: a dataless
+// file of a File Provider (iCloud Drive, OneDrive, Dropbox) that reports
+// its full length but keeps nothing on the local disk until opened.
+func Placeholder(fi fs.FileInfo) bool {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Flags&unix.SF_DATALESS != 0
+	}
+	return false
+}
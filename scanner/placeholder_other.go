@@ -0,0 +1,8 @@
+//go:build !(windows || darwin)
+
+package scanner
+
+import "io/fs"
+
+// Only Windows and macOS mark cloud-sync placeholders.
+func Placeholder(fs.FileInfo) bool { return false }
@@ -0,0 +1,23 @@
+//go:build windows
+
+package scanner
+
+import (
+	"io/fs"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// placeholderAttrs mark files whose data lives with a cloud provider
+// (OneDrive, Dropbox, iCloud for Windows) and is fetched when opened.
+const placeholderAttrs = windows.FILE_ATTRIBUTE_RECALL_ON_DATA_ACCESS | windows.FILE_ATTRIBUTE_RECALL_ON_OPEN | windows.FILE_ATTRIBUTE_OFFLINE
+
+// Placeholder reports whether fi is a cloud-sync placeholder: a file that
+// reports its full length but keeps (almost) nothing on the local disk.
+func Placeholder(fi fs.FileInfo) bool {
+	if d, ok := fi.Sys().(*syscall.Win32FileAttributeData); ok {
+		return d.FileAttributes&placeholderAttrs != 0
+	}
+	return false
+}
@@ -0,0 +1,580 @@
+// Package scanner lists a directory and sizes its immediate children
+// concurrently, reporting results as a stream of typed events. It is the
+// engine behind the disktree TUI and can be used by other Go programs.
+//
+//	events, err := scanner.Scan(ctx, "/var", scanner.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	for ev := range events {
+//		switch ev := ev.(type) {
+//		case scanner.ChildEvent:
+//			fmt.Println(ev.Path, ev.Size, ev.Pending)
+//		case scanner.DoneEvent:
+//			fmt.Println("total", ev.Root.Size)
+//		}
+//	}
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Options configure a scan. The zero value is usable.
+type Options struct {
+	// Threads bounds how many child directories are sized at once, and the
+	// workers of the built-in walker (default: GOMAXPROCS*4).
+	Threads int
+	// FollowSymlinks includes symbolic links; they are skipped by default.
+	FollowSymlinks bool
+	// FollowLink decides, when FollowSymlinks is set, whether a link is
+	// sized as its target (true) or counted as the link itself (false). Nil
+	// sizes every link as its target. Links to directories are walked at
+	// most once per walk, and never when they point back at an ancestor.
+	FollowLink func(link, target string) bool
+	// ExcludeHidden leaves hidden entries (see IsHidden) out of the scan and
+	// out of every total. By default they are included and flagged.
+	ExcludeHidden bool
+	// TryUnreadable sizes child directories even when they can't be listed
+	// (other users' homes, for example). By default such directories are
+	// reported as NoAccess with an unknown size instead of a misleading 0.
+	TryUnreadable bool
+	// Allocated sizes files by the disk space allocated to them (st_blocks)
+	// instead of their length, as du does without --apparent-size. Sparse
+	// and compressed files come out smaller, small files round up to a
+	// block. Where the platform has no block counts it makes no difference.
+	Allocated bool
+	// Xattrs adds the size of each file's extended attributes, resource
+	// forks included, to its size: sidecar metadata can add up on volumes
+	// of design assets. It costs a system call or more per file and is
+	// supported on macOS and Linux.
+	Xattrs bool
+	// DiskSizes also counts the space files take on disk after transparent
+	// compression (see DiskSize) in Totals.Disk, next to their length.
+	DiskSizes bool
+	// MaxDepth bounds how many levels below a sized directory Walk
+	// descends (default DefaultMaxDepth). Deeper directories, such as those
+	// under a recursive bind mount, are left out and flag Totals.Truncated.
+	MaxDepth int
+	// ExcludeFile, when set, leaves out the files it reports true for, e.g.
+	// those older or smaller than a limit: they are not entries and count
+	// towards no total. Directories are always walked.
+	ExcludeFile func(fi fs.FileInfo) bool
+	// Skip, when set, leaves out the entries whose path it reports true
+	// for, with everything below them, e.g. directories the user chose to
+	// ignore.
+	Skip func(path string) bool
+	// SizeDir computes the totals of a child directory. Nil uses Walk.
+	SizeDir func(ctx context.Context, path string) Totals
+}
+
+// DefaultMaxDepth is the depth limit of a walk when Options.MaxDepth is 0;
+// real trees are far shallower, so reaching it means a loop.
+const DefaultMaxDepth = 4096
+
+// FileSize is the size of the file fi as counted by a scan: its length, or
+// with allocated set the disk space it takes (see Options.Allocated).
+func FileSize(fi fs.FileInfo, allocated bool) int64 {
+	if allocated {
+		return allocatedSize(fi)
+	}
+	return fi.Size()
+}
+
+func (o Options) threads() int {
+	if o.Threads > 0 {
+		return o.Threads
+	}
+	return runtime.GOMAXPROCS(0) * 4
+}
+
+// excludes reports whether ExcludeFile leaves fi out.
+func (o Options) excludes(fi fs.FileInfo) bool {
+	return o.ExcludeFile != nil && o.ExcludeFile(fi)
+}
+
+// skips reports whether Skip leaves path out.
+func (o Options) skips(path string) bool {
+	return o.Skip != nil && o.Skip(path)
+}
+
+// DepthLimit is MaxDepth, or DefaultMaxDepth when it is unset.
+func (o Options) DepthLimit() int {
+	if o.MaxDepth > 0 {
+		return o.MaxDepth
+	}
+	return DefaultMaxDepth
+}
+
+// Totals are the cumulative size and counts of a subtree.
+type Totals struct {
+	Size  int64
+	Files int64
+	Dirs  int64
+	// Exclusive is the size of the files directly inside the subtree's root
+	// directory, not counting subdirectories. For a file it equals Size.
+	Exclusive int64
+	Err       error // last error met below the subtree, if any
+	// Changed is set when entries vanished while the subtree was walked
+	// (deleted or renamed during the scan). They are left out of the
+	// totals rather than reported as errors.
+	Changed bool
+	// Truncated is set when directories below the depth limit (see
+	// Options.MaxDepth) were left out of the totals.
+	Truncated bool
+	// Estimated is set when part of the totals were extrapolated instead
+	// of walked; SizeDir hooks that stop early set it.
+	Estimated bool
+	// Margin is the half-width of a 95% confidence interval around Size
+	// when part of it was sampled rather than counted; 0 when exact.
+	Margin int64
+	// Special counts the FIFOs, sockets and device files met in the
+	// subtree. They are skipped, not counted in Size or Files.
+	Special SpecialCounts
+	// Disk is the space the files take on disk after compression, counted
+	// only with Options.DiskSizes.
+	Disk int64
+	// Cloud is the part of Size in cloud-sync placeholders (see
+	// Placeholder): counted at its full length, but not stored locally.
+	Cloud int64
+}
+
+// Entry is an immediate child of the scanned directory.
+type Entry struct {
+	Name  string
+	Path  string
+	IsDir bool
+	// Hidden is set on dotfiles and entries with the platform hidden flag.
+	Hidden bool
+	Totals
+	// Pending is set on directories that are listed but not sized yet;
+	// their Size is -1.
+	Pending bool
+	// ListedFiles and ListedDirs count the entries directly inside a
+	// Pending directory once it has been read, ahead of its totals.
+	ListedFiles, ListedDirs int64
+	// NoAccess is set on directories that could not be listed; their Size
+	// is -1 and Err holds the permission error.
+	NoAccess bool
+	// LinkTarget is the resolved target of a symbolic link. IsDir and the
+	// totals describe the target when the link was followed.
+	LinkTarget string
+	// Kind is set on special files; they are reported with no size and
+	// counted in Special.
+	Kind SpecialKind
+}
+
+// Event is one of ChildEvent, ProgressEvent or DoneEvent.
+type Event interface{ event() }
+
+// ChildEvent reports a child of the scanned directory. Files are reported
+// once with their size. Directories are reported first as Pending when
+// listed, again as Pending with their entry counts once those are read (if
+// they have any entries), then with their totals.
+type ChildEvent struct{ Entry }
+
+// ProgressEvent is sent after each child directory has been sized.
+type ProgressEvent struct {
+	Listed int   // children listed
+	Sized  int   // child directories sized so far
+	Dirs   int   // child directories in total
+	Bytes  int64 // bytes accounted for so far
+}
+
+// DoneEvent is the last event of a scan. Root's totals aggregate Children.
+// A canceled scan ends without a DoneEvent.
+type DoneEvent struct {
+	Root     Entry
+	Children []Entry
+}
+
+func (ChildEvent) event()    {}
+func (ProgressEvent) event() {}
+func (DoneEvent) event()     {}
+
+// Scan lists root and sizes its children in the background. An error is
+// returned only when root itself cannot be listed. The channel is closed
+// after the DoneEvent, or early when ctx is canceled; callers must drain it.
+func Scan(ctx context.Context, root string, opts Options) (<-chan Event, error) {
+	ents, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	size := opts.SizeDir
+	if size == nil {
+		size = func(ctx context.Context, p string) Totals { return Walk(ctx, p, opts) }
+	}
+	ch := make(chan Event, 64)
+	go func() {
+		defer close(ch)
+		send := func(ev Event) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		sem := make(chan struct{}, opts.threads())
+		// counting has its own workers, so every row gets its count while
+		// the sizing of most still waits its turn
+		countSem := make(chan struct{}, opts.threads())
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		children := make([]Entry, 0, len(ents))
+		var progress ProgressEvent
+		var guard LinkGuard
+		var vanished bool // a child disappeared between listing and stat
+
+		for _, e := range ents {
+			isLink := e.Type()&fs.ModeSymlink != 0
+			if isLink && !opts.FollowSymlinks {
+				continue
+			}
+			c := Entry{Name: e.Name(), Path: filepath.Join(root, e.Name()), IsDir: e.IsDir(), Hidden: IsHidden(e)}
+			if c.Hidden && opts.ExcludeHidden || opts.skips(c.Path) {
+				continue
+			}
+			info, kind := e.Info, Special(e.Type())
+			if isLink {
+				target, fi, follow := opts.ResolveLink(c.Path)
+				c.LinkTarget = target
+				if follow && fi.IsDir() && !guard.Enter(c.Path, target) {
+					follow = false // a loop, or a directory another link already covers
+				}
+				if follow {
+					c.IsDir = fi.IsDir()
+					info, kind = func() (fs.FileInfo, error) { return fi, nil }, Special(fi.Mode())
+				}
+			}
+			mu.Lock()
+			progress.Listed++
+			mu.Unlock()
+			if kind != NotSpecial {
+				c.Kind = kind
+				c.Special.Add(kind)
+				mu.Lock()
+				children = append(children, c)
+				mu.Unlock()
+				if !send(ChildEvent{c}) {
+					return
+				}
+				continue
+			}
+			if !c.IsDir {
+				fi, err := info()
+				if errors.Is(err, fs.ErrNotExist) {
+					vanished = true
+					continue
+				}
+				if err == nil && opts.excludes(fi) {
+					continue
+				}
+				if err == nil {
+					size := opts.fileSize(c.Path, fi)
+					c.Size, c.Files, c.Exclusive = size, 1, size
+					if isPlaceholder(fi) {
+						c.Cloud = size
+					}
+					if opts.DiskSizes {
+						c.Disk = DiskSize(c.Path, fi)
+					}
+				}
+				mu.Lock()
+				children = append(children, c)
+				progress.Bytes += c.Size
+				mu.Unlock()
+				if !send(ChildEvent{c}) {
+					return
+				}
+				continue
+			}
+			mu.Lock()
+			progress.Dirs++
+			mu.Unlock()
+			pending := c
+			pending.Size, pending.Pending = -1, true
+			if !send(ChildEvent{pending}) {
+				return
+			}
+			wg.Add(1)
+			go func(c Entry) {
+				defer wg.Done()
+				select {
+				case countSem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				files, dirs, err := countEntries(c.Path, opts.ExcludeHidden)
+				<-countSem
+				if err == nil && files+dirs > 0 {
+					counted := c
+					counted.Size, counted.Pending = -1, true
+					counted.ListedFiles, counted.ListedDirs = files, dirs
+					if !send(ChildEvent{counted}) {
+						return
+					}
+				}
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				if err := listable(c.Path); err != nil && !opts.TryUnreadable {
+					c.Size, c.Err, c.NoAccess = -1, err, true
+				} else {
+					c.Totals = size(ctx, c.Path)
+				}
+				<-sem
+				mu.Lock()
+				children = append(children, c)
+				progress.Sized++
+				progress.Bytes += max(c.Size, 0)
+				p := progress
+				mu.Unlock()
+				if send(ChildEvent{c}) {
+					send(p)
+				}
+			}(c)
+		}
+		wg.Wait()
+		if ctx.Err() != nil {
+			return
+		}
+
+		done := DoneEvent{Root: Entry{Name: filepath.Base(root), Path: root, IsDir: true}, Children: children}
+		done.Root.Changed = vanished
+		for _, c := range children {
+			done.Root.Size += max(c.Size, 0)
+			done.Root.Disk += c.Disk
+			done.Root.Cloud += c.Cloud
+			done.Root.Files += c.Files
+			done.Root.Dirs += c.Dirs
+			if !c.IsDir {
+				done.Root.Exclusive += c.Size
+			}
+			if c.Err != nil {
+				done.Root.Err = c.Err
+			}
+			done.Root.Changed = done.Root.Changed || c.Changed
+			done.Root.Truncated = done.Root.Truncated || c.Truncated
+			done.Root.Estimated = done.Root.Estimated || c.Estimated
+			done.Root.Special.Merge(c.Special)
+			if c.Margin > 0 {
+				// independent errors: the squares add up
+				done.Root.Margin = int64(math.Round(math.Hypot(float64(done.Root.Margin), float64(c.Margin))))
+			}
+		}
+		send(done)
+	}()
+	return ch, nil
+}
+
+// listable reports a permission error if dir can't be listed. Other errors
+// are left for the walker to report.
+func listable(dir string) error {
+	f, err := os.Open(dir)
+	if err == nil {
+		_, err = f.Readdirnames(1)
+		_ = f.Close()
+	}
+	if errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	return nil
+}
+
+// ResolveLink resolves the symbolic link at link. follow reports whether
+// the link should be sized as its target, whose info is then returned;
+// dangling links and links FollowLink rejects count as the link itself.
+func (o Options) ResolveLink(link string) (target string, fi fs.FileInfo, follow bool) {
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		// dangling or looping; still say where it points
+		target, _ = os.Readlink(link)
+		return target, nil, false
+	}
+	if o.FollowLink != nil && !o.FollowLink(link, target) {
+		return target, nil, false
+	}
+	if fi, err = os.Stat(target); err != nil {
+		return target, nil, false
+	}
+	return target, fi, true
+}
+
+// LinkGuard stops a walk that follows symbolic links from looping: each
+// directory target is entered once, and links back to an ancestor of
+// themselves never. The zero value is ready to use.
+type LinkGuard struct{ seen sync.Map }
+
+// Enter reports whether the walk should descend into the directory link
+// pointing at target.
+func (g *LinkGuard) Enter(link, target string) bool {
+	if link == target || strings.HasPrefix(link, target+string(os.PathSeparator)) {
+		return false
+	}
+	_, seen := g.seen.LoadOrStore(target, true)
+	return !seen
+}
+
+// Walk sums the subtree at path with up to opts.Threads concurrent
+// listings. The directory itself is not counted in Dirs.
+func Walk(ctx context.Context, path string, opts Options) Totals {
+	sem := make(chan struct{}, opts.threads())
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var t Totals
+	var guard LinkGuard
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		guard.seen.Store(real, true)
+	}
+
+	limit := opts.DepthLimit()
+
+	var walk func(p string, depth int)
+	walk = func(p string, depth int) {
+		defer wg.Done()
+		if depth > limit {
+			mu.Lock()
+			t.Truncated = true
+			mu.Unlock()
+			return
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		ents, err := readDir(p)
+		<-sem
+		if errors.Is(err, fs.ErrNotExist) {
+			mu.Lock()
+			t.Changed = true
+			mu.Unlock()
+			return
+		}
+		if err != nil {
+			mu.Lock()
+			t.Err = err
+			mu.Unlock()
+			return
+		}
+		var size, files, dirs, disk, cloud int64
+		var changed bool
+		var special SpecialCounts
+		for _, e := range ents {
+			isLink := e.Type()&fs.ModeSymlink != 0
+			if isLink && !opts.FollowSymlinks {
+				continue
+			}
+			if opts.ExcludeHidden && IsHidden(e) {
+				continue
+			}
+			child := filepath.Join(p, e.Name())
+			if opts.skips(child) {
+				continue
+			}
+			isDir, info, kind := e.IsDir(), e.Info, Special(e.Type())
+			if isLink {
+				if target, fi, follow := opts.ResolveLink(child); follow {
+					if fi.IsDir() && !guard.Enter(child, target) {
+						continue
+					}
+					isDir, info, kind = fi.IsDir(), func() (fs.FileInfo, error) { return fi, nil }, Special(fi.Mode())
+				}
+			}
+			if kind != NotSpecial {
+				special.Add(kind)
+				continue
+			}
+			if isDir {
+				dirs++
+				wg.Add(1)
+				go walk(child, depth+1)
+				continue
+			}
+			fi, err := info()
+			if errors.Is(err, fs.ErrNotExist) {
+				changed = true
+				continue
+			}
+			if err == nil && !opts.excludes(fi) {
+				fsize := opts.fileSize(child, fi)
+				size += fsize
+				files++
+				if isPlaceholder(fi) {
+					cloud += fsize
+				}
+				if opts.DiskSizes {
+					disk += DiskSize(child, fi)
+				}
+			}
+		}
+		mu.Lock()
+		t.Changed = t.Changed || changed
+		t.Special.Merge(special)
+		t.Size += size
+		t.Disk += disk
+		t.Cloud += cloud
+		t.Files += files
+		t.Dirs += dirs
+		if p == path {
+			t.Exclusive = size
+		}
+		mu.Unlock()
+	}
+	wg.Add(1)
+	walk(path, 0)
+	wg.Wait()
+	return t
+}
+
+// countEntries counts the files and directories directly inside dir,
+// without looking at any of them.
+func countEntries(dir string, excludeHidden bool) (files, dirs int64, err error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	for {
+		ents, err := f.ReadDir(1024)
+		for _, e := range ents {
+			switch {
+			case excludeHidden && IsHidden(e):
+			case e.IsDir():
+				dirs++
+			default:
+				files++
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return files, dirs, err
+		}
+	}
+}
+
+// readDir lists dir like os.ReadDir, trying once more when dir is missing:
+// a directory that is being replaced (renamed over) can vanish briefly. A
+// remaining fs.ErrNotExist means dir was removed during the walk.
+func readDir(dir string) ([]fs.DirEntry, error) {
+	ents, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		ents, err = os.ReadDir(dir)
+	}
+	return ents, err
+}
@@ -0,0 +1,435 @@
+package scanner
+
+import (
+	"context"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestScanEmitsChildrenProgressAndDone(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", "e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"f": 5, "d/g": 10, "d/e/h": 20} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err := Scan(context.Background(), root, Options{Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending, counted, sized, progress int
+	var done *DoneEvent
+	for ev := range events {
+		switch ev := ev.(type) {
+		case ChildEvent:
+			if ev.Pending {
+				if ev.Size != -1 || !ev.IsDir {
+					t.Fatalf("pending child should be a directory with size -1: %+v", ev.Entry)
+				}
+				if ev.ListedFiles == 0 && ev.ListedDirs == 0 {
+					pending++
+					continue
+				}
+				// d holds g and e
+				counted++
+				if ev.ListedFiles != 1 || ev.ListedDirs != 1 || ev.Files != 0 {
+					t.Fatalf("unexpected entry counts for d: %+v", ev.Entry)
+				}
+			} else if ev.Name == "d" {
+				sized++
+				if ev.Size != 30 || ev.Files != 2 || ev.Dirs != 1 || ev.Exclusive != 10 {
+					t.Fatalf("unexpected totals for d: %+v", ev.Totals)
+				}
+			}
+		case ProgressEvent:
+			progress++
+			if ev.Sized != 1 || ev.Dirs != 1 {
+				t.Fatalf("unexpected progress: %+v", ev)
+			}
+		case DoneEvent:
+			done = &ev
+		}
+	}
+	if pending != 1 || counted != 1 || sized != 1 || progress != 1 {
+		t.Fatalf("pending=%d counted=%d sized=%d progress=%d", pending, counted, sized, progress)
+	}
+	if done == nil || done.Root.Size != 35 || done.Root.Files != 3 || done.Root.Exclusive != 5 || len(done.Children) != 2 {
+		t.Fatalf("unexpected done event: %+v", done)
+	}
+}
+
+func TestScanUsesSizeDirHook(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var called string
+	events, err := Scan(context.Background(), root, Options{SizeDir: func(_ context.Context, p string) Totals {
+		called = p
+		return Totals{Size: 42}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var total int64
+	for ev := range events {
+		if d, ok := ev.(DoneEvent); ok {
+			total = d.Root.Size
+		}
+	}
+	if called != filepath.Join(root, "d") || total != 42 {
+		t.Fatalf("SizeDir called for %q, total %d", called, total)
+	}
+}
+
+func TestAllocatedSizes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no block counts")
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// a sparse file: 8 MiB long, hardly anything allocated
+	f, err := os.Create(filepath.Join(root, "d", "sparse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(8 << 20); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	if got := Walk(context.Background(), root, Options{}); got.Size != 8<<20 {
+		t.Fatalf("apparent size %d, want %d", got.Size, 8<<20)
+	}
+	if got := Walk(context.Background(), root, Options{Allocated: true}); got.Size >= 8<<20 {
+		t.Fatalf("allocated size %d should be below the length of a sparse file", got.Size)
+	}
+}
+
+func TestDirsRemovedDuringScanAreChangedNotErrors(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"gone/sub", "kept"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "kept", "f"), make([]byte, 5), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// "gone" is deleted after the root was listed but before it is sized
+	events, err := Scan(context.Background(), root, Options{SizeDir: func(ctx context.Context, p string) Totals {
+		if filepath.Base(p) == "gone" {
+			if err := os.RemoveAll(p); err != nil {
+				t.Error(err)
+			}
+		}
+		return Walk(ctx, p, Options{})
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done DoneEvent
+	for ev := range events {
+		if d, ok := ev.(DoneEvent); ok {
+			done = d
+		}
+	}
+	if done.Root.Err != nil || !done.Root.Changed || done.Root.Size != 5 {
+		t.Fatalf("root = %+v; want size 5, changed, no error", done.Root.Totals)
+	}
+	for _, c := range done.Children {
+		if c.Changed != (c.Name == "gone") || c.Err != nil {
+			t.Fatalf("child %s: changed=%v err=%v", c.Name, c.Changed, c.Err)
+		}
+	}
+}
+
+func TestScanMissingRoot(t *testing.T) {
+	if _, err := Scan(context.Background(), filepath.Join(t.TempDir(), "missing"), Options{}); err == nil {
+		t.Fatal("expected an error for a missing root")
+	}
+}
+
+func TestScanFlagsOrExcludesHidden(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", ".cache"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"f": 5, ".env": 7, "d/g": 10, "d/.cache/h": 20} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := func(opts Options) DoneEvent {
+		events, err := Scan(context.Background(), root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var done DoneEvent
+		for ev := range events {
+			if d, ok := ev.(DoneEvent); ok {
+				done = d
+			}
+		}
+		return done
+	}
+
+	all := run(Options{})
+	if all.Root.Size != 42 || len(all.Children) != 3 {
+		t.Fatalf("hidden entries should count by default: %+v", all.Root)
+	}
+	for _, c := range all.Children {
+		if c.Hidden != (c.Name == ".env") {
+			t.Fatalf("Hidden = %v for %s", c.Hidden, c.Name)
+		}
+	}
+
+	visible := run(Options{ExcludeHidden: true})
+	if visible.Root.Size != 15 || visible.Root.Dirs != 0 || len(visible.Children) != 2 {
+		t.Fatalf("hidden entries should be excluded everywhere: %+v", visible.Root)
+	}
+}
+
+func TestScanReportsUnreadableDirsAsNoAccess(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs POSIX permissions and a non-root user")
+	}
+	root := t.TempDir()
+	locked := filepath.Join(root, "other-user")
+	if err := os.Mkdir(locked, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "f"), make([]byte, 5), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(locked, 0o755) })
+
+	for _, try := range []bool{false, true} {
+		events, err := Scan(context.Background(), root, Options{TryUnreadable: try})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var done DoneEvent
+		for ev := range events {
+			if d, ok := ev.(DoneEvent); ok {
+				done = d
+			}
+		}
+		if done.Root.Size != 5 {
+			t.Fatalf("TryUnreadable=%v: root size %d; want 5", try, done.Root.Size)
+		}
+		for _, c := range done.Children {
+			if c.Name != "other-user" {
+				continue
+			}
+			if c.NoAccess == try || c.Err == nil {
+				t.Fatalf("TryUnreadable=%v: unexpected entry %+v", try, c)
+			}
+			if !try && c.Size != -1 {
+				t.Fatalf("no-access size should be unknown, got %d", c.Size)
+			}
+		}
+	}
+}
+
+func TestWalkFollowsLinksOnceAndSkipsCycles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	root, outside := t.TempDir(), t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for p, size := range map[string]int{filepath.Join(root, "data", "f"): 100, filepath.Join(outside, "g"): 1000} {
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"out":       outside,                          // counted through the link
+		"data/loop": root,                             // a cycle back to the root
+		"again":     outside,                          // already walked through out
+		"file":      filepath.Join(root, "data", "f"), // a file link, sized as its target
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := Walk(context.Background(), root, Options{FollowSymlinks: true, Threads: 2})
+	if got.Size != 1200 || got.Files != 3 {
+		t.Fatalf("expected data, out and file counted once: %+v", got)
+	}
+
+	inside := func(_, target string) bool { return !strings.HasPrefix(target, outside) }
+	got = Walk(context.Background(), root, Options{FollowSymlinks: true, FollowLink: inside})
+	if got.Size < 200 || got.Size >= 1200 {
+		t.Fatalf("a vetoed link should count as itself: %+v", got)
+	}
+}
+
+func TestWalkStopsAtMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "a", "b", "c")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"f": 1, "a/f": 10, "a/b/f": 100, "a/b/c/f": 1000} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if tot := Walk(context.Background(), root, Options{}); tot.Size != 1111 || tot.Truncated {
+		t.Fatalf("default limit: %+v", tot)
+	}
+	tot := Walk(context.Background(), root, Options{MaxDepth: 2})
+	if tot.Size != 111 || !tot.Truncated {
+		t.Errorf("MaxDepth 2 should leave c out and flag it: %+v", tot)
+	}
+}
+
+func TestExcludeFileLeavesFilesOutOfTotals(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"big": 2000, "tiny": 3, "d/big": 5000, "d/tiny": 4} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{ExcludeFile: func(fi fs.FileInfo) bool { return fi.Size() < 1024 }}
+	events, err := Scan(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done DoneEvent
+	for ev := range events {
+		if d, ok := ev.(DoneEvent); ok {
+			done = d
+		}
+	}
+	if done.Root.Size != 7000 || done.Root.Files != 2 || len(done.Children) != 2 {
+		t.Fatalf("small files should be left out: %+v, %d children", done.Root.Totals, len(done.Children))
+	}
+	if tot := Walk(context.Background(), filepath.Join(root, "d"), opts); tot.Size != 5000 || tot.Files != 1 {
+		t.Errorf("Walk: %+v", tot)
+	}
+}
+
+func TestSkipLeavesSubtreesOut(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"photos/2024", "docs"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, size := range map[string]int{"photos/2024/a.jpg": 9000, "docs/b.txt": 100, "c.txt": 10} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{Skip: func(p string) bool { return p == filepath.Join(root, "photos") }}
+	events, err := Scan(context.Background(), root, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done DoneEvent
+	for ev := range events {
+		if d, ok := ev.(DoneEvent); ok {
+			done = d
+		}
+	}
+	if done.Root.Size != 110 || len(done.Children) != 2 {
+		t.Fatalf("photos should be left out: %+v, %d children", done.Root.Totals, len(done.Children))
+	}
+	opts.Skip = func(p string) bool { return p == filepath.Join(root, "photos", "2024") }
+	if tot := Walk(context.Background(), root, opts); tot.Size != 110 || tot.Dirs != 2 {
+		t.Errorf("Walk: %+v", tot)
+	}
+}
+
+func TestSpecialFilesAreCountedNotSized(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets in the filesystem")
+	}
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "d", "f"), make([]byte, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Join(root, "s"), filepath.Join(root, "d", "s")} {
+		ln, err := net.Listen("unix", p)
+		if err != nil {
+			t.Skip("unix sockets:", err)
+		}
+		defer ln.Close()
+	}
+	events, err := Scan(context.Background(), root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done DoneEvent
+	var sock Entry
+	for ev := range events {
+		switch ev := ev.(type) {
+		case ChildEvent:
+			if ev.Name == "s" {
+				sock = ev.Entry
+			}
+		case DoneEvent:
+			done = ev
+		}
+	}
+	if sock.Kind != Socket || sock.Size != 0 || sock.Files != 0 {
+		t.Fatalf("the socket should be reported with its kind and no size: %+v", sock)
+	}
+	if done.Root.Size != 10 || done.Root.Files != 1 || done.Root.Special[Socket] != 2 {
+		t.Fatalf("sockets should be counted apart: %+v", done.Root.Totals)
+	}
+	if got := done.Root.Special.String(); got != "2 sockets" {
+		t.Errorf("Special.String() = %q", got)
+	}
+}
+
+func TestPlaceholdersAreCountedApart(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"online.bin": 1000, "d/online.bin": 300, "d/local.bin": 20} {
+		if err := os.WriteFile(filepath.Join(root, name), make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	isPlaceholder = func(fi fs.FileInfo) bool { return strings.HasPrefix(fi.Name(), "online") }
+	t.Cleanup(func() { isPlaceholder = Placeholder })
+	events, err := Scan(context.Background(), root, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done DoneEvent
+	for ev := range events {
+		if d, ok := ev.(DoneEvent); ok {
+			done = d
+		}
+	}
+	if done.Root.Size != 1320 || done.Root.Cloud != 1300 {
+		t.Fatalf("placeholders should count in Size and in Cloud: %+v", done.Root.Totals)
+	}
+}
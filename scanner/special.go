@@ -0,0 +1,87 @@
+package scanner
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// SpecialKind classifies the entries that are neither regular files,
+// directories nor symbolic links. Their sizes mean nothing (a device node
+// may report the size of the whole device) and stat'ing some of them can
+// hang, so walks skip them and only count them in Totals.Special.
+type SpecialKind int
+
+const (
+	NotSpecial SpecialKind = iota
+	FIFO
+	Socket
+	BlockDevice
+	CharDevice
+	numSpecialKinds
+)
+
+var specialNames = [numSpecialKinds]string{"", "FIFO", "socket", "block device", "character device"}
+
+func (k SpecialKind) String() string {
+	if k < 0 || k >= numSpecialKinds {
+		return "special file"
+	}
+	return specialNames[k]
+}
+
+// Special classifies a file from its mode, or from the type bits of a
+// fs.DirEntry, which take no stat.
+func Special(mode fs.FileMode) SpecialKind {
+	switch {
+	case mode&fs.ModeNamedPipe != 0:
+		return FIFO
+	case mode&fs.ModeSocket != 0:
+		return Socket
+	case mode&fs.ModeCharDevice != 0:
+		return CharDevice
+	case mode&fs.ModeDevice != 0:
+		return BlockDevice
+	}
+	return NotSpecial
+}
+
+// SpecialCounts counts the special files skipped below a directory, by kind.
+type SpecialCounts [numSpecialKinds]int64
+
+// Add counts one file of kind k.
+func (c *SpecialCounts) Add(k SpecialKind) {
+	if k > NotSpecial && k < numSpecialKinds {
+		c[k]++
+	}
+}
+
+// Merge adds the counts of o.
+func (c *SpecialCounts) Merge(o SpecialCounts) {
+	for k := range c {
+		c[k] += o[k]
+	}
+}
+
+// Total is the number of special files counted.
+func (c SpecialCounts) Total() int64 {
+	var n int64
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+// String lists the counts, e.g. "2 FIFOs, 1 socket"; "" when there are none.
+func (c SpecialCounts) String() string {
+	var parts []string
+	for k := NotSpecial + 1; k < numSpecialKinds; k++ {
+		switch n := c[k]; {
+		case n == 1:
+			parts = append(parts, "1 "+k.String())
+		case n > 1:
+			parts = append(parts, fmt.Sprintf("%d %ss", n, k))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
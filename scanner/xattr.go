@@ -0,0 +1,33 @@
+package scanner
+
+import "io/fs"
+
+// Xattr is one extended attribute of a file. On macOS a file's resource
+// fork is the attribute named ResourceFork.
+type Xattr struct {
+	Name string
+	Size int64
+}
+
+// ResourceFork is the attribute macOS exposes a resource fork as.
+const ResourceFork = "com.apple.ResourceFork"
+
+// XattrSize is the total size of the extended attributes of the file at
+// path (not following a final symlink); 0 where they are not supported.
+func XattrSize(path string) int64 {
+	attrs, _ := Xattrs(path)
+	var n int64
+	for _, a := range attrs {
+		n += a.Size
+	}
+	return n
+}
+
+// fileSize is FileSize plus, with Xattrs set, the file's attributes.
+func (o Options) fileSize(path string, fi fs.FileInfo) int64 {
+	size := FileSize(fi, o.Allocated)
+	if o.Xattrs {
+		size += XattrSize(path)
+	}
+	return size
+}
@@ -0,0 +1,10 @@
+//go:build !(darwin || linux)
+
+package scanner
+
+import "errors"
+
+// Xattrs is only implemented on macOS and Linux.
+func Xattrs(string) ([]Xattr, error) {
+	return nil, errors.ErrUnsupported
+}
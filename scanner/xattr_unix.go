@@ -0,0 +1,44 @@
+//go:build darwin || linux
+
+package scanner
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// Xattrs lists the extended attributes of the file at path with their
+// sizes, not following a final symlink.
+func Xattrs(path string) ([]Xattr, error) {
+	var buf []byte
+	for {
+		n, err := unix.Llistxattr(path, buf)
+		if errors.Is(err, unix.ERANGE) {
+			buf = nil // grew since it was measured
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		if buf == nil {
+			buf = make([]byte, n)
+			continue
+		}
+		buf = buf[:n]
+		break
+	}
+	var attrs []Xattr
+	for _, name := range bytes.Split(bytes.TrimRight(buf, "\x00"), []byte{0}) {
+		n, err := unix.Lgetxattr(path, string(name), nil)
+		if err != nil {
+			continue // removed since it was listed
+		}
+		attrs = append(attrs, Xattr{Name: string(name), Size: int64(n)})
+	}
+	return attrs, nil
+}
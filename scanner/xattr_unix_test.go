@@ -0,0 +1,33 @@
+//go:build darwin || linux
+
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestXattrsAddToFileSizes(t *testing.T) {
+	root := t.TempDir()
+	f := filepath.Join(root, "f")
+	if err := os.WriteFile(f, make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := unix.Setxattr(f, "user.disktree", make([]byte, 40), 0); err != nil {
+		t.Skip("extended attributes:", err)
+	}
+	attrs, err := Xattrs(f)
+	if err != nil || len(attrs) != 1 || attrs[0].Name != "user.disktree" || attrs[0].Size != 40 {
+		t.Fatalf("Xattrs = %+v, %v", attrs, err)
+	}
+	if tot := Walk(context.Background(), root, Options{}); tot.Size != 100 {
+		t.Errorf("without Xattrs: %d, want 100", tot.Size)
+	}
+	if tot := Walk(context.Background(), root, Options{Xattrs: true}); tot.Size != 140 {
+		t.Errorf("with Xattrs: %d, want 140", tot.Size)
+	}
+}
@@ -3,10 +3,17 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"net"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func TestScannerIntegration(t *testing.T) {
@@ -87,3 +94,286 @@ func TestScannerIntegration(t *testing.T) {
 		t.Fatalf("scanDir children missing expected entries: got %v", names)
 	}
 }
+
+func TestSumHelperAndElevatedMerge(t *testing.T) {
+	cache = sync.Map{}
+	tmp := t.TempDir()
+	locked := filepath.Join(tmp, "locked")
+	if err := os.MkdirAll(locked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(locked, "f"), bytes.Repeat([]byte{'x'}, 50), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runSumHelper(&out, locked, &Scanner{threads: 2, mounts: newMountTable(nil)}); err != nil {
+		t.Fatal(err)
+	}
+	var rep sumReport
+	if err := json.Unmarshal(out.Bytes(), &rep); err != nil {
+		t.Fatalf("helper output not JSON: %v (%q)", err, out.String())
+	}
+	if rep.Size != 50 || rep.Files != 1 {
+		t.Fatalf("helper report = %+v; want 50 bytes, 1 file", rep)
+	}
+
+	// pretend the directory was unreadable during the normal scan
+	m := initialModel(tmp, 2, false)
+	child := &Node{Name: "locked", Path: locked, Err: os.ErrPermission}
+	m.current = &Node{Name: filepath.Base(tmp), Path: tmp, Children: []*Node{child}, Scanned: true}
+	m.applyElevated(elevatedDoneMsg{path: locked, rep: rep})
+	if child.Err != nil || child.Size != 50 {
+		t.Fatalf("child not updated: %+v", child)
+	}
+	if m.current.Size != 50 || m.current.Files != 1 {
+		t.Fatalf("parent totals not recomputed: size=%d files=%d", m.current.Size, m.current.Files)
+	}
+}
+
+func TestIncrementalRescanOnlyWalksChangedDirs(t *testing.T) {
+	dirRecords = sync.Map{}
+	tmp := t.TempDir()
+	deep := filepath.Join(tmp, "deep", "er")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "top"), bytes.Repeat([]byte{'a'}, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 2, trustMtime: true}
+
+	res, ws := s.sumDirCached(context.Background(), tmp)
+	if res.size != 10 || ws.dirs != 3 || ws.rewalked != 3 {
+		t.Fatalf("first walk = %+v %+v; want 10 bytes, 3/3 dirs walked", res, ws)
+	}
+	res, ws = s.sumDirCached(context.Background(), tmp)
+	if res.size != 10 || res.dirs != 2 || ws.rewalked != 0 {
+		t.Fatalf("unchanged rescan = %+v %+v; want cached totals, nothing re-walked", res, ws)
+	}
+
+	// adding a file deep down bumps only that directory's mtime
+	if err := os.WriteFile(filepath.Join(deep, "new"), bytes.Repeat([]byte{'b'}, 5), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(deep, later, later); err != nil {
+		t.Fatal(err)
+	}
+	res, ws = s.sumDirCached(context.Background(), tmp)
+	if res.size != 15 || res.files != 2 {
+		t.Fatalf("rescan after change = %+v; want 15 bytes, 2 files", res)
+	}
+	if ws.rewalked != 1 || ws.changed != 1 {
+		t.Fatalf("rescan stats = %+v; want exactly the changed dir re-walked", ws)
+	}
+
+	// changes made through disktree invalidate the parent listing
+	invalidateSums(filepath.Join(deep, "new"))
+	if _, ws := s.sumDirCached(context.Background(), tmp); ws.rewalked != 1 {
+		t.Fatalf("invalidated parent should be re-walked, stats %+v", ws)
+	}
+}
+
+func TestRescanSeesFilesGrowingInPlace(t *testing.T) {
+	dirRecords = sync.Map{}
+	tmp := t.TempDir()
+	top := filepath.Join(tmp, "top")
+	if err := os.WriteFile(top, bytes.Repeat([]byte{'a'}, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 2}
+	s.sumDirCached(context.Background(), tmp)
+	mtime := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	s.sumDirCached(context.Background(), tmp)
+
+	// appending doesn't touch the directory's mtime
+	f, err := os.OpenFile(top, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(bytes.Repeat([]byte{'b'}, 90))
+	_ = f.Close()
+	if res, ws := s.sumDirCached(context.Background(), tmp); res.size != 100 || ws.changed != 1 {
+		t.Fatalf("rescan = %+v %+v; want the grown file's 100 bytes", res, ws)
+	}
+}
+
+func TestScanDirAndTUIScanAgree(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	tmp := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmp, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "d", "f"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(tmp, "d"), filepath.Join(tmp, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	s := &Scanner{threads: 2}
+	direct := s.scanDir(context.Background(), tmp)
+	cache = sync.Map{}
+	var updates int
+	viaTUI, _ := s.scan(context.Background(), tmp, true, func(*Node) { updates++ })
+
+	for _, n := range []*Node{direct, viaTUI} {
+		if len(n.Children) != 1 || n.Children[0].Name != "d" || n.Size != 5 {
+			t.Fatalf("expected only d (5 bytes) with symlinks skipped, got %+v", n)
+		}
+	}
+	if updates != 3 {
+		t.Fatalf("expected a pending, a counted and a sized update for d, got %d", updates)
+	}
+
+	missing := filepath.Join(tmp, "missing")
+	if n := s.scanDir(context.Background(), missing); n.Err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+	if _, ok := cache.Load(missing); ok {
+		t.Fatal("unreadable roots should not be cached")
+	}
+}
+
+func TestNoAccessRowsShowUnknownSize(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	m.loading = false
+	m.current = &Node{Name: "home", Path: "/home", Scanned: true, Size: 100, Children: []*Node{
+		{Name: "me", Path: "/home/me", IsDir: true, Size: 100},
+		{Name: "other", Path: "/home/other", IsDir: true, Size: -1, NoAccess: true, Err: os.ErrPermission},
+	}}
+	m.setTableRowsFromNode(m.current)
+	rows := m.tbl.Rows()
+	if len(rows) != 2 || strings.TrimSpace(rows[1][1]) != "no access" {
+		t.Fatalf("expected a trailing no-access row, got %v", rows)
+	}
+	if m.elevatedTarget() != nil {
+		t.Fatal("cursor is on the readable row")
+	}
+	m.tbl.SetCursor(1)
+	if m.elevatedTarget() == nil {
+		t.Fatal("no-access rows should be eligible for an elevated rescan")
+	}
+}
+
+func TestPendingRowsShowEntryCounts(t *testing.T) {
+	m := initialModel(t.TempDir(), 1, false)
+	m.loading = false
+	m.current = &Node{Name: "srv", Path: "/srv", Scanned: true, Children: []*Node{
+		{Name: "done", Path: "/srv/done", IsDir: true, Size: 10, Files: 4, Dirs: 1},
+		{Name: "busy", Path: "/srv/busy", IsDir: true, Size: -1, ListedFiles: 12, ListedDirs: 3},
+	}}
+	sumChildren(m.current)
+	m.setTableRowsFromNode(m.current)
+	rows := m.tbl.Rows()
+	if len(rows) != 2 || rows[0][3] != "4" || rows[1][3] != "12+" || rows[1][4] != "3+" {
+		t.Fatalf("a directory being sized should show its entry counts, got %v", rows)
+	}
+	if m.current.Files != 4 {
+		t.Fatalf("entry counts must stay out of the totals, got %d files", m.current.Files)
+	}
+}
+
+func TestExclusiveSizesAndSort(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	tmp := t.TempDir()
+	for name, size := range map[string]int{
+		"flat/a.bin":       3000,
+		"nested/x/b.bin":   5000,
+		"nested/small.txt": 10,
+	} {
+		p := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Scanner{threads: 2}
+	for _, incremental := range []bool{false, true} {
+		n, _ := s.scan(context.Background(), tmp, incremental, nil)
+		got := map[string]int64{}
+		for _, c := range n.Children {
+			got[c.Name] = c.Exclusive
+		}
+		if got["flat"] != 3000 || got["nested"] != 10 {
+			t.Fatalf("incremental=%v: exclusive sizes %v; want flat=3000 nested=10", incremental, got)
+		}
+	}
+
+	m := initialModel(tmp, 2, false)
+	m.loading = false
+	m.current = s.scanDir(context.Background(), tmp)
+	m.setTableRowsFromNode(m.current)
+	if m.rows[0].Name != "nested" {
+		t.Fatalf("size sort should put nested first, got %s", m.rows[0].Name)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	if m.rows[0].Name != "flat" {
+		t.Fatalf("exclusive sort should put flat first, got %s", m.rows[0].Name)
+	}
+	if own := strings.TrimSpace(m.tbl.Rows()[1][2]); own != "10 B" {
+		t.Fatalf("Own column for nested = %q; want 10 B", own)
+	}
+}
+
+func TestDirsRemovedDuringScanAreTaggedChanged(t *testing.T) {
+	dirRecords = sync.Map{}
+	dir := t.TempDir()
+	s := &Scanner{threads: 2}
+	res := s.sumDir(context.Background(), filepath.Join(dir, "gone"))
+	if res.err != nil || !res.changed {
+		t.Fatalf("a directory removed before it was walked should be changed, not an error: %+v", res)
+	}
+
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.current = &Node{Name: filepath.Base(dir), Path: dir, IsDir: true, Scanned: true, Changed: true, Children: []*Node{
+		{Name: "gone", Path: filepath.Join(dir, "gone"), IsDir: true, Changed: true},
+	}}
+	m.setTableRowsFromNode(m.current)
+	if !strings.Contains(m.tbl.Rows()[0][0], "[changed during scan]") {
+		t.Fatalf("row should be tagged: %q", m.tbl.Rows()[0][0])
+	}
+	if !strings.Contains(m.View(), "changed during scan: r to rescan") {
+		t.Fatalf("header should suggest a rescan")
+	}
+}
+
+func TestSpecialFilesAreSkippedAndListed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets in the filesystem")
+	}
+	cache = sync.Map{}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "d", "e"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "d", "e", "f"), make([]byte, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{filepath.Join(root, "s"), filepath.Join(root, "d", "e", "s")} {
+		ln, err := net.Listen("unix", p)
+		if err != nil {
+			t.Skip("unix sockets:", err)
+		}
+		defer ln.Close()
+	}
+	s := &Scanner{threads: 1, mounts: newMountTable(nil)}
+	n, _ := s.scan(context.Background(), root, false, nil)
+	if n.Size != 10 || n.Files != 1 || n.Special.Total() != 2 {
+		t.Fatalf("sockets should be counted apart: size %d, %d files, special %v", n.Size, n.Files, n.Special)
+	}
+	if got := specialNote(n); !strings.Contains(got, "2 sockets") {
+		t.Errorf("specialNote = %q", got)
+	}
+}
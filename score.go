@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// --------------------------- Cleanup score -----------------------
+
+// scoreKind is what an entry's name says about how safe it is to delete,
+// with the weight that adds to its score.
+type scoreKind struct {
+	label  string
+	weight float64
+}
+
+var (
+	kindCache = scoreKind{"cache", 1}
+	kindBuild = scoreKind{"build", 1}
+	kindCopy  = scoreKind{"copy", 0.8}
+	kindTemp  = scoreKind{"temp", 0.7}
+	kindMedia = scoreKind{"image", 0.5} // installers and disk images
+	kindOther = scoreKind{}
+)
+
+// regenerable are directory names whose contents are rebuilt or downloaded
+// again on demand.
+var regenerable = map[string]scoreKind{
+	".cache": kindCache, "cache": kindCache, "caches": kindCache, "__pycache__": kindCache,
+	".npm": kindCache, ".pnpm-store": kindCache, ".yarn": kindCache, ".gradle": kindCache,
+	".m2": kindCache, ".nuget": kindCache, ".cargo": kindCache, "go-build": kindCache,
+	".tox": kindCache, ".pytest_cache": kindCache, ".mypy_cache": kindCache, "deriveddata": kindCache,
+	"node_modules": kindBuild, "target": kindBuild, "build": kindBuild, "dist": kindBuild,
+	"out": kindBuild, ".next": kindBuild, ".nuxt": kindBuild, ".terraform": kindBuild,
+	".venv": kindBuild, "venv": kindBuild, "obj": kindBuild,
+	"tmp": kindTemp, "temp": kindTemp, ".trash": kindTemp, "logs": kindTemp,
+}
+
+// tempExts and imageExts are file extensions of throwaway files and of
+// installers or disk images, which usually outlive their use.
+var (
+	tempExts  = map[string]bool{".tmp": true, ".temp": true, ".log": true, ".bak": true, ".old": true, ".swp": true, ".dmp": true, ".core": true, ".part": true, ".crdownload": true}
+	imageExts = map[string]bool{".iso": true, ".dmg": true, ".img": true, ".pkg": true, ".msi": true, ".deb": true, ".rpm": true, ".appimage": true, ".vdi": true, ".vmdk": true, ".qcow2": true}
+)
+
+// copyName matches the names file managers and browsers give copies:
+// "report (1).pdf", "notes copy.txt", "Copy of slides.key".
+var copyName = regexp.MustCompile(`(?i)( \(\d+\)| - copy| copy( \d+)?)(\.[^.]+)?$|^copy of `)
+
+// classify is the kind n's name suggests.
+func classify(n *Node) scoreKind {
+	name := strings.ToLower(n.Name)
+	if n.IsDir {
+		if k, ok := regenerable[name]; ok {
+			return k
+		}
+	} else {
+		ext := filepath.Ext(name)
+		switch {
+		case tempExts[ext] || strings.HasSuffix(name, "~"):
+			return kindTemp
+		case imageExts[ext]:
+			return kindMedia
+		}
+	}
+	if copyName.MatchString(name) {
+		return kindCopy
+	}
+	return kindOther
+}
+
+// scoreInfo is what the score needs beyond the node: looked up once per
+// directory visit, since sorting asks for it on every comparison.
+type scoreInfo struct {
+	kind scoreKind
+	age  time.Duration // since the last modification
+}
+
+// cleanupScore ranks an entry from 0 to 100 by how much deleting it is
+// worth: size counts most (nothing small scores high), and age and a
+// regenerable or throwaway kind raise it.
+func cleanupScore(size int64, age time.Duration, kind scoreKind) int {
+	if size <= 0 {
+		return 0
+	}
+	// 0 at 1 MB and below, 1 at 128 GB and above, by powers of two
+	sizeW := math.Min(1, math.Max(0, (math.Log2(float64(size))-20)/17))
+	// 0 when touched this month, 1 after two years
+	ageW := math.Min(1, math.Max(0, (age.Hours()/24-30)/700))
+	return int(math.Round(100 * sizeW * (0.4 + 0.3*ageW + 0.3*kind.weight)))
+}
+
+// score is n's cleanup score, and the label of its kind (or its age).
+func (m *model) score(n *Node) (int, string) {
+	dir := filepath.Dir(n.Path)
+	if m.scores == nil || m.scoresDir != dir {
+		m.scores, m.scoresDir = map[string]scoreInfo{}, dir
+	}
+	info, ok := m.scores[n.Path]
+	if !ok {
+		info.kind = classify(n)
+		if fi, err := os.Lstat(n.Path); err == nil {
+			info.age = time.Since(fi.ModTime())
+		}
+		m.scores[n.Path] = info
+	}
+	label := info.kind.label
+	if label == "" && info.age > 365*24*time.Hour {
+		label = fmt.Sprintf("%dy old", int(info.age.Hours()/24/365))
+	}
+	// online-only placeholders free nothing here when deleted
+	return cleanupScore(localSize(n), info.age, info.kind), label
+}
+
+// scoreColumns is the Score column, shown while sorting by it (c).
+func (m *model) scoreColumns() []table.Column {
+	if m.sort != sortByScore {
+		return nil
+	}
+	w := 14
+	if m.narrow() {
+		w = 0
+	}
+	return []table.Column{{Title: "Score", Width: w}}
+}
+
+func (m *model) scoreCell(n *Node) string {
+	if n.Size < 0 {
+		return ""
+	}
+	s, label := m.score(n)
+	if label == "" {
+		return fmt.Sprintf("%3d", s)
+	}
+	return fmt.Sprintf("%3d %s", s, label)
+}
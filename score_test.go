@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		isDir bool
+		want  string
+	}{
+		{"node_modules", true, "build"},
+		{".cache", true, "cache"},
+		{"node_modules", false, ""},
+		{"debug.log", false, "temp"},
+		{"notes.txt~", false, "temp"},
+		{"ubuntu-24.04.iso", false, "image"},
+		{"report (1).pdf", false, "copy"},
+		{"Copy of slides.key", false, "copy"},
+		{"photos copy", true, "copy"},
+		{"photo-2.jpg", false, ""},
+		{"src", true, ""},
+	} {
+		if got := classify(&Node{Name: tc.name, IsDir: tc.isDir}).label; got != tc.want {
+			t.Errorf("classify(%q, dir=%v) = %q, want %q", tc.name, tc.isDir, got, tc.want)
+		}
+	}
+}
+
+func TestCleanupScore(t *testing.T) {
+	year := 365 * 24 * time.Hour
+	if s := cleanupScore(512<<10, 5*year, kindCache); s != 0 {
+		t.Errorf("anything under 1 MB should score 0, got %d", s)
+	}
+	big, old, cacheDir := cleanupScore(10<<30, 0, kindOther), cleanupScore(10<<30, 3*year, kindOther), cleanupScore(10<<30, 0, kindCache)
+	if !(old > big && cacheDir > big) {
+		t.Errorf("age and kind should raise the score: new %d, old %d, cache %d", big, old, cacheDir)
+	}
+	if s := cleanupScore(1<<40, 3*year, kindCache); s != 100 {
+		t.Errorf("a huge old cache should score 100, got %d", s)
+	}
+	if small, large := cleanupScore(2<<20, 3*year, kindBuild), cleanupScore(10<<30, 0, kindOther); small >= large {
+		t.Errorf("size should count most: 2 MB old build %d, 10 GB new file %d", small, large)
+	}
+}
+
+func TestSortByScoreAddsColumn(t *testing.T) {
+	h := newTUIHarness(t, 140, 24)
+	if err := os.WriteFile(filepath.Join(h.m.rootPath, "big.log"), make([]byte, 3<<20), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h.keys("r")
+	base := len(h.m.tbl.Columns())
+	h.keys("c")
+	cols := h.m.tbl.Columns()
+	if len(cols) != base+1 || cols[base].Title != "Score" {
+		t.Fatalf("columns = %v", cols)
+	}
+	if top := h.m.tbl.Rows()[0]; !strings.Contains(top[0], "big.log") || !strings.HasSuffix(top[base], "temp") {
+		t.Errorf("top row = %v, want big.log scored as temp", top)
+	}
+	h.keys("s")
+	if len(h.m.tbl.Columns()) != base {
+		t.Error("s should drop the Score column")
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Scan server -------------------------
+
+// With -serve a disktree process does the scanning without a TUI and keeps
+// the tree in memory, and TUIs started with -attach get their listings
+// from it over a unix socket instead of walking themselves. Any number of
+// them can attach, and closing a terminal loses nothing: attaching again
+// shows the same results at once. The socket is only accessible to its
+// owner; viewers act on the files themselves (deletes, renames) and tell
+// the server what they changed.
+
+// serverRequest is a viewer's request, one JSON object per line.
+type serverRequest struct {
+	Op    string `json:"op"` // hello, list or forget
+	Path  string `json:"path,omitempty"`
+	Fresh bool   `json:"fresh,omitempty"` // list again, don't answer from memory
+}
+
+// serverReply is one line of an answer: hello's root, a child of a listing
+// being sized, the finished listing, or an error.
+type serverReply struct {
+	Root    string    `json:"root,omitempty"`
+	PID     int       `json:"pid,omitempty"`
+	Started time.Time `json:"started,omitzero"`
+	Child   *wireNode `json:"child,omitempty"`
+	Node    *wireNode `json:"node,omitempty"`
+	Err     string    `json:"error,omitempty"`
+}
+
+// wireNode is a Node on the socket, with its children but not theirs.
+type wireNode struct {
+	Name        string                `json:"name"`
+	Path        string                `json:"path"`
+	IsDir       bool                  `json:"dir,omitempty"`
+	Size        int64                 `json:"size"`
+	Files       int64                 `json:"files,omitempty"`
+	Dirs        int64                 `json:"dirs,omitempty"`
+	Exclusive   int64                 `json:"own,omitempty"`
+	Err         string                `json:"error,omitempty"`
+	Hidden      bool                  `json:"hidden,omitempty"`
+	NoAccess    bool                  `json:"no_access,omitempty"`
+	LinkTarget  string                `json:"link,omitempty"`
+	Changed     bool                  `json:"changed,omitempty"`
+	Truncated   bool                  `json:"truncated,omitempty"`
+	Estimated   bool                  `json:"estimated,omitempty"`
+	Margin      int64                 `json:"margin,omitempty"`
+	Kind        scanner.SpecialKind   `json:"kind,omitempty"`
+	Special     scanner.SpecialCounts `json:"special,omitzero"`
+	Disk        int64                 `json:"disk,omitempty"`
+	Cloud       int64                 `json:"cloud,omitempty"`
+	ListedFiles int64                 `json:"listed_files,omitempty"`
+	ListedDirs  int64                 `json:"listed_dirs,omitempty"`
+	Children    []*wireNode           `json:"children,omitempty"`
+}
+
+func toWire(n *Node, children bool) *wireNode {
+	w := &wireNode{Name: n.Name, Path: n.Path, IsDir: n.IsDir, Size: n.Size, Files: n.Files, Dirs: n.Dirs, Exclusive: n.Exclusive, Err: errString(n.Err), Hidden: n.Hidden, NoAccess: n.NoAccess, LinkTarget: n.LinkTarget, Changed: n.Changed, Truncated: n.Truncated, Estimated: n.Estimated, Margin: n.Margin, Kind: n.Kind, Special: n.Special, Disk: n.Disk, Cloud: n.Cloud, ListedFiles: n.ListedFiles, ListedDirs: n.ListedDirs}
+	if children {
+		for _, c := range n.Children {
+			w.Children = append(w.Children, toWire(c, false))
+		}
+	}
+	return w
+}
+
+func (w *wireNode) node() *Node {
+	n := &Node{Name: w.Name, Path: w.Path, IsDir: w.IsDir, Size: w.Size, Files: w.Files, Dirs: w.Dirs, Exclusive: w.Exclusive, Hidden: w.Hidden, NoAccess: w.NoAccess, LinkTarget: w.LinkTarget, Changed: w.Changed, Truncated: w.Truncated, Estimated: w.Estimated, Margin: w.Margin, Kind: w.Kind, Special: w.Special, Disk: w.Disk, Cloud: w.Cloud, ListedFiles: w.ListedFiles, ListedDirs: w.ListedDirs}
+	if w.Err != "" {
+		n.Err = errors.New(w.Err)
+	}
+	for _, c := range w.Children {
+		n.Children = append(n.Children, c.node())
+	}
+	return n
+}
+
+// scanServer answers viewers from the process's cache. Listings of a path
+// asked for by several viewers at once are walked once.
+type scanServer struct {
+	s       *Scanner
+	root    string
+	started time.Time
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a listing being walked for one or more viewers.
+type flight struct {
+	done chan struct{}
+	node *Node
+}
+
+// runScanServer scans root and serves the results on sock until ctx ends
+// (Ctrl+C or SIGTERM when run from main).
+func runScanServer(ctx context.Context, sock, root string, s *Scanner, w io.Writer) error {
+	if c, err := net.Dial("unix", sock); err == nil {
+		c.Close()
+		return fmt.Errorf("%s: a server is already listening there", sock)
+	}
+	_ = os.Remove(sock) // left behind by a server that was killed
+	ln, err := listenPrivate(sock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sock)
+	srv := &scanServer{s: s, root: root, started: time.Now(), flights: map[string]*flight{}}
+	fmt.Fprintf(w, "Serving %s on %s (pid %d); view it with: disktree -attach %s\n", root, sock, os.Getpid(), sock)
+	go func() {
+		defer crashGuard()
+		t0 := time.Now()
+		n := srv.list(ctx, root, false, nil)
+		if ctx.Err() == nil {
+			fmt.Fprintf(w, "Scanned %s: %s in %d files (%s)\n", root, humanBytes(maxInt64(n.Size, 0)), n.Files, time.Since(t0).Round(time.Millisecond))
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go srv.serve(ctx, conn)
+	}
+}
+
+// listenPrivate listens on a unix socket at sock that only its owner can
+// connect to. The socket is bound in a private directory next to sock,
+// where nobody else can reach it before it is chmod'ed, and then moved
+// into place.
+func listenPrivate(sock string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(sock), ".disktree-serve-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(dir, "s.sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, sock); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveOnSignals runs runScanServer until Ctrl+C or SIGTERM.
+func serveOnSignals(sock, root string, s *Scanner, w io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runScanServer(ctx, sock, root, s, w)
+}
+
+// serve answers the requests on one connection.
+func (srv *scanServer) serve(ctx context.Context, conn net.Conn) {
+	defer crashGuard()
+	defer conn.Close()
+	dec, enc := json.NewDecoder(bufio.NewReader(conn)), json.NewEncoder(conn)
+	for {
+		var req serverRequest
+		if dec.Decode(&req) != nil {
+			return
+		}
+		if req.Path != "" {
+			req.Path = filepath.Clean(req.Path)
+		}
+		if req.Op != "hello" && !underPath(req.Path, srv.root) {
+			// viewers may only list and forget what this server scans
+			if enc.Encode(serverReply{Err: req.Path + " is not under " + srv.root}) != nil {
+				return
+			}
+			continue
+		}
+		var err error
+		switch req.Op {
+		case "hello":
+			err = enc.Encode(serverReply{Root: srv.root, PID: os.Getpid(), Started: srv.started})
+		case "list":
+			var mu sync.Mutex // children arrive from the walkers
+			n := srv.list(ctx, req.Path, req.Fresh, func(c *Node) {
+				mu.Lock()
+				_ = enc.Encode(serverReply{Child: toWire(c, false)})
+				mu.Unlock()
+			})
+			mu.Lock()
+			err = enc.Encode(serverReply{Node: toWire(n, true)})
+			mu.Unlock()
+		case "forget":
+			srv.forget(req.Path)
+			err = enc.Encode(serverReply{})
+		default:
+			err = enc.Encode(serverReply{Err: "unknown op " + req.Op})
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// forget drops what is remembered about p, which a viewer changed, and the
+// listings above it, whose sizes it is part of. They are walked again
+// (incrementally) when next asked for.
+func (srv *scanServer) forget(p string) {
+	forgetCachedSubtree(p)
+	invalidateSums(p)
+	for d := filepath.Dir(p); underPath(d, srv.root); d = filepath.Dir(d) {
+		cache.Delete(pathKey(d))
+		if d == filepath.Dir(d) {
+			break
+		}
+	}
+}
+
+// list is the listing of path with its children sized: from memory when
+// it has been walked, unless fresh, else walked (incrementally). A viewer
+// asking for a path already being walked waits for that walk.
+func (srv *scanServer) list(ctx context.Context, path string, fresh bool, onChild func(*Node)) *Node {
+	key := pathKey(path)
+	srv.mu.Lock()
+	if f := srv.flights[key]; f != nil {
+		srv.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.node
+		case <-ctx.Done():
+			return &Node{Name: nodeName(path), Path: path, IsDir: true, Err: ctx.Err()}
+		}
+	}
+	if v, ok := cache.Load(key); ok && !fresh {
+		if n := v.(*Node); n.Scanned && !n.Pruned {
+			srv.mu.Unlock()
+			return n
+		}
+	}
+	f := &flight{done: make(chan struct{})}
+	srv.flights[key] = f
+	srv.mu.Unlock()
+
+	f.node, _ = srv.s.scan(ctx, path, true, onChild)
+	srv.mu.Lock()
+	delete(srv.flights, key)
+	srv.mu.Unlock()
+	close(f.done)
+	return f.node
+}
+
+// serverClient is a viewer's side of -attach: a pool of connections, one
+// per listing being fetched, like the -scan-as bridge.
+type serverClient struct {
+	sock    string
+	root    string
+	pid     int
+	started time.Time
+	mu      sync.Mutex
+	idle    []*sumConn
+	asked   map[string]bool // paths listed once already: asking again means fresh
+}
+
+// attachServer connects to the server on sock.
+func attachServer(sock string) (*serverClient, error) {
+	c := &serverClient{sock: sock, asked: map[string]bool{}}
+	sc, err := c.get()
+	if err != nil {
+		return nil, fmt.Errorf("-attach %s: %w (is disktree -serve running?)", sock, err)
+	}
+	var rep serverReply
+	if err := sc.enc.Encode(serverRequest{Op: "hello"}); err == nil {
+		err = sc.dec.Decode(&rep)
+	}
+	if err != nil {
+		sc.c.Close()
+		return nil, fmt.Errorf("-attach %s: %w", sock, err)
+	}
+	c.root, c.pid, c.started = rep.Root, rep.PID, rep.Started
+	c.put(sc)
+	return c, nil
+}
+
+func (c *serverClient) get() (*sumConn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		sc := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return sc, nil
+	}
+	c.mu.Unlock()
+	conn, err := net.Dial("unix", c.sock)
+	if err != nil {
+		return nil, err
+	}
+	return &sumConn{c: conn, dec: json.NewDecoder(bufio.NewReader(conn)), enc: json.NewEncoder(conn)}, nil
+}
+
+func (c *serverClient) put(sc *sumConn) {
+	c.mu.Lock()
+	c.idle = append(c.idle, sc)
+	c.mu.Unlock()
+}
+
+// scan gets path's listing from the server. The first time a path is
+// asked for, what the server has in memory will do; after that the TUI
+// asks because it wants it rescanned.
+func (c *serverClient) scan(ctx context.Context, path string, onChild func(*Node)) *Node {
+	key := pathKey(path)
+	c.mu.Lock()
+	fresh := c.asked[key]
+	c.asked[key] = true
+	c.mu.Unlock()
+	fail := func(err error) *Node {
+		return &Node{Name: nodeName(path), Path: path, IsDir: true, Err: fmt.Errorf("scan server: %w", err), Scanned: true}
+	}
+	sc, err := c.get()
+	if err != nil {
+		return fail(err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = sc.c.SetDeadline(time.Now()) })
+	err = sc.enc.Encode(serverRequest{Op: "list", Path: path, Fresh: fresh})
+	var n *Node
+	for err == nil && n == nil {
+		var rep serverReply
+		if err = sc.dec.Decode(&rep); err != nil {
+			break
+		}
+		switch {
+		case rep.Err != "":
+			err = errors.New(rep.Err)
+		case rep.Child != nil && onChild != nil:
+			onChild(rep.Child.node())
+		case rep.Node != nil:
+			n = rep.Node.node()
+		}
+	}
+	if !stop() || err != nil {
+		sc.c.Close()
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fail(err)
+	}
+	c.put(sc)
+	n.Scanned = true
+	return n
+}
+
+// forget tells the server that path changed on disk, so no viewer gets
+// its old listing from memory.
+func (c *serverClient) forget(path string) {
+	if c == nil {
+		return
+	}
+	sc, err := c.get()
+	if err != nil {
+		return
+	}
+	var rep serverReply
+	if err = sc.enc.Encode(serverRequest{Op: "forget", Path: path}); err == nil {
+		err = sc.dec.Decode(&rep)
+	}
+	if err != nil {
+		sc.c.Close()
+		return
+	}
+	c.put(sc)
+}
+
+// close drops the connections; the server keeps running.
+func (c *serverClient) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sc := range c.idle {
+		sc.c.Close()
+	}
+	c.idle = nil
+}
+
+// attached is the server this process views, if any; invalidateSums tells
+// it about the changes the viewer makes.
+var attached *serverClient
+
+// serverTag is the header note of a viewer.
+func (m *model) serverTag() string {
+	if m.scanner.server == nil {
+		return ""
+	}
+	return fmt.Sprintf("[attached to scan server %d]", m.scanner.server.pid)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestServer serves a scan of root on a socket for the test.
+func startTestServer(t *testing.T, root string) string {
+	t.Helper()
+	sock := filepath.Join(t.TempDir(), "s.sock")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- runScanServer(ctx, sock, root, &Scanner{threads: 4, mounts: newMountTable(nil)}, io.Discard)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+		if _, err := os.Stat(sock); !os.IsNotExist(err) {
+			t.Error("the server left its socket behind")
+		}
+	})
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if c, err := net.Dial("unix", sock); err == nil {
+			c.Close()
+			return sock
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAttachedScannerListsFromTheServer(t *testing.T) {
+	cache, dirRecords = sync.Map{}, sync.Map{}
+	root := t.TempDir()
+	for p, size := range map[string]int{"a/b/f": 5000, "c/g": 300} {
+		p = filepath.Join(root, p)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sock := startTestServer(t, root)
+	if err := runScanServer(context.Background(), sock, root, &Scanner{}, io.Discard); err == nil {
+		t.Fatal("a second server on the same socket should be refused")
+	}
+
+	client, err := attachServer(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+	if client.root != root || client.pid != os.Getpid() {
+		t.Fatalf("hello: got root %q pid %d", client.root, client.pid)
+	}
+	s := &Scanner{server: client}
+	n, _ := s.scan(context.Background(), root, true, nil)
+	if n.Err != nil || n.Size != 5300 || len(n.Children) != 2 || !n.Scanned {
+		t.Fatalf("root from the server: %+v", n)
+	}
+	var streamed []*Node
+	a, _ := s.scan(context.Background(), filepath.Join(root, "a"), true, func(c *Node) { streamed = append(streamed, c) })
+	if a.Size != 5000 || len(a.Children) != 1 || a.Children[0].Name != "b" || len(streamed) == 0 {
+		t.Fatalf("a from the server: %+v (%d children streamed)", a, len(streamed))
+	}
+
+	if fi, err := os.Stat(sock); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode: %v %v", fi.Mode(), err)
+	}
+	// nothing outside the root is listed
+	for _, p := range []string{filepath.Dir(root), filepath.Join(root, "..", "x")} {
+		if n := client.scan(context.Background(), p, nil); n.Err == nil {
+			t.Fatalf("%s is outside the root but was listed", p)
+		}
+	}
+
+	// a viewer's delete reaches the server, and a rescan sees it
+	if err := os.Remove(filepath.Join(root, "c", "g")); err != nil {
+		t.Fatal(err)
+	}
+	client.forget(filepath.Join(root, "c", "g"))
+	if n, _ = s.scan(context.Background(), root, true, nil); n.Size != 5000 {
+		t.Fatalf("after the delete the root should be 5000 B, got %d", n.Size)
+	}
+}
+
+func TestAttachFailsWithoutServer(t *testing.T) {
+	if _, err := attachServer(filepath.Join(t.TempDir(), "none.sock")); err == nil {
+		t.Fatal("attaching to nothing should fail")
+	}
+}
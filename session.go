@@ -0,0 +1,182 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Session archives --------------------
+
+// sessionFormat marks a .dtree file, so a stray gzip isn't taken for one.
+const sessionFormat = "disktree-session"
+
+// sessionVersion is bumped when the layout changes incompatibly.
+const sessionVersion = 1
+
+// sessionFile is a saved scan: gzip-compressed JSON of the whole tree with
+// the export preamble, written by ctrl+s (or -export x.dtree) and browsed
+// offline with `disktree open x.dtree`, e.g. by a colleague looking into a
+// capacity incident on a machine they can't reach.
+type sessionFile struct {
+	Format  string       `json:"format"`
+	Version int          `json:"version"`
+	Meta    *jsonMeta    `json:"meta"`
+	Tree    *sessionNode `json:"tree"`
+}
+
+// sessionNode is a tree entry. Paths are rebuilt from the names and the
+// root in the preamble, which keeps archives of deep trees small.
+type sessionNode struct {
+	Name     string         `json:"n"`
+	IsDir    bool           `json:"d,omitempty"`
+	Size     int64          `json:"s"`
+	Files    int64          `json:"f,omitempty"`
+	Dirs     int64          `json:"k,omitempty"`
+	Error    string         `json:"e,omitempty"`
+	Children []*sessionNode `json:"c,omitempty"`
+}
+
+type sessionExporter struct{}
+
+func (sessionExporter) Name() string      { return "session" }
+func (sessionExporter) Extension() string { return ".dtree" }
+
+func (sessionExporter) Write(w io.Writer, root *Node, o exportOptions) error {
+	meta := &jsonMeta{Root: root.Path, Generated: time.Now().Format(time.RFC3339), Version: version}
+	if o.Meta != nil {
+		meta = o.Meta.json()
+	}
+	var conv func(n *Node) *sessionNode
+	conv = func(n *Node) *sessionNode {
+		s := &sessionNode{Name: n.Name, IsDir: n.IsDir, Size: n.Size, Files: n.Files, Dirs: n.Dirs, Error: errString(n.Err)}
+		for _, c := range n.Children {
+			s.Children = append(s.Children, conv(c))
+		}
+		return s
+	}
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(sessionFile{Format: sessionFormat, Version: sessionVersion, Meta: meta, Tree: conv(root)}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// readSession turns an archive into a file listing, so it is browsed like
+// -from-file: everything that needs the real files is refused.
+func readSession(r io.Reader) (*fileListing, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a disktree session: %w", err)
+	}
+	var sf sessionFile
+	if err := json.NewDecoder(zr).Decode(&sf); err != nil {
+		return nil, fmt.Errorf("not a disktree session: %w", err)
+	}
+	switch {
+	case sf.Format != sessionFormat || sf.Meta == nil || sf.Tree == nil:
+		return nil, errors.New("not a disktree session")
+	case sf.Version > sessionVersion:
+		return nil, fmt.Errorf("the session was saved by a newer disktree (format %d); update to open it", sf.Version)
+	}
+	root := filepath.Clean(sf.Meta.Root)
+	l := &fileListing{root: root, dirs: map[string]*Node{}, meta: sf.Meta}
+	var build func(s *sessionNode, p string) *Node
+	build = func(s *sessionNode, p string) *Node {
+		n := &Node{Name: s.Name, Path: p, IsDir: s.IsDir, Size: s.Size, Files: s.Files, Dirs: s.Dirs, Exclusive: s.Size, Scanned: true}
+		if s.Error != "" {
+			n.Err = errors.New(s.Error)
+		}
+		if !s.IsDir {
+			return n
+		}
+		for _, c := range s.Children {
+			child := build(c, filepath.Join(p, c.Name))
+			if child.IsDir {
+				n.Exclusive -= child.Size
+			}
+			n.Children = append(n.Children, child)
+		}
+		n.Exclusive = max(0, n.Exclusive)
+		l.dirs[p] = n
+		leaders.offerExclusive(p, n.Exclusive)
+		leaders.offerCumulative(p, n.Size)
+		return n
+	}
+	top := build(sf.Tree, root)
+	top.Name, top.IsDir = nodeName(root), true
+	l.dirs[root] = top
+	return l, nil
+}
+
+// loadSession reads the archive at path.
+func loadSession(path string) (*fileListing, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	l, err := readSession(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+// saveSession archives the whole tree from the scan root. A scan is walked
+// in depth in the background like a deep export; an open list or session
+// is written as it is.
+func (m *model) saveSession() tea.Cmd {
+	path := "disktree-session-" + timestamp() + sessionExporter{}.Extension()
+	if m.listing == nil {
+		m.status = "Saving the session: walking " + m.rootPath + " in depth ..."
+		return m.startExport(m.rootPath, path, exportOptions{Format: sessionExporter{}.Name(), IncludeErrors: true})
+	}
+	l := m.listing
+	o := exportOptions{}
+	if l.meta != nil {
+		o.Meta = &exportMeta{Root: l.meta.Root, Host: l.meta.Host, Version: l.meta.Version, Options: l.meta.Options}
+		o.Meta.Time, _ = time.Parse(time.RFC3339, l.meta.Generated)
+		o.Meta.errors.Store(l.meta.Errors)
+	}
+	f, err := os.Create(path)
+	if err == nil {
+		err = sessionExporter{}.Write(f, l.node(l.root), o)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		m.status = "⚠ saving the session failed: " + err.Error()
+		return nil
+	}
+	m.status = "Saved the session to " + path + " — disktree open " + path
+	return m.showExportToast(path, "session of "+l.root)
+}
+
+// sessionTag is the header note of an opened session.
+func sessionTag(meta *jsonMeta) string {
+	when := meta.Generated
+	if t, err := time.Parse(time.RFC3339, meta.Generated); err == nil {
+		when = t.Local().Format("2006-01-02 15:04")
+	}
+	tag := "[session"
+	if meta.Host != "" {
+		tag += " of " + meta.Host
+	}
+	tag += ", " + when
+	if meta.Errors > 0 {
+		tag += fmt.Sprintf(", %d unreadable", meta.Errors)
+	}
+	return tag + ", read-only]"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	tmp := deepExportTree(t)
+	out := filepath.Join(t.TempDir(), "capture.dtree")
+	s := &Scanner{threads: 2, mounts: newMountTable(nil)}
+	if err := s.runDeepExport(context.Background(), tmp, out, exportOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	l, err := loadSession(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePath(l.root, tmp) {
+		t.Fatalf("root = %s, want %s", l.root, tmp)
+	}
+	root := l.node(tmp)
+	if root == nil || root.Size != 100 || len(root.Children) != 2 || root.Exclusive != 60 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	b := l.node(filepath.Join(tmp, "a", "b"))
+	if b == nil || b.Size != 30 || len(b.Children) != 1 || b.Children[0].Path != filepath.Join(tmp, "a", "b", "f2") {
+		t.Fatalf("unexpected a/b: %+v", b)
+	}
+	if tag := l.tag(); !strings.HasPrefix(tag, "[session of ") || !strings.HasSuffix(tag, "read-only]") {
+		t.Errorf("tag = %q", tag)
+	}
+
+	// an opened session saves again as it is
+	var buf bytes.Buffer
+	if err := (sessionExporter{}).Write(&buf, root, exportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	again, err := readSession(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := again.node(filepath.Join(tmp, "a")); n == nil || n.Size != 40 {
+		t.Fatalf("unexpected a after a second save: %+v", n)
+	}
+}
+
+func TestReadSessionRejectsOtherFiles(t *testing.T) {
+	if _, err := readSession(strings.NewReader("100\t/srv/x\n")); err == nil {
+		t.Error("a plain file list is not a session")
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(`{"format":"disktree-session","version":99,"meta":{"root":"/"},"tree":{"n":"/"}}`))
+	_ = zw.Close()
+	if _, err := readSession(&buf); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Errorf("a newer format should be refused, got %v", err)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/exp/golden"
+	"github.com/muesli/termenv"
+)
+
+// tuiHarness drives a model with scripted keys and messages and renders
+// frames for golden-file comparison. Commands returned by Update are not
+// run (ticks would make frames timing dependent); scans are instead
+// drained synchronously so every frame is deterministic.
+//
+// Regenerate golden files with: go test -run Snapshot -update
+type tuiHarness struct {
+	t      *testing.T
+	m      *model
+	seenCh chan tea.Msg
+	pkgDir string // golden files live under testdata here, not in the fixture
+	tmp    string
+}
+
+// newTUIHarness builds a small fixed tree, changes into it so paths in
+// frames are stable, and runs the initial scan at the given terminal size.
+func newTUIHarness(t *testing.T, width, height int) *tuiHarness {
+	t.Helper()
+	tmp := t.TempDir()
+	for name, size := range map[string]int{
+		"alpha/big.bin":        4096,
+		"alpha/nested/one.txt": 1024,
+		"beta/small.txt":       100,
+		"readme.md":            2048,
+		"zeta.log":             10,
+	} {
+		p := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pkgDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(tmp)
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+
+	// render with colors so highlight and overlay styling are part of the frame
+	prev := lipgloss.ColorProfile()
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	t.Cleanup(func() { lipgloss.SetColorProfile(prev) })
+
+	m := initialModel(".", 2, false)
+	m.loadingMinDuration = 0
+	h := &tuiHarness{t: t, m: m, pkgDir: pkgDir, tmp: tmp}
+	m.Init()
+	h.send(tea.WindowSizeMsg{Width: width, Height: height})
+	h.settle()
+	return h
+}
+
+// send delivers messages to the model in order.
+func (h *tuiHarness) send(msgs ...tea.Msg) *tuiHarness {
+	for _, msg := range msgs {
+		h.m.Update(msg)
+	}
+	return h
+}
+
+// keys sends key presses: named keys ("enter", "esc", "backspace", "up",
+// "down", "tab") or literal text, one rune per press.
+func (h *tuiHarness) keys(keys ...string) *tuiHarness {
+	named := map[string]tea.KeyType{
+		"enter":     tea.KeyEnter,
+		"esc":       tea.KeyEscape,
+		"backspace": tea.KeyBackspace,
+		"up":        tea.KeyUp,
+		"down":      tea.KeyDown,
+		"tab":       tea.KeyTab,
+		"ctrl+u":    tea.KeyCtrlU,
+	}
+	for _, k := range keys {
+		if kt, ok := named[k]; ok {
+			h.send(tea.KeyMsg{Type: kt})
+		} else {
+			for _, r := range k {
+				h.send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			}
+		}
+		h.settle()
+	}
+	return h
+}
+
+// settle waits for a scan started by the last message to finish and then
+// delivers its messages, as the program loop would once it is idle.
+func (h *tuiHarness) settle() {
+	h.t.Helper()
+	if h.m.scanCh == nil || h.m.scanCh == h.seenCh {
+		return
+	}
+	h.seenCh = h.m.scanCh
+	var msgs []tea.Msg
+	for msg := range h.m.scanCh {
+		msgs = append(msgs, msg)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.m.ongoingScansMu.Lock()
+		idle := h.m.ongoingScans == 0
+		h.m.ongoingScansMu.Unlock()
+		if idle {
+			break
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatal("scan did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	h.send(msgs...)
+	h.send(flushUpdatesMsg{})
+}
+
+// frame renders the current view with escape sequences spelled out, so
+// golden files stay readable and style changes show up in diffs.
+func (h *tuiHarness) frame() []byte {
+	lines := strings.Split(h.m.View(), "\n")
+	for i, l := range lines {
+		q := strconv.Quote(l)
+		lines[i] = q[1 : len(q)-1]
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func (h *tuiHarness) requireFrame() {
+	h.t.Helper()
+	frame := h.frame()
+	if err := os.Chdir(h.pkgDir); err != nil {
+		h.t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(h.tmp) }()
+	golden.RequireEqual(h.t, frame)
+}
+
+func TestSnapshotMainView(t *testing.T) {
+	h := newTUIHarness(t, 100, 16)
+	h.requireFrame()
+}
+
+func TestSnapshotNarrowView(t *testing.T) {
+	h := newTUIHarness(t, 50, 16)
+	h.requireFrame()
+}
+
+func TestSnapshotDrillDownAndBack(t *testing.T) {
+	h := newTUIHarness(t, 100, 16)
+	h.keys("enter") // largest entry first: alpha
+	t.Run("into", func(t *testing.T) {
+		h.t = t
+		h.requireFrame()
+	})
+	h.keys("backspace")
+	t.Run("back", func(t *testing.T) {
+		h.t = t
+		h.requireFrame()
+	})
+}
+
+func TestSnapshotOverlays(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		keys []string
+	}{
+		{"help", []string{"?"}},
+		{"filter-prompt", []string{"/", "be"}},
+		{"filter-applied", []string{"/", "be", "enter"}},
+		{"confirm-delete", []string{"down", "down", "d"}},
+		{"chart", []string{"v"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTUIHarness(t, 100, 24)
+			h.keys(tc.keys...)
+			h.requireFrame()
+		})
+	}
+}
+
+func TestSnapshotRescanShowsSizeChange(t *testing.T) {
+	h := newTUIHarness(t, 100, 16)
+	h.m.scanner.trustMtime = true // the status says how much was re-listed
+	if err := os.WriteFile(filepath.Join(h.tmp, "beta", "grown.bin"), make([]byte, 3000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(h.tmp, "zeta.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(h.tmp, "readme.md"), make([]byte, 1024), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h.keys("r")
+	h.requireFrame()
+}
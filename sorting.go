@@ -0,0 +1,133 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// --------------------------- Sorting -----------------------------
+
+// childOrder remembers which node's children are in table order, so a
+// render doesn't sort tens of thousands of entries on every tick. Updates
+// from a running scan are placed by binary search; a full sort happens only
+// when another node is shown, the sort key changes, or the children were
+// changed elsewhere (deletes, renames, merged rescans).
+type childOrder struct {
+	node  *Node
+	by    sortMode
+	index map[string]*Node // children by pathKey, to find what an update replaces
+}
+
+// childBefore is the table order: the sort key, with entries of unknown
+// size last, then name and path so that no two entries tie.
+func (m *model) childBefore(a, b *Node) bool {
+	if (a.Size < 0) != (b.Size < 0) {
+		return b.Size < 0
+	}
+	switch m.sort {
+	case sortByName:
+	case sortByExclusive:
+		if a.Exclusive != b.Exclusive || a.Size != b.Size {
+			return exclusiveBefore(a, b)
+		}
+	case sortByDisk:
+		if a.Disk != b.Disk {
+			return a.Disk > b.Disk
+		}
+	case sortByScore:
+		if sa, sb := m.scoreOf(a), m.scoreOf(b); sa != sb {
+			return sa > sb
+		}
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	default:
+		if a.Size != b.Size {
+			return a.Size > b.Size
+		}
+	}
+	if an, bn := strings.ToLower(a.Name), strings.ToLower(b.Name); an != bn {
+		return an < bn
+	}
+	return a.Path < b.Path
+}
+
+func (m *model) scoreOf(n *Node) int {
+	s, _ := m.score(n)
+	return s
+}
+
+// setSort changes the table order. The Score column shows only while
+// sorting by score, so switching to or from it lays the table out again.
+func (m *model) setSort(s sortMode) {
+	relayout := (s == sortByScore) != (m.sort == sortByScore)
+	m.sort = s
+	if relayout {
+		m.relayoutTable()
+	} else if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+}
+
+func (m *model) compareChildren(a, b *Node) int {
+	switch {
+	case m.childBefore(a, b):
+		return -1
+	case m.childBefore(b, a):
+		return 1
+	}
+	return 0
+}
+
+// sortChildren puts n's children in table order. Children that already are
+// in it cost one pass to check.
+func (m *model) sortChildren(n *Node) {
+	o := &m.order
+	if o.node == n && o.by == m.sort && slices.IsSortedFunc(n.Children, m.compareChildren) {
+		if len(o.index) != len(n.Children) {
+			m.indexChildren(n)
+		}
+		return
+	}
+	slices.SortFunc(n.Children, m.compareChildren)
+	m.indexChildren(n)
+}
+
+func (m *model) indexChildren(n *Node) {
+	o := &m.order
+	o.node, o.by = n, m.sort
+	o.index = make(map[string]*Node, len(n.Children))
+	for _, c := range n.Children {
+		o.index[pathKey(c.Path)] = c
+	}
+}
+
+// placeChild adds c to n's children in table order, replacing the entry
+// with the same path, without sorting the rest.
+func (m *model) placeChild(n *Node, c *Node) {
+	o := &m.order
+	switch {
+	case o.node != n || o.by != m.sort:
+		slices.SortFunc(n.Children, m.compareChildren)
+		m.indexChildren(n)
+	case len(o.index) != len(n.Children):
+		m.indexChildren(n) // added or removed elsewhere
+	}
+	key := pathKey(c.Path)
+	if old, ok := o.index[key]; ok {
+		if i := m.childPos(n.Children, old); i < len(n.Children) && n.Children[i] == old {
+			n.Children = slices.Delete(n.Children, i, i+1)
+		} else {
+			// replaced or changed in place since it was placed
+			n.Children = slices.DeleteFunc(n.Children, func(x *Node) bool { return samePath(x.Path, c.Path) })
+		}
+	}
+	n.Children = slices.Insert(n.Children, m.childPos(n.Children, c), c)
+	o.index[key] = c
+}
+
+// childPos is where c belongs among the sorted children.
+func (m *model) childPos(children []*Node, c *Node) int {
+	return sort.Search(len(children), func(i int) bool { return !m.childBefore(children[i], c) })
+}
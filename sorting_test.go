@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestScanUpdatesKeepChildrenSorted(t *testing.T) {
+	dir := t.TempDir()
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 20})
+	rnd := rand.New(rand.NewSource(1))
+	const n = 300
+	// every child arrives pending, then once or twice with a size
+	var msgs []childUpdateMsg
+	for i := 0; i < n; i++ {
+		p := filepath.Join(dir, fmt.Sprintf("c%03d", i))
+		msgs = append(msgs, childUpdateMsg{child: &Node{Name: filepath.Base(p), Path: p, IsDir: true, Size: -1}})
+		for k := 0; k < 1+i%2; k++ {
+			msgs = append(msgs, childUpdateMsg{child: &Node{Name: filepath.Base(p), Path: p, IsDir: true, Size: rnd.Int63n(50), Exclusive: rnd.Int63n(50)}})
+		}
+	}
+	rnd.Shuffle(len(msgs), func(i, j int) { msgs[i], msgs[j] = msgs[j], msgs[i] })
+	last := map[string]int64{}
+	for i, msg := range msgs {
+		msg.token = m.scanToken
+		m.Update(msg)
+		last[msg.child.Path] = msg.child.Size
+		if i%50 == 0 {
+			m.Update(flushUpdatesMsg{})
+		}
+	}
+	check := func(what string) {
+		t.Helper()
+		kids := m.current.Children
+		if len(kids) != n {
+			t.Fatalf("%s: %d children, want %d", what, len(kids), n)
+		}
+		if !slices.IsSortedFunc(kids, m.compareChildren) {
+			t.Fatalf("%s: children out of order", what)
+		}
+		for _, c := range kids {
+			if c.Size != last[c.Path] {
+				t.Fatalf("%s: %s has size %d, want the last update's %d", what, c.Name, c.Size, last[c.Path])
+			}
+		}
+	}
+	check("by size")
+	for _, key := range []rune{'n', 'x'} {
+		m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{key}})
+		p := filepath.Join(dir, "c007")
+		m.Update(childUpdateMsg{child: &Node{Name: "c007", Path: p, IsDir: true, Size: 99}, token: m.scanToken})
+		last[p] = 99
+		check("after " + string(key))
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- System stores -----------------------
+
+// systemStore is a well-known store that is managed by its own tooling.
+// Deleting its files by hand corrupts it or is undone by the owning
+// service, so the delete key offers the native reclaim commands instead.
+type systemStore struct {
+	name    string
+	goos    string   // only detected on this OS; "" for any
+	globs   []string // protect-style globs; "/**" covers the path and everything below
+	note    string
+	actions []storeAction
+}
+
+// storeAction is one native command offered for a store.
+type storeAction struct {
+	label string
+	argv  []string
+	root  bool // run through sudo/pkexec
+	// reclaims is set when the command frees space, so the view is
+	// rescanned afterwards
+	reclaims bool
+}
+
+var systemStores = []systemStore{
+	{
+		name:  "systemd journal",
+		goos:  "linux",
+		globs: []string{"/var/log/journal/**", "/run/log/journal/**"},
+		note:  "journald keeps its files open and indexed; vacuum them with journalctl.",
+		actions: []storeAction{
+			{label: "Show journal disk usage", argv: []string{"journalctl", "--disk-usage"}},
+			{label: "Keep the last 2 weeks", argv: []string{"journalctl", "--vacuum-time=2weeks"}, root: true, reclaims: true},
+			{label: "Shrink to 500 MB", argv: []string{"journalctl", "--vacuum-size=500M"}, root: true, reclaims: true},
+		},
+	},
+	{
+		name:  "snapd storage",
+		goos:  "linux",
+		globs: []string{"/var/lib/snapd/**", "/snap/**"},
+		note:  "Snaps are mounted images; remove them or their old revisions with snap.",
+		actions: []storeAction{
+			{label: "List snaps and disabled revisions", argv: []string{"snap", "list", "--all"}},
+			{label: "Keep only 2 revisions per snap", argv: []string{"snap", "set", "system", "refresh.retain=2"}, root: true, reclaims: true},
+		},
+	},
+	{
+		name:  "flatpak (system)",
+		goos:  "linux",
+		globs: []string{"/var/lib/flatpak/**"},
+		note:  "Flatpak shares runtimes between apps; let flatpak decide what is unused.",
+		actions: []storeAction{
+			{label: "List installed apps and runtimes", argv: []string{"flatpak", "list", "--system"}},
+			{label: "Remove unused runtimes", argv: []string{"flatpak", "uninstall", "--system", "--unused", "-y"}, root: true, reclaims: true},
+		},
+	},
+	{
+		name:  "flatpak (user)",
+		goos:  "linux",
+		globs: []string{"~/.local/share/flatpak/**"},
+		note:  "Flatpak shares runtimes between apps; let flatpak decide what is unused.",
+		actions: []storeAction{
+			{label: "List installed apps and runtimes", argv: []string{"flatpak", "list", "--user"}},
+			{label: "Remove unused runtimes", argv: []string{"flatpak", "uninstall", "--user", "--unused", "-y"}, reclaims: true},
+		},
+	},
+	{
+		name: "Time Machine",
+		goos: "darwin",
+		globs: []string{
+			"/.MobileBackups/**", "/System/Volumes/Data/.MobileBackups/**",
+			"/Volumes/com.apple.TimeMachine.localsnapshots/**", "/Volumes/*/Backups.backupdb/**",
+		},
+		note: "Backups and local APFS snapshots share unchanged data; only tmutil knows what deleting one frees.",
+		actions: []storeAction{
+			{label: "List local snapshots", argv: []string{"tmutil", "listlocalsnapshots", "/"}},
+			{label: "List backups", argv: []string{"tmutil", "listbackups"}},
+			{label: "Thin local snapshots", argv: []string{"tmutil", "thinlocalsnapshots", "/", "999999999999", "4"}, root: true, reclaims: true},
+		},
+	},
+}
+
+// detectStore returns the system store holding path on this OS, if any.
+func detectStore(path string) (*systemStore, bool) {
+	for i := range systemStores {
+		st := &systemStores[i]
+		if st.goos != "" && st.goos != runtime.GOOS {
+			continue
+		}
+		globs := make([]string, len(st.globs))
+		for j, g := range st.globs {
+			globs[j] = expandHome(g)
+		}
+		if _, ok := (protectedRules{globs: globs}).match(path); ok {
+			return st, true
+		}
+	}
+	return nil, false
+}
+
+// storeDoneMsg reports a finished store command and its output.
+type storeDoneMsg struct {
+	action storeAction
+	out    string
+	err    error
+}
+
+// run executes a, elevated when it needs root, with the TUI suspended so a
+// password prompt can be answered. Output is captured for the dialog.
+func (a storeAction) run() tea.Cmd {
+	argv := a.argv
+	if a.root {
+		// already root or no elevator: run as is and report what fails
+		if elev, err := elevatorCommand(); err == nil {
+			argv = append([]string{elev}, argv...)
+		}
+	}
+	var out bytes.Buffer
+	c := exec.Command(argv[0], argv[1:]...)
+	c.Stdout = &out
+	c.Stderr = &out
+	return tea.ExecProcess(c, func(err error) tea.Msg {
+		return storeDoneMsg{action: a, out: out.String(), err: err}
+	})
+}
+
+// storeOverlay offers a store's native commands in place of deleting n.
+// The last entry falls through to the regular delete confirmation.
+type storeOverlay struct {
+	store   *systemStore
+	node    *Node
+	cursor  int
+	missing map[int]string // actions whose tool isn't installed
+	output  string         // output of the last command
+}
+
+func newStoreOverlay(st *systemStore, n *Node) *storeOverlay {
+	o := &storeOverlay{store: st, node: n, missing: map[int]string{}}
+	for i, a := range st.actions {
+		if _, err := exec.LookPath(a.argv[0]); err != nil {
+			o.missing[i] = a.argv[0] + " not found"
+		}
+	}
+	return o
+}
+
+func (o *storeOverlay) opts() overlayOpts {
+	return overlayOpts{id: "store", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *storeOverlay) View(m *model) string {
+	w := m.popupWidth(76)
+	inner := maxvalue(10, w-6)
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{
+		lipgloss.NewStyle().Bold(true).Render(truncateToWidth(o.node.Name+" is part of the "+o.store.name, inner)),
+		"",
+		lipgloss.NewStyle().Width(inner).Render(o.store.note),
+		"",
+	}
+	items := make([]string, 0, len(o.store.actions)+1)
+	for i, a := range o.store.actions {
+		item := a.label + "  " + faint.Render(strings.Join(a.argv, " "))
+		if a.root {
+			item += faint.Render(" (as root)")
+		}
+		if why, ok := o.missing[i]; ok {
+			item = faint.Render(a.label + " — " + why)
+		}
+		items = append(items, item)
+	}
+	items = append(items, "Move to trash anyway")
+	for i, item := range items {
+		prefix := "  "
+		if i == o.cursor {
+			prefix = "› "
+		}
+		line := truncateToWidth(prefix+item, inner)
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Bold(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	if o.output != "" {
+		lines = append(lines, "")
+		out := strings.Split(strings.TrimRight(o.output, "\n"), "\n")
+		if len(out) > 8 {
+			out = append(out[:7], fmt.Sprintf("… %d more lines", len(out)-7))
+		}
+		for _, l := range out {
+			lines = append(lines, truncateToWidth(sanitizeLine(l), inner))
+		}
+	}
+	lines = append(lines, "", faint.Render("↑/↓ choose  Enter run  Esc close"))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *storeOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	last := len(o.store.actions)
+	switch msg.String() {
+	case "esc", "q":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j", "tab":
+		o.cursor = minvalue(last, o.cursor+1)
+	case "enter":
+		if o.cursor == last {
+			if rule, ok := m.protect.match(o.node.Path); ok {
+				m.promptProtectedDelete(o.node, rule)
+			} else {
+				m.overlays.push(newConfirmDelete(o.node, m.confirmThreshold))
+			}
+			return nil, true
+		}
+		if why, ok := o.missing[o.cursor]; ok {
+			m.status = "⚠ " + why
+			return nil, false
+		}
+		a := o.store.actions[o.cursor]
+		m.status = "Running " + strings.Join(a.argv, " ") + " ..."
+		return a.run(), false
+	}
+	return nil, false
+}
+
+// applyStoreDone shows a finished command's output in the store dialog and
+// rescans when the command freed space.
+func (m *model) applyStoreDone(msg storeDoneMsg) tea.Cmd {
+	cmdline := strings.Join(msg.action.argv, " ")
+	if o, ok := m.overlays.get("store").(*storeOverlay); ok {
+		o.output = msg.out
+		if msg.err != nil {
+			o.output += msg.err.Error()
+		}
+	}
+	if msg.err != nil {
+		m.status = fmt.Sprintf("⚠ %s failed: %v", cmdline, msg.err)
+		return nil
+	}
+	m.status = cmdline + " finished"
+	if !msg.action.reclaims {
+		return nil
+	}
+	return func() tea.Msg { return rescanMsg{} }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestDetectStore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the journal, snap and flatpak detectors are Linux only")
+	}
+	t.Setenv("HOME", "/home/alice")
+	cases := map[string]string{
+		"/var/log/journal":                                 "systemd journal",
+		"/var/log/journal/0123/system.journal":             "systemd journal",
+		"/var/lib/snapd/snaps/core_1.snap":                 "snapd storage",
+		"/var/lib/flatpak":                                 "flatpak (system)",
+		"/home/alice/.local/share/flatpak/repo/objects/ab": "flatpak (user)",
+		"/var/log/syslog":                                  "",
+		"/var/lib/snapdragon":                              "",
+	}
+	for p, want := range cases {
+		st, ok := detectStore(p)
+		got := ""
+		if ok {
+			got = st.name
+		}
+		if got != want {
+			t.Errorf("detectStore(%q) = %q; want %q", p, got, want)
+		}
+	}
+}
+
+func TestDeleteInStoreOffersNativeTools(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses the systemd journal detector")
+	}
+	dir := t.TempDir()
+	m := initialModel(dir, 1, false)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	journal := &Node{Name: "journal", Path: "/var/log/journal", IsDir: true, Size: 4 << 30}
+	m.current = &Node{Name: "log", Path: "/var/log", Scanned: true, Size: 4 << 30, Children: []*Node{journal}}
+	m.setTableRowsFromNode(m.current)
+	if !strings.Contains(m.tbl.Rows()[0][0], "[systemd journal]") {
+		t.Fatalf("store row should be tagged: %q", m.tbl.Rows()[0][0])
+	}
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'d'}})
+	o, ok := m.overlays.focused().(*storeOverlay)
+	if !ok {
+		t.Fatalf("expected the store dialog instead of a delete confirmation")
+	}
+	if v := o.View(m); !strings.Contains(v, "journalctl --vacuum-time=2weeks") || !strings.Contains(v, "Move to trash anyway") {
+		t.Fatalf("dialog should list the native commands and the fallback:\n%s", v)
+	}
+
+	cmd := m.applyStoreDone(storeDoneMsg{action: systemStores[0].actions[1], out: "Vacuuming done, freed 3.9G\n"})
+	if cmd == nil {
+		t.Fatalf("a reclaiming command should trigger a rescan")
+	}
+	if _, ok := cmd().(rescanMsg); !ok {
+		t.Fatalf("expected a rescan message")
+	}
+	if !strings.Contains(o.View(m), "freed 3.9G") {
+		t.Fatalf("command output should show in the dialog")
+	}
+	if cmd := m.applyStoreDone(storeDoneMsg{action: systemStores[0].actions[0], err: errors.New("exit status 1")}); cmd != nil || !strings.HasPrefix(m.status, "⚠") {
+		t.Fatalf("a failed command should only report, got status %q", m.status)
+	}
+
+	for range systemStores[0].actions {
+		m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlays.has("store") || !m.overlays.has("confirm-delete") {
+		t.Fatalf("the last entry should fall through to the delete confirmation")
+	}
+}
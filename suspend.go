@@ -0,0 +1,41 @@
+package main
+
+import (
+	"runtime"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- Suspend -----------------------------
+
+// suspend hands the terminal back to the shell, as ctrl+z does for any
+// program under job control. The whole process stops, scan workers
+// included, and fg resumes it where it was: a running scan continues
+// rather than starting over.
+func (m *model) suspend() tea.Cmd {
+	if runtime.GOOS == "windows" {
+		m.status = "Suspending to the shell needs job control, which Windows consoles don't have"
+		return nil
+	}
+	m.suspendedAt = time.Now()
+	return tea.Suspend
+}
+
+// resumed reports the return from the shell. Files may have changed
+// meanwhile; a finished view says how to catch up.
+func (m *model) resumed() {
+	away := time.Since(m.suspendedAt).Round(time.Second)
+	switch {
+	case m.suspendedAt.IsZero():
+		m.status = "Resumed"
+	case m.loading:
+		m.status = "Resumed after " + away.String() + " — the scan continues where it was"
+	default:
+		m.status = "Resumed after " + away.String() + " — r rescans if files changed meanwhile"
+	}
+	m.suspendedAt = time.Time{}
+	if m.current != nil {
+		m.setTableRowsFromNode(m.current)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestSuspendKeepsScan(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no job control")
+	}
+	m := initialModel(t.TempDir(), 1, false)
+	t.Cleanup(m.cancel)
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	m.loading = true
+	cur := m.current
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlZ})
+	if cmd == nil {
+		t.Fatal("ctrl+z should suspend during a scan")
+	}
+	if _, ok := cmd().(tea.SuspendMsg); !ok {
+		t.Fatal("ctrl+z should send tea.SuspendMsg")
+	}
+	m.Update(tea.ResumeMsg{})
+	if !m.loading || m.current != cur {
+		t.Fatal("the scan state should survive the suspend")
+	}
+	if !strings.Contains(m.status, "scan continues") {
+		t.Fatalf("unexpected status %q", m.status)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Symlink attribution -----------------
+
+// linkPolicy decides where the data behind a followed symlink is counted
+// (-symlink-policy). It only matters with -follow-symlinks.
+type linkPolicy int
+
+const (
+	// linkAtLink counts a link's target at the link, unless the target is
+	// inside the scan root and therefore already counted where it lives.
+	linkAtLink linkPolicy = iota
+	// linkAtTarget counts data only where it lives; links count as
+	// themselves and targets outside the scan root are not counted.
+	linkAtTarget
+	// linkBoth counts a link's target at the link as well as where it
+	// lives, so data inside the scan root is counted twice.
+	linkBoth
+)
+
+var linkPolicyNames = []string{"link", "target", "both"}
+
+func (p linkPolicy) String() string { return linkPolicyNames[p] }
+
+func parseLinkPolicy(s string) (linkPolicy, error) {
+	for i, n := range linkPolicyNames {
+		if s == n {
+			return linkPolicy(i), nil
+		}
+	}
+	return 0, fmt.Errorf("-symlink-policy must be one of %s", strings.Join(linkPolicyNames, ", "))
+}
+
+// options are the scanner engine settings matching this Scanner.
+func (s *Scanner) options() scanner.Options {
+	return scanner.Options{
+		Threads:        s.threads,
+		FollowSymlinks: s.followSymlinks,
+		FollowLink:     func(_, target string) bool { return s.countsThroughLink(target) },
+		ExcludeHidden:  s.excludeHidden,
+		TryUnreadable:  s.tryUnreadable || s.scanAs != nil, // the helper may read them
+		Allocated:      s.allocated,
+		Xattrs:         s.xattrs,
+		DiskSizes:      s.diskSizes,
+		MaxDepth:       maxTreeDepth,
+		ExcludeFile:    s.exclude.fileFilter(),
+		Skip:           s.ignored.skipFunc(),
+	}
+}
+
+// countsThroughLink reports whether a followed link to target is sized as
+// its target under the link policy.
+func (s *Scanner) countsThroughLink(target string) bool {
+	switch s.linkPolicy {
+	case linkAtTarget:
+		return false
+	case linkBoth:
+		return true
+	default:
+		return !s.inRoot(target)
+	}
+}
+
+// inRoot reports whether the resolved path p lies inside the scan root.
+// Link targets are fully resolved, so the root is too.
+func (s *Scanner) inRoot(p string) bool {
+	if s.root == "" {
+		return false
+	}
+	root := s.root
+	if real, err := filepath.EvalSymlinks(root); err == nil {
+		root = real
+	}
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// doubleCounted reports whether n is a link whose target is counted both
+// at the link and where it lives.
+func (s *Scanner) doubleCounted(n *Node) bool {
+	return n.LinkTarget != "" && s.followSymlinks && s.linkPolicy == linkBoth && s.inRoot(n.LinkTarget)
+}
+
+// linkAttribution explains, for the details view, where a link's data is
+// counted.
+func (s *Scanner) linkAttribution(n *Node) string {
+	if _, err := os.Stat(n.Path); err != nil {
+		return "the link itself; its target is missing"
+	}
+	switch {
+	case s.doubleCounted(n):
+		return "here and at the target — double counted"
+	case s.countsThroughLink(n.LinkTarget):
+		return "here, at the link"
+	case s.inRoot(n.LinkTarget):
+		return "at the target; the link counts as itself"
+	default:
+		return "not counted; the target is outside the scan"
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// linkTree builds root/data/f (100 B), root/in -> root/data and
+// root/out -> outside/g (1000 B) and returns root's resolved path.
+func linkTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on Windows")
+	}
+	root, _ = filepath.EvalSymlinks(t.TempDir())
+	outside, _ = filepath.EvalSymlinks(t.TempDir())
+	if err := os.Mkdir(filepath.Join(root, "data"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for p, size := range map[string]int{filepath.Join(root, "data", "f"): 100, filepath.Join(outside, "g"): 1000} {
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"in": filepath.Join(root, "data"), "out": outside} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside
+}
+
+func TestSymlinkPolicies(t *testing.T) {
+	root, _ := linkTree(t)
+	linkSize := func(name string) int64 {
+		fi, err := os.Lstat(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi.Size()
+	}
+	for _, tc := range []struct {
+		policy string
+		want   int64
+	}{
+		{"link", 100 + 1000 + linkSize("in")},
+		{"target", 100 + linkSize("in") + linkSize("out")},
+		{"both", 100 + 100 + 1000},
+	} {
+		cache = sync.Map{}
+		dirRecords = sync.Map{}
+		p, err := parseLinkPolicy(tc.policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &Scanner{threads: 2, followSymlinks: true, linkPolicy: p, root: root}
+		if got := s.sumDir(context.Background(), root).size; got != tc.want {
+			t.Fatalf("%s: walked size %d; want %d", tc.policy, got, tc.want)
+		}
+		n, _ := s.scan(context.Background(), root, false, nil)
+		if n.Size != tc.want {
+			t.Fatalf("%s: scanned size %d; want %d", tc.policy, n.Size, tc.want)
+		}
+	}
+	if _, err := parseLinkPolicy("everywhere"); err == nil {
+		t.Fatalf("expected an error for an unknown policy")
+	}
+}
+
+func TestDoubleCountedLinksAreFlagged(t *testing.T) {
+	cache = sync.Map{}
+	dirRecords = sync.Map{}
+	root, outside := linkTree(t)
+
+	m := initialModel(root, 2, true)
+	t.Cleanup(m.cancel)
+	m.loading = false
+	m.scanner.linkPolicy = linkBoth
+	m.current, _ = m.scanner.scan(context.Background(), root, false, nil)
+	m.setTableRowsFromNode(m.current)
+	if m.doubleCounted != 1 {
+		t.Fatalf("expected one double-counted link, got %d", m.doubleCounted)
+	}
+	var in, out *Node
+	for i, r := range m.tbl.Rows() {
+		switch m.rows[i].Name {
+		case "in":
+			in = m.rows[i]
+			if !strings.HasPrefix(r[0], "⚠ ") || !strings.Contains(r[0], "→ "+filepath.Join(root, "data")) {
+				t.Fatalf("in should be flagged with its target: %q", r[0])
+			}
+		case "out":
+			out = m.rows[i]
+			if strings.HasPrefix(r[0], "⚠") {
+				t.Fatalf("out points outside the scan and is counted once: %q", r[0])
+			}
+		}
+	}
+	if in == nil || out == nil || out.LinkTarget != outside {
+		t.Fatalf("missing link rows: in=%v out=%v", in, out)
+	}
+	if !strings.Contains(m.View(), "double-counted links") {
+		t.Fatalf("expected the header to mention double counting")
+	}
+
+	d := newDetailsOverlay(m, in)
+	want := [][2]string{{"Link target", filepath.Join(root, "data")}, {"Counted", "here and at the target — double counted"}}
+	for _, w := range want {
+		found := false
+		for _, r := range d.rows {
+			found = found || r == w
+		}
+		if !found {
+			t.Fatalf("details missing %v: %v", w, d.rows)
+		}
+	}
+	m.scanner.linkPolicy = linkAtLink
+	if got := m.scanner.linkAttribution(in); got != "at the target; the link counts as itself" {
+		t.Fatalf("link policy attribution for in = %q", got)
+	}
+	if got := m.scanner.linkAttribution(out); got != "here, at the link" {
+		t.Fatalf("link policy attribution for out = %q", got)
+	}
+}
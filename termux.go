@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Storage profiles --------------------
+
+// storageProfile adapts disktree to a platform whose storage layout needs
+// explaining. The only one is Termux on Android, chosen with -profile.
+type storageProfile struct {
+	name string
+	// shared is the user's shared storage (DCIM, Download, ...); its parent's
+	// parent holds the SD cards
+	shared string
+	home   string
+	// restricted are globs of directories Android hides from apps: they list
+	// as empty or partly, or not at all
+	restricted []string
+}
+
+// storageRoot is one entry of the start screen.
+type storageRoot struct {
+	label string
+	path  string
+	note  string
+}
+
+// Profiles for -profile.
+const (
+	profileAuto   = "auto"
+	profileTermux = "termux"
+	profileNone   = "none"
+)
+
+// androidShared is where Android mounts the primary user's shared storage.
+const androidShared = "/storage/emulated/0"
+
+// parseProfile picks the storage profile for -profile; nil means none.
+func parseProfile(s string, getenv func(string) string) (*storageProfile, error) {
+	switch s {
+	case profileAuto, "":
+		if !detectTermux(getenv) {
+			return nil, nil
+		}
+	case profileTermux:
+	case profileNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown profile %q (want auto, termux or none)", s)
+	}
+	return newTermuxProfile(androidShared, getenv("HOME")), nil
+}
+
+// detectTermux looks for the variables Termux sets in its shells.
+func detectTermux(getenv func(string) string) bool {
+	return getenv("TERMUX_VERSION") != "" || strings.Contains(getenv("PREFIX"), "/com.termux/")
+}
+
+func newTermuxProfile(shared, home string) *storageProfile {
+	return &storageProfile{
+		name:   profileTermux,
+		shared: shared,
+		home:   home,
+		restricted: []string{
+			filepath.Join(shared, "Android", "data"), filepath.Join(shared, "Android", "obb"),
+			"/data/data", "/data/app", "/data/user", "/data/media",
+		},
+	}
+}
+
+// restrictedNote is the row note of a directory Android restricts, or "".
+func (p *storageProfile) restrictedNote(path string) string {
+	if p == nil {
+		return ""
+	}
+	if _, ok := (protectedRules{globs: p.restricted}).match(path); ok {
+		return "restricted by Android"
+	}
+	return ""
+}
+
+// startRoots lists the common storage roots that exist on this device, for
+// the start screen. Entries that can't be read say how to fix it.
+func (p *storageProfile) startRoots() []storageRoot {
+	var out []storageRoot
+	add := func(label, path string) {
+		if _, err := os.Stat(path); err != nil {
+			return
+		}
+		r := storageRoot{label: label, path: path, note: p.restrictedNote(path)}
+		if f, err := os.Open(path); err != nil {
+			r.note = "no access"
+			if underPath(path, p.shared) || samePath(path, p.shared) {
+				r.note = "no access: run termux-setup-storage"
+			}
+		} else {
+			_ = f.Close()
+		}
+		out = append(out, r)
+	}
+	add("Shared storage", p.shared)
+	for _, d := range []struct{ label, dir string }{
+		{"Camera (DCIM)", "DCIM"}, {"Downloads", "Download"}, {"Pictures", "Pictures"},
+		{"Movies", "Movies"}, {"Music", "Music"}, {"Documents", "Documents"},
+		{"App media", filepath.Join("Android", "media")}, {"App data", filepath.Join("Android", "data")},
+	} {
+		add(d.label, filepath.Join(p.shared, d.dir))
+	}
+	// SD cards and USB drives appear next to "emulated" as XXXX-XXXX
+	storage := filepath.Dir(filepath.Dir(p.shared))
+	if ents, err := os.ReadDir(storage); err == nil {
+		for _, e := range ents {
+			if n := e.Name(); n != "emulated" && n != "self" && e.IsDir() {
+				add("Card "+n, filepath.Join(storage, n))
+			}
+		}
+	}
+	if p.home != "" {
+		add("Termux home", p.home)
+		// $HOME is <sandbox>/files/home; the sandbox holds the packages too
+		add("Termux sandbox", filepath.Dir(filepath.Dir(p.home)))
+	}
+	return out
+}
+
+// markAndroidStorage flags the mounts below /storage as Android's emulated
+// storage: local flash behind FUSE or sdcardfs, which the mount table would
+// otherwise take for a network filesystem.
+func markAndroidStorage(t *mountTable) {
+	if t == nil {
+		return
+	}
+	for i := range t.mounts {
+		mi := &t.mounts[i]
+		if strings.HasPrefix(mi.Point, "/storage/") || strings.EqualFold(mi.FSType, "sdcardfs") {
+			mi.Emulated = true
+		}
+	}
+}
+
+// startOverlay is the start screen of a storage profile: the common roots,
+// Enter scans one, Esc stays where the scan started.
+type startOverlay struct {
+	title  string
+	roots  []storageRoot
+	cursor int
+}
+
+func newStartOverlay(p *storageProfile) *startOverlay {
+	return &startOverlay{title: "Android storage", roots: p.startRoots()}
+}
+
+func (o *startOverlay) opts() overlayOpts {
+	return overlayOpts{id: "start", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *startOverlay) View(m *model) string {
+	w := m.popupWidth(72)
+	faint := lipgloss.NewStyle().Faint(true)
+	lines := []string{lipgloss.NewStyle().Bold(true).Render(o.title), ""}
+	if len(o.roots) == 0 {
+		lines = append(lines, faint.Render("no storage found; run termux-setup-storage"))
+	}
+	for i, r := range o.roots {
+		line := fmt.Sprintf("%-16s %s", r.label, sanitizeLine(r.path))
+		if r.note != "" {
+			line += "  " + faint.Render("["+r.note+"]")
+		}
+		if i == o.cursor {
+			line = lipgloss.NewStyle().Reverse(true).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "", faint.Render("↑/↓ move  Enter scan  Esc stay in "+sanitizeLine(m.rootPath)))
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (o *startOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "esc", "q":
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	case "up", "k":
+		o.cursor = maxvalue(0, o.cursor-1)
+	case "down", "j":
+		o.cursor = minvalue(maxvalue(0, len(o.roots)-1), o.cursor+1)
+	case "enter":
+		if o.cursor >= len(o.roots) {
+			return nil, true
+		}
+		return m.gotoPath(o.roots[o.cursor].path), true
+	}
+	return nil, false
+}
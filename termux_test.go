@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseProfile(t *testing.T) {
+	termux := map[string]string{"TERMUX_VERSION": "0.118.1", "HOME": "/data/data/com.termux/files/home"}
+	for _, tc := range []struct {
+		flag string
+		env  map[string]string
+		want bool
+	}{
+		{"auto", termux, true},
+		{"auto", map[string]string{"PREFIX": "/data/data/com.termux/files/usr"}, true},
+		{"auto", map[string]string{"PREFIX": "/usr"}, false},
+		{"termux", nil, true},
+		{"none", termux, false},
+	} {
+		p, err := parseProfile(tc.flag, func(k string) string { return tc.env[k] })
+		if err != nil || (p != nil) != tc.want {
+			t.Errorf("parseProfile(%q, %v) = %v, %v", tc.flag, tc.env, p, err)
+		}
+	}
+	if _, err := parseProfile("ios", os.Getenv); err == nil {
+		t.Errorf("unknown profiles should be rejected")
+	}
+}
+
+func TestTermuxStartScreen(t *testing.T) {
+	base := t.TempDir()
+	shared := filepath.Join(base, "storage", "emulated", "0")
+	home := filepath.Join(base, "data", "com.termux", "files", "home")
+	for _, d := range []string{
+		filepath.Join(shared, "DCIM"), filepath.Join(shared, "Download"), filepath.Join(shared, "Android", "data"),
+		filepath.Join(base, "storage", "self"), filepath.Join(base, "storage", "1A2B-3C4D"), home,
+	} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p := newTermuxProfile(shared, home)
+	var labels []string
+	for _, r := range p.startRoots() {
+		labels = append(labels, r.label)
+		if r.label == "App data" && r.note != "restricted by Android" {
+			t.Errorf("Android/data should be marked restricted, got %q", r.note)
+		}
+	}
+	want := "Shared storage,Camera (DCIM),Downloads,App data,Card 1A2B-3C4D,Termux home,Termux sandbox"
+	if got := strings.Join(labels, ","); got != want {
+		t.Fatalf("start roots %s, want %s", got, want)
+	}
+
+	m := initialModel(base, 1, false)
+	t.Cleanup(m.cancel)
+	m.profile = p
+	m.overlays.push(newStartOverlay(p))
+	m.Update(tea.WindowSizeMsg{Width: 100, Height: 30})
+	if v := m.View(); !strings.Contains(v, "Android storage") || !strings.Contains(v, "Card 1A2B-3C4D") {
+		t.Fatalf("start screen not shown:\n%s", v)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	if m.overlays.has("start") || m.current.Path != filepath.Join(shared, "DCIM") {
+		t.Fatalf("Enter should scan DCIM, got %s", m.current.Path)
+	}
+}
+
+func TestAndroidStorageMounts(t *testing.T) {
+	mt := newMountTable([]mountInfo{
+		{Point: "/", FSType: "ext4"},
+		{Point: "/storage/emulated", FSType: "fuse", Source: "/dev/fuse"},
+		{Point: "/mnt/remote", FSType: "fuse.sshfs"},
+	})
+	markAndroidStorage(mt)
+	mi := mt.lookup("/storage/emulated/0/DCIM")
+	if !mi.Emulated || mi.network() || !volumeFoldsCase(mi) {
+		t.Fatalf("shared storage is local and ignores case: %+v", mi)
+	}
+	if mi := mt.lookup("/mnt/remote/x"); mi.Emulated || !mi.network() {
+		t.Fatalf("other FUSE mounts are untouched: %+v", mi)
+	}
+}
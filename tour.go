@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Onboarding --------------------------
+
+// tourOverlay introduces navigation, delete/undo and where disktree keeps
+// its files. It is shown on first launch and with -tour; dismissing it
+// records tour_seen in the config file so it does not come back.
+type tourOverlay struct {
+	configPath string // where to record that the tour was seen; empty skips it
+}
+
+func (tourOverlay) opts() overlayOpts {
+	return overlayOpts{id: "tour", z: zAlert, dim: true, focusable: true}
+}
+
+func (t tourOverlay) View(m *model) string {
+	w := m.popupWidth(64)
+	bold := lipgloss.NewStyle().Bold(true)
+	faint := lipgloss.NewStyle().Faint(true)
+	wrap := lipgloss.NewStyle().Width(w - 6)
+	lines := []string{
+		bold.Render("Welcome to DiskTree"),
+		"",
+		wrap.Render("Folders are listed largest first. ↑/↓ move, Enter opens a folder, Backspace goes up, / filters and g jumps to any path."),
+		"",
+		wrap.Render("d moves the selection to DiskTree's trash; nothing is erased. u undoes deletes, renames and copies, one at a time, and ctrl+r redoes them. Large and protected items ask twice."),
+		"",
+		bold.Render("Trash") + "   " + getTrashDir(),
+		bold.Render("Config") + "  " + t.configPathOrDefault(),
+		"",
+		faint.Render("Press ? any time for all keys. Enter to start"),
+	}
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(1, 2).Width(w).Background(lipgloss.Color("0"))
+	return modalStyle.Render(strings.Join(lines, "\n"))
+}
+
+func (t tourOverlay) configPathOrDefault() string {
+	if t.configPath != "" {
+		return t.configPath
+	}
+	return defaultConfigPath()
+}
+
+func (t tourOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "enter", "esc", " ", "q", "?":
+		if t.configPath != "" {
+			if err := markTourSeen(t.configPath); err != nil {
+				m.status = "⚠ could not save config: " + err.Error()
+			}
+		}
+		if msg.String() == "?" {
+			m.overlays.push(helpOverlay{})
+		}
+		return nil, true
+	case "ctrl+c":
+		return m.quit(), true
+	}
+	return nil, false
+}
+
+// markTourSeen sets tour_seen in the config file at path, creating it if
+// needed and keeping the other settings.
+func markTourSeen(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	cfg.TourSeen = true
+	return saveConfig(path, cfg)
+}
+
+// saveConfig writes cfg to path as indented JSON.
+func saveConfig(path string, cfg Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
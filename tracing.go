@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --------------------------- Tracing -----------------------------
+
+// tracePhase is a part of a scan whose time is accounted separately.
+type tracePhase int
+
+const (
+	phaseReaddir   tracePhase = iota // listing directories
+	phaseStat                        // stat'ing files for their size
+	phaseAggregate                   // summing listings into subtree totals
+	phaseExport                      // writing export rows
+	numPhases
+)
+
+var phaseNames = [numPhases]string{"readdir", "stat", "aggregate", "export"}
+
+// phaseTotals accumulates one phase of a run. Workers run phases
+// concurrently, so busy (the summed time of every call) can exceed the
+// span from first to last.
+type phaseTotals struct {
+	calls atomic.Int64
+	busy  atomic.Int64 // nanoseconds
+	first atomic.Int64 // unix nanoseconds of the earliest start
+	last  atomic.Int64 // unix nanoseconds of the latest end
+}
+
+// tracer sends OpenTelemetry spans of scans and exports to an OTLP/HTTP
+// collector, enabled with -otel. Each scan or export is a span with one
+// child span per phase, running from the phase's first call to its last
+// and carrying the call count and summed busy time; per-call spans would
+// be millions on large trees. Spans are queued and sent in the background,
+// dropped when the collector can't keep up.
+type tracer struct {
+	endpoint string // full URL of the traces endpoint
+	header   http.Header
+	service  string
+	client   *http.Client
+	parent   traceParent // from TRACEPARENT, to join a pipeline's trace
+
+	queue   chan []otlpSpan
+	done    chan struct{}
+	mu      sync.Mutex // guards sending on queue against closing it
+	closed  bool
+	dropped atomic.Int64
+	failed  atomic.Int64
+}
+
+// traceParent is the trace a run belongs to, from a W3C traceparent header.
+type traceParent struct {
+	traceID string
+	spanID  string
+}
+
+// newTracer sets up OTLP/HTTP export of traces to endpoint, the collector's
+// base URL (/v1/traces is added unless the path already ends in it).
+// Headers and the service name come from the standard OTEL_EXPORTER_OTLP_HEADERS
+// and OTEL_SERVICE_NAME variables, and a TRACEPARENT variable makes the
+// runs children of the caller's span.
+func newTracer(endpoint string, getenv func(string) string) (*tracer, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("otel endpoint %q is not an http(s) URL", endpoint)
+	}
+	if !strings.HasSuffix(u.Path, "/v1/traces") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/traces"
+	}
+	t := &tracer{
+		endpoint: u.String(),
+		header:   http.Header{},
+		service:  "disktree",
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan []otlpSpan, 64),
+		done:     make(chan struct{}),
+	}
+	if s := getenv("OTEL_SERVICE_NAME"); s != "" {
+		t.service = s
+	}
+	for _, kv := range strings.Split(getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.TrimSpace(k) != "" {
+			v, _ = url.QueryUnescape(strings.TrimSpace(v))
+			t.header.Add(strings.TrimSpace(k), v)
+		}
+	}
+	t.parent, _ = parseTraceParent(getenv("TRACEPARENT"))
+	go t.loop()
+	return t, nil
+}
+
+// parseTraceParent reads a W3C traceparent value: version-traceid-spanid-flags.
+func parseTraceParent(s string) (traceParent, bool) {
+	f := strings.Split(strings.TrimSpace(s), "-")
+	if len(f) != 4 || len(f[1]) != 32 || len(f[2]) != 16 {
+		return traceParent{}, false
+	}
+	for _, id := range f[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.Trim(id, "0") == "" {
+			return traceParent{}, false
+		}
+	}
+	return traceParent{traceID: strings.ToLower(f[1]), spanID: strings.ToLower(f[2])}, true
+}
+
+// traceRun is one traced scan or export.
+type traceRun struct {
+	t      *tracer
+	name   string
+	path   string
+	start  time.Time
+	phases [numPhases]phaseTotals
+}
+
+type traceRunKey struct{}
+
+// begin starts a run, or returns nil when tracing is off. The returned
+// context carries the run to the walkers below it.
+func (t *tracer) begin(ctx context.Context, name, path string) (context.Context, *traceRun) {
+	if t == nil {
+		return ctx, nil
+	}
+	r := &traceRun{t: t, name: name, path: path, start: time.Now()}
+	return context.WithValue(ctx, traceRunKey{}, r), r
+}
+
+// traceRunFrom returns the run ctx belongs to, if any.
+func traceRunFrom(ctx context.Context) *traceRun {
+	r, _ := ctx.Value(traceRunKey{}).(*traceRun)
+	return r
+}
+
+// now starts timing a call; it costs nothing when r is nil.
+func (r *traceRun) now() time.Time {
+	if r == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// add accounts a call of phase p that started at t0 (from now).
+func (r *traceRun) add(p tracePhase, t0 time.Time) {
+	if r == nil {
+		return
+	}
+	end := time.Now()
+	ps := &r.phases[p]
+	ps.calls.Add(1)
+	ps.busy.Add(int64(end.Sub(t0)))
+	for s := t0.UnixNano(); ; {
+		f := ps.first.Load()
+		if f != 0 && f <= s || ps.first.CompareAndSwap(f, s) {
+			break
+		}
+	}
+	for e := end.UnixNano(); ; {
+		l := ps.last.Load()
+		if l >= e || ps.last.CompareAndSwap(l, e) {
+			break
+		}
+	}
+}
+
+// end finishes the run and queues its spans.
+func (r *traceRun) end(err error) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	traceID, parent := r.t.parent.traceID, r.t.parent.spanID
+	if traceID == "" {
+		traceID = randomHex(16)
+	}
+	root := otlpSpan{
+		TraceID:      traceID,
+		SpanID:       randomHex(8),
+		ParentSpanID: parent,
+		Name:         r.name,
+		Kind:         1, // internal
+		Start:        strconv.FormatInt(r.start.UnixNano(), 10),
+		End:          strconv.FormatInt(now.UnixNano(), 10),
+		Attributes:   []otlpAttr{stringAttr("disktree.path", r.path)},
+	}
+	if err != nil {
+		root.Status = &otlpStatus{Code: 2, Message: err.Error()}
+	}
+	spans := []otlpSpan{root}
+	for p := range r.phases {
+		ps := &r.phases[p]
+		if ps.calls.Load() == 0 {
+			continue
+		}
+		spans = append(spans, otlpSpan{
+			TraceID:      traceID,
+			SpanID:       randomHex(8),
+			ParentSpanID: root.SpanID,
+			Name:         phaseNames[p],
+			Kind:         1,
+			Start:        strconv.FormatInt(ps.first.Load(), 10),
+			End:          strconv.FormatInt(ps.last.Load(), 10),
+			Attributes: []otlpAttr{
+				intAttr("disktree.calls", ps.calls.Load()),
+				intAttr("disktree.busy_ms", time.Duration(ps.busy.Load()).Milliseconds()),
+			},
+		})
+	}
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.t.closed {
+		return // a scan that outlived the session
+	}
+	select {
+	case r.t.queue <- spans:
+	default:
+		r.t.dropped.Add(1)
+	}
+}
+
+// close sends what is queued, waiting at most timeout, and reports runs
+// that were lost.
+func (t *tracer) close(timeout time.Duration) string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	select {
+	case <-t.done:
+	case <-time.After(timeout):
+		return "otel: collector did not answer in time; some spans were not sent"
+	}
+	if n := t.dropped.Load() + t.failed.Load(); n > 0 {
+		return fmt.Sprintf("otel: %d traces could not be sent to %s", n, t.endpoint)
+	}
+	return ""
+}
+
+func (t *tracer) loop() {
+	defer close(t.done)
+	defer crashGuard()
+	for spans := range t.queue {
+		// take whatever else is waiting along in the same request
+		for more := true; more; {
+			select {
+			case s, ok := <-t.queue:
+				spans, more = append(spans, s...), ok
+			default:
+				more = false
+			}
+		}
+		if err := t.post(spans); err != nil {
+			t.failed.Add(1)
+		}
+	}
+}
+
+func (t *tracer) post(spans []otlpSpan) error {
+	body, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttr{
+			stringAttr("service.name", t.service),
+			stringAttr("service.version", version),
+		}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "disktree", Version: version}, Spans: spans}},
+	}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = t.header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The OTLP/JSON encoding of an export request, as far as disktree uses it.
+// Trace and span ids are hex and 64-bit numbers are strings.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID      string      `json:"traceId"`
+	SpanID       string      `json:"spanId"`
+	ParentSpanID string      `json:"parentSpanId,omitempty"`
+	Name         string      `json:"name"`
+	Kind         int         `json:"kind"`
+	Start        string      `json:"startTimeUnixNano"`
+	End          string      `json:"endTimeUnixNano"`
+	Attributes   []otlpAttr  `json:"attributes,omitempty"`
+	Status       *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 = error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func stringAttr(k, v string) otlpAttr {
+	return otlpAttr{Key: k, Value: otlpAnyValue{StringValue: &v}}
+}
+
+func intAttr(k string, v int64) otlpAttr {
+	s := strconv.FormatInt(v, 10)
+	return otlpAttr{Key: k, Value: otlpAnyValue{IntValue: &s}}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTracerSendsPhaseSpans(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"1", "a/2", "a/b/3"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var got []otlpTraces
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("X-Team") != "disk ops" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Header)
+		}
+		var tr otlpTraces
+		if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+			t.Errorf("bad body: %v", err)
+		}
+		mu.Lock()
+		got = append(got, tr)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_HEADERS": "X-Team=disk%20ops",
+		"TRACEPARENT":                "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	}
+	tr, err := newTracer(srv.URL, func(k string) string { return env[k] })
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 2, mounts: systemMounts(), netThreads: 1, root: root, trace: tr}
+	s.scan(context.Background(), root, false, nil)
+	if err := s.runDeepExport(context.Background(), root, filepath.Join(t.TempDir(), "out.csv"), exportOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg := tr.close(5 * time.Second); msg != "" {
+		t.Fatal(msg)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	spans := map[string][]otlpSpan{} // by parent
+	byName := map[string]otlpSpan{}
+	for _, tr := range got {
+		for _, rs := range tr.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, sp := range ss.Spans {
+					spans[sp.ParentSpanID] = append(spans[sp.ParentSpanID], sp)
+					if sp.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+						t.Errorf("span %s is not in the caller's trace", sp.Name)
+					}
+					if sp.ParentSpanID == "00f067aa0ba902b7" {
+						byName[sp.Name] = sp
+					}
+				}
+			}
+		}
+	}
+	want := map[string][]string{
+		"scan":   {"readdir", "stat", "aggregate"},
+		"export": {"readdir", "stat", "aggregate", "export"},
+	}
+	for run, phases := range want {
+		r, ok := byName[run]
+		if !ok {
+			t.Fatalf("no %s span under the caller's span", run)
+		}
+		kids := map[string]otlpSpan{}
+		for _, sp := range spans[r.SpanID] {
+			kids[sp.Name] = sp
+		}
+		for _, p := range phases {
+			sp, ok := kids[p]
+			if !ok {
+				t.Fatalf("%s has no %s span, got %v", run, p, kids)
+			}
+			start, _ := strconv.ParseInt(sp.Start, 10, 64)
+			end, _ := strconv.ParseInt(sp.End, 10, 64)
+			if start <= 0 || end < start {
+				t.Fatalf("%s/%s runs from %s to %s", run, p, sp.Start, sp.End)
+			}
+		}
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	if _, ok := parseTraceParent("00-00000000000000000000000000000000-00f067aa0ba902b7-01"); ok {
+		t.Errorf("an all-zero trace id is invalid")
+	}
+	if _, ok := parseTraceParent("garbage"); ok {
+		t.Errorf("garbage accepted")
+	}
+	if p, ok := parseTraceParent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"); !ok || p.spanID != "00f067aa0ba902b7" {
+		t.Errorf("unexpected %+v", p)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- Trash CLI ---------------------------
+
+// trashMetaSuffix is appended to a trashed item's path for its metadata.
+const trashMetaSuffix = ".meta.json"
+
+// trashID is a short, stable name for a trashed item: a hash of its name
+// inside the trash, which is unique there.
+func trashID(ti *TrashItem) string {
+	sum := sha1.Sum([]byte(filepath.Base(ti.TrashPath)))
+	return hex.EncodeToString(sum[:4])
+}
+
+// readTrash loads the metadata of every item in the trash directory dir,
+// newest first. Items whose data is gone are skipped; metadata written
+// before the trash was moved is pointed at the item next to it.
+func readTrash(dir string) ([]*TrashItem, error) {
+	ents, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []*TrashItem
+	for _, e := range ents {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), trashMetaSuffix) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		var ti TrashItem
+		if json.Unmarshal(b, &ti) != nil || ti.OrigPath == "" {
+			continue
+		}
+		ti.TrashPath = filepath.Join(dir, strings.TrimSuffix(e.Name(), trashMetaSuffix))
+		if _, err := os.Lstat(ti.TrashPath); err != nil {
+			continue
+		}
+		items = append(items, &ti)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// findTrashed returns the items matching each argument: an ID from `trash
+// list`, or an original path, which picks its most recently trashed copy.
+func findTrashed(items []*TrashItem, args []string) ([]*TrashItem, error) {
+	var out []*TrashItem
+	for _, a := range args {
+		var found *TrashItem
+		for _, ti := range items {
+			if trashID(ti) == a {
+				found = ti
+				break
+			}
+		}
+		if found == nil {
+			p := a
+			if abs, err := filepath.Abs(expandHome(a)); err == nil {
+				p = abs
+			}
+			for _, ti := range items {
+				if ti.OrigPath == p {
+					found = ti // newest first
+					break
+				}
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%s: no such item in the trash (see disktree trash list)", a)
+		}
+		out = append(out, found)
+	}
+	return out, nil
+}
+
+// runTrash implements `disktree trash list` and `disktree trash restore
+// <id|path>...`. Usage errors return errTrashUsage.
+func runTrash(args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errTrashUsage
+	}
+	items, err := readAllTrash()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list", "ls":
+		if len(args) != 1 {
+			return errTrashUsage
+		}
+		if len(items) == 0 {
+			fmt.Fprintln(w, "The trash is empty.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tDELETED\tSIZE\tORIGINAL PATH")
+		for _, ti := range items {
+			size := "-"
+			if ti.Size > 0 || !ti.IsDir {
+				size = humanBytes(trashedSize(ti))
+			}
+			orig := ti.OrigPath
+			if ti.IsDir {
+				orig += string(os.PathSeparator)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", trashID(ti), ti.DeletedAt.Local().Format(time.DateTime), size, orig)
+		}
+		return tw.Flush()
+	case "restore":
+		if len(args) < 2 {
+			return errTrashUsage
+		}
+		sel, err := findTrashed(items, args[1:])
+		if err != nil {
+			return err
+		}
+		for _, ti := range sel {
+			dst, err := restoreFromTrashTo(ti)
+			audit("restore", ti.OrigPath, dst, trashedSize(ti), err)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", ti.OrigPath, err)
+			}
+			if dst != ti.OrigPath {
+				fmt.Fprintf(w, "restored %s as %s (the original path is taken)\n", ti.OrigPath, dst)
+			} else {
+				fmt.Fprintf(w, "restored %s\n", dst)
+			}
+		}
+		return nil
+	}
+	return errTrashUsage
+}
+
+var errTrashUsage = errors.New("usage: disktree trash list | disktree trash restore <id|path>...")
+
+// trashedSize is the recorded size of ti, or the file's size when it was
+// trashed without one.
+func trashedSize(ti *TrashItem) int64 {
+	if ti.Size > 0 || ti.IsDir {
+		return ti.Size
+	}
+	if fi, err := os.Lstat(ti.TrashPath); err == nil {
+		return fi.Size()
+	}
+	return 0
+}
+
+// --------------------------- Trash on exit -----------------------
+
+// trashedThisSession returns the items deleted during the session that are
+// still in the trash, and their total size.
+func (m *model) trashedThisSession() ([]*TrashItem, int64) {
+	var items []*TrashItem
+	var size int64
+	for _, ti := range m.sessionTrash {
+		if _, err := os.Lstat(ti.TrashPath); err != nil {
+			continue // restored, or emptied by hand
+		}
+		items = append(items, ti)
+		size += trashedSize(ti)
+	}
+	return items, size
+}
+
+// quit ends the program, first asking what to do with this session's trash
+// unless -trash-on-exit says otherwise.
+func (m *model) quit() tea.Cmd {
+	if m.overlays.has("quit-trash") {
+		return nil
+	}
+	items, size := m.trashedThisSession()
+	if len(items) == 0 || m.trashOnExit == "keep" {
+		m.cancel()
+		return tea.Quit
+	}
+	if m.trashOnExit == "empty" {
+		m.cancel()
+		return emptyTrashed(items)
+	}
+	m.overlays.push(&quitTrashOverlay{items: items, size: size})
+	return nil
+}
+
+// trashEmptiedMsg ends the program once the session's trash is emptied.
+type trashEmptiedMsg struct{ err error }
+
+// emptyTrashed permanently removes items and their metadata.
+func emptyTrashed(items []*TrashItem) tea.Cmd {
+	return func() tea.Msg {
+		var errs []error
+		for _, ti := range items {
+			err := os.RemoveAll(ti.TrashPath)
+			audit("purge", ti.OrigPath, "", trashedSize(ti), err)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := os.Remove(ti.TrashPath + trashMetaSuffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+		return trashEmptiedMsg{err: errors.Join(errs...)}
+	}
+}
+
+// quitTrashOverlay asks at quit whether to empty what this session moved to
+// the trash: empty now, keep, or keep and never ask again.
+type quitTrashOverlay struct {
+	items []*TrashItem
+	size  int64
+	focus int // 0 = empty now, 1 = keep, 2 = always keep
+}
+
+func (o *quitTrashOverlay) opts() overlayOpts {
+	return overlayOpts{id: "quit-trash", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *quitTrashOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(m.popupWidth(66)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	noun := "items"
+	if len(o.items) == 1 {
+		noun = "item"
+	}
+	lines := []string{
+		fmt.Sprintf("Trash contains %s from this session (%d %s)", humanBytes(o.size), len(o.items), noun),
+		lipgloss.NewStyle().Faint(true).Render("The space is only freed once the trash is emptied."),
+	}
+	footer := buttonRow(o.focus, "Empty now", "Keep", "Always keep")
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", footer))
+}
+
+func (o *quitTrashOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "left", "h":
+		o.focus = maxvalue(0, o.focus-1)
+	case "right", "l":
+		o.focus = minvalue(2, o.focus+1)
+	case "tab":
+		o.focus = (o.focus + 1) % 3
+	case "esc":
+		m.status = "Quit canceled"
+		return nil, true
+	case "ctrl+c":
+		m.cancel()
+		return tea.Quit, true
+	case "enter":
+		switch o.focus {
+		case 0:
+			m.cancel()
+			m.status = fmt.Sprintf("Emptying %s from the trash ...", humanBytes(o.size))
+			return emptyTrashed(o.items), true
+		case 2:
+			m.trashOnExit = "keep"
+			cfg, err := loadConfig(m.configPath)
+			if err == nil {
+				cfg.TrashOnExit = "keep"
+				err = saveConfig(m.configPath, cfg)
+			}
+			if err != nil {
+				m.status = "⚠ could not save config: " + err.Error() + " — press q again to quit"
+				return nil, true
+			}
+		}
+		m.cancel()
+		return tea.Quit, true
+	}
+	return nil, false
+}
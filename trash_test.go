@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestTrashListAndRestore(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	work := t.TempDir()
+	gone := filepath.Join(work, "gone", "notes.txt")
+	kept := filepath.Join(work, "kept.log")
+	for p, size := range map[string]int{gone: 12, kept: 34} {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var ids []string
+	for _, p := range []string{gone, kept} {
+		ti, err := moveToTrash(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, trashID(ti))
+	}
+	// the notes' directory is deleted after the session
+	if err := os.Remove(filepath.Dir(gone)); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := runTrash([]string{"list"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{ids[0], ids[1], gone, kept, "12 B", "34 B"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("list output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := runTrash([]string{"restore", ids[0], kept}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{gone, kept} {
+		if _, err := os.Stat(p); err != nil {
+			t.Fatalf("%s should be restored: %v", p, err)
+		}
+	}
+	if items, _ := readTrash(getTrashDir()); len(items) != 0 {
+		t.Fatalf("trash should be empty after restoring everything, got %d items", len(items))
+	}
+
+	if err := runTrash([]string{"restore", ids[0]}, &out); err == nil || errors.Is(err, errTrashUsage) {
+		t.Fatalf("restoring a missing item should fail with a lookup error, got %v", err)
+	}
+	if err := runTrash([]string{"empty"}, &out); !errors.Is(err, errTrashUsage) {
+		t.Fatalf("unknown subcommand should be a usage error, got %v", err)
+	}
+}
+
+func TestQuitOffersToEmptySessionTrash(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir := t.TempDir()
+	trashFile := func(m *model, name string) *TrashItem {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, make([]byte, 2048), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.deleteToTrash(p)
+		return m.sessionTrash[len(m.sessionTrash)-1]
+	}
+	q := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'q'}}
+	isQuit := func(cmd tea.Cmd) bool {
+		if cmd == nil {
+			return false
+		}
+		_, ok := cmd().(tea.QuitMsg)
+		return ok
+	}
+
+	m := initialModel(dir, 1, false)
+	m.loading = false
+	m.configPath = filepath.Join(t.TempDir(), "config.json")
+	if _, cmd := m.Update(q); !isQuit(cmd) {
+		t.Fatalf("nothing trashed: q should quit right away")
+	}
+
+	m = initialModel(dir, 1, false)
+	m.loading = false
+	m.configPath = filepath.Join(t.TempDir(), "config.json")
+	ti := trashFile(m, "a.bin")
+	if _, cmd := m.Update(q); cmd != nil || !m.overlays.has("quit-trash") {
+		t.Fatalf("q should ask about the session's trash first")
+	}
+	if v := m.overlays.focused().View(m); !strings.Contains(v, "Trash contains 2.0 KB from this session") {
+		t.Fatalf("unexpected prompt:\n%s", v)
+	}
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	if m.overlays.has("quit-trash") || m.ctx.Err() != nil {
+		t.Fatalf("Esc should cancel quitting")
+	}
+	if _, err := os.Lstat(ti.TrashPath); err != nil {
+		t.Fatalf("nothing should be emptied on cancel: %v", err)
+	}
+
+	m = initialModel(dir, 1, false)
+	m.loading = false
+	m.configPath = filepath.Join(t.TempDir(), "config.json")
+	ti = trashFile(m, "b.bin")
+	m.Update(q)
+	o := m.overlays.focused().(*quitTrashOverlay)
+	cmd, closed := o.Update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	if !closed || cmd == nil {
+		t.Fatalf("Empty now should close the dialog and start emptying")
+	}
+	msg := cmd()
+	if _, err := os.Lstat(ti.TrashPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("trashed item should be gone, got %v", err)
+	}
+	if _, err := os.Lstat(ti.TrashPath + trashMetaSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("metadata should be gone, got %v", err)
+	}
+	if _, cmd := m.Update(msg); !isQuit(cmd) {
+		t.Fatalf("emptying should end in quitting")
+	}
+
+	m = initialModel(dir, 1, false)
+	m.loading = false
+	m.configPath = filepath.Join(t.TempDir(), "config.json")
+	trashFile(m, "c.bin")
+	m.Update(q)
+	m.Update(tea.KeyMsg{Type: tea.KeyRight})
+	m.Update(tea.KeyMsg{Type: tea.KeyRight})
+	if _, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter}); !isQuit(cmd) {
+		t.Fatalf("Always keep should quit")
+	}
+	if cfg, err := loadConfig(m.configPath); err != nil || cfg.TrashOnExit != "keep" {
+		t.Fatalf("Always keep should be saved, got %+v (%v)", cfg, err)
+	}
+}
+
+func TestStagedCopyIsAllOrNothing(t *testing.T) {
+	src := deepTree(t, 3)
+	dir := t.TempDir()
+
+	prev := maxTreeDepth
+	t.Cleanup(func() { maxTreeDepth = prev })
+	maxTreeDepth = 1
+	dst := filepath.Join(dir, "item")
+	if err := stageCopy(src, dst, true); !errors.Is(err, errTooDeep) {
+		t.Fatalf("stageCopy = %v, want the copy to fail", err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 0 {
+		t.Fatalf("a failed copy should leave nothing behind, found %s", ents[0].Name())
+	}
+
+	maxTreeDepth = prev
+	if err := stageCopy(src, dst, true); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dst, "d", "d", "d", "f")); err != nil || fi.Size() != 10 {
+		t.Fatalf("staged copy incomplete: %v", err)
+	}
+	if ents, _ := os.ReadDir(dir); len(ents) != 1 {
+		t.Fatalf("only the finished copy should remain, found %d entries", len(ents))
+	}
+
+	dead := filepath.Join(dir, stagingPrefix+"999999999-old")
+	mine := filepath.Join(dir, stagingPrefix+strconv.Itoa(os.Getpid())+"-busy")
+	for _, p := range []string{dead, mine} {
+		if err := os.Mkdir(p, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sweepStaging(dir)
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Error("a crashed process's staging copy should be swept")
+	}
+	if _, err := os.Stat(mine); err != nil {
+		t.Error("a running copy must not be swept")
+	}
+}
+
+func TestTrashDedup(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	logPath := withAuditLog(t)
+	work := t.TempDir()
+	build := filepath.Join(work, "build")
+	built := time.Now().Add(-time.Hour).Truncate(time.Second)
+	// trashes build with a file that never changes and one that does
+	trashBuild := func(gen string) *TrashItem {
+		t.Helper()
+		if err := os.MkdirAll(build, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(build, "lib.a"), []byte(strings.Repeat("x", 1000)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Join(build, "lib.a"), built, built); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(build, "stamp"), []byte(gen), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ti, err := moveToTrash(build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ti.Size = 1001
+		return ti
+	}
+
+	first := trashBuild("1")
+	second := trashBuild("2")
+	r := dedupTrash("link", second)
+	if r.linked != 1 || r.reclaimed != 1000 {
+		t.Fatalf("link: linked %d files, %d bytes; want 1 file, 1000 bytes", r.linked, r.reclaimed)
+	}
+	a, _ := os.Stat(filepath.Join(first.TrashPath, "lib.a"))
+	b, _ := os.Stat(filepath.Join(second.TrashPath, "lib.a"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Fatal("identical files are not hard-linked")
+	}
+	if got, _ := os.ReadFile(filepath.Join(second.TrashPath, "stamp")); string(got) != "2" {
+		t.Fatalf("changed file = %q; want the new content", got)
+	}
+
+	// a restored copy gets its own data back
+	if err := restoreFromTrash(first); err != nil {
+		t.Fatal(err)
+	}
+	r1, _ := os.Stat(filepath.Join(build, "lib.a"))
+	b, _ = os.Stat(filepath.Join(second.TrashPath, "lib.a"))
+	if r1 == nil || b == nil || os.SameFile(r1, b) || !r1.ModTime().Equal(built) {
+		t.Fatal("the restored file should be apart from the trashed copy, with its own times")
+	}
+	if err := os.RemoveAll(build); err != nil {
+		t.Fatal(err)
+	}
+
+	third := trashBuild("3")
+	m := initialModel(work, 1, false)
+	m.trashDedup = "latest"
+	m.sessionTrash = []*TrashItem{second, third}
+	m.journal.record(&journalOp{Kind: opTrash, Trash: second})
+	m.journal.record(&journalOp{Kind: opTrash, Trash: third})
+	note := m.dedupTrashed(third)
+	if !strings.Contains(note, "dropped its older copy") {
+		t.Fatalf("note = %q", note)
+	}
+	items, err := readTrash(getTrashDir())
+	if err != nil || len(items) != 1 || items[0].TrashPath != third.TrashPath {
+		t.Fatalf("trash after latest = %v, %v; want only the newest copy", items, err)
+	}
+	if len(m.sessionTrash) != 1 || len(m.journal.ops) != 1 || m.journal.next != 1 {
+		t.Fatalf("session trash %d, journal %d/%d; want the dropped copies forgotten", len(m.sessionTrash), m.journal.next, len(m.journal.ops))
+	}
+	entries, err := readAudit(logPath)
+	if err != nil || len(entries) != 1 || entries[0].Action != "purge" || entries[0].Path != build || entries[0].Result != "ok" {
+		t.Fatalf("audit = %+v, %v; want the dropped copy purged", entries, err)
+	}
+}
+
+func TestElevatedDeleteIsNotUndoable(t *testing.T) {
+	h := newTUIHarness(t, 120, 30)
+	zeta := filepath.Join(h.tmp, "zeta.log")
+	ti, err := moveToTrash(zeta) // as the helper would, but it stays ours here
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.send(elevatedTrashMsg{path: zeta, item: ti})
+	if h.m.journal.next != 0 || len(h.m.sessionTrash) != 0 {
+		t.Fatalf("journal %d, session trash %d; want neither to hold the root-owned item", h.m.journal.next, len(h.m.sessionTrash))
+	}
+	if !strings.Contains(h.m.status, "needs root") {
+		t.Fatalf("status %q should say the item needs root to restore", h.m.status)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// --------------------------- Trash dedup -------------------------
+
+// dedupResult is what a dedup pass reclaimed.
+type dedupResult struct {
+	dropped   []*TrashItem // older copies removed (latest)
+	linked    int          // files hard-linked (link)
+	reclaimed int64
+}
+
+// note is the status suffix for r, or "".
+func (r dedupResult) note() string {
+	switch {
+	case len(r.dropped) == 1:
+		return fmt.Sprintf(" — dropped its older copy from the trash (%s)", humanBytes(r.reclaimed))
+	case len(r.dropped) > 1:
+		return fmt.Sprintf(" — dropped %d older copies from the trash (%s)", len(r.dropped), humanBytes(r.reclaimed))
+	case r.linked > 0:
+		return fmt.Sprintf(" — %s hard-linked to its previous copy in the trash", humanBytes(r.reclaimed))
+	}
+	return ""
+}
+
+// olderCopies are the items in ti's trash directory trashed from the same
+// path before it, newest first.
+func olderCopies(ti *TrashItem) []*TrashItem {
+	items, _ := readTrash(filepath.Dir(ti.TrashPath))
+	var out []*TrashItem
+	for _, o := range items {
+		if o.TrashPath != ti.TrashPath && samePath(o.OrigPath, ti.OrigPath) && o.DeletedAt.Before(ti.DeletedAt) {
+			out = append(out, o)
+		}
+	}
+	return out
+}
+
+// dedupTrash applies -trash-dedup to ti, just moved to the trash, so a path
+// deleted again and again (a build directory that keeps coming back)
+// doesn't fill the trash with copies of itself:
+//
+//	off     keep every copy (default)
+//	latest  keep only the most recent copy of a path
+//	link    keep every copy, but hard-link files identical to the previous
+//	        copy's so each version costs only what changed
+//
+// Errors only cost the space; the new copy never loses data.
+func dedupTrash(mode string, ti *TrashItem) dedupResult {
+	var r dedupResult
+	if mode != "latest" && mode != "link" {
+		return r
+	}
+	older := olderCopies(ti)
+	if len(older) == 0 {
+		return r
+	}
+	if mode == "link" {
+		if prev := older[0]; prev.IsDir == ti.IsDir {
+			var linked []string
+			linked, r.reclaimed = linkIdentical(prev.TrashPath, ti.TrashPath)
+			r.linked = len(linked)
+			// both copies remember what they share, whichever is restored
+			for _, it := range []*TrashItem{prev, ti} {
+				if len(linked) > 0 {
+					it.Linked = slices.Compact(slices.Sorted(slices.Values(append(it.Linked, linked...))))
+					_ = writeTrashMeta(it.TrashPath, *it)
+				}
+			}
+		}
+		return r
+	}
+	for _, o := range older {
+		size := trashedSize(o)
+		o.Size = size // for the caller, once the item is gone
+		err := os.RemoveAll(o.TrashPath)
+		audit("purge", o.OrigPath, "", size, err)
+		if err != nil {
+			continue
+		}
+		_ = os.Remove(o.TrashPath + trashMetaSuffix)
+		r.dropped = append(r.dropped, o)
+		r.reclaimed += size
+	}
+	return r
+}
+
+// linkIdentical replaces each regular file under dst whose counterpart at
+// the same place under src has the same content, mode, owner and
+// modification time with a hard link to it, so the link is faithful to
+// both. It returns the linked files, relative to dst, and their size.
+func linkIdentical(src, dst string) ([]string, int64) {
+	var linked []string
+	var size int64
+	_ = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return nil
+		}
+		old := filepath.Join(src, rel)
+		nfi, err1 := d.Info()
+		ofi, err2 := os.Lstat(old)
+		if err1 != nil || err2 != nil || !ofi.Mode().IsRegular() || ofi.Size() != nfi.Size() || nfi.Size() == 0 || os.SameFile(ofi, nfi) {
+			return nil
+		}
+		if ofi.Mode() != nfi.Mode() || !ofi.ModTime().Equal(nfi.ModTime()) || !sameOwner(ofi, nfi) {
+			return nil
+		}
+		if same, err := sameContent(old, p); err != nil || !same {
+			return nil
+		}
+		tmp := p + ".dedup" + uniqueSuffix()
+		if os.Link(old, tmp) != nil {
+			return nil // e.g. a filesystem without hard links
+		}
+		if os.Rename(tmp, p) != nil {
+			_ = os.Remove(tmp)
+			return nil
+		}
+		linked = append(linked, rel)
+		size += nfi.Size()
+		return nil
+	})
+	return linked, size
+}
+
+// sameOwner reports whether a and b have the same owner and group, where
+// files have them.
+func sameOwner(a, b fs.FileInfo) bool {
+	au, ag, aok := fileOwner(a)
+	bu, bg, bok := fileOwner(b)
+	return aok == bok && au == bu && ag == bg
+}
+
+// unshareLinked gives each file of the trashed item at trashPath that it
+// shares with another copy (TrashItem.Linked) its own data again, before
+// the item is restored: editing the restored file must not change the copy
+// still in the trash. Copies keep mode, owner and times, and so do the
+// directories they are in.
+func unshareLinked(trashPath string) error {
+	b, err := os.ReadFile(trashPath + trashMetaSuffix)
+	if err != nil {
+		return nil // no record, nothing linked
+	}
+	var ti TrashItem
+	if json.Unmarshal(b, &ti) != nil {
+		return nil
+	}
+	for _, rel := range ti.Linked {
+		p := filepath.Join(trashPath, rel)
+		if !underPath(p, trashPath) {
+			continue
+		}
+		fi, err := os.Lstat(p)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue // gone since, or purged by hand
+		}
+		dir, dfi := filepath.Dir(p), fs.FileInfo(nil)
+		if rel != "." {
+			dfi, _ = os.Lstat(dir)
+		}
+		tmp := filepath.Join(dir, ".unshare"+uniqueSuffix())
+		if err := copyFile(p, tmp); err != nil {
+			_ = os.Remove(tmp)
+			return fmt.Errorf("copying %s apart from the other trashed copy: %w", rel, err)
+		}
+		if err := os.Rename(tmp, p); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+		if dfi != nil {
+			_ = os.Chtimes(dir, dfi.ModTime(), dfi.ModTime())
+		}
+	}
+	return nil
+}
+
+// sameContent reports whether the files a and b hold the same bytes.
+func sameContent(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	ba, bb := make([]byte, 64<<10), make([]byte, 64<<10)
+	for {
+		na, errA := io.ReadFull(fa, ba)
+		nb, errB := io.ReadFull(fb, bb)
+		if na != nb || !bytes.Equal(ba[:na], bb[:nb]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			return false, errB
+		}
+	}
+}
+
+// dedupTrashed runs -trash-dedup on ti, trashed this session, and keeps the
+// session's records in step: dropped copies leave the journal (there is
+// nothing left to restore) and count as freed for good.
+func (m *model) dedupTrashed(ti *TrashItem) string {
+	r := dedupTrash(m.trashDedup, ti)
+	for _, o := range r.dropped {
+		size := trashedSize(o)
+		m.journal.forget(o.TrashPath)
+		if i := slices.IndexFunc(m.sessionTrash, func(s *TrashItem) bool { return s.TrashPath == o.TrashPath }); i >= 0 {
+			m.sessionTrash = slices.Delete(m.sessionTrash, i, i+1)
+			m.freed.inTrash = max(0, m.freed.inTrash-size)
+		} else {
+			m.freed.removed(size) // trashed by an earlier session
+		}
+	}
+	return r.note()
+}
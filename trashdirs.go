@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// --------------------------- Trash location ----------------------
+
+// trashRoute sends deletes from below mount to the trash directory dir, so
+// a big scratch volume can keep its own trash and deletes there stay fast
+// renames instead of copies to the home volume.
+type trashRoute struct {
+	mount, dir string
+}
+
+var (
+	// trashDirOverride replaces the default trash directory (-trash-dir)
+	trashDirOverride string
+	// trashRoutes are the trash_mounts of the config, longest mount first
+	trashRoutes []trashRoute
+)
+
+// configureTrash sets where deletes go from -trash-dir (or trash_dir) and
+// the config's trash_mounts.
+func configureTrash(dir string, mounts map[string]string) error {
+	trashDirOverride = ""
+	if dir != "" {
+		abs, err := filepath.Abs(expandHome(dir))
+		if err != nil {
+			return fmt.Errorf("-trash-dir: %w", err)
+		}
+		trashDirOverride = abs
+	}
+	trashRoutes = nil
+	for mount, d := range mounts {
+		if mount == "" || d == "" {
+			return fmt.Errorf("trash_mounts: %q → %q: both the mount and the trash directory are needed", mount, d)
+		}
+		m, err := filepath.Abs(expandHome(mount))
+		if err != nil {
+			return fmt.Errorf("trash_mounts: %w", err)
+		}
+		td, err := filepath.Abs(expandHome(d))
+		if err != nil {
+			return fmt.Errorf("trash_mounts: %w", err)
+		}
+		trashRoutes = append(trashRoutes, trashRoute{mount: m, dir: td})
+	}
+	sort.Slice(trashRoutes, func(i, j int) bool {
+		if len(trashRoutes[i].mount) != len(trashRoutes[j].mount) {
+			return len(trashRoutes[i].mount) > len(trashRoutes[j].mount)
+		}
+		return trashRoutes[i].mount < trashRoutes[j].mount
+	})
+	return nil
+}
+
+// configureTrashFrom applies the default config's trash settings, for the
+// subcommands that run before flags and config are read.
+func configureTrashFrom(path string) {
+	if cfg, err := loadConfig(path); err == nil {
+		_ = configureTrash(cfg.TrashDir, cfg.TrashMounts)
+		auditLog = cfg.AuditLog
+	}
+}
+
+// trashDirFor is the trash directory a delete of path lands in: that of
+// the deepest trash_mounts entry containing it, else the default trash.
+func trashDirFor(path string) string {
+	for _, r := range trashRoutes {
+		root := filepath.Dir(r.mount) == r.mount && filepath.VolumeName(path) == filepath.VolumeName(r.mount)
+		if root || underPath(path, r.mount) {
+			return r.dir
+		}
+	}
+	return getTrashDir()
+}
+
+// trashDirs are every trash directory items may be in, the default first.
+// The trash of an older version's data directory (legacyDataDir) is last, so
+// what was deleted before an upgrade is still listed and restorable.
+func trashDirs() []string {
+	dirs := []string{getTrashDir()}
+	extra := make([]string, 0, len(trashRoutes)+1)
+	for _, r := range trashRoutes {
+		extra = append(extra, r.dir)
+	}
+	if d := legacyDataDir(); d != "" {
+		extra = append(extra, filepath.Join(d, "trash"))
+	}
+	for _, e := range extra {
+		dup := false
+		for _, d := range dirs {
+			dup = dup || samePath(d, e)
+		}
+		if !dup {
+			dirs = append(dirs, e)
+		}
+	}
+	return dirs
+}
+
+// readAllTrash is readTrash over every trash directory, newest first.
+func readAllTrash() ([]*TrashItem, error) {
+	var items []*TrashItem
+	for _, d := range trashDirs() {
+		its, err := readTrash(d)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, its...)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// --------------------------- UAC elevation -----------------------
+
+// On Windows there is no sudo to pipe through: an elevated process is
+// started with a UAC prompt (ShellExecuteEx "runas") and can't write to our
+// stdout. So the helper gets its paths in a file (-sum-batch) and writes
+// its reports to another (-sum-out), and one prompt sizes every folder a
+// scan of C:\ couldn't read.
+
+// errUACCanceled is returned when the UAC prompt was declined.
+var errUACCanceled = errors.New("canceled at the UAC prompt")
+
+// batchReport is one folder's totals in the -sum-out file.
+type batchReport struct {
+	Path string `json:"path"`
+	sumReport
+}
+
+// runSumBatch is the body of the -sum-batch helper: it sizes each path
+// listed in list, one per line, and writes the reports to out.
+func runSumBatch(list, out string, s *Scanner) error {
+	data, err := os.ReadFile(list)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for p := range strings.Lines(string(data)) {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if err := enc.Encode(batchReport{Path: p, sumReport: sumReportOf(s.sumDir(context.Background(), p))}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readBatchReports reads a -sum-out file.
+func readBatchReports(path string) ([]batchReport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var reps []batchReport
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var r batchReport
+		if err := dec.Decode(&r); err != nil {
+			return reps, err
+		}
+		reps = append(reps, r)
+	}
+	return reps, nil
+}
+
+type uacDoneMsg struct {
+	reports []batchReport
+	err     error
+}
+
+// uacTargets are the children of n that couldn't be listed.
+func uacTargets(n *Node) []string {
+	if n == nil {
+		return nil
+	}
+	var paths []string
+	for _, c := range n.Children {
+		if c.NoAccess {
+			paths = append(paths, c.Path)
+		}
+	}
+	return paths
+}
+
+// offerUAC asks, once per session, to size the folders a finished scan of
+// n couldn't read as administrator. Only where a UAC prompt can elevate.
+func (m *model) offerUAC(n *Node) {
+	if m.uacOffered || !uacAvailable() {
+		return
+	}
+	if paths := uacTargets(n); len(paths) > 0 {
+		m.uacOffered = true
+		m.overlays.push(&uacOverlay{paths: paths, focus: 0})
+	}
+}
+
+// rescanUAC sizes paths through a helper started with a UAC prompt. It
+// runs in the background: the prompt is a window of its own.
+func (m *model) rescanUAC(paths []string) tea.Cmd {
+	self, err := os.Executable()
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "disktree-uac-")
+	if err != nil {
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	list, out := filepath.Join(dir, "paths.txt"), filepath.Join(dir, "sums.jsonl")
+	if err := os.WriteFile(list, []byte(strings.Join(paths, "\n")+"\n"), 0o600); err != nil {
+		os.RemoveAll(dir)
+		m.status = "⚠ " + err.Error()
+		return nil
+	}
+	args := append([]string{"-sum-batch", list, "-sum-out", out}, m.scanner.helperArgs()...)
+	if len(paths) == 1 {
+		m.status = fmt.Sprintf("Sizing %s as administrator — confirm the UAC prompt ...", paths[0])
+	} else {
+		m.status = fmt.Sprintf("Sizing %d folders as administrator — confirm the UAC prompt ...", len(paths))
+	}
+	return func() tea.Msg {
+		defer os.RemoveAll(dir)
+		if err := runElevated(self, args); err != nil {
+			return uacDoneMsg{err: err}
+		}
+		reps, err := readBatchReports(out)
+		return uacDoneMsg{reports: reps, err: err}
+	}
+}
+
+// applyUAC merges the helper's totals like an elevated rescan.
+func (m *model) applyUAC(msg uacDoneMsg) {
+	if errors.Is(msg.err, errUACCanceled) {
+		m.status = "Canceled at the UAC prompt; unreadable folders keep an unknown size"
+		return
+	}
+	var total int64
+	for _, r := range msg.reports {
+		m.applyElevated(elevatedDoneMsg{path: r.Path, rep: r.sumReport})
+		total += r.Size
+	}
+	switch {
+	case msg.err != nil && len(msg.reports) == 0:
+		m.status = "⚠ elevated rescan failed: " + msg.err.Error()
+	case len(msg.reports) > 1:
+		m.status = fmt.Sprintf("Sized %d folders as administrator: %s [elevated]", len(msg.reports), humanBytes(total))
+	}
+	if msg.err != nil && len(msg.reports) > 0 {
+		m.status += " ⚠ " + msg.err.Error()
+	}
+}
+
+// uacOverlay offers to size the folders a scan couldn't read through UAC.
+type uacOverlay struct {
+	paths []string
+	focus int // 0 = elevate, 1 = not now
+}
+
+func (o *uacOverlay) opts() overlayOpts {
+	return overlayOpts{id: "uac", z: zDialog, dim: true, focusable: true}
+}
+
+func (o *uacOverlay) View(m *model) string {
+	modalStyle := lipgloss.NewStyle().Border(lipgloss.DoubleBorder()).Padding(1, 2).Width(m.popupWidth(64)).Align(lipgloss.Center).Background(lipgloss.Color("0"))
+	warn := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	names := make([]string, 0, 3)
+	for _, p := range o.paths[:min(3, len(o.paths))] {
+		names = append(names, filepath.Base(p))
+	}
+	list := strings.Join(names, ", ")
+	if len(o.paths) > 3 {
+		list += fmt.Sprintf(" and %d more", len(o.paths)-3)
+	}
+	what := "1 folder needs administrator rights"
+	if len(o.paths) > 1 {
+		what = fmt.Sprintf("%d folders need administrator rights", len(o.paths))
+	}
+	lines := []string{
+		what,
+		warn.Render(list),
+		"Size them as administrator? One UAC prompt covers all of them; nothing else runs elevated",
+	}
+	return modalStyle.Render(lipgloss.JoinVertical(lipgloss.Center, strings.Join(lines, "\n"), "", buttonRow(o.focus, "Size as administrator", "Not now")))
+}
+
+func (o *uacOverlay) Update(m *model, msg tea.KeyMsg) (tea.Cmd, bool) {
+	switch msg.String() {
+	case "left", "h":
+		o.focus = 0
+	case "right", "l":
+		o.focus = 1
+	case "tab":
+		o.focus = (o.focus + 1) % 2
+	case "enter":
+		if o.focus != 0 {
+			m.status = "Press ! on an unreadable folder to size it as administrator"
+			return nil, true
+		}
+		return m.rescanUAC(o.paths), true
+	case "esc":
+		m.status = ""
+		return nil, true
+	}
+	return nil, false
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "errors"
+
+// UAC is Windows only; elsewhere elevated rescans go through sudo or
+// pkexec (elevate.go).
+func uacAvailable() bool { return false }
+
+func runElevated(string, []string) error { return errors.ErrUnsupported }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSumBatchRoundTrip(t *testing.T) {
+	cache = sync.Map{}
+	tmp := t.TempDir()
+	a, b := filepath.Join(tmp, "a"), filepath.Join(tmp, "b")
+	for i, d := range []string{a, b} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "f"), make([]byte, 10*(i+1)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, out := filepath.Join(tmp, "paths.txt"), filepath.Join(tmp, "sums.jsonl")
+	if err := os.WriteFile(list, []byte(a+"\n\n"+b+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := runSumBatch(list, out, &Scanner{threads: 2}); err != nil {
+		t.Fatal(err)
+	}
+	reps, err := readBatchReports(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reps) != 2 || reps[0].Path != a || reps[0].Size != 10 || reps[1].Path != b || reps[1].Size != 20 {
+		t.Fatalf("reports = %+v; want a 10 bytes, b 20 bytes", reps)
+	}
+}
+
+func TestApplyUACMergesReports(t *testing.T) {
+	tmp := t.TempDir()
+	m := initialModel(tmp, 2, false)
+	sys := &Node{Name: "System Volume Information", Path: filepath.Join(tmp, "System Volume Information"), IsDir: true, Size: -1, NoAccess: true}
+	rec := &Node{Name: "$Recycle.Bin", Path: filepath.Join(tmp, "$Recycle.Bin"), IsDir: true, Size: -1, NoAccess: true}
+	ok := &Node{Name: "Users", Path: filepath.Join(tmp, "Users"), IsDir: true, Size: 5, Files: 1}
+	m.current = &Node{Name: filepath.Base(tmp), Path: tmp, IsDir: true, Children: []*Node{sys, ok, rec}, Scanned: true}
+
+	if got := uacTargets(m.current); len(got) != 2 || got[0] != sys.Path || got[1] != rec.Path {
+		t.Fatalf("uacTargets = %v; want the two unreadable folders", got)
+	}
+
+	m.applyUAC(uacDoneMsg{reports: []batchReport{
+		{Path: sys.Path, sumReport: sumReport{Size: 100, Files: 2}},
+		{Path: rec.Path, sumReport: sumReport{Size: 50, Files: 1}},
+	}})
+	if sys.NoAccess || sys.Size != 100 || rec.NoAccess || rec.Size != 50 {
+		t.Fatalf("children not updated: %+v %+v", sys, rec)
+	}
+	if m.current.Size != 155 || m.current.Files != 4 {
+		t.Fatalf("parent totals = %d bytes, %d files; want 155, 4", m.current.Size, m.current.Files)
+	}
+	if !strings.Contains(m.status, "Sized 2 folders") {
+		t.Fatalf("status = %q", m.status)
+	}
+	if len(uacTargets(m.current)) != 0 {
+		t.Fatal("merged folders still offered for a UAC rescan")
+	}
+
+	m.applyUAC(uacDoneMsg{err: errUACCanceled})
+	if !strings.Contains(m.status, "Canceled") {
+		t.Fatalf("status after a declined prompt = %q", m.status)
+	}
+}
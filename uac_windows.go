@@ -0,0 +1,85 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procShellExecuteEx = windows.NewLazySystemDLL("shell32.dll").NewProc("ShellExecuteExW")
+
+// shellExecuteInfo is SHELLEXECUTEINFOW.
+type shellExecuteInfo struct {
+	cbSize      uint32
+	fMask       uint32
+	hwnd        windows.Handle
+	verb        *uint16
+	file        *uint16
+	parameters  *uint16
+	directory   *uint16
+	show        int32
+	instApp     windows.Handle
+	idList      uintptr
+	class       *uint16
+	keyClass    windows.Handle
+	hotKey      uint32
+	iconMonitor windows.Handle
+	process     windows.Handle
+}
+
+const (
+	seeMaskNoCloseProcess = 0x00000040
+	seeMaskNoAsync        = 0x00000100
+)
+
+// uacAvailable reports whether a UAC prompt could give us rights we lack.
+func uacAvailable() bool {
+	return !windows.GetCurrentProcessToken().IsElevated()
+}
+
+// runElevated runs exe with args elevated through a UAC prompt and waits
+// for it to exit.
+func runElevated(exe string, args []string) error {
+	verb, _ := windows.UTF16PtrFromString("runas")
+	file, err := windows.UTF16PtrFromString(exe)
+	if err != nil {
+		return err
+	}
+	params, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(args))
+	if err != nil {
+		return err
+	}
+	info := shellExecuteInfo{
+		fMask:      seeMaskNoCloseProcess | seeMaskNoAsync,
+		verb:       verb,
+		file:       file,
+		parameters: params,
+		show:       windows.SW_HIDE,
+	}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+	if ok, _, err := procShellExecuteEx.Call(uintptr(unsafe.Pointer(&info))); ok == 0 {
+		if errors.Is(err, windows.ERROR_CANCELLED) {
+			return errUACCanceled
+		}
+		return err
+	}
+	if info.process == 0 {
+		return errors.New("the elevated helper did not start")
+	}
+	defer windows.CloseHandle(info.process)
+	if _, err := windows.WaitForSingleObject(info.process, windows.INFINITE); err != nil {
+		return err
+	}
+	var code uint32
+	if err := windows.GetExitCodeProcess(info.process, &code); err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("the elevated helper exited with code %d", code)
+	}
+	return nil
+}
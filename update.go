@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// --------------------------- Version and self-update -------------
+
+// releaseAPI is the GitHub API endpoint for the latest release.
+const releaseAPI = "https://api.github.com/repos/jvanrhyn/disktree/releases/latest"
+
+func init() {
+	// `go install ...@v1.2.3` records the module version even without ldflags
+	if version == "dev" {
+		if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			version = bi.Main.Version
+		}
+	}
+}
+
+// runVersion prints the version and the build details embedded by the Go
+// toolchain (`disktree version`).
+func runVersion(w io.Writer) {
+	fmt.Fprintf(w, "disktree %s\n", version)
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, s := range bi.Settings {
+			settings[s.Key] = s.Value
+		}
+		if rev := settings["vcs.revision"]; rev != "" {
+			if settings["vcs.modified"] == "true" {
+				rev += " (modified)"
+			}
+			fmt.Fprintf(w, "  commit:  %s\n", rev)
+		}
+		if t := settings["vcs.time"]; t != "" {
+			fmt.Fprintf(w, "  built:   %s\n", t)
+		}
+	}
+	fmt.Fprintf(w, "  go:      %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// releaseAssetName is the binary CI publishes for a platform.
+func releaseAssetName(goos, goarch string) string {
+	name := fmt.Sprintf("disktree-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// updater replaces the running binary with the latest release.
+type updater struct {
+	client *http.Client
+	api    string // latest release endpoint
+	exe    string // binary to replace
+	goos   string
+	goarch string
+}
+
+func newUpdater() (*updater, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	return &updater{client: &http.Client{Timeout: 2 * time.Minute}, api: releaseAPI, exe: exe, goos: runtime.GOOS, goarch: runtime.GOARCH}, nil
+}
+
+// run downloads the release binary for this platform, checks it against the
+// release's checksums.txt and swaps it in (`disktree self-update`).
+func (u *updater) run(w io.Writer) error {
+	var rel githubRelease
+	if err := u.getJSON(u.api, &rel); err != nil {
+		return fmt.Errorf("looking up the latest release: %w", err)
+	}
+	if rel.TagName == version {
+		fmt.Fprintf(w, "disktree %s is the latest release\n", version)
+		return nil
+	}
+	want := releaseAssetName(u.goos, u.goarch)
+	var binURL, sumsURL string
+	for _, a := range rel.Assets {
+		switch a.Name {
+		case want:
+			binURL = a.URL
+		case "checksums.txt":
+			sumsURL = a.URL
+		}
+	}
+	if binURL == "" {
+		return fmt.Errorf("release %s has no binary for %s/%s", rel.TagName, u.goos, u.goarch)
+	}
+	if sumsURL == "" {
+		return fmt.Errorf("release %s has no checksums.txt; refusing to install an unverified binary", rel.TagName)
+	}
+	sum, err := u.checksumFor(sumsURL, want)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Downloading disktree %s (%s) ...\n", rel.TagName, want)
+	tmp, err := u.download(binURL, sum)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(u.exe, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	fmt.Fprintf(w, "Updated %s from %s to %s\n", u.exe, version, rel.TagName)
+	return nil
+}
+
+func (u *updater) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "disktree/"+version)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+func (u *updater) getJSON(url string, v any) error {
+	resp, err := u.get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// checksumFor finds name's SHA-256 in a sha256sum-style checksums file.
+func (u *updater) checksumFor(url, name string) (string, error) {
+	resp, err := u.get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// download saves url next to the executable and verifies its SHA-256.
+func (u *updater) download(url, sum string) (string, error) {
+	resp, err := u.get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	f, err := os.CreateTemp(filepath.Dir(u.exe), ".disktree-update-*")
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+			err = fmt.Errorf("checksum mismatch for downloaded binary: got %s, want %s", got, sum)
+		}
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o755)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// replaceExecutable moves newBin over exe. A running binary can't be
+// overwritten on Windows, so the old one is renamed aside first.
+func replaceExecutable(exe, newBin string) error {
+	old := exe + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newBin, exe); err != nil {
+		if rerr := os.Rename(old, exe); rerr != nil {
+			return errors.Join(err, rerr)
+		}
+		return err
+	}
+	// Windows keeps the running image locked; the .old file goes next time
+	_ = os.Remove(old)
+	return nil
+}
+
+// runSelfUpdate is the `disktree self-update` command.
+func runSelfUpdate(w io.Writer) error {
+	u, err := newUpdater()
+	if err != nil {
+		return err
+	}
+	return u.run(w)
+}
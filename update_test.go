@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// releaseServer serves a fake latest release for linux/amd64 with the given
+// binary and the checksum listed for it.
+func releaseServer(t *testing.T, bin []byte, sum string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprintf(w, `{"tag_name":"v9.9.9","assets":[{"name":"disktree-linux-amd64","browser_download_url":"%[1]s/bin"},{"name":"checksums.txt","browser_download_url":"%[1]s/sums"}]}`, srv.URL)
+		case "/bin":
+			_, _ = w.Write(bin)
+		case "/sums":
+			fmt.Fprintf(w, "%s  disktree-darwin-arm64\n%s  disktree-linux-amd64\n", strings.Repeat("0", 64), sum)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSelfUpdateVerifiesChecksum(t *testing.T) {
+	newBin := []byte("#!/bin/sh\necho new\n")
+	h := sha256.Sum256(newBin)
+	good := hex.EncodeToString(h[:])
+
+	for _, tc := range []struct {
+		name    string
+		sum     string
+		wantErr string
+		want    string
+	}{
+		{"installs", good, "", string(newBin)},
+		{"mismatch", strings.Repeat("ab", 32), "checksum mismatch", "old"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			exe := filepath.Join(t.TempDir(), "disktree")
+			if err := os.WriteFile(exe, []byte("old"), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			srv := releaseServer(t, newBin, tc.sum)
+			u := &updater{client: srv.Client(), api: srv.URL + "/latest", exe: exe, goos: "linux", goarch: "amd64"}
+			err := u.run(io.Discard)
+			if tc.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+			got, err := os.ReadFile(exe)
+			if err != nil || string(got) != tc.want {
+				t.Fatalf("executable = %q, %v; want %q", got, err, tc.want)
+			}
+			// no temp or backup files left behind
+			if ents, _ := os.ReadDir(filepath.Dir(exe)); len(ents) != 1 {
+				t.Fatalf("expected only the executable, found %d entries", len(ents))
+			}
+		})
+	}
+}
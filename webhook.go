@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --------------------------- Scan webhook ------------------------
+
+// webhookEvent is one entry of a webhook batch. A run sends "start", a
+// "dir" for every directory as its subtree is summed, and "done" last.
+type webhookEvent struct {
+	Type  string `json:"type"`
+	Path  string `json:"path,omitempty"`
+	Depth int    `json:"depth,omitempty"`
+	Size  int64  `json:"size,omitempty"`
+	Files int64  `json:"files,omitempty"`
+	Dirs  int64  `json:"dirs,omitempty"`
+	Error string `json:"error,omitempty"`
+	// done only
+	Rows      int64 `json:"rows,omitempty"`
+	ElapsedMS int64 `json:"elapsed_ms,omitempty"`
+}
+
+// webhookBatch is the body of one POST.
+type webhookBatch struct {
+	Run    string         `json:"run"` // the same for every batch of a run
+	Root   string         `json:"root"`
+	Seq    int            `json:"seq"` // 1, 2, ... in the order sent
+	Events []webhookEvent `json:"events"`
+}
+
+// webhook streams scan events to an HTTP endpoint while a headless export
+// runs, so dashboards can follow long scans. Events are queued without
+// blocking the walk and POSTed as JSON batches every interval, or sooner
+// once a batch is full. A batch that still fails after a few tries is
+// dropped and counted; the scan never waits on the endpoint.
+type webhook struct {
+	url      string
+	header   http.Header
+	client   *http.Client
+	interval time.Duration
+	batch    int
+	run      string
+	root     string
+	started  time.Time
+
+	mu      sync.Mutex
+	pending []webhookEvent
+	kick    chan struct{} // a batch is full
+	stop    chan struct{}
+	done    chan struct{}
+
+	// owned by the sending goroutine until done is closed
+	seq     int
+	sent    int
+	failed  int
+	lastErr error
+}
+
+// webhookRetries is how many times a batch is tried before it is dropped.
+const webhookRetries = 3
+
+// newWebhook checks the endpoint and "Name: value" headers given on the
+// command line.
+func newWebhook(endpoint string, headers []string, interval time.Duration, batch int) (*webhook, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook %q is not an http(s) URL", endpoint)
+	}
+	h := http.Header{}
+	for _, kv := range headers {
+		k, v, ok := strings.Cut(kv, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("webhook header %q is not Name: value", kv)
+		}
+		h.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("webhook interval must be positive")
+	}
+	if batch <= 0 {
+		return nil, fmt.Errorf("webhook batch size must be positive")
+	}
+	return &webhook{
+		url:      endpoint,
+		header:   h,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		interval: interval,
+		batch:    batch,
+	}, nil
+}
+
+// start begins a run over root and the goroutine that sends it.
+func (h *webhook) start(root string) {
+	if h == nil {
+		return
+	}
+	h.root = root
+	h.started = time.Now()
+	host, _ := os.Hostname()
+	h.run = fmt.Sprintf("%s-%d-%d", host, os.Getpid(), h.started.UnixNano())
+	h.kick = make(chan struct{}, 1)
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	h.add(webhookEvent{Type: "start", Path: root})
+	go h.loop()
+}
+
+// add queues ev for the next batch.
+func (h *webhook) add(ev webhookEvent) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.pending = append(h.pending, ev)
+	full := len(h.pending) >= h.batch
+	h.mu.Unlock()
+	if full {
+		select {
+		case h.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// dir queues the summary of a directory whose subtree is complete.
+func (h *webhook) dir(r exportRow) {
+	ev := webhookEvent{Type: "dir", Path: r.Path, Depth: r.Depth, Size: r.Size, Files: r.Files, Dirs: r.Dirs}
+	if r.Err != nil {
+		ev.Error = r.Err.Error()
+	}
+	h.add(ev)
+}
+
+// finish queues the "done" event, sends everything still queued and
+// returns a one-line account of the run.
+func (h *webhook) finish(rows int64, err error) string {
+	if h == nil {
+		return ""
+	}
+	ev := webhookEvent{Type: "done", Rows: rows, ElapsedMS: time.Since(h.started).Milliseconds()}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	h.add(ev)
+	close(h.stop)
+	<-h.done
+	s := fmt.Sprintf("Webhook: %d batches sent to %s", h.sent, h.url)
+	if h.failed > 0 {
+		s += fmt.Sprintf(", %d dropped (%v)", h.failed, h.lastErr)
+	}
+	return s
+}
+
+func (h *webhook) loop() {
+	defer close(h.done)
+	defer crashGuard()
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-h.kick:
+		case <-h.stop:
+			for h.flush() {
+			}
+			return
+		}
+		for h.flush() {
+		}
+	}
+}
+
+// flush sends up to one batch of queued events and reports whether more
+// are waiting.
+func (h *webhook) flush() bool {
+	h.mu.Lock()
+	n := min(len(h.pending), h.batch)
+	evs := h.pending[:n:n]
+	h.pending = h.pending[n:]
+	more := len(h.pending) > 0
+	h.mu.Unlock()
+	if n == 0 {
+		return false
+	}
+	h.seq++
+	body, err := json.Marshal(webhookBatch{Run: h.run, Root: h.root, Seq: h.seq, Events: evs})
+	if err == nil {
+		err = h.post(body)
+	}
+	if err != nil {
+		h.failed++
+		h.lastErr = err
+	} else {
+		h.sent++
+	}
+	return more
+}
+
+// post sends one batch, trying again after a short pause when the request
+// fails or the endpoint answers with an error status.
+func (h *webhook) post(body []byte) error {
+	var err error
+	for try := 0; try < webhookRetries; try++ {
+		if try > 0 {
+			time.Sleep(time.Duration(try) * 500 * time.Millisecond)
+		}
+		var req *http.Request
+		req, err = http.NewRequestWithContext(context.Background(), http.MethodPost, h.url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header = h.header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "disktree")
+		var resp *http.Response
+		resp, err = h.client.Do(req)
+		if err != nil {
+			continue
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		err = fmt.Errorf("%s", resp.Status)
+	}
+	return err
+}
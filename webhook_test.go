@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHeadlessExportWebhook(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a/x", "a/y", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{"a/x/1", "a/y/2", "b/3"} {
+		if err := os.WriteFile(filepath.Join(root, f), []byte("1234"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	var batches []webhookBatch
+	fails := 1 // the first request is refused and must be retried
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer t" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected headers %v", r.Header)
+		}
+		if fails > 0 {
+			fails--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var b webhookBatch
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &b); err != nil {
+			t.Errorf("bad batch %s: %v", body, err)
+		}
+		batches = append(batches, b)
+	}))
+	defer srv.Close()
+
+	hook, err := newWebhook(srv.URL, []string{"Authorization: Bearer t"}, time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Scanner{threads: 2, mounts: systemMounts(), netThreads: 1, root: root}
+	var out strings.Builder
+	if err := s.runHeadlessExport(root, filepath.Join(t.TempDir(), "out.csv"), exportOptions{}, hook, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// start + 4 dirs + root + done = 7 events in batches of 3
+	if len(batches) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(batches))
+	}
+	var evs []webhookEvent
+	for i, b := range batches {
+		if b.Seq != i+1 || b.Run != batches[0].Run || b.Root != root {
+			t.Fatalf("batch %d has seq %d run %q root %q", i, b.Seq, b.Run, b.Root)
+		}
+		evs = append(evs, b.Events...)
+	}
+	if evs[0].Type != "start" || evs[len(evs)-1].Type != "done" || evs[len(evs)-1].Rows != 7 {
+		t.Fatalf("expected start first and done last, got %+v", evs)
+	}
+	dirs := map[string]webhookEvent{}
+	for _, e := range evs {
+		if e.Type == "dir" {
+			dirs[e.Path] = e
+		}
+	}
+	if a := dirs[filepath.Join(root, "a")]; a.Size != 8 || a.Files != 2 || a.Dirs != 2 {
+		t.Fatalf("unexpected summary of a: %+v", a)
+	}
+	// the root is summed last, after all of its subdirectories
+	if r, ok := dirs[root]; !ok || r.Size != 12 || evs[len(evs)-2].Path != root {
+		t.Fatalf("expected the root summary before done, got %+v", evs)
+	}
+	if !strings.Contains(out.String(), "Webhook: 3 batches sent") {
+		t.Fatalf("unexpected report %q", out.String())
+	}
+}
+
+func TestNewWebhookRejectsBadInput(t *testing.T) {
+	for _, tc := range []struct {
+		url    string
+		header string
+	}{
+		{"ftp://example.com/x", "A: b"},
+		{"localhost:8080", "A: b"},
+		{"http://example.com/x", "no colon"},
+	} {
+		if _, err := newWebhook(tc.url, []string{tc.header}, time.Second, 10); err == nil {
+			t.Errorf("newWebhook(%q, %q) should fail", tc.url, tc.header)
+		}
+	}
+}
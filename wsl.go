@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// --------------------------- WSL ---------------------------------
+
+// Under WSL the Windows drives are mounted at /mnt/c and so on over 9p (or
+// drvfs on WSL 1), where every stat is a round trip to the Windows host and
+// a scan is many times slower than on Windows itself. A Windows build of
+// disktree can do the sizing instead: Windows programs run from WSL, so the
+// walk of each directory is handed to "disktree.exe -sum-json C:\..." as it
+// is for elevated rescans.
+
+var (
+	wslOnce sync.Once
+	wsl     bool
+)
+
+// inWSL reports whether this process runs inside WSL, checked once.
+func inWSL() bool {
+	wslOnce.Do(func() {
+		wsl = runtime.GOOS == "linux" && detectWSL(os.Getenv, os.ReadFile)
+	})
+	return wsl
+}
+
+// detectWSL looks for the variables WSL sets and for Microsoft's kernel.
+func detectWSL(getenv func(string) string, readFile func(string) ([]byte, error)) bool {
+	if getenv("WSL_DISTRO_NAME") != "" || getenv("WSL_INTEROP") != "" {
+		return true
+	}
+	b, err := readFile("/proc/sys/kernel/osrelease")
+	return err == nil && strings.Contains(strings.ToLower(string(b)), "microsoft")
+}
+
+// windowsDrive returns the Windows root (e.g. `C:\`) of a drive mount, or
+// false when mi is not one.
+func windowsDrive(mi mountInfo) (string, bool) {
+	t := strings.ToLower(mi.FSType)
+	if t != "9p" && t != "drvfs" {
+		return "", false
+	}
+	src := mi.Source
+	switch {
+	case len(src) >= 2 && src[1] == ':' && isDriveLetter(src[0]):
+		return strings.ToUpper(src[:1]) + `:\`, true
+	case strings.HasPrefix(src, `\\`):
+		return strings.TrimSuffix(src, `\`) + `\`, true // a mapped network share
+	}
+	// some versions name the source "drvfs"; the mount point still says
+	if b := path.Base(mi.Point); len(b) == 1 && isDriveLetter(b[0]) && path.Dir(mi.Point) == "/mnt" {
+		return strings.ToUpper(b) + `:\`, true
+	}
+	return "", false
+}
+
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// wslWindowsPath translates p into the path Windows programs know it by:
+// /mnt/c/Users becomes C:\Users, and files of the Linux side are reached
+// through the distribution's \\wsl$ share.
+func wslWindowsPath(t *mountTable, distro, p string) (string, bool) {
+	p = filepath.Clean(p)
+	mi := t.lookup(p)
+	if root, ok := windowsDrive(mi); ok {
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, mi.Point), "/")
+		return root + strings.ReplaceAll(rel, "/", `\`), true
+	}
+	if distro == "" || !filepath.IsAbs(p) {
+		return "", false
+	}
+	return `\\wsl$\` + distro + strings.ReplaceAll(p, "/", `\`), true
+}
+
+// wslBridge sizes directories on Windows drives with a native helper.
+type wslBridge struct {
+	mounts *mountTable
+	helper string      // Windows build of disktree; "" when none was found
+	native atomic.Bool // size Windows drives with helper instead of over 9p
+	failed atomic.Int64
+}
+
+// newWSLBridge sets up the bridge when running inside WSL, and returns nil
+// elsewhere. helper is -wsl-helper: a path, "auto" to look for
+// disktree.exe on the PATH and next to this binary, or "off".
+func newWSLBridge(helper string) *wslBridge {
+	if !inWSL() {
+		return nil
+	}
+	b := &wslBridge{mounts: systemMounts()}
+	switch helper {
+	case "off":
+	case "", "auto":
+		if p, err := exec.LookPath("disktree.exe"); err == nil {
+			b.helper = p
+		} else if self, err := os.Executable(); err == nil {
+			if p := filepath.Join(filepath.Dir(self), "disktree.exe"); fileExists(p) {
+				b.helper = p
+			}
+		}
+	default:
+		b.helper = helper
+		b.native.Store(true) // asked for by name
+	}
+	return b
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// onWindowsDrive reports whether p lives on a Windows drive.
+func (b *wslBridge) onWindowsDrive(p string) bool {
+	if b == nil {
+		return false
+	}
+	_, ok := windowsDrive(b.mounts.lookup(p))
+	return ok
+}
+
+// sum sizes the directory p with the helper when native sizing is on and p
+// is on a Windows drive. It reports false when the walk should go over 9p
+// after all, including when the helper fails.
+func (b *wslBridge) sum(ctx context.Context, p string, s *Scanner) (dirSum, bool) {
+	if b == nil || b.helper == "" || !b.native.Load() {
+		return dirSum{}, false
+	}
+	w, ok := wslWindowsPath(b.mounts, "", p)
+	if !ok {
+		return dirSum{}, false
+	}
+	args := []string{"-sum-json", w, "-threads", fmt.Sprint(s.threads)}
+	if s.excludeHidden {
+		args = append(args, "-exclude-hidden")
+	}
+	if s.allocated {
+		args = append(args, "-allocated")
+	}
+	args = append(args, fmt.Sprintf("-xattrs=%t", s.xattrs), fmt.Sprintf("-compressed=%t", s.diskSizes))
+	args = append(args, s.sampling.args()...)
+	args = append(args, s.exclude.args()...)
+	var out bytes.Buffer
+	c := exec.CommandContext(ctx, b.helper, args...)
+	c.Stdout = &out
+	var rep sumReport
+	if err := c.Run(); err != nil || json.Unmarshal(out.Bytes(), &rep) != nil {
+		if ctx.Err() == nil {
+			b.failed.Add(1)
+		}
+		return dirSum{}, false
+	}
+	res := dirSum{size: rep.Size, files: rep.Files, dirs: rep.Dirs, exclusive: rep.Exclusive, margin: rep.Margin}
+	if rep.Err != "" {
+		res.err = errors.New(rep.Err)
+	}
+	return res, true
+}
+
+// wslTag is the header note for a directory on a Windows drive: a warning
+// about 9p, and how to avoid it.
+func (m *model) wslTag() string {
+	b := m.scanner.wsl
+	if m.current == nil || !b.onWindowsDrive(m.current.Path) {
+		return ""
+	}
+	switch {
+	case b.helper == "":
+		return "[Windows drive over 9p: slow, see -wsl-helper]"
+	case !b.native.Load():
+		return "[Windows drive over 9p: slow, W to size natively]"
+	case b.failed.Load() > 0:
+		return fmt.Sprintf("[native sizing failed %d times, used 9p]", b.failed.Load())
+	}
+	return "[Windows drive: sized by " + filepath.Base(b.helper) + "]"
+}
+
+// toggleWSLNative switches native sizing of Windows drives and rescans the
+// current directory when it is on one.
+func (m *model) toggleWSLNative() tea.Cmd {
+	b := m.scanner.wsl
+	switch {
+	case b == nil:
+		m.status = "Not running in WSL"
+		return nil
+	case b.helper == "":
+		m.status = "⚠ No Windows build of disktree found: put disktree.exe on the Windows PATH or pass -wsl-helper"
+		return nil
+	}
+	on := !b.native.Load()
+	b.native.Store(on)
+	b.failed.Store(0)
+	m.status = "Windows drives are sized over 9p"
+	if on {
+		m.status = "Windows drives are sized by " + b.helper
+	}
+	if m.current == nil || !b.onWindowsDrive(m.current.Path) {
+		return nil
+	}
+	return m.rescanCurrent(false)
+}
+
+// wslExplorer opens p in Explorer, selected in its folder when reveal is
+// set. It reports false outside WSL or when p has no Windows path.
+func wslExplorer(p string, reveal bool) (bool, error) {
+	if !inWSL() {
+		return false, nil
+	}
+	w, ok := wslWindowsPath(systemMounts(), os.Getenv("WSL_DISTRO_NAME"), p)
+	if !ok {
+		return false, nil
+	}
+	if reveal {
+		return true, startDetached("explorer.exe", "/select,"+w)
+	}
+	return true, startDetached("explorer.exe", w)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectWSL(t *testing.T) {
+	noFile := func(string) ([]byte, error) { return nil, errors.New("missing") }
+	kernel := func(release string) func(string) ([]byte, error) {
+		return func(string) ([]byte, error) { return []byte(release), nil }
+	}
+	env := func(k, v string) func(string) string {
+		return func(name string) string {
+			if name == k {
+				return v
+			}
+			return ""
+		}
+	}
+	for _, tc := range []struct {
+		getenv   func(string) string
+		readFile func(string) ([]byte, error)
+		want     bool
+	}{
+		{env("WSL_DISTRO_NAME", "Ubuntu"), noFile, true},
+		{env("WSL_INTEROP", "/run/WSL/1_interop"), noFile, true},
+		{env("", ""), kernel("5.15.153.1-microsoft-standard-WSL2\n"), true},
+		{env("", ""), kernel("4.4.0-19041-Microsoft\n"), true},
+		{env("", ""), kernel("6.8.0-45-generic\n"), false},
+		{env("", ""), noFile, false},
+	} {
+		if got := detectWSL(tc.getenv, tc.readFile); got != tc.want {
+			t.Errorf("detectWSL = %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestWSLWindowsPath(t *testing.T) {
+	mt := newMountTable([]mountInfo{
+		{Point: "/", FSType: "ext4", Source: "/dev/sdc"},
+		{Point: "/mnt/c", FSType: "9p", Source: `C:\`},
+		{Point: "/mnt/d", FSType: "9p", Source: "drvfs"},
+		{Point: "/mnt/share", FSType: "drvfs", Source: `\\nas\media`},
+	})
+	for _, tc := range []struct {
+		distro, in, want string
+		ok               bool
+	}{
+		{"", "/mnt/c/Users/me/AppData", `C:\Users\me\AppData`, true},
+		{"", "/mnt/c", `C:\`, true},
+		{"", "/mnt/d/games", `D:\games`, true},
+		{"", "/mnt/share/films/x.mkv", `\\nas\media\films\x.mkv`, true},
+		{"Ubuntu", "/home/me/src", `\\wsl$\Ubuntu\home\me\src`, true},
+		{"", "/home/me/src", "", false},
+	} {
+		got, ok := wslWindowsPath(mt, tc.distro, tc.in)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("wslWindowsPath(%q) = %q, %v; want %q, %v", tc.in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestWSLNativeSizing(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake helper is a shell script")
+	}
+	root := t.TempDir()
+	for _, d := range []string{"big", "small"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "small", "f"), []byte("123"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// the helper answers for big only and fails for everything else
+	helper := filepath.Join(t.TempDir(), "disktree.exe")
+	script := "#!/bin/sh\ncase \"$2\" in\n" +
+		"'C:\\big') echo '{\"size\":5000,\"files\":7,\"dirs\":2,\"exclusive\":10}' ;;\n" +
+		"*) exit 1 ;;\nesac\n"
+	if err := os.WriteFile(helper, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	b := &wslBridge{mounts: newMountTable([]mountInfo{{Point: root, FSType: "9p", Source: `C:\`}}), helper: helper}
+	s := &Scanner{threads: 2, netThreads: 1, root: root, wsl: b}
+
+	sizes := func() map[string]int64 {
+		n, _ := s.scan(context.Background(), root, false, nil)
+		out := map[string]int64{}
+		for _, c := range n.Children {
+			out[c.Name] = c.Size
+		}
+		return out
+	}
+	if got := sizes(); got["big"] != 0 || got["small"] != 3 {
+		t.Fatalf("native sizing is off until asked for, got %v", got)
+	}
+	b.native.Store(true)
+	if got := sizes(); got["big"] != 5000 || got["small"] != 3 {
+		t.Fatalf("expected big from the helper and small over 9p, got %v", got)
+	}
+	if b.failed.Load() != 1 {
+		t.Fatalf("the failed helper run should be counted, got %d", b.failed.Load())
+	}
+
+	m := initialModel(root, 1, false)
+	t.Cleanup(m.cancel)
+	m.scanner.wsl = b
+	m.current = &Node{Path: filepath.Join(root, "big"), IsDir: true}
+	if tag := m.wslTag(); !strings.Contains(tag, "failed 1 times") {
+		t.Fatalf("unexpected tag %q", tag)
+	}
+	b.native.Store(false)
+	if tag := m.wslTag(); !strings.Contains(tag, "W to size natively") {
+		t.Fatalf("unexpected tag %q", tag)
+	}
+	m.current = &Node{Path: "/elsewhere", IsDir: true}
+	if tag := m.wslTag(); tag != "" {
+		t.Fatalf("no note off Windows drives, got %q", tag)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"jvanrhyn.dev/disktree/scanner"
+)
+
+// --------------------------- Extended attributes -----------------
+
+// fileSize is the size a walk counts for the file fi at path: its length
+// or allocated size, plus its extended attributes with -xattrs.
+func (s *Scanner) fileSize(path string, fi fs.FileInfo) int64 {
+	size := scanner.FileSize(fi, s.allocated)
+	if s.xattrs {
+		size += scanner.XattrSize(path)
+	}
+	return size
+}
+
+// xattrDetail describes the extended attributes of the file at path for
+// the details view, largest first; "" when it has none or they can't be
+// read.
+func xattrDetail(path string, counted bool) string {
+	attrs, err := scanner.Xattrs(path)
+	if err != nil || len(attrs) == 0 {
+		return ""
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Size > attrs[j].Size })
+	var total int64
+	for _, a := range attrs {
+		total += a.Size
+	}
+	s := fmt.Sprintf("%s in %d", humanBytes(total), len(attrs))
+	if len(attrs) == 1 {
+		s += " attribute"
+	} else {
+		s += " attributes"
+	}
+	var top []string
+	for _, a := range attrs[:min(3, len(attrs))] {
+		name := a.Name
+		if name == scanner.ResourceFork {
+			name = "resource fork"
+		}
+		top = append(top, name+" "+humanBytes(a.Size))
+	}
+	s += " (" + strings.Join(top, ", ")
+	if len(attrs) > 3 {
+		s += ", …"
+	}
+	s += ")"
+	if !counted {
+		s += " — not in its size (see -xattrs)"
+	}
+	return s
+}